@@ -24,6 +24,7 @@ import (
 	"os"
 	"os/signal"
 	"strings"
+	"syscall"
 
 	"github.com/Loopring/relay/cmd/utils"
 	"github.com/Loopring/relay/config"
@@ -51,6 +52,8 @@ func startNode(ctx *cli.Context) error {
 	signalChan := make(chan os.Signal, 1)
 	signal.Notify(signalChan, os.Interrupt)
 	signal.Notify(signalChan, os.Kill)
+	reloadChan := make(chan os.Signal, 1)
+	signal.Notify(reloadChan, syscall.SIGHUP)
 	go func() {
 		for {
 			select {
@@ -60,6 +63,11 @@ func startNode(ctx *cli.Context) error {
 					n.Stop()
 				}
 				os.Exit(1)
+			case <-reloadChan:
+				log.Info("captured SIGHUP, reloading config...")
+				if nil != n {
+					reloadConfig(ctx, n)
+				}
 			}
 		}
 	}()
@@ -76,6 +84,16 @@ func startNode(ctx *cli.Context) error {
 	return nil
 }
 
+// reloadConfig 配置文件校验失败时保留原配置继续运行
+func reloadConfig(ctx *cli.Context, n *node.Node) {
+	defer func() {
+		if err := recover(); nil != err {
+			log.Errorf("reload config error:%v", err)
+		}
+	}()
+	n.Reload(utils.SetGlobalConfig(ctx))
+}
+
 func unlockAccount(ctx *cli.Context, globalConfig *config.GlobalConfig) {
 	if "full" == globalConfig.Mode || "miner" == globalConfig.Mode {
 		unlockAccs := []accounts.Account{}
@@ -88,14 +88,21 @@ type GlobalConfig struct {
 	MarketCap      MarketCapOptions
 	UserManager    UserManagerOptions
 	AccountManager AccountManagerOptions
+	TxManager      TxManagerOptions
 }
 
 type AccountManagerOptions struct {
-	CacheDuration int64
+	CacheDuration     int64
+	TrackPermitExpiry bool
+}
+
+type TxManagerOptions struct {
+	DisabledPersistence []string
 }
 
 type JsonrpcOptions struct {
-	Port string
+	Port      string
+	AdminPort string // 运维接口(如区块重放)端口, 只监听127.0.0.1, 为空时不开启
 }
 
 type WebsocketOptions struct {
@@ -110,6 +117,10 @@ type OrderManagerOptions struct {
 	CutoffCacheExpireTime int64
 	CutoffCacheCleanTime  int64
 	DustOrderValue        int64
+	ProtocolVersion       string  // 多版本部署时, 非空则只处理该版本协议的事件
+	ImbalanceWindow       int64   // 统计买卖成交量的时间窗口(秒)
+	ImbalanceThreshold    float64 // 一侧成交量占比达到该值时发出MarketImbalance, 0表示关闭
+	CancelConfirmBlocks   int64   // cancel事件确认块数, 期间分叉回滚的cancel不会移除订单, 0表示立即处理
 }
 
 type IpfsOptions struct {
@@ -130,15 +141,53 @@ func (opts IpfsOptions) Url() string {
 type AccessorOptions struct {
 	RawUrls           []string `required:"true"`
 	FetchTxRetryCount int
+	RetryMaxAttempts  int
+	RetryBaseDelay    int64 // ms
+	RetryMaxDelay     int64 // ms
+	LogsChunkSize     int64 // blocks per eth_getLogs request
 }
 
 type ExtractorOptions struct {
-	StartBlockNumber   *big.Int
-	EndBlockNumber     *big.Int
-	ConfirmBlockNumber uint64
-	ForkWaitingTime    int64
-	Debug              bool
-	Open               bool
+	StartBlockNumber       *big.Int
+	EndBlockNumber         *big.Int
+	ConfirmBlockNumber     uint64
+	ForkWaitingTime        int64
+	ReorgTxCheck           bool
+	ReorgTrackDepth        int64
+	FeeTolerance           float64
+	RawHexAmounts          bool   // 序列化事件时额外输出hex格式的金额, 避免js客户端丢失精度
+	RouteContractTransfers bool   // 合约之间的transfer单独发到ContractTransfer
+	ContractCodeCacheSize  int    // 缓存是否合约地址的数量, 超出时淘汰最久未访问的, 0使用默认值
+	SnapshotFile           string // 停止时保存processor状态, 重启时从中恢复
+	RouteProtocolVersion   bool   // 协议事件额外按版本发出, 供各版本的ordermanager订阅
+	EmitTransferEdges      bool   // 输出TransferEdge事件, 供分析构建转账图
+	PausedTokenFailures    int    // 同一token连续失败的transfer达到该数量时发出TokenPaused, 0不检测
+	EmitBlockFillStats     bool   // 每个块结束时发出BlockFillStats汇总该块的成交
+	Debug                  bool
+	Open                   bool
+
+	// 只注册列出的合约method/event名称, 为空时全部注册
+	EnabledHandlers []string
+
+	// 已废弃的协议版本, 合约地址仍然识别, 但不再转发ringMined/cancel/cutoff事件
+	DeprecatedProtocolVersions []string
+
+	// blockTime为0时按块号查询区块头时间
+	FetchMissingBlockTime bool
+
+	// 按(TxHash, LogIndex)去重的区块窗口, 扫块层重复投递的日志只处理一次, 0不去重
+	EventDedupWindow int64
+
+	// 追块时每次通过eth_getLogs扫描的块数, 区间内没有已注册事件的块只处理区块头,
+	// 其中的method调用(如失败的交易)及eth转账不再解析, 0不启用
+	CatchUpLogsRange int64
+
+	// 每个owner每秒(按区块时间)在原topic发出的transfer/approve事件数, 超出部分改发到AccountEventOverflow, 0不限制
+	OwnerEventRate  float64
+	OwnerEventBurst int
+
+	// 垃圾/空投token合约地址, 其transfer/approve不发出也不记录, 可通过SetSpamContracts运行时更新
+	SpamContracts []string
 }
 
 type KeyStoreOptions struct {
@@ -206,6 +255,11 @@ type MarketOptions struct {
 	TokenFile             string
 	OldVersionWethAddress string
 	CronJobLock           bool
+	MinFillSize           map[string]string // market -> base token amount
+	DecimalsRefreshCron   string            // 定期重新读取可升级token的decimals, 为空时不刷新
+	MaxTokens             int               // 内存中token数量上限, 超出时淘汰最久没有transfer的非市场token, 0为不限制
+	RegisterDebounce      int               // 毫秒, 合并连续的TokenRegistered, 静默后只重建一次市场, 0为每次立即重建
+	TapeBufferSize        int               // 每个成交明细(tape)订阅者的缓冲条数, 订阅者消费不及时时丢弃新成交, 0为默认值
 }
 
 type MarketCapOptions struct {
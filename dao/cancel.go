@@ -34,6 +34,7 @@ type CancelEvent struct {
 	CreateTime      int64  `gorm:"column:create_time"`
 	AmountCancelled string `gorm:"column:amount_cancelled;type:varchar(40)"`
 	LogIndex        int64  `gorm:"column:log_index"`
+	TxIndex         int64  `gorm:"column:tx_index"`
 	Fork            bool   `gorm:"column:fork"`
 }
 
@@ -47,6 +48,7 @@ func (e *CancelEvent) ConvertDown(src *types.OrderCancelledEvent) error {
 	e.CreateTime = src.BlockTime
 	e.BlockNumber = src.BlockNumber.Int64()
 	e.LogIndex = src.TxLogIndex
+	e.TxIndex = src.TxIndex
 
 	return nil
 }
@@ -61,6 +63,7 @@ func (e *CancelEvent) ConvertUp(dst *types.OrderCancelledEvent) error {
 	dst.BlockTime = e.CreateTime
 	dst.BlockNumber = big.NewInt(e.BlockNumber)
 	dst.TxLogIndex = e.LogIndex
+	dst.TxIndex = e.TxIndex
 
 	return nil
 }
@@ -36,6 +36,7 @@ type CutOffEvent struct {
 	BlockNumber     int64  `gorm:"column:block_number"`
 	Cutoff          int64  `gorm:"column:cutoff"`
 	LogIndex        int64  `gorm:"column:log_index"`
+	TxIndex         int64  `gorm:"column:tx_index"`
 	Fork            bool   `gorm:"column:fork"`
 	CreateTime      int64  `gorm:"column:create_time"`
 }
@@ -48,6 +49,7 @@ func (e *CutOffEvent) ConvertDown(src *types.CutoffEvent) error {
 	e.TxHash = src.TxHash.Hex()
 	e.Cutoff = src.Cutoff.Int64()
 	e.LogIndex = src.TxLogIndex
+	e.TxIndex = src.TxIndex
 	e.BlockNumber = src.BlockNumber.Int64()
 	e.CreateTime = src.BlockTime
 
@@ -69,6 +71,7 @@ func (e *CutOffEvent) ConvertUp(dst *types.CutoffEvent) error {
 	dst.TxHash = common.HexToHash(e.TxHash)
 	dst.BlockNumber = big.NewInt(e.BlockNumber)
 	dst.TxLogIndex = e.LogIndex
+	dst.TxIndex = e.TxIndex
 	dst.Cutoff = big.NewInt(e.Cutoff)
 	dst.BlockTime = e.CreateTime
 	dst.OrderHashList = []common.Hash{}
@@ -36,6 +36,7 @@ type CutOffPairEvent struct {
 	OrderHashList   string `gorm:"column:order_hash_list;type:text"`
 	BlockNumber     int64  `gorm:"column:block_number"`
 	LogIndex        int64  `gorm:"column:log_index"`
+	TxIndex         int64  `gorm:"column:tx_index"`
 	Cutoff          int64  `gorm:"column:cutoff"`
 	CreateTime      int64  `gorm:"column:create_time"`
 	Fork            bool   `gorm:"column:fork"`
@@ -51,6 +52,7 @@ func (e *CutOffPairEvent) ConvertDown(src *types.CutoffPairEvent) error {
 	e.Token2 = src.Token2.Hex()
 	e.Cutoff = src.Cutoff.Int64()
 	e.LogIndex = src.TxLogIndex
+	e.TxIndex = src.TxIndex
 	e.BlockNumber = src.BlockNumber.Int64()
 	e.CreateTime = src.BlockTime
 
@@ -75,6 +77,7 @@ func (e *CutOffPairEvent) ConvertUp(dst *types.CutoffPairEvent) error {
 	dst.BlockNumber = big.NewInt(e.BlockNumber)
 	dst.Cutoff = big.NewInt(e.Cutoff)
 	dst.TxLogIndex = e.LogIndex
+	dst.TxIndex = e.TxIndex
 	dst.BlockTime = e.CreateTime
 	dst.OrderHashList = []common.Hash{}
 
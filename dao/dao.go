@@ -82,6 +82,8 @@ func (s *RdsServiceImpl) Prepare() {
 	tables = append(tables, &TransactionEntity{})
 	tables = append(tables, &TransactionView{})
 	tables = append(tables, &CheckPoint{})
+	tables = append(tables, &Token{})
+	tables = append(tables, &MarketConfig{})
 	//tables = append(tables, &RingMinedMethod{})
 
 	for _, t := range tables {
@@ -49,6 +49,7 @@ type FillEvent struct {
 	SplitB          string `gorm:"column:split_b;type:varchar(40)" json:"splitB"`
 	Market          string `gorm:"column:market;type:varchar(42)" json:"market"`
 	LogIndex        int64  `gorm:"column:log_index"`
+	TxIndex         int64  `gorm:"column:tx_index"`
 	Fork            bool   `gorm:"column:fork"`
 	Side            string `gorm:"column:side" json:"side"`
 	OrderType       string `gorm:"column:order_type" json:"orderType"`
@@ -77,6 +78,7 @@ func (f *FillEvent) ConvertDown(src *types.OrderFilledEvent) error {
 	f.Owner = src.Owner.Hex()
 	f.FillIndex = src.FillIndex.Int64()
 	f.LogIndex = src.TxLogIndex
+	f.TxIndex = src.TxIndex
 	f.Market = src.Market
 
 	return nil
@@ -105,6 +107,7 @@ func (f *FillEvent) ConvertUp(dst *types.OrderFilledEvent) error {
 	dst.Owner = common.HexToAddress(f.Owner)
 	dst.FillIndex = big.NewInt(f.FillIndex)
 	dst.TxLogIndex = f.LogIndex
+	dst.TxIndex = f.TxIndex
 	dst.Market = f.Market
 
 	return nil
@@ -178,6 +181,17 @@ func (s *RdsServiceImpl) QueryRecentFills(market, owner string, start int64, end
 	return
 }
 
+// 通过用户订单关联成交记录, 不区分市场
+func (s *RdsServiceImpl) GetFillsByOwner(owner string, start, end int64) (fills []FillEvent, err error) {
+	orderhashs := s.db.Model(&Order{}).Select("order_hash").Where("owner = ?", owner).QueryExpr()
+	query := s.db.Where("order_hash in (?)", orderhashs).Where("fork=?", false)
+	if timeQuery := buildTimeQueryString(start, end); timeQuery != "" {
+		query = query.Where(timeQuery)
+	}
+	err = query.Order("create_time desc").Find(&fills).Error
+	return
+}
+
 func buildTimeQueryString(start, end int64) string {
 	rst := ""
 	if start != 0 && end == 0 {
@@ -19,6 +19,7 @@
 package dao
 
 import (
+	"context"
 	txtyp "github.com/Loopring/relay/txmanager/types"
 	"github.com/Loopring/relay/types"
 	"github.com/ethereum/go-ethereum/common"
@@ -44,9 +45,12 @@ type RdsService interface {
 	// order table
 	GetOrderByHash(orderhash common.Hash) (*Order, error)
 	GetOrdersByHash(orderhashs []string) (map[string]Order, error)
+	GetOrdersByHashContext(ctx context.Context, orderhashs []string) (map[string]Order, error)
 	MarkMinerOrders(filterOrderhashs []string, blockNumber int64) error
 	GetOrdersForMiner(protocol, tokenS, tokenB string, length int, filterStatus []types.OrderStatus, reservedTime, startBlockNumber, endBlockNumber int64) ([]*Order, error)
 	GetCutoffOrders(owner common.Address, cutoffTime *big.Int) ([]Order, error)
+	GetOpenOrders() ([]Order, error)
+	GetMarketOpenOrders(market string) ([]Order, error)
 	GetCutoffPairOrders(owner, token1, token2 common.Address, cutoffTime *big.Int) ([]Order, error)
 	SetCutOffOrders(orderHashList []common.Hash, blockNumber *big.Int) error
 	GetOrderBook(protocol, tokenS, tokenB common.Address, length int) ([]Order, error)
@@ -55,6 +59,7 @@ type RdsService interface {
 	UpdateOrderWhileRollbackCutoff(orderhash common.Hash, status types.OrderStatus, blockNumber *big.Int) error
 	UpdateOrderWhileFill(hash common.Hash, status types.OrderStatus, dealtAmountS, dealtAmountB, splitAmountS, splitAmountB, blockNumber *big.Int) error
 	UpdateOrderWhileCancel(hash common.Hash, status types.OrderStatus, cancelledAmountS, cancelledAmountB, blockNumber *big.Int) error
+	UpdateOrderLifecycle(hash common.Hash, firstFilledTime, removedTime int64) error
 	GetFrozenAmount(owner common.Address, token common.Address, statusSet []types.OrderStatus, delegateAddress common.Address) ([]Order, error)
 	GetFrozenLrcFee(owner common.Address, statusSet []types.OrderStatus) ([]Order, error)
 
@@ -67,6 +72,7 @@ type RdsService interface {
 	// fill event table
 	FindFillEvent(txhash string, FillIndex int64) (*FillEvent, error)
 	QueryRecentFills(mkt, owner string, start int64, end int64) (fills []FillEvent, err error)
+	GetFillsByOwner(owner string, start, end int64) (fills []FillEvent, err error)
 	GetFillForkEvents(from, to int64) ([]FillEvent, error)
 	RollBackFill(from, to int64) error
 	FillsPageQuery(query map[string]interface{}, pageIndex, pageSize int) (res PageResult, err error)
@@ -133,4 +139,11 @@ type RdsService interface {
 
 	// checkpoint
 	QueryCheckPointByType(businessType string) (point CheckPoint, err error)
+
+	// token table
+	GetTokens() ([]types.Token, error)
+	SaveToken(token types.Token) error
+
+	// market config table
+	GetMarketConfigs() ([]types.MarketConfig, error)
 }
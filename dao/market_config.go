@@ -0,0 +1,80 @@
+/*
+
+  Copyright 2017 Loopring Project Ltd (Loopring Foundation).
+
+  Licensed under the Apache License, Version 2.0 (the "License");
+  you may not use this file except in compliance with the License.
+  You may obtain a copy of the License at
+
+  http://www.apache.org/licenses/LICENSE-2.0
+
+  Unless required by applicable law or agreed to in writing, software
+  distributed under the License is distributed on an "AS IS" BASIS,
+  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+  See the License for the specific language governing permissions and
+  limitations under the License.
+
+*/
+
+package dao
+
+import (
+	"github.com/Loopring/relay/types"
+	"math/big"
+)
+
+// 市场交易对参数, 未配置的市场使用默认值
+type MarketConfig struct {
+	ID             int    `gorm:"column:id;primary_key;"`
+	Market         string `gorm:"column:market;type:varchar(42);unique_index"`
+	MinAmountS     string `gorm:"column:min_amount_s;type:varchar(64)"`
+	PriceDecimals  int    `gorm:"column:price_decimals"`
+	AmountDecimals int    `gorm:"column:amount_decimals"`
+	CreateTime     int64  `gorm:"column:create_time;type:bigint"`
+	UpdateTime     int64  `gorm:"column:update_time;type:bigint"`
+}
+
+func (m *MarketConfig) ConvertDown(src *types.MarketConfig) error {
+	m.Market = src.Market
+	m.MinAmountS = ""
+	if src.MinAmountS != nil {
+		m.MinAmountS = src.MinAmountS.String()
+	}
+	m.PriceDecimals = src.PriceDecimals
+	m.AmountDecimals = src.AmountDecimals
+
+	return nil
+}
+
+func (m *MarketConfig) ConvertUp(dst *types.MarketConfig) error {
+	dst.Market = m.Market
+	dst.MinAmountS = big.NewInt(0)
+	if m.MinAmountS != "" {
+		if amount, ok := new(big.Int).SetString(m.MinAmountS, 0); ok {
+			dst.MinAmountS = amount
+		}
+	}
+	dst.PriceDecimals = m.PriceDecimals
+	dst.AmountDecimals = m.AmountDecimals
+
+	return nil
+}
+
+func (s *RdsServiceImpl) GetMarketConfigs() ([]types.MarketConfig, error) {
+	var (
+		list    []MarketConfig
+		configs []types.MarketConfig
+	)
+
+	if err := s.db.Find(&list).Error; err != nil {
+		return nil, err
+	}
+
+	for _, v := range list {
+		var config types.MarketConfig
+		v.ConvertUp(&config)
+		configs = append(configs, config)
+	}
+
+	return configs, nil
+}
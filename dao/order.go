@@ -19,6 +19,7 @@
 package dao
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"github.com/Loopring/relay/crypto"
@@ -71,6 +72,8 @@ type Order struct {
 	Market                string  `gorm:"column:market;type:varchar(40)"`
 	Side                  string  `gorm:"column:side;type:varchar(40)`
 	OrderType             string  `gorm:"column:order_type;type:varchar(40)`
+	FirstFilledTime       int64   `gorm:"column:first_filled_time;type:bigint"`
+	RemovedTime           int64   `gorm:"column:removed_time;type:bigint"`
 }
 
 // convert types/orderState to dao/order
@@ -117,6 +120,8 @@ func (o *Order) ConvertDown(state *types.OrderState) error {
 	o.BroadcastTime = state.BroadcastTime
 	o.Side = state.RawOrder.Side
 	o.OrderType = state.RawOrder.OrderType
+	o.FirstFilledTime = state.FirstFilledTime
+	o.RemovedTime = state.RemovedTime
 
 	return nil
 }
@@ -173,6 +178,8 @@ func (o *Order) ConvertUp(state *types.OrderState) error {
 	state.BroadcastTime = o.BroadcastTime
 	state.RawOrder.Market = o.Market
 	state.RawOrder.CreateTime = o.CreateTime
+	state.FirstFilledTime = o.FirstFilledTime
+	state.RemovedTime = o.RemovedTime
 	if o.Side == "" {
 		state.RawOrder.Side = util.GetSide(o.TokenS, o.TokenB)
 	} else {
@@ -245,6 +252,37 @@ func (s *RdsServiceImpl) GetOrdersByHash(orderhashs []string) (map[string]Order,
 	return ret, err
 }
 
+// GetOrdersByHashContext gorm不支持context, 直接走database/sql使查询随ctx取消
+func (s *RdsServiceImpl) GetOrdersByHashContext(ctx context.Context, orderhashs []string) (map[string]Order, error) {
+	ret := make(map[string]Order)
+	if len(orderhashs) == 0 {
+		return ret, nil
+	}
+
+	args := make([]interface{}, len(orderhashs))
+	for i, v := range orderhashs {
+		args[i] = v
+	}
+	placeholders := strings.TrimSuffix(strings.Repeat("?,", len(orderhashs)), ",")
+	query := "SELECT * FROM " + s.db.NewScope(&Order{}).TableName() + " WHERE order_hash IN (" + placeholders + ")"
+
+	rows, err := s.db.DB().QueryContext(ctx, query, args...)
+	if err != nil {
+		return ret, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var ord Order
+		if err := s.db.ScanRows(rows, &ord); err != nil {
+			return ret, err
+		}
+		ret[ord.OrderHash] = ord
+	}
+
+	return ret, rows.Err()
+}
+
 func (s *RdsServiceImpl) GetCutoffOrders(owner common.Address, cutoffTime *big.Int) ([]Order, error) {
 	var (
 		list []Order
@@ -256,6 +294,33 @@ func (s *RdsServiceImpl) GetCutoffOrders(owner common.Address, cutoffTime *big.I
 	return list, err
 }
 
+// 只取统计挂单数需要的字段
+func (s *RdsServiceImpl) GetOpenOrders() ([]Order, error) {
+	var (
+		list []Order
+		err  error
+	)
+
+	filterStatus := []types.OrderStatus{types.ORDER_PARTIAL, types.ORDER_NEW}
+	err = s.db.Select("order_hash, market, valid_until").Where("valid_until >= ? and status in (?)", time.Now().Unix(), filterStatus).Find(&list).Error
+	return list, err
+}
+
+func (s *RdsServiceImpl) GetMarketOpenOrders(market string) ([]Order, error) {
+	var (
+		list []Order
+		err  error
+	)
+
+	filterStatus := []types.OrderStatus{types.ORDER_PARTIAL, types.ORDER_NEW}
+	nowtime := time.Now().Unix()
+	err = s.db.Where("market = ? and status in (?)", market, filterStatus).
+		Where("valid_since < ?", nowtime).
+		Where("valid_until >= ? ", nowtime).
+		Find(&list).Error
+	return list, err
+}
+
 func (s *RdsServiceImpl) GetCutoffPairOrders(owner, token1, token2 common.Address, cutoffTime *big.Int) ([]Order, error) {
 	var (
 		list []Order
@@ -466,6 +531,21 @@ func (s *RdsServiceImpl) UpdateOrderWhileCancel(hash common.Hash, status types.O
 	return s.db.Model(&Order{}).Where("order_hash = ?", hash.Hex()).Update(items).Error
 }
 
+// 只更新非0的时间戳, 首次成交时间与移除时间均取自对应事件的区块时间
+func (s *RdsServiceImpl) UpdateOrderLifecycle(hash common.Hash, firstFilledTime, removedTime int64) error {
+	items := map[string]interface{}{}
+	if firstFilledTime > 0 {
+		items["first_filled_time"] = firstFilledTime
+	}
+	if removedTime > 0 {
+		items["removed_time"] = removedTime
+	}
+	if len(items) == 0 {
+		return nil
+	}
+	return s.db.Model(&Order{}).Where("order_hash = ?", hash.Hex()).Update(items).Error
+}
+
 func (s *RdsServiceImpl) UpdateOrderWhileRollbackCutoff(orderhash common.Hash, status types.OrderStatus, blockNumber *big.Int) error {
 	items := map[string]interface{}{
 		"status":        uint8(status),
@@ -0,0 +1,101 @@
+/*
+
+  Copyright 2017 Loopring Project Ltd (Loopring Foundation).
+
+  Licensed under the Apache License, Version 2.0 (the "License");
+  you may not use this file except in compliance with the License.
+  You may obtain a copy of the License at
+
+  http://www.apache.org/licenses/LICENSE-2.0
+
+  Unless required by applicable law or agreed to in writing, software
+  distributed under the License is distributed on an "AS IS" BASIS,
+  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+  See the License for the specific language governing permissions and
+  limitations under the License.
+
+*/
+
+package dao
+
+import (
+	"github.com/Loopring/relay/types"
+	"github.com/ethereum/go-ethereum/common"
+	"math/big"
+	"time"
+)
+
+// 运行时增删的token, 删除时标记deny
+type Token struct {
+	ID         int    `gorm:"column:id;primary_key;"`
+	Protocol   string `gorm:"column:protocol;type:varchar(42)"`
+	Symbol     string `gorm:"column:symbol;type:varchar(20);unique_index"`
+	Source     string `gorm:"column:source;type:varchar(64)"`
+	Decimals   string `gorm:"column:decimals;type:varchar(64)"`
+	IsMarket   bool   `gorm:"column:is_market"`
+	Deny       bool   `gorm:"column:deny"`
+	CreateTime int64  `gorm:"column:create_time;type:bigint"`
+	UpdateTime int64  `gorm:"column:update_time;type:bigint"`
+}
+
+func (t *Token) ConvertDown(src *types.Token) error {
+	t.Protocol = src.Protocol.Hex()
+	t.Symbol = src.Symbol
+	t.Source = src.Source
+	t.Decimals = ""
+	if src.Decimals != nil {
+		t.Decimals = src.Decimals.String()
+	}
+	t.IsMarket = src.IsMarket
+	t.Deny = src.Deny
+
+	return nil
+}
+
+func (t *Token) ConvertUp(dst *types.Token) error {
+	dst.Protocol = common.HexToAddress(t.Protocol)
+	dst.Symbol = t.Symbol
+	dst.Source = t.Source
+	if t.Decimals != "" {
+		dst.Decimals, _ = new(big.Int).SetString(t.Decimals, 0)
+	}
+	dst.IsMarket = t.IsMarket
+	dst.Deny = t.Deny
+	dst.Time = t.CreateTime
+
+	return nil
+}
+
+func (s *RdsServiceImpl) GetTokens() ([]types.Token, error) {
+	var (
+		list   []Token
+		tokens []types.Token
+	)
+
+	if err := s.db.Find(&list).Error; err != nil {
+		return nil, err
+	}
+
+	for _, v := range list {
+		var token types.Token
+		v.ConvertUp(&token)
+		tokens = append(tokens, token)
+	}
+
+	return tokens, nil
+}
+
+// SaveToken insert token or update it by symbol
+func (s *RdsServiceImpl) SaveToken(token types.Token) error {
+	var item Token
+
+	now := time.Now().Unix()
+	err := s.db.Where("symbol = ?", token.Symbol).First(&item).Error
+	if err != nil {
+		item = Token{CreateTime: now}
+	}
+	item.ConvertDown(&token)
+	item.UpdateTime = now
+
+	return s.db.Save(&item).Error
+}
@@ -19,6 +19,7 @@
 package ethaccessor
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"github.com/Loopring/relay/config"
@@ -41,6 +42,14 @@ func GetBalance(result interface{}, address common.Address, blockNumber string)
 	return accessor.RetryCall(blockNumber, 2, result, "eth_getBalance", address, blockNumber)
 }
 
+func GetCode(result interface{}, address common.Address, blockNumber string) error {
+	return accessor.RetryCall(blockNumber, 2, result, "eth_getCode", address, blockNumber)
+}
+
+func GetCodeContext(ctx context.Context, result interface{}, address common.Address, blockNumber string) error {
+	return accessor.RetryCallContext(ctx, blockNumber, 2, result, "eth_getCode", address, blockNumber)
+}
+
 func SendRawTransaction(result interface{}, tx string) error {
 	return accessor.RetryCall("latest", 2, result, "eth_sendRawTransaction", tx)
 }
@@ -54,36 +63,65 @@ func Call(result interface{}, ethCall *CallArg, blockNumber string) error {
 }
 
 func GetBlockByNumber(result interface{}, blockNumber *big.Int, withObject bool) error {
-	return accessor.RetryCall(blockNumber.String(), 2, result, "eth_getBlockByNumber", fmt.Sprintf("%#x", blockNumber), withObject)
+	return accessor.RetryFetch(blockNumber.String(), result, "eth_getBlockByNumber", fmt.Sprintf("%#x", blockNumber), withObject)
 }
 
 func GetBlockByHash(result types.CheckNull, blockHash string, withObject bool) error {
-	for _, c := range accessor.clients {
-		//todo:is it need retrycall
-		if err := c.client.Call(result, "eth_getBlockByHash", blockHash, withObject); nil == err {
-			if !result.IsNull() {
-				return nil
+	return accessor.retry.do("eth_getBlockByHash", func() error {
+		for _, c := range accessor.clients {
+			if err := c.client.Call(result, "eth_getBlockByHash", blockHash, withObject); nil == err {
+				if !result.IsNull() {
+					return nil
+				}
 			}
 		}
-	}
-	return fmt.Errorf("no block with blockhash:%s", blockHash)
-
-	//return accessor.RetryCall("latest", 2, result, "eth_getBlockByHash", blockHash, withObject)
-}
-
-func GetTransactionReceipt(result interface{}, txHash string, blockParameter string) error {
-	return accessor.RetryCall(blockParameter, 2, result, "eth_getTransactionReceipt", txHash)
+		return fmt.Errorf("no block with blockhash:%s", blockHash)
+	})
+}
+
+// GetTransactionReceipt 节点间同步有延迟, 所有节点都返回null时为ErrNotFound, 有节点请求失败时返回该错误
+func GetTransactionReceipt(result types.CheckNull, txHash string, blockParameter string) error {
+	return accessor.retry.do("eth_getTransactionReceipt", func() error {
+		var callErr error
+		for _, c := range accessor.clients {
+			if err := c.client.Call(result, "eth_getTransactionReceipt", txHash); nil == err {
+				if !result.IsNull() {
+					return nil
+				}
+			} else {
+				callErr = err
+			}
+		}
+		if callErr != nil {
+			return fmt.Errorf("get transaction receipt %s error:%s", txHash, callErr.Error())
+		}
+		return ErrNotFound
+	})
 }
 
+// GetTransactionByHash 所有节点都返回null时为ErrNotFound, 有节点请求失败时返回该错误
 func GetTransactionByHash(result types.CheckNull, txHash string, blockParameter string) error {
-	for _, c := range accessor.clients {
-		if err := c.client.Call(result, "eth_getTransactionByHash", txHash); nil == err {
-			if !result.IsNull() {
-				return nil
+	return accessor.retry.do("eth_getTransactionByHash", func() error {
+		var callErr error
+		for _, c := range accessor.clients {
+			if err := c.client.Call(result, "eth_getTransactionByHash", txHash); nil == err {
+				if !result.IsNull() {
+					return nil
+				}
+			} else {
+				callErr = err
 			}
 		}
-	}
-	return fmt.Errorf("no transaction with hash:%s", txHash)
+		if callErr != nil {
+			return fmt.Errorf("get transaction %s error:%s", txHash, callErr.Error())
+		}
+		return ErrNotFound
+	})
+}
+
+// GetLogs 按配置的区间大小分段获取[from, to]内的logs
+func GetLogs(from, to *big.Int, addresses []common.Address, topics [][]common.Hash) ([]Log, error) {
+	return accessor.logs.FetchRange(from, to, addresses, topics)
 }
 
 func EstimateGasPrice(minGasPrice, maxGasPrice *big.Int) *big.Int {
@@ -91,12 +129,12 @@ func EstimateGasPrice(minGasPrice, maxGasPrice *big.Int) *big.Int {
 }
 
 func GetBlockTransactionCountByHash(result interface{}, blockHash string, blockParameter string) error {
-	return accessor.RetryCall("latest", 5, result, "eth_getBlockTransactionCountByHash", blockHash)
+	return accessor.RetryFetch("latest", result, "eth_getBlockTransactionCountByHash", blockHash)
 
 }
 
 func GetBlockTransactionCountByNumber(result interface{}, blockNumber string) error {
-	return accessor.RetryCall(blockNumber, 2, result, "eth_getBlockTransactionCountByNumber", blockNumber)
+	return accessor.RetryFetch(blockNumber, result, "eth_getBlockTransactionCountByNumber", blockNumber)
 
 }
 
@@ -133,6 +171,22 @@ func Erc20Allowance(tokenAddress, ownerAddress, spender common.Address, blockPar
 	return accessor.Erc20Allowance(tokenAddress, ownerAddress, spender, blockParameter)
 }
 
+func Erc20Symbol(tokenAddress common.Address, blockParameter string) (string, error) {
+	return accessor.Erc20Symbol(tokenAddress, blockParameter)
+}
+
+func Erc20Decimals(tokenAddress common.Address, blockParameter string) (uint8, error) {
+	return accessor.Erc20Decimals(tokenAddress, blockParameter)
+}
+
+func Erc20SymbolContext(ctx context.Context, tokenAddress common.Address, blockParameter string) (string, error) {
+	return accessor.Erc20SymbolContext(ctx, tokenAddress, blockParameter)
+}
+
+func Erc20DecimalsContext(ctx context.Context, tokenAddress common.Address, blockParameter string) (uint8, error) {
+	return accessor.Erc20DecimalsContext(ctx, tokenAddress, blockParameter)
+}
+
 // todo(fuk): 需要测试，如果没有，合约是否返回为0
 func GetCutoff(contractAddress, owner common.Address, blockNumber string) (*big.Int, error) {
 	var cutoff types.Big
@@ -182,11 +236,11 @@ func BatchCall(routeParam string, reqs []BatchReq) error {
 }
 
 func BatchTransactions(reqs []*BatchTransactionReq, blockNumber string) error {
-	return accessor.BatchTransactions(blockNumber, 5, reqs)
+	return accessor.BatchTransactions(blockNumber, reqs)
 }
 
 func BatchTransactionRecipients(reqs []*BatchTransactionRecipientReq, blockNumber string) error {
-	return accessor.BatchTransactionRecipients(blockNumber, 5, reqs)
+	return accessor.BatchTransactionRecipients(blockNumber, reqs)
 }
 
 func NewBlockIterator(startNumber, endNumber *big.Int, withTxData bool, confirms uint64) *BlockIterator {
@@ -266,6 +320,8 @@ func Initialize(accessorOptions config.AccessorOptions, commonOptions config.Com
 	} else {
 		accessor.fetchTxRetryCount = 60
 	}
+	accessor.retry = newRetryPolicy(accessorOptions)
+	accessor.logs = newLogRangeFetcher(accessorOptions.LogsChunkSize, accessor.getLogs)
 	accessor.AddressNonce = make(map[common.Address]*big.Int)
 	accessor.MutilClient = NewMutilClient(accessorOptions.RawUrls)
 	if nil != err {
@@ -281,9 +337,6 @@ func Initialize(accessorOptions config.AccessorOptions, commonOptions config.Com
 	}
 	accessor.WethAddress = wethAddress
 
-	accessor.ProtocolAddresses = make(map[common.Address]*ProtocolAddress)
-	accessor.DelegateAddresses = make(map[common.Address]bool)
-
 	if protocolImplAbi, err := NewAbi(commonOptions.ProtocolImpl.ImplAbi); nil != err {
 		return err
 	} else {
@@ -308,24 +361,39 @@ func Initialize(accessorOptions config.AccessorOptions, commonOptions config.Com
 	//	accessor.NameRegistryAbi = nameRegistryAbi
 	//}
 
-	for version, address := range commonOptions.ProtocolImpl.Address {
+	if accessor.ProtocolAddresses, accessor.DelegateAddresses, err = accessor.loadProtocolAddresses(commonOptions.ProtocolImpl.Address); nil != err {
+		return err
+	}
+
+	accessor.MutilClient.startSyncBlockNumber()
+	return nil
+}
+
+// loadProtocolAddresses 按配置的version->address从链上读取各版本协议的lrc/tokenRegistry/delegate地址
+func (accessor *ethNodeAccessor) loadProtocolAddresses(impls map[string]string) (map[common.Address]*ProtocolAddress, map[common.Address]bool, error) {
+	protocols := make(map[common.Address]*ProtocolAddress)
+	delegates := make(map[common.Address]bool)
+	for version, address := range impls {
+		if !common.IsHexAddress(address) {
+			return nil, nil, fmt.Errorf("accessor,protocol version:%s invalid address:%s", version, address)
+		}
 		impl := &ProtocolAddress{Version: version, ContractAddress: common.HexToAddress(address)}
 		callMethod := accessor.ContractCallMethod(accessor.ProtocolImplAbi, impl.ContractAddress)
 		var addr string
 		if err := callMethod(&addr, "lrcTokenAddress", "latest"); nil != err {
-			return err
+			return nil, nil, err
 		} else {
 			log.Debugf("version:%s, contract:%s, lrcTokenAddress:%s", version, address, addr)
 			impl.LrcTokenAddress = common.HexToAddress(addr)
 		}
 		if err := callMethod(&addr, "tokenRegistryAddress", "latest"); nil != err {
-			return err
+			return nil, nil, err
 		} else {
 			log.Debugf("version:%s, contract:%s, tokenRegistryAddress:%s", version, address, addr)
 			impl.TokenRegistryAddress = common.HexToAddress(addr)
 		}
 		if err := callMethod(&addr, "delegateAddress", "latest"); nil != err {
-			return err
+			return nil, nil, err
 		} else {
 			log.Debugf("version:%s, contract:%s, delegateAddress:%s", version, address, addr)
 			impl.DelegateAddress = common.HexToAddress(addr)
@@ -336,11 +404,24 @@ func Initialize(accessorOptions config.AccessorOptions, commonOptions config.Com
 		//	log.Debugf("version:%s, contract:%s, nameRegistryAddress:%s", version, address, addr)
 		//	impl.NameRegistryAddress = common.HexToAddress(addr)
 		//}
-		accessor.ProtocolAddresses[impl.ContractAddress] = impl
-		accessor.DelegateAddresses[impl.DelegateAddress] = true
+		protocols[impl.ContractAddress] = impl
+		delegates[impl.DelegateAddress] = true
 	}
 
-	accessor.MutilClient.startSyncBlockNumber()
+	return protocols, delegates, nil
+}
+
+// ReloadProtocolAddresses 配置变更后重新加载协议地址, 任一版本加载失败时保留原地址
+func ReloadProtocolAddresses(impls map[string]string) error {
+	protocols, delegates, err := accessor.loadProtocolAddresses(impls)
+	if nil != err {
+		return err
+	}
+
+	accessor.mtx.Lock()
+	accessor.ProtocolAddresses = protocols
+	accessor.DelegateAddresses = delegates
+	accessor.mtx.Unlock()
 	return nil
 }
 
@@ -19,6 +19,7 @@
 package ethaccessor
 
 import (
+	"context"
 	"errors"
 	"github.com/Loopring/relay/cache"
 	"github.com/Loopring/relay/log"
@@ -244,6 +245,16 @@ func (mc *MutilClient) Call(routeParam string, result interface{}, method string
 	}
 }
 
+// CallContext 请求最优节点, ctx取消时立即返回, 不用于eth_blockNumber及eth_sendRawTransaction
+func (mc *MutilClient) CallContext(ctx context.Context, routeParam string, result interface{}, method string, args ...interface{}) (node string, err error) {
+	rpcClient := mc.bestClient(routeParam)
+	if nil == rpcClient {
+		return "", errors.New("there isn't an usable ethnode")
+	}
+	err = rpcClient.client.CallContext(ctx, result, method, args...)
+	return rpcClient.url, err
+}
+
 func (mc *MutilClient) BatchCall(routeParam string, b []rpc.BatchElem) (node string, err error) {
 	rpcClient := mc.bestClient(routeParam)
 	if nil == rpcClient {
@@ -269,6 +280,8 @@ type ethNodeAccessor struct {
 	mtx               sync.RWMutex
 	AddressNonce      map[common.Address]*big.Int
 	fetchTxRetryCount int
+	retry             *retryPolicy
+	logs              *logRangeFetcher
 }
 
 type AddressNonce struct {
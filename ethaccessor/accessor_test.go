@@ -40,8 +40,8 @@ var (
 	miner                = test.Entity().Creator
 	account1             = test.Entity().Accounts[0].Address
 	account2             = test.Entity().Accounts[1].Address
-	lrcTokenAddress      = util.AllTokens["LRC"].Protocol
-	wethTokenAddress     = util.AllTokens["WETH"].Protocol
+	lrcTokenAddress      = util.AllTokens()["LRC"].Protocol
+	wethTokenAddress     = util.AllTokens()["WETH"].Protocol
 	delegateAddress      = test.Delegate()
 	gas                  = big.NewInt(200000)
 	gasPrice             = big.NewInt(21000000000)
@@ -112,7 +112,7 @@ func TestEthNodeAccessor_EthBalance(t *testing.T) {
 
 func TestEthNodeAccessor_SetTokenBalance(t *testing.T) {
 	reqs := ethaccessor.BatchBalanceReqs{}
-	for _, v := range util.AllTokens {
+	for _, v := range util.AllTokens() {
 		req := &ethaccessor.BatchBalanceReq{}
 		req.BlockParameter = "latest"
 		req.Token = v.Protocol
@@ -132,7 +132,7 @@ func TestEthNodeAccessor_SetTokenBalance(t *testing.T) {
 	//}
 
 	reqs1 := ethaccessor.BatchErc20AllowanceReqs{}
-	for _, v := range util.AllTokens {
+	for _, v := range util.AllTokens() {
 		for _, impl := range ethaccessor.ProtocolAddresses() {
 			req := &ethaccessor.BatchErc20AllowanceReq{}
 			req.BlockParameter = "latest"
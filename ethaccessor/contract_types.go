@@ -59,6 +59,14 @@ const (
 	METHOD_WETH_WITHDRAWAL = "withdraw"
 	METHOD_APPROVE         = "approve"
 	METHOD_TRANSFER        = "transfer"
+	METHOD_TRANSFER_FROM   = "transferFrom"
+
+	METHOD_INCREASE_APPROVAL  = "increaseApproval"
+	METHOD_DECREASE_APPROVAL  = "decreaseApproval"
+	METHOD_INCREASE_ALLOWANCE = "increaseAllowance"
+	METHOD_DECREASE_ALLOWANCE = "decreaseAllowance"
+
+	METHOD_PERMIT = "permit"
 )
 
 func TxIsSubmitRing(methodName string) bool {
@@ -544,12 +552,15 @@ func (m *CancelOrderMethod) ConvertDown() (*types.Order, *big.Int, error) {
 	return &order, cancelAmount, nil
 }
 
+// CutoffMethod 部分协议版本允许relayer/多签代owner提交cutoff, 此时owner作为方法参数传入
 type CutoffMethod struct {
-	Cutoff *big.Int `fieldName:"cutoff" fieldId:"0"`
+	Owner  common.Address `fieldName:"owner" fieldId:"0"`
+	Cutoff *big.Int       `fieldName:"cutoff" fieldId:"1"`
 }
 
 func (method *CutoffMethod) ConvertDown() *types.CutoffEvent {
 	evt := &types.CutoffEvent{}
+	evt.Owner = method.Owner
 	evt.Cutoff = method.Cutoff
 
 	return evt
@@ -594,6 +605,48 @@ func (e *ApproveMethod) ConvertDown() *types.ApprovalEvent {
 	return evt
 }
 
+// permit(EIP-2612)链下签名授权, owner为签名者而不是交易发送方
+type PermitMethod struct {
+	Owner    common.Address `fieldName:"owner" fieldId:"0"`
+	Spender  common.Address `fieldName:"spender" fieldId:"1"`
+	Value    *big.Int       `fieldName:"value" fieldId:"2"`
+	Deadline *big.Int       `fieldName:"deadline" fieldId:"3"`
+	V        uint8          `fieldName:"v" fieldId:"4"`
+	R        [32]byte       `fieldName:"r" fieldId:"5"`
+	S        [32]byte       `fieldName:"s" fieldId:"6"`
+}
+
+// ConvertDown deadline超出int64(如uint256最大值)时视为永不过期, 返回错误由调用方跳过
+func (m *PermitMethod) ConvertDown() (*types.PermitApprovalEvent, error) {
+	if m.Deadline == nil || !m.Deadline.IsInt64() {
+		return nil, errors.New("permit deadline out of range")
+	}
+
+	evt := &types.PermitApprovalEvent{}
+	evt.Owner = m.Owner
+	evt.Spender = m.Spender
+	evt.Amount = m.Value
+	evt.Deadline = m.Deadline.Int64()
+
+	return evt, nil
+}
+
+// increaseApproval/decreaseApproval/increaseAllowance/decreaseAllowance参数相同, 只有授权的增量
+// abi中参数统一命名为spender&value, 不影响method id
+type AllowanceChangeMethod struct {
+	Spender common.Address `fieldName:"spender" fieldId:"0"`
+	Value   *big.Int       `fieldName:"value" fieldId:"1"`
+}
+
+func (e *AllowanceChangeMethod) ConvertDown(increase bool) *types.AllowanceChangedEvent {
+	evt := &types.AllowanceChangedEvent{}
+	evt.Spender = e.Spender
+	evt.Delta = e.Value
+	evt.Increase = increase
+
+	return evt
+}
+
 // function transfer(address to, uint256 value) public returns (bool);
 type TransferMethod struct {
 	Receiver common.Address `fieldName:"to" fieldId:"0"`
@@ -608,6 +661,22 @@ func (e *TransferMethod) ConvertDown() *types.TransferEvent {
 	return evt
 }
 
+// function transferFrom(address from, address to, uint256 value) public returns (bool);
+type TransferFromMethod struct {
+	Sender   common.Address `fieldName:"from" fieldId:"0"`
+	Receiver common.Address `fieldName:"to" fieldId:"1"`
+	Value    *big.Int       `fieldName:"value" fieldId:"2"`
+}
+
+func (e *TransferFromMethod) ConvertDown() *types.TransferEvent {
+	evt := &types.TransferEvent{}
+	evt.Sender = e.Sender
+	evt.Receiver = e.Receiver
+	evt.Amount = e.Value
+
+	return evt
+}
+
 type ProtocolAddress struct {
 	Version         string
 	ContractAddress common.Address
@@ -0,0 +1,128 @@
+/*
+
+  Copyright 2017 Loopring Project Ltd (Loopring Foundation).
+
+  Licensed under the Apache License, Version 2.0 (the "License");
+  you may not use this file except in compliance with the License.
+  You may obtain a copy of the License at
+
+  http://www.apache.org/licenses/LICENSE-2.0
+
+  Unless required by applicable law or agreed to in writing, software
+  distributed under the License is distributed on an "AS IS" BASIS,
+  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+  See the License for the specific language governing permissions and
+  limitations under the License.
+
+*/
+
+package ethaccessor
+
+import (
+	"fmt"
+	"github.com/Loopring/relay/log"
+	"github.com/Loopring/relay/types"
+	"github.com/ethereum/go-ethereum/common"
+	"math/big"
+	"strings"
+	"sync"
+)
+
+const defaultLogsChunkSize = 1000
+
+// 节点对区间过大或结果过多的eth_getLogs返回的错误
+var tooManyLogsErrors = []string{
+	"too many",
+	"query returned more than",
+	"limit exceeded",
+	"response size exceeded",
+	"block range is too wide",
+}
+
+func isTooManyLogsError(err error) bool {
+	msg := strings.ToLower(err.Error())
+	for _, v := range tooManyLogsErrors {
+		if strings.Contains(msg, v) {
+			return true
+		}
+	}
+	return false
+}
+
+// 追块时按区间分段获取logs, 节点拒绝时区间减半, 缩小后的区间保留给后续请求
+type logRangeFetcher struct {
+	mtx       sync.Mutex
+	chunkSize int64
+	fetch     func(query FilterQuery) ([]Log, error)
+}
+
+func newLogRangeFetcher(chunkSize int64, fetch func(query FilterQuery) ([]Log, error)) *logRangeFetcher {
+	if chunkSize <= 0 {
+		chunkSize = defaultLogsChunkSize
+	}
+	return &logRangeFetcher{chunkSize: chunkSize, fetch: fetch}
+}
+
+func (f *logRangeFetcher) ChunkSize() int64 {
+	f.mtx.Lock()
+	defer f.mtx.Unlock()
+	return f.chunkSize
+}
+
+func (f *logRangeFetcher) FetchRange(from, to *big.Int, addresses []common.Address, topics [][]common.Hash) ([]Log, error) {
+	if from.Cmp(to) > 0 {
+		return nil, fmt.Errorf("accessor,invalid logs range %s-%s", from.String(), to.String())
+	}
+
+	var ret []Log
+	start := new(big.Int).Set(from)
+	for start.Cmp(to) <= 0 {
+		chunk := f.ChunkSize()
+		end := new(big.Int).Add(start, big.NewInt(chunk-1))
+		if end.Cmp(to) > 0 {
+			end.Set(to)
+		}
+
+		query := FilterQuery{
+			FromBlock: types.BigintToHex(start),
+			ToBlock:   types.BigintToHex(end),
+			Address:   addresses,
+			Topics:    topics,
+		}
+		logs, err := f.fetch(query)
+		if err != nil {
+			if !isTooManyLogsError(err) || chunk <= 1 {
+				return nil, err
+			}
+			f.shrink(chunk)
+			log.Debugf("accessor,getLogs range %s-%s rejected:%s, chunk size reduced to %d", start.String(), end.String(), err.Error(), f.ChunkSize())
+			continue
+		}
+
+		ret = append(ret, logs...)
+		start.Add(end, big.NewInt(1))
+	}
+
+	return ret, nil
+}
+
+func (f *logRangeFetcher) shrink(failed int64) {
+	f.mtx.Lock()
+	defer f.mtx.Unlock()
+
+	// 并发请求时只按失败时的区间缩小一次
+	if f.chunkSize == failed {
+		f.chunkSize = failed / 2
+		if f.chunkSize < 1 {
+			f.chunkSize = 1
+		}
+	}
+}
+
+func (accessor *ethNodeAccessor) getLogs(query FilterQuery) ([]Log, error) {
+	var logs []Log
+	if _, err := accessor.Call("latest", &logs, "eth_getLogs", query); err != nil {
+		return nil, err
+	}
+	return logs, nil
+}
@@ -0,0 +1,107 @@
+/*
+
+  Copyright 2017 Loopring Project Ltd (Loopring Foundation).
+
+  Licensed under the Apache License, Version 2.0 (the "License");
+  you may not use this file except in compliance with the License.
+  You may obtain a copy of the License at
+
+  http://www.apache.org/licenses/LICENSE-2.0
+
+  Unless required by applicable law or agreed to in writing, software
+  distributed under the License is distributed on an "AS IS" BASIS,
+  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+  See the License for the specific language governing permissions and
+  limitations under the License.
+
+*/
+
+package ethaccessor
+
+import (
+	"errors"
+	"github.com/Loopring/relay/config"
+	"github.com/Loopring/relay/log"
+	"github.com/Loopring/relay/types"
+	"go.uber.org/zap"
+	"math/big"
+	"testing"
+)
+
+// 区间超过maxRange时拒绝请求的节点, 每个块返回一条log
+type rangeLimitedNode struct {
+	maxRange int64
+	queries  []FilterQuery
+}
+
+func (n *rangeLimitedNode) getLogs(query FilterQuery) ([]Log, error) {
+	n.queries = append(n.queries, query)
+
+	from := types.HexToBigint(query.FromBlock).Int64()
+	to := types.HexToBigint(query.ToBlock).Int64()
+	if to-from+1 > n.maxRange {
+		return nil, errors.New("query returned more than 10000 results")
+	}
+
+	var logs []Log
+	for i := from; i <= to; i++ {
+		var l Log
+		l.BlockNumber.SetInt(big.NewInt(i))
+		logs = append(logs, l)
+	}
+	return logs, nil
+}
+
+func TestLogRangeFetcher_ShrinkChunk(t *testing.T) {
+	zapOpts := zap.NewDevelopmentConfig()
+	zapOpts.Level = zap.NewAtomicLevelAt(zap.ErrorLevel)
+	log.Initialize(config.LogOptions{ZapOpts: zapOpts})
+
+	node := &rangeLimitedNode{maxRange: 300}
+	fetcher := newLogRangeFetcher(1000, node.getLogs)
+
+	logs, err := fetcher.FetchRange(big.NewInt(1), big.NewInt(1000), nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// 1000 -> 500 -> 250
+	if fetcher.ChunkSize() != 250 {
+		t.Fatalf("chunk size should be reduced to 250, got %d", fetcher.ChunkSize())
+	}
+	if len(node.queries) != 6 {
+		t.Fatalf("expect 2 rejected and 4 chunked queries, got %d", len(node.queries))
+	}
+	if len(logs) != 1000 {
+		t.Fatalf("expect 1000 logs, got %d", len(logs))
+	}
+	for i, l := range logs {
+		if l.BlockNumber.Int64() != int64(i+1) {
+			t.Fatalf("log %d has block number %d", i, l.BlockNumber.Int64())
+		}
+	}
+
+	// 后续请求直接使用缩小后的区间
+	node.queries = nil
+	if _, err := fetcher.FetchRange(big.NewInt(1001), big.NewInt(1500), nil, nil); err != nil {
+		t.Fatal(err)
+	}
+	if len(node.queries) != 2 {
+		t.Fatalf("expect 2 queries with reduced chunk, got %d", len(node.queries))
+	}
+}
+
+func TestLogRangeFetcher_OtherError(t *testing.T) {
+	calls := 0
+	fetcher := newLogRangeFetcher(100, func(query FilterQuery) ([]Log, error) {
+		calls++
+		return nil, errors.New("connection refused")
+	})
+
+	if _, err := fetcher.FetchRange(big.NewInt(1), big.NewInt(10), nil, nil); err == nil {
+		t.Fatalf("non range error should be returned")
+	}
+	if calls != 1 || fetcher.ChunkSize() != 100 {
+		t.Fatalf("non range error should not shrink chunk, calls:%d chunk:%d", calls, fetcher.ChunkSize())
+	}
+}
@@ -19,6 +19,7 @@
 package ethaccessor
 
 import (
+	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
@@ -28,6 +29,7 @@ import (
 	"github.com/Loopring/relay/types"
 	"github.com/ethereum/go-ethereum/accounts/abi"
 	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
 	ethTypes "github.com/ethereum/go-ethereum/core/types"
 	"github.com/ethereum/go-ethereum/rlp"
 	"github.com/ethereum/go-ethereum/rpc"
@@ -57,6 +59,28 @@ func (accessor *ethNodeAccessor) RetryCall(routeParam string, retry int, result
 	return err
 }
 
+// RetryCallContext 同RetryCall, ctx取消后不再重试
+func (accessor *ethNodeAccessor) RetryCallContext(ctx context.Context, routeParam string, retry int, result interface{}, method string, args ...interface{}) error {
+	var err error
+	for i := 0; i < retry; i++ {
+		if _, err = accessor.CallContext(ctx, routeParam, result, method, args...); nil == err {
+			return nil
+		}
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+	}
+	return err
+}
+
+// RetryFetch 获取区块头/receipt等数据, 失败时按退避策略重试, 用完重试次数返回ErrAccessor
+func (accessor *ethNodeAccessor) RetryFetch(routeParam string, result interface{}, method string, args ...interface{}) error {
+	return accessor.retry.do(method, func() error {
+		_, err := accessor.Call(routeParam, result, method, args...)
+		return err
+	})
+}
+
 func (accessor *ethNodeAccessor) Erc20Allowance(tokenAddress, ownerAddress, spenderAddress common.Address, blockParameter string) (*big.Int, error) {
 	var allowance types.Big
 	callMethod := accessor.ContractCallMethod(accessor.Erc20Abi, tokenAddress)
@@ -67,6 +91,46 @@ func (accessor *ethNodeAccessor) Erc20Allowance(tokenAddress, ownerAddress, spen
 	}
 }
 
+// Erc20Symbol the erc20 abi from config has no symbol method, use weth abi instead
+func (accessor *ethNodeAccessor) Erc20Symbol(tokenAddress common.Address, blockParameter string) (string, error) {
+	return accessor.Erc20SymbolContext(context.Background(), tokenAddress, blockParameter)
+}
+
+func (accessor *ethNodeAccessor) Erc20SymbolContext(ctx context.Context, tokenAddress common.Address, blockParameter string) (string, error) {
+	var (
+		res    string
+		symbol string
+	)
+	callMethod := accessor.ContractCallMethodContext(ctx, accessor.WethAbi, tokenAddress)
+	if err := callMethod(&res, "symbol", blockParameter); nil != err {
+		return "", err
+	}
+	data, err := hexutil.Decode(res)
+	if err != nil {
+		return "", err
+	}
+	if err := accessor.WethAbi.Unpack(&symbol, "symbol", data, abi.SEL_UNPACK_METHOD); nil != err {
+		return "", err
+	}
+	return symbol, nil
+}
+
+func (accessor *ethNodeAccessor) Erc20Decimals(tokenAddress common.Address, blockParameter string) (uint8, error) {
+	return accessor.Erc20DecimalsContext(context.Background(), tokenAddress, blockParameter)
+}
+
+func (accessor *ethNodeAccessor) Erc20DecimalsContext(ctx context.Context, tokenAddress common.Address, blockParameter string) (uint8, error) {
+	var decimals types.Big
+	callMethod := accessor.ContractCallMethodContext(ctx, accessor.WethAbi, tokenAddress)
+	if err := callMethod(&decimals, "decimals", blockParameter); nil != err {
+		return 0, err
+	}
+	if decimals.BigInt().Cmp(big.NewInt(255)) > 0 {
+		return 0, fmt.Errorf("accessor: token %s decimals overflow", tokenAddress.Hex())
+	}
+	return uint8(decimals.Int64()), nil
+}
+
 func (accessor *ethNodeAccessor) GetCancelledOrFilled(contractAddress common.Address, orderhash common.Hash, blockNumStr string) (*big.Int, error) {
 	var amount types.Big
 	if _, ok := accessor.DelegateAddresses[contractAddress]; !ok {
@@ -160,14 +224,11 @@ func (accessor *ethNodeAccessor) BatchCall(routeParam string, reqElems []rpc.Bat
 	return reqElems, nil
 }
 
-func (accessor *ethNodeAccessor) RetryBatchCall(routeParam string, reqElems []rpc.BatchElem, retry int) ([]rpc.BatchElem, error) {
-	var err error
-	for i := 0; i < retry; i++ {
-		if _, err = accessor.BatchCall(routeParam, reqElems); err == nil {
-			break
-		}
-		log.Debugf("accessor,RetryBatchCall %d'st time to get block's transactions", i+1)
-	}
+func (accessor *ethNodeAccessor) RetryBatchCall(routeParam string, reqElems []rpc.BatchElem) ([]rpc.BatchElem, error) {
+	err := accessor.retry.do("batchCall", func() error {
+		_, err := accessor.BatchCall(routeParam, reqElems)
+		return err
+	})
 	return reqElems, err
 }
 
@@ -198,9 +259,9 @@ func (accessor *ethNodeAccessor) BatchErc20Allowance(routeParam string, reqs []*
 	return nil
 }
 
-func (accessor *ethNodeAccessor) BatchTransactions(routeParam string, retry int, reqs []*BatchTransactionReq) error {
-	if len(reqs) < 1 || retry < 1 {
-		return fmt.Errorf("ethaccessor:batchTransactions retry or reqs invalid")
+func (accessor *ethNodeAccessor) BatchTransactions(routeParam string, reqs []*BatchTransactionReq) error {
+	if len(reqs) < 1 {
+		return fmt.Errorf("ethaccessor:batchTransactions reqs invalid")
 	}
 
 	reqElems := make([]rpc.BatchElem, len(reqs))
@@ -212,7 +273,7 @@ func (accessor *ethNodeAccessor) BatchTransactions(routeParam string, retry int,
 		}
 	}
 
-	if _, err := accessor.RetryBatchCall(routeParam, reqElems, retry); err != nil {
+	if _, err := accessor.RetryBatchCall(routeParam, reqElems); err != nil {
 		return err
 	}
 
@@ -242,9 +303,9 @@ func (accessor *ethNodeAccessor) BatchTransactions(routeParam string, retry int,
 	return nil
 }
 
-func (accessor *ethNodeAccessor) BatchTransactionRecipients(routeParam string, retry int, reqs []*BatchTransactionRecipientReq) error {
-	if len(reqs) < 1 || retry < 1 {
-		return fmt.Errorf("ethaccessor:batchTransactionRecipients retry or reqs invalid")
+func (accessor *ethNodeAccessor) BatchTransactionRecipients(routeParam string, reqs []*BatchTransactionRecipientReq) error {
+	if len(reqs) < 1 {
+		return fmt.Errorf("ethaccessor:batchTransactionRecipients reqs invalid")
 	}
 
 	reqElems := make([]rpc.BatchElem, len(reqs))
@@ -256,7 +317,7 @@ func (accessor *ethNodeAccessor) BatchTransactionRecipients(routeParam string, r
 		}
 	}
 
-	if _, err := accessor.RetryBatchCall(routeParam, reqElems, retry); err != nil {
+	if _, err := accessor.RetryBatchCall(routeParam, reqElems); err != nil {
 		return err
 	}
 
@@ -324,6 +385,21 @@ func (accessor *ethNodeAccessor) ContractCallMethod(a *abi.ABI, contractAddress
 	}
 }
 
+// ContractCallMethodContext 同ContractCallMethod, eth_call随ctx取消
+func (accessor *ethNodeAccessor) ContractCallMethodContext(ctx context.Context, a *abi.ABI, contractAddress common.Address) func(result interface{}, methodName, blockParameter string, args ...interface{}) error {
+	return func(result interface{}, methodName string, blockParameter string, args ...interface{}) error {
+		callData, err := a.Pack(methodName, args...)
+		if nil != err {
+			return err
+		}
+		arg := &CallArg{}
+		arg.From = contractAddress
+		arg.To = contractAddress
+		arg.Data = common.ToHex(callData)
+		return accessor.RetryCallContext(ctx, blockParameter, 2, result, "eth_call", arg, blockParameter)
+	}
+}
+
 func (ethAccessor *ethNodeAccessor) SignAndSendTransaction(result interface{}, sender common.Address, tx *ethTypes.Transaction) error {
 	var err error
 	if tx, err = crypto.SignTx(sender, tx, nil); nil != err {
@@ -443,6 +519,16 @@ func (iterator *BlockIterator) Next() (interface{}, error) {
 	return block, err
 }
 
+// CurrentNumber 下一次Next获取的块号
+func (iterator *BlockIterator) CurrentNumber() *big.Int {
+	return new(big.Int).Set(iterator.currentNumber)
+}
+
+// Skip 跳过当前块, 由调用方自行获取
+func (iterator *BlockIterator) Skip() {
+	iterator.currentNumber.Add(iterator.currentNumber, big.NewInt(1))
+}
+
 func (accessor *ethNodeAccessor) getFullBlockFromCacheByHash(hash string) (*BlockWithTxAndReceipt, error) {
 	blockWithTxAndReceipt := &BlockWithTxAndReceipt{}
 
@@ -460,7 +546,7 @@ func (accessor *ethNodeAccessor) getFullBlockFromCacheByHash(hash string) (*Bloc
 func (accessor *ethNodeAccessor) GetFullBlock(blockNumber *big.Int, withTxObject bool) (interface{}, error) {
 	blockWithTxHash := &BlockWithTxHash{}
 
-	if err := accessor.RetryCall(blockNumber.String(), 2, &blockWithTxHash, "eth_getBlockByNumber", fmt.Sprintf("%#x", blockNumber), false); nil != err || blockWithTxHash == nil {
+	if err := accessor.RetryFetch(blockNumber.String(), &blockWithTxHash, "eth_getBlockByNumber", fmt.Sprintf("%#x", blockNumber), false); nil != err || blockWithTxHash == nil {
 		blockNumberStr := "0"
 		if nil != blockNumber {
 			blockNumberStr = blockNumber.String()
@@ -526,7 +612,7 @@ func (accessor *ethNodeAccessor) GetFullBlock(blockNumber *big.Int, withTxObject
 				}
 
 				var txcnt types.Big
-				if err := accessor.RetryCall("latest", 2, &txcnt, "eth_getBlockTransactionCountByHash", blockWithTxAndReceipt.Hash.Hex()); err != nil {
+				if err := accessor.RetryFetch("latest", &txcnt, "eth_getBlockTransactionCountByHash", blockWithTxAndReceipt.Hash.Hex()); err != nil {
 					return blockWithTxAndReceipt, err
 				}
 				txcntinblock := len(blockWithTxAndReceipt.Transactions)
@@ -558,7 +644,7 @@ func (iterator *BlockIterator) Prev() (interface{}, error) {
 		return nil, errors.New("finished")
 	}
 	prevNumber := new(big.Int).Sub(iterator.currentNumber, big.NewInt(1))
-	if err := iterator.ethClient.RetryCall(prevNumber.String(), 2, &block, "eth_getBlockByNumber", fmt.Sprintf("%#x", prevNumber), iterator.withTxData); nil != err {
+	if err := iterator.ethClient.RetryFetch(prevNumber.String(), &block, "eth_getBlockByNumber", fmt.Sprintf("%#x", prevNumber), iterator.withTxData); nil != err {
 		return nil, err
 	} else {
 		if nil == block {
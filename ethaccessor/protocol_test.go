@@ -0,0 +1,48 @@
+/*
+
+  Copyright 2017 Loopring Project Ltd (Loopring Foundation).
+
+  Licensed under the Apache License, Version 2.0 (the "License");
+  you may not use this file except in compliance with the License.
+  You may obtain a copy of the License at
+
+  http://www.apache.org/licenses/LICENSE-2.0
+
+  Unless required by applicable law or agreed to in writing, software
+  distributed under the License is distributed on an "AS IS" BASIS,
+  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+  See the License for the specific language governing permissions and
+  limitations under the License.
+
+*/
+
+package ethaccessor
+
+import (
+	"github.com/ethereum/go-ethereum/common"
+	"testing"
+)
+
+func TestReloadProtocolAddresses_InvalidKeepsPrevious(t *testing.T) {
+	origin := accessor
+	defer func() { accessor = origin }()
+
+	protocol := common.HexToAddress("0x781870080C8C24a2FD6882296c49c837b06A65E6")
+	accessor = &ethNodeAccessor{}
+	accessor.ProtocolAddresses = map[common.Address]*ProtocolAddress{protocol: {Version: "v1.5", ContractAddress: protocol}}
+	accessor.DelegateAddresses = make(map[common.Address]bool)
+
+	if err := ReloadProtocolAddresses(map[string]string{"v2.0": "not an address"}); err == nil {
+		t.Fatalf("invalid address should fail")
+	}
+	if _, ok := ProtocolAddresses()[protocol]; !ok || len(ProtocolAddresses()) != 1 {
+		t.Fatalf("protocol addresses should be kept after failed reload")
+	}
+
+	if err := ReloadProtocolAddresses(map[string]string{}); err != nil {
+		t.Fatal(err)
+	}
+	if len(ProtocolAddresses()) != 0 {
+		t.Fatalf("removed protocol should be dropped, got %d", len(ProtocolAddresses()))
+	}
+}
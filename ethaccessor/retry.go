@@ -0,0 +1,121 @@
+/*
+
+  Copyright 2017 Loopring Project Ltd (Loopring Foundation).
+
+  Licensed under the Apache License, Version 2.0 (the "License");
+  you may not use this file except in compliance with the License.
+  You may obtain a copy of the License at
+
+  http://www.apache.org/licenses/LICENSE-2.0
+
+  Unless required by applicable law or agreed to in writing, software
+  distributed under the License is distributed on an "AS IS" BASIS,
+  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+  See the License for the specific language governing permissions and
+  limitations under the License.
+
+*/
+
+package ethaccessor
+
+import (
+	"errors"
+	"fmt"
+	"github.com/Loopring/relay/config"
+	"github.com/Loopring/relay/log"
+	"math/rand"
+	"time"
+)
+
+const (
+	defaultRetryMaxAttempts = 5
+	defaultRetryBaseDelay   = 200 * time.Millisecond
+	defaultRetryMaxDelay    = 5 * time.Second
+)
+
+// ErrNotFound 节点正常返回但结果为null, 如交易不存在
+var ErrNotFound = errors.New("accessor,not found")
+
+// IsNotFound 判断err是否为ErrNotFound, 包括重试后返回的ErrAccessor
+func IsNotFound(err error) bool {
+	if e, ok := err.(*ErrAccessor); ok {
+		err = e.Err
+	}
+	return err == ErrNotFound
+}
+
+// ErrAccessor 重试次数用完后仍然失败
+type ErrAccessor struct {
+	Method   string
+	Attempts int
+	Err      error
+}
+
+func (e *ErrAccessor) Error() string {
+	return fmt.Sprintf("accessor,%s failed after %d attempts:%s", e.Method, e.Attempts, e.Err.Error())
+}
+
+// 区块头/receipt等数据获取的重试策略, 指数退避并加随机抖动
+type retryPolicy struct {
+	maxAttempts int
+	baseDelay   time.Duration
+	maxDelay    time.Duration
+	sleep       func(time.Duration)
+}
+
+func newRetryPolicy(options config.AccessorOptions) *retryPolicy {
+	p := &retryPolicy{}
+	p.maxAttempts = defaultRetryMaxAttempts
+	p.baseDelay = defaultRetryBaseDelay
+	p.maxDelay = defaultRetryMaxDelay
+	p.sleep = time.Sleep
+
+	if options.RetryMaxAttempts > 0 {
+		p.maxAttempts = options.RetryMaxAttempts
+	}
+	if options.RetryBaseDelay > 0 {
+		p.baseDelay = time.Duration(options.RetryBaseDelay) * time.Millisecond
+	}
+	if options.RetryMaxDelay > 0 {
+		p.maxDelay = time.Duration(options.RetryMaxDelay) * time.Millisecond
+	}
+
+	return p
+}
+
+// 第attempt次失败后的等待时间, 在[d/2, d)之间随机
+func (p *retryPolicy) backoff(attempt int) time.Duration {
+	d := p.baseDelay
+	for i := 0; i < attempt && d < p.maxDelay; i++ {
+		d *= 2
+	}
+	if d > p.maxDelay {
+		d = p.maxDelay
+	}
+
+	half := d / 2
+	if half <= 0 {
+		return d
+	}
+	return half + time.Duration(rand.Int63n(int64(half)))
+}
+
+func (p *retryPolicy) do(method string, fn func() error) error {
+	var err error
+	for attempt := 0; attempt < p.maxAttempts; attempt++ {
+		if err = fn(); nil == err {
+			return nil
+		}
+		// 节点正常返回null, 重试也是同样的结果, 交由调用方按不存在处理
+		if err == ErrNotFound {
+			return err
+		}
+		if attempt+1 < p.maxAttempts {
+			delay := p.backoff(attempt)
+			log.Debugf("accessor,%s %d'st attempt failed:%s, retry after %s", method, attempt+1, err.Error(), delay.String())
+			p.sleep(delay)
+		}
+	}
+
+	return &ErrAccessor{Method: method, Attempts: p.maxAttempts, Err: err}
+}
@@ -0,0 +1,178 @@
+/*
+
+  Copyright 2017 Loopring Project Ltd (Loopring Foundation).
+
+  Licensed under the Apache License, Version 2.0 (the "License");
+  you may not use this file except in compliance with the License.
+  You may obtain a copy of the License at
+
+  http://www.apache.org/licenses/LICENSE-2.0
+
+  Unless required by applicable law or agreed to in writing, software
+  distributed under the License is distributed on an "AS IS" BASIS,
+  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+  See the License for the specific language governing permissions and
+  limitations under the License.
+
+*/
+
+package ethaccessor
+
+import (
+	"errors"
+	"github.com/Loopring/relay/config"
+	"github.com/Loopring/relay/log"
+	"github.com/ethereum/go-ethereum/rpc"
+	"go.uber.org/zap"
+	"testing"
+	"time"
+)
+
+// 前failures次调用失败的节点
+type flakyAccessor struct {
+	failures int
+	calls    int
+}
+
+func (a *flakyAccessor) Call(result interface{}, method string, args ...interface{}) error {
+	a.calls++
+	if a.calls <= a.failures {
+		return errors.New("connection reset")
+	}
+	return nil
+}
+
+func testRetryPolicy(maxAttempts int, delays *[]time.Duration) *retryPolicy {
+	p := newRetryPolicy(config.AccessorOptions{RetryMaxAttempts: maxAttempts, RetryBaseDelay: 100, RetryMaxDelay: 400})
+	p.sleep = func(d time.Duration) {
+		*delays = append(*delays, d)
+	}
+	return p
+}
+
+func TestRetryPolicy_Do(t *testing.T) {
+	zapOpts := zap.NewDevelopmentConfig()
+	zapOpts.Level = zap.NewAtomicLevelAt(zap.ErrorLevel)
+	log.Initialize(config.LogOptions{ZapOpts: zapOpts})
+
+	var delays []time.Duration
+	p := testRetryPolicy(5, &delays)
+
+	node := &flakyAccessor{failures: 3}
+	if err := p.do("eth_getTransactionReceipt", func() error {
+		return node.Call(nil, "eth_getTransactionReceipt", "0x01")
+	}); err != nil {
+		t.Fatalf("fetch should succeed after retry, err:%s", err.Error())
+	}
+	if node.calls != 4 || len(delays) != 3 {
+		t.Fatalf("expect 4 calls and 3 backoffs, got %d calls and %d backoffs", node.calls, len(delays))
+	}
+	for i, d := range delays {
+		max := time.Duration(100<<uint(i)) * time.Millisecond
+		if max > 400*time.Millisecond {
+			max = 400 * time.Millisecond
+		}
+		if d < max/2 || d >= max {
+			t.Fatalf("backoff %d should be in [%s, %s), got %s", i, (max / 2).String(), max.String(), d.String())
+		}
+	}
+
+	delays = delays[:0]
+	node = &flakyAccessor{failures: 10}
+	err := p.do("eth_getBlockByNumber", func() error {
+		return node.Call(nil, "eth_getBlockByNumber", "0x1", false)
+	})
+	if node.calls != 5 {
+		t.Fatalf("should give up after 5 attempts, got %d calls", node.calls)
+	}
+	accessorErr, ok := err.(*ErrAccessor)
+	if !ok {
+		t.Fatalf("expect ErrAccessor, got %v", err)
+	}
+	if accessorErr.Method != "eth_getBlockByNumber" || accessorErr.Attempts != 5 {
+		t.Fatalf("unexpected ErrAccessor:%s", accessorErr.Error())
+	}
+}
+
+// 模拟节点的eth_getTransactionByHash, known中的交易返回, 否则返回null, err不为空时请求失败
+type TxNodeService struct {
+	known map[string]bool
+	err   error
+	calls int
+}
+
+func (s *TxNodeService) GetTransactionByHash(hash string) (map[string]string, error) {
+	s.calls++
+	if s.err != nil {
+		return nil, s.err
+	}
+	if !s.known[hash] {
+		return nil, nil
+	}
+	return map[string]string{"hash": hash, "blockNumber": "0x64"}, nil
+}
+
+func (s *TxNodeService) GetTransactionReceipt(hash string) (map[string]string, error) {
+	s.calls++
+	if s.err != nil {
+		return nil, s.err
+	}
+	if !s.known[hash] {
+		return nil, nil
+	}
+	return map[string]string{"transactionHash": hash, "blockNumber": "0x64"}, nil
+}
+
+func TestGetTransactionByHash_NotFound(t *testing.T) {
+	zapOpts := zap.NewDevelopmentConfig()
+	zapOpts.Level = zap.NewAtomicLevelAt(zap.ErrorLevel)
+	log.Initialize(config.LogOptions{ZapOpts: zapOpts})
+
+	txhash := "0x26383249d29e13c4c5f73505775813829875d0b0bf496f2af2867548e2bf8108"
+	service := &TxNodeService{known: map[string]bool{txhash: true}}
+	server := rpc.NewServer()
+	if err := server.RegisterName("eth", service); err != nil {
+		t.Fatal(err)
+	}
+	defer server.Stop()
+
+	var delays []time.Duration
+	origin := accessor
+	defer func() { accessor = origin }()
+	accessor = &ethNodeAccessor{retry: testRetryPolicy(3, &delays)}
+	accessor.MutilClient = &MutilClient{clients: map[string]*RpcClient{"inproc": {url: "inproc", client: rpc.DialInProc(server)}}}
+
+	var tx Transaction
+	if err := GetTransactionByHash(&tx, txhash, "latest"); err != nil || tx.Hash != txhash {
+		t.Fatalf("known transaction should be fetched, err:%v", err)
+	}
+
+	// null结果不重试
+	service.calls = 0
+	err := GetTransactionByHash(&Transaction{}, "0x01", "latest")
+	if !IsNotFound(err) {
+		t.Fatalf("null result should be not found, got %v", err)
+	}
+	if service.calls != 1 || len(delays) != 0 {
+		t.Fatalf("not found should not be retried, got %d calls and %d backoffs", service.calls, len(delays))
+	}
+
+	var receipt TransactionReceipt
+	if err := GetTransactionReceipt(&receipt, txhash, "latest"); err != nil || receipt.TransactionHash != txhash {
+		t.Fatalf("known receipt should be fetched, err:%v", err)
+	}
+	service.calls = 0
+	if err := GetTransactionReceipt(&TransactionReceipt{}, "0x01", "latest"); !IsNotFound(err) {
+		t.Fatalf("null receipt should be not found, got %v", err)
+	}
+	if service.calls != 1 || len(delays) != 0 {
+		t.Fatalf("null receipt should not be retried, got %d calls and %d backoffs", service.calls, len(delays))
+	}
+
+	// 节点请求失败不能当作交易不存在
+	service.err = errors.New("connection refused")
+	err = GetTransactionByHash(&Transaction{}, txhash, "latest")
+	if err == nil || IsNotFound(err) {
+		t.Fatalf("rpc error should not be treated as not found, got %v", err)
+	}
+}
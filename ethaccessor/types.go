@@ -79,6 +79,10 @@ type Transaction struct {
 	R                string    `json:"r"`
 	S                string    `json:"s"`
 	V                string    `json:"v"`
+
+	// EIP-1559(type 2)交易, legacy交易没有这两个字段
+	MaxFeePerGas         *types.Big `json:"maxFeePerGas"`
+	MaxPriorityFeePerGas *types.Big `json:"maxPriorityFeePerGas"`
 }
 
 func (tx *Transaction) MethodId() string {
@@ -148,6 +152,13 @@ type TransactionReceipt struct {
 	To                string     `json:"to"`
 	TransactionHash   string     `json:"transactionHash"`
 	TransactionIndex  types.Big  `json:"transactionIndex"`
+
+	// london之后的节点返回实际成交的gasPrice
+	EffectiveGasPrice *types.Big `json:"effectiveGasPrice"`
+}
+
+func (receipt *TransactionReceipt) IsNull() bool {
+	return types.IsZeroHash(common.HexToHash(receipt.TransactionHash))
 }
 
 func (receipt *TransactionReceipt) AfterByzantiumFork() bool {
@@ -34,12 +34,30 @@ const (
 	WethDeposit      = "WethDepositEvent"
 	WethWithdrawal   = "WethWithdrawalEvent"
 	Approve          = "ApproveMethod"
+	ApproveFailed    = "ApproveFailed"
+	AllowanceChanged = "AllowanceChanged"
+	PermitApprove    = "PermitApprove"
+	AllowanceExpired = "AllowanceExpired"
+	AllowanceStale   = "AllowanceStale"
 	Transfer         = "Transfer"
+	ContractTransfer = "ContractTransfer"
+	TransferEdge     = "TransferEdge"
+	TokenPaused      = "TokenPaused"
+	TokenSupply      = "TokenSupplyChanged" // 零地址参与的transfer, 即增发或销毁
 	EthTransferEvent = "EthTransferEvent"
 
+	AccountEventOverflow = "AccountEventOverflow" // 超出owner限流而未在原topic发出的transfer/approve, 附带累计超出数量
+
 	RingMined           = "RingMined"
 	OrderFilled         = "OrderFilled"
+	RingMidPrice        = "RingMidPrice"
+	BlockFillStats      = "BlockFillStats"
+	MarketAnomaly       = "MarketAnomaly"
+	OrderHashMismatch   = "OrderHashMismatch"
+	MarketImbalance     = "MarketImbalance"
+	FeeDiscrepancy      = "FeeDiscrepancy"
 	CancelOrder         = "CancelOrder"
+	OrderConsumed       = "OrderConsumed"
 	CutoffAll           = "Cutoff"
 	CutoffPair          = "CutoffPair"
 	TokenRegistered     = "TokenRegistered"
@@ -47,6 +65,14 @@ const (
 	RingHashSubmitted   = "RingHashSubmitted"
 	AddressAuthorized   = "AddressAuthorized"
 	AddressDeAuthorized = "AddressDeAuthorized"
+	ProtocolSetChanged  = "ProtocolSetChanged"
+
+	OrderPartiallyFilled = "OrderPartiallyFilled" // 订单首次部分成交
+	TokenMetadataChanged = "TokenMetadataChanged" // 可升级token的decimals变化
+	TokenEvicted         = "TokenEvicted"         // 超出max_tokens被淘汰的token
+	TradeExecuted        = "TradeExecuted"        // 链上成交关联到relay存储的订单
+
+	OrderManagerUnknownFill = "OrderManagerUnknownFill" // 订单不在relay中的成交, 待回填
 
 	MinedOrderState            = "MinedOrderState" //orderbook send orderstate to miner
 	WalletTransactionSubmitted = "WalletTransactionSubmitted"
@@ -64,6 +90,7 @@ const (
 	Miner_SubmitRing_Method          = "Miner_SubmitRing_Method"
 	Miner_SubmitRingHash_Method      = "Miner_SubmitRingHash_Method"
 	Miner_BatchSubmitRingHash_Method = "Miner_BatchSubmitRingHash_Method"
+	MinerRingSettledCost             = "MinerRingSettledCost"
 
 	// Block
 	Block_New = "Block_New"
@@ -74,9 +101,17 @@ const (
 	ChainForkDetected = "ChainForkDetected"
 	ExtractorWarning  = "ExtractorWarning"
 
+	ExtractorUnpackError = "ExtractorUnpackError" // 合约method/event解析失败
+	BlockTimeUnavailable = "BlockTimeUnavailable" // 区块时间为0且无法从区块头获取
+
+	ExtractorHandlerCancelled = "ExtractorHandlerCancelled" // extractor停止时handler中的db/rpc调用被中断
+
 	// Transaction
-	TransactionEvent   = "TransactionEvent"
-	PendingTransaction = "PendingTransaction"
+	TransactionEvent        = "TransactionEvent"
+	PendingTransaction      = "PendingTransaction"
+	TransactionCompleted    = "TransactionCompleted"
+	TransactionEffects      = "TransactionEffects"
+	TransactionStateChanged = "TransactionStateChanged"
 
 	// socketio notify event types
 	LoopringTickerUpdated = "LoopringTickerUpdated"
@@ -87,15 +122,35 @@ const (
 	TransactionUpdated    = "TransactionUpdated"
 )
 
+// VersionTopic 多版本部署时, 某一协议版本的事件topic
+func VersionTopic(topic, version string) string {
+	return topic + "@" + version
+}
+
 //change map to sync.Map
 var watchers map[string][]*Watcher
 var mtx *sync.Mutex
 
 type EventData interface{}
 
+// Watcher subscribe a topic, there are three ordering options:
+// Concurrent watcher is fired in a new goroutine and emitter never waits for it, events may be handled out of order;
+// non-concurrent watcher is waited by emitter, events from the same emitter goroutine are handled in emit order;
+// Ordered watcher is non-concurrent and handles events one by one, even if they are emitted from different goroutines.
 type Watcher struct {
 	Concurrent bool
+	Ordered    bool
 	Handle     func(eventData EventData) error
+
+	lock sync.Mutex
+}
+
+func (w *Watcher) handle(eventData EventData) error {
+	if w.Ordered {
+		w.lock.Lock()
+		defer w.lock.Unlock()
+	}
+	return w.Handle(eventData)
 }
 
 func Un(topic string, watcher *Watcher) {
@@ -110,6 +165,13 @@ func Un(topic string, watcher *Watcher) {
 	watchers[topic] = watchersTmp
 }
 
+// WatcherCount topic上当前注册的watcher数量
+func WatcherCount(topic string) int {
+	mtx.Lock()
+	defer mtx.Unlock()
+	return len(watchers[topic])
+}
+
 func On(topic string, watcher *Watcher) {
 	mtx.Lock()
 	defer mtx.Unlock()
@@ -123,7 +185,7 @@ func Emit(topic string, eventData EventData) {
 	//should limit the count of watchers
 	var wg sync.WaitGroup
 	for _, ob := range watchers[topic] {
-		if ob.Concurrent {
+		if ob.Concurrent && !ob.Ordered {
 			go ob.Handle(eventData)
 		} else {
 			wg.Add(1)
@@ -132,7 +194,7 @@ func Emit(topic string, eventData EventData) {
 				defer func() {
 					wg.Add(-1)
 				}()
-				if err := ob.Handle(eventData); err != nil {
+				if err := ob.handle(eventData); err != nil {
 					log.Errorf(err.Error())
 				}
 			}(ob)
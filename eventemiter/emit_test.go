@@ -20,6 +20,8 @@ package eventemitter_test
 
 import (
 	"github.com/Loopring/relay/eventemiter"
+	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 )
@@ -49,3 +51,73 @@ func TestEmit(t *testing.T) {
 
 	time.Sleep(time.Duration(100000000))
 }
+
+func TestEmitOrdering(t *testing.T) {
+	const (
+		topic = "TestEmitOrdering"
+		total = 100
+	)
+
+	var (
+		received        []int
+		inflight, maxIn int32
+	)
+	ordered := &eventemitter.Watcher{Ordered: true, Handle: func(event eventemitter.EventData) error {
+		if n := atomic.AddInt32(&inflight, 1); n > atomic.LoadInt32(&maxIn) {
+			atomic.StoreInt32(&maxIn, n)
+		}
+		received = append(received, event.(int))
+		atomic.AddInt32(&inflight, -1)
+		return nil
+	}}
+
+	var started int32
+	release := make(chan bool)
+	concurrent := &eventemitter.Watcher{Concurrent: true, Handle: func(event eventemitter.EventData) error {
+		atomic.AddInt32(&started, 1)
+		<-release
+		return nil
+	}}
+
+	eventemitter.On(topic, ordered)
+	eventemitter.On(topic, concurrent)
+	defer eventemitter.Un(topic, ordered)
+	defer eventemitter.Un(topic, concurrent)
+
+	for i := 0; i < total; i++ {
+		eventemitter.Emit(topic, i)
+	}
+
+	// ordered watcher has handled all events in emit order, none of the concurrent handles has returned
+	if len(received) != total {
+		t.Fatalf("ordered watcher expect %d events, got %d", total, len(received))
+	}
+	for i, v := range received {
+		if v != i {
+			t.Fatalf("ordered watcher expect event %d at %d, got %d", i, i, v)
+		}
+	}
+	deadline := time.Now().Add(time.Second)
+	for atomic.LoadInt32(&started) < total && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+	}
+	if n := atomic.LoadInt32(&started); n != total {
+		t.Fatalf("concurrent watcher expect %d handles running together, got %d", total, n)
+	}
+	close(release)
+
+	// ordered watcher never handle events in parallel even if emitters run concurrently
+	received = nil
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			eventemitter.Emit(topic, i)
+		}(i)
+	}
+	wg.Wait()
+	if len(received) != 10 || atomic.LoadInt32(&maxIn) != 1 {
+		t.Fatalf("ordered watcher should handle events one by one, got %d events and max inflight %d", len(received), maxIn)
+	}
+}
@@ -0,0 +1,79 @@
+/*
+
+  Copyright 2017 Loopring Project Ltd (Loopring Foundation).
+
+  Licensed under the Apache License, Version 2.0 (the "License");
+  you may not use this file except in compliance with the License.
+  You may obtain a copy of the License at
+
+  http://www.apache.org/licenses/LICENSE-2.0
+
+  Unless required by applicable law or agreed to in writing, software
+  distributed under the License is distributed on an "AS IS" BASIS,
+  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+  See the License for the specific language governing permissions and
+  limitations under the License.
+
+*/
+
+package eventemitter
+
+import (
+	"github.com/Loopring/relay/log"
+	"sort"
+	"sync"
+)
+
+// 各模块启动时声明自己会发出的topic, 用于校验watcher与emitter是否配对
+var (
+	declaredTopics map[string]bool
+	declaredMtx    sync.Mutex
+)
+
+func Declare(topics ...string) {
+	declaredMtx.Lock()
+	defer declaredMtx.Unlock()
+	for _, topic := range topics {
+		declaredTopics[topic] = true
+	}
+}
+
+// Validate 交叉校验已注册的watcher与已声明的topic,
+// orphanHandlers: 有watcher但无人发出的topic, orphanEmits: 会发出但无watcher的topic
+func Validate() (orphanHandlers, orphanEmits []string) {
+	mtx.Lock()
+	handled := make(map[string]bool)
+	for topic, list := range watchers {
+		if len(list) > 0 {
+			handled[topic] = true
+		}
+	}
+	mtx.Unlock()
+
+	declaredMtx.Lock()
+	for topic := range declaredTopics {
+		if !handled[topic] {
+			orphanEmits = append(orphanEmits, topic)
+		}
+	}
+	for topic := range handled {
+		if !declaredTopics[topic] {
+			orphanHandlers = append(orphanHandlers, topic)
+		}
+	}
+	declaredMtx.Unlock()
+
+	sort.Strings(orphanHandlers)
+	sort.Strings(orphanEmits)
+	for _, topic := range orphanHandlers {
+		log.Warnf("eventemitter,topic:%s has watchers but no emitter declared", topic)
+	}
+	for _, topic := range orphanEmits {
+		log.Warnf("eventemitter,topic:%s is emitted but no watcher registered", topic)
+	}
+	return orphanHandlers, orphanEmits
+}
+
+func init() {
+	declaredTopics = make(map[string]bool)
+}
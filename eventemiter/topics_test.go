@@ -0,0 +1,66 @@
+/*
+
+  Copyright 2017 Loopring Project Ltd (Loopring Foundation).
+
+  Licensed under the Apache License, Version 2.0 (the "License");
+  you may not use this file except in compliance with the License.
+  You may obtain a copy of the License at
+
+  http://www.apache.org/licenses/LICENSE-2.0
+
+  Unless required by applicable law or agreed to in writing, software
+  distributed under the License is distributed on an "AS IS" BASIS,
+  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+  See the License for the specific language governing permissions and
+  limitations under the License.
+
+*/
+
+package eventemitter_test
+
+import (
+	"github.com/Loopring/relay/config"
+	"github.com/Loopring/relay/eventemiter"
+	"github.com/Loopring/relay/log"
+	"go.uber.org/zap"
+	"testing"
+)
+
+func TestValidate(t *testing.T) {
+	zapOpts := zap.NewDevelopmentConfig()
+	zapOpts.Level = zap.NewAtomicLevelAt(zap.ErrorLevel)
+	log.Initialize(config.LogOptions{ZapOpts: zapOpts})
+
+	watcher := &eventemitter.Watcher{Concurrent: false, Handle: func(event eventemitter.EventData) error { return nil }}
+	eventemitter.Declare("ValidatePaired", "ValidateUnhandled")
+	eventemitter.On("ValidatePaired", watcher)
+	eventemitter.On("ValidateOrphan", watcher)
+	defer eventemitter.Un("ValidatePaired", watcher)
+	defer eventemitter.Un("ValidateOrphan", watcher)
+
+	orphanHandlers, orphanEmits := eventemitter.Validate()
+	if !contains(orphanHandlers, "ValidateOrphan") {
+		t.Fatalf("watcher on undeclared topic should be reported, got %v", orphanHandlers)
+	}
+	if !contains(orphanEmits, "ValidateUnhandled") {
+		t.Fatalf("declared topic without watcher should be reported, got %v", orphanEmits)
+	}
+	if contains(orphanHandlers, "ValidatePaired") || contains(orphanEmits, "ValidatePaired") {
+		t.Fatalf("paired topic should not be reported")
+	}
+
+	// 取消注册后不再报告
+	eventemitter.Un("ValidateOrphan", watcher)
+	if orphanHandlers, _ = eventemitter.Validate(); contains(orphanHandlers, "ValidateOrphan") {
+		t.Fatalf("watcher removed should not be reported")
+	}
+}
+
+func contains(topics []string, topic string) bool {
+	for _, v := range topics {
+		if v == topic {
+			return true
+		}
+	}
+	return false
+}
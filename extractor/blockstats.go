@@ -0,0 +1,115 @@
+/*
+
+  Copyright 2017 Loopring Project Ltd (Loopring Foundation).
+
+  Licensed under the Apache License, Version 2.0 (the "License");
+  you may not use this file except in compliance with the License.
+  You may obtain a copy of the License at
+
+  http://www.apache.org/licenses/LICENSE-2.0
+
+  Unless required by applicable law or agreed to in writing, software
+  distributed under the License is distributed on an "AS IS" BASIS,
+  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+  See the License for the specific language governing permissions and
+  limitations under the License.
+
+*/
+
+package extractor
+
+import (
+	"github.com/Loopring/relay/eventemiter"
+	"github.com/Loopring/relay/market/util"
+	"github.com/Loopring/relay/types"
+	"github.com/ethereum/go-ethereum/common"
+	"math/big"
+)
+
+// 以Block_New/Block_End为边界汇总块内的ringMined及orderFilled
+type blockFillStatsCollector struct {
+	stats    *types.BlockFillStatsEvent
+	owners   map[common.Address]bool
+	watchers map[string]*eventemitter.Watcher
+}
+
+func newBlockFillStatsCollector() *blockFillStatsCollector {
+	return &blockFillStatsCollector{watchers: make(map[string]*eventemitter.Watcher)}
+}
+
+func (c *blockFillStatsCollector) Start() {
+	c.watchers[eventemitter.Block_New] = &eventemitter.Watcher{Concurrent: false, Handle: c.handleBlockNew}
+	c.watchers[eventemitter.RingMined] = &eventemitter.Watcher{Concurrent: false, Handle: c.handleRingMined}
+	c.watchers[eventemitter.OrderFilled] = &eventemitter.Watcher{Concurrent: false, Handle: c.handleOrderFilled}
+	c.watchers[eventemitter.Block_End] = &eventemitter.Watcher{Concurrent: false, Handle: c.handleBlockEnd}
+
+	for topic, watcher := range c.watchers {
+		eventemitter.On(topic, watcher)
+	}
+}
+
+func (c *blockFillStatsCollector) Stop() {
+	for topic, watcher := range c.watchers {
+		eventemitter.Un(topic, watcher)
+	}
+	c.watchers = make(map[string]*eventemitter.Watcher)
+}
+
+func (c *blockFillStatsCollector) handleBlockNew(input eventemitter.EventData) error {
+	evt := input.(*types.BlockEvent)
+	c.stats = &types.BlockFillStatsEvent{
+		BlockNumber:   evt.BlockNumber,
+		BlockHash:     evt.BlockHash,
+		MarketVolumes: make(map[string]*big.Int),
+	}
+	c.owners = make(map[common.Address]bool)
+	return nil
+}
+
+func (c *blockFillStatsCollector) inBlock(txinfo types.TxInfo) bool {
+	return c.stats != nil && txinfo.BlockNumber != nil && txinfo.BlockNumber.Cmp(c.stats.BlockNumber) == 0
+}
+
+func (c *blockFillStatsCollector) handleRingMined(input eventemitter.EventData) error {
+	evt := input.(*types.RingMinedEvent)
+	if c.inBlock(evt.TxInfo) {
+		c.stats.RingCount++
+	}
+	return nil
+}
+
+func (c *blockFillStatsCollector) handleOrderFilled(input eventemitter.EventData) error {
+	fill := input.(*types.OrderFilledEvent)
+	// submitRing失败时按订单发出的fill并未成交, 不计入
+	if fill.Status != types.TX_STATUS_SUCCESS || !c.inBlock(fill.TxInfo) {
+		return nil
+	}
+
+	c.stats.FillCount++
+	c.owners[fill.Owner] = true
+
+	// 一次撮合包含买卖两个fill, 只以卖单收到的计价token计量
+	if fill.Market == "" || fill.AmountB == nil || util.GetSide(fill.TokenS.Hex(), fill.TokenB.Hex()) != util.SideSell {
+		return nil
+	}
+	volume, ok := c.stats.MarketVolumes[fill.Market]
+	if !ok {
+		volume = big.NewInt(0)
+		c.stats.MarketVolumes[fill.Market] = volume
+	}
+	volume.Add(volume, fill.AmountB)
+	return nil
+}
+
+func (c *blockFillStatsCollector) handleBlockEnd(input eventemitter.EventData) error {
+	if c.stats == nil {
+		return nil
+	}
+
+	stats := c.stats
+	stats.UniqueOwners = len(c.owners)
+	c.stats, c.owners = nil, nil
+
+	eventemitter.Emit(eventemitter.BlockFillStats, stats)
+	return nil
+}
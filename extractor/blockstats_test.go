@@ -0,0 +1,99 @@
+/*
+
+  Copyright 2017 Loopring Project Ltd (Loopring Foundation).
+
+  Licensed under the Apache License, Version 2.0 (the "License");
+  you may not use this file except in compliance with the License.
+  You may obtain a copy of the License at
+
+  http://www.apache.org/licenses/LICENSE-2.0
+
+  Unless required by applicable law or agreed to in writing, software
+  distributed under the License is distributed on an "AS IS" BASIS,
+  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+  See the License for the specific language governing permissions and
+  limitations under the License.
+
+*/
+
+package extractor
+
+import (
+	"github.com/Loopring/relay/dao"
+	"github.com/Loopring/relay/eventemiter"
+	"github.com/Loopring/relay/market/util"
+	"github.com/Loopring/relay/types"
+	"github.com/ethereum/go-ethereum/common"
+	"math/big"
+	"testing"
+)
+
+func TestBlockFillStatsCollector(t *testing.T) {
+	lrc, weth := setupMarketTokens()
+	rdn := types.Token{Protocol: common.HexToAddress("0x255Aa6DF07540Cb5d3d297f0D0D4D84cb52bc8e6"), Symbol: "RDN", Decimals: lrc.Decimals}
+	util.SetTokens(map[string]types.Token{"LRC": lrc, "RDN": rdn}, map[string]types.Token{"WETH": weth})
+
+	var (
+		alice = "0x1b978a1D302335a6F2Ebe4B8823B5E17c3C84135"
+		bob   = "0xb1018949b241D76A1AB2094f473E9bEfeAbB5Ead"
+		carol = "0x4Ec94E1007605D70a86279370ec5e4b755295eDA"
+	)
+	lrcSeller := dao.Order{OrderHash: common.HexToHash("0x01").Hex(), Owner: alice, TokenS: lrc.Protocol.Hex(), TokenB: weth.Protocol.Hex(), AmountS: "1000"}
+	lrcBuyer := dao.Order{OrderHash: common.HexToHash("0x02").Hex(), Owner: bob, TokenS: weth.Protocol.Hex(), TokenB: lrc.Protocol.Hex(), AmountS: "5"}
+	rdnSeller := dao.Order{OrderHash: common.HexToHash("0x03").Hex(), Owner: alice, TokenS: rdn.Protocol.Hex(), TokenB: weth.Protocol.Hex(), AmountS: "300"}
+	rdnBuyer := dao.Order{OrderHash: common.HexToHash("0x04").Hex(), Owner: carol, TokenS: weth.Protocol.Hex(), TokenB: rdn.Protocol.Hex(), AmountS: "7"}
+
+	orders := make(map[string]dao.Order)
+	for _, ord := range []dao.Order{lrcSeller, lrcBuyer, rdnSeller, rdnBuyer} {
+		orders[ord.OrderHash] = ord
+	}
+	processor := &AbiProcessor{db: &mockRdsService{orders: orders}}
+
+	collector := newBlockFillStatsCollector()
+	collector.Start()
+	defer collector.Stop()
+
+	var stats []*types.BlockFillStatsEvent
+	watcher := &eventemitter.Watcher{Concurrent: false, Handle: func(input eventemitter.EventData) error {
+		stats = append(stats, input.(*types.BlockFillStatsEvent))
+		return nil
+	}}
+	eventemitter.On(eventemitter.BlockFillStats, watcher)
+	defer eventemitter.Un(eventemitter.BlockFillStats, watcher)
+
+	// ringMinedEventData中的事件都在块100
+	block := &types.BlockEvent{BlockNumber: big.NewInt(100), BlockHash: common.HexToHash("0x64")}
+	eventemitter.Emit(eventemitter.Block_New, block)
+	processor.handleRingMinedEvent(ringMinedEventData([]dao.Order{lrcSeller, lrcBuyer}))
+	processor.handleRingMinedEvent(ringMinedEventData([]dao.Order{rdnSeller, rdnBuyer}))
+
+	// submitRing失败产生的fill不计入
+	failed := &types.OrderFilledEvent{Owner: common.HexToAddress("0x17233e07c67d086464fD408148c3ABB56245FA64"), Market: "LRC-WETH", TokenS: lrc.Protocol, TokenB: weth.Protocol, AmountB: big.NewInt(100)}
+	failed.BlockNumber = big.NewInt(100)
+	failed.Status = types.TX_STATUS_FAILED
+	eventemitter.Emit(eventemitter.OrderFilled, failed)
+
+	eventemitter.Emit(eventemitter.Block_End, block)
+
+	if len(stats) != 1 {
+		t.Fatalf("expect 1 block stats, got %d", len(stats))
+	}
+	s := stats[0]
+	if s.BlockNumber.Int64() != 100 || s.BlockHash != block.BlockHash {
+		t.Fatalf("unexpected block %s %s", s.BlockNumber.String(), s.BlockHash.Hex())
+	}
+	if s.RingCount != 2 || s.FillCount != 4 || s.UniqueOwners != 3 {
+		t.Fatalf("expect 2 rings, 4 fills and 3 owners, got %d %d %d", s.RingCount, s.FillCount, s.UniqueOwners)
+	}
+	if len(s.MarketVolumes) != 2 || s.MarketVolumes["LRC-WETH"].Int64() != 5 || s.MarketVolumes["RDN-WETH"].Int64() != 7 {
+		t.Fatalf("unexpected market volumes %v", s.MarketVolumes)
+	}
+
+	// 空块也输出汇总
+	block = &types.BlockEvent{BlockNumber: big.NewInt(101)}
+	eventemitter.Emit(eventemitter.Block_New, block)
+	eventemitter.Emit(eventemitter.Block_End, block)
+	if len(stats) != 2 || stats[1].FillCount != 0 || len(stats[1].MarketVolumes) != 0 {
+		t.Fatalf("empty block should emit empty stats")
+	}
+}
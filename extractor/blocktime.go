@@ -0,0 +1,89 @@
+/*
+
+  Copyright 2017 Loopring Project Ltd (Loopring Foundation).
+
+  Licensed under the Apache License, Version 2.0 (the "License");
+  you may not use this file except in compliance with the License.
+  You may obtain a copy of the License at
+
+  http://www.apache.org/licenses/LICENSE-2.0
+
+  Unless required by applicable law or agreed to in writing, software
+  distributed under the License is distributed on an "AS IS" BASIS,
+  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+  See the License for the specific language governing permissions and
+  limitations under the License.
+
+*/
+
+package extractor
+
+import (
+	"fmt"
+	"github.com/Loopring/relay/ethaccessor"
+	"github.com/Loopring/relay/eventemiter"
+	"github.com/Loopring/relay/log"
+	"github.com/Loopring/relay/types"
+	"github.com/ethereum/go-ethereum/common"
+	"math/big"
+	"sync"
+)
+
+// 部分节点对刚出的块返回的blockTime为0, 此时按块号查询区块头时间, 同一块只查询一次
+type blockTimeResolver struct {
+	mtx    sync.Mutex
+	number *big.Int
+	time   *big.Int
+	header func(blockNumber *big.Int) (*big.Int, error)
+}
+
+func newBlockTimeResolver() *blockTimeResolver {
+	return &blockTimeResolver{header: blockHeaderTime}
+}
+
+func blockHeaderTime(blockNumber *big.Int) (*big.Int, error) {
+	var block ethaccessor.Block
+	if err := ethaccessor.GetBlockByNumber(&block, blockNumber, false); err != nil {
+		return nil, err
+	}
+	return block.Timestamp.BigInt(), nil
+}
+
+func validBlockTime(blockTime *big.Int) bool {
+	return blockTime != nil && blockTime.Sign() > 0
+}
+
+// resolve 仍无法取得区块时间时发出BlockTimeUnavailable, 返回值为0
+func (r *blockTimeResolver) resolve(txhash common.Hash, blockNumber, blockTime *big.Int) *big.Int {
+	if validBlockTime(blockTime) {
+		return blockTime
+	}
+
+	r.mtx.Lock()
+	defer r.mtx.Unlock()
+
+	if r.number != nil && blockNumber != nil && r.number.Cmp(blockNumber) == 0 {
+		return r.time
+	}
+
+	var err error
+	if blockNumber == nil {
+		err = fmt.Errorf("block number is empty")
+	} else if headerTime, fetchErr := r.header(blockNumber); fetchErr != nil {
+		err = fetchErr
+	} else if !validBlockTime(headerTime) {
+		err = fmt.Errorf("block header time is zero")
+	} else {
+		r.number = new(big.Int).Set(blockNumber)
+		r.time = headerTime
+		return headerTime
+	}
+
+	log.Errorf("extractor,tx:%s block:%s time unavailable:%s", txhash.Hex(), blockNumber.String(), err.Error())
+	eventemitter.Emit(eventemitter.BlockTimeUnavailable, &types.BlockTimeUnavailableEvent{
+		TxHash:      txhash,
+		BlockNumber: blockNumber,
+		Err:         err,
+	})
+	return big.NewInt(0)
+}
@@ -0,0 +1,126 @@
+/*
+
+  Copyright 2017 Loopring Project Ltd (Loopring Foundation).
+
+  Licensed under the Apache License, Version 2.0 (the "License");
+  you may not use this file except in compliance with the License.
+  You may obtain a copy of the License at
+
+  http://www.apache.org/licenses/LICENSE-2.0
+
+  Unless required by applicable law or agreed to in writing, software
+  distributed under the License is distributed on an "AS IS" BASIS,
+  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+  See the License for the specific language governing permissions and
+  limitations under the License.
+
+*/
+
+package extractor
+
+import (
+	"fmt"
+	"github.com/Loopring/relay/config"
+	"github.com/Loopring/relay/ethaccessor"
+	"github.com/Loopring/relay/eventemiter"
+	"github.com/Loopring/relay/types"
+	"github.com/ethereum/go-ethereum/common"
+	"math/big"
+	"testing"
+)
+
+func TestExtractorServiceImpl_ZeroBlockTime(t *testing.T) {
+	initializeAccessorAbi(t)
+	lrc, _ := setupMarketTokens()
+
+	processor := newAbiProcessor(&mockRdsService{}, &config.ExtractorOptions{})
+	defer processor.Unload()
+
+	var (
+		sender        = common.HexToAddress("0x1b978a1D302335a6F2Ebe4B8823B5E17c3C84135")
+		receiver      = common.HexToAddress("0xb1018949b241D76A1AB2094f473E9bEfeAbB5Ead")
+		transferEvent = ethaccessor.Erc20Abi().Events[ethaccessor.EVENT_TRANSFER]
+	)
+	input, err := ethaccessor.Erc20Abi().Pack(ethaccessor.METHOD_TRANSFER, receiver, big.NewInt(100))
+	if err != nil {
+		t.Fatal(err)
+	}
+	transfer := func(index, number int64) (*ethaccessor.Transaction, *ethaccessor.TransactionReceipt) {
+		tx := &ethaccessor.Transaction{
+			Hash:        common.BigToHash(big.NewInt(index)).Hex(),
+			From:        sender.Hex(),
+			To:          lrc.Protocol.Hex(),
+			Input:       common.ToHex(input),
+			BlockNumber: *types.NewBigPtr(big.NewInt(number)),
+		}
+		receipt := &ethaccessor.TransactionReceipt{
+			Status:  types.NewBigPtr(big.NewInt(1)),
+			GasUsed: *types.NewBigPtr(big.NewInt(50000)),
+			Logs: []ethaccessor.Log{{
+				Address: tx.To,
+				Topics:  []string{transferEvent.Id().Hex(), common.BytesToHash(sender.Bytes()).Hex(), common.BytesToHash(receiver.Bytes()).Hex()},
+				Data:    common.ToHex(common.LeftPadBytes(big.NewInt(100).Bytes(), 32)),
+			}},
+		}
+		return tx, receipt
+	}
+
+	var transfers []*types.TransferEvent
+	transferWatcher := &eventemitter.Watcher{Concurrent: false, Handle: func(input eventemitter.EventData) error {
+		transfers = append(transfers, input.(*types.TransferEvent))
+		return nil
+	}}
+	eventemitter.On(eventemitter.Transfer, transferWatcher)
+	defer eventemitter.Un(eventemitter.Transfer, transferWatcher)
+
+	var anomalies []*types.BlockTimeUnavailableEvent
+	anomalyWatcher := &eventemitter.Watcher{Concurrent: false, Handle: func(input eventemitter.EventData) error {
+		anomalies = append(anomalies, input.(*types.BlockTimeUnavailableEvent))
+		return nil
+	}}
+	eventemitter.On(eventemitter.BlockTimeUnavailable, anomalyWatcher)
+	defer eventemitter.Un(eventemitter.BlockTimeUnavailable, anomalyWatcher)
+
+	var fetched []int64
+	resolver := newBlockTimeResolver()
+	resolver.header = func(blockNumber *big.Int) (*big.Int, error) {
+		fetched = append(fetched, blockNumber.Int64())
+		if blockNumber.Int64() == 10 {
+			return big.NewInt(1520000010), nil
+		}
+		return nil, fmt.Errorf("header not found")
+	}
+	l := &ExtractorServiceImpl{processor: processor, blockTimes: resolver}
+
+	// blockTime为0时查询区块头, 同一块的交易只查询一次
+	tx, receipt := transfer(1, 10)
+	l.ProcessMinedTransaction(tx, receipt, big.NewInt(0))
+	tx, receipt = transfer(2, 10)
+	l.ProcessMinedTransaction(tx, receipt, nil)
+	if len(fetched) != 1 || fetched[0] != 10 {
+		t.Fatalf("expect block header of 10 fetched once, got %v", fetched)
+	}
+	if len(transfers) != 2 || transfers[0].BlockTime != 1520000010 || transfers[1].BlockTime != 1520000010 {
+		t.Fatalf("transfers should carry fetched block time")
+	}
+
+	// 正常的blockTime不查询
+	tx, receipt = transfer(3, 11)
+	l.ProcessMinedTransaction(tx, receipt, big.NewInt(1520000011))
+	if len(fetched) != 1 || transfers[2].BlockTime != 1520000011 {
+		t.Fatalf("valid block time should be used directly")
+	}
+	if len(anomalies) != 0 {
+		t.Fatalf("no anomaly expected, got %d", len(anomalies))
+	}
+
+	// 查询失败时发出BlockTimeUnavailable, 交易仍然处理
+	tx, receipt = transfer(4, 12)
+	l.ProcessMinedTransaction(tx, receipt, big.NewInt(0))
+	if len(anomalies) != 1 || anomalies[0].BlockNumber.Int64() != 12 || anomalies[0].TxHash != common.HexToHash(tx.Hash) {
+		t.Fatalf("expect block time anomaly for block 12")
+	}
+	if len(transfers) != 4 {
+		t.Fatalf("transfer should still be emitted when block time unavailable")
+	}
+}
@@ -0,0 +1,107 @@
+/*
+
+  Copyright 2017 Loopring Project Ltd (Loopring Foundation).
+
+  Licensed under the Apache License, Version 2.0 (the "License");
+  you may not use this file except in compliance with the License.
+  You may obtain a copy of the License at
+
+  http://www.apache.org/licenses/LICENSE-2.0
+
+  Unless required by applicable law or agreed to in writing, software
+  distributed under the License is distributed on an "AS IS" BASIS,
+  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+  See the License for the specific language governing permissions and
+  limitations under the License.
+
+*/
+
+package extractor
+
+import (
+	"github.com/Loopring/relay/ethaccessor"
+	"github.com/Loopring/relay/log"
+	"github.com/ethereum/go-ethereum/common"
+	"math/big"
+)
+
+// 追块时按区间通过eth_getLogs获取已注册事件, 区间内没有相关log的块只处理区块头, 不再获取全部交易及receipt.
+// 区间由ethaccessor按logs_chunk_size分段请求, 节点拒绝时自动缩小
+type catchUpScanner struct {
+	window  int64
+	topics  func() []common.Hash
+	head    func() (*big.Int, error)
+	getLogs func(from, to *big.Int, addresses []common.Address, topics [][]common.Hash) ([]ethaccessor.Log, error)
+
+	// 已扫描的区间及其中包含相关log的块号
+	from, to *big.Int
+	blocks   map[int64]bool
+}
+
+func newCatchUpScanner(window int64, topics func() []common.Hash, head func() (*big.Int, error)) *catchUpScanner {
+	return &catchUpScanner{
+		window:  window,
+		topics:  topics,
+		head:    head,
+		getLogs: ethaccessor.GetLogs,
+	}
+}
+
+// skippable 块内没有相关log时返回true, 超出已扫描区间时从该块开始扫描下一个区间, 超过head的块不跳过
+func (s *catchUpScanner) skippable(blockNumber *big.Int) (bool, error) {
+	if s.to == nil || blockNumber.Cmp(s.from) < 0 || blockNumber.Cmp(s.to) > 0 {
+		if err := s.scan(blockNumber); err != nil {
+			return false, err
+		}
+		if s.to == nil {
+			return false, nil
+		}
+	}
+	return !s.blocks[blockNumber.Int64()], nil
+}
+
+func (s *catchUpScanner) scan(from *big.Int) error {
+	s.from, s.to, s.blocks = nil, nil, nil
+
+	head, err := s.head()
+	if err != nil {
+		return err
+	}
+	if from.Cmp(head) > 0 {
+		return nil
+	}
+	to := new(big.Int).Add(from, big.NewInt(s.window-1))
+	if to.Cmp(head) > 0 {
+		to.Set(head)
+	}
+
+	// 同一位置的多个topic为或的关系
+	logs, err := s.getLogs(from, to, nil, [][]common.Hash{s.topics()})
+	if err != nil {
+		return err
+	}
+	blocks := make(map[int64]bool)
+	for _, evtLog := range logs {
+		if !evtLog.Removed {
+			blocks[evtLog.BlockNumber.Int64()] = true
+		}
+	}
+	s.from, s.to, s.blocks = new(big.Int).Set(from), to, blocks
+	log.Debugf("extractor,catch up scanned block %s-%s, %d blocks with logs", from.String(), to.String(), len(blocks))
+
+	return nil
+}
+
+// catchUpTopics 已注册的合约事件及erc20事件, Reload后随之变化, should be called with processMtx locked
+func (processor *AbiProcessor) catchUpTopics() []common.Hash {
+	var topics []common.Hash
+	for id := range processor.events {
+		topics = append(topics, id)
+	}
+	for id := range processor.erc20Events {
+		if _, ok := processor.events[id]; !ok {
+			topics = append(topics, id)
+		}
+	}
+	return topics
+}
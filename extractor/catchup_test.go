@@ -0,0 +1,96 @@
+/*
+
+  Copyright 2017 Loopring Project Ltd (Loopring Foundation).
+
+  Licensed under the Apache License, Version 2.0 (the "License");
+  you may not use this file except in compliance with the License.
+  You may obtain a copy of the License at
+
+  http://www.apache.org/licenses/LICENSE-2.0
+
+  Unless required by applicable law or agreed to in writing, software
+  distributed under the License is distributed on an "AS IS" BASIS,
+  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+  See the License for the specific language governing permissions and
+  limitations under the License.
+
+*/
+
+package extractor
+
+import (
+	"fmt"
+	"github.com/Loopring/relay/ethaccessor"
+	"github.com/Loopring/relay/types"
+	"github.com/ethereum/go-ethereum/common"
+	"math/big"
+	"testing"
+)
+
+func TestCatchUpScanner_Skippable(t *testing.T) {
+	transfer := common.HexToHash("0xddf252ad1be2c89b69c2b068fc378daa952ba7f163c4a11628f55a4df523b3ef")
+	head := big.NewInt(125)
+
+	var ranges []string
+	scanner := newCatchUpScanner(10, func() []common.Hash { return []common.Hash{transfer} }, func() (*big.Int, error) {
+		return head, nil
+	})
+	scanner.getLogs = func(from, to *big.Int, addresses []common.Address, topics [][]common.Hash) ([]ethaccessor.Log, error) {
+		ranges = append(ranges, fmt.Sprintf("%s-%s", from.String(), to.String()))
+		if len(topics) != 1 || len(topics[0]) != 1 || topics[0][0] != transfer {
+			t.Errorf("unexpected topics %v", topics)
+		}
+		var logs []ethaccessor.Log
+		for _, n := range []int64{103, 112, 121} {
+			if n >= from.Int64() && n <= to.Int64() {
+				logs = append(logs, ethaccessor.Log{BlockNumber: *types.NewBigWithInt(int(n))})
+			}
+		}
+		return logs, nil
+	}
+
+	for n := int64(100); n <= 126; n++ {
+		skip, err := scanner.skippable(big.NewInt(n))
+		if err != nil {
+			t.Fatal(err)
+		}
+		expect := n != 103 && n != 112 && n != 121 && n <= head.Int64()
+		if skip != expect {
+			t.Errorf("block %d expect skippable %t, got %t", n, expect, skip)
+		}
+	}
+
+	// 区间不超过已确认的head, 超出head后每块重新检查
+	expectRanges := []string{"100-109", "110-119", "120-125"}
+	if len(ranges) != len(expectRanges) {
+		t.Fatalf("expect scanned ranges %v, got %v", expectRanges, ranges)
+	}
+	for i, r := range expectRanges {
+		if ranges[i] != r {
+			t.Errorf("expect range %s, got %s", r, ranges[i])
+		}
+	}
+}
+
+func TestCatchUpScanner_GetLogsError(t *testing.T) {
+	scanner := newCatchUpScanner(10, func() []common.Hash { return nil }, func() (*big.Int, error) {
+		return big.NewInt(1000), nil
+	})
+	failed := true
+	scanner.getLogs = func(from, to *big.Int, addresses []common.Address, topics [][]common.Hash) ([]ethaccessor.Log, error) {
+		if failed {
+			return nil, fmt.Errorf("connection refused")
+		}
+		return nil, nil
+	}
+
+	if skip, err := scanner.skippable(big.NewInt(100)); err == nil || skip {
+		t.Fatalf("get logs error should not skip block, got %t %v", skip, err)
+	}
+
+	// 失败的区间不缓存, 下次重新获取
+	failed = false
+	if skip, err := scanner.skippable(big.NewInt(100)); err != nil || !skip {
+		t.Errorf("block without logs should be skipped after retry, got %t %v", skip, err)
+	}
+}
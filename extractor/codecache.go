@@ -0,0 +1,96 @@
+/*
+
+  Copyright 2017 Loopring Project Ltd (Loopring Foundation).
+
+  Licensed under the Apache License, Version 2.0 (the "License");
+  you may not use this file except in compliance with the License.
+  You may obtain a copy of the License at
+
+  http://www.apache.org/licenses/LICENSE-2.0
+
+  Unless required by applicable law or agreed to in writing, software
+  distributed under the License is distributed on an "AS IS" BASIS,
+  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+  See the License for the specific language governing permissions and
+  limitations under the License.
+
+*/
+
+package extractor
+
+import (
+	"container/list"
+	"github.com/ethereum/go-ethereum/common"
+	"sync"
+)
+
+// 未配置contract_code_cache_size时缓存的地址数
+const defaultContractCodeCacheSize = 10000
+
+type contractCode struct {
+	Address    common.Address `json:"address"`
+	IsContract bool           `json:"is_contract"`
+}
+
+// address -> 是否合约地址的LRU缓存, 超出容量时淘汰最久未访问的地址
+type contractCodeCache struct {
+	mtx   sync.Mutex
+	size  int
+	items map[common.Address]*list.Element
+	order *list.List // 队首为最近访问的地址
+}
+
+func newContractCodeCache(size int) *contractCodeCache {
+	if size <= 0 {
+		size = defaultContractCodeCacheSize
+	}
+	return &contractCodeCache{size: size, items: make(map[common.Address]*list.Element), order: list.New()}
+}
+
+func (c *contractCodeCache) get(address common.Address) (isContract bool, exists bool) {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+
+	elem, ok := c.items[address]
+	if !ok {
+		return false, false
+	}
+	c.order.MoveToFront(elem)
+	return elem.Value.(*contractCode).IsContract, true
+}
+
+func (c *contractCodeCache) add(address common.Address, isContract bool) {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+
+	if elem, ok := c.items[address]; ok {
+		elem.Value.(*contractCode).IsContract = isContract
+		c.order.MoveToFront(elem)
+		return
+	}
+	c.items[address] = c.order.PushFront(&contractCode{Address: address, IsContract: isContract})
+
+	for c.order.Len() > c.size {
+		oldest := c.order.Back()
+		c.order.Remove(oldest)
+		delete(c.items, oldest.Value.(*contractCode).Address)
+	}
+}
+
+func (c *contractCodeCache) len() int {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+	return c.order.Len()
+}
+
+// entries 按访问时间从旧到新返回, 依次add即可恢复淘汰顺序
+func (c *contractCodeCache) entries() []contractCode {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+
+	list := make([]contractCode, 0, c.order.Len())
+	for elem := c.order.Back(); elem != nil; elem = elem.Prev() {
+		list = append(list, *elem.Value.(*contractCode))
+	}
+	return list
+}
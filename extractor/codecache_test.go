@@ -0,0 +1,55 @@
+/*
+
+  Copyright 2017 Loopring Project Ltd (Loopring Foundation).
+
+  Licensed under the Apache License, Version 2.0 (the "License");
+  you may not use this file except in compliance with the License.
+  You may obtain a copy of the License at
+
+  http://www.apache.org/licenses/LICENSE-2.0
+
+  Unless required by applicable law or agreed to in writing, software
+  distributed under the License is distributed on an "AS IS" BASIS,
+  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+  See the License for the specific language governing permissions and
+  limitations under the License.
+
+*/
+
+package extractor
+
+import (
+	"github.com/ethereum/go-ethereum/common"
+	"testing"
+)
+
+func TestContractCodeCache_Evict(t *testing.T) {
+	a := common.HexToAddress("0x1B793201a2Ed5bC6bb5fE96B6e8Bd5F6B0b24A0d")
+	b := common.HexToAddress("0x255Aa6DF07540Cb5d3d297f0D0D4D84cb52bc8e6")
+	c := common.HexToAddress("0x4Ec94E1007605D70a86279370ec5e4b755295eDA")
+
+	cache := newContractCodeCache(2)
+	cache.add(a, true)
+	cache.add(b, false)
+
+	// 访问a后b成为最久未访问的地址
+	if ok, exists := cache.get(a); !exists || !ok {
+		t.Fatalf("a should be cached as contract")
+	}
+	cache.add(c, true)
+
+	if cache.len() != 2 {
+		t.Fatalf("cache size should be bounded to 2, got %d", cache.len())
+	}
+	if _, exists := cache.get(b); exists {
+		t.Fatalf("b should be evicted")
+	}
+	if _, exists := cache.get(a); !exists {
+		t.Fatalf("a should stay in cache")
+	}
+
+	entries := cache.entries()
+	if len(entries) != 2 || entries[0].Address != c || entries[1].Address != a {
+		t.Fatalf("entries should be ordered from oldest to newest, got %v", entries)
+	}
+}
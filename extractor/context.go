@@ -0,0 +1,84 @@
+/*
+
+  Copyright 2017 Loopring Project Ltd (Loopring Foundation).
+
+  Licensed under the Apache License, Version 2.0 (the "License");
+  you may not use this file except in compliance with the License.
+  You may obtain a copy of the License at
+
+  http://www.apache.org/licenses/LICENSE-2.0
+
+  Unless required by applicable law or agreed to in writing, software
+  distributed under the License is distributed on an "AS IS" BASIS,
+  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+  See the License for the specific language governing permissions and
+  limitations under the License.
+
+*/
+
+package extractor
+
+import (
+	"context"
+	"github.com/Loopring/relay/eventemiter"
+	"github.com/Loopring/relay/log"
+	"github.com/Loopring/relay/types"
+	"github.com/ethereum/go-ethereum/common"
+)
+
+// resetContext extractor启动时重建, 停止时cancel, 使阻塞在db/rpc上的handler及时返回
+func (processor *AbiProcessor) resetContext() {
+	processor.ctxMtx.Lock()
+	defer processor.ctxMtx.Unlock()
+
+	if processor.cancel != nil {
+		processor.cancel()
+	}
+	processor.ctx, processor.cancel = context.WithCancel(context.Background())
+}
+
+func (processor *AbiProcessor) cancelContext() {
+	processor.ctxMtx.Lock()
+	defer processor.ctxMtx.Unlock()
+
+	if processor.cancel != nil {
+		processor.cancel()
+	}
+}
+
+func (processor *AbiProcessor) context() context.Context {
+	processor.ctxMtx.RLock()
+	defer processor.ctxMtx.RUnlock()
+
+	if processor.ctx == nil {
+		return context.Background()
+	}
+	return processor.ctx
+}
+
+// callWithContext 将extractor的ctx传入db/rpc调用, ctx取消导致的失败发出ExtractorHandlerCancelled并返回ctx.Err()
+func (processor *AbiProcessor) callWithContext(txhash common.Hash, name string, fn func(ctx context.Context) error) error {
+	ctx := processor.context()
+	if err := ctx.Err(); err != nil {
+		processor.emitCancelled(txhash, name, err)
+		return err
+	}
+
+	if err := fn(ctx); err != nil {
+		if ctx.Err() != nil {
+			processor.emitCancelled(txhash, name, ctx.Err())
+			return ctx.Err()
+		}
+		return err
+	}
+	return nil
+}
+
+func (processor *AbiProcessor) emitCancelled(txhash common.Hash, name string, err error) {
+	log.Warnf("extractor,tx:%s %s cancelled:%s", txhash.Hex(), name, err.Error())
+	eventemitter.Emit(eventemitter.ExtractorHandlerCancelled, &types.ExtractorHandlerCancelledEvent{
+		TxHash: txhash,
+		Name:   name,
+		Err:    err,
+	})
+}
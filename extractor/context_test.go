@@ -0,0 +1,97 @@
+/*
+
+  Copyright 2017 Loopring Project Ltd (Loopring Foundation).
+
+  Licensed under the Apache License, Version 2.0 (the "License");
+  you may not use this file except in compliance with the License.
+  You may obtain a copy of the License at
+
+  http://www.apache.org/licenses/LICENSE-2.0
+
+  Unless required by applicable law or agreed to in writing, software
+  distributed under the License is distributed on an "AS IS" BASIS,
+  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+  See the License for the specific language governing permissions and
+  limitations under the License.
+
+*/
+
+package extractor
+
+import (
+	"context"
+	"github.com/Loopring/relay/dao"
+	"github.com/Loopring/relay/eventemiter"
+	"github.com/Loopring/relay/types"
+	"github.com/ethereum/go-ethereum/common"
+	"testing"
+	"time"
+)
+
+// blockingRdsService 模拟挂起的db查询, 直到ctx取消或release关闭
+type blockingRdsService struct {
+	dao.RdsService
+	started chan bool
+	release chan bool
+}
+
+func (s *blockingRdsService) GetOrdersByHashContext(ctx context.Context, orderhashs []string) (map[string]dao.Order, error) {
+	s.started <- true
+	select {
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	case <-s.release:
+		return make(map[string]dao.Order), nil
+	}
+}
+
+func TestAbiProcessor_CancelContext(t *testing.T) {
+	lrc, weth := setupMarketTokens()
+
+	db := &blockingRdsService{started: make(chan bool, 1), release: make(chan bool)}
+	defer close(db.release)
+	processor := &AbiProcessor{db: db}
+	processor.resetContext()
+
+	var cancelled []*types.ExtractorHandlerCancelledEvent
+	watcher := &eventemitter.Watcher{Concurrent: false, Handle: func(input eventemitter.EventData) error {
+		cancelled = append(cancelled, input.(*types.ExtractorHandlerCancelledEvent))
+		return nil
+	}}
+	eventemitter.On(eventemitter.ExtractorHandlerCancelled, watcher)
+	defer eventemitter.Un(eventemitter.ExtractorHandlerCancelled, watcher)
+
+	seller := dao.Order{OrderHash: common.HexToHash("0x01").Hex(), Owner: "0x1b978a1D302335a6F2Ebe4B8823B5E17c3C84135", TokenS: lrc.Protocol.Hex(), TokenB: weth.Protocol.Hex()}
+	buyer := dao.Order{OrderHash: common.HexToHash("0x02").Hex(), Owner: "0xb1018949b241D76A1AB2094f473E9bEfeAbB5Ead", TokenS: weth.Protocol.Hex(), TokenB: lrc.Protocol.Hex()}
+	data := ringMinedEventData([]dao.Order{seller, buyer})
+
+	result := make(chan error, 1)
+	go func() {
+		result <- processor.handleRingMinedEvent(data)
+	}()
+
+	// db查询挂起后停止extractor
+	<-db.started
+	processor.cancelContext()
+
+	select {
+	case err := <-result:
+		if err != context.Canceled {
+			t.Fatalf("expect context canceled, got %v", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatalf("handler should return promptly after cancel")
+	}
+	if len(cancelled) != 1 || cancelled[0].TxHash != data.TxHash || cancelled[0].Err != context.Canceled {
+		t.Fatalf("expect one cancelled event for tx:%s, got %d", data.TxHash.Hex(), len(cancelled))
+	}
+
+	// 取消后的调用直接返回, 重新启动后恢复
+	if err := processor.callWithContext(types.NilHash, "test", func(ctx context.Context) error { return nil }); err != context.Canceled {
+		t.Fatalf("call after cancel should fail, got %v", err)
+	}
+	processor.resetContext()
+	if err := processor.callWithContext(types.NilHash, "test", func(ctx context.Context) error { return nil }); err != nil {
+		t.Fatalf("call after reset should succeed, got %v", err)
+	}
+}
@@ -19,6 +19,9 @@
 package extractor
 
 import (
+	"bytes"
+	"context"
+	"encoding/json"
 	"fmt"
 	"github.com/Loopring/relay/config"
 	"github.com/Loopring/relay/dao"
@@ -31,8 +34,15 @@ import (
 	"github.com/ethereum/go-ethereum/common"
 	"github.com/ethereum/go-ethereum/common/hexutil"
 	"math/big"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
 )
 
+// lrcFee允许的相对偏差
+const defaultFeeTolerance = 0.01
+
 type EventData struct {
 	types.TxInfo
 	Event  interface{}
@@ -40,6 +50,7 @@ type EventData struct {
 	Id     common.Hash
 	Name   string
 	Topics []string
+	Input  string // 所在交易的input, permit等需要从调用参数补充事件信息
 }
 
 func newEventData(event *abi.Event, cabi *abi.ABI) EventData {
@@ -52,9 +63,82 @@ func newEventData(event *abi.Event, cabi *abi.ABI) EventData {
 	return c
 }
 
-func (event *EventData) FullFilled(tx *ethaccessor.Transaction, evtLog *ethaccessor.Log, gasUsed, blockTime *big.Int, methodName string) {
-	event.TxInfo = setTxInfo(tx, gasUsed, blockTime, methodName)
+// eventDataRecord EventData中可稳定序列化的部分, 用于日志及回放
+type eventDataRecord struct {
+	Id          string            `json:"id"`
+	Name        string            `json:"name"`
+	Topics      []string          `json:"topics"`
+	Protocol    string            `json:"protocol"`
+	TxHash      string            `json:"tx_hash"`
+	BlockNumber string            `json:"block_number"`
+	BlockTime   int64             `json:"block_time"`
+	TxLogIndex  int64             `json:"tx_log_index"`
+	Status      string            `json:"status"`
+	Event       interface{}       `json:"event"`
+	Amounts     map[string]string `json:"amounts,omitempty"`
+}
+
+// 开启后EventData序列化时附带event中big.Int字段的hex格式, 由ExtractorOptions.RawHexAmounts配置
+var rawHexAmounts bool
+
+// eventHexAmounts 以字段名为key输出event中所有*big.Int字段的hex值
+func eventHexAmounts(event interface{}) map[string]string {
+	v := reflect.ValueOf(event)
+	for v.Kind() == reflect.Ptr {
+		if v.IsNil() {
+			return nil
+		}
+		v = v.Elem()
+	}
+	if v.Kind() != reflect.Struct {
+		return nil
+	}
+
+	bigIntType := reflect.TypeOf(&big.Int{})
+	amounts := make(map[string]string)
+	for i := 0; i < v.NumField(); i++ {
+		field := v.Type().Field(i)
+		if field.PkgPath != "" || field.Type != bigIntType || v.Field(i).IsNil() {
+			continue
+		}
+		amounts[field.Name] = hexutil.EncodeBig(v.Field(i).Interface().(*big.Int))
+	}
+	if len(amounts) == 0 {
+		return nil
+	}
+	return amounts
+}
+
+// MarshalJSON omit abi pointer, TxInfo json tags conflict so fields are listed explicitly
+func (event EventData) MarshalJSON() ([]byte, error) {
+	record := eventDataRecord{
+		Id:         event.Id.Hex(),
+		Name:       event.Name,
+		Topics:     event.Topics,
+		Protocol:   event.Protocol.Hex(),
+		TxHash:     event.TxHash.Hex(),
+		BlockTime:  event.BlockTime,
+		TxLogIndex: event.TxLogIndex,
+		Status:     types.StatusStr(event.Status),
+		Event:      event.Event,
+	}
+	if event.BlockNumber != nil {
+		record.BlockNumber = event.BlockNumber.String()
+	}
+	if record.Topics == nil {
+		record.Topics = []string{}
+	}
+	if rawHexAmounts {
+		record.Amounts = eventHexAmounts(event.Event)
+	}
+
+	return json.Marshal(record)
+}
+
+func (event *EventData) FullFilled(tx *ethaccessor.Transaction, receipt *ethaccessor.TransactionReceipt, evtLog *ethaccessor.Log, gasUsed, blockTime *big.Int, methodName string) {
+	event.TxInfo = setTxInfo(tx, receipt, gasUsed, blockTime, methodName)
 	event.Topics = evtLog.Topics
+	event.Input = tx.Input
 	event.Protocol = common.HexToAddress(evtLog.Address)
 	event.TxLogIndex = evtLog.LogIndex.Int64()
 	event.Status = types.TX_STATUS_SUCCESS
@@ -79,14 +163,27 @@ func newMethodData(method *abi.Method, cabi *abi.ABI) MethodData {
 	return c
 }
 
-func (method *MethodData) FullFilled(tx *ethaccessor.Transaction, gasUsed, blockTime *big.Int, status types.TxStatus, methodName string) {
-	method.TxInfo = setTxInfo(tx, gasUsed, blockTime, methodName)
+func (method *MethodData) FullFilled(tx *ethaccessor.Transaction, receipt *ethaccessor.TransactionReceipt, gasUsed, blockTime *big.Int, status types.TxStatus, methodName string) {
+	method.TxInfo = setTxInfo(tx, receipt, gasUsed, blockTime, methodName)
 	method.Input = tx.Input
 	method.TxLogIndex = 0
 	method.Status = status
 }
 
-func setTxInfo(tx *ethaccessor.Transaction, gasUsed, blockTime *big.Int, methodName string) types.TxInfo {
+func (method *MethodData) isPending() bool {
+	return method.Status == types.TX_STATUS_PENDING
+}
+
+func (method *MethodData) isFailed() bool {
+	return method.Status == types.TX_STATUS_FAILED
+}
+
+// processNeeded 成功的交易由event处理, method只在pending或failed时需要单独处理
+func (method *MethodData) processNeeded() bool {
+	return method.isPending() || method.isFailed()
+}
+
+func setTxInfo(tx *ethaccessor.Transaction, receipt *ethaccessor.TransactionReceipt, gasUsed, blockTime *big.Int, methodName string) types.TxInfo {
 	var txinfo types.TxInfo
 
 	txinfo.BlockNumber = tx.BlockNumber.BigInt()
@@ -99,7 +196,7 @@ func setTxInfo(tx *ethaccessor.Transaction, gasUsed, blockTime *big.Int, methodN
 	txinfo.To = common.HexToAddress(tx.To)
 	txinfo.GasLimit = tx.Gas.BigInt()
 	txinfo.GasUsed = gasUsed
-	txinfo.GasPrice = tx.GasPrice.BigInt()
+	setGasPrice(&txinfo, tx, receipt)
 	txinfo.Nonce = tx.Nonce.BigInt()
 	txinfo.Value = tx.Value.BigInt()
 
@@ -114,6 +211,22 @@ func setTxInfo(tx *ethaccessor.Transaction, gasUsed, blockTime *big.Int, methodN
 	return txinfo
 }
 
+// setGasPrice mined交易以receipt中的effectiveGasPrice为准, pending及legacy节点没有时使用tx.gasPrice
+func setGasPrice(txinfo *types.TxInfo, tx *ethaccessor.Transaction, receipt *ethaccessor.TransactionReceipt) {
+	if receipt != nil && receipt.EffectiveGasPrice != nil {
+		txinfo.GasPrice = receipt.EffectiveGasPrice.BigInt()
+	} else {
+		txinfo.GasPrice = tx.GasPrice.BigInt()
+	}
+	if tx.MaxFeePerGas != nil {
+		txinfo.MaxFeePerGas = tx.MaxFeePerGas.BigInt()
+	}
+	if tx.MaxPriorityFeePerGas != nil {
+		txinfo.MaxPriorityFeePerGas = tx.MaxPriorityFeePerGas.BigInt()
+	}
+	txinfo.SponsoredTransaction = types.IsSponsoredGasPrice(txinfo.GasPrice)
+}
+
 type AbiProcessor struct {
 	events      map[common.Hash]EventData
 	methods     map[string]MethodData
@@ -122,29 +235,190 @@ type AbiProcessor struct {
 	delegates   map[common.Address]string
 	db          dao.RdsService
 	options     *config.ExtractorOptions
+
+	// erc20 abi中全部method id, 包括未处理的method
+	erc20Methods map[string]bool
+
+	// delegate -> protocol, 多版本部署时每个版本有自己的delegate
+	delegateProtocols map[common.Address]common.Address
+	// protocol -> version, route_protocol_version开启时用于发出带版本的事件
+	protocolVersions map[common.Address]string
+	// protocol -> 是否当前版本, 废弃版本仍识别但不再转发ringMined/cancel/cutoff事件
+	activeProtocols map[common.Address]bool
+	// AddressAuthorized/AddressDeAuthorized会在不同watcher中修改delegates
+	delegateMtx sync.RWMutex
+
+	// tokens never registered, resolved on chain the first time we see their transfer
+	unknownTokens map[common.Address]bool
+	// market util淘汰的token, 由区块处理协程在下一个块开始前移除
+	evictedTokens []*types.TokenEvictedEvent
+	evictedMtx    sync.Mutex
+	erc20Symbol   func(ctx context.Context, tokenAddress common.Address, blockParameter string) (string, error)
+	erc20Decimals func(ctx context.Context, tokenAddress common.Address, blockParameter string) (uint8, error)
+
+	// accounts relay cares about, eg: unlocked wallets
+	trackedOwner func(owner common.Address) bool
+
+	// 最近区块中已处理的日志, 重复投递时跳过
+	seenLogs *seenLogs
+	// 当前交易中已发出的授权, 数量不变的重复Approval不再发出
+	approvals txApprovals
+	// 按owner限制transfer/approve的发出数量, nil时不限制
+	ownerLimiter *ownerRateLimiter
+	// 各event/method已处理数量及extractor指标的进程内计数
+	stats *statsRegistry
+	// 垃圾token合约, transfer/approve直接丢弃
+	spam spamContracts
+
+	// address -> 是否合约地址, 只在route_contract_transfers开启时使用
+	contractCodes *contractCodeCache
+	hasCode       func(ctx context.Context, address common.Address) (bool, error)
+
+	// 当前块内ringMined涉及的订单, nil时直接查询db
+	orderBatch    *blockOrderBatch
+	orderBatchMtx sync.RWMutex
+
+	// processor注册的全部watcher, Unload时移除
+	watchers map[string]*eventemitter.Watcher
+
+	// 正在重放的交易, 其事件带Replay标记
+	replayTxs map[common.Hash]bool
+	replayMtx sync.RWMutex
+
+	// extractor停止时取消, 中断handler中的db/rpc调用
+	ctx    context.Context
+	cancel context.CancelFunc
+	ctxMtx sync.RWMutex
 }
 
 // 这里无需考虑版本问题，对解析来说，不接受版本升级带来数据结构变化的可能性
 func newAbiProcessor(db dao.RdsService, option *config.ExtractorOptions) *AbiProcessor {
 	processor := &AbiProcessor{}
 
+	processor.options = option
+	processor.resetContracts()
+	processor.erc20Symbol = ethaccessor.Erc20SymbolContext
+	processor.erc20Decimals = ethaccessor.Erc20DecimalsContext
+	processor.contractCodes = newContractCodeCache(option.ContractCodeCacheSize)
+	processor.hasCode = hasCode
+	processor.db = db
+	processor.resetContext()
+
+	processor.ownerLimiter = newOwnerRateLimiter(option.OwnerEventRate, option.OwnerEventBurst)
+	processor.stats = newStatsRegistry()
+	processor.spam.reset(spamContractAddresses(option.SpamContracts))
+
+	if option.SnapshotFile == "" || !processor.loadSnapshot(option.SnapshotFile) {
+		processor.loadProtocolAddress()
+	} else {
+		// 协议版本以配置为准, 快照恢复后重新加载
+		for _, v := range ethaccessor.ProtocolAddresses() {
+			processor.loadProtocolVersion(v)
+		}
+	}
+	processor.loadContracts()
+	//processor.loadTokenRegisterContract()
+	//processor.loadTokenTransferDelegateProtocol()
+
+	return processor
+}
+
+// 合约地址及event/method注册信息, 初始化及Reload时重建
+// 未知token及去重记录依赖旧的合约列表, 一并清除, 去重高水位保留以免快照回退
+func (processor *AbiProcessor) resetContracts() {
 	processor.events = make(map[common.Hash]EventData)
 	processor.erc20Events = make(map[common.Hash]bool)
+	processor.erc20Methods = make(map[string]bool)
 	processor.methods = make(map[string]MethodData)
 	processor.protocols = make(map[common.Address]string)
+	processor.delegateMtx.Lock()
 	processor.delegates = make(map[common.Address]string)
-	processor.db = db
-
-	processor.options = option
+	processor.delegateProtocols = make(map[common.Address]common.Address)
+	processor.delegateMtx.Unlock()
+	processor.protocolVersions = make(map[common.Address]string)
+	processor.activeProtocols = make(map[common.Address]bool)
+	processor.watchers = make(map[string]*eventemitter.Watcher)
+	processor.unknownTokens = make(map[common.Address]bool)
+
+	var latest int64
+	if processor.seenLogs != nil {
+		processor.seenLogs.mtx.Lock()
+		latest = processor.seenLogs.latest
+		processor.seenLogs.mtx.Unlock()
+	}
+	processor.seenLogs = nil
+	if processor.options != nil {
+		processor.seenLogs = newSeenLogs(processor.options.EventDedupWindow)
+	}
+	if processor.seenLogs != nil {
+		processor.seenLogs.latest = latest
+	}
+}
 
-	processor.loadProtocolAddress()
+func (processor *AbiProcessor) loadContracts() {
 	processor.loadErc20Contract()
 	processor.loadWethContract()
 	processor.loadProtocolContract()
-	//processor.loadTokenRegisterContract()
-	//processor.loadTokenTransferDelegateProtocol()
+}
 
-	return processor
+// Unload 移除processor注册的全部watcher, 之后不再处理任何合约事件
+func (processor *AbiProcessor) Unload() {
+	for topic, watcher := range processor.watchers {
+		eventemitter.Un(topic, watcher)
+	}
+	processor.watchers = make(map[string]*eventemitter.Watcher)
+}
+
+// Reload 配置变更后重新加载合约, 需在extractor停止处理区块时调用
+func (processor *AbiProcessor) Reload(db dao.RdsService, option *config.ExtractorOptions) {
+	processor.Unload()
+
+	previous := processor.protocolVersions
+
+	processor.db = db
+	processor.options = option
+	processor.spam.reset(spamContractAddresses(option.SpamContracts))
+	processor.resetContracts()
+	processor.loadProtocolAddress()
+	processor.loadContracts()
+
+	if evt, ok := protocolSetChange(previous, processor.protocolVersions); ok {
+		log.Infof("extractor,protocol set changed, added:%d, removed:%d", len(evt.Added), len(evt.Removed))
+		eventemitter.Emit(eventemitter.ProtocolSetChanged, evt)
+	}
+}
+
+// protocolSetChange 比较前后两次加载的协议合约地址, 无变化时返回false
+func protocolSetChange(previous, current map[common.Address]string) (*types.ProtocolSetChangedEvent, bool) {
+	evt := &types.ProtocolSetChangedEvent{}
+	for protocol := range current {
+		if _, ok := previous[protocol]; !ok {
+			evt.Added = append(evt.Added, protocol)
+		}
+	}
+	for protocol := range previous {
+		if _, ok := current[protocol]; !ok {
+			evt.Removed = append(evt.Removed, protocol)
+		}
+	}
+	if len(evt.Added) == 0 && len(evt.Removed) == 0 {
+		return nil, false
+	}
+
+	sortAddresses(evt.Added)
+	sortAddresses(evt.Removed)
+	return evt, true
+}
+
+func sortAddresses(list []common.Address) {
+	sort.Slice(list, func(i, j int) bool {
+		return bytes.Compare(list[i].Bytes(), list[j].Bytes()) < 0
+	})
+}
+
+func (processor *AbiProcessor) watch(topic string, watcher *eventemitter.Watcher) {
+	eventemitter.On(topic, watcher)
+	processor.watchers[topic] = watcher
 }
 
 // GetEvent get EventData with id hash
@@ -230,31 +504,240 @@ func (processor *AbiProcessor) SupportedMethod(tx *ethaccessor.Transaction) bool
 	return ok
 }
 
+// IsValidEthTransferTransaction 新token上线而relay/miner尚未支持时, 对该token的调用不能当作eth转账.
+// 调用token合约或者calldata为erc20方法时返回false, 不带input直接向token合约转eth(如weth fallback)仍视为eth转账
+func (processor *AbiProcessor) IsValidEthTransferTransaction(tx *ethaccessor.Transaction) bool {
+	id := tx.MethodId()
+	if id == "" {
+		return true
+	}
+	if processor.erc20Methods[id] {
+		return false
+	}
+
+	to := common.HexToAddress(tx.To)
+	if processor.SupportedContract(to) || processor.unknownTokens[to] {
+		return false
+	}
+	if _, ok := util.TokenByAddress(to); ok {
+		return false
+	}
+	return true
+}
+
 // HasSpender check approve spender address have ever been load
 func (processor *AbiProcessor) HasSpender(spender common.Address) bool {
+	processor.delegateMtx.RLock()
+	defer processor.delegateMtx.RUnlock()
 	_, ok := processor.delegates[spender]
 	return ok
 }
 
+// GetDelegateProtocol find protocol which delegate belongs to
+func (processor *AbiProcessor) GetDelegateProtocol(delegate common.Address) (common.Address, bool) {
+	processor.delegateMtx.RLock()
+	defer processor.delegateMtx.RUnlock()
+	protocol, ok := processor.delegateProtocols[delegate]
+	return protocol, ok
+}
+
+// IsRelevantTransaction 解析前预过滤, 交易涉及已知合约、token或者跟踪的账户
+func (processor *AbiProcessor) IsRelevantTransaction(tx *ethaccessor.Transaction) bool {
+	from := common.HexToAddress(tx.From)
+	to := common.HexToAddress(tx.To)
+
+	if processor.SupportedContract(to) || processor.HasSpender(to) {
+		return true
+	}
+
+	// token registered after processor loaded
+	if _, err := util.AddressToToken(to); err == nil {
+		return true
+	}
+
+	if processor.trackedOwner != nil && (processor.trackedOwner(from) || processor.trackedOwner(to)) {
+		return true
+	}
+
+	return false
+}
+
 func (processor *AbiProcessor) loadProtocolAddress() {
-	for _, v := range util.AllTokens {
-		processor.protocols[v.Protocol] = v.Symbol
-		log.Infof("extractor,contract protocol %s->%s", v.Symbol, v.Protocol.Hex())
+	for _, v := range util.AllTokens() {
+		processor.loadTokenAddress(v.Protocol, v.Symbol)
 	}
 
 	for _, v := range ethaccessor.ProtocolAddresses() {
-		protocolSymbol := "loopring"
-		delegateSymbol := "transfer_delegate"
-		tokenRegisterSymbol := "token_register"
+		processor.loadProtocolVersion(v)
+	}
+}
+
+func (processor *AbiProcessor) loadTokenAddress(token common.Address, symbol string) {
+	processor.protocols[token] = symbol
+	log.Infof("extractor,contract protocol %s->%s", symbol, token.Hex())
+}
+
+// 只移除token地址, 不影响同地址的loopring合约
+func (processor *AbiProcessor) unloadTokenAddress(token common.Address, symbol string) {
+	if processor.protocols[token] == symbol {
+		delete(processor.protocols, token)
+	}
+}
+
+// handleTokenEvicted 在market util的协程中调用, 只记录, 不直接修改protocols
+func (processor *AbiProcessor) handleTokenEvicted(input eventemitter.EventData) error {
+	evt := input.(*types.TokenEvictedEvent)
+
+	processor.evictedMtx.Lock()
+	processor.evictedTokens = append(processor.evictedTokens, evt)
+	processor.evictedMtx.Unlock()
+	return nil
+}
+
+// unloadEvictedTokens 移除已淘汰token, 未验证token再次出现transfer时重新查询注册
+func (processor *AbiProcessor) unloadEvictedTokens() {
+	processor.evictedMtx.Lock()
+	list := processor.evictedTokens
+	processor.evictedTokens = nil
+	processor.evictedMtx.Unlock()
+
+	for _, evt := range list {
+		processor.unloadTokenAddress(evt.Token, evt.Symbol)
+		delete(processor.unknownTokens, evt.Token)
+		log.Infof("extractor,evicted token %s->%s unloaded", evt.Symbol, evt.Token.Hex())
+	}
+}
+
+// delegate授权protocol后, 作为该protocol的spender
+func (processor *AbiProcessor) loadDelegate(delegate, protocol common.Address) {
+	processor.delegateMtx.Lock()
+	defer processor.delegateMtx.Unlock()
+
+	processor.delegates[delegate] = "transfer_delegate"
+	processor.delegateProtocols[delegate] = protocol
+	log.Infof("extractor,delegate %s authorized protocol %s", delegate.Hex(), protocol.Hex())
+}
+
+// delegate取消对protocol的授权后, 不再作为spender
+func (processor *AbiProcessor) unloadDelegate(delegate, protocol common.Address) {
+	processor.delegateMtx.Lock()
+	defer processor.delegateMtx.Unlock()
+
+	if current, ok := processor.delegateProtocols[delegate]; ok && current == protocol {
+		delete(processor.delegates, delegate)
+		delete(processor.delegateProtocols, delegate)
+		log.Infof("extractor,delegate %s deauthorized protocol %s", delegate.Hex(), protocol.Hex())
+	}
+}
+
+func (processor *AbiProcessor) loadProtocolVersion(v *ethaccessor.ProtocolAddress) {
+	protocolSymbol := "loopring"
+	delegateSymbol := "transfer_delegate"
+	tokenRegisterSymbol := "token_register"
+
+	processor.protocols[v.ContractAddress] = protocolSymbol
+	processor.protocols[v.TokenRegistryAddress] = tokenRegisterSymbol
+	processor.protocols[v.DelegateAddress] = delegateSymbol
+	processor.protocolVersions[v.ContractAddress] = v.Version
+	processor.activeProtocols[v.ContractAddress] = !processor.deprecatedVersion(v.Version)
+	processor.delegateMtx.Lock()
+	processor.delegates[v.DelegateAddress] = delegateSymbol
+	processor.delegateProtocols[v.DelegateAddress] = v.ContractAddress
+	processor.delegateMtx.Unlock()
+
+	log.Infof("extractor,contract protocol %s->%s", protocolSymbol, v.ContractAddress.Hex())
+	log.Infof("extractor,contract protocol %s->%s", tokenRegisterSymbol, v.TokenRegistryAddress.Hex())
+	log.Infof("extractor,contract protocol %s->%s", delegateSymbol, v.DelegateAddress.Hex())
+}
+
+func (processor *AbiProcessor) deprecatedVersion(version string) bool {
+	if processor.options == nil {
+		return false
+	}
+	for _, v := range processor.options.DeprecatedProtocolVersions {
+		if v == version {
+			return true
+		}
+	}
+	return false
+}
+
+// IsActiveProtocol 废弃版本的协议返回false, 未按版本加载的地址不做限制
+func (processor *AbiProcessor) IsActiveProtocol(protocol common.Address) bool {
+	active, ok := processor.activeProtocols[protocol]
+	return !ok || active
+}
+
+// unpackMethodInput 解析失败时发出ExtractorUnpackError, 调用方直接返回nil, 不阻塞后续处理
+func unpackMethodInput(contract MethodData, v interface{}) bool {
+	var (
+		data []byte
+		err  error
+	)
+	if len(contract.Input) < 10 {
+		err = fmt.Errorf("input length %d shorter than method id", len(contract.Input))
+	} else if data, err = hexutil.Decode("0x" + contract.Input[10:]); err == nil {
+		err = contract.CAbi.UnpackMethodInput(v, contract.Name, data)
+	}
+	if err != nil {
+		emitUnpackError(contract.TxHash, contract.BlockNumber, contract.Name, err)
+		return false
+	}
+	return true
+}
+
+func emitUnpackError(txhash common.Hash, blockNumber *big.Int, name string, err error) {
+	log.Errorf("extractor,tx:%s %s unpack error:%s", txhash.Hex(), name, err.Error())
+	eventemitter.Emit(eventemitter.ExtractorUnpackError, &types.ExtractorUnpackErrorEvent{
+		TxHash:      txhash,
+		BlockNumber: blockNumber,
+		Name:        name,
+		Err:         err,
+	})
+}
+
+// registerEvent 同一event id只注册一次, weth等abi与erc20 abi重复声明Transfer/Approval时保留先注册的, 避免同一日志被处理两次
+func (processor *AbiProcessor) registerEvent(contract EventData, watcher *eventemitter.Watcher) bool {
+	if !processor.handlerEnabled(contract.Name) {
+		log.Infof("extractor,contract event name:%s not enabled", contract.Name)
+		return false
+	}
+	if exist, ok := processor.events[contract.Id]; ok {
+		log.Warnf("extractor,contract event name:%s -> key:%s already registered by event:%s, ignored", contract.Name, contract.Id.Hex(), exist.Name)
+		return false
+	}
+
+	watcher.Handle = processor.stats.wrap(contract.Name, watcher.Handle)
+	processor.watch(contract.Id.Hex(), watcher)
+	processor.events[contract.Id] = contract
+	log.Infof("extractor,contract event name:%s -> key:%s", contract.Name, contract.Id.Hex())
+	return true
+}
+
+func (processor *AbiProcessor) registerMethod(contract MethodData, watcher *eventemitter.Watcher) bool {
+	if !processor.handlerEnabled(contract.Name) {
+		log.Infof("extractor,contract method name:%s not enabled", contract.Name)
+		return false
+	}
 
-		processor.protocols[v.ContractAddress] = protocolSymbol
-		processor.protocols[v.TokenRegistryAddress] = tokenRegisterSymbol
-		processor.protocols[v.DelegateAddress] = delegateSymbol
+	watcher.Handle = processor.stats.wrap(contract.Name, watcher.Handle)
+	processor.watch(contract.Id, watcher)
+	processor.methods[contract.Id] = contract
+	log.Infof("extractor,contract method name:%s -> key:%s", contract.Name, contract.Id)
+	return true
+}
 
-		log.Infof("extractor,contract protocol %s->%s", protocolSymbol, v.ContractAddress.Hex())
-		log.Infof("extractor,contract protocol %s->%s", tokenRegisterSymbol, v.TokenRegistryAddress.Hex())
-		log.Infof("extractor,contract protocol %s->%s", delegateSymbol, v.DelegateAddress.Hex())
+// handlerEnabled 配置enabled_handlers时只处理列出的method/event, 精简部署时跳过transfer/approve等解析
+func (processor *AbiProcessor) handlerEnabled(name string) bool {
+	if processor.options == nil || len(processor.options.EnabledHandlers) == 0 {
+		return true
+	}
+	for _, v := range processor.options.EnabledHandlers {
+		if v == name {
+			return true
+		}
 	}
+	return false
 }
 
 func (processor *AbiProcessor) loadProtocolContract() {
@@ -281,9 +764,7 @@ func (processor *AbiProcessor) loadProtocolContract() {
 			watcher = &eventemitter.Watcher{Concurrent: false, Handle: processor.handleCutoffPairEvent}
 		}
 
-		eventemitter.On(contract.Id.Hex(), watcher)
-		processor.events[contract.Id] = contract
-		log.Infof("extractor,contract event name:%s -> key:%s", contract.Name, contract.Id.Hex())
+		processor.registerEvent(contract, watcher)
 	}
 
 	for name, method := range ethaccessor.ProtocolImplAbi().Methods {
@@ -309,9 +790,7 @@ func (processor *AbiProcessor) loadProtocolContract() {
 			watcher = &eventemitter.Watcher{Concurrent: false, Handle: processor.handleCutoffPairMethod}
 		}
 
-		eventemitter.On(contract.Id, watcher)
-		processor.methods[contract.Id] = contract
-		log.Infof("extractor,contract method name:%s -> key:%s", contract.Name, contract.Id)
+		processor.registerMethod(contract, watcher)
 	}
 }
 
@@ -333,32 +812,38 @@ func (processor *AbiProcessor) loadErc20Contract() {
 			watcher = &eventemitter.Watcher{Concurrent: false, Handle: processor.handleApprovalEvent}
 		}
 
-		eventemitter.On(contract.Id.Hex(), watcher)
-		processor.events[contract.Id] = contract
-		processor.erc20Events[contract.Id] = true
-		log.Infof("extractor,contract event name:%s -> key:%s", contract.Name, contract.Id.Hex())
-	}
-
-	for name, method := range ethaccessor.Erc20Abi().Methods {
-		if name != ethaccessor.METHOD_TRANSFER && name != ethaccessor.METHOD_APPROVE {
-			continue
+		if processor.registerEvent(contract, watcher) {
+			processor.erc20Events[contract.Id] = true
 		}
+	}
 
+	for _, method := range ethaccessor.Erc20Abi().Methods {
 		watcher := &eventemitter.Watcher{}
 		contract := newMethodData(&method, ethaccessor.Erc20Abi())
+		processor.erc20Methods[contract.Id] = true
 
 		switch contract.Name {
 		case ethaccessor.METHOD_TRANSFER:
 			contract.Method = &ethaccessor.TransferMethod{}
 			watcher = &eventemitter.Watcher{Concurrent: false, Handle: processor.handleTransferMethod}
+		case ethaccessor.METHOD_TRANSFER_FROM:
+			contract.Method = &ethaccessor.TransferFromMethod{}
+			watcher = &eventemitter.Watcher{Concurrent: false, Handle: processor.handleTransferFromMethod}
 		case ethaccessor.METHOD_APPROVE:
 			contract.Method = &ethaccessor.ApproveMethod{}
 			watcher = &eventemitter.Watcher{Concurrent: false, Handle: processor.handleApproveMethod}
+		case ethaccessor.METHOD_INCREASE_APPROVAL, ethaccessor.METHOD_DECREASE_APPROVAL,
+			ethaccessor.METHOD_INCREASE_ALLOWANCE, ethaccessor.METHOD_DECREASE_ALLOWANCE:
+			contract.Method = &ethaccessor.AllowanceChangeMethod{}
+			watcher = &eventemitter.Watcher{Concurrent: false, Handle: processor.handleAllowanceChangeMethod}
+		case ethaccessor.METHOD_PERMIT:
+			contract.Method = &ethaccessor.PermitMethod{}
+			watcher = &eventemitter.Watcher{Concurrent: false, Handle: processor.handlePermitMethod}
+		default:
+			continue
 		}
 
-		eventemitter.On(contract.Id, watcher)
-		processor.methods[contract.Id] = contract
-		log.Infof("extractor,contract method name:%s -> key:%s", contract.Name, contract.Id)
+		processor.registerMethod(contract, watcher)
 	}
 }
 
@@ -380,9 +865,7 @@ func (processor *AbiProcessor) loadWethContract() {
 			watcher = &eventemitter.Watcher{Concurrent: false, Handle: processor.handleWethWithdrawalMethod}
 		}
 
-		eventemitter.On(contract.Id, watcher)
-		processor.methods[contract.Id] = contract
-		log.Infof("extractor,contract method name:%s -> key:%s", contract.Name, contract.Id)
+		processor.registerMethod(contract, watcher)
 	}
 
 	for name, event := range ethaccessor.WethAbi().Events {
@@ -402,9 +885,7 @@ func (processor *AbiProcessor) loadWethContract() {
 			watcher = &eventemitter.Watcher{Concurrent: false, Handle: processor.handleWethWithdrawalEvent}
 		}
 
-		eventemitter.On(contract.Id.Hex(), watcher)
-		processor.events[contract.Id] = contract
-		log.Infof("extractor,contract event name:%s -> key:%s", contract.Name, contract.Id.Hex())
+		processor.registerEvent(contract, watcher)
 	}
 }
 
@@ -426,9 +907,7 @@ func (processor *AbiProcessor) loadTokenRegisterContract() {
 			watcher = &eventemitter.Watcher{Concurrent: false, Handle: processor.handleTokenUnRegisteredEvent}
 		}
 
-		eventemitter.On(contract.Id.Hex(), watcher)
-		processor.events[contract.Id] = contract
-		log.Infof("extractor,contract event name:%s -> key:%s", contract.Name, contract.Id.Hex())
+		processor.registerEvent(contract, watcher)
 	}
 }
 
@@ -450,22 +929,22 @@ func (processor *AbiProcessor) loadTokenTransferDelegateProtocol() {
 			watcher = &eventemitter.Watcher{Concurrent: false, Handle: processor.handleAddressDeAuthorizedEvent}
 		}
 
-		eventemitter.On(contract.Id.Hex(), watcher)
-		processor.events[contract.Id] = contract
-		log.Infof("extractor,contract event name:%s -> key:%s", contract.Name, contract.Id.Hex())
+		processor.registerEvent(contract, watcher)
 	}
 }
 
 // 只需要解析submitRing,cancel，cutoff这些方法在event里，如果方法不成功也不用执行后续逻辑
 func (processor *AbiProcessor) handleSubmitRingMethod(input eventemitter.EventData) error {
 	contract := input.(MethodData)
+	if !processor.IsActiveProtocol(contract.Protocol) {
+		log.Infof("extractor,tx:%s submitRing method from deprecated protocol:%s skipped", contract.TxHash.Hex(), contract.Protocol.Hex())
+		return nil
+	}
 
 	// unpack submit ring method
 	ring := contract.Method.(*ethaccessor.SubmitRingMethodInputs)
 	ring.Protocol = contract.To
-	data := hexutil.MustDecode("0x" + contract.Input[10:])
-	if err := contract.CAbi.UnpackMethodInput(ring, contract.Name, data); err != nil {
-		log.Errorf("extractor,tx:%s submitRing method, unpack error:%s", contract.TxHash.Hex(), err.Error())
+	if !unpackMethodInput(contract, ring) {
 		return nil
 	}
 
@@ -478,26 +957,71 @@ func (processor *AbiProcessor) handleSubmitRingMethod(input eventemitter.EventDa
 
 	// set txinfo for event
 	event.TxInfo = contract.TxInfo
-	if event.Status == types.TX_STATUS_FAILED {
+	if contract.isFailed() {
 		event.Err = fmt.Errorf("method %s transaction failed", contract.Name)
 	}
 
-	// 不需要发送订单到gateway
-	//for _, v := range event.OrderList {
-	//	v.Hash = v.GenerateHash()
-	//	log.Debugf("extractor,tx:%s submitRing method orderHash:%s,owner:%s,tokenS:%s,tokenB:%s,amountS:%s,amountB:%s", event.TxHash.Hex(), v.Hash.Hex(), v.Owner.Hex(), v.TokenS.Hex(), v.TokenB.Hex(), v.AmountS.String(), v.AmountB.String())
-	//	eventemitter.Emit(eventemitter.GatewayNewOrder, v)
-	//}
+	// 从环路中恢复订单发送到gateway, gateway对已存在的订单不做处理
+	for i := range event.OrderList {
+		v := &event.OrderList[i]
+		v.Protocol = ring.Protocol
+		v.DelegateAddress = contract.DelegateAddress
+		v.Hash = v.GenerateHash()
+		log.Debugf("extractor,tx:%s submitRing method orderHash:%s,owner:%s,tokenS:%s,tokenB:%s,amountS:%s,amountB:%s", event.TxHash.Hex(), v.Hash.Hex(), v.Owner.Hex(), v.TokenS.Hex(), v.TokenB.Hex(), v.AmountS.String(), v.AmountB.String())
+		eventemitter.Emit(eventemitter.GatewayNewOrder, v)
+	}
+	processor.verifyOrderHashes(event.TxInfo, event.OrderList)
+
+	// pending的submitRing结果未知, 只有确认失败后才把订单记为失败成交
+	if contract.isFailed() {
+		processor.saveOrderListAsTxs(event.TxInfo, event.OrderList)
+	}
 
 	log.Debugf("extractor,tx:%s submitRing method gas:%s, gasprice:%s, status:%s", event.TxHash.Hex(), event.GasUsed.String(), event.GasPrice.String(), types.StatusStr(event.Status))
 
-	eventemitter.Emit(eventemitter.Miner_SubmitRing_Method, event)
+	processor.emitProtocolEvent(eventemitter.Miner_SubmitRing_Method, event.Protocol, event)
 
 	return nil
 }
 
+// saveOrderListAsTxs 失败的submitRing没有ringMined事件, 将环路中的订单作为失败的成交发出,
+// 其他模块只处理成功的成交, txmanager据此记录用户的失败交易
+func (processor *AbiProcessor) saveOrderListAsTxs(txinfo types.TxInfo, orders []types.Order) {
+	length := len(orders)
+	for i, ord := range orders {
+		fill := &types.OrderFilledEvent{}
+		fill.TxInfo = txinfo
+		fill.RingIndex = big.NewInt(0)
+		fill.FillIndex = big.NewInt(int64(i))
+		fill.OrderHash = ord.Hash
+		fill.PreOrderHash = orders[(i+length-1)%length].Hash
+		fill.NextOrderHash = orders[(i+1)%length].Hash
+		fill.Owner = ord.Owner
+		fill.TokenS = ord.TokenS
+		fill.TokenB = ord.TokenB
+		fill.SellTo = orders[(i+1)%length].Owner
+		fill.BuyFrom = orders[(i+length-1)%length].Owner
+		fill.AmountS = ord.AmountS
+		fill.AmountB = ord.AmountB
+		fill.LrcFee = big.NewInt(0)
+		fill.LrcReward = big.NewInt(0)
+		fill.SplitS = big.NewInt(0)
+		fill.SplitB = big.NewInt(0)
+		if market, err := util.WrapMarketByAddress(fill.TokenB.Hex(), fill.TokenS.Hex()); err == nil {
+			fill.Market = market
+		}
+
+		log.Debugf("extractor,tx:%s submitRing method failed, save order:%s as failed fill", txinfo.TxHash.Hex(), ord.Hash.Hex())
+		processor.emitProtocolEvent(eventemitter.OrderFilled, fill.Protocol, fill)
+	}
+}
+
 func (processor *AbiProcessor) handleCancelOrderMethod(input eventemitter.EventData) error {
 	contract := input.(MethodData)
+	if !processor.IsActiveProtocol(contract.Protocol) {
+		log.Infof("extractor,tx:%s cancelOrder method from deprecated protocol:%s skipped", contract.TxHash.Hex(), contract.Protocol.Hex())
+		return nil
+	}
 	contractEvent := contract.Method.(*ethaccessor.CancelOrderMethod)
 
 	if contract.DelegateAddress == types.NilAddress {
@@ -505,9 +1029,7 @@ func (processor *AbiProcessor) handleCancelOrderMethod(input eventemitter.EventD
 		return nil
 	}
 
-	data := hexutil.MustDecode("0x" + contract.Input[10:])
-	if err := contract.CAbi.UnpackMethodInput(contractEvent, contract.Name, data); err != nil {
-		log.Errorf("extractor,tx:%s cancelOrder method unpack error:%s", contract.TxHash.Hex(), err.Error())
+	if !unpackMethodInput(contract, contractEvent) {
 		return nil
 	}
 
@@ -517,64 +1039,97 @@ func (processor *AbiProcessor) handleCancelOrderMethod(input eventemitter.EventD
 	order.Hash = order.GenerateHash()
 	log.Debugf("extractor,tx:%s cancelOrder method order tokenS:%s,tokenB:%s,amountS:%s,amountB:%s", contract.TxHash.Hex(), order.TokenS.Hex(), order.TokenB.Hex(), order.AmountS.String(), order.AmountB.String())
 
-	// 发送到txmanager
 	tmCancelEvent := &types.OrderCancelledEvent{}
 	tmCancelEvent.TxInfo = contract.TxInfo
 	tmCancelEvent.OrderHash = order.Hash
 	tmCancelEvent.AmountCancelled = cancelAmount
-	eventemitter.Emit(eventemitter.CancelOrder, tmCancelEvent)
+
+	// pending cancel is provisional, consumers replace it by the mined cancel of the same tx.
+	// mined tx with orderCancelled event is handled by event path, method path only sees mined tx without event(e.g. failed)
+	processor.emitProtocolEvent(eventemitter.CancelOrder, tmCancelEvent.Protocol, tmCancelEvent)
 
 	return nil
 }
 
 func (processor *AbiProcessor) handleCutoffMethod(input eventemitter.EventData) error {
 	contract := input.(MethodData)
+	if !processor.IsActiveProtocol(contract.Protocol) {
+		log.Infof("extractor,tx:%s cutoff method from deprecated protocol:%s skipped", contract.TxHash.Hex(), contract.Protocol.Hex())
+		return nil
+	}
 	contractMethod := contract.Method.(*ethaccessor.CutoffMethod)
 
-	data := hexutil.MustDecode("0x" + contract.Input[10:])
-	if err := contract.CAbi.UnpackMethodInput(&contractMethod.Cutoff, contract.Name, data); err != nil {
-		log.Errorf("extractor,tx:%s cutoff method unpack error:%s", contract.TxHash.Hex(), err.Error())
+	// 方法只有cutoff一个参数时为owner自己提交, 带owner参数时为relayer/多签代为提交
+	delegated := cutoffMethodHasOwner(contract)
+	if delegated {
+		contractMethod.Owner = types.NilAddress
+		if !unpackMethodInput(contract, contractMethod) {
+			return nil
+		}
+	} else if !unpackMethodInput(contract, &contractMethod.Cutoff) {
 		return nil
 	}
 
 	cutoff := contractMethod.ConvertDown()
 	cutoff.TxInfo = contract.TxInfo
-	cutoff.Owner = cutoff.From
-	log.Debugf("extractor,tx:%s cutoff method owner:%s, cutoff:%d, status:%d", contract.TxHash.Hex(), cutoff.Owner.Hex(), cutoff.Cutoff.Int64(), cutoff.Status)
+	if !delegated || types.IsZeroAddress(cutoff.Owner) {
+		cutoff.Owner = cutoff.From
+	}
+	log.Debugf("extractor,tx:%s cutoff method owner:%s, from:%s, cutoff:%d, status:%d", contract.TxHash.Hex(), cutoff.Owner.Hex(), cutoff.From.Hex(), cutoff.Cutoff.Int64(), cutoff.Status)
 
-	eventemitter.Emit(eventemitter.CutoffAll, cutoff)
+	processor.emitProtocolEvent(eventemitter.CutoffAll, cutoff.Protocol, cutoff)
 
 	return nil
 }
 
+func cutoffMethodHasOwner(contract MethodData) bool {
+	if contract.CAbi == nil {
+		return false
+	}
+	method, ok := contract.CAbi.Methods[contract.Name]
+	if !ok {
+		return false
+	}
+	for _, input := range method.Inputs {
+		if input.Name == "owner" && input.Type.T == abi.AddressTy {
+			return true
+		}
+	}
+	return false
+}
+
 func (processor *AbiProcessor) handleCutoffPairMethod(input eventemitter.EventData) error {
 	contract := input.(MethodData)
+	if !processor.IsActiveProtocol(contract.Protocol) {
+		log.Infof("extractor,tx:%s cutoffPair method from deprecated protocol:%s skipped", contract.TxHash.Hex(), contract.Protocol.Hex())
+		return nil
+	}
 	contractMethod := contract.Method.(*ethaccessor.CutoffPairMethod)
 
-	data := hexutil.MustDecode("0x" + contract.Input[10:])
-	if err := contract.CAbi.UnpackMethodInput(contractMethod, contract.Name, data); err != nil {
-		log.Errorf("extractor,tx:%s cutoffpair method unpack error:%s", contract.TxHash.Hex(), err.Error())
+	if !unpackMethodInput(contract, contractMethod) {
 		return nil
 	}
 
 	cutoffpair := contractMethod.ConvertDown()
 	cutoffpair.TxInfo = contract.TxInfo
 	cutoffpair.Owner = cutoffpair.From
+	cutoffpair.Token1, cutoffpair.Token2 = canonicalTokenPair(cutoffpair.Token1, cutoffpair.Token2)
 
 	log.Debugf("extractor,tx:%s cutoffpair method owenr:%s, token1:%s, token2:%s, cutoff:%d", contract.TxHash.Hex(), cutoffpair.Owner.Hex(), cutoffpair.Token1.Hex(), cutoffpair.Token2.Hex(), cutoffpair.Cutoff.Int64())
 
-	eventemitter.Emit(eventemitter.CutoffPair, cutoffpair)
+	processor.emitProtocolEvent(eventemitter.CutoffPair, cutoffpair.Protocol, cutoffpair)
 
 	return nil
 }
 
 func (processor *AbiProcessor) handleApproveMethod(input eventemitter.EventData) error {
 	contractData := input.(MethodData)
+	if processor.isSpamContract(contractData.TxHash, contractData.Protocol) {
+		return nil
+	}
 	contractMethod := contractData.Method.(*ethaccessor.ApproveMethod)
 
-	data := hexutil.MustDecode("0x" + contractData.Input[10:])
-	if err := contractData.CAbi.UnpackMethodInput(contractMethod, contractData.Name, data); err != nil {
-		log.Errorf("extractor,tx:%s approve method unpack error:%s", contractData.TxHash.Hex(), err.Error())
+	if !unpackMethodInput(contractData, contractMethod) {
 		return nil
 	}
 
@@ -582,30 +1137,121 @@ func (processor *AbiProcessor) handleApproveMethod(input eventemitter.EventData)
 	approve.Owner = contractData.From
 	approve.TxInfo = contractData.TxInfo
 
+	// 失败的approve不产生授权, 单独发出以便记录交易
+	if contractData.isFailed() {
+		log.Debugf("extractor,tx:%s approve method failed, owner:%s, spender:%s, value:%s", contractData.TxHash.Hex(), approve.Owner.Hex(), approve.Spender.Hex(), approve.Amount.String())
+		eventemitter.Emit(eventemitter.ApproveFailed, approve)
+		return nil
+	}
+
 	log.Debugf("extractor,tx:%s approve method owner:%s, spender:%s, value:%s", contractData.TxHash.Hex(), approve.Owner.Hex(), approve.Spender.Hex(), approve.Amount.String())
 
-	eventemitter.Emit(eventemitter.Approve, approve)
+	processor.emitAccountEvent(eventemitter.Approve, approve.Owner, approve.BlockTime, approve)
+
+	return nil
+}
+
+// 成功的permit会产生Approval事件, 由handleApprovalEvent发出PermitApprove; 这里只处理没有Approval日志的permit交易
+func (processor *AbiProcessor) handlePermitMethod(input eventemitter.EventData) error {
+	contractData := input.(MethodData)
+	if processor.isSpamContract(contractData.TxHash, contractData.Protocol) {
+		return nil
+	}
+	if contractData.isFailed() {
+		log.Debugf("extractor,tx:%s permit method failed, skip", contractData.TxHash.Hex())
+		return nil
+	}
+
+	processor.emitPermitApprove(contractData.TxInfo, contractData.Input)
+
+	return nil
+}
+
+// emitPermitApprove 从permit调用参数中解析deadline, 供accountManager跟踪授权过期
+func (processor *AbiProcessor) emitPermitApprove(txinfo types.TxInfo, input string) {
+	var method ethaccessor.PermitMethod
+	contract := MethodData{TxInfo: txinfo, CAbi: ethaccessor.Erc20Abi(), Name: ethaccessor.METHOD_PERMIT, Input: input}
+	if !unpackMethodInput(contract, &method) {
+		return
+	}
+
+	permit, err := method.ConvertDown()
+	if err != nil {
+		log.Debugf("extractor,tx:%s permit of owner:%s not tracked:%s", txinfo.TxHash.Hex(), method.Owner.Hex(), err.Error())
+		return
+	}
+	permit.TxInfo = txinfo
+
+	log.Debugf("extractor,tx:%s permit owner:%s, spender:%s, value:%s, deadline:%d", txinfo.TxHash.Hex(), permit.Owner.Hex(), permit.Spender.Hex(), permit.Amount.String(), permit.Deadline)
+
+	eventemitter.Emit(eventemitter.PermitApprove, permit)
+}
+
+// increaseApproval等方法只包含授权增量, 发出AllowanceChanged由下游重新获取链上授权
+func (processor *AbiProcessor) handleAllowanceChangeMethod(input eventemitter.EventData) error {
+	contractData := input.(MethodData)
+	if processor.isSpamContract(contractData.TxHash, contractData.Protocol) {
+		return nil
+	}
+	contractMethod := contractData.Method.(*ethaccessor.AllowanceChangeMethod)
+
+	if !unpackMethodInput(contractData, contractMethod) {
+		return nil
+	}
+
+	increase := contractData.Name == ethaccessor.METHOD_INCREASE_APPROVAL || contractData.Name == ethaccessor.METHOD_INCREASE_ALLOWANCE
+	change := contractMethod.ConvertDown(increase)
+	change.Owner = contractData.From
+	change.TxInfo = contractData.TxInfo
+
+	log.Debugf("extractor,tx:%s %s method owner:%s, spender:%s, delta:%s", contractData.TxHash.Hex(), contractData.Name, change.Owner.Hex(), change.Spender.Hex(), change.Delta.String())
+
+	eventemitter.Emit(eventemitter.AllowanceChanged, change)
 
 	return nil
 }
 
 func (processor *AbiProcessor) handleTransferMethod(input eventemitter.EventData) error {
 	contractData := input.(MethodData)
+	if processor.isSpamContract(contractData.TxHash, contractData.Protocol) {
+		return nil
+	}
 	contractMethod := contractData.Method.(*ethaccessor.TransferMethod)
 
-	data := hexutil.MustDecode("0x" + contractData.Input[10:])
-	if err := contractData.CAbi.UnpackMethodInput(contractMethod, contractData.Name, data); err != nil {
-		log.Errorf("extractor,tx:%s transfer method unpack error:%s", contractData.TxHash.Hex(), err.Error())
+	if !unpackMethodInput(contractData, contractMethod) {
 		return nil
 	}
 
 	transfer := contractMethod.ConvertDown()
 	transfer.Sender = contractData.From
 	transfer.TxInfo = contractData.TxInfo
+	transfer.Received = util.TransferReceivedAmount(transfer.Protocol, transfer.Amount)
 
 	log.Debugf("extractor,tx:%s transfer method sender:%s, receiver:%s, value:%s", transfer.TxHash.Hex(), transfer.Sender.Hex(), transfer.Receiver.Hex(), transfer.Amount.String())
 
-	eventemitter.Emit(eventemitter.Transfer, transfer)
+	processor.emitAccountEvent(eventemitter.Transfer, transfer.Sender, transfer.BlockTime, transfer)
+	return nil
+}
+
+// transferFrom由spender发起, 转出方为from参数而不是交易发送方
+func (processor *AbiProcessor) handleTransferFromMethod(input eventemitter.EventData) error {
+	contractData := input.(MethodData)
+	if processor.isSpamContract(contractData.TxHash, contractData.Protocol) {
+		return nil
+	}
+	contractMethod := contractData.Method.(*ethaccessor.TransferFromMethod)
+
+	if !unpackMethodInput(contractData, contractMethod) {
+		return nil
+	}
+
+	transfer := contractMethod.ConvertDown()
+	transfer.TxInfo = contractData.TxInfo
+	transfer.Received = util.TransferReceivedAmount(transfer.Protocol, transfer.Amount)
+
+	log.Debugf("extractor,tx:%s transferFrom method spender:%s, sender:%s, receiver:%s, value:%s", transfer.TxHash.Hex(), transfer.From.Hex(), transfer.Sender.Hex(), transfer.Receiver.Hex(), transfer.Amount.String())
+
+	processor.emitAccountEvent(eventemitter.Transfer, transfer.Sender, transfer.BlockTime, transfer)
 	return nil
 }
 
@@ -628,9 +1274,7 @@ func (processor *AbiProcessor) handleWethWithdrawalMethod(input eventemitter.Eve
 	contractData := input.(MethodData)
 	contractMethod := contractData.Method.(*ethaccessor.WethWithdrawalMethod)
 
-	data := hexutil.MustDecode("0x" + contractData.Input[10:])
-	if err := contractData.CAbi.UnpackMethodInput(&contractMethod.Value, contractData.Name, data); err != nil {
-		log.Errorf("extractor,tx:%s wethWithdrawal method unpack error:%s", contractData.TxHash.Hex(), err.Error())
+	if !unpackMethodInput(contractData, &contractMethod.Value) {
 		return nil
 	}
 
@@ -647,6 +1291,10 @@ func (processor *AbiProcessor) handleWethWithdrawalMethod(input eventemitter.Eve
 
 func (processor *AbiProcessor) handleRingMinedEvent(input eventemitter.EventData) error {
 	contractData := input.(EventData)
+	if !processor.IsActiveProtocol(contractData.Protocol) {
+		log.Infof("extractor,tx:%s ringMined event from deprecated protocol:%s skipped", contractData.TxHash.Hex(), contractData.Protocol.Hex())
+		return nil
+	}
 	if len(contractData.Topics) < 2 {
 		log.Errorf("extractor,tx:%s ringMined event indexed fields number error", contractData.TxHash.Hex())
 		return nil
@@ -668,15 +1316,23 @@ func (processor *AbiProcessor) handleRingMinedEvent(input eventemitter.EventData
 		return nil
 	}
 	ringmined.TxInfo = contractData.TxInfo
+	ringmined.GasCost = ringmined.Fee()
 
-	log.Debugf("extractor,tx:%s ringMined event logIndex:%d delegate:%s, ringhash:%s, ringIndex:%s",
+	log.Debugf("extractor,tx:%s ringMined event logIndex:%d delegate:%s, ringhash:%s, ringIndex:%s, gasCost:%s",
 		contractData.TxHash.Hex(),
 		ringmined.TxLogIndex,
 		ringmined.DelegateAddress.Hex(),
 		ringmined.Ringhash.Hex(),
-		ringmined.RingIndex.String())
+		ringmined.RingIndex.String(),
+		ringmined.GasCost.String())
 
-	eventemitter.Emit(eventemitter.RingMined, ringmined)
+	processor.emitProtocolEvent(eventemitter.RingMined, ringmined.Protocol, ringmined)
+	eventemitter.Emit(eventemitter.MinerRingSettledCost, &types.RingSettledCostEvent{
+		TxInfo:    ringmined.TxInfo,
+		Ringhash:  ringmined.Ringhash,
+		GasCost:   ringmined.GasCost,
+		FillCount: len(fills),
+	})
 
 	var (
 		fillList      []*types.OrderFilledEvent
@@ -707,25 +1363,53 @@ func (processor *AbiProcessor) handleRingMinedEvent(input eventemitter.EventData
 		orderhashList = append(orderhashList, fill.OrderHash.Hex())
 	}
 
-	ordermap, err := processor.db.GetOrdersByHash(orderhashList)
+	var ordermap map[string]dao.Order
+	err = processor.callWithContext(contractData.TxHash, "ringMined getOrdersByHash", func(ctx context.Context) (err error) {
+		ordermap, err = processor.getOrdersByHash(ctx, orderhashList)
+		return err
+	})
 	if err != nil {
 		log.Errorf("extractor,tx:%s ringMined event getOrdersByHash error:%s", contractData.TxHash.Hex(), err.Error())
+		// extractor停止时返回ctx错误
+		if err == processor.context().Err() {
+			return err
+		}
 		return nil
 	}
 
+	classifyFillRoles(fillList, ordermap)
+
+	var matchedFills []*types.OrderFilledEvent
 	length := len(fillList)
 	for i := 0; i < length; i++ {
 		fill := fillList[i]
 
 		ord, ok := ordermap[fill.OrderHash.Hex()]
 		if !ok {
+			// 其他relay提交的订单, 未经订单校验, 以链上原始数据发出等待回填
+			log.Debugf("extractor,tx:%s orderFilled event fillIndex:%d order:%s not found", contractData.TxHash.Hex(), fill.FillIndex.Int64(), fill.OrderHash.Hex())
+			eventemitter.Emit(eventemitter.OrderManagerUnknownFill, fill)
 			continue
 		}
 
 		fill.TokenS = common.HexToAddress(ord.TokenS)
 		fill.TokenB = common.HexToAddress(ord.TokenB)
 		fill.Owner = common.HexToAddress(ord.Owner)
-		fill.Market, _ = util.WrapMarketByAddress(fill.TokenB.Hex(), fill.TokenS.Hex())
+		if market, err := util.WrapMarketByAddress(fill.TokenB.Hex(), fill.TokenS.Hex()); err == nil {
+			fill.Market = market
+			util.CheckMarket(fill.Market, fill.TokenS, fill.TokenB, "ringMined", fill.TxHash)
+		} else if util.IsUnknownToken(err) {
+			log.Errorf("extractor,tx:%s orderFilled event fillIndex:%d order:%s %s", contractData.TxHash.Hex(), fill.FillIndex.Int64(), fill.OrderHash.Hex(), err.Error())
+		} else {
+			log.Debugf("extractor,tx:%s orderFilled event fillIndex:%d order:%s market error:%s", contractData.TxHash.Hex(), fill.FillIndex.Int64(), fill.OrderHash.Hex(), err.Error())
+		}
+
+		if slippage, ok := fillSlippage(fill, &ord); ok {
+			fill.Slippage = slippage
+		}
+		fill.FeeToken = fillFeeToken(fill)
+		fillNormalize(fill)
+		fillNetAmounts(fill)
 
 		if i == length-1 {
 			fill.SellTo = fillList[0].Owner
@@ -738,15 +1422,270 @@ func (processor *AbiProcessor) handleRingMinedEvent(input eventemitter.EventData
 			fill.BuyFrom = fillList[i-1].Owner
 		}
 
-		log.Debugf("extractor,tx:%s orderFilled event match fillIndex:%d and order:%s", contractData.TxHash.Hex(), fill.FillIndex.Int64(), ord.OrderHash)
+		log.Debugf("extractor,tx:%s orderFilled event match fillIndex:%d, role:%s and order:%s", contractData.TxHash.Hex(), fill.FillIndex.Int64(), fill.Role, ord.OrderHash)
+
+		processor.emitProtocolEvent(eventemitter.OrderFilled, fill.Protocol, fill)
+		matchedFills = append(matchedFills, fill)
 
-		eventemitter.Emit(eventemitter.OrderFilled, fill)
+		if evt, ok := fillFeeDiscrepancy(fill, &ord, processor.feeTolerance()); ok {
+			log.Debugf("extractor,tx:%s feeDiscrepancy event order:%s, expected:%s, actual:%s", contractData.TxHash.Hex(), ord.OrderHash, evt.ExpectedFee.String(), evt.ActualFee.String())
+			eventemitter.Emit(eventemitter.FeeDiscrepancy, evt)
+		}
+	}
+
+	if evt, ok := ringMidPrice(matchedFills); ok {
+		evt.TxInfo = contractData.TxInfo
+		evt.Ringhash = ringmined.Ringhash
+		log.Debugf("extractor,tx:%s ringMidPrice event market:%s, bid:%s, ask:%s, mid:%s", contractData.TxHash.Hex(), evt.Market, evt.BidPrice.FloatString(8), evt.AskPrice.FloatString(8), evt.MidPrice.FloatString(8))
+		eventemitter.Emit(eventemitter.RingMidPrice, evt)
 	}
+
 	return nil
 }
 
+// emitProtocolEvent 开启route_protocol_version时, 协议事件同时发到所属版本的topic
+func (processor *AbiProcessor) emitProtocolEvent(topic string, protocol common.Address, event eventemitter.EventData) {
+	eventemitter.Emit(topic, event)
+
+	if processor.options == nil || !processor.options.RouteProtocolVersion {
+		return
+	}
+	if version, ok := processor.protocolVersions[protocol]; ok {
+		eventemitter.Emit(eventemitter.VersionTopic(topic, version), event)
+	} else {
+		log.Debugf("extractor,protocol:%s version not found, topic:%s", protocol.Hex(), topic)
+	}
+}
+
+// emittedTopics 合约event/method id由extractor发出, 以及route_protocol_version开启时带版本的topic
+func (processor *AbiProcessor) emittedTopics() []string {
+	var topics []string
+	for id := range processor.events {
+		topics = append(topics, id.Hex())
+	}
+	for id := range processor.methods {
+		topics = append(topics, id)
+	}
+
+	if processor.options != nil && processor.options.RouteProtocolVersion {
+		for _, version := range processor.protocolVersions {
+			for _, topic := range []string{eventemitter.RingMined, eventemitter.OrderFilled, eventemitter.CancelOrder, eventemitter.CutoffAll, eventemitter.CutoffPair, eventemitter.Miner_SubmitRing_Method} {
+				topics = append(topics, eventemitter.VersionTopic(topic, version))
+			}
+		}
+	}
+	return topics
+}
+
+func (processor *AbiProcessor) feeTolerance() float64 {
+	if processor.options != nil && processor.options.FeeTolerance > 0 {
+		return processor.options.FeeTolerance
+	}
+	return defaultFeeTolerance
+}
+
+// fillSlippage 订单限价为amountB/amountS, 成交价为fill.amountB/fill.amountS, 返回成交价/限价-1
+func fillSlippage(fill *types.OrderFilledEvent, ord *dao.Order) (float64, bool) {
+	orderAmountS, ok := new(big.Int).SetString(ord.AmountS, 0)
+	if !ok || orderAmountS.Sign() <= 0 {
+		return 0, false
+	}
+	orderAmountB, ok := new(big.Int).SetString(ord.AmountB, 0)
+	if !ok || orderAmountB.Sign() <= 0 {
+		return 0, false
+	}
+	if fill.AmountS == nil || fill.AmountB == nil || fill.AmountS.Sign() <= 0 {
+		return 0, false
+	}
+
+	ratio := new(big.Rat).SetFrac(new(big.Int).Mul(fill.AmountB, orderAmountS), new(big.Int).Mul(fill.AmountS, orderAmountB))
+	ratio.Sub(ratio, big.NewRat(1, 1))
+	slippage, _ := ratio.Float64()
+	return slippage, true
+}
+
+// fillNormalize 按token精度转换成交数量, 价格为每单位base的quote数量
+func fillNormalize(fill *types.OrderFilledEvent) {
+	fill.NormalizedAmountS = normalizedAmount(fill.TokenS, fill.AmountS)
+	fill.NormalizedAmountB = normalizedAmount(fill.TokenB, fill.AmountB)
+	fill.NormalizedLrcFee = normalizedAmount(lrcTokenAddress(), fill.LrcFee)
+
+	if fill.Market == "" || fill.AmountS == nil || fill.AmountB == nil {
+		return
+	}
+	if price, err := util.CalculatePrice(fill.AmountS.String(), fill.AmountB.String(), fill.TokenS, fill.TokenB, fill.Market); err == nil {
+		fill.Price = price
+	}
+}
+
+// fillNetAmounts 分润splitB从买入token中扣除, 买入token为lrc时lrcFee也从中扣除
+func fillNetAmounts(fill *types.OrderFilledEvent) {
+	if fill.AmountB == nil {
+		return
+	}
+
+	fill.GrossAmountB = new(big.Int).Set(fill.AmountB)
+	net := new(big.Int).Set(fill.AmountB)
+	if fill.SplitB != nil {
+		net.Sub(net, fill.SplitB)
+	}
+	if fill.LrcFee != nil && fill.TokenB == lrcTokenAddress() {
+		net.Sub(net, fill.LrcFee)
+	}
+	if net.Sign() < 0 {
+		net.SetInt64(0)
+	}
+	fill.NetAmountB = net
+}
+
+// fillFeeToken 手续费token以链上成交数据为准: 矿工选择分润时为splitS/splitB对应的token, 否则为lrc
+func fillFeeToken(fill *types.OrderFilledEvent) common.Address {
+	if fill.SplitS != nil && fill.SplitS.Sign() > 0 {
+		return fill.TokenS
+	}
+	if fill.SplitB != nil && fill.SplitB.Sign() > 0 {
+		return fill.TokenB
+	}
+	return lrcTokenAddress()
+}
+
+func lrcTokenAddress() common.Address {
+	lrc, _ := util.TokenBySymbol("LRC")
+	return lrc.Protocol
+}
+
+func normalizedAmount(token common.Address, amount *big.Int) float64 {
+	if amount == nil {
+		return 0
+	}
+	t, ok := util.TokenByAddress(token)
+	if !ok || t.Decimals == nil || t.Decimals.Sign() <= 0 {
+		return 0
+	}
+	result, _ := new(big.Rat).SetFrac(amount, t.Decimals).Float64()
+	return result
+}
+
+// fillFeeDiscrepancy 矿工选择收取lrcFee时, 应收值为订单lrcFee按成交比例折算, 偏差超过tolerance时返回
+func fillFeeDiscrepancy(fill *types.OrderFilledEvent, ord *dao.Order, tolerance float64) (*types.FeeDiscrepancyEvent, bool) {
+	if fill.LrcFee == nil || fill.SplitS.Sign() > 0 || fill.SplitB.Sign() > 0 {
+		return nil, false
+	}
+
+	orderFee, ok := new(big.Int).SetString(ord.LrcFee, 0)
+	if !ok {
+		return nil, false
+	}
+	orderAmount, filled := ord.AmountS, fill.AmountS
+	if ord.BuyNoMoreThanAmountB {
+		orderAmount, filled = ord.AmountB, fill.AmountB
+	}
+	total, ok := new(big.Int).SetString(orderAmount, 0)
+	if !ok || total.Sign() <= 0 || filled == nil {
+		return nil, false
+	}
+
+	expected := new(big.Int).Mul(orderFee, filled)
+	expected.Quo(expected, total)
+
+	diff := new(big.Rat).SetInt(new(big.Int).Sub(fill.LrcFee, expected))
+	diff.Abs(diff)
+	allowed := new(big.Rat).Mul(new(big.Rat).SetInt(expected), new(big.Rat).SetFloat64(tolerance))
+	if diff.Cmp(allowed) <= 0 {
+		return nil, false
+	}
+
+	evt := &types.FeeDiscrepancyEvent{}
+	evt.TxInfo = fill.TxInfo
+	evt.Ringhash = fill.Ringhash
+	evt.OrderHash = fill.OrderHash
+	evt.Owner = fill.Owner
+	evt.ExpectedFee = expected
+	evt.ActualFee = fill.LrcFee
+	return evt, true
+}
+
+// ringMidPrice only two orders ring in the same market has bid&ask price, mid price is the average of them
+func ringMidPrice(fills []*types.OrderFilledEvent) (*types.RingMidPriceEvent, bool) {
+	if len(fills) != 2 || fills[0].Market == "" || fills[0].Market != fills[1].Market {
+		return nil, false
+	}
+
+	evt := &types.RingMidPriceEvent{Market: fills[0].Market}
+	for _, fill := range fills {
+		price, side := fillPrice(fill)
+		if price == nil {
+			return nil, false
+		}
+		if side == util.SideSell {
+			evt.AskPrice = price
+		} else {
+			evt.BidPrice = price
+		}
+	}
+	if evt.AskPrice == nil || evt.BidPrice == nil {
+		return nil, false
+	}
+
+	evt.MidPrice = new(big.Rat).Add(evt.BidPrice, evt.AskPrice)
+	evt.MidPrice.Quo(evt.MidPrice, big.NewRat(2, 1))
+
+	return evt, true
+}
+
+// fillPrice price of base token in quote token, amounts scaled by token decimals
+func fillPrice(fill *types.OrderFilledEvent) (*big.Rat, string) {
+	side := util.GetSide(fill.TokenS.Hex(), fill.TokenB.Hex())
+	amountS := tokenAmount(fill.TokenS, fill.AmountS)
+	amountB := tokenAmount(fill.TokenB, fill.AmountB)
+	if amountS.Sign() <= 0 || amountB.Sign() <= 0 {
+		return nil, side
+	}
+
+	if side == util.SideSell {
+		return new(big.Rat).Quo(amountB, amountS), side
+	}
+	return new(big.Rat).Quo(amountS, amountB), side
+}
+
+func tokenAmount(token common.Address, amount *big.Int) *big.Rat {
+	if amount == nil {
+		return new(big.Rat)
+	}
+	ret := new(big.Rat).SetInt(amount)
+	if t, err := util.AddressToToken(token); err == nil && t.Decimals != nil && t.Decimals.Sign() > 0 {
+		ret.Quo(ret, new(big.Rat).SetInt(t.Decimals))
+	}
+	return ret
+}
+
+// classifyFillRoles labels the most recently created order in the ring as taker and the others as makers.
+// if none of the orders are known, the order at ring position 0 is the taker.
+func classifyFillRoles(fills []*types.OrderFilledEvent, ordermap map[string]dao.Order) {
+	taker := 0
+	var latest int64 = -1
+	for i, fill := range fills {
+		if ord, ok := ordermap[fill.OrderHash.Hex()]; ok && ord.CreateTime > latest {
+			latest = ord.CreateTime
+			taker = i
+		}
+	}
+
+	for i, fill := range fills {
+		if i == taker {
+			fill.Role = types.FILL_ROLE_TAKER
+		} else {
+			fill.Role = types.FILL_ROLE_MAKER
+		}
+	}
+}
+
 func (processor *AbiProcessor) handleOrderCancelledEvent(input eventemitter.EventData) error {
 	contractData := input.(EventData)
+	if !processor.IsActiveProtocol(contractData.Protocol) {
+		log.Infof("extractor,tx:%s orderCancelled event from deprecated protocol:%s skipped", contractData.TxHash.Hex(), contractData.Protocol.Hex())
+		return nil
+	}
 	if len(contractData.Topics) < 2 {
 		log.Errorf("extractor,tx:%s orderCancelled event indexed fields number error", contractData.TxHash.Hex())
 		return nil
@@ -760,13 +1699,17 @@ func (processor *AbiProcessor) handleOrderCancelledEvent(input eventemitter.Even
 
 	log.Debugf("extractor,tx:%s orderCancelled event delegate:%s, orderhash:%s, cancelAmount:%s", contractData.TxHash.Hex(), evt.DelegateAddress.Hex(), evt.OrderHash.Hex(), evt.AmountCancelled.String())
 
-	eventemitter.Emit(eventemitter.CancelOrder, evt)
+	processor.emitProtocolEvent(eventemitter.CancelOrder, evt.Protocol, evt)
 
 	return nil
 }
 
 func (processor *AbiProcessor) handleCutoffEvent(input eventemitter.EventData) error {
 	contractData := input.(EventData)
+	if !processor.IsActiveProtocol(contractData.Protocol) {
+		log.Infof("extractor,tx:%s cutoffTimestampChanged event from deprecated protocol:%s skipped", contractData.TxHash.Hex(), contractData.Protocol.Hex())
+		return nil
+	}
 	if len(contractData.Topics) < 2 {
 		log.Errorf("extractor,tx:%s cutoffTimestampChanged event indexed fields number error", contractData.TxHash.Hex())
 		return nil
@@ -780,13 +1723,17 @@ func (processor *AbiProcessor) handleCutoffEvent(input eventemitter.EventData) e
 
 	log.Debugf("extractor,tx:%s cutoffTimestampChanged event delegate:%s, ownerAddress:%s, cutOffTime:%s, status:%d", contractData.TxHash.Hex(), evt.DelegateAddress.Hex(), evt.Owner.Hex(), evt.Cutoff.String(), evt.Status)
 
-	eventemitter.Emit(eventemitter.CutoffAll, evt)
+	processor.emitProtocolEvent(eventemitter.CutoffAll, evt.Protocol, evt)
 
 	return nil
 }
 
 func (processor *AbiProcessor) handleCutoffPairEvent(input eventemitter.EventData) error {
 	contractData := input.(EventData)
+	if !processor.IsActiveProtocol(contractData.Protocol) {
+		log.Infof("extractor,tx:%s cutoffPair event from deprecated protocol:%s skipped", contractData.TxHash.Hex(), contractData.Protocol.Hex())
+		return nil
+	}
 	if len(contractData.Topics) < 2 {
 		log.Errorf("extractor,tx:%s cutoffPair event indexed fields number error", contractData.TxHash.Hex())
 		return nil
@@ -797,16 +1744,28 @@ func (processor *AbiProcessor) handleCutoffPairEvent(input eventemitter.EventDat
 
 	evt := contractEvent.ConvertDown()
 	evt.TxInfo = contractData.TxInfo
+	evt.Token1, evt.Token2 = canonicalTokenPair(evt.Token1, evt.Token2)
 
 	log.Debugf("extractor,tx:%s cutoffPair event delegate:%s, ownerAddress:%s, token1:%s, token2:%s, cutOffTime:%s", contractData.TxHash.Hex(), evt.DelegateAddress.Hex(), evt.Owner.Hex(), evt.Token1.Hex(), evt.Token2.Hex(), evt.Cutoff.String())
 
-	eventemitter.Emit(eventemitter.CutoffPair, evt)
+	processor.emitProtocolEvent(eventemitter.CutoffPair, evt.Protocol, evt)
 
 	return nil
 }
 
+// 合约不保证token1/token2顺序, 同一交易对按字节序排序, 保证ordermanager只处理一个市场
+func canonicalTokenPair(token1, token2 common.Address) (common.Address, common.Address) {
+	if bytes.Compare(token1.Bytes(), token2.Bytes()) > 0 {
+		return token2, token1
+	}
+	return token1, token2
+}
+
 func (processor *AbiProcessor) handleTransferEvent(input eventemitter.EventData) error {
 	contractData := input.(EventData)
+	if processor.isSpamContract(contractData.TxHash, contractData.Protocol) {
+		return nil
+	}
 
 	if len(contractData.Topics) < 3 {
 		log.Errorf("extractor,tx:%s tokenTransfer event indexed fields number error", contractData.TxHash.Hex())
@@ -819,16 +1778,130 @@ func (processor *AbiProcessor) handleTransferEvent(input eventemitter.EventData)
 
 	transfer := contractEvent.ConvertDown()
 	transfer.TxInfo = contractData.TxInfo
+	transfer.Mint = transfer.Sender == types.NilAddress && transfer.Receiver != types.NilAddress
+	transfer.Burn = transfer.Receiver == types.NilAddress && transfer.Sender != types.NilAddress
+
+	processor.resolveUnknownToken(transfer.Protocol, transfer.BlockNumber)
+	transfer.Received = util.TransferReceivedAmount(transfer.Protocol, transfer.Amount)
 
 	log.Debugf("extractor,tx:%s tokenTransfer event, methodName:%s, logIndex:%d, from:%s, to:%s, value:%s", contractData.TxHash.Hex(), transfer.Identify, transfer.TxLogIndex, transfer.Sender.Hex(), transfer.Receiver.Hex(), transfer.Amount.String())
 
-	eventemitter.Emit(eventemitter.Transfer, transfer)
+	if processor.isContractTransfer(transfer) {
+		eventemitter.Emit(eventemitter.ContractTransfer, transfer)
+	} else {
+		// 增发的sender都是零地址, 按receiver限流
+		owner := transfer.Sender
+		if transfer.Mint {
+			owner = transfer.Receiver
+		}
+		processor.emitAccountEvent(eventemitter.Transfer, owner, transfer.BlockTime, transfer)
+	}
+
+	if transfer.Mint || transfer.Burn {
+		emitSupplyChanged(transfer)
+	}
 
 	return nil
 }
 
+// emitSupplyChanged 增发时供应量增加transfer数量, 销毁时减少
+func emitSupplyChanged(transfer *types.TransferEvent) {
+	supply := &types.TokenSupplyChangedEvent{TxInfo: transfer.TxInfo, Token: transfer.Protocol, Mint: transfer.Mint}
+	if transfer.Mint {
+		supply.Account = transfer.Receiver
+		supply.Delta = new(big.Int).Set(transfer.Amount)
+	} else {
+		supply.Account = transfer.Sender
+		supply.Delta = new(big.Int).Neg(transfer.Amount)
+	}
+
+	log.Debugf("extractor,tx:%s token:%s supply changed, account:%s, mint:%t, delta:%s", transfer.TxHash.Hex(), transfer.Protocol.Hex(), supply.Account.Hex(), supply.Mint, supply.Delta.String())
+	eventemitter.Emit(eventemitter.TokenSupply, supply)
+}
+
+// isContractTransfer 转出和转入地址都是合约时, 一般是协议内部资金流转而不是用户行为
+func (processor *AbiProcessor) isContractTransfer(transfer *types.TransferEvent) bool {
+	if processor.options == nil || !processor.options.RouteContractTransfers {
+		return false
+	}
+	return processor.isContract(transfer.Sender) && processor.isContract(transfer.Receiver)
+}
+
+func (processor *AbiProcessor) isContract(address common.Address) bool {
+	if ok, exists := processor.contractCodes.get(address); exists {
+		return ok
+	}
+
+	var ok bool
+	err := processor.callWithContext(types.NilHash, "getCode", func(ctx context.Context) (err error) {
+		ok, err = processor.hasCode(ctx, address)
+		return err
+	})
+	if err != nil {
+		log.Errorf("extractor,get code of %s error:%s", address.Hex(), err.Error())
+		return false
+	}
+	processor.contractCodes.add(address, ok)
+	return ok
+}
+
+func hasCode(ctx context.Context, address common.Address) (bool, error) {
+	var code string
+	if err := ethaccessor.GetCodeContext(ctx, &code, address, "latest"); err != nil {
+		return false, err
+	}
+	return code != "" && code != "0x", nil
+}
+
+// resolveUnknownToken query symbol&decimals for token contract which not exist in token list,
+// and register it as unverified token if it looks like erc20. only the first transfer of the contract will be checked.
+func (processor *AbiProcessor) resolveUnknownToken(protocol common.Address, blockNumber *big.Int) {
+	if _, err := util.AddressToToken(protocol); err == nil {
+		return
+	}
+	if _, ok := processor.unknownTokens[protocol]; ok {
+		return
+	}
+	processor.unknownTokens[protocol] = true
+
+	blockParameter := "latest"
+	if blockNumber != nil {
+		blockParameter = types.BigintToHex(blockNumber)
+	}
+
+	var symbol string
+	err := processor.callWithContext(types.NilHash, "erc20Symbol", func(ctx context.Context) (err error) {
+		symbol, err = processor.erc20Symbol(ctx, protocol, blockParameter)
+		return err
+	})
+	if err != nil || symbol == "" {
+		log.Debugf("extractor,contract %s is not erc20 token, get symbol failed", protocol.Hex())
+		return
+	}
+	var decimals uint8
+	err = processor.callWithContext(types.NilHash, "erc20Decimals", func(ctx context.Context) (err error) {
+		decimals, err = processor.erc20Decimals(ctx, protocol, blockParameter)
+		return err
+	})
+	if err != nil {
+		log.Debugf("extractor,contract %s is not erc20 token, get decimals failed", protocol.Hex())
+		return
+	}
+
+	token, err := util.AddUnverifiedToken(protocol, symbol, decimals)
+	if err != nil {
+		log.Errorf("extractor,register unverified token:%s error:%s", protocol.Hex(), err.Error())
+		return
+	}
+
+	log.Infof("extractor,register unverified token %s->%s, decimals:%d", token.Symbol, token.Protocol.Hex(), decimals)
+}
+
 func (processor *AbiProcessor) handleApprovalEvent(input eventemitter.EventData) error {
 	contractData := input.(EventData)
+	if processor.isSpamContract(contractData.TxHash, contractData.Protocol) {
+		return nil
+	}
 	if len(contractData.Topics) < 3 {
 		log.Errorf("extractor,tx:%s approval event indexed fields number error", contractData.TxHash.Hex())
 		return nil
@@ -843,7 +1916,16 @@ func (processor *AbiProcessor) handleApprovalEvent(input eventemitter.EventData)
 
 	log.Debugf("extractor,tx:%s approval event owner:%s, spender:%s, value:%s", contractData.TxHash.Hex(), approve.Owner.Hex(), approve.Spender.Hex(), approve.Amount.String())
 
-	eventemitter.Emit(eventemitter.Approve, approve)
+	if processor.approvals.unchanged(approve) {
+		log.Debugf("extractor,tx:%s approval event allowance unchanged, skipped", contractData.TxHash.Hex())
+		return nil
+	}
+	processor.emitAccountEvent(eventemitter.Approve, approve.Owner, approve.BlockTime, approve)
+
+	// Approve会清除之前的permit跟踪, 需在其后发出
+	if contractData.Identify == ethaccessor.METHOD_PERMIT {
+		processor.emitPermitApprove(contractData.TxInfo, contractData.Input)
+	}
 
 	return nil
 }
@@ -857,6 +1939,9 @@ func (processor *AbiProcessor) handleTokenRegisteredEvent(input eventemitter.Eve
 
 	log.Debugf("extractor,tx:%s tokenRegistered event address:%s, symbol:%s", contractData.TxHash.Hex(), evt.Token.Hex(), evt.Symbol)
 
+	if evt.Status == types.TX_STATUS_SUCCESS {
+		processor.loadTokenAddress(evt.Token, strings.ToUpper(evt.Symbol))
+	}
 	eventemitter.Emit(eventemitter.TokenRegistered, evt)
 
 	return nil
@@ -871,6 +1956,9 @@ func (processor *AbiProcessor) handleTokenUnRegisteredEvent(input eventemitter.E
 
 	log.Debugf("extractor,tx:%s tokenUnregistered event address:%s, symbol:%s", contractData.TxHash.Hex(), evt.Token.Hex(), evt.Symbol)
 
+	if evt.Status == types.TX_STATUS_SUCCESS {
+		processor.unloadTokenAddress(evt.Token, strings.ToUpper(evt.Symbol))
+	}
 	eventemitter.Emit(eventemitter.TokenUnRegistered, evt)
 
 	return nil
@@ -891,6 +1979,9 @@ func (processor *AbiProcessor) handleAddressAuthorizedEvent(input eventemitter.E
 
 	log.Debugf("extractor,tx:%s addressAuthorized event address:%s, number:%d", contractData.TxHash.Hex(), evt.Protocol.Hex(), evt.Number)
 
+	if evt.Status == types.TX_STATUS_SUCCESS {
+		processor.loadDelegate(contractData.Protocol, evt.Protocol)
+	}
 	eventemitter.Emit(eventemitter.AddressAuthorized, evt)
 
 	return nil
@@ -911,7 +2002,10 @@ func (processor *AbiProcessor) handleAddressDeAuthorizedEvent(input eventemitter
 
 	log.Debugf("extractor,tx:%s addressDeAuthorized event address:%s, number:%d", contractData.TxHash.Hex(), evt.Protocol.Hex(), evt.Number)
 
-	eventemitter.Emit(eventemitter.AddressAuthorized, evt)
+	if evt.Status == types.TX_STATUS_SUCCESS {
+		processor.unloadDelegate(contractData.Protocol, evt.Protocol)
+	}
+	eventemitter.Emit(eventemitter.AddressDeAuthorized, evt)
 
 	return nil
 }
@@ -956,6 +2050,12 @@ func (processor *AbiProcessor) handleWethWithdrawalEvent(input eventemitter.Even
 }
 
 func (processor *AbiProcessor) handleEthTransfer(tx *ethaccessor.Transaction, receipt *ethaccessor.TransactionReceipt, time *big.Int) error {
+	// 创建合约的交易没有to, 不是转账
+	if tx.To == "" || tx.To == "0x" {
+		log.Debugf("extractor,tx:%s contract creation, skip eth transfer", tx.Hash)
+		return nil
+	}
+
 	var dst types.TransferEvent
 
 	dst.From = common.HexToAddress(tx.From)
@@ -968,20 +2068,39 @@ func (processor *AbiProcessor) handleEthTransfer(tx *ethaccessor.Transaction, re
 	dst.BlockTime = time.Int64()
 
 	dst.GasLimit = tx.Gas.BigInt()
-	dst.GasPrice = tx.GasPrice.BigInt()
+	setGasPrice(&dst.TxInfo, tx, receipt)
 	dst.Nonce = tx.Nonce.BigInt()
 
 	dst.Sender = common.HexToAddress(tx.From)
 	dst.Receiver = common.HexToAddress(tx.To)
+	dst.SelfTransfer = dst.Sender == dst.Receiver
 	dst.GasUsed, dst.Status = processor.getGasAndStatus(tx, receipt)
+	dst.Replay = processor.isReplay(dst.TxHash)
 
 	log.Debugf("extractor,tx:%s handleEthTransfer from:%s, to:%s, value:%s, gasUsed:%s, status:%d", tx.Hash, tx.From, tx.To, tx.Value.BigInt().String(), dst.GasUsed.String(), dst.Status)
 
-	eventemitter.Emit(eventemitter.EthTransferEvent, &dst)
+	processor.emitAccountEvent(eventemitter.EthTransferEvent, dst.Sender, dst.BlockTime, &dst)
 
 	return nil
 }
 
+func (processor *AbiProcessor) handleTransactionCompleted(tx *ethaccessor.Transaction, receipt *ethaccessor.TransactionReceipt, time *big.Int) {
+	var dst types.TransactionCompletedEvent
+
+	dst.From = common.HexToAddress(tx.From)
+	dst.To = common.HexToAddress(tx.To)
+	dst.TxHash = common.HexToHash(tx.Hash)
+	dst.BlockNumber = tx.BlockNumber.BigInt()
+	dst.BlockTime = time.Int64()
+	dst.GasLimit = tx.Gas.BigInt()
+	setGasPrice(&dst.TxInfo, tx, receipt)
+	dst.Nonce = tx.Nonce.BigInt()
+	dst.GasUsed, dst.Status = processor.getGasAndStatus(tx, receipt)
+	dst.Replay = processor.isReplay(dst.TxHash)
+
+	eventemitter.Emit(eventemitter.TransactionCompleted, &dst)
+}
+
 func (processor *AbiProcessor) getGasAndStatus(tx *ethaccessor.Transaction, receipt *ethaccessor.TransactionReceipt) (*big.Int, types.TxStatus) {
 	var (
 		gasUsed *big.Int
@@ -0,0 +1,2099 @@
+/*
+
+  Copyright 2017 Loopring Project Ltd (Loopring Foundation).
+
+  Licensed under the Apache License, Version 2.0 (the "License");
+  you may not use this file except in compliance with the License.
+  You may obtain a copy of the License at
+
+  http://www.apache.org/licenses/LICENSE-2.0
+
+  Unless required by applicable law or agreed to in writing, software
+  distributed under the License is distributed on an "AS IS" BASIS,
+  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+  See the License for the specific language governing permissions and
+  limitations under the License.
+
+*/
+
+package extractor
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/Loopring/relay/config"
+	"github.com/Loopring/relay/crypto"
+	"github.com/Loopring/relay/dao"
+	"github.com/Loopring/relay/ethaccessor"
+	"github.com/Loopring/relay/eventemiter"
+	"github.com/Loopring/relay/log"
+	"github.com/Loopring/relay/market/util"
+	"github.com/Loopring/relay/types"
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"go.uber.org/zap"
+	"math/big"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func init() {
+	zapOpts := zap.NewDevelopmentConfig()
+	zapOpts.Level = zap.NewAtomicLevelAt(zap.ErrorLevel)
+	log.Initialize(config.LogOptions{ZapOpts: zapOpts})
+}
+
+func protocolImplAbi(t *testing.T) *abi.ABI {
+	cfg := config.LoadConfig("../config/relay.toml")
+	implAbi, err := ethaccessor.NewAbi(cfg.Common.ProtocolImpl.ImplAbi)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return implAbi
+}
+
+// mockRdsService only implements the dao methods used by abi processor handlers
+type mockRdsService struct {
+	dao.RdsService
+	orders map[string]dao.Order
+}
+
+func (s *mockRdsService) GetOrdersByHashContext(ctx context.Context, orderhashs []string) (map[string]dao.Order, error) {
+	ret := make(map[string]dao.Order)
+	for _, v := range orderhashs {
+		if ord, ok := s.orders[v]; ok {
+			ret[v] = ord
+		}
+	}
+	return ret, nil
+}
+
+func bytes32(data []byte) [32]uint8 {
+	var ret [32]uint8
+	copy(ret[32-len(data):], data)
+	return ret
+}
+
+// ringMinedEventData builds a ringMined event data whose orderInfoList contains 7 fields per order
+func ringMinedEventData(orders []dao.Order) EventData {
+	ringhash := common.HexToHash("0x1234")
+	evt := &ethaccessor.RingMinedEvent{RingIndex: big.NewInt(1), RingHash: ringhash}
+	for _, ord := range orders {
+		amountS := big.NewInt(100)
+		if ord.AmountS != "" {
+			amountS.SetString(ord.AmountS, 0)
+		}
+		evt.OrderInfoList = append(evt.OrderInfoList,
+			bytes32(common.HexToHash(ord.OrderHash).Bytes()),
+			bytes32(common.HexToAddress(ord.Owner).Bytes()),
+			bytes32(common.HexToAddress(ord.TokenS).Bytes()),
+			bytes32(amountS.Bytes()),
+			bytes32(big.NewInt(0).Bytes()),
+			bytes32(big.NewInt(1).Bytes()),
+			bytes32(big.NewInt(1).Bytes()),
+		)
+	}
+
+	var data EventData
+	data.TxHash = common.HexToHash("0xabcd")
+	data.BlockNumber = big.NewInt(100)
+	data.Status = types.TX_STATUS_SUCCESS
+	data.Event = evt
+	data.Topics = []string{"", ringhash.Hex()}
+	return data
+}
+
+func collectFills(t *testing.T, fn func()) []*types.OrderFilledEvent {
+	var fills []*types.OrderFilledEvent
+	watcher := &eventemitter.Watcher{Concurrent: false, Handle: func(input eventemitter.EventData) error {
+		fills = append(fills, input.(*types.OrderFilledEvent))
+		return nil
+	}}
+	eventemitter.On(eventemitter.OrderFilled, watcher)
+	defer eventemitter.Un(eventemitter.OrderFilled, watcher)
+
+	fn()
+	return fills
+}
+
+func TestAbiProcessor_HandleRingMinedEventFillRole(t *testing.T) {
+	maker := dao.Order{
+		OrderHash:  common.HexToHash("0x01").Hex(),
+		Owner:      "0x1b978a1D302335a6F2Ebe4B8823B5E17c3C84135",
+		TokenS:     "0xEF68e7C694F40c8202821eDF525dE3782458639f",
+		TokenB:     "0xC02aaA39b223FE8D0A0e5C4F27eAD9083C756Cc2",
+		CreateTime: 1000,
+	}
+	taker := dao.Order{
+		OrderHash:  common.HexToHash("0x02").Hex(),
+		Owner:      "0xb1018949b241D76A1AB2094f473E9bEfeAbB5Ead",
+		TokenS:     "0xC02aaA39b223FE8D0A0e5C4F27eAD9083C756Cc2",
+		TokenB:     "0xEF68e7C694F40c8202821eDF525dE3782458639f",
+		CreateTime: 2000,
+	}
+
+	processor := &AbiProcessor{db: &mockRdsService{orders: map[string]dao.Order{
+		maker.OrderHash: maker,
+		taker.OrderHash: taker,
+	}}}
+
+	fills := collectFills(t, func() {
+		processor.handleRingMinedEvent(ringMinedEventData([]dao.Order{maker, taker}))
+	})
+	if len(fills) != 2 {
+		t.Fatalf("expect 2 fills, got %d", len(fills))
+	}
+
+	for _, fill := range fills {
+		switch fill.OrderHash.Hex() {
+		case maker.OrderHash:
+			if fill.Role != types.FILL_ROLE_MAKER {
+				t.Errorf("order %s expect role maker, got %s", fill.OrderHash.Hex(), fill.Role)
+			}
+		case taker.OrderHash:
+			if fill.Role != types.FILL_ROLE_TAKER {
+				t.Errorf("order %s expect role taker, got %s", fill.OrderHash.Hex(), fill.Role)
+			}
+		default:
+			t.Errorf("unexpected fill %s", fill.OrderHash.Hex())
+		}
+	}
+}
+
+func setupMarketTokens() (lrc, weth types.Token) {
+	decimals, _ := new(big.Int).SetString("1000000000000000000", 0)
+	lrc = types.Token{Protocol: common.HexToAddress("0xEF68e7C694F40c8202821eDF525dE3782458639f"), Symbol: "LRC", Decimals: decimals}
+	weth = types.Token{Protocol: common.HexToAddress("0xC02aaA39b223FE8D0A0e5C4F27eAD9083C756Cc2"), Symbol: "WETH", Decimals: decimals, IsMarket: true}
+
+	util.SetTokens(map[string]types.Token{"LRC": lrc}, map[string]types.Token{"WETH": weth})
+	return
+}
+
+func TestAbiProcessor_HandleRingMinedEventMidPrice(t *testing.T) {
+	lrc, weth := setupMarketTokens()
+
+	seller := dao.Order{
+		OrderHash: common.HexToHash("0x01").Hex(),
+		Owner:     "0x1b978a1D302335a6F2Ebe4B8823B5E17c3C84135",
+		TokenS:    lrc.Protocol.Hex(),
+		TokenB:    weth.Protocol.Hex(),
+		AmountS:   "1000000000000000000000",
+	}
+	buyer := dao.Order{
+		OrderHash: common.HexToHash("0x02").Hex(),
+		Owner:     "0xb1018949b241D76A1AB2094f473E9bEfeAbB5Ead",
+		TokenS:    weth.Protocol.Hex(),
+		TokenB:    lrc.Protocol.Hex(),
+		AmountS:   "2000000000000000000",
+	}
+	processor := &AbiProcessor{db: &mockRdsService{orders: map[string]dao.Order{
+		seller.OrderHash: seller,
+		buyer.OrderHash:  buyer,
+	}}}
+
+	var evts []*types.RingMidPriceEvent
+	watcher := &eventemitter.Watcher{Concurrent: false, Handle: func(input eventemitter.EventData) error {
+		evts = append(evts, input.(*types.RingMidPriceEvent))
+		return nil
+	}}
+	eventemitter.On(eventemitter.RingMidPrice, watcher)
+	defer eventemitter.Un(eventemitter.RingMidPrice, watcher)
+
+	fills := collectFills(t, func() {
+		processor.handleRingMinedEvent(ringMinedEventData([]dao.Order{seller, buyer}))
+	})
+	if len(evts) != 1 {
+		t.Fatalf("expect 1 ringMidPrice event, got %d", len(evts))
+	}
+
+	evt := evts[0]
+	if evt.Market != "LRC-WETH" {
+		t.Errorf("expect market LRC-WETH, got %s", evt.Market)
+	}
+
+	legs := new(big.Rat)
+	for _, fill := range fills {
+		price, _ := fillPrice(fill)
+		legs.Add(legs, price)
+	}
+	average := legs.Quo(legs, big.NewRat(2, 1))
+	if evt.MidPrice.Cmp(average) != 0 {
+		t.Errorf("expect mid price %s, got %s", average.FloatString(8), evt.MidPrice.FloatString(8))
+	}
+	if evt.AskPrice.Cmp(big.NewRat(2, 1000)) != 0 || evt.BidPrice.Cmp(big.NewRat(2, 1000)) != 0 {
+		t.Errorf("expect bid&ask price 0.002, got bid:%s ask:%s", evt.BidPrice.FloatString(8), evt.AskPrice.FloatString(8))
+	}
+}
+
+func TestAbiProcessor_HandleTransferEventUnknownToken(t *testing.T) {
+	util.SetTokens(map[string]types.Token{}, map[string]types.Token{})
+
+	token := common.HexToAddress("0x8b0f7dad5a9a64c895fe54612b6949286d55f37c")
+	queried := 0
+	processor := &AbiProcessor{unknownTokens: make(map[common.Address]bool)}
+	processor.erc20Symbol = func(ctx context.Context, tokenAddress common.Address, blockParameter string) (string, error) {
+		queried++
+		return "foo", nil
+	}
+	processor.erc20Decimals = func(ctx context.Context, tokenAddress common.Address, blockParameter string) (uint8, error) {
+		return 6, nil
+	}
+
+	var data EventData
+	data.Protocol = token
+	data.BlockNumber = big.NewInt(100)
+	data.Event = &ethaccessor.TransferEvent{Value: big.NewInt(1000)}
+	data.Topics = []string{"", common.HexToHash("0x01").Hex(), common.HexToHash("0x02").Hex()}
+
+	processor.handleTransferEvent(data)
+	processor.handleTransferEvent(data)
+
+	registered, err := util.AddressToToken(token)
+	if err != nil {
+		t.Fatalf("unknown erc20 token should be registered tentatively")
+	}
+	if !registered.Unverified {
+		t.Errorf("token should be flagged unverified")
+	}
+	if registered.Symbol != "FOO" {
+		t.Errorf("expect symbol FOO, got %s", registered.Symbol)
+	}
+	if registered.Decimals.Cmp(big.NewInt(1000000)) != 0 {
+		t.Errorf("expect decimals 1e6, got %s", registered.Decimals.String())
+	}
+	if queried != 1 {
+		t.Errorf("token metadata should be queried only once, got %d", queried)
+	}
+}
+
+func TestAbiProcessor_HandleCancelOrderCanonical(t *testing.T) {
+	implAbi := protocolImplAbi(t)
+
+	addresses := [5]common.Address{
+		common.HexToAddress("0x1b978a1D302335a6F2Ebe4B8823B5E17c3C84135"),
+		common.HexToAddress("0xEF68e7C694F40c8202821eDF525dE3782458639f"),
+		common.HexToAddress("0xC02aaA39b223FE8D0A0e5C4F27eAD9083C756Cc2"),
+		common.HexToAddress("0xb1018949b241D76A1AB2094f473E9bEfeAbB5Ead"),
+		common.HexToAddress("0xb1018949b241D76A1AB2094f473E9bEfeAbB5Ead"),
+	}
+	values := [6]*big.Int{big.NewInt(1000), big.NewInt(10), big.NewInt(1), big.NewInt(2), big.NewInt(5), big.NewInt(1000)}
+	input, err := implAbi.Pack(ethaccessor.METHOD_CANCEL_ORDER, addresses, values, false, uint8(50), uint8(27), [32]byte{}, [32]byte{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	processor := &AbiProcessor{}
+
+	var cancels []*types.OrderCancelledEvent
+	watcher := &eventemitter.Watcher{Concurrent: false, Handle: func(input eventemitter.EventData) error {
+		cancels = append(cancels, input.(*types.OrderCancelledEvent))
+		return nil
+	}}
+	eventemitter.On(eventemitter.CancelOrder, watcher)
+	defer eventemitter.Un(eventemitter.CancelOrder, watcher)
+
+	// pending cancelOrder method
+	cancelMethod := implAbi.Methods[ethaccessor.METHOD_CANCEL_ORDER]
+	method := newMethodData(&cancelMethod, implAbi)
+	method.Method = &ethaccessor.CancelOrderMethod{}
+	method.Input = common.ToHex(input)
+	method.TxHash = common.HexToHash("0xabcd")
+	method.DelegateAddress = common.HexToAddress("0x17233e07c67d086464fD408148c3ABB56245FA64")
+	method.Status = types.TX_STATUS_PENDING
+	processor.handleCancelOrderMethod(method)
+
+	if len(cancels) != 1 || cancels[0].Status != types.TX_STATUS_PENDING {
+		t.Fatalf("pending cancel method should emit one provisional cancel, got %d cancels", len(cancels))
+	}
+
+	// mined orderCancelled event of the same tx
+	orderhash := cancels[0].OrderHash
+	cancelledEvent := implAbi.Events[ethaccessor.EVENT_ORDER_CANCELLED]
+	event := newEventData(&cancelledEvent, implAbi)
+	event.Event = &ethaccessor.OrderCancelledEvent{AmountCancelled: big.NewInt(1000)}
+	event.TxHash = method.TxHash
+	event.Status = types.TX_STATUS_SUCCESS
+	event.Topics = []string{event.Id.Hex(), orderhash.Hex()}
+	processor.handleOrderCancelledEvent(event)
+
+	var canonical []*types.OrderCancelledEvent
+	for _, v := range cancels {
+		if v.Status == types.TX_STATUS_SUCCESS {
+			canonical = append(canonical, v)
+		}
+	}
+	if len(canonical) != 1 {
+		t.Fatalf("expect one canonical cancel, got %d", len(canonical))
+	}
+	if canonical[0].TxHash != method.TxHash || canonical[0].OrderHash != orderhash || canonical[0].AmountCancelled.Int64() != 1000 {
+		t.Errorf("canonical cancel mismatch, orderhash:%s amount:%s", canonical[0].OrderHash.Hex(), canonical[0].AmountCancelled.String())
+	}
+}
+
+func TestAbiProcessor_HandleTransferEventFeeOnTransfer(t *testing.T) {
+	decimals, _ := new(big.Int).SetString("1000000000000000000", 0)
+	fee := types.Token{
+		Protocol:        common.HexToAddress("0x419D0d8BdD9aF5e606Ae2232ed285Aff190E711b"),
+		Symbol:          "FEE",
+		Decimals:        decimals,
+		FeeOnTransfer:   true,
+		TransferFeeRate: big.NewRat(2, 100),
+	}
+	util.SetTokens(map[string]types.Token{"FEE": fee}, map[string]types.Token{})
+
+	var transfers []*types.TransferEvent
+	watcher := &eventemitter.Watcher{Concurrent: false, Handle: func(input eventemitter.EventData) error {
+		transfers = append(transfers, input.(*types.TransferEvent))
+		return nil
+	}}
+	eventemitter.On(eventemitter.Transfer, watcher)
+	defer eventemitter.Un(eventemitter.Transfer, watcher)
+
+	processor := &AbiProcessor{unknownTokens: make(map[common.Address]bool)}
+
+	var data EventData
+	data.Protocol = fee.Protocol
+	data.Event = &ethaccessor.TransferEvent{Value: big.NewInt(1000)}
+	data.Topics = []string{"", common.HexToHash("0x01").Hex(), common.HexToHash("0x02").Hex()}
+	processor.handleTransferEvent(data)
+
+	if len(transfers) != 1 {
+		t.Fatalf("expect 1 transfer, got %d", len(transfers))
+	}
+	if transfers[0].Amount.Int64() != 1000 {
+		t.Errorf("logged amount should be kept, got %s", transfers[0].Amount.String())
+	}
+	if transfers[0].Received.Int64() != 980 {
+		t.Errorf("expect received amount 980, got %s", transfers[0].Received.String())
+	}
+}
+
+func TestAbiProcessor_HandleTransferEventMintAndBurn(t *testing.T) {
+	lrc, _ := setupMarketTokens()
+
+	var transfers []*types.TransferEvent
+	watcher := &eventemitter.Watcher{Concurrent: false, Handle: func(input eventemitter.EventData) error {
+		transfers = append(transfers, input.(*types.TransferEvent))
+		return nil
+	}}
+	eventemitter.On(eventemitter.Transfer, watcher)
+	defer eventemitter.Un(eventemitter.Transfer, watcher)
+
+	var supplies []*types.TokenSupplyChangedEvent
+	supplyWatcher := &eventemitter.Watcher{Concurrent: false, Handle: func(input eventemitter.EventData) error {
+		supplies = append(supplies, input.(*types.TokenSupplyChangedEvent))
+		return nil
+	}}
+	eventemitter.On(eventemitter.TokenSupply, supplyWatcher)
+	defer eventemitter.Un(eventemitter.TokenSupply, supplyWatcher)
+
+	processor := &AbiProcessor{unknownTokens: make(map[common.Address]bool)}
+	account := common.HexToAddress("0x1b978a1D302335a6F2Ebe4B8823B5E17c3C84135")
+	transfer := func(from, to common.Address, amount int64) {
+		var data EventData
+		data.Protocol = lrc.Protocol
+		data.Event = &ethaccessor.TransferEvent{Value: big.NewInt(amount)}
+		data.Topics = []string{"", common.BytesToHash(from.Bytes()).Hex(), common.BytesToHash(to.Bytes()).Hex()}
+		processor.handleTransferEvent(data)
+	}
+
+	transfer(types.NilAddress, account, 500)
+	transfer(account, types.NilAddress, 200)
+	transfer(account, common.HexToAddress("0xb1018949b241D76A1AB2094f473E9bEfeAbB5Ead"), 100)
+
+	if len(transfers) != 3 {
+		t.Fatalf("expect 3 transfers, got %d", len(transfers))
+	}
+	if !transfers[0].Mint || transfers[0].Burn {
+		t.Errorf("transfer from zero address should be classified as mint")
+	}
+	if transfers[1].Mint || !transfers[1].Burn {
+		t.Errorf("transfer to zero address should be classified as burn")
+	}
+	if transfers[2].Mint || transfers[2].Burn {
+		t.Errorf("normal transfer should not be classified as mint or burn")
+	}
+
+	if len(supplies) != 2 {
+		t.Fatalf("expect 2 supply changes, got %d", len(supplies))
+	}
+	if !supplies[0].Mint || supplies[0].Account != account || supplies[0].Token != lrc.Protocol || supplies[0].Delta.Int64() != 500 {
+		t.Errorf("unexpected mint supply change, mint:%t account:%s delta:%s", supplies[0].Mint, supplies[0].Account.Hex(), supplies[0].Delta.String())
+	}
+	if supplies[1].Mint || supplies[1].Account != account || supplies[1].Delta.Int64() != -200 {
+		t.Errorf("unexpected burn supply change, mint:%t account:%s delta:%s", supplies[1].Mint, supplies[1].Account.Hex(), supplies[1].Delta.String())
+	}
+}
+
+func TestAbiProcessor_HandleTransferEventContractToContract(t *testing.T) {
+	lrc := types.Token{Protocol: common.HexToAddress("0xEF68e7C694F40c8202821eDF525dE3782458639f"), Symbol: "LRC", Decimals: big.NewInt(1e18)}
+	util.SetTokens(map[string]types.Token{"LRC": lrc}, map[string]types.Token{})
+
+	var (
+		delegate = common.HexToAddress("0xC533531f4f291F036513f7Abd23bfc7f4D8aC780")
+		exchange = common.HexToAddress("0x781870080C8C24a2FD6882296c49c837b06A65E6")
+		user     = common.HexToAddress("0x1b978a1D302335a6F2Ebe4B8823B5E17c3C84135")
+	)
+
+	var accountTransfers, contractTransfers []*types.TransferEvent
+	accountWatcher := &eventemitter.Watcher{Concurrent: false, Handle: func(input eventemitter.EventData) error {
+		accountTransfers = append(accountTransfers, input.(*types.TransferEvent))
+		return nil
+	}}
+	contractWatcher := &eventemitter.Watcher{Concurrent: false, Handle: func(input eventemitter.EventData) error {
+		contractTransfers = append(contractTransfers, input.(*types.TransferEvent))
+		return nil
+	}}
+	eventemitter.On(eventemitter.Transfer, accountWatcher)
+	defer eventemitter.Un(eventemitter.Transfer, accountWatcher)
+	eventemitter.On(eventemitter.ContractTransfer, contractWatcher)
+	defer eventemitter.Un(eventemitter.ContractTransfer, contractWatcher)
+
+	queried := 0
+	processor := &AbiProcessor{
+		options:       &config.ExtractorOptions{RouteContractTransfers: true},
+		unknownTokens: make(map[common.Address]bool),
+		contractCodes: newContractCodeCache(0),
+		hasCode: func(ctx context.Context, address common.Address) (bool, error) {
+			queried++
+			return address == delegate || address == exchange, nil
+		},
+	}
+
+	transfer := func(from, to common.Address) EventData {
+		var data EventData
+		data.Protocol = lrc.Protocol
+		data.Event = &ethaccessor.TransferEvent{Value: big.NewInt(1000)}
+		data.Topics = []string{"", common.BytesToHash(from.Bytes()).Hex(), common.BytesToHash(to.Bytes()).Hex()}
+		return data
+	}
+
+	processor.handleTransferEvent(transfer(delegate, exchange))
+	processor.handleTransferEvent(transfer(delegate, exchange))
+	processor.handleTransferEvent(transfer(user, exchange))
+
+	if len(contractTransfers) != 2 {
+		t.Fatalf("contract to contract transfers should be routed to ContractTransfer, got %d", len(contractTransfers))
+	}
+	if contractTransfers[0].Sender != delegate || contractTransfers[0].Receiver != exchange {
+		t.Errorf("unexpected contract transfer %s -> %s", contractTransfers[0].Sender.Hex(), contractTransfers[0].Receiver.Hex())
+	}
+	if len(accountTransfers) != 1 || accountTransfers[0].Sender != user {
+		t.Fatalf("transfer from account should stay on Transfer, got %d", len(accountTransfers))
+	}
+	if queried != 3 {
+		t.Errorf("code query should be cached per address, got %d queries", queried)
+	}
+
+	// 未开启时不查询code
+	processor.options.RouteContractTransfers = false
+	processor.handleTransferEvent(transfer(delegate, exchange))
+	if len(accountTransfers) != 2 || queried != 3 {
+		t.Errorf("routing disabled should emit Transfer without code query, got %d transfers %d queries", len(accountTransfers), queried)
+	}
+}
+
+func TestAbiProcessor_HandleRingMinedEventMarketAnomaly(t *testing.T) {
+	_, weth := setupMarketTokens()
+
+	// token注册后市场延迟重建, RDN-WETH能被解析但不在市场列表中
+	util.SetRegisterDebounce(60000)
+	defer util.SetRegisterDebounce(0)
+	rdn := types.Token{Protocol: common.HexToAddress("0x255aa6df07540cb5d3d297f0d0d4d84cb52bc8e6"), Symbol: "RDN"}
+	rdnRegistered := &types.TokenRegisterEvent{Token: rdn.Protocol, Symbol: rdn.Symbol}
+	rdnRegistered.Status = types.TX_STATUS_SUCCESS
+	util.TokenRegister(rdnRegistered)
+
+	seller := dao.Order{
+		OrderHash: common.HexToHash("0x01").Hex(),
+		Owner:     "0x1b978a1D302335a6F2Ebe4B8823B5E17c3C84135",
+		TokenS:    rdn.Protocol.Hex(),
+		TokenB:    weth.Protocol.Hex(),
+	}
+	buyer := dao.Order{
+		OrderHash: common.HexToHash("0x02").Hex(),
+		Owner:     "0xb1018949b241D76A1AB2094f473E9bEfeAbB5Ead",
+		TokenS:    weth.Protocol.Hex(),
+		TokenB:    rdn.Protocol.Hex(),
+	}
+	processor := &AbiProcessor{db: &mockRdsService{orders: map[string]dao.Order{
+		seller.OrderHash: seller,
+		buyer.OrderHash:  buyer,
+	}}}
+
+	var anomalies []*types.MarketAnomalyEvent
+	watcher := &eventemitter.Watcher{Concurrent: false, Handle: func(input eventemitter.EventData) error {
+		anomalies = append(anomalies, input.(*types.MarketAnomalyEvent))
+		return nil
+	}}
+	eventemitter.On(eventemitter.MarketAnomaly, watcher)
+	defer eventemitter.Un(eventemitter.MarketAnomaly, watcher)
+
+	collectFills(t, func() {
+		processor.handleRingMinedEvent(ringMinedEventData([]dao.Order{seller, buyer}))
+	})
+	if len(anomalies) != 2 {
+		t.Fatalf("expect 2 market anomalies, got %d", len(anomalies))
+	}
+	for _, v := range anomalies {
+		if v.Market != "RDN-WETH" {
+			t.Errorf("expect anomaly market RDN-WETH, got %s", v.Market)
+		}
+	}
+
+	// 正常市场不应产生anomaly
+	anomalies = anomalies[:0]
+	lrc, _ := util.TokenBySymbol("LRC")
+	seller.TokenS, buyer.TokenB = lrc.Protocol.Hex(), lrc.Protocol.Hex()
+	processor.db = &mockRdsService{orders: map[string]dao.Order{
+		seller.OrderHash: seller,
+		buyer.OrderHash:  buyer,
+	}}
+	collectFills(t, func() {
+		processor.handleRingMinedEvent(ringMinedEventData([]dao.Order{seller, buyer}))
+	})
+	if len(anomalies) != 0 {
+		t.Fatalf("expect no market anomaly for LRC-WETH, got %d", len(anomalies))
+	}
+}
+
+func TestAbiProcessor_IsRelevantTransaction(t *testing.T) {
+	var (
+		protocol = common.HexToAddress("0x781870080C8C24a2FD6882296c49c837b06A65E6")
+		tracked  = common.HexToAddress("0x1b978a1D302335a6F2Ebe4B8823B5E17c3C84135")
+		alice    = common.HexToAddress("0x4bad3053d574cd54513babe21db3f09bea1d387d")
+		bob      = common.HexToAddress("0xb1018949b241D76A1AB2094f473E9bEfeAbB5Ead")
+	)
+
+	processor := &AbiProcessor{
+		protocols: map[common.Address]string{protocol: "loopring"},
+		delegates: make(map[common.Address]string),
+		trackedOwner: func(owner common.Address) bool {
+			return owner == tracked
+		},
+	}
+
+	ring := &ethaccessor.Transaction{From: alice.Hex(), To: protocol.Hex(), Input: "0xe78aadb2"}
+	if !processor.IsRelevantTransaction(ring) {
+		t.Errorf("submitRing tx to protocol should be relevant")
+	}
+
+	send := &ethaccessor.Transaction{From: alice.Hex(), To: bob.Hex(), Value: *types.NewBigWithInt(1)}
+	if processor.IsRelevantTransaction(send) {
+		t.Errorf("eth send between untracked accounts should be irrelevant")
+	}
+
+	send.To = tracked.Hex()
+	if !processor.IsRelevantTransaction(send) {
+		t.Errorf("eth send to tracked account should be relevant")
+	}
+}
+
+func TestAbiProcessor_HandleApproveMethodFailed(t *testing.T) {
+	cfg := config.LoadConfig("../config/relay.toml")
+	erc20Abi, err := ethaccessor.NewAbi(cfg.Common.Erc20Abi)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var granted, failed []*types.ApprovalEvent
+	approveWatcher := &eventemitter.Watcher{Concurrent: false, Handle: func(input eventemitter.EventData) error {
+		granted = append(granted, input.(*types.ApprovalEvent))
+		return nil
+	}}
+	failedWatcher := &eventemitter.Watcher{Concurrent: false, Handle: func(input eventemitter.EventData) error {
+		failed = append(failed, input.(*types.ApprovalEvent))
+		return nil
+	}}
+	eventemitter.On(eventemitter.Approve, approveWatcher)
+	defer eventemitter.Un(eventemitter.Approve, approveWatcher)
+	eventemitter.On(eventemitter.ApproveFailed, failedWatcher)
+	defer eventemitter.Un(eventemitter.ApproveFailed, failedWatcher)
+
+	method := MethodData{
+		CAbi:   erc20Abi,
+		Name:   "approve",
+		Method: &ethaccessor.ApproveMethod{},
+		Input:  "0x095ea7b300000000000000000000000045aa504eb94077eec4bf95a10095a8e3196fc5910000000000000000000000000000000000000000000000008ac7230489e80000",
+	}
+	method.TxHash = common.HexToHash("0x01")
+	method.From = common.HexToAddress("0x1b978a1D302335a6F2Ebe4B8823B5E17c3C84135")
+	method.Status = types.TX_STATUS_FAILED
+
+	processor := &AbiProcessor{}
+	processor.handleApproveMethod(method)
+
+	if len(granted) != 0 {
+		t.Fatalf("failed approve should not grant allowance, got %d approvals", len(granted))
+	}
+	if len(failed) != 1 || failed[0].Status != types.TX_STATUS_FAILED {
+		t.Fatalf("failed approve should be emitted as ApproveFailed, got %d", len(failed))
+	}
+	if failed[0].Spender != common.HexToAddress("0x45aa504eb94077eec4bf95a10095a8e3196fc591") {
+		t.Fatalf("unexpected spender %s", failed[0].Spender.Hex())
+	}
+
+	// pending approve still emitted
+	method.Method = &ethaccessor.ApproveMethod{}
+	method.Status = types.TX_STATUS_PENDING
+	processor.handleApproveMethod(method)
+	if len(granted) != 1 {
+		t.Fatalf("pending approve should be emitted, got %d", len(granted))
+	}
+}
+
+func TestAbiProcessor_HandleRingMinedEventFeeDiscrepancy(t *testing.T) {
+	lrc, weth := setupMarketTokens()
+
+	seller := dao.Order{
+		OrderHash: common.HexToHash("0x01").Hex(),
+		Owner:     "0x1b978a1D302335a6F2Ebe4B8823B5E17c3C84135",
+		TokenS:    lrc.Protocol.Hex(),
+		TokenB:    weth.Protocol.Hex(),
+		AmountS:   "1000000000000000000000",
+		LrcFee:    "10000000000000000000",
+	}
+	buyer := dao.Order{
+		OrderHash: common.HexToHash("0x02").Hex(),
+		Owner:     "0xb1018949b241D76A1AB2094f473E9bEfeAbB5Ead",
+		TokenS:    weth.Protocol.Hex(),
+		TokenB:    lrc.Protocol.Hex(),
+		AmountS:   "2000000000000000000",
+		LrcFee:    "1000000000000000000",
+	}
+	processor := &AbiProcessor{db: &mockRdsService{orders: map[string]dao.Order{
+		seller.OrderHash: seller,
+		buyer.OrderHash:  buyer,
+	}}}
+
+	// seller全部成交, 矿工只收取了5LRC; buyer按订单收取1LRC
+	data := ringMinedEventData([]dao.Order{seller, buyer})
+	evt := data.Event.(*ethaccessor.RingMinedEvent)
+	underpaid, _ := new(big.Int).SetString("5000000000000000000", 0)
+	paid, _ := new(big.Int).SetString(buyer.LrcFee, 0)
+	evt.OrderInfoList[5] = bytes32(underpaid.Bytes())
+	evt.OrderInfoList[6] = bytes32(big.NewInt(0).Bytes())
+	evt.OrderInfoList[12] = bytes32(paid.Bytes())
+	evt.OrderInfoList[13] = bytes32(big.NewInt(0).Bytes())
+
+	var discrepancies []*types.FeeDiscrepancyEvent
+	watcher := &eventemitter.Watcher{Concurrent: false, Handle: func(input eventemitter.EventData) error {
+		discrepancies = append(discrepancies, input.(*types.FeeDiscrepancyEvent))
+		return nil
+	}}
+	eventemitter.On(eventemitter.FeeDiscrepancy, watcher)
+	defer eventemitter.Un(eventemitter.FeeDiscrepancy, watcher)
+
+	processor.handleRingMinedEvent(data)
+
+	if len(discrepancies) != 1 {
+		t.Fatalf("expect 1 feeDiscrepancy event, got %d", len(discrepancies))
+	}
+	d := discrepancies[0]
+	expected, _ := new(big.Int).SetString(seller.LrcFee, 0)
+	if d.OrderHash.Hex() != seller.OrderHash || d.ExpectedFee.Cmp(expected) != 0 || d.ActualFee.Cmp(underpaid) != 0 {
+		t.Fatalf("unexpected discrepancy order:%s expected:%s actual:%s", d.OrderHash.Hex(), d.ExpectedFee.String(), d.ActualFee.String())
+	}
+}
+
+func TestAbiProcessor_HandleTransferFromMethod(t *testing.T) {
+	cfg := config.LoadConfig("../config/relay.toml")
+	erc20Abi, err := ethaccessor.NewAbi(cfg.Common.Erc20Abi)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var transfers []*types.TransferEvent
+	watcher := &eventemitter.Watcher{Concurrent: false, Handle: func(input eventemitter.EventData) error {
+		transfers = append(transfers, input.(*types.TransferEvent))
+		return nil
+	}}
+	eventemitter.On(eventemitter.Transfer, watcher)
+	defer eventemitter.Un(eventemitter.Transfer, watcher)
+
+	var (
+		spender  = common.HexToAddress("0x17233e07c67d086464fD408148c3ABB56245FA64")
+		sender   = common.HexToAddress("0x1b978a1D302335a6F2Ebe4B8823B5E17c3C84135")
+		receiver = common.HexToAddress("0x45aa504eb94077eec4bf95a10095a8e3196fc591")
+		token    = common.HexToAddress("0xcd36128815ebe0b44d0374649bad2721b8751bef")
+	)
+
+	// transferFrom(0x1b97..., 0x45aa..., 10e18)
+	method := MethodData{
+		CAbi:   erc20Abi,
+		Name:   ethaccessor.METHOD_TRANSFER_FROM,
+		Method: &ethaccessor.TransferFromMethod{},
+		Input: "0x23b872dd" +
+			"0000000000000000000000001b978a1d302335a6f2ebe4b8823b5e17c3c84135" +
+			"00000000000000000000000045aa504eb94077eec4bf95a10095a8e3196fc591" +
+			"0000000000000000000000000000000000000000000000008ac7230489e80000",
+	}
+	method.TxHash = common.HexToHash("0x01")
+	method.From = spender
+	method.To = token
+	method.Protocol = token
+	method.Status = types.TX_STATUS_SUCCESS
+
+	processor := &AbiProcessor{}
+	processor.handleTransferFromMethod(method)
+
+	if len(transfers) != 1 {
+		t.Fatalf("expect 1 transfer, got %d", len(transfers))
+	}
+	transfer := transfers[0]
+	if transfer.Sender != sender || transfer.Receiver != receiver {
+		t.Errorf("sender should be from argument, got %s -> %s", transfer.Sender.Hex(), transfer.Receiver.Hex())
+	}
+	if transfer.From != spender || transfer.Protocol != token {
+		t.Errorf("tx info should keep spender %s and token %s, got %s %s", spender.Hex(), token.Hex(), transfer.From.Hex(), transfer.Protocol.Hex())
+	}
+	expected, _ := new(big.Int).SetString("10000000000000000000", 10)
+	if transfer.Amount.Cmp(expected) != 0 {
+		t.Errorf("expect amount %s, got %s", expected.String(), transfer.Amount.String())
+	}
+}
+
+func TestAbiProcessor_HandleAllowanceChangeMethod(t *testing.T) {
+	cfg := config.LoadConfig("../config/relay.toml")
+	erc20Abi, err := ethaccessor.NewAbi(cfg.Common.Erc20Abi)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var changes []*types.AllowanceChangedEvent
+	watcher := &eventemitter.Watcher{Concurrent: false, Handle: func(input eventemitter.EventData) error {
+		changes = append(changes, input.(*types.AllowanceChangedEvent))
+		return nil
+	}}
+	eventemitter.On(eventemitter.AllowanceChanged, watcher)
+	defer eventemitter.Un(eventemitter.AllowanceChanged, watcher)
+
+	var (
+		owner   = common.HexToAddress("0x1b978a1D302335a6F2Ebe4B8823B5E17c3C84135")
+		spender = common.HexToAddress("0x45aa504eb94077eec4bf95a10095a8e3196fc591")
+		args    = "00000000000000000000000045aa504eb94077eec4bf95a10095a8e3196fc591" +
+			"0000000000000000000000000000000000000000000000008ac7230489e80000"
+	)
+
+	cases := []struct {
+		name     string
+		selector string
+		increase bool
+	}{
+		{ethaccessor.METHOD_INCREASE_APPROVAL, "0xd73dd623", true},
+		{ethaccessor.METHOD_DECREASE_APPROVAL, "0x66188463", false},
+		{ethaccessor.METHOD_INCREASE_ALLOWANCE, "0x39509351", true},
+		{ethaccessor.METHOD_DECREASE_ALLOWANCE, "0xa457c2d7", false},
+	}
+
+	processor := &AbiProcessor{}
+	for _, c := range cases {
+		abiMethod, ok := erc20Abi.Methods[c.name]
+		if !ok {
+			t.Fatalf("erc20 abi should contain %s", c.name)
+		}
+		method := newMethodData(&abiMethod, erc20Abi)
+		if method.Id != c.selector {
+			t.Fatalf("%s method id should be %s, got %s", c.name, c.selector, method.Id)
+		}
+
+		method.Method = &ethaccessor.AllowanceChangeMethod{}
+		method.Input = c.selector + args
+		method.TxHash = common.HexToHash("0x01")
+		method.From = owner
+		method.Status = types.TX_STATUS_SUCCESS
+		processor.handleAllowanceChangeMethod(method)
+
+		change := changes[len(changes)-1]
+		if change.Owner != owner || change.Spender != spender {
+			t.Errorf("%s unexpected owner %s spender %s", c.name, change.Owner.Hex(), change.Spender.Hex())
+		}
+		if change.Increase != c.increase || change.Delta.String() != "10000000000000000000" {
+			t.Errorf("%s unexpected change increase:%t delta:%s", c.name, change.Increase, change.Delta.String())
+		}
+	}
+	if len(changes) != len(cases) {
+		t.Fatalf("expect %d allowance changes, got %d", len(cases), len(changes))
+	}
+}
+
+func TestEventData_MarshalJSON(t *testing.T) {
+	implAbi := protocolImplAbi(t)
+	ringMined := implAbi.Events[ethaccessor.EVENT_RING_MINED]
+
+	data := newEventData(&ringMined, implAbi)
+	data.Event = &ethaccessor.RingMinedEvent{
+		RingIndex:     big.NewInt(7),
+		RingHash:      common.HexToHash("0x1234"),
+		Miner:         common.HexToAddress("0x4bad3053d574cd54513babe21db3f09bea1d387d"),
+		FeeRecipient:  common.HexToAddress("0x4bad3053d574cd54513babe21db3f09bea1d387d"),
+		OrderInfoList: [][32]uint8{bytes32([]byte{1})},
+	}
+	data.Topics = []string{data.Id.Hex(), common.HexToHash("0x1234").Hex()}
+	data.Protocol = common.HexToAddress("0x781870080C8C24a2FD6882296c49c837b06A65E6")
+	data.TxHash = common.HexToHash("0xabcd")
+	data.BlockNumber = big.NewInt(100)
+	data.BlockTime = 1520000000
+	data.TxLogIndex = 3
+	data.Status = types.TX_STATUS_SUCCESS
+
+	bs, err := json.Marshal(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := `{"id":"` + data.Id.Hex() + `","name":"RingMined",` +
+		`"topics":["` + data.Id.Hex() + `","0x0000000000000000000000000000000000000000000000000000000000001234"],` +
+		`"protocol":"0x781870080C8C24a2FD6882296c49c837b06A65E6",` +
+		`"tx_hash":"0x000000000000000000000000000000000000000000000000000000000000abcd",` +
+		`"block_number":"100","block_time":1520000000,"tx_log_index":3,"status":"success",` +
+		`"event":{"RingIndex":7,"RingHash":"0x0000000000000000000000000000000000000000000000000000000000001234",` +
+		`"Miner":"0x4bad3053d574cd54513babe21db3f09bea1d387d","FeeRecipient":"0x4bad3053d574cd54513babe21db3f09bea1d387d",` +
+		`"OrderInfoList":[[0,0,0,0,0,0,0,0,0,0,0,0,0,0,0,0,0,0,0,0,0,0,0,0,0,0,0,0,0,0,0,1]]}}`
+	if string(bs) != expected {
+		t.Fatalf("unexpected json:\n%s\nexpected:\n%s", string(bs), expected)
+	}
+
+	// pointer marshals the same
+	if bs2, _ := json.Marshal(&data); string(bs2) != expected {
+		t.Fatalf("pointer json differs:%s", string(bs2))
+	}
+}
+
+func TestEventData_MarshalJSONRawHexAmounts(t *testing.T) {
+	value, _ := new(big.Int).SetString("123456789012345678901234567890123", 10)
+
+	var data EventData
+	data.Name = "Transfer"
+	data.Event = &ethaccessor.TransferEvent{Value: value}
+
+	bs, err := json.Marshal(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(bs), `"amounts"`) {
+		t.Fatalf("hex amounts should be omitted by default:%s", string(bs))
+	}
+
+	rawHexAmounts = true
+	defer func() { rawHexAmounts = false }()
+
+	bs, err = json.Marshal(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var record struct {
+		Amounts map[string]string `json:"amounts"`
+	}
+	if err := json.Unmarshal(bs, &record); err != nil {
+		t.Fatal(err)
+	}
+	hex, ok := record.Amounts["Value"]
+	if !ok || hex != "0x"+value.Text(16) {
+		t.Fatalf("expect value hex %s, got %s", "0x"+value.Text(16), hex)
+	}
+	if decoded, err := hexutil.DecodeBig(hex); err != nil || decoded.Cmp(value) != 0 {
+		t.Fatalf("hex amount should decode losslessly, got %v %v", decoded, err)
+	}
+}
+
+func TestAbiProcessor_HandleSubmitRingMethodOrders(t *testing.T) {
+	crypto.Initialize(crypto.NewKSCrypto(true, nil))
+
+	implAbi := protocolImplAbi(t)
+	input := "0xe78aadb20000000000000000000000000000000000000000000000000000000000000120000000000000000000000000000000000000000000000000000000000000024000000000000000000000000000000000000000000000000000000000000003e0000000000000000000000000000000000000000000000000000000000000044000000000000000000000000000000000000000000000000000000000000004a0000000000000000000000000000000000000000000000000000000000000054000000000000000000000000000000000000000000000000000000000000005e00000000000000000000000003acdf3e3d8ec52a768083f718e763727b021065000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000002000000000000000000000000bb27332611e3f6372b37ef7d728a6f3a881f9391000000000000000000000000c02aaa39b223fe8d0a0e5c4f27ead9083c756cc2000000000000000000000000b94065482ad64d4c2b9252358d746b39e820a5820000000000000000000000008b0f7dad5a9a64c895fe54612b6949286d55f37c000000000000000000000000b94065482ad64d4c2b9252358d746b39e820a5820000000000000000000000001b793e49237758dbd8b752afc9eb4b329d5da016000000000000000000000000b94065482ad64d4c2b9252358d746b39e820a5820000000000000000000000002ffd520ac4d79caa0c1a7e5f1f7b37b4444da378000000000000000000000000000000000000000000000000000000000000000200000000000000000000000000000000000000000000000025fa7a1faa41a00000000000000000000000000000000000000000000000026493009208ba100000000000000000000000000000000000000000000000000000000000005af07096000000000000000000000000000000000000000000000000000000005af1c21600000000000000000000000000000000000000000000000042c08d83f9a1000000000000000000000000000000000000000000000000000025fa7a1faa41a0000000000000000000000000000000000000000000000000056bc75e2d6310000000000000000000000000000000000000000000000000000000560a24872ba000000000000000000000000000000000000000000000000000000000005af1178e000000000000000000000000000000000000000000000000000000005af2690e00000000000000000000000000000000000000000000000005698eef066700000000000000000000000000000000000000000000000000056bc75e2d631000000000000000000000000000000000000000000000000000000000000000000002000000000000000000000000000000000000000000000000000000000000003200000000000000000000000000000000000000000000000000000000000000320000000000000000000000000000000000000000000000000000000000000002000000000000000000000000000000000000000000000000000000000000000100000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000004000000000000000000000000000000000000000000000000000000000000001b000000000000000000000000000000000000000000000000000000000000001b000000000000000000000000000000000000000000000000000000000000001c000000000000000000000000000000000000000000000000000000000000001b0000000000000000000000000000000000000000000000000000000000000004c14c87a401d3200487730431cc60cfbfd75086f24fc21819b91b2fe3d420b98a325b0fb4071bb3f7efef29bf567dd24ff05757c97af576be02ab8164b9a95c7a63936adf69c67c360d754b81d3980710ad0273cc9e2c5d8251363d8004e0b42e9dfb1ef1034d7939f70acf5cb717f73de4c13673ea9480bb8f2b39284dbcd49a00000000000000000000000000000000000000000000000000000000000000047faf5a6cc75d4aaf0ca207eafc1b3113c241dc3517cfa6fb7c06c79d901cff007b769c119d59a95252e008b3a35963dbd94f41f581c76b4d2af3b23d5daa33b97876371bd88382688660f2538a8681e14c68d62252c2a104738a08aa2f94d4496b5dbd58a834895e0cded1adc5068ee4771b0f1f23126491ad5f762df8683ea6"
+
+	submitRing := func(status types.TxStatus) ([]*types.Order, []*types.OrderFilledEvent) {
+		method := MethodData{
+			CAbi:   implAbi,
+			Name:   ethaccessor.METHOD_SUBMIT_RING,
+			Method: &ethaccessor.SubmitRingMethodInputs{},
+			Input:  input,
+		}
+		method.TxHash = common.HexToHash("0xabcd")
+		method.To = common.HexToAddress("0x781870080C8C24a2FD6882296c49c837b06A65E6")
+		method.DelegateAddress = common.HexToAddress("0x17233e07c67d086464fD408148c3ABB56245FA64")
+		method.BlockNumber = big.NewInt(100)
+		method.Status = status
+
+		var orders []*types.Order
+		watcher := &eventemitter.Watcher{Concurrent: false, Handle: func(input eventemitter.EventData) error {
+			orders = append(orders, input.(*types.Order))
+			return nil
+		}}
+		eventemitter.On(eventemitter.GatewayNewOrder, watcher)
+		defer eventemitter.Un(eventemitter.GatewayNewOrder, watcher)
+
+		processor := &AbiProcessor{}
+		fills := collectFills(t, func() {
+			processor.handleSubmitRingMethod(method)
+		})
+		return orders, fills
+	}
+
+	expected := []struct{ owner, tokenS, tokenB common.Address }{
+		{
+			common.HexToAddress("0xbb27332611e3f6372b37ef7d728a6f3a881f9391"),
+			common.HexToAddress("0xc02aaa39b223fe8d0a0e5c4f27ead9083c756cc2"),
+			common.HexToAddress("0x1b793e49237758dbd8b752afc9eb4b329d5da016"),
+		},
+		{
+			common.HexToAddress("0xb94065482ad64d4c2b9252358d746b39e820a582"),
+			common.HexToAddress("0x1b793e49237758dbd8b752afc9eb4b329d5da016"),
+			common.HexToAddress("0xc02aaa39b223fe8d0a0e5c4f27ead9083c756cc2"),
+		},
+	}
+
+	orders, fills := submitRing(types.TX_STATUS_SUCCESS)
+	if len(orders) != len(expected) {
+		t.Fatalf("expect %d orders, got %d", len(expected), len(orders))
+	}
+	for i, ord := range orders {
+		if ord.Owner != expected[i].owner || ord.TokenS != expected[i].tokenS || ord.TokenB != expected[i].tokenB {
+			t.Errorf("order %d unexpected owner:%s tokenS:%s tokenB:%s", i, ord.Owner.Hex(), ord.TokenS.Hex(), ord.TokenB.Hex())
+		}
+		if ord.Hash != ord.GenerateHash() || types.IsZeroHash(ord.Hash) {
+			t.Errorf("order %d hash not set", i)
+		}
+	}
+	if len(fills) != 0 {
+		t.Fatalf("successful submitRing should not emit fills, got %d", len(fills))
+	}
+
+	// 失败的交易仍然记录订单
+	orders, fills = submitRing(types.TX_STATUS_FAILED)
+	if len(orders) != len(expected) || len(fills) != len(expected) {
+		t.Fatalf("expect %d orders and failed fills, got %d orders %d fills", len(expected), len(orders), len(fills))
+	}
+	for i, fill := range fills {
+		if fill.Status != types.TX_STATUS_FAILED || fill.OrderHash != orders[i].Hash || fill.Owner != expected[i].owner {
+			t.Errorf("fill %d unexpected status:%s order:%s owner:%s", i, types.StatusStr(fill.Status), fill.OrderHash.Hex(), fill.Owner.Hex())
+		}
+	}
+
+	// pending交易结果未知, 不能记为失败成交
+	orders, fills = submitRing(types.TX_STATUS_PENDING)
+	if len(orders) != len(expected) || len(fills) != 0 {
+		t.Fatalf("pending submitRing expect %d orders and no fills, got %d orders %d fills", len(expected), len(orders), len(fills))
+	}
+}
+
+func TestMethodData_Status(t *testing.T) {
+	cases := []struct {
+		status                   types.TxStatus
+		pending, failed, process bool
+	}{
+		{types.TX_STATUS_PENDING, true, false, true},
+		{types.TX_STATUS_FAILED, false, true, true},
+		{types.TX_STATUS_SUCCESS, false, false, false},
+		{types.TX_STATUS_UNKNOWN, false, false, false},
+	}
+
+	for _, c := range cases {
+		var method MethodData
+		method.Status = c.status
+		if method.isPending() != c.pending || method.isFailed() != c.failed || method.processNeeded() != c.process {
+			t.Errorf("status %s expect pending:%t failed:%t processNeeded:%t, got %t %t %t", types.StatusStr(c.status), c.pending, c.failed, c.process, method.isPending(), method.isFailed(), method.processNeeded())
+		}
+	}
+}
+
+func TestAbiProcessor_GetDelegateProtocol(t *testing.T) {
+	var (
+		protocol = common.HexToAddress("0x781870080C8C24a2FD6882296c49c837b06A65E6")
+		delegate = common.HexToAddress("0xC533531f4f291F036513f7Abd23bfc7f4D8aC780")
+		registry = common.HexToAddress("0xE8C2F3Dd85B2B4dB4E4De7D6C0a5e7B1e6A2c3C4")
+	)
+
+	processor := &AbiProcessor{
+		protocols:         make(map[common.Address]string),
+		delegates:         make(map[common.Address]string),
+		delegateProtocols: make(map[common.Address]common.Address),
+		protocolVersions:  make(map[common.Address]string),
+		activeProtocols:   make(map[common.Address]bool),
+	}
+	processor.loadProtocolVersion(&ethaccessor.ProtocolAddress{
+		Version:              "v1.5",
+		ContractAddress:      protocol,
+		TokenRegistryAddress: registry,
+		DelegateAddress:      delegate,
+	})
+
+	if got, ok := processor.GetDelegateProtocol(delegate); !ok || got != protocol {
+		t.Errorf("delegate should resolve to protocol %s, got %s %t", protocol.Hex(), got.Hex(), ok)
+	}
+	if !processor.HasSpender(delegate) {
+		t.Errorf("loaded delegate should be known spender")
+	}
+	if _, ok := processor.GetDelegateProtocol(protocol); ok {
+		t.Errorf("protocol address is not a delegate")
+	}
+}
+
+func TestAbiProcessor_HandleAddressDeAuthorizedEvent(t *testing.T) {
+	var (
+		protocol = common.HexToAddress("0x781870080C8C24a2FD6882296c49c837b06A65E6")
+		delegate = common.HexToAddress("0xC533531f4f291F036513f7Abd23bfc7f4D8aC780")
+		registry = common.HexToAddress("0xE8C2F3Dd85B2B4dB4E4De7D6C0a5e7B1e6A2c3C4")
+	)
+
+	processor := &AbiProcessor{
+		protocols:         make(map[common.Address]string),
+		delegates:         make(map[common.Address]string),
+		delegateProtocols: make(map[common.Address]common.Address),
+		protocolVersions:  make(map[common.Address]string),
+		activeProtocols:   make(map[common.Address]bool),
+	}
+	processor.loadProtocolVersion(&ethaccessor.ProtocolAddress{
+		Version:              "v1.5",
+		ContractAddress:      protocol,
+		TokenRegistryAddress: registry,
+		DelegateAddress:      delegate,
+	})
+	if !processor.HasSpender(delegate) {
+		t.Fatalf("authorized delegate should be known spender")
+	}
+
+	var authorized, deauthorized int
+	authorizedWatcher := &eventemitter.Watcher{Concurrent: false, Handle: func(input eventemitter.EventData) error {
+		authorized++
+		return nil
+	}}
+	deauthorizedWatcher := &eventemitter.Watcher{Concurrent: false, Handle: func(input eventemitter.EventData) error {
+		if input.(*types.AddressDeAuthorizedEvent).Protocol != protocol {
+			t.Errorf("unexpected deauthorized address")
+		}
+		deauthorized++
+		return nil
+	}}
+	eventemitter.On(eventemitter.AddressAuthorized, authorizedWatcher)
+	defer eventemitter.Un(eventemitter.AddressAuthorized, authorizedWatcher)
+	eventemitter.On(eventemitter.AddressDeAuthorized, deauthorizedWatcher)
+	defer eventemitter.Un(eventemitter.AddressDeAuthorized, deauthorizedWatcher)
+
+	evt := EventData{Event: &ethaccessor.AddressDeAuthorizedEvent{}}
+	evt.Topics = []string{"0x", common.BytesToHash(protocol.Bytes()).Hex()}
+	evt.Protocol = delegate
+	evt.Status = types.TX_STATUS_SUCCESS
+	if err := processor.handleAddressDeAuthorizedEvent(evt); err != nil {
+		t.Fatal(err)
+	}
+
+	if authorized != 0 || deauthorized != 1 {
+		t.Fatalf("deauthorization should be emitted as AddressDeAuthorized, got authorized:%d deauthorized:%d", authorized, deauthorized)
+	}
+	if processor.HasSpender(delegate) {
+		t.Errorf("deauthorized delegate should not be spender")
+	}
+	if _, ok := processor.GetDelegateProtocol(delegate); ok {
+		t.Errorf("deauthorized delegate should not resolve to protocol")
+	}
+}
+
+func TestAbiProcessor_HandleAddressAuthorizedEvent(t *testing.T) {
+	var (
+		protocol = common.HexToAddress("0x781870080C8C24a2FD6882296c49c837b06A65E6")
+		delegate = common.HexToAddress("0xC533531f4f291F036513f7Abd23bfc7f4D8aC780")
+		owner    = common.HexToAddress("0x1b978a1D302335a6F2Ebe4B8823B5E17c3C84135")
+		token    = common.HexToAddress("0xEF68e7C694F40c8202821eDF525dE3782458639f")
+	)
+
+	processor := &AbiProcessor{
+		delegates:         make(map[common.Address]string),
+		delegateProtocols: make(map[common.Address]common.Address),
+	}
+	if processor.HasSpender(delegate) {
+		t.Fatalf("delegate should not be spender before authorized")
+	}
+
+	var approvals []*types.ApprovalEvent
+	watcher := &eventemitter.Watcher{Concurrent: false, Handle: func(input eventemitter.EventData) error {
+		approval := input.(*types.ApprovalEvent)
+		if processor.HasSpender(approval.Spender) {
+			approvals = append(approvals, approval)
+		}
+		return nil
+	}}
+	eventemitter.On(eventemitter.Approve, watcher)
+	defer eventemitter.Un(eventemitter.Approve, watcher)
+
+	authorized := EventData{Event: &ethaccessor.AddressAuthorizedEvent{}}
+	authorized.Topics = []string{"0x", common.BytesToHash(protocol.Bytes()).Hex()}
+	authorized.Protocol = delegate
+	authorized.Status = types.TX_STATUS_SUCCESS
+
+	// 授权与查询在不同goroutine中并发进行
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			processor.HasSpender(delegate)
+			processor.GetDelegateProtocol(delegate)
+		}()
+		go func() {
+			defer wg.Done()
+			processor.handleAddressAuthorizedEvent(EventData{Event: &ethaccessor.AddressAuthorizedEvent{}, TxInfo: authorized.TxInfo, Topics: authorized.Topics})
+		}()
+	}
+	wg.Wait()
+
+	if !processor.HasSpender(delegate) {
+		t.Fatalf("authorized delegate should be spender")
+	}
+	if got, ok := processor.GetDelegateProtocol(delegate); !ok || got != protocol {
+		t.Errorf("authorized delegate should resolve to protocol %s, got %s", protocol.Hex(), got.Hex())
+	}
+
+	approval := EventData{Event: &ethaccessor.ApprovalEvent{Value: big.NewInt(100)}}
+	approval.Topics = []string{"0x", common.BytesToHash(owner.Bytes()).Hex(), common.BytesToHash(delegate.Bytes()).Hex()}
+	approval.Protocol = token
+	approval.Status = types.TX_STATUS_SUCCESS
+	processor.handleApprovalEvent(approval)
+
+	if len(approvals) != 1 || approvals[0].Owner != owner || approvals[0].Spender != delegate {
+		t.Fatalf("approval to authorized delegate should be emitted, got %d", len(approvals))
+	}
+}
+
+func TestAbiProcessor_DuplicateApproval(t *testing.T) {
+	var (
+		owner   = common.HexToAddress("0x1b978a1D302335a6F2Ebe4B8823B5E17c3C84135")
+		spender = common.HexToAddress("0x17233e07c67d086464fD408148c3ABB56245FA64")
+		token   = common.HexToAddress("0xEF68e7C694F40c8202821eDF525dE3782458639f")
+	)
+
+	var emitted []*types.ApprovalEvent
+	watcher := &eventemitter.Watcher{Concurrent: false, Handle: func(input eventemitter.EventData) error {
+		emitted = append(emitted, input.(*types.ApprovalEvent))
+		return nil
+	}}
+	eventemitter.On(eventemitter.Approve, watcher)
+	defer eventemitter.Un(eventemitter.Approve, watcher)
+
+	processor := &AbiProcessor{}
+	approve := func(txhash string, value int64) {
+		approval := EventData{Event: &ethaccessor.ApprovalEvent{Value: big.NewInt(value)}}
+		approval.Topics = []string{"0x", common.BytesToHash(owner.Bytes()).Hex(), common.BytesToHash(spender.Bytes()).Hex()}
+		approval.Protocol = token
+		approval.TxHash = common.HexToHash(txhash)
+		approval.Status = types.TX_STATUS_SUCCESS
+		processor.handleApprovalEvent(approval)
+	}
+
+	// 数量相同的approve也是独立的交易, 都需要发出供txmanager记录, 是否刷新授权由account manager按缓存判断
+	approve("0x01", 100)
+	approve("0x02", 100)
+	if len(emitted) != 2 || emitted[1].TxHash != common.HexToHash("0x02") {
+		t.Fatalf("approval with same value should still be emitted, got %d", len(emitted))
+	}
+}
+
+func TestAbiProcessor_UnchangedApproval(t *testing.T) {
+	var (
+		owner   = common.HexToAddress("0x1b978a1D302335a6F2Ebe4B8823B5E17c3C84135")
+		spender = common.HexToAddress("0x17233e07c67d086464fD408148c3ABB56245FA64")
+		token   = common.HexToAddress("0xEF68e7C694F40c8202821eDF525dE3782458639f")
+		txhash  = common.HexToHash("0x01")
+	)
+
+	var emitted []*types.ApprovalEvent
+	watcher := &eventemitter.Watcher{Concurrent: false, Handle: func(input eventemitter.EventData) error {
+		emitted = append(emitted, input.(*types.ApprovalEvent))
+		return nil
+	}}
+	eventemitter.On(eventemitter.Approve, watcher)
+	defer eventemitter.Un(eventemitter.Approve, watcher)
+
+	processor := &AbiProcessor{}
+	approve := func(logIndex int64, value int64) {
+		approval := EventData{Event: &ethaccessor.ApprovalEvent{Value: big.NewInt(value)}}
+		approval.Topics = []string{"0x", common.BytesToHash(owner.Bytes()).Hex(), common.BytesToHash(spender.Bytes()).Hex()}
+		approval.Protocol = token
+		approval.TxHash = txhash
+		approval.TxLogIndex = logIndex
+		approval.Status = types.TX_STATUS_SUCCESS
+		processor.handleApprovalEvent(approval)
+	}
+
+	// token在同一交易中重复发出数量相同的Approval
+	approve(1, 100)
+	approve(2, 100)
+	if len(emitted) != 1 {
+		t.Fatalf("unchanged approval should be suppressed, got %d", len(emitted))
+	}
+
+	approve(3, 200)
+	if len(emitted) != 2 || emitted[1].Amount.Int64() != 200 {
+		t.Fatalf("changed approval should be emitted, got %d", len(emitted))
+	}
+
+	// 同一交易被重新处理时不能被当作重复授权
+	approve(1, 200)
+	if len(emitted) != 3 {
+		t.Fatalf("reprocessed approval should be emitted, got %d", len(emitted))
+	}
+}
+
+func TestAbiProcessor_HandleTokenRegisteredEvent(t *testing.T) {
+	token := common.HexToAddress("0x419D0d8BdD9aF5e606Ae2232ed285Aff190E711b")
+	processor := &AbiProcessor{protocols: make(map[common.Address]string)}
+
+	registered := EventData{Event: &ethaccessor.TokenRegisteredEvent{Token: token, Symbol: "fun"}}
+	registered.Status = types.TX_STATUS_SUCCESS
+	if err := processor.handleTokenRegisteredEvent(registered); err != nil {
+		t.Fatal(err)
+	}
+	if !processor.SupportedContract(token) {
+		t.Fatalf("registered token address should be loaded")
+	}
+
+	unregistered := EventData{Event: &ethaccessor.TokenUnRegisteredEvent{Token: token, Symbol: "FUN"}}
+	unregistered.Status = types.TX_STATUS_SUCCESS
+	if err := processor.handleTokenUnRegisteredEvent(unregistered); err != nil {
+		t.Fatal(err)
+	}
+	if processor.SupportedContract(token) {
+		t.Errorf("unregistered token address should be removed")
+	}
+}
+
+func TestAbiProcessor_UnloadEvictedTokens(t *testing.T) {
+	token := common.HexToAddress("0x419D0d8BdD9aF5e606Ae2232ed285Aff190E711b")
+	unverified := common.HexToAddress("0x255Aa6DF07540Cb5d3d297f0D0D4D84cb52bc8e6")
+	processor := &AbiProcessor{protocols: map[common.Address]string{token: "FUN"}, unknownTokens: map[common.Address]bool{unverified: true}}
+
+	processor.handleTokenEvicted(&types.TokenEvictedEvent{Token: token, Symbol: "FUN"})
+	processor.handleTokenEvicted(&types.TokenEvictedEvent{Token: unverified, Symbol: "RDN"})
+	if !processor.SupportedContract(token) {
+		t.Fatalf("evicted token should be kept until next block")
+	}
+
+	processor.unloadEvictedTokens()
+	if processor.SupportedContract(token) {
+		t.Errorf("evicted token address should be removed")
+	}
+	if processor.unknownTokens[unverified] {
+		t.Errorf("evicted unverified token should be resolved again")
+	}
+}
+
+func TestAbiProcessor_HandleCutoffPairEventCanonical(t *testing.T) {
+	var (
+		owner = common.HexToAddress("0x1b978a1D302335a6F2Ebe4B8823B5E17c3C84135")
+		lrc   = common.HexToAddress("0xEF68e7C694F40c8202821eDF525dE3782458639f")
+		weth  = common.HexToAddress("0x2956356cD2a2bf3202F771F50D3D14A367b48070")
+	)
+
+	var received []*types.CutoffPairEvent
+	watcher := &eventemitter.Watcher{Concurrent: false, Handle: func(input eventemitter.EventData) error {
+		received = append(received, input.(*types.CutoffPairEvent))
+		return nil
+	}}
+	eventemitter.On(eventemitter.CutoffPair, watcher)
+	defer eventemitter.Un(eventemitter.CutoffPair, watcher)
+
+	processor := &AbiProcessor{}
+	for _, pair := range [][2]common.Address{{lrc, weth}, {weth, lrc}} {
+		var data EventData
+		data.Event = &ethaccessor.CutoffPairEvent{Token1: pair[0], Token2: pair[1], Cutoff: big.NewInt(1520000000)}
+		data.Topics = []string{"", common.BytesToHash(owner.Bytes()).Hex()}
+		processor.handleCutoffPairEvent(data)
+	}
+
+	if len(received) != 2 {
+		t.Fatalf("expect 2 cutoffpair events, got %d", len(received))
+	}
+	for _, evt := range received {
+		if evt.Owner != owner || evt.Token1 != weth || evt.Token2 != lrc {
+			t.Errorf("expect canonical scope %s-%s, got %s-%s", weth.Hex(), lrc.Hex(), evt.Token1.Hex(), evt.Token2.Hex())
+		}
+	}
+}
+
+func TestAbiProcessor_HandleCutoffMethodOwner(t *testing.T) {
+	var (
+		owner   = common.HexToAddress("0x1b978a1D302335a6F2Ebe4B8823B5E17c3C84135")
+		relayer = common.HexToAddress("0x45aa504eb94077eec4bf95a10095a8e3196fc591")
+	)
+
+	selfAbi, err := ethaccessor.NewAbi(`[{"constant":false,"inputs":[{"name":"cutoff","type":"uint256"}],"name":"cancelAllOrders","outputs":[],"payable":false,"type":"function"}]`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	delegatedAbi, err := ethaccessor.NewAbi(`[{"constant":false,"inputs":[{"name":"owner","type":"address"},{"name":"cutoff","type":"uint256"}],"name":"cancelAllOrders","outputs":[],"payable":false,"type":"function"}]`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var received []*types.CutoffEvent
+	watcher := &eventemitter.Watcher{Concurrent: false, Handle: func(input eventemitter.EventData) error {
+		received = append(received, input.(*types.CutoffEvent))
+		return nil
+	}}
+	eventemitter.On(eventemitter.CutoffAll, watcher)
+	defer eventemitter.Un(eventemitter.CutoffAll, watcher)
+
+	word := func(b []byte) string {
+		return common.Bytes2Hex(common.LeftPadBytes(b, 32))
+	}
+	cutoffMethod := func(cabi *abi.ABI, args ...[]byte) MethodData {
+		input := common.ToHex(cabi.Methods[ethaccessor.METHOD_CUTOFF_ALL].Id())
+		for _, arg := range args {
+			input += word(arg)
+		}
+		method := MethodData{
+			CAbi:   cabi,
+			Name:   ethaccessor.METHOD_CUTOFF_ALL,
+			Method: &ethaccessor.CutoffMethod{},
+			Input:  input,
+		}
+		method.TxHash = common.HexToHash("0x01")
+		method.From = relayer
+		return method
+	}
+
+	processor := &AbiProcessor{options: &config.ExtractorOptions{}}
+	cutoff := big.NewInt(1520000000)
+
+	// owner自己提交, owner取tx.from
+	processor.handleCutoffMethod(cutoffMethod(selfAbi, cutoff.Bytes()))
+	if len(received) != 1 {
+		t.Fatalf("expect 1 cutoff event, got %d", len(received))
+	}
+	if received[0].Owner != relayer || received[0].Cutoff.Cmp(cutoff) != 0 {
+		t.Fatalf("self cutoff should use tx.from as owner, got owner:%s cutoff:%s", received[0].Owner.Hex(), received[0].Cutoff.String())
+	}
+
+	// relayer代为提交, owner取方法参数
+	processor.handleCutoffMethod(cutoffMethod(delegatedAbi, owner.Bytes(), cutoff.Bytes()))
+	if len(received) != 2 {
+		t.Fatalf("expect 2 cutoff events, got %d", len(received))
+	}
+	if received[1].Owner != owner || received[1].From != relayer || received[1].Cutoff.Cmp(cutoff) != 0 {
+		t.Fatalf("delegated cutoff should use owner argument, got owner:%s from:%s cutoff:%s", received[1].Owner.Hex(), received[1].From.Hex(), received[1].Cutoff.String())
+	}
+}
+
+func TestAbiProcessor_EmitProtocolEventByVersion(t *testing.T) {
+	var (
+		owner     = common.HexToAddress("0x1b978a1D302335a6F2Ebe4B8823B5E17c3C84135")
+		protocol1 = common.HexToAddress("0x781870080C8C24a2FD6882296c49c837b06A65E6")
+		protocol2 = common.HexToAddress("0x8d8812b72d1e4ffCeC158D25f56748b7d67c1e78")
+	)
+
+	received := make(map[string][]*types.CutoffEvent)
+	for _, version := range []string{"v1.0", "v1.5"} {
+		version := version
+		watcher := &eventemitter.Watcher{Concurrent: false, Handle: func(input eventemitter.EventData) error {
+			received[version] = append(received[version], input.(*types.CutoffEvent))
+			return nil
+		}}
+		topic := eventemitter.VersionTopic(eventemitter.CutoffAll, version)
+		eventemitter.On(topic, watcher)
+		defer eventemitter.Un(topic, watcher)
+	}
+
+	var total int
+	watcher := &eventemitter.Watcher{Concurrent: false, Handle: func(input eventemitter.EventData) error {
+		total++
+		return nil
+	}}
+	eventemitter.On(eventemitter.CutoffAll, watcher)
+	defer eventemitter.Un(eventemitter.CutoffAll, watcher)
+
+	processor := &AbiProcessor{
+		options:          &config.ExtractorOptions{RouteProtocolVersion: true},
+		protocolVersions: map[common.Address]string{protocol1: "v1.0", protocol2: "v1.5"},
+	}
+
+	var data EventData
+	data.Event = &ethaccessor.CutoffEvent{Cutoff: big.NewInt(1520000000)}
+	data.Topics = []string{"", common.BytesToHash(owner.Bytes()).Hex()}
+	data.Protocol = protocol1
+	processor.handleCutoffEvent(data)
+
+	if len(received["v1.0"]) != 1 || received["v1.0"][0].Protocol != protocol1 {
+		t.Fatalf("v1.0 consumer should receive the v1.0 cutoff, got %d", len(received["v1.0"]))
+	}
+	if len(received["v1.5"]) != 0 {
+		t.Fatalf("v1.5 consumer should not receive v1.0 cutoff, got %d", len(received["v1.5"]))
+	}
+	if total != 1 {
+		t.Fatalf("unscoped consumer should still receive cutoff, got %d", total)
+	}
+
+	// 未开启时只发到原topic
+	processor.options.RouteProtocolVersion = false
+	processor.handleCutoffEvent(data)
+	if len(received["v1.0"]) != 1 || total != 2 {
+		t.Fatalf("versioned topic should not be emitted when routing disabled")
+	}
+}
+
+func TestAbiProcessor_DeprecatedProtocol(t *testing.T) {
+	var (
+		owner      = common.HexToAddress("0x1b978a1D302335a6F2Ebe4B8823B5E17c3C84135")
+		deprecated = &ethaccessor.ProtocolAddress{Version: "v1.0", ContractAddress: common.HexToAddress("0x781870080C8C24a2FD6882296c49c837b06A65E6")}
+		active     = &ethaccessor.ProtocolAddress{Version: "v1.5", ContractAddress: common.HexToAddress("0x8d8812b72d1e4ffCeC158D25f56748b7d67c1e78")}
+	)
+
+	cutoffAbi, err := ethaccessor.NewAbi(`[{"constant":false,"inputs":[{"name":"cutoff","type":"uint256"}],"name":"cancelAllOrders","outputs":[],"payable":false,"type":"function"}]`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	processor := &AbiProcessor{options: &config.ExtractorOptions{DeprecatedProtocolVersions: []string{"v1.0"}}}
+	processor.resetContracts()
+	processor.loadProtocolVersion(deprecated)
+	processor.loadProtocolVersion(active)
+
+	if !processor.SupportedContract(deprecated.ContractAddress) {
+		t.Fatalf("deprecated protocol should still be recognized")
+	}
+	if processor.IsActiveProtocol(deprecated.ContractAddress) || !processor.IsActiveProtocol(active.ContractAddress) {
+		t.Fatalf("only v1.5 should be active")
+	}
+
+	cutoffs := make(map[common.Address]int)
+	cancels := make(map[common.Address]int)
+	cutoffWatcher := &eventemitter.Watcher{Concurrent: false, Handle: func(input eventemitter.EventData) error {
+		cutoffs[input.(*types.CutoffEvent).Protocol]++
+		return nil
+	}}
+	cancelWatcher := &eventemitter.Watcher{Concurrent: false, Handle: func(input eventemitter.EventData) error {
+		cancels[input.(*types.OrderCancelledEvent).Protocol]++
+		return nil
+	}}
+	eventemitter.On(eventemitter.CutoffAll, cutoffWatcher)
+	defer eventemitter.Un(eventemitter.CutoffAll, cutoffWatcher)
+	eventemitter.On(eventemitter.CancelOrder, cancelWatcher)
+	defer eventemitter.Un(eventemitter.CancelOrder, cancelWatcher)
+
+	for _, protocol := range []common.Address{deprecated.ContractAddress, active.ContractAddress} {
+		var cutoff EventData
+		cutoff.Event = &ethaccessor.CutoffEvent{Cutoff: big.NewInt(1520000000)}
+		cutoff.Topics = []string{"", common.BytesToHash(owner.Bytes()).Hex()}
+		cutoff.Protocol = protocol
+		processor.handleCutoffEvent(cutoff)
+
+		var cancel EventData
+		cancel.Event = &ethaccessor.OrderCancelledEvent{AmountCancelled: big.NewInt(1000)}
+		cancel.Topics = []string{"", common.HexToHash("0x01").Hex()}
+		cancel.Protocol = protocol
+		processor.handleOrderCancelledEvent(cancel)
+
+		// 失败交易没有event, 由method发出
+		method := MethodData{CAbi: cutoffAbi, Name: ethaccessor.METHOD_CUTOFF_ALL, Method: &ethaccessor.CutoffMethod{}}
+		method.Input = common.ToHex(cutoffAbi.Methods[ethaccessor.METHOD_CUTOFF_ALL].Id()) + common.Bytes2Hex(common.LeftPadBytes(big.NewInt(1520000000).Bytes(), 32))
+		method.Protocol = protocol
+		method.From = owner
+		method.Status = types.TX_STATUS_FAILED
+		processor.handleCutoffMethod(method)
+	}
+
+	if cutoffs[deprecated.ContractAddress] != 0 || cancels[deprecated.ContractAddress] != 0 {
+		t.Fatalf("events and methods from deprecated protocol should be skipped")
+	}
+	if cutoffs[active.ContractAddress] != 2 || cancels[active.ContractAddress] != 1 {
+		t.Fatalf("events and methods from active protocol should be forwarded, got cutoff:%d cancel:%d", cutoffs[active.ContractAddress], cancels[active.ContractAddress])
+	}
+}
+
+func TestAbiProcessor_IsValidEthTransferTransaction(t *testing.T) {
+	var (
+		sender   = "0x1b978a1D302335a6F2Ebe4B8823B5E17c3C84135"
+		receiver = "0xb1018949b241D76A1AB2094f473E9bEfeAbB5Ead"
+		lrc      = types.Token{Symbol: "LRC", Protocol: common.HexToAddress("0xEF68e7C694F40c8202821eDF525dE3782458639f")}
+		newToken = "0x8d8812b72d1e4ffCeC158D25f56748b7d67c1e78"
+	)
+
+	util.SetTokens(map[string]types.Token{"LRC": lrc}, map[string]types.Token{})
+
+	processor := &AbiProcessor{
+		protocols:     map[common.Address]string{},
+		unknownTokens: map[common.Address]bool{},
+		erc20Methods:  map[string]bool{"0xa9059cbb": true, "0x095ea7b3": true},
+	}
+
+	transferInput := "0xa9059cbb000000000000000000000000b1018949b241d76a1ab2094f473e9befeabb5ead0000000000000000000000000000000000000000000000000de0b6b3a7640000"
+	// 自定义方法, 不在erc20 abi中
+	mintInput := "0x40c10f19000000000000000000000000b1018949b241d76a1ab2094f473e9befeabb5ead"
+
+	cases := []struct {
+		name   string
+		to     string
+		input  string
+		expect bool
+	}{
+		{"eth send", receiver, "0x", true},
+		{"token transfer to unsupported contract", newToken, transferInput, false},
+		{"unknown method on registered token", lrc.Protocol.Hex(), mintInput, false},
+		{"eth send to registered token", lrc.Protocol.Hex(), "0x", true},
+		{"unknown method on unknown contract", newToken, mintInput, true},
+	}
+
+	for _, c := range cases {
+		tx := &ethaccessor.Transaction{From: sender, To: c.to, Input: c.input}
+		if got := processor.IsValidEthTransferTransaction(tx); got != c.expect {
+			t.Errorf("%s: expect %t, got %t", c.name, c.expect, got)
+		}
+	}
+}
+
+func TestAbiProcessor_HandleEthTransferEdgeCases(t *testing.T) {
+	var transfers []*types.TransferEvent
+	watcher := &eventemitter.Watcher{Concurrent: false, Handle: func(input eventemitter.EventData) error {
+		transfers = append(transfers, input.(*types.TransferEvent))
+		return nil
+	}}
+	eventemitter.On(eventemitter.EthTransferEvent, watcher)
+	defer eventemitter.Un(eventemitter.EthTransferEvent, watcher)
+
+	owner := common.HexToAddress("0x1b978a1D302335a6F2Ebe4B8823B5E17c3C84135")
+	receipt := &ethaccessor.TransactionReceipt{
+		BlockNumber: *types.NewBigWithInt(5000000),
+		GasUsed:     *types.NewBigWithInt(21000),
+		Status:      types.NewBigWithInt(1),
+	}
+	processor := &AbiProcessor{}
+
+	// 创建合约
+	creation := &ethaccessor.Transaction{Hash: "0x01", From: owner.Hex(), Value: *types.NewBigWithInt(0), Input: "0x6060604052"}
+	if err := processor.handleEthTransfer(creation, receipt, big.NewInt(1520000000)); err != nil {
+		t.Fatalf("contract creation should be skipped without error:%s", err.Error())
+	}
+	if len(transfers) != 0 {
+		t.Fatalf("contract creation should not emit eth transfer, got %d", len(transfers))
+	}
+
+	self := &ethaccessor.Transaction{Hash: "0x02", From: owner.Hex(), To: owner.Hex(), Value: *types.NewBigWithInt(5)}
+	processor.handleEthTransfer(self, receipt, big.NewInt(1520000000))
+
+	send := &ethaccessor.Transaction{Hash: "0x03", From: owner.Hex(), To: "0xb1018949b241D76A1AB2094f473E9bEfeAbB5Ead", Value: *types.NewBigWithInt(5)}
+	processor.handleEthTransfer(send, receipt, big.NewInt(1520000000))
+
+	if len(transfers) != 2 {
+		t.Fatalf("expect 2 eth transfers, got %d", len(transfers))
+	}
+	if !transfers[0].SelfTransfer || transfers[0].Receiver != owner {
+		t.Fatalf("transfer to sender itself should be flagged as self transfer")
+	}
+	if transfers[1].SelfTransfer {
+		t.Fatalf("transfer to other account should not be flagged as self transfer")
+	}
+}
+
+func TestAbiProcessor_HandleRingMinedEventSettledCost(t *testing.T) {
+	lrc, weth := setupMarketTokens()
+
+	seller := dao.Order{OrderHash: common.HexToHash("0x01").Hex(), Owner: "0x1b978a1D302335a6F2Ebe4B8823B5E17c3C84135", TokenS: lrc.Protocol.Hex(), TokenB: weth.Protocol.Hex()}
+	buyer := dao.Order{OrderHash: common.HexToHash("0x02").Hex(), Owner: "0xb1018949b241D76A1AB2094f473E9bEfeAbB5Ead", TokenS: weth.Protocol.Hex(), TokenB: lrc.Protocol.Hex()}
+	processor := &AbiProcessor{db: &mockRdsService{orders: map[string]dao.Order{
+		seller.OrderHash: seller,
+		buyer.OrderHash:  buyer,
+	}}}
+
+	var ringmined []*types.RingMinedEvent
+	ringWatcher := &eventemitter.Watcher{Concurrent: false, Handle: func(input eventemitter.EventData) error {
+		ringmined = append(ringmined, input.(*types.RingMinedEvent))
+		return nil
+	}}
+	eventemitter.On(eventemitter.RingMined, ringWatcher)
+	defer eventemitter.Un(eventemitter.RingMined, ringWatcher)
+
+	var costs []*types.RingSettledCostEvent
+	costWatcher := &eventemitter.Watcher{Concurrent: false, Handle: func(input eventemitter.EventData) error {
+		costs = append(costs, input.(*types.RingSettledCostEvent))
+		return nil
+	}}
+	eventemitter.On(eventemitter.MinerRingSettledCost, costWatcher)
+	defer eventemitter.Un(eventemitter.MinerRingSettledCost, costWatcher)
+
+	tx := &ethaccessor.Transaction{GasPrice: *types.NewBigWithInt(20000000000)}
+	receipt := &ethaccessor.TransactionReceipt{GasUsed: *types.NewBigWithInt(350000)}
+	data := ringMinedEventData([]dao.Order{seller, buyer})
+	data.GasUsed = receipt.GasUsed.BigInt()
+	data.GasPrice = tx.GasPrice.BigInt()
+	processor.handleRingMinedEvent(data)
+
+	expect, _ := new(big.Int).SetString("7000000000000000", 0)
+	if len(ringmined) != 1 || ringmined[0].GasCost.Cmp(expect) != 0 {
+		t.Fatalf("ringmined should carry gas cost %s", expect.String())
+	}
+	if len(costs) != 1 {
+		t.Fatalf("expect 1 ring settled cost event, got %d", len(costs))
+	}
+	cost := costs[0]
+	if cost.Ringhash != common.HexToHash("0x1234") || cost.FillCount != 2 || cost.GasCost.Cmp(expect) != 0 {
+		t.Fatalf("unexpected settled cost ringhash:%s fills:%d cost:%s", cost.Ringhash.Hex(), cost.FillCount, cost.GasCost.String())
+	}
+	if cost.GasUsed.Int64() != 350000 || cost.GasPrice.Int64() != 20000000000 {
+		t.Fatalf("settled cost should carry gas used and price, got %s %s", cost.GasUsed.String(), cost.GasPrice.String())
+	}
+}
+
+func TestAbiProcessor_HandleRingMinedEventUnknownFill(t *testing.T) {
+	lrc, weth := setupMarketTokens()
+
+	known := dao.Order{OrderHash: common.HexToHash("0x01").Hex(), Owner: "0x1b978a1D302335a6F2Ebe4B8823B5E17c3C84135", TokenS: lrc.Protocol.Hex(), TokenB: weth.Protocol.Hex()}
+	unknown := dao.Order{OrderHash: common.HexToHash("0x02").Hex(), Owner: "0xb1018949b241D76A1AB2094f473E9bEfeAbB5Ead", TokenS: weth.Protocol.Hex(), TokenB: lrc.Protocol.Hex()}
+	processor := &AbiProcessor{db: &mockRdsService{orders: map[string]dao.Order{
+		known.OrderHash: known,
+	}}}
+
+	var unknownFills []*types.OrderFilledEvent
+	watcher := &eventemitter.Watcher{Concurrent: false, Handle: func(input eventemitter.EventData) error {
+		unknownFills = append(unknownFills, input.(*types.OrderFilledEvent))
+		return nil
+	}}
+	eventemitter.On(eventemitter.OrderManagerUnknownFill, watcher)
+	defer eventemitter.Un(eventemitter.OrderManagerUnknownFill, watcher)
+
+	fills := collectFills(t, func() {
+		processor.handleRingMinedEvent(ringMinedEventData([]dao.Order{known, unknown}))
+	})
+
+	if len(fills) != 1 || fills[0].OrderHash.Hex() != known.OrderHash {
+		t.Fatalf("expect only known order filled, got %d fills", len(fills))
+	}
+	if fills[0].TokenS != lrc.Protocol || fills[0].TokenB != weth.Protocol {
+		t.Fatalf("known fill should be matched with order tokens")
+	}
+
+	if len(unknownFills) != 1 {
+		t.Fatalf("expect 1 unknown fill, got %d", len(unknownFills))
+	}
+	fill := unknownFills[0]
+	if fill.OrderHash.Hex() != unknown.OrderHash || fill.Ringhash != common.HexToHash("0x1234") {
+		t.Fatalf("unknown fill should carry raw order hash and ringhash, got %s %s", fill.OrderHash.Hex(), fill.Ringhash.Hex())
+	}
+	if fill.TokenS != weth.Protocol || fill.Market != "" {
+		t.Fatalf("unknown fill should keep raw on-chain tokenS and no market, got %s %s", fill.TokenS.Hex(), fill.Market)
+	}
+	if fill.AmountS == nil || fill.AmountB == nil {
+		t.Fatalf("unknown fill should carry on-chain amounts")
+	}
+}
+
+func TestAbiProcessor_RegisterEventDeduplicate(t *testing.T) {
+	cfg := config.LoadConfig("../config/relay.toml")
+	erc20Abi, err := ethaccessor.NewAbi(cfg.Common.Erc20Abi)
+	if err != nil {
+		t.Fatal(err)
+	}
+	wethAbi, err := ethaccessor.NewAbi(cfg.Common.WethAbi)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	processor := &AbiProcessor{events: make(map[common.Hash]EventData), watchers: make(map[string]*eventemitter.Watcher)}
+	handled := make(map[string]int)
+	registered := make(map[string]*eventemitter.Watcher)
+	defer func() {
+		for topic, watcher := range registered {
+			eventemitter.Un(topic, watcher)
+		}
+	}()
+	register := func(cabi *abi.ABI, name string) {
+		for _, event := range cabi.Events {
+			contract := newEventData(&event, cabi)
+			watcher := &eventemitter.Watcher{Concurrent: false, Handle: func(input eventemitter.EventData) error {
+				handled[name]++
+				return nil
+			}}
+			if processor.registerEvent(contract, watcher) {
+				registered[contract.Id.Hex()] = watcher
+			}
+		}
+	}
+	register(erc20Abi, "erc20")
+	register(wethAbi, "weth")
+
+	transfer := erc20Abi.Events[ethaccessor.EVENT_TRANSFER]
+	if wethAbi.Events[ethaccessor.EVENT_TRANSFER].Id() != transfer.Id() {
+		t.Fatalf("weth and erc20 transfer should share the same event id")
+	}
+	if contract := processor.events[transfer.Id()]; contract.CAbi != erc20Abi {
+		t.Fatalf("transfer event should keep the first registration from erc20 abi")
+	}
+	if _, ok := processor.events[wethAbi.Events[ethaccessor.EVENT_WETH_DEPOSIT].Id()]; !ok {
+		t.Fatalf("weth only event should still be registered")
+	}
+
+	evtLog := ethaccessor.Log{Topics: []string{transfer.Id().Hex()}}
+	event, ok := processor.GetEvent(evtLog)
+	if !ok {
+		t.Fatalf("weth transfer log should be supported")
+	}
+	eventemitter.Emit(event.Id.Hex(), event)
+
+	if handled["erc20"] != 1 || handled["weth"] != 0 {
+		t.Fatalf("weth transfer log should fire exactly one handler, got erc20:%d weth:%d", handled["erc20"], handled["weth"])
+	}
+}
+
+func TestAbiProcessor_HandleRingMinedEventSlippage(t *testing.T) {
+	lrc, weth := setupMarketTokens()
+
+	// 卖1000lrc至少换10weth, 用2weth买至少80lrc
+	seller := dao.Order{OrderHash: common.HexToHash("0x01").Hex(), Owner: "0x1b978a1D302335a6F2Ebe4B8823B5E17c3C84135", TokenS: lrc.Protocol.Hex(), TokenB: weth.Protocol.Hex(), AmountS: "1000", AmountB: "10"}
+	buyer := dao.Order{OrderHash: common.HexToHash("0x02").Hex(), Owner: "0xb1018949b241D76A1AB2094f473E9bEfeAbB5Ead", TokenS: weth.Protocol.Hex(), TokenB: lrc.Protocol.Hex(), AmountS: "2", AmountB: "80"}
+	processor := &AbiProcessor{db: &mockRdsService{orders: map[string]dao.Order{
+		seller.OrderHash: seller,
+		buyer.OrderHash:  buyer,
+	}}}
+
+	// 成交: 100lrc换2weth
+	sellerFill, buyerFill := seller, buyer
+	sellerFill.AmountS, buyerFill.AmountS = "100", "2"
+	fills := collectFills(t, func() {
+		processor.handleRingMinedEvent(ringMinedEventData([]dao.Order{sellerFill, buyerFill}))
+	})
+	if len(fills) != 2 {
+		t.Fatalf("expect 2 fills, got %d", len(fills))
+	}
+	if fills[0].Slippage != 1 {
+		t.Fatalf("seller filled at twice the limit price, expect improvement 1, got %f", fills[0].Slippage)
+	}
+	if fills[1].Slippage != 0.25 {
+		t.Fatalf("buyer got 100lrc against limit 80lrc, expect improvement 0.25, got %f", fills[1].Slippage)
+	}
+
+	// 差于限价时为负
+	worse := &types.OrderFilledEvent{AmountS: big.NewInt(1000), AmountB: big.NewInt(1)}
+	if slippage, ok := fillSlippage(worse, &seller); !ok || slippage != -0.9 {
+		t.Fatalf("expect slippage -0.9, got %f", slippage)
+	}
+	if _, ok := fillSlippage(worse, &dao.Order{AmountS: "0", AmountB: "10"}); ok {
+		t.Fatalf("order without valid amount should be skipped")
+	}
+}
+
+func TestFillNormalize_SixDecimals(t *testing.T) {
+	_, weth := setupMarketTokens()
+
+	usdc := types.Token{Protocol: common.HexToAddress("0xA0b86991c6218b36c1d19D4a2e9Eb0cE3606eB48"), Symbol: "USDC", Decimals: big.NewInt(1000000)}
+	if err := util.AddToken(usdc); err != nil {
+		t.Fatal(err)
+	}
+	defer func() { setupMarketTokens() }()
+
+	// 卖出1500.5 usdc买入1 weth, 手续费2.5 lrc
+	amountB, _ := new(big.Int).SetString("1000000000000000000", 0)
+	lrcFee, _ := new(big.Int).SetString("2500000000000000000", 0)
+	fill := &types.OrderFilledEvent{
+		TokenS:  usdc.Protocol,
+		TokenB:  weth.Protocol,
+		AmountS: big.NewInt(1500500000),
+		AmountB: amountB,
+		LrcFee:  lrcFee,
+		Market:  "WETH-USDC",
+	}
+	fillNormalize(fill)
+
+	if fill.NormalizedAmountS != 1500.5 || fill.NormalizedAmountB != 1 || fill.NormalizedLrcFee != 2.5 {
+		t.Fatalf("unexpected normalized amounts, amountS:%f amountB:%f lrcFee:%f", fill.NormalizedAmountS, fill.NormalizedAmountB, fill.NormalizedLrcFee)
+	}
+	if fill.Price != 1500.5 {
+		t.Fatalf("expect price 1500.5 usdc per weth, got %f", fill.Price)
+	}
+	if fill.AmountS.Cmp(big.NewInt(1500500000)) != 0 || fill.LrcFee.Cmp(lrcFee) != 0 {
+		t.Fatalf("raw amounts should be kept")
+	}
+
+	// 精度未知的token不转换
+	unknown := &types.OrderFilledEvent{TokenS: common.HexToAddress("0x01"), TokenB: weth.Protocol, AmountS: big.NewInt(100), AmountB: amountB, Market: "WETH-USDC"}
+	fillNormalize(unknown)
+	if unknown.NormalizedAmountS != 0 || unknown.Price != 0 || unknown.NormalizedAmountB != 1 {
+		t.Fatalf("unknown token should not be normalized")
+	}
+}
+
+func TestAbiProcessor_HandleRingMinedEventFeeToken(t *testing.T) {
+	lrc, weth := setupMarketTokens()
+
+	seller := dao.Order{OrderHash: common.HexToHash("0x01").Hex(), Owner: "0x1b978a1D302335a6F2Ebe4B8823B5E17c3C84135", TokenS: lrc.Protocol.Hex(), TokenB: weth.Protocol.Hex(), AmountS: "1000", AmountB: "10"}
+	buyer := dao.Order{OrderHash: common.HexToHash("0x02").Hex(), Owner: "0xb1018949b241D76A1AB2094f473E9bEfeAbB5Ead", TokenS: weth.Protocol.Hex(), TokenB: lrc.Protocol.Hex(), AmountS: "10", AmountB: "1000"}
+	processor := &AbiProcessor{db: &mockRdsService{orders: map[string]dao.Order{
+		seller.OrderHash: seller,
+		buyer.OrderHash:  buyer,
+	}}}
+
+	// seller以splitB(weth)支付手续费, buyer无分润时为lrc
+	data := ringMinedEventData([]dao.Order{seller, buyer})
+	evt := data.Event.(*ethaccessor.RingMinedEvent)
+	var splitB [32]uint8
+	for i := range splitB {
+		splitB[i] = 0xff
+	}
+	splitB[31] = 0xfb
+	evt.OrderInfoList[5] = bytes32(big.NewInt(0).Bytes())
+	evt.OrderInfoList[6] = splitB
+	evt.OrderInfoList[13] = bytes32(big.NewInt(0).Bytes())
+
+	fills := collectFills(t, func() {
+		processor.handleRingMinedEvent(data)
+	})
+	if len(fills) != 2 {
+		t.Fatalf("expect 2 fills, got %d", len(fills))
+	}
+	if fills[0].SplitB.Int64() != 5 || fills[0].FeeToken != weth.Protocol {
+		t.Fatalf("seller fill should pay fee in weth, got %s", fills[0].FeeToken.Hex())
+	}
+	if fills[1].FeeToken != lrc.Protocol {
+		t.Fatalf("buyer fill should pay fee in lrc, got %s", fills[1].FeeToken.Hex())
+	}
+}
+
+func TestFillNetAmounts(t *testing.T) {
+	lrc, weth := setupMarketTokens()
+
+	// 买入1000 lrc, 分润10 lrc, 以lrc支付手续费25
+	fill := &types.OrderFilledEvent{
+		TokenS:  weth.Protocol,
+		TokenB:  lrc.Protocol,
+		AmountS: big.NewInt(10),
+		AmountB: big.NewInt(1000),
+		SplitB:  big.NewInt(10),
+		LrcFee:  big.NewInt(25),
+	}
+	fillNetAmounts(fill)
+
+	fee := new(big.Int).Add(fill.SplitB, fill.LrcFee)
+	if fill.GrossAmountB.Cmp(fill.AmountB) != 0 || new(big.Int).Sub(fill.GrossAmountB, fee).Cmp(fill.NetAmountB) != 0 {
+		t.Fatalf("gross minus fee should equal net, gross:%s net:%s", fill.GrossAmountB.String(), fill.NetAmountB.String())
+	}
+	if fill.NetAmountB.Int64() != 965 {
+		t.Fatalf("expect net 965, got %s", fill.NetAmountB.String())
+	}
+
+	// 买入token不是lrc时lrcFee不从买入token中扣除
+	fill.TokenS, fill.TokenB = lrc.Protocol, weth.Protocol
+	fillNetAmounts(fill)
+	if fill.NetAmountB.Int64() != 990 {
+		t.Fatalf("expect net 990 while buying weth, got %s", fill.NetAmountB.String())
+	}
+	if fill.AmountB.Int64() != 1000 {
+		t.Fatalf("raw amountB should be kept")
+	}
+}
+
+func TestAbiProcessor_UnpackErrorEvent(t *testing.T) {
+	cfg := config.LoadConfig("../config/relay.toml")
+	erc20Abi, err := ethaccessor.NewAbi(cfg.Common.Erc20Abi)
+	if err != nil {
+		t.Fatal(err)
+	}
+	input, err := erc20Abi.Pack(ethaccessor.METHOD_TRANSFER, common.HexToAddress("0xb1018949b241D76A1AB2094f473E9bEfeAbB5Ead"), big.NewInt(100))
+	if err != nil {
+		t.Fatal(err)
+	}
+	method := erc20Abi.Methods[ethaccessor.METHOD_TRANSFER]
+
+	var errs []*types.ExtractorUnpackErrorEvent
+	errWatcher := &eventemitter.Watcher{Concurrent: false, Handle: func(input eventemitter.EventData) error {
+		errs = append(errs, input.(*types.ExtractorUnpackErrorEvent))
+		return nil
+	}}
+	eventemitter.On(eventemitter.ExtractorUnpackError, errWatcher)
+	defer eventemitter.Un(eventemitter.ExtractorUnpackError, errWatcher)
+
+	var transfers int
+	transferWatcher := &eventemitter.Watcher{Concurrent: false, Handle: func(input eventemitter.EventData) error {
+		transfers++
+		return nil
+	}}
+	eventemitter.On(eventemitter.Transfer, transferWatcher)
+	defer eventemitter.Un(eventemitter.Transfer, transferWatcher)
+
+	processor := &AbiProcessor{}
+	full := common.ToHex(input)
+	// 截断的calldata: 参数不完整, 奇数长度, 只有部分method id
+	for i, calldata := range []string{full[:len(full)-40], full[:len(full)-1], full[:6]} {
+		contract := newMethodData(&method, erc20Abi)
+		contract.Method = &ethaccessor.TransferMethod{}
+		contract.Input = calldata
+		contract.TxHash = common.BigToHash(big.NewInt(int64(i + 1)))
+		contract.BlockNumber = big.NewInt(100)
+
+		if err := processor.handleTransferMethod(contract); err != nil {
+			t.Fatalf("unpack failure should not block the pipeline, got %s", err.Error())
+		}
+	}
+
+	if transfers != 0 {
+		t.Fatalf("malformed transfer should not be emitted, got %d", transfers)
+	}
+	if len(errs) != 3 {
+		t.Fatalf("expect 3 unpack error events, got %d", len(errs))
+	}
+	for i, evt := range errs {
+		if evt.TxHash != common.BigToHash(big.NewInt(int64(i+1))) || evt.Name != ethaccessor.METHOD_TRANSFER || evt.Err == nil || evt.BlockNumber.Int64() != 100 {
+			t.Fatalf("unexpected unpack error event tx:%s name:%s err:%v", evt.TxHash.Hex(), evt.Name, evt.Err)
+		}
+	}
+}
+
+func TestAbiProcessor_HandleEthTransferGasPrice(t *testing.T) {
+	processor := &AbiProcessor{}
+
+	var transfers []*types.TransferEvent
+	watcher := &eventemitter.Watcher{Concurrent: false, Handle: func(input eventemitter.EventData) error {
+		transfers = append(transfers, input.(*types.TransferEvent))
+		return nil
+	}}
+	eventemitter.On(eventemitter.EthTransferEvent, watcher)
+	defer eventemitter.Un(eventemitter.EthTransferEvent, watcher)
+
+	cases := []struct {
+		name           string
+		tx             string
+		receipt        string
+		gasPrice       int64
+		maxFee         int64
+		maxPriorityFee int64
+	}{
+		{
+			name:     "legacy",
+			tx:       `{"hash":"0x01","from":"0x1b978a1D302335a6F2Ebe4B8823B5E17c3C84135","to":"0xb1018949b241D76A1AB2094f473E9bEfeAbB5Ead","value":"0x5","gasPrice":"0x4a817c800","gas":"0x5208"}`,
+			receipt:  `{"gasUsed":"0x5208","status":"0x1"}`,
+			gasPrice: 20000000000,
+		},
+		{
+			name:           "eip1559",
+			tx:             `{"hash":"0x02","type":"0x2","from":"0x1b978a1D302335a6F2Ebe4B8823B5E17c3C84135","to":"0xb1018949b241D76A1AB2094f473E9bEfeAbB5Ead","value":"0x5","gasPrice":"0x6fc23ac00","maxFeePerGas":"0x6fc23ac00","maxPriorityFeePerGas":"0x77359400","gas":"0x5208"}`,
+			receipt:        `{"gasUsed":"0x5208","status":"0x1","effectiveGasPrice":"0x3b9aca00"}`,
+			gasPrice:       1000000000,
+			maxFee:         30000000000,
+			maxPriorityFee: 2000000000,
+		},
+	}
+
+	for _, c := range cases {
+		var (
+			tx      ethaccessor.Transaction
+			receipt ethaccessor.TransactionReceipt
+		)
+		if err := json.Unmarshal([]byte(c.tx), &tx); err != nil {
+			t.Fatal(err)
+		}
+		if err := json.Unmarshal([]byte(c.receipt), &receipt); err != nil {
+			t.Fatal(err)
+		}
+
+		transfers = nil
+		processor.handleEthTransfer(&tx, &receipt, big.NewInt(1520000000))
+		if len(transfers) != 1 {
+			t.Fatalf("%s: expect 1 eth transfer, got %d", c.name, len(transfers))
+		}
+		evt := transfers[0]
+		if evt.GasPrice.Int64() != c.gasPrice {
+			t.Fatalf("%s: expect gas price %d, got %s", c.name, c.gasPrice, evt.GasPrice.String())
+		}
+		if fee := evt.Fee(); fee.Int64() != c.gasPrice*21000 {
+			t.Fatalf("%s: fee should use effective gas price, got %s", c.name, fee.String())
+		}
+		if c.maxFee == 0 {
+			if evt.MaxFeePerGas != nil || evt.MaxPriorityFeePerGas != nil {
+				t.Fatalf("%s: legacy tx should not carry eip1559 fields", c.name)
+			}
+		} else if evt.MaxFeePerGas.Int64() != c.maxFee || evt.MaxPriorityFeePerGas.Int64() != c.maxPriorityFee {
+			t.Fatalf("%s: unexpected max fee %s priority fee %s", c.name, evt.MaxFeePerGas.String(), evt.MaxPriorityFeePerGas.String())
+		}
+	}
+
+	// pending交易没有receipt, 使用tx.gasPrice
+	var pending ethaccessor.Transaction
+	json.Unmarshal([]byte(cases[1].tx), &pending)
+	var info types.TxInfo
+	setGasPrice(&info, &pending, nil)
+	if info.GasPrice.Int64() != 30000000000 {
+		t.Fatalf("pending tx should fall back to tx gas price, got %s", info.GasPrice.String())
+	}
+}
+
+func TestAbiProcessor_PermitApprove(t *testing.T) {
+	initializeAccessorAbi(t)
+
+	var (
+		owner   = common.HexToAddress("0x1b978a1D302335a6F2Ebe4B8823B5E17c3C84135")
+		spender = common.HexToAddress("0x17233e07c67d086464fD408148c3ABB56245FA64")
+		token   = common.HexToAddress("0xEF68e7C694F40c8202821eDF525dE3782458639f")
+		relayer = common.HexToAddress("0x4Ec94E1007605D70a86279370ec5e4b755295eDA")
+	)
+
+	var topics []string
+	var permits []*types.PermitApprovalEvent
+	approveWatcher := &eventemitter.Watcher{Concurrent: false, Handle: func(input eventemitter.EventData) error {
+		topics = append(topics, eventemitter.Approve)
+		return nil
+	}}
+	permitWatcher := &eventemitter.Watcher{Concurrent: false, Handle: func(input eventemitter.EventData) error {
+		topics = append(topics, eventemitter.PermitApprove)
+		permits = append(permits, input.(*types.PermitApprovalEvent))
+		return nil
+	}}
+	eventemitter.On(eventemitter.Approve, approveWatcher)
+	defer eventemitter.Un(eventemitter.Approve, approveWatcher)
+	eventemitter.On(eventemitter.PermitApprove, permitWatcher)
+	defer eventemitter.Un(eventemitter.PermitApprove, permitWatcher)
+
+	permitInput := func(deadline *big.Int) string {
+		words := [][]byte{
+			owner.Bytes(),
+			spender.Bytes(),
+			big.NewInt(100).Bytes(),
+			deadline.Bytes(),
+			{27},
+			common.HexToHash("0x01").Bytes(),
+			common.HexToHash("0x02").Bytes(),
+		}
+		input := "0xd505accf"
+		for _, v := range words {
+			input += common.Bytes2Hex(common.LeftPadBytes(v, 32))
+		}
+		return input
+	}
+
+	// 成功的permit由Approval事件发出, relayer发送交易, owner为签名者
+	processor := &AbiProcessor{}
+	approval := EventData{Event: &ethaccessor.ApprovalEvent{Value: big.NewInt(100)}}
+	approval.Topics = []string{"0x", common.BytesToHash(owner.Bytes()).Hex(), common.BytesToHash(spender.Bytes()).Hex()}
+	approval.Protocol = token
+	approval.From = relayer
+	approval.Identify = ethaccessor.METHOD_PERMIT
+	approval.Input = permitInput(big.NewInt(1520000000))
+	approval.Status = types.TX_STATUS_SUCCESS
+	processor.handleApprovalEvent(approval)
+
+	if len(topics) != 2 || topics[0] != eventemitter.Approve || topics[1] != eventemitter.PermitApprove {
+		t.Fatalf("permit should be emitted after approve, got %v", topics)
+	}
+	if permits[0].Owner != owner || permits[0].Spender != spender || permits[0].Protocol != token || permits[0].Deadline != 1520000000 {
+		t.Fatalf("unexpected permit owner:%s, spender:%s, token:%s, deadline:%d", permits[0].Owner.Hex(), permits[0].Spender.Hex(), permits[0].Protocol.Hex(), permits[0].Deadline)
+	}
+
+	// 普通approve不发出PermitApprove
+	approval.Identify = ethaccessor.METHOD_APPROVE
+	processor.handleApprovalEvent(approval)
+	if len(permits) != 1 {
+		t.Fatalf("plain approval should not emit permit, got %d", len(permits))
+	}
+
+	// 失败的permit及不过期的deadline都不跟踪
+	method := MethodData{CAbi: ethaccessor.Erc20Abi(), Name: ethaccessor.METHOD_PERMIT, Method: &ethaccessor.PermitMethod{}}
+	method.Protocol = token
+	method.Input = permitInput(big.NewInt(1520000000))
+	method.Status = types.TX_STATUS_FAILED
+	processor.handlePermitMethod(method)
+
+	method.Input = permitInput(new(big.Int).Sub(new(big.Int).Lsh(big.NewInt(1), 256), big.NewInt(1)))
+	method.Status = types.TX_STATUS_SUCCESS
+	processor.handlePermitMethod(method)
+	if len(permits) != 1 {
+		t.Fatalf("failed permit or permit without deadline should not be tracked, got %d", len(permits))
+	}
+}
@@ -0,0 +1,124 @@
+/*
+
+  Copyright 2017 Loopring Project Ltd (Loopring Foundation).
+
+  Licensed under the Apache License, Version 2.0 (the "License");
+  you may not use this file except in compliance with the License.
+  You may obtain a copy of the License at
+
+  http://www.apache.org/licenses/LICENSE-2.0
+
+  Unless required by applicable law or agreed to in writing, software
+  distributed under the License is distributed on an "AS IS" BASIS,
+  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+  See the License for the specific language governing permissions and
+  limitations under the License.
+
+*/
+
+package extractor
+
+import (
+	"github.com/Loopring/relay/types"
+	"github.com/ethereum/go-ethereum/common"
+	"math/big"
+	"sync"
+)
+
+type logKey struct {
+	txHash   common.Hash
+	logIndex int64
+}
+
+// 扫块层重试时同一日志可能被重复投递, 按(TxHash, LogIndex)去重, 只保留最近window个区块的记录
+type seenLogs struct {
+	mtx    sync.Mutex
+	window int64
+	latest int64
+	seen   map[logKey]int64
+}
+
+func newSeenLogs(window int64) *seenLogs {
+	if window <= 0 {
+		return nil
+	}
+	return &seenLogs{window: window, seen: make(map[logKey]int64)}
+}
+
+// firstSeen 窗口内已处理过的日志返回false
+func (s *seenLogs) firstSeen(txhash common.Hash, logIndex, blockNumber int64) bool {
+	if s == nil {
+		return true
+	}
+
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+
+	key := logKey{txHash: txhash, logIndex: logIndex}
+	if _, ok := s.seen[key]; ok {
+		return false
+	}
+	s.seen[key] = blockNumber
+
+	if blockNumber > s.latest {
+		s.latest = blockNumber
+		for k, number := range s.seen {
+			if number <= s.latest-s.window {
+				delete(s.seen, k)
+			}
+		}
+	}
+	return true
+}
+
+// rollback 分叉后blockNumber之后的交易可能在新链上重新打包, 不能再被当作重复日志
+func (s *seenLogs) rollback(blockNumber int64) {
+	if s == nil {
+		return
+	}
+
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+
+	for k, number := range s.seen {
+		if number > blockNumber {
+			delete(s.seen, k)
+		}
+	}
+	if s.latest > blockNumber {
+		s.latest = blockNumber
+	}
+}
+
+// 同一交易内授权数量不变的重复Approval(如token在approve中重复发出事件)只发出一次,
+// 不同交易即使数量相同也是独立的approve, 仍需发出供txmanager记录
+type txApprovals struct {
+	mtx      sync.Mutex
+	txHash   common.Hash
+	logIndex int64
+	amounts  map[string]*big.Int
+}
+
+// unchanged 当前交易中已发出过相同owner/token/spender/amount的授权时返回true,
+// 新交易或同一交易被重新处理(logIndex回退)时清空之前的记录
+func (a *txApprovals) unchanged(evt *types.ApprovalEvent) bool {
+	if evt.Amount == nil {
+		return false
+	}
+
+	a.mtx.Lock()
+	defer a.mtx.Unlock()
+
+	if a.amounts == nil || a.txHash != evt.TxHash || evt.TxLogIndex <= a.logIndex {
+		a.txHash = evt.TxHash
+		a.amounts = make(map[string]*big.Int)
+	}
+	a.logIndex = evt.TxLogIndex
+
+	key := evt.Owner.Hex() + evt.Protocol.Hex() + evt.Spender.Hex()
+	if last, ok := a.amounts[key]; ok && last.Cmp(evt.Amount) == 0 {
+		return true
+	}
+	a.amounts[key] = new(big.Int).Set(evt.Amount)
+	return false
+}
@@ -0,0 +1,118 @@
+/*
+
+  Copyright 2017 Loopring Project Ltd (Loopring Foundation).
+
+  Licensed under the Apache License, Version 2.0 (the "License");
+  you may not use this file except in compliance with the License.
+  You may obtain a copy of the License at
+
+  http://www.apache.org/licenses/LICENSE-2.0
+
+  Unless required by applicable law or agreed to in writing, software
+  distributed under the License is distributed on an "AS IS" BASIS,
+  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+  See the License for the specific language governing permissions and
+  limitations under the License.
+
+*/
+
+package extractor
+
+import (
+	"github.com/Loopring/relay/config"
+	"github.com/Loopring/relay/dao"
+	"github.com/Loopring/relay/ethaccessor"
+	"github.com/Loopring/relay/eventemiter"
+	"github.com/Loopring/relay/types"
+	"github.com/ethereum/go-ethereum/common"
+	"math/big"
+	"testing"
+)
+
+func TestExtractorServiceImpl_DuplicateLogDelivery(t *testing.T) {
+	initializeAccessorAbi(t)
+	lrc, _ := setupMarketTokens()
+
+	processor := newAbiProcessor(&mockRdsService{}, &config.ExtractorOptions{EventDedupWindow: 5})
+	defer processor.Unload()
+
+	var (
+		sender        = common.HexToAddress("0x1b978a1D302335a6F2Ebe4B8823B5E17c3C84135")
+		receiver      = common.HexToAddress("0xb1018949b241D76A1AB2094f473E9bEfeAbB5Ead")
+		transferEvent = ethaccessor.Erc20Abi().Events[ethaccessor.EVENT_TRANSFER]
+	)
+	input, err := ethaccessor.Erc20Abi().Pack(ethaccessor.METHOD_TRANSFER, receiver, big.NewInt(100))
+	if err != nil {
+		t.Fatal(err)
+	}
+	transfer := func(index, number int64) (*ethaccessor.Transaction, *ethaccessor.TransactionReceipt) {
+		tx := &ethaccessor.Transaction{
+			Hash:        common.BigToHash(big.NewInt(index)).Hex(),
+			From:        sender.Hex(),
+			To:          lrc.Protocol.Hex(),
+			Input:       common.ToHex(input),
+			BlockNumber: *types.NewBigPtr(big.NewInt(number)),
+		}
+		receipt := &ethaccessor.TransactionReceipt{
+			Status:  types.NewBigPtr(big.NewInt(1)),
+			GasUsed: *types.NewBigPtr(big.NewInt(50000)),
+			Logs: []ethaccessor.Log{{
+				Address:  tx.To,
+				Topics:   []string{transferEvent.Id().Hex(), common.BytesToHash(sender.Bytes()).Hex(), common.BytesToHash(receiver.Bytes()).Hex()},
+				Data:     common.ToHex(common.LeftPadBytes(big.NewInt(100).Bytes(), 32)),
+				LogIndex: *types.NewBigPtr(big.NewInt(3)),
+			}},
+		}
+		return tx, receipt
+	}
+
+	var transfers []*types.TransferEvent
+	watcher := &eventemitter.Watcher{Concurrent: false, Handle: func(input eventemitter.EventData) error {
+		transfers = append(transfers, input.(*types.TransferEvent))
+		return nil
+	}}
+	eventemitter.On(eventemitter.Transfer, watcher)
+	defer eventemitter.Un(eventemitter.Transfer, watcher)
+
+	l := &ExtractorServiceImpl{processor: processor}
+
+	// 同一日志投递两次只发出一次
+	tx, receipt := transfer(1, 10)
+	l.ProcessMinedTransaction(tx, receipt, big.NewInt(1520000010))
+	l.ProcessMinedTransaction(tx, receipt, big.NewInt(1520000010))
+	if len(transfers) != 1 {
+		t.Fatalf("duplicate log should be emitted once, got %d", len(transfers))
+	}
+
+	// 超出窗口后按区块淘汰
+	next, nextReceipt := transfer(2, 15)
+	l.ProcessMinedTransaction(next, nextReceipt, big.NewInt(1520000015))
+	l.ProcessMinedTransaction(tx, receipt, big.NewInt(1520000010))
+	if len(transfers) != 3 {
+		t.Fatalf("log out of window should be processed again, got %d transfers", len(transfers))
+	}
+
+	// 分叉后同一交易在新链上重新打包, 分叉点之前的日志仍然去重
+	var (
+		root     = &types.Block{BlockNumber: big.NewInt(14), BlockHash: common.HexToHash("0x0e"), ParentHash: common.HexToHash("0x0d")}
+		orphaned = &types.Block{BlockNumber: big.NewInt(15), BlockHash: common.HexToHash("0x0f"), ParentHash: root.BlockHash}
+		replaced = &types.Block{BlockNumber: big.NewInt(15), BlockHash: common.HexToHash("0x1f"), ParentHash: root.BlockHash}
+	)
+	rootModel := &dao.Block{}
+	rootModel.ConvertDown(root)
+	l.detector = &forkDetector{db: &reorgRdsService{blocks: map[common.Hash]*dao.Block{root.BlockHash: rootModel}}, latestBlock: orphaned}
+	if err := l.ForkProcess(replaced); err == nil {
+		t.Fatalf("fork should be detected")
+	}
+	if l.startBlockNumber.Int64() != 15 {
+		t.Fatalf("extractor should restart after fork block, got %d", l.startBlockNumber.Int64())
+	}
+	l.ProcessMinedTransaction(tx, receipt, big.NewInt(1520000010))
+	if len(transfers) != 3 {
+		t.Fatalf("log before fork block should still be deduplicated, got %d transfers", len(transfers))
+	}
+	l.ProcessMinedTransaction(next, nextReceipt, big.NewInt(1520000015))
+	if len(transfers) != 4 {
+		t.Fatalf("log after fork block should be processed again, got %d transfers", len(transfers))
+	}
+}
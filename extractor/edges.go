@@ -0,0 +1,80 @@
+/*
+
+  Copyright 2017 Loopring Project Ltd (Loopring Foundation).
+
+  Licensed under the Apache License, Version 2.0 (the "License");
+  you may not use this file except in compliance with the License.
+  You may obtain a copy of the License at
+
+  http://www.apache.org/licenses/LICENSE-2.0
+
+  Unless required by applicable law or agreed to in writing, software
+  distributed under the License is distributed on an "AS IS" BASIS,
+  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+  See the License for the specific language governing permissions and
+  limitations under the License.
+
+*/
+
+package extractor
+
+import (
+	"github.com/Loopring/relay/eventemiter"
+	"github.com/Loopring/relay/types"
+	"github.com/ethereum/go-ethereum/common"
+)
+
+// 将token及eth转账统一为from->to的边, 供分析/合规构建转账图
+type transferEdgeEmitter struct {
+	watchers map[string]*eventemitter.Watcher
+}
+
+func newTransferEdgeEmitter() *transferEdgeEmitter {
+	return &transferEdgeEmitter{watchers: make(map[string]*eventemitter.Watcher)}
+}
+
+func (e *transferEdgeEmitter) Start() {
+	e.watchers[eventemitter.Transfer] = &eventemitter.Watcher{Concurrent: false, Handle: e.handleTokenTransfer}
+	e.watchers[eventemitter.ContractTransfer] = &eventemitter.Watcher{Concurrent: false, Handle: e.handleTokenTransfer}
+	e.watchers[eventemitter.EthTransferEvent] = &eventemitter.Watcher{Concurrent: false, Handle: e.handleEthTransfer}
+
+	for topic, watcher := range e.watchers {
+		eventemitter.On(topic, watcher)
+	}
+}
+
+func (e *transferEdgeEmitter) Stop() {
+	for topic, watcher := range e.watchers {
+		eventemitter.Un(topic, watcher)
+	}
+	e.watchers = make(map[string]*eventemitter.Watcher)
+}
+
+func (e *transferEdgeEmitter) handleTokenTransfer(input eventemitter.EventData) error {
+	evt := input.(*types.TransferEvent)
+	e.emit(evt, evt.Protocol)
+	return nil
+}
+
+func (e *transferEdgeEmitter) handleEthTransfer(input eventemitter.EventData) error {
+	evt := input.(*types.TransferEvent)
+	e.emit(evt, types.NilAddress)
+	return nil
+}
+
+// 只输出已成功且金额不为0的转账, 自转账不构成边
+func (e *transferEdgeEmitter) emit(evt *types.TransferEvent, token common.Address) {
+	if evt.Status != types.TX_STATUS_SUCCESS || evt.Amount == nil || evt.Amount.Sign() == 0 || evt.Sender == evt.Receiver {
+		return
+	}
+
+	eventemitter.Emit(eventemitter.TransferEdge, &types.TransferEdgeEvent{
+		From:        evt.Sender,
+		To:          evt.Receiver,
+		Token:       token,
+		Amount:      evt.Amount,
+		BlockNumber: evt.BlockNumber,
+		TxHash:      evt.TxHash,
+		LogIndex:    evt.TxLogIndex,
+	})
+}
@@ -0,0 +1,85 @@
+/*
+
+  Copyright 2017 Loopring Project Ltd (Loopring Foundation).
+
+  Licensed under the Apache License, Version 2.0 (the "License");
+  you may not use this file except in compliance with the License.
+  You may obtain a copy of the License at
+
+  http://www.apache.org/licenses/LICENSE-2.0
+
+  Unless required by applicable law or agreed to in writing, software
+  distributed under the License is distributed on an "AS IS" BASIS,
+  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+  See the License for the specific language governing permissions and
+  limitations under the License.
+
+*/
+
+package extractor
+
+import (
+	"github.com/Loopring/relay/eventemiter"
+	"github.com/Loopring/relay/types"
+	"github.com/ethereum/go-ethereum/common"
+	"math/big"
+	"testing"
+)
+
+func TestTransferEdgeEmitter(t *testing.T) {
+	emitter := newTransferEdgeEmitter()
+	emitter.Start()
+	defer emitter.Stop()
+
+	var edges []*types.TransferEdgeEvent
+	watcher := &eventemitter.Watcher{Concurrent: false, Handle: func(input eventemitter.EventData) error {
+		edges = append(edges, input.(*types.TransferEdgeEvent))
+		return nil
+	}}
+	eventemitter.On(eventemitter.TransferEdge, watcher)
+	defer eventemitter.Un(eventemitter.TransferEdge, watcher)
+
+	var (
+		alice = common.HexToAddress("0x1b978a1D302335a6F2Ebe4B8823B5E17c3C84135")
+		bob   = common.HexToAddress("0xb1018949b241D76A1AB2094f473E9bEfeAbB5Ead")
+		vault = common.HexToAddress("0x4Ec94E1007605D70a86279370ec5e4b755295eDA")
+		lrc   = common.HexToAddress("0xcd36128815ebe0b44d0374649bad2721b8751bef")
+	)
+
+	transfer := func(topic string, sender, receiver common.Address, token common.Address, amount int64, status types.TxStatus, logIndex int64) {
+		evt := &types.TransferEvent{Sender: sender, Receiver: receiver, Amount: big.NewInt(amount)}
+		evt.Protocol = token
+		evt.Status = status
+		evt.BlockNumber = big.NewInt(200)
+		evt.TxHash = common.HexToHash("0x01")
+		evt.TxLogIndex = logIndex
+		eventemitter.Emit(topic, evt)
+	}
+
+	transfer(eventemitter.Transfer, alice, bob, lrc, 100, types.TX_STATUS_SUCCESS, 1)
+	transfer(eventemitter.EthTransferEvent, bob, alice, bob, 7, types.TX_STATUS_SUCCESS, 0)
+	transfer(eventemitter.ContractTransfer, vault, bob, lrc, 30, types.TX_STATUS_SUCCESS, 2)
+	// 失败, pending, 自转账以及0金额的转账不输出
+	transfer(eventemitter.Transfer, alice, vault, lrc, 50, types.TX_STATUS_FAILED, 3)
+	transfer(eventemitter.Transfer, alice, vault, lrc, 50, types.TX_STATUS_PENDING, 4)
+	transfer(eventemitter.EthTransferEvent, alice, alice, alice, 1, types.TX_STATUS_SUCCESS, 0)
+	transfer(eventemitter.Transfer, alice, vault, lrc, 0, types.TX_STATUS_SUCCESS, 5)
+
+	expect := []types.TransferEdgeEvent{
+		{From: alice, To: bob, Token: lrc, Amount: big.NewInt(100), LogIndex: 1},
+		{From: bob, To: alice, Token: types.NilAddress, Amount: big.NewInt(7), LogIndex: 0},
+		{From: vault, To: bob, Token: lrc, Amount: big.NewInt(30), LogIndex: 2},
+	}
+	if len(edges) != len(expect) {
+		t.Fatalf("expect %d edges, got %d", len(expect), len(edges))
+	}
+	for i, v := range expect {
+		got := edges[i]
+		if got.From != v.From || got.To != v.To || got.Token != v.Token || got.Amount.Cmp(v.Amount) != 0 || got.LogIndex != v.LogIndex {
+			t.Errorf("edge %d expect %s->%s token:%s amount:%s, got %s->%s token:%s amount:%s", i, v.From.Hex(), v.To.Hex(), v.Token.Hex(), v.Amount, got.From.Hex(), got.To.Hex(), got.Token.Hex(), got.Amount)
+		}
+		if got.BlockNumber.Int64() != 200 || got.TxHash != common.HexToHash("0x01") {
+			t.Errorf("edge %d should carry block and tx hash", i)
+		}
+	}
+}
@@ -0,0 +1,154 @@
+/*
+
+  Copyright 2017 Loopring Project Ltd (Loopring Foundation).
+
+  Licensed under the Apache License, Version 2.0 (the "License");
+  you may not use this file except in compliance with the License.
+  You may obtain a copy of the License at
+
+  http://www.apache.org/licenses/LICENSE-2.0
+
+  Unless required by applicable law or agreed to in writing, software
+  distributed under the License is distributed on an "AS IS" BASIS,
+  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+  See the License for the specific language governing permissions and
+  limitations under the License.
+
+*/
+
+package extractor
+
+import (
+	"github.com/Loopring/relay/eventemiter"
+	"github.com/Loopring/relay/log"
+	"github.com/Loopring/relay/types"
+	"github.com/ethereum/go-ethereum/common"
+	"sync"
+)
+
+// 按交易汇总账户变动, 在TransactionCompleted时一次性发出
+type txEffectsCollector struct {
+	mtx      sync.Mutex
+	effects  map[common.Hash]map[common.Address][]types.AccountEffect
+	watchers map[string]*eventemitter.Watcher
+}
+
+func newTxEffectsCollector() *txEffectsCollector {
+	c := &txEffectsCollector{}
+	c.effects = make(map[common.Hash]map[common.Address][]types.AccountEffect)
+	c.watchers = make(map[string]*eventemitter.Watcher)
+
+	return c
+}
+
+func (c *txEffectsCollector) Start() {
+	c.watchers[eventemitter.Transfer] = &eventemitter.Watcher{Concurrent: false, Handle: c.handleTransfer}
+	c.watchers[eventemitter.EthTransferEvent] = &eventemitter.Watcher{Concurrent: false, Handle: c.handleEthTransfer}
+	c.watchers[eventemitter.Approve] = &eventemitter.Watcher{Concurrent: false, Handle: c.handleApprove}
+	c.watchers[eventemitter.OrderFilled] = &eventemitter.Watcher{Concurrent: false, Handle: c.handleOrderFilled}
+	c.watchers[eventemitter.TransactionCompleted] = &eventemitter.Watcher{Concurrent: false, Handle: c.handleTransactionCompleted}
+
+	for topic, watcher := range c.watchers {
+		eventemitter.On(topic, watcher)
+	}
+}
+
+func (c *txEffectsCollector) Stop() {
+	for topic, watcher := range c.watchers {
+		eventemitter.Un(topic, watcher)
+	}
+	c.watchers = make(map[string]*eventemitter.Watcher)
+
+	c.mtx.Lock()
+	c.effects = make(map[common.Hash]map[common.Address][]types.AccountEffect)
+	c.mtx.Unlock()
+}
+
+// 只统计已成功的变动, pending交易没有完成边界
+func (c *txEffectsCollector) add(tx *types.TxInfo, account common.Address, effect types.AccountEffect) {
+	if tx.Status != types.TX_STATUS_SUCCESS || effect.Amount == nil || effect.Amount.Sign() == 0 {
+		return
+	}
+
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+
+	accounts, ok := c.effects[tx.TxHash]
+	if !ok {
+		accounts = make(map[common.Address][]types.AccountEffect)
+		c.effects[tx.TxHash] = accounts
+	}
+	accounts[account] = append(accounts[account], effect)
+}
+
+func (c *txEffectsCollector) handleTransfer(input eventemitter.EventData) error {
+	evt := input.(*types.TransferEvent)
+
+	received := evt.Amount
+	if evt.Received != nil {
+		received = evt.Received
+	}
+	if !evt.Mint {
+		c.add(&evt.TxInfo, evt.Sender, types.AccountEffect{Type: types.EFFECT_TRANSFER_OUT, Token: evt.Protocol, Amount: evt.Amount, Counterparty: evt.Receiver})
+	}
+	if !evt.Burn {
+		c.add(&evt.TxInfo, evt.Receiver, types.AccountEffect{Type: types.EFFECT_TRANSFER_IN, Token: evt.Protocol, Amount: received, Counterparty: evt.Sender})
+	}
+
+	return nil
+}
+
+func (c *txEffectsCollector) handleEthTransfer(input eventemitter.EventData) error {
+	evt := input.(*types.TransferEvent)
+	if evt.SelfTransfer {
+		return nil
+	}
+
+	c.add(&evt.TxInfo, evt.Sender, types.AccountEffect{Type: types.EFFECT_TRANSFER_OUT, Token: types.NilAddress, Amount: evt.Amount, Counterparty: evt.Receiver})
+	c.add(&evt.TxInfo, evt.Receiver, types.AccountEffect{Type: types.EFFECT_TRANSFER_IN, Token: types.NilAddress, Amount: evt.Amount, Counterparty: evt.Sender})
+
+	return nil
+}
+
+func (c *txEffectsCollector) handleApprove(input eventemitter.EventData) error {
+	evt := input.(*types.ApprovalEvent)
+
+	c.add(&evt.TxInfo, evt.Owner, types.AccountEffect{Type: types.EFFECT_APPROVE, Token: evt.Protocol, Amount: evt.Amount, Counterparty: evt.Spender})
+
+	return nil
+}
+
+func (c *txEffectsCollector) handleOrderFilled(input eventemitter.EventData) error {
+	evt := input.(*types.OrderFilledEvent)
+
+	c.add(&evt.TxInfo, evt.Owner, types.AccountEffect{Type: types.EFFECT_FILL_SELL, Token: evt.TokenS, Amount: evt.AmountS})
+	c.add(&evt.TxInfo, evt.Owner, types.AccountEffect{Type: types.EFFECT_FILL_BUY, Token: evt.TokenB, Amount: evt.AmountB})
+
+	return nil
+}
+
+func (c *txEffectsCollector) handleTransactionCompleted(input eventemitter.EventData) error {
+	evt := input.(*types.TransactionCompletedEvent)
+
+	c.mtx.Lock()
+	accounts, ok := c.effects[evt.TxHash]
+	delete(c.effects, evt.TxHash)
+	c.mtx.Unlock()
+
+	// 与relay无关的交易不发出汇总
+	if !ok {
+		return nil
+	}
+
+	// 代付交易发送者不承担gas
+	if gas := evt.Fee(); gas.Sign() > 0 {
+		accounts[evt.From] = append(accounts[evt.From], types.AccountEffect{Type: types.EFFECT_GAS, Token: types.NilAddress, Amount: gas})
+	} else if evt.SponsoredTransaction {
+		log.Debugf("extractor,tx:%s sponsored transaction, gas price is zero", evt.TxHash.Hex())
+	}
+
+	log.Debugf("extractor,tx:%s effects of %d accounts", evt.TxHash.Hex(), len(accounts))
+	eventemitter.Emit(eventemitter.TransactionEffects, &types.TransactionEffectsEvent{TxInfo: evt.TxInfo, Effects: accounts})
+
+	return nil
+}
@@ -0,0 +1,197 @@
+/*
+
+  Copyright 2017 Loopring Project Ltd (Loopring Foundation).
+
+  Licensed under the Apache License, Version 2.0 (the "License");
+  you may not use this file except in compliance with the License.
+  You may obtain a copy of the License at
+
+  http://www.apache.org/licenses/LICENSE-2.0
+
+  Unless required by applicable law or agreed to in writing, software
+  distributed under the License is distributed on an "AS IS" BASIS,
+  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+  See the License for the specific language governing permissions and
+  limitations under the License.
+
+*/
+
+package extractor
+
+import (
+	"github.com/Loopring/relay/ethaccessor"
+	"github.com/Loopring/relay/eventemiter"
+	"github.com/Loopring/relay/types"
+	"github.com/ethereum/go-ethereum/common"
+	"math/big"
+	"testing"
+)
+
+func TestTxEffectsCollector_TransactionEffects(t *testing.T) {
+	collector := newTxEffectsCollector()
+	collector.Start()
+	defer collector.Stop()
+
+	var effects []*types.TransactionEffectsEvent
+	watcher := &eventemitter.Watcher{Concurrent: false, Handle: func(input eventemitter.EventData) error {
+		effects = append(effects, input.(*types.TransactionEffectsEvent))
+		return nil
+	}}
+	eventemitter.On(eventemitter.TransactionEffects, watcher)
+	defer eventemitter.Un(eventemitter.TransactionEffects, watcher)
+
+	var (
+		miner   = common.HexToAddress("0x4bad3053d574cd54513babe21db3f09bea1d387d")
+		owner   = common.HexToAddress("0x1b978a1D302335a6F2Ebe4B8823B5E17c3C84135")
+		spender = common.HexToAddress("0x17233e07c67d086464fD408148c3ABB56245FA64")
+		lrc     = common.HexToAddress("0xcd36128815ebe0b44d0374649bad2721b8751bef")
+		weth    = common.HexToAddress("0x88699e7fee2da0462981a08a15a3b940304cc516")
+		txinfo  = types.TxInfo{
+			TxHash:   common.HexToHash("0x01"),
+			From:     miner,
+			Status:   types.TX_STATUS_SUCCESS,
+			GasUsed:  big.NewInt(21000),
+			GasPrice: big.NewInt(10),
+		}
+	)
+
+	fill := &types.OrderFilledEvent{Owner: owner, TokenS: lrc, TokenB: weth, AmountS: big.NewInt(100), AmountB: big.NewInt(1)}
+	fill.TxInfo = txinfo
+	eventemitter.Emit(eventemitter.OrderFilled, fill)
+
+	transfer := &types.TransferEvent{Sender: owner, Receiver: miner, Amount: big.NewInt(5)}
+	transfer.TxInfo = txinfo
+	transfer.Protocol = lrc
+	eventemitter.Emit(eventemitter.Transfer, transfer)
+
+	approval := &types.ApprovalEvent{Owner: owner, Spender: spender, Amount: big.NewInt(1000)}
+	approval.TxInfo = txinfo
+	approval.Protocol = lrc
+	eventemitter.Emit(eventemitter.Approve, approval)
+
+	// 同块其他交易的变动不应计入
+	other := &types.TransferEvent{Sender: owner, Receiver: spender, Amount: big.NewInt(7)}
+	other.TxInfo = txinfo
+	other.TxHash = common.HexToHash("0x02")
+	other.Protocol = weth
+	eventemitter.Emit(eventemitter.Transfer, other)
+
+	if len(effects) != 0 {
+		t.Fatalf("effects should only be emitted at tx completion")
+	}
+	eventemitter.Emit(eventemitter.TransactionCompleted, &types.TransactionCompletedEvent{TxInfo: txinfo})
+
+	if len(effects) != 1 {
+		t.Fatalf("expect 1 transaction effects event, got %d", len(effects))
+	}
+	evt := effects[0]
+	if evt.TxHash != txinfo.TxHash {
+		t.Fatalf("effects tx hash %s should be %s", evt.TxHash.Hex(), txinfo.TxHash.Hex())
+	}
+	if len(evt.Effects) != 2 {
+		t.Fatalf("expect effects of 2 accounts, got %d", len(evt.Effects))
+	}
+
+	expect := map[common.Address][]types.AccountEffect{
+		owner: {
+			{Type: types.EFFECT_FILL_SELL, Token: lrc, Amount: big.NewInt(100)},
+			{Type: types.EFFECT_FILL_BUY, Token: weth, Amount: big.NewInt(1)},
+			{Type: types.EFFECT_TRANSFER_OUT, Token: lrc, Amount: big.NewInt(5), Counterparty: miner},
+			{Type: types.EFFECT_APPROVE, Token: lrc, Amount: big.NewInt(1000), Counterparty: spender},
+		},
+		miner: {
+			{Type: types.EFFECT_TRANSFER_IN, Token: lrc, Amount: big.NewInt(5), Counterparty: owner},
+			{Type: types.EFFECT_GAS, Token: types.NilAddress, Amount: big.NewInt(210000)},
+		},
+	}
+	for account, list := range expect {
+		got := evt.Effects[account]
+		if len(got) != len(list) {
+			t.Fatalf("account %s expect %d effects, got %d", account.Hex(), len(list), len(got))
+		}
+		for i, v := range list {
+			if got[i].Type != v.Type || got[i].Token != v.Token || got[i].Amount.Cmp(v.Amount) != 0 || got[i].Counterparty != v.Counterparty {
+				t.Fatalf("account %s effect %d expect %s %s, got %s %s", account.Hex(), i, v.Type, v.Amount.String(), got[i].Type, got[i].Amount.String())
+			}
+		}
+	}
+
+	// 完成后不再重复发出
+	eventemitter.Emit(eventemitter.TransactionCompleted, &types.TransactionCompletedEvent{TxInfo: txinfo})
+	if len(effects) != 1 {
+		t.Fatalf("effects should be emitted once per tx, got %d", len(effects))
+	}
+}
+
+func TestTxEffectsCollector_SponsoredTransaction(t *testing.T) {
+	collector := newTxEffectsCollector()
+	collector.Start()
+	defer collector.Stop()
+
+	var effects []*types.TransactionEffectsEvent
+	watcher := &eventemitter.Watcher{Concurrent: false, Handle: func(input eventemitter.EventData) error {
+		effects = append(effects, input.(*types.TransactionEffectsEvent))
+		return nil
+	}}
+	eventemitter.On(eventemitter.TransactionEffects, watcher)
+	defer eventemitter.Un(eventemitter.TransactionEffects, watcher)
+
+	var transfers []*types.TransferEvent
+	transferWatcher := &eventemitter.Watcher{Concurrent: false, Handle: func(input eventemitter.EventData) error {
+		transfers = append(transfers, input.(*types.TransferEvent))
+		return nil
+	}}
+	eventemitter.On(eventemitter.EthTransferEvent, transferWatcher)
+	defer eventemitter.Un(eventemitter.EthTransferEvent, transferWatcher)
+
+	var (
+		sender   = common.HexToAddress("0x1b978a1D302335a6F2Ebe4B8823B5E17c3C84135")
+		receiver = common.HexToAddress("0xb1018949b241D76A1AB2094f473E9bEfeAbB5Ead")
+	)
+
+	tx := &ethaccessor.Transaction{
+		Hash:        "0x03",
+		From:        sender.Hex(),
+		To:          receiver.Hex(),
+		Value:       *types.NewBigWithInt(5),
+		GasPrice:    *types.NewBigWithInt(0),
+		Gas:         *types.NewBigWithInt(21000),
+		BlockNumber: *types.NewBigWithInt(5000000),
+	}
+	receipt := &ethaccessor.TransactionReceipt{
+		BlockNumber: *types.NewBigWithInt(5000000),
+		GasUsed:     *types.NewBigWithInt(21000),
+		Status:      types.NewBigWithInt(1),
+	}
+
+	processor := &AbiProcessor{}
+	if err := processor.handleEthTransfer(tx, receipt, big.NewInt(1520000000)); err != nil {
+		t.Fatalf("zero gas price transfer should not fail:%s", err.Error())
+	}
+	processor.handleTransactionCompleted(tx, receipt, big.NewInt(1520000000))
+
+	if len(transfers) != 1 {
+		t.Fatalf("expect 1 eth transfer, got %d", len(transfers))
+	}
+	if !transfers[0].SponsoredTransaction {
+		t.Fatalf("zero gas price transfer should be flagged as sponsored")
+	}
+	if fee := transfers[0].Fee(); fee.Sign() != 0 {
+		t.Fatalf("sponsored transaction fee should be 0, got %s", fee.String())
+	}
+
+	if len(effects) != 1 {
+		t.Fatalf("expect 1 transaction effects event, got %d", len(effects))
+	}
+	if !effects[0].SponsoredTransaction {
+		t.Fatalf("transaction effects should be flagged as sponsored")
+	}
+	for _, v := range effects[0].Effects[sender] {
+		if v.Type == types.EFFECT_GAS {
+			t.Fatalf("sponsored transaction sender should not pay gas, got %s", v.Amount.String())
+		}
+	}
+	if len(effects[0].Effects[sender]) != 1 || len(effects[0].Effects[receiver]) != 1 {
+		t.Fatalf("expect transfer effects only, got sender:%d receiver:%d", len(effects[0].Effects[sender]), len(effects[0].Effects[receiver]))
+	}
+}
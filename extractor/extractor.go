@@ -27,6 +27,7 @@ import (
 	"github.com/Loopring/relay/log"
 	"github.com/Loopring/relay/types"
 	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/common"
 	"github.com/ethereum/go-ethereum/common/hexutil"
 	"math/big"
 	"sort"
@@ -43,10 +44,56 @@ const (
 	defaultForkWaitingTime = 10
 )
 
+// extractor固定发出的topic, 合约event/method id等动态topic由processor声明
+var extractorTopics = []string{
+	eventemitter.Block_New,
+	eventemitter.Block_End,
+	eventemitter.SyncChainComplete,
+	eventemitter.ChainForkDetected,
+	eventemitter.ExtractorWarning,
+	eventemitter.ExtractorUnpackError,
+	eventemitter.BlockTimeUnavailable,
+	eventemitter.ExtractorHandlerCancelled,
+	eventemitter.RingMined,
+	eventemitter.OrderFilled,
+	eventemitter.OrderManagerUnknownFill,
+	eventemitter.RingMidPrice,
+	eventemitter.FeeDiscrepancy,
+	eventemitter.MinerRingSettledCost,
+	eventemitter.Miner_SubmitRing_Method,
+	eventemitter.CancelOrder,
+	eventemitter.CutoffAll,
+	eventemitter.CutoffPair,
+	eventemitter.GatewayNewOrder,
+	eventemitter.OrderHashMismatch,
+	eventemitter.TokenRegistered,
+	eventemitter.TokenUnRegistered,
+	eventemitter.AddressAuthorized,
+	eventemitter.AddressDeAuthorized,
+	eventemitter.ProtocolSetChanged,
+	eventemitter.Transfer,
+	eventemitter.ContractTransfer,
+	eventemitter.TokenSupply,
+	eventemitter.AccountEventOverflow,
+	eventemitter.EthTransferEvent,
+	eventemitter.Approve,
+	eventemitter.ApproveFailed,
+	eventemitter.AllowanceChanged,
+	eventemitter.WethDeposit,
+	eventemitter.WethWithdrawal,
+	eventemitter.TransactionCompleted,
+	eventemitter.TransactionStateChanged,
+	eventemitter.TransactionEffects,
+}
+
 type ExtractorService interface {
 	Start()
 	Stop()
 	ForkProcess(block *types.Block) error
+	IsRelevantTransaction(tx *ethaccessor.Transaction) bool
+	BlockLatency() (*big.Int, time.Duration)
+	ReplayBlocks(from, to *big.Int) error
+	Reload(options config.ExtractorOptions)
 }
 
 // TODO(fukun):不同的channel，应当交给orderbook统一进行后续处理，可以将channel作为函数返回值、全局变量、参数等方式
@@ -57,12 +104,29 @@ type ExtractorServiceImpl struct {
 	dao              dao.RdsService
 	stop             chan bool
 	lock             sync.RWMutex
+	processMtx       sync.Mutex // 区块处理与Reload/ReplayBlocks互斥
 	startBlockNumber *big.Int
 	endBlockNumber   *big.Int
 	iterator         *ethaccessor.BlockIterator
 	pendingTxWatcher *eventemitter.Watcher
+	effects          *txEffectsCollector
+	edges            *transferEdgeEmitter
+	pausedTokens     *pausedTokenDetector
+	fillStats        *blockFillStatsCollector
+	reorg            *reorgTxTracker
 	syncComplete     bool
 	forkComplete     bool
+	latencyBlock     *big.Int
+	blockLatency     time.Duration
+
+	// 已重放的交易, 重复调用ReplayBlocks时跳过, 最多保留maxReplayedTxs个, 超出时淘汰最早的记录
+	replayed      map[common.Hash]bool
+	replayedOrder []common.Hash
+	getBlock      func(blockNumber *big.Int) (*ethaccessor.BlockWithTxAndReceipt, error)
+
+	blockTimes *blockTimeResolver
+	metrics    *extractorMetrics
+	catchUp    *catchUpScanner
 }
 
 func NewExtractorService(options config.ExtractorOptions, db dao.RdsService) *ExtractorServiceImpl {
@@ -74,13 +138,37 @@ func NewExtractorService(options config.ExtractorOptions, db dao.RdsService) *Ex
 
 	l.options = options
 	l.dao = db
+	rawHexAmounts = options.RawHexAmounts
 	l.processor = newAbiProcessor(db, &options)
+	l.metrics = newExtractorMetrics(l.processor.stats)
 	l.detector = newForkDetector(db, l.options.StartBlockNumber)
+	l.effects = newTxEffectsCollector()
+	if options.EmitTransferEdges {
+		l.edges = newTransferEdgeEmitter()
+	}
+	if options.PausedTokenFailures > 0 {
+		l.pausedTokens = newPausedTokenDetector(options.PausedTokenFailures)
+	}
+	if options.EmitBlockFillStats {
+		l.fillStats = newBlockFillStatsCollector()
+	}
+	if options.ReorgTxCheck {
+		l.reorg = newReorgTxTracker(options.ReorgTrackDepth)
+	}
+	if options.FetchMissingBlockTime {
+		l.blockTimes = newBlockTimeResolver()
+	}
+	if options.CatchUpLogsRange > 0 {
+		l.catchUp = newCatchUpScanner(options.CatchUpLogsRange, l.processor.catchUpTopics, l.confirmedHead)
+	}
+	l.replayed = make(map[common.Hash]bool)
+	l.getBlock = getFullBlock
 	l.stop = make(chan bool, 1)
 	l.setBlockNumberRange()
 
 	l.pendingTxWatcher = &eventemitter.Watcher{Concurrent: false, Handle: l.WatchingPendingTransaction}
 	eventemitter.On(eventemitter.PendingTransaction, l.pendingTxWatcher)
+	eventemitter.On(eventemitter.TokenEvicted, &eventemitter.Watcher{Concurrent: false, Handle: l.processor.handleTokenEvicted})
 
 	return &l
 }
@@ -92,12 +180,38 @@ func (l *ExtractorServiceImpl) Start() {
 
 	log.Infof("extractor start from block:%s...", l.startBlockNumber.String())
 	l.syncComplete = false
+	l.processor.resetContext()
+	eventemitter.Declare(extractorTopics...)
+	eventemitter.Declare(l.processor.emittedTopics()...)
+	l.effects.Start()
+	if l.edges != nil {
+		eventemitter.Declare(eventemitter.TransferEdge)
+		l.edges.Start()
+	}
+	if l.pausedTokens != nil {
+		eventemitter.Declare(eventemitter.TokenPaused)
+		l.pausedTokens.Start()
+	}
+	if l.fillStats != nil {
+		eventemitter.Declare(eventemitter.BlockFillStats)
+		l.fillStats.Start()
+	}
+	if l.reorg != nil {
+		l.reorg.Start()
+	}
+	l.metrics.Start()
 
 	l.iterator = ethaccessor.NewBlockIterator(l.startBlockNumber, l.endBlockNumber, true, l.options.ConfirmBlockNumber)
 	go func() {
 		for {
 			select {
 			case <-l.stop:
+				// 区块处理已结束, 此时保存快照不会与processor并发修改
+				if l.options.SnapshotFile != "" {
+					if err := l.processor.saveSnapshot(l.options.SnapshotFile); err != nil {
+						log.Errorf("extractor,save snapshot error:%s", err.Error())
+					}
+				}
 				return
 			default:
 				if err := l.ProcessBlock(); nil != err {
@@ -114,6 +228,21 @@ func (l *ExtractorServiceImpl) Stop() {
 		return
 	}
 
+	l.effects.Stop()
+	if l.edges != nil {
+		l.edges.Stop()
+	}
+	if l.pausedTokens != nil {
+		l.pausedTokens.Stop()
+	}
+	if l.fillStats != nil {
+		l.fillStats.Stop()
+	}
+	if l.reorg != nil {
+		l.reorg.Stop()
+	}
+	l.metrics.Stop()
+	l.processor.cancelContext()
 	l.stop <- true
 }
 
@@ -131,13 +260,18 @@ func (l *ExtractorServiceImpl) ForkProcess(currentBlock *types.Block) error {
 
 	log.Debugf("extractor,detected chain fork, from :%d to %d", forkEvent.ForkBlock.Int64(), forkEvent.DetectedBlock.Int64())
 
+	// 孤块中已发出的交易在新链上可能失败或不存在
+	if l.reorg != nil {
+		l.reorg.Reorg(forkEvent)
+	}
+
 	l.Stop()
 
 	// emit event
 	eventemitter.Emit(eventemitter.ChainForkDetected, forkEvent)
 
 	// reset start blockNumber
-	l.startBlockNumber = new(big.Int).Add(forkEvent.ForkBlock, big.NewInt(1))
+	l.resetAfterFork(forkEvent)
 
 	// waiting for the eth node catch up
 	time.Sleep(time.Duration(l.options.ForkWaitingTime) * time.Second)
@@ -147,6 +281,32 @@ func (l *ExtractorServiceImpl) ForkProcess(currentBlock *types.Block) error {
 	return fmt.Errorf("extractor,detected chain fork")
 }
 
+// resetAfterFork 分叉点之后的交易在新链上可能以相同的(TxHash, LogIndex)重新打包, 清除其去重记录后从分叉点之后重新扫块
+func (l *ExtractorServiceImpl) resetAfterFork(forkEvent *types.ForkedEvent) {
+	l.processor.seenLogs.rollback(forkEvent.ForkBlock.Int64())
+	l.startBlockNumber = new(big.Int).Add(forkEvent.ForkBlock, big.NewInt(1))
+}
+
+// Reload 配置文件变更后重新加载合约/垃圾token/去重窗口等processor配置, 等待当前区块处理完成后执行
+// 扫块范围及确认数等仍以启动时配置为准
+func (l *ExtractorServiceImpl) Reload(options config.ExtractorOptions) {
+	l.processMtx.Lock()
+	defer l.processMtx.Unlock()
+
+	log.Infof("extractor,reload contracts")
+	rawHexAmounts = options.RawHexAmounts
+	l.processor.Reload(l.dao, &options)
+}
+
+// SetTrackedOwnerFilter 设置需要跟踪的账户, 与其相关的交易均视为relay相关
+func (l *ExtractorServiceImpl) SetTrackedOwnerFilter(filter func(owner common.Address) bool) {
+	l.processor.trackedOwner = filter
+}
+
+func (l *ExtractorServiceImpl) IsRelevantTransaction(tx *ethaccessor.Transaction) bool {
+	return l.processor.IsRelevantTransaction(tx)
+}
+
 func (l *ExtractorServiceImpl) Sync(blockNumber *big.Int) {
 	var syncBlock types.Big
 	if err := ethaccessor.BlockNumber(&syncBlock); err != nil {
@@ -176,6 +336,12 @@ func (l *ExtractorServiceImpl) WatchingPendingTransaction(input eventemitter.Eve
 }
 
 func (l *ExtractorServiceImpl) ProcessBlock() error {
+	if l.catchUp != nil && !l.syncComplete {
+		if block := l.catchUpBlock(); block != nil {
+			return l.processBlock(block)
+		}
+	}
+
 	inter, err := l.iterator.Next()
 	if err != nil {
 		return fmt.Errorf("extractor,iterator next error:%s", err.Error())
@@ -183,6 +349,51 @@ func (l *ExtractorServiceImpl) ProcessBlock() error {
 
 	// get current block
 	block := inter.(*ethaccessor.BlockWithTxAndReceipt)
+	return l.processBlock(block)
+}
+
+// catchUpBlock 追块时当前块没有相关log则只获取区块头, 返回nil时按正常流程获取完整区块
+func (l *ExtractorServiceImpl) catchUpBlock() *ethaccessor.BlockWithTxAndReceipt {
+	blockNumber := l.iterator.CurrentNumber()
+
+	l.processMtx.Lock()
+	skip, err := l.catchUp.skippable(blockNumber)
+	l.processMtx.Unlock()
+	if err != nil {
+		log.Errorf("extractor,catch up get logs from block:%s error:%s", blockNumber.String(), err.Error())
+		return nil
+	}
+	if !skip {
+		return nil
+	}
+
+	var header ethaccessor.Block
+	if err := ethaccessor.GetBlockByNumber(&header, blockNumber, false); err != nil {
+		log.Errorf("extractor,catch up get block:%s header error:%s", blockNumber.String(), err.Error())
+		return nil
+	}
+	l.iterator.Skip()
+	return &ethaccessor.BlockWithTxAndReceipt{Block: header}
+}
+
+// confirmedHead 已达到确认数的最新块, 不超过配置的结束块
+func (l *ExtractorServiceImpl) confirmedHead() (*big.Int, error) {
+	var latest types.Big
+	if err := ethaccessor.BlockNumber(&latest); err != nil {
+		return nil, err
+	}
+	head := new(big.Int).Sub(latest.BigInt(), new(big.Int).SetUint64(l.options.ConfirmBlockNumber))
+	if head.Cmp(l.endBlockNumber) > 0 {
+		head.Set(l.endBlockNumber)
+	}
+	return head, nil
+}
+
+func (l *ExtractorServiceImpl) processBlock(block *ethaccessor.BlockWithTxAndReceipt) error {
+	l.processMtx.Lock()
+	defer l.processMtx.Unlock()
+
+	start := time.Now()
 	log.Infof("extractor,get block:%s->%s, transaction number:%d", block.Number.BigInt().String(), block.Hash.Hex(), len(block.Transactions))
 
 	currentBlock := &types.Block{}
@@ -214,17 +425,43 @@ func (l *ExtractorServiceImpl) ProcessBlock() error {
 	eventemitter.Emit(eventemitter.Block_New, blockEvent)
 
 	if len(block.Transactions) > 0 {
+		l.processor.unloadEvictedTokens()
+		l.processor.PrefetchBlockOrders(block.Receipts)
+		defer l.processor.ReleaseBlockOrders()
+
 		for idx, transaction := range block.Transactions {
 			receipt := block.Receipts[idx]
 			l.debug("extractor,tx:%s", transaction.Hash)
+			l.metrics.setQueueDepth(len(block.Transactions) - idx)
 			l.ProcessMinedTransaction(&transaction, &receipt, block.Timestamp.BigInt())
 		}
+		l.metrics.setQueueDepth(0)
 	}
 
+	l.setBlockLatency(blockEvent.BlockNumber, time.Since(start))
+
 	eventemitter.Emit(eventemitter.Block_End, blockEvent)
 	return nil
 }
 
+// BlockLatency 返回最近处理完成的块号及其从开始处理到所有交易事件发出的耗时
+func (l *ExtractorServiceImpl) BlockLatency() (*big.Int, time.Duration) {
+	l.lock.RLock()
+	defer l.lock.RUnlock()
+
+	return l.latencyBlock, l.blockLatency
+}
+
+func (l *ExtractorServiceImpl) setBlockLatency(blockNumber *big.Int, latency time.Duration) {
+	l.lock.Lock()
+	l.latencyBlock = new(big.Int).Set(blockNumber)
+	l.blockLatency = latency
+	l.lock.Unlock()
+	l.metrics.setBlockLatency(latency)
+
+	log.Debugf("extractor,block:%s processed, latency:%s", blockNumber.String(), latency.String())
+}
+
 func (l *ExtractorServiceImpl) ProcessPendingTransaction(tx *ethaccessor.Transaction) error {
 	log.Debugf("extractor,process pending transaction %s", tx.Hash)
 
@@ -233,6 +470,10 @@ func (l *ExtractorServiceImpl) ProcessPendingTransaction(tx *ethaccessor.Transac
 	if l.processor.SupportedMethod(tx) {
 		return l.ProcessMethod(tx, nil, blockTime)
 	}
+	if !l.processor.IsValidEthTransferTransaction(tx) {
+		l.debug("extractor,pending tx:%s to:%s is an unsupported contract call", tx.Hash, tx.To)
+		return nil
+	}
 
 	return l.processor.handleEthTransfer(tx, nil, blockTime)
 }
@@ -240,15 +481,24 @@ func (l *ExtractorServiceImpl) ProcessPendingTransaction(tx *ethaccessor.Transac
 func (l *ExtractorServiceImpl) ProcessMinedTransaction(tx *ethaccessor.Transaction, receipt *ethaccessor.TransactionReceipt, blockTime *big.Int) error {
 	l.debug("extractor,process mined transaction,tx:%s status :%s,logs:%d", tx.Hash, receipt.Status.BigInt().String(), len(receipt.Logs))
 
-	if l.processor.SupportedEvents(receipt) {
-		return l.ProcessEvent(tx, receipt, blockTime)
+	if l.blockTimes != nil && !validBlockTime(blockTime) {
+		blockTime = l.blockTimes.resolve(common.HexToHash(tx.Hash), tx.BlockNumber.BigInt(), blockTime)
 	}
 
-	if l.processor.SupportedMethod(tx) {
-		return l.ProcessMethod(tx, receipt, blockTime)
+	var err error
+	if l.processor.SupportedEvents(receipt) {
+		err = l.ProcessEvent(tx, receipt, blockTime)
+	} else if l.processor.SupportedMethod(tx) {
+		err = l.ProcessMethod(tx, receipt, blockTime)
+	} else if l.processor.IsValidEthTransferTransaction(tx) {
+		err = l.processor.handleEthTransfer(tx, receipt, blockTime)
+	} else {
+		l.debug("extractor,tx:%s to:%s is an unsupported contract call", tx.Hash, tx.To)
 	}
 
-	return l.processor.handleEthTransfer(tx, receipt, blockTime)
+	l.processor.handleTransactionCompleted(tx, receipt, blockTime)
+
+	return err
 }
 
 func (l *ExtractorServiceImpl) ProcessMethod(tx *ethaccessor.Transaction, receipt *ethaccessor.TransactionReceipt, blockTime *big.Int) error {
@@ -259,8 +509,10 @@ func (l *ExtractorServiceImpl) ProcessMethod(tx *ethaccessor.Transaction, receip
 	}
 
 	gas, status := l.processor.getGasAndStatus(tx, receipt)
-	method.FullFilled(tx, gas, blockTime, status, method.Name)
+	method.FullFilled(tx, receipt, gas, blockTime, status, method.Name)
+	method.Replay = l.processor.isReplay(method.TxHash)
 	eventemitter.Emit(method.Id, method)
+	l.metrics.eventProcessed()
 
 	return nil
 }
@@ -289,16 +541,25 @@ func (l *ExtractorServiceImpl) ProcessEvent(tx *ethaccessor.Transaction, receipt
 			continue
 		}
 
+		// 重放时有意重新发出, 不做去重
+		txhash := common.HexToHash(tx.Hash)
+		if !l.processor.isReplay(txhash) && !l.processor.seenLogs.firstSeen(txhash, evtLog.LogIndex.Int64(), tx.BlockNumber.Int64()) {
+			l.debug("extractor,tx:%s log:%d delivered again, skip", tx.Hash, evtLog.LogIndex.Int64())
+			continue
+		}
+
 		data := hexutil.MustDecode(evtLog.Data)
 		if nil != data && len(data) > 0 {
 			if err := event.CAbi.Unpack(event.Event, event.Name, data, abi.SEL_UNPACK_EVENT); nil != err {
-				log.Errorf("extractor,process event,tx:%s unpack event error:%s", tx.Hash, err.Error())
+				emitUnpackError(common.HexToHash(tx.Hash), tx.BlockNumber.BigInt(), event.Name, err)
 				continue
 			}
 		}
 
-		event.FullFilled(tx, &evtLog, receipt.GasUsed.BigInt(), blockTime, methodName)
+		event.FullFilled(tx, receipt, &evtLog, receipt.GasUsed.BigInt(), blockTime, methodName)
+		event.Replay = l.processor.isReplay(event.TxHash)
 		eventemitter.Emit(event.Id.Hex(), event)
+		l.metrics.eventProcessed()
 	}
 
 	return nil
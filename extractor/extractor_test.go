@@ -53,7 +53,7 @@ func TestExtractorServiceImpl_ProcessPendingTransaction(t *testing.T) {
 	}
 
 	accmanager := test.GenerateAccountManager()
-	tm := txmanager.NewTxManager(test.Rds(), &accmanager)
+	tm := txmanager.NewTxManager(test.Rds(), &accmanager, &test.Cfg().TxManager)
 	tm.Start()
 
 	om := test.GenerateOrderManager()
@@ -77,7 +77,7 @@ func TestExtractorServiceImpl_ProcessMinedTransaction(t *testing.T) {
 	}
 
 	accmanager := test.GenerateAccountManager()
-	tm := txmanager.NewTxManager(test.Rds(), &accmanager)
+	tm := txmanager.NewTxManager(test.Rds(), &accmanager, &test.Cfg().TxManager)
 	tm.Start()
 	processor := extractor.NewExtractorService(test.Cfg().Extractor, test.Rds())
 	processor.ProcessMinedTransaction(tx, receipt, big.NewInt(100))
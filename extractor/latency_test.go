@@ -0,0 +1,82 @@
+/*
+
+  Copyright 2017 Loopring Project Ltd (Loopring Foundation).
+
+  Licensed under the Apache License, Version 2.0 (the "License");
+  you may not use this file except in compliance with the License.
+  You may obtain a copy of the License at
+
+  http://www.apache.org/licenses/LICENSE-2.0
+
+  Unless required by applicable law or agreed to in writing, software
+  distributed under the License is distributed on an "AS IS" BASIS,
+  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+  See the License for the specific language governing permissions and
+  limitations under the License.
+
+*/
+
+package extractor
+
+import (
+	"github.com/Loopring/relay/config"
+	"github.com/Loopring/relay/dao"
+	"github.com/Loopring/relay/ethaccessor"
+	"github.com/Loopring/relay/eventemiter"
+	"github.com/Loopring/relay/log"
+	"github.com/Loopring/relay/types"
+	"github.com/ethereum/go-ethereum/common"
+	"go.uber.org/zap"
+	"math/big"
+	"testing"
+	"time"
+)
+
+type latencyRdsService struct {
+	dao.RdsService
+}
+
+func (s *latencyRdsService) SaveBlock(latest *dao.Block) error {
+	return nil
+}
+
+func TestExtractorServiceImpl_BlockLatency(t *testing.T) {
+	zapOpts := zap.NewDevelopmentConfig()
+	zapOpts.Level = zap.NewAtomicLevelAt(zap.ErrorLevel)
+	log.Initialize(config.LogOptions{ZapOpts: zapOpts})
+
+	parent := &types.Block{BlockNumber: big.NewInt(5000019), BlockHash: common.HexToHash("0x19")}
+	db := &latencyRdsService{}
+	l := &ExtractorServiceImpl{dao: db, syncComplete: true}
+	l.detector = &forkDetector{db: db, latestBlock: parent}
+
+	if number, latency := l.BlockLatency(); number != nil || latency != 0 {
+		t.Fatalf("no block processed yet, got %v %s", number, latency.String())
+	}
+
+	// 模拟块内交易处理耗时
+	watcher := &eventemitter.Watcher{Concurrent: false, Handle: func(input eventemitter.EventData) error {
+		time.Sleep(5 * time.Millisecond)
+		return nil
+	}}
+	eventemitter.On(eventemitter.Block_New, watcher)
+	defer eventemitter.Un(eventemitter.Block_New, watcher)
+
+	block := &ethaccessor.BlockWithTxAndReceipt{}
+	block.Number = *types.NewBigWithInt(5000020)
+	block.Hash = common.HexToHash("0x20")
+	block.ParentHash = parent.BlockHash
+	block.Timestamp = *types.NewBigWithInt(1520000000)
+
+	if err := l.processBlock(block); err != nil {
+		t.Fatalf("process block error:%s", err.Error())
+	}
+
+	number, latency := l.BlockLatency()
+	if number == nil || number.Int64() != 5000020 {
+		t.Fatalf("latency should be recorded for block 5000020, got %v", number)
+	}
+	if latency < 5*time.Millisecond {
+		t.Fatalf("latency should cover block processing, got %s", latency.String())
+	}
+}
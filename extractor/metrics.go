@@ -0,0 +1,146 @@
+/*
+
+  Copyright 2017 Loopring Project Ltd (Loopring Foundation).
+
+  Licensed under the Apache License, Version 2.0 (the "License");
+  you may not use this file except in compliance with the License.
+  You may obtain a copy of the License at
+
+  http://www.apache.org/licenses/LICENSE-2.0
+
+  Unless required by applicable law or agreed to in writing, software
+  distributed under the License is distributed on an "AS IS" BASIS,
+  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+  See the License for the specific language governing permissions and
+  limitations under the License.
+
+*/
+
+package extractor
+
+import (
+	"github.com/Loopring/relay/eventemiter"
+	"time"
+)
+
+const (
+	MetricEventsProcessed = "extractor_events_processed_total"
+	MetricDecodeFailures  = "extractor_decode_failures_total"
+	MetricQueueDepth      = "extractor_queue_depth"
+	MetricBlockLatency    = "extractor_block_latency_seconds"
+	MetricHandlerErrors   = "extractor_handler_errors_total"
+)
+
+// MetricsRegistry 指标注册接口, 可直接用prometheus.NewCounter/NewGauge注册后返回实现
+type MetricsRegistry interface {
+	Counter(name, help string) MetricsCounter
+	Gauge(name, help string) MetricsGauge
+}
+
+type MetricsCounter interface {
+	Inc()
+}
+
+type MetricsGauge interface {
+	Set(value float64)
+}
+
+// extractorMetrics 默认只注册到processor的statsRegistry, 设置registry后同时上报; 为nil时各方法不做任何事
+type extractorMetrics struct {
+	eventsProcessed MetricsCounter
+	decodeFailures  MetricsCounter
+	queueDepth      MetricsGauge
+	blockLatency    MetricsGauge
+	watcher         *eventemitter.Watcher
+}
+
+func newExtractorMetrics(registry MetricsRegistry) *extractorMetrics {
+	m := &extractorMetrics{}
+	m.eventsProcessed = registry.Counter(MetricEventsProcessed, "contract events and methods emitted by extractor")
+	m.decodeFailures = registry.Counter(MetricDecodeFailures, "contract events and methods failed to unpack")
+	m.queueDepth = registry.Gauge(MetricQueueDepth, "transactions of current block waiting to be processed")
+	m.blockLatency = registry.Gauge(MetricBlockLatency, "seconds from block start to all transaction events emitted")
+	return m
+}
+
+func (m *extractorMetrics) Start() {
+	if m == nil || m.watcher != nil {
+		return
+	}
+	m.watcher = &eventemitter.Watcher{Concurrent: false, Handle: m.handleUnpackError}
+	eventemitter.On(eventemitter.ExtractorUnpackError, m.watcher)
+}
+
+func (m *extractorMetrics) Stop() {
+	if m == nil || m.watcher == nil {
+		return
+	}
+	eventemitter.Un(eventemitter.ExtractorUnpackError, m.watcher)
+	m.watcher = nil
+}
+
+func (m *extractorMetrics) handleUnpackError(input eventemitter.EventData) error {
+	m.decodeFailures.Inc()
+	return nil
+}
+
+func (m *extractorMetrics) eventProcessed() {
+	if m != nil {
+		m.eventsProcessed.Inc()
+	}
+}
+
+func (m *extractorMetrics) setQueueDepth(depth int) {
+	if m != nil {
+		m.queueDepth.Set(float64(depth))
+	}
+}
+
+func (m *extractorMetrics) setBlockLatency(latency time.Duration) {
+	if m != nil {
+		m.blockLatency.Set(latency.Seconds())
+	}
+}
+
+// multiRegistry 同一指标同时注册到多个registry
+type multiRegistry []MetricsRegistry
+
+type multiCounter []MetricsCounter
+
+func (m multiCounter) Inc() {
+	for _, c := range m {
+		c.Inc()
+	}
+}
+
+type multiGauge []MetricsGauge
+
+func (m multiGauge) Set(value float64) {
+	for _, g := range m {
+		g.Set(value)
+	}
+}
+
+func (r multiRegistry) Counter(name, help string) MetricsCounter {
+	var counters multiCounter
+	for _, registry := range r {
+		counters = append(counters, registry.Counter(name, help))
+	}
+	return counters
+}
+
+func (r multiRegistry) Gauge(name, help string) MetricsGauge {
+	var gauges multiGauge
+	for _, registry := range r {
+		gauges = append(gauges, registry.Gauge(name, help))
+	}
+	return gauges
+}
+
+// SetMetricsRegistry 注册extractor指标, 需在Start之前调用, processor的Stats仍从同一组counter读取
+func (l *ExtractorServiceImpl) SetMetricsRegistry(registry MetricsRegistry) {
+	if l.processor != nil && l.processor.stats != nil {
+		registry = multiRegistry{l.processor.stats, registry}
+	}
+	l.metrics = newExtractorMetrics(registry)
+}
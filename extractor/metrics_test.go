@@ -0,0 +1,130 @@
+/*
+
+  Copyright 2017 Loopring Project Ltd (Loopring Foundation).
+
+  Licensed under the Apache License, Version 2.0 (the "License");
+  you may not use this file except in compliance with the License.
+  You may obtain a copy of the License at
+
+  http://www.apache.org/licenses/LICENSE-2.0
+
+  Unless required by applicable law or agreed to in writing, software
+  distributed under the License is distributed on an "AS IS" BASIS,
+  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+  See the License for the specific language governing permissions and
+  limitations under the License.
+
+*/
+
+package extractor
+
+import (
+	"github.com/Loopring/relay/config"
+	"github.com/Loopring/relay/ethaccessor"
+	"github.com/Loopring/relay/eventemiter"
+	"github.com/Loopring/relay/log"
+	"github.com/Loopring/relay/types"
+	"github.com/ethereum/go-ethereum/common"
+	"go.uber.org/zap"
+	"math/big"
+	"testing"
+)
+
+type stubMetric struct {
+	count int
+	value float64
+}
+
+func (m *stubMetric) Inc()              { m.count++ }
+func (m *stubMetric) Set(value float64) { m.value = value }
+
+type stubMetricsRegistry struct {
+	metrics map[string]*stubMetric
+}
+
+func (r *stubMetricsRegistry) register(name string) *stubMetric {
+	if r.metrics == nil {
+		r.metrics = make(map[string]*stubMetric)
+	}
+	m := &stubMetric{}
+	r.metrics[name] = m
+	return m
+}
+
+func (r *stubMetricsRegistry) Counter(name, help string) MetricsCounter { return r.register(name) }
+func (r *stubMetricsRegistry) Gauge(name, help string) MetricsGauge     { return r.register(name) }
+
+func TestExtractorServiceImpl_Metrics(t *testing.T) {
+	zapOpts := zap.NewDevelopmentConfig()
+	zapOpts.Level = zap.NewAtomicLevelAt(zap.ErrorLevel)
+	log.Initialize(config.LogOptions{ZapOpts: zapOpts})
+
+	registry := &stubMetricsRegistry{}
+	db := &latencyRdsService{}
+	parent := &types.Block{BlockNumber: big.NewInt(5000019), BlockHash: common.HexToHash("0x19")}
+	l := &ExtractorServiceImpl{dao: db, syncComplete: true}
+	l.detector = &forkDetector{db: db, latestBlock: parent}
+	l.SetMetricsRegistry(registry)
+
+	for _, name := range []string{MetricEventsProcessed, MetricDecodeFailures, MetricQueueDepth, MetricBlockLatency} {
+		if _, ok := registry.metrics[name]; !ok {
+			t.Fatalf("metric %s should be registered", name)
+		}
+	}
+
+	l.metrics.Start()
+	defer l.metrics.Stop()
+
+	eventemitter.Emit(eventemitter.ExtractorUnpackError, &types.ExtractorUnpackErrorEvent{})
+	if registry.metrics[MetricDecodeFailures].count != 1 {
+		t.Fatalf("decode failures should be 1, got %d", registry.metrics[MetricDecodeFailures].count)
+	}
+
+	l.metrics.eventProcessed()
+	l.metrics.eventProcessed()
+	if registry.metrics[MetricEventsProcessed].count != 2 {
+		t.Fatalf("events processed should be 2, got %d", registry.metrics[MetricEventsProcessed].count)
+	}
+
+	l.metrics.setQueueDepth(3)
+	if registry.metrics[MetricQueueDepth].value != 3 {
+		t.Fatalf("queue depth should be 3, got %f", registry.metrics[MetricQueueDepth].value)
+	}
+
+	block := &ethaccessor.BlockWithTxAndReceipt{}
+	block.Number = *types.NewBigWithInt(5000020)
+	block.Hash = common.HexToHash("0x20")
+	block.ParentHash = parent.BlockHash
+	block.Timestamp = *types.NewBigWithInt(1520000000)
+	if err := l.processBlock(block); err != nil {
+		t.Fatalf("process block error:%s", err.Error())
+	}
+	_, latency := l.BlockLatency()
+	if registry.metrics[MetricBlockLatency].value != latency.Seconds() {
+		t.Fatalf("block latency gauge should be %f, got %f", latency.Seconds(), registry.metrics[MetricBlockLatency].value)
+	}
+
+	// 未设置registry时不做任何事
+	var none *extractorMetrics
+	none.Start()
+	none.eventProcessed()
+	none.setQueueDepth(1)
+	none.Stop()
+}
+
+func TestExtractorServiceImpl_MetricsSharedWithStats(t *testing.T) {
+	registry := &stubMetricsRegistry{}
+	l := &ExtractorServiceImpl{processor: &AbiProcessor{stats: newStatsRegistry()}}
+	l.SetMetricsRegistry(registry)
+
+	l.metrics.Start()
+	defer l.metrics.Stop()
+
+	eventemitter.Emit(eventemitter.ExtractorUnpackError, &types.ExtractorUnpackErrorEvent{})
+	if registry.metrics[MetricDecodeFailures].count != 1 {
+		t.Fatalf("decode failures should be 1, got %d", registry.metrics[MetricDecodeFailures].count)
+	}
+	if errors := l.processor.Stats()[StatsErrorKey]; errors != 1 {
+		t.Fatalf("decode failures should be counted in stats errors, got %d", errors)
+	}
+}
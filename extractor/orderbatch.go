@@ -0,0 +1,131 @@
+/*
+
+  Copyright 2017 Loopring Project Ltd (Loopring Foundation).
+
+  Licensed under the Apache License, Version 2.0 (the "License");
+  you may not use this file except in compliance with the License.
+  You may obtain a copy of the License at
+
+  http://www.apache.org/licenses/LICENSE-2.0
+
+  Unless required by applicable law or agreed to in writing, software
+  distributed under the License is distributed on an "AS IS" BASIS,
+  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+  See the License for the specific language governing permissions and
+  limitations under the License.
+
+*/
+
+package extractor
+
+import (
+	"context"
+	"github.com/Loopring/relay/dao"
+	"github.com/Loopring/relay/ethaccessor"
+	"github.com/Loopring/relay/log"
+	"github.com/Loopring/relay/types"
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+)
+
+// blockOrderBatch 块内ringMined涉及的订单, queried中存在而orders中不存在的为relay未知订单
+type blockOrderBatch struct {
+	queried map[string]bool
+	orders  map[string]dao.Order
+}
+
+// PrefetchBlockOrders 块开始时从receipts中收集ringMined的订单hash, 批量查询后缓存到块结束, 同一订单被多个环引用时只查一次
+func (processor *AbiProcessor) PrefetchBlockOrders(receipts []ethaccessor.TransactionReceipt) {
+	var orderhashList []string
+	queried := make(map[string]bool)
+
+	for _, receipt := range receipts {
+		for _, evtLog := range receipt.Logs {
+			event, ok := processor.GetEvent(evtLog)
+			if !ok || event.Name != ethaccessor.EVENT_RING_MINED {
+				continue
+			}
+
+			data, err := hexutil.Decode(evtLog.Data)
+			if err != nil || len(data) == 0 {
+				continue
+			}
+			// 不能解析到共用的event.Event中
+			contractEvent := &ethaccessor.RingMinedEvent{}
+			if err := event.CAbi.Unpack(contractEvent, event.Name, data, abi.SEL_UNPACK_EVENT); err != nil {
+				continue
+			}
+			_, fills, err := contractEvent.ConvertDown()
+			if err != nil {
+				continue
+			}
+			for _, fill := range fills {
+				orderhash := fill.OrderHash.Hex()
+				if !queried[orderhash] {
+					queried[orderhash] = true
+					orderhashList = append(orderhashList, orderhash)
+				}
+			}
+		}
+	}
+
+	batch := &blockOrderBatch{queried: queried, orders: make(map[string]dao.Order)}
+	if len(orderhashList) > 0 {
+		var ordermap map[string]dao.Order
+		err := processor.callWithContext(types.NilHash, "prefetchBlockOrders", func(ctx context.Context) (err error) {
+			ordermap, err = processor.db.GetOrdersByHashContext(ctx, orderhashList)
+			return err
+		})
+		if err != nil {
+			// 批量查询失败时各环单独查询
+			log.Errorf("extractor,prefetch block orders error:%s", err.Error())
+			batch = nil
+		} else {
+			batch.orders = ordermap
+		}
+	}
+
+	processor.orderBatchMtx.Lock()
+	processor.orderBatch = batch
+	processor.orderBatchMtx.Unlock()
+}
+
+// ReleaseBlockOrders 块结束时丢弃缓存, 之后的查询直接访问db
+func (processor *AbiProcessor) ReleaseBlockOrders() {
+	processor.orderBatchMtx.Lock()
+	processor.orderBatch = nil
+	processor.orderBatchMtx.Unlock()
+}
+
+// getOrdersByHash 优先使用块内缓存, 只有未预取的订单才查询db
+func (processor *AbiProcessor) getOrdersByHash(ctx context.Context, orderhashList []string) (map[string]dao.Order, error) {
+	processor.orderBatchMtx.RLock()
+	batch := processor.orderBatch
+	processor.orderBatchMtx.RUnlock()
+
+	if batch == nil {
+		return processor.db.GetOrdersByHashContext(ctx, orderhashList)
+	}
+
+	ret := make(map[string]dao.Order)
+	var missed []string
+	for _, orderhash := range orderhashList {
+		if !batch.queried[orderhash] {
+			missed = append(missed, orderhash)
+		} else if ord, ok := batch.orders[orderhash]; ok {
+			ret[orderhash] = ord
+		}
+	}
+	if len(missed) == 0 {
+		return ret, nil
+	}
+
+	ordermap, err := processor.db.GetOrdersByHashContext(ctx, missed)
+	if err != nil {
+		return nil, err
+	}
+	for k, v := range ordermap {
+		ret[k] = v
+	}
+	return ret, nil
+}
@@ -0,0 +1,192 @@
+/*
+
+  Copyright 2017 Loopring Project Ltd (Loopring Foundation).
+
+  Licensed under the Apache License, Version 2.0 (the "License");
+  you may not use this file except in compliance with the License.
+  You may obtain a copy of the License at
+
+  http://www.apache.org/licenses/LICENSE-2.0
+
+  Unless required by applicable law or agreed to in writing, software
+  distributed under the License is distributed on an "AS IS" BASIS,
+  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+  See the License for the specific language governing permissions and
+  limitations under the License.
+
+*/
+
+package extractor
+
+import (
+	"context"
+	"github.com/Loopring/relay/config"
+	"github.com/Loopring/relay/dao"
+	"github.com/Loopring/relay/ethaccessor"
+	"github.com/Loopring/relay/eventemiter"
+	"github.com/ethereum/go-ethereum/common"
+	"math/big"
+	"testing"
+	"time"
+)
+
+// countingRdsService records GetOrdersByHashContext round trips, latency simulates db access
+type countingRdsService struct {
+	mockRdsService
+	queries int
+	latency time.Duration
+}
+
+func (s *countingRdsService) GetOrdersByHashContext(ctx context.Context, orderhashs []string) (map[string]dao.Order, error) {
+	s.queries++
+	if s.latency > 0 {
+		time.Sleep(s.latency)
+	}
+	return s.mockRdsService.GetOrdersByHashContext(ctx, orderhashs)
+}
+
+// ringMinedLog encodes ringMined event data as it is in transaction receipt
+func ringMinedLog(id common.Hash, orders []dao.Order) ethaccessor.Log {
+	infoList := ringMinedEventData(orders).Event.(*ethaccessor.RingMinedEvent).OrderInfoList
+
+	var data []byte
+	data = append(data, common.LeftPadBytes(big.NewInt(1).Bytes(), 32)...)
+	data = append(data, common.LeftPadBytes(common.HexToAddress("0x4bad3053d574cd54513babe21db3f09bea1d387d").Bytes(), 32)...)
+	data = append(data, common.LeftPadBytes(common.HexToAddress("0x4bad3053d574cd54513babe21db3f09bea1d387d").Bytes(), 32)...)
+	data = append(data, common.LeftPadBytes(big.NewInt(0x80).Bytes(), 32)...)
+	data = append(data, common.LeftPadBytes(big.NewInt(int64(len(infoList))).Bytes(), 32)...)
+	for _, v := range infoList {
+		data = append(data, v[:]...)
+	}
+
+	return ethaccessor.Log{Topics: []string{id.Hex(), common.HexToHash("0x1234").Hex()}, Data: common.ToHex(data)}
+}
+
+func newBatchTestProcessor(t testing.TB, db dao.RdsService) (*AbiProcessor, common.Hash) {
+	cfg := config.LoadConfig("../config/relay.toml")
+	implAbi, err := ethaccessor.NewAbi(cfg.Common.ProtocolImpl.ImplAbi)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ringMined := implAbi.Events[ethaccessor.EVENT_RING_MINED]
+	contract := newEventData(&ringMined, implAbi)
+	contract.Event = &ethaccessor.RingMinedEvent{}
+
+	processor := &AbiProcessor{db: db, events: map[common.Hash]EventData{contract.Id: contract}}
+	return processor, contract.Id
+}
+
+func TestAbiProcessor_PrefetchBlockOrders(t *testing.T) {
+	lrc, weth := setupMarketTokens()
+
+	shared := dao.Order{OrderHash: common.HexToHash("0x01").Hex(), Owner: "0x1b978a1D302335a6F2Ebe4B8823B5E17c3C84135", TokenS: lrc.Protocol.Hex(), TokenB: weth.Protocol.Hex()}
+	buyer1 := dao.Order{OrderHash: common.HexToHash("0x02").Hex(), Owner: "0xb1018949b241D76A1AB2094f473E9bEfeAbB5Ead", TokenS: weth.Protocol.Hex(), TokenB: lrc.Protocol.Hex()}
+	buyer2 := dao.Order{OrderHash: common.HexToHash("0x03").Hex(), Owner: "0x4Ec94E1007605D70a86279370ec5e4b755295eDA", TokenS: weth.Protocol.Hex(), TokenB: lrc.Protocol.Hex()}
+	unknown := dao.Order{OrderHash: common.HexToHash("0x04").Hex(), Owner: "0x4Ec94E1007605D70a86279370ec5e4b755295eDA", TokenS: weth.Protocol.Hex(), TokenB: lrc.Protocol.Hex()}
+
+	db := &countingRdsService{mockRdsService: mockRdsService{orders: map[string]dao.Order{
+		shared.OrderHash: shared,
+		buyer1.OrderHash: buyer1,
+		buyer2.OrderHash: buyer2,
+	}}}
+	processor, id := newBatchTestProcessor(t, db)
+
+	// shared订单被两个环引用, unknown订单relay中不存在
+	rings := [][]dao.Order{{shared, buyer1}, {shared, buyer2}, {unknown, buyer1}}
+	var receipts []ethaccessor.TransactionReceipt
+	for _, ring := range rings {
+		receipts = append(receipts, ethaccessor.TransactionReceipt{Logs: []ethaccessor.Log{ringMinedLog(id, ring)}})
+	}
+	// 非ringMined日志被忽略
+	receipts = append(receipts, ethaccessor.TransactionReceipt{Logs: []ethaccessor.Log{{Topics: []string{common.HexToHash("0xff").Hex()}}}})
+
+	processor.PrefetchBlockOrders(receipts)
+	if db.queries != 1 {
+		t.Fatalf("expect 1 batched query, got %d", db.queries)
+	}
+
+	var unknownFills int
+	watcher := &eventemitter.Watcher{Concurrent: false, Handle: func(input eventemitter.EventData) error {
+		unknownFills++
+		return nil
+	}}
+	eventemitter.On(eventemitter.OrderManagerUnknownFill, watcher)
+	defer eventemitter.Un(eventemitter.OrderManagerUnknownFill, watcher)
+
+	fills := collectFills(t, func() {
+		for _, ring := range rings {
+			processor.handleRingMinedEvent(ringMinedEventData(ring))
+		}
+	})
+	if db.queries != 1 {
+		t.Fatalf("rings in prefetched block should not query db, got %d queries", db.queries)
+	}
+	if len(fills) != 5 || unknownFills != 1 {
+		t.Fatalf("expect 5 matched fills and 1 unknown fill, got %d and %d", len(fills), unknownFills)
+	}
+	if fills[0].OrderHash.Hex() != shared.OrderHash || fills[1].OrderHash.Hex() != buyer1.OrderHash {
+		t.Fatalf("unexpected fill order %s %s", fills[0].OrderHash.Hex(), fills[1].OrderHash.Hex())
+	}
+	if fills[2].OrderHash.Hex() != shared.OrderHash || fills[2].TokenS != lrc.Protocol || fills[2].Owner != common.HexToAddress(shared.Owner) {
+		t.Fatalf("order shared by rings should be matched in each ring")
+	}
+
+	// 未预取的订单仍然查询db
+	extra := dao.Order{OrderHash: common.HexToHash("0x05").Hex(), Owner: "0x1b978a1D302335a6F2Ebe4B8823B5E17c3C84135", TokenS: lrc.Protocol.Hex(), TokenB: weth.Protocol.Hex()}
+	db.orders[extra.OrderHash] = extra
+	ordermap, err := processor.getOrdersByHash(context.Background(), []string{shared.OrderHash, extra.OrderHash})
+	if err != nil || len(ordermap) != 2 || db.queries != 2 {
+		t.Fatalf("hash not prefetched should be queried, got %d orders %d queries", len(ordermap), db.queries)
+	}
+
+	processor.ReleaseBlockOrders()
+	processor.handleRingMinedEvent(ringMinedEventData(rings[0]))
+	if db.queries != 3 {
+		t.Fatalf("released batch should query db per ring, got %d queries", db.queries)
+	}
+}
+
+func BenchmarkAbiProcessor_RingMinedOrderLookup(b *testing.B) {
+	lrc, weth := setupMarketTokens()
+
+	const ringCount = 20
+	orders := make(map[string]dao.Order)
+	var rings [][]dao.Order
+	for i := 0; i < ringCount; i++ {
+		seller := dao.Order{OrderHash: common.BigToHash(big.NewInt(int64(2*i + 1))).Hex(), Owner: "0x1b978a1D302335a6F2Ebe4B8823B5E17c3C84135", TokenS: lrc.Protocol.Hex(), TokenB: weth.Protocol.Hex()}
+		buyer := dao.Order{OrderHash: common.BigToHash(big.NewInt(int64(2*i + 2))).Hex(), Owner: "0xb1018949b241D76A1AB2094f473E9bEfeAbB5Ead", TokenS: weth.Protocol.Hex(), TokenB: lrc.Protocol.Hex()}
+		orders[seller.OrderHash] = seller
+		orders[buyer.OrderHash] = buyer
+		rings = append(rings, []dao.Order{seller, buyer})
+	}
+
+	db := &countingRdsService{mockRdsService: mockRdsService{orders: orders}, latency: 200 * time.Microsecond}
+	processor, id := newBatchTestProcessor(b, db)
+
+	var (
+		receipts []ethaccessor.TransactionReceipt
+		events   []EventData
+	)
+	for _, ring := range rings {
+		receipts = append(receipts, ethaccessor.TransactionReceipt{Logs: []ethaccessor.Log{ringMinedLog(id, ring)}})
+		events = append(events, ringMinedEventData(ring))
+	}
+
+	b.Run("PerRing", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			for _, evt := range events {
+				processor.handleRingMinedEvent(evt)
+			}
+		}
+	})
+
+	b.Run("Batched", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			processor.PrefetchBlockOrders(receipts)
+			for _, evt := range events {
+				processor.handleRingMinedEvent(evt)
+			}
+			processor.ReleaseBlockOrders()
+		}
+	})
+}
@@ -0,0 +1,81 @@
+/*
+
+  Copyright 2017 Loopring Project Ltd (Loopring Foundation).
+
+  Licensed under the Apache License, Version 2.0 (the "License");
+  you may not use this file except in compliance with the License.
+  You may obtain a copy of the License at
+
+  http://www.apache.org/licenses/LICENSE-2.0
+
+  Unless required by applicable law or agreed to in writing, software
+  distributed under the License is distributed on an "AS IS" BASIS,
+  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+  See the License for the specific language governing permissions and
+  limitations under the License.
+
+*/
+
+package extractor
+
+import (
+	"context"
+	"fmt"
+	"github.com/Loopring/relay/dao"
+	"github.com/Loopring/relay/eventemiter"
+	"github.com/Loopring/relay/log"
+	"github.com/Loopring/relay/types"
+	"strings"
+)
+
+// VerifyOrderHash 存储的订单字段重新计算后应得到api提交时存储的hash,
+// 不一致说明GenerateHash与入库时的计算方式有差异
+// 订单按submitRing中计算的hash查出, 因此无需再与链上订单的hash比较
+func VerifyOrderHash(stored *dao.Order) error {
+	// ConvertUp在hash不一致时返回错误, 这里需要继续比较, 忽略错误
+	var state types.OrderState
+	stored.ConvertUp(&state)
+	if recomputed := state.RawOrder.GenerateHash(); !strings.EqualFold(recomputed.Hex(), stored.OrderHash) {
+		return fmt.Errorf("stored order %s fields recomputed to hash %s", stored.OrderHash, recomputed.Hex())
+	}
+	return nil
+}
+
+// verifyOrderHashes submitRing中的订单与已存储订单比较hash, 未存储的订单(非relay提交)不检查
+func (processor *AbiProcessor) verifyOrderHashes(txinfo types.TxInfo, orders []types.Order) {
+	if processor.db == nil || len(orders) == 0 {
+		return
+	}
+
+	var orderhashList []string
+	for _, v := range orders {
+		orderhashList = append(orderhashList, v.Hash.Hex())
+	}
+	var stored map[string]dao.Order
+	err := processor.callWithContext(txinfo.TxHash, "verifyOrderHashes", func(ctx context.Context) (err error) {
+		stored, err = processor.getOrdersByHash(ctx, orderhashList)
+		return err
+	})
+	if err != nil {
+		log.Errorf("extractor,tx:%s verify order hash, get orders error:%s", txinfo.TxHash.Hex(), err.Error())
+		return
+	}
+
+	for i := range orders {
+		ord := &orders[i]
+		model, ok := stored[ord.Hash.Hex()]
+		if !ok {
+			continue
+		}
+		if err := VerifyOrderHash(&model); err != nil {
+			log.Errorf("extractor,tx:%s order hash anomaly:%s", txinfo.TxHash.Hex(), err.Error())
+			eventemitter.Emit(eventemitter.OrderHashMismatch, &types.OrderHashMismatchEvent{
+				TxInfo:     txinfo,
+				OrderHash:  ord.Hash,
+				StoredHash: model.OrderHash,
+				Owner:      ord.Owner,
+				Reason:     err.Error(),
+			})
+		}
+	}
+}
@@ -0,0 +1,89 @@
+/*
+
+  Copyright 2017 Loopring Project Ltd (Loopring Foundation).
+
+  Licensed under the Apache License, Version 2.0 (the "License");
+  you may not use this file except in compliance with the License.
+  You may obtain a copy of the License at
+
+  http://www.apache.org/licenses/LICENSE-2.0
+
+  Unless required by applicable law or agreed to in writing, software
+  distributed under the License is distributed on an "AS IS" BASIS,
+  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+  See the License for the specific language governing permissions and
+  limitations under the License.
+
+*/
+
+package extractor
+
+import (
+	"github.com/Loopring/relay/dao"
+	"github.com/Loopring/relay/eventemiter"
+	"github.com/Loopring/relay/types"
+	"github.com/ethereum/go-ethereum/common"
+	"testing"
+)
+
+func storedOrder(owner, amountS string) dao.Order {
+	order := dao.Order{
+		Protocol:        "0x456044789a41b277f033e4d79fab2139d69cd154",
+		DelegateAddress: "0x17233e07c67d086464fD408148c3ABB56245FA64",
+		Owner:           owner,
+		TokenS:          "0xEF68e7C694F40c8202821eDF525dE3782458639f",
+		TokenB:          "0xC02aaA39b223FE8D0A0e5C4F27eAD9083C756Cc2",
+		AmountS:         amountS,
+		AmountB:         "100",
+		LrcFee:          "0",
+		ValidSince:      1,
+		ValidUntil:      2,
+	}
+
+	var state types.OrderState
+	order.ConvertUp(&state)
+	order.OrderHash = state.RawOrder.GenerateHash().Hex()
+	return order
+}
+
+func TestAbiProcessor_VerifyOrderHashes(t *testing.T) {
+	matched := storedOrder("0x1b978a1D302335a6F2Ebe4B8823B5E17c3C84135", "1000")
+	mismatched := storedOrder("0xb1018949b241D76A1AB2094f473E9bEfeAbB5Ead", "1000")
+
+	var ringOrders []types.Order
+	for _, v := range []dao.Order{matched, mismatched} {
+		var state types.OrderState
+		v.ConvertUp(&state)
+		state.RawOrder.Hash = state.RawOrder.GenerateHash()
+		ringOrders = append(ringOrders, state.RawOrder)
+	}
+	if err := VerifyOrderHash(&matched); err != nil {
+		t.Fatalf("matched order should pass verification:%s", err.Error())
+	}
+
+	// 存储的字段与hash不一致
+	mismatched.AmountS = "2000"
+
+	var anomalies []*types.OrderHashMismatchEvent
+	watcher := &eventemitter.Watcher{Concurrent: false, Handle: func(input eventemitter.EventData) error {
+		anomalies = append(anomalies, input.(*types.OrderHashMismatchEvent))
+		return nil
+	}}
+	eventemitter.On(eventemitter.OrderHashMismatch, watcher)
+	defer eventemitter.Un(eventemitter.OrderHashMismatch, watcher)
+
+	processor := &AbiProcessor{db: &mockRdsService{orders: map[string]dao.Order{
+		matched.OrderHash:    matched,
+		mismatched.OrderHash: mismatched,
+	}}}
+	var txinfo types.TxInfo
+	txinfo.TxHash = common.HexToHash("0x01")
+	processor.verifyOrderHashes(txinfo, ringOrders)
+
+	if len(anomalies) != 1 {
+		t.Fatalf("expect 1 order hash anomaly, got %d", len(anomalies))
+	}
+	if anomalies[0].OrderHash != ringOrders[1].Hash || anomalies[0].Owner != ringOrders[1].Owner || anomalies[0].TxHash != txinfo.TxHash {
+		t.Errorf("anomaly should be reported for mismatched order, got %s", anomalies[0].OrderHash.Hex())
+	}
+}
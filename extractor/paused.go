@@ -0,0 +1,89 @@
+/*
+
+  Copyright 2017 Loopring Project Ltd (Loopring Foundation).
+
+  Licensed under the Apache License, Version 2.0 (the "License");
+  you may not use this file except in compliance with the License.
+  You may obtain a copy of the License at
+
+  http://www.apache.org/licenses/LICENSE-2.0
+
+  Unless required by applicable law or agreed to in writing, software
+  distributed under the License is distributed on an "AS IS" BASIS,
+  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+  See the License for the specific language governing permissions and
+  limitations under the License.
+
+*/
+
+package extractor
+
+import (
+	"github.com/Loopring/relay/eventemiter"
+	"github.com/Loopring/relay/log"
+	"github.com/Loopring/relay/types"
+	"github.com/ethereum/go-ethereum/common"
+	"sync"
+)
+
+// 可暂停的erc20在暂停期间transfer会revert, 同一token连续失败达到threshold时认为token已暂停
+type pausedTokenDetector struct {
+	threshold int
+	failures  map[common.Address]int
+	paused    map[common.Address]bool
+	mtx       sync.Mutex
+	watchers  map[string]*eventemitter.Watcher
+}
+
+func newPausedTokenDetector(threshold int) *pausedTokenDetector {
+	return &pausedTokenDetector{
+		threshold: threshold,
+		failures:  make(map[common.Address]int),
+		paused:    make(map[common.Address]bool),
+		watchers:  make(map[string]*eventemitter.Watcher),
+	}
+}
+
+func (d *pausedTokenDetector) Start() {
+	d.watchers[eventemitter.Transfer] = &eventemitter.Watcher{Concurrent: false, Handle: d.handleTransfer}
+	d.watchers[eventemitter.ContractTransfer] = &eventemitter.Watcher{Concurrent: false, Handle: d.handleTransfer}
+
+	for topic, watcher := range d.watchers {
+		eventemitter.On(topic, watcher)
+	}
+}
+
+func (d *pausedTokenDetector) Stop() {
+	for topic, watcher := range d.watchers {
+		eventemitter.Un(topic, watcher)
+	}
+	d.watchers = make(map[string]*eventemitter.Watcher)
+}
+
+func (d *pausedTokenDetector) handleTransfer(input eventemitter.EventData) error {
+	evt := input.(*types.TransferEvent)
+
+	var signal *types.TokenPausedEvent
+	d.mtx.Lock()
+	switch evt.Status {
+	case types.TX_STATUS_FAILED:
+		d.failures[evt.Protocol]++
+		if !d.paused[evt.Protocol] && d.failures[evt.Protocol] >= d.threshold {
+			d.paused[evt.Protocol] = true
+			signal = &types.TokenPausedEvent{TxInfo: evt.TxInfo, Token: evt.Protocol, Paused: true, Failures: d.failures[evt.Protocol]}
+		}
+	case types.TX_STATUS_SUCCESS:
+		if d.paused[evt.Protocol] {
+			signal = &types.TokenPausedEvent{TxInfo: evt.TxInfo, Token: evt.Protocol, Paused: false}
+		}
+		delete(d.failures, evt.Protocol)
+		delete(d.paused, evt.Protocol)
+	}
+	d.mtx.Unlock()
+
+	if signal != nil {
+		log.Debugf("extractor,tx:%s token:%s paused:%t after %d failed transfers", evt.TxHash.Hex(), signal.Token.Hex(), signal.Paused, signal.Failures)
+		eventemitter.Emit(eventemitter.TokenPaused, signal)
+	}
+	return nil
+}
@@ -0,0 +1,83 @@
+/*
+
+  Copyright 2017 Loopring Project Ltd (Loopring Foundation).
+
+  Licensed under the Apache License, Version 2.0 (the "License");
+  you may not use this file except in compliance with the License.
+  You may obtain a copy of the License at
+
+  http://www.apache.org/licenses/LICENSE-2.0
+
+  Unless required by applicable law or agreed to in writing, software
+  distributed under the License is distributed on an "AS IS" BASIS,
+  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+  See the License for the specific language governing permissions and
+  limitations under the License.
+
+*/
+
+package extractor
+
+import (
+	"github.com/Loopring/relay/eventemiter"
+	"github.com/Loopring/relay/types"
+	"github.com/ethereum/go-ethereum/common"
+	"math/big"
+	"testing"
+)
+
+func TestPausedTokenDetector(t *testing.T) {
+	detector := newPausedTokenDetector(3)
+	detector.Start()
+	defer detector.Stop()
+
+	var signals []*types.TokenPausedEvent
+	watcher := &eventemitter.Watcher{Concurrent: false, Handle: func(input eventemitter.EventData) error {
+		signals = append(signals, input.(*types.TokenPausedEvent))
+		return nil
+	}}
+	eventemitter.On(eventemitter.TokenPaused, watcher)
+	defer eventemitter.Un(eventemitter.TokenPaused, watcher)
+
+	pausable := common.HexToAddress("0xEF68e7C694F40c8202821eDF525dE3782458639f")
+	other := common.HexToAddress("0xC02aaA39b223FE8D0A0e5C4F27eAD9083C756Cc2")
+	transfer := func(token common.Address, status types.TxStatus) {
+		evt := &types.TransferEvent{
+			Sender:   common.HexToAddress("0x1b978a1D302335a6F2Ebe4B8823B5E17c3C84135"),
+			Receiver: common.HexToAddress("0xb1018949b241D76A1AB2094f473E9bEfeAbB5Ead"),
+			Amount:   big.NewInt(100),
+		}
+		evt.Protocol = token
+		evt.Status = status
+		eventemitter.Emit(eventemitter.Transfer, evt)
+	}
+
+	// 其他token的失败以及pending交易不计入
+	transfer(pausable, types.TX_STATUS_FAILED)
+	transfer(other, types.TX_STATUS_FAILED)
+	transfer(pausable, types.TX_STATUS_PENDING)
+	transfer(pausable, types.TX_STATUS_FAILED)
+	if len(signals) != 0 {
+		t.Fatalf("token should not be paused before threshold, got %d signals", len(signals))
+	}
+
+	transfer(pausable, types.TX_STATUS_FAILED)
+	transfer(pausable, types.TX_STATUS_FAILED)
+	if len(signals) != 1 {
+		t.Fatalf("expect 1 paused signal, got %d", len(signals))
+	}
+	if !signals[0].Paused || signals[0].Token != pausable || signals[0].Failures != 3 {
+		t.Fatalf("unexpected paused signal token:%s paused:%t failures:%d", signals[0].Token.Hex(), signals[0].Paused, signals[0].Failures)
+	}
+
+	// 恢复后发出Paused=false, 计数重新开始
+	transfer(pausable, types.TX_STATUS_SUCCESS)
+	if len(signals) != 2 || signals[1].Paused {
+		t.Fatalf("successful transfer should signal token resumed")
+	}
+	transfer(pausable, types.TX_STATUS_FAILED)
+	transfer(other, types.TX_STATUS_SUCCESS)
+	if len(signals) != 2 {
+		t.Fatalf("failures should be counted again after resumed, got %d signals", len(signals))
+	}
+}
@@ -0,0 +1,135 @@
+/*
+
+  Copyright 2017 Loopring Project Ltd (Loopring Foundation).
+
+  Licensed under the Apache License, Version 2.0 (the "License");
+  you may not use this file except in compliance with the License.
+  You may obtain a copy of the License at
+
+  http://www.apache.org/licenses/LICENSE-2.0
+
+  Unless required by applicable law or agreed to in writing, software
+  distributed under the License is distributed on an "AS IS" BASIS,
+  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+  See the License for the specific language governing permissions and
+  limitations under the License.
+
+*/
+
+package extractor
+
+import (
+	"github.com/Loopring/relay/eventemiter"
+	"github.com/Loopring/relay/log"
+	"github.com/Loopring/relay/types"
+	"github.com/ethereum/go-ethereum/common"
+	"sync"
+	"time"
+)
+
+// 超过该数量时清理已回满的bucket, 避免长时间运行后owner数量无限增长
+const maxOwnerBuckets = 10000
+
+type ownerBucket struct {
+	tokens     float64
+	last       time.Time
+	overflowed int
+}
+
+// 按owner的令牌桶, 限制单个活跃账户(如机器人)发出的transfer/approve数量.
+// 令牌按区块时间恢复, 追块时是否放行与处理速度无关
+type ownerRateLimiter struct {
+	mtx     sync.Mutex
+	rate    float64
+	burst   float64
+	buckets map[common.Address]*ownerBucket
+	now     func() time.Time
+}
+
+func newOwnerRateLimiter(rate float64, burst int) *ownerRateLimiter {
+	if rate <= 0 {
+		return nil
+	}
+	if burst <= 0 {
+		burst = int(rate)
+	}
+	if burst < 1 {
+		burst = 1
+	}
+	return &ownerRateLimiter{rate: rate, burst: float64(burst), buckets: make(map[common.Address]*ownerBucket), now: time.Now}
+}
+
+// allow 桶内有令牌时返回true, 否则返回false及该owner自上次放行后累计超出的数量.
+// blockTime为事件所在区块时间, pending交易没有区块时间时使用当前时间
+func (l *ownerRateLimiter) allow(owner common.Address, blockTime int64) (bool, int) {
+	if l == nil {
+		return true, 0
+	}
+
+	l.mtx.Lock()
+	defer l.mtx.Unlock()
+
+	now := time.Unix(blockTime, 0)
+	if blockTime <= 0 {
+		now = l.now()
+	}
+	bucket, ok := l.buckets[owner]
+	if !ok {
+		if len(l.buckets) >= maxOwnerBuckets {
+			l.prune(now)
+		}
+		bucket = &ownerBucket{tokens: l.burst, last: now}
+		l.buckets[owner] = bucket
+	} else {
+		l.refill(bucket, now)
+	}
+
+	if bucket.tokens >= 1 {
+		bucket.tokens--
+		bucket.overflowed = 0
+		return true, 0
+	}
+	bucket.overflowed++
+	return false, bucket.overflowed
+}
+
+func (l *ownerRateLimiter) refill(bucket *ownerBucket, now time.Time) {
+	// 乱序的区块时间(pending与mined交替)不回退
+	if !now.After(bucket.last) {
+		return
+	}
+	bucket.tokens += now.Sub(bucket.last).Seconds() * l.rate
+	if bucket.tokens > l.burst {
+		bucket.tokens = l.burst
+	}
+	bucket.last = now
+}
+
+// prune should be called with mtx locked, 回满的bucket与新建的等价
+func (l *ownerRateLimiter) prune(now time.Time) {
+	for owner, bucket := range l.buckets {
+		l.refill(bucket, now)
+		if bucket.tokens >= l.burst {
+			delete(l.buckets, owner)
+		}
+	}
+}
+
+// emitAccountEvent 按owner限流发出transfer/approve, 超出的部分不在原topic发出,
+// 改发到AccountEventOverflow并附带累计超出数量, 需要完整数据的消费方可同时订阅该topic.
+// fill等市场事件不经过这里, 不受限流影响
+func (processor *AbiProcessor) emitAccountEvent(topic string, owner common.Address, blockTime int64, event eventemitter.EventData) {
+	ok, overflowed := processor.ownerLimiter.allow(owner, blockTime)
+	if ok {
+		eventemitter.Emit(topic, event)
+		return
+	}
+
+	log.Debugf("extractor,owner:%s %s event rate limited, overflowed:%d", owner.Hex(), topic, overflowed)
+	eventemitter.Emit(eventemitter.AccountEventOverflow, &types.AccountEventOverflowEvent{
+		Topic:      topic,
+		Owner:      owner,
+		Event:      event,
+		Overflowed: overflowed,
+	})
+}
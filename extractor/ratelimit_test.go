@@ -0,0 +1,109 @@
+/*
+
+  Copyright 2017 Loopring Project Ltd (Loopring Foundation).
+
+  Licensed under the Apache License, Version 2.0 (the "License");
+  you may not use this file except in compliance with the License.
+  You may obtain a copy of the License at
+
+  http://www.apache.org/licenses/LICENSE-2.0
+
+  Unless required by applicable law or agreed to in writing, software
+  distributed under the License is distributed on an "AS IS" BASIS,
+  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+  See the License for the specific language governing permissions and
+  limitations under the License.
+
+*/
+
+package extractor
+
+import (
+	"github.com/Loopring/relay/ethaccessor"
+	"github.com/Loopring/relay/eventemiter"
+	"github.com/Loopring/relay/types"
+	"github.com/ethereum/go-ethereum/common"
+	"math/big"
+	"testing"
+	"time"
+)
+
+func TestAbiProcessor_OwnerRateLimit(t *testing.T) {
+	lrc, _ := setupMarketTokens()
+
+	var transfers []*types.TransferEvent
+	watcher := &eventemitter.Watcher{Concurrent: false, Handle: func(input eventemitter.EventData) error {
+		transfers = append(transfers, input.(*types.TransferEvent))
+		return nil
+	}}
+	eventemitter.On(eventemitter.Transfer, watcher)
+	defer eventemitter.Un(eventemitter.Transfer, watcher)
+
+	var overflows []*types.AccountEventOverflowEvent
+	overflowWatcher := &eventemitter.Watcher{Concurrent: false, Handle: func(input eventemitter.EventData) error {
+		overflows = append(overflows, input.(*types.AccountEventOverflowEvent))
+		return nil
+	}}
+	eventemitter.On(eventemitter.AccountEventOverflow, overflowWatcher)
+	defer eventemitter.Un(eventemitter.AccountEventOverflow, overflowWatcher)
+
+	limiter := newOwnerRateLimiter(1, 3)
+	limiter.now = func() time.Time {
+		t.Fatalf("mined events should be limited by block time")
+		return time.Time{}
+	}
+	processor := &AbiProcessor{unknownTokens: make(map[common.Address]bool), ownerLimiter: limiter}
+
+	bot := common.HexToAddress("0x1b978a1D302335a6F2Ebe4B8823B5E17c3C84135")
+	user := common.HexToAddress("0xb1018949b241D76A1AB2094f473E9bEfeAbB5Ead")
+	blockTime := int64(1520000000)
+	transfer := func(from common.Address) {
+		var data EventData
+		data.Protocol = lrc.Protocol
+		data.BlockTime = blockTime
+		data.Event = &ethaccessor.TransferEvent{Value: big.NewInt(100)}
+		data.Topics = []string{"", common.BytesToHash(from.Bytes()).Hex(), common.BytesToHash(user.Bytes()).Hex()}
+		processor.handleTransferEvent(data)
+	}
+
+	// bot同一区块内10个transfer, Transfer只放行burst个, 其余发到AccountEventOverflow
+	for i := 0; i < 10; i++ {
+		transfer(bot)
+	}
+	if len(transfers) != 3 {
+		t.Fatalf("expect 3 transfers within burst, got %d", len(transfers))
+	}
+	if len(overflows) != 7 {
+		t.Fatalf("expect 7 overflowed transfers, got %d", len(overflows))
+	}
+	last := overflows[len(overflows)-1]
+	if last.Topic != eventemitter.Transfer || last.Owner != bot || last.Overflowed != 7 {
+		t.Errorf("unexpected overflow topic:%s owner:%s overflowed:%d", last.Topic, last.Owner.Hex(), last.Overflowed)
+	}
+	if evt, ok := last.Event.(*types.TransferEvent); !ok || evt.Sender != bot {
+		t.Errorf("overflow event should carry the original transfer")
+	}
+
+	// 其他owner不受影响
+	transfer(user)
+	if len(transfers) != 4 || transfers[3].Sender != user {
+		t.Fatalf("other owner should not be rate limited")
+	}
+
+	// 按区块时间恢复令牌
+	blockTime += 2
+	transfer(bot)
+	transfer(bot)
+	transfer(bot)
+	if len(transfers) != 6 || len(overflows) != 8 {
+		t.Fatalf("expect 2 refilled transfers, got %d transfers %d overflows", len(transfers), len(overflows))
+	}
+	if overflows[7].Overflowed != 1 {
+		t.Errorf("overflow count should restart after owner allowed, got %d", overflows[7].Overflowed)
+	}
+
+	// 未配置时不限制
+	if ok, _ := newOwnerRateLimiter(0, 0).allow(bot, blockTime); !ok {
+		t.Errorf("nil limiter should allow all events")
+	}
+}
@@ -0,0 +1,210 @@
+/*
+
+  Copyright 2017 Loopring Project Ltd (Loopring Foundation).
+
+  Licensed under the Apache License, Version 2.0 (the "License");
+  you may not use this file except in compliance with the License.
+  You may obtain a copy of the License at
+
+  http://www.apache.org/licenses/LICENSE-2.0
+
+  Unless required by applicable law or agreed to in writing, software
+  distributed under the License is distributed on an "AS IS" BASIS,
+  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+  See the License for the specific language governing permissions and
+  limitations under the License.
+
+*/
+
+package extractor
+
+import (
+	"github.com/Loopring/relay/config"
+	"github.com/Loopring/relay/ethaccessor"
+	"github.com/Loopring/relay/eventemiter"
+	"github.com/Loopring/relay/types"
+	"github.com/ethereum/go-ethereum/common"
+	"math/big"
+	"testing"
+)
+
+// 不连接节点, 只加载abi
+func initializeAccessorAbi(t *testing.T) {
+	cfg := config.LoadConfig("../config/relay.toml")
+	cfg.Common.ProtocolImpl.Address = nil
+	if err := ethaccessor.Initialize(config.AccessorOptions{}, cfg.Common, types.NilAddress); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestAbiProcessor_Reload(t *testing.T) {
+	initializeAccessorAbi(t)
+
+	processor := newAbiProcessor(&mockRdsService{}, &config.ExtractorOptions{})
+	defer processor.Unload()
+
+	processor.Reload(&mockRdsService{}, &config.ExtractorOptions{})
+	processor.Reload(&mockRdsService{}, &config.ExtractorOptions{})
+
+	var topics []string
+	for id := range processor.events {
+		topics = append(topics, id.Hex())
+	}
+	for id := range processor.methods {
+		topics = append(topics, id)
+	}
+	if len(topics) == 0 || len(topics) != len(processor.watchers) {
+		t.Fatalf("expect every event and method tracked, got %d topics and %d watchers", len(topics), len(processor.watchers))
+	}
+	for _, topic := range topics {
+		if n := eventemitter.WatcherCount(topic); n != 1 {
+			t.Fatalf("topic:%s should have exactly one watcher after reload, got %d", topic, n)
+		}
+	}
+
+	processor.Unload()
+	for _, topic := range topics {
+		if n := eventemitter.WatcherCount(topic); n != 0 {
+			t.Fatalf("topic:%s should have no watcher after unload, got %d", topic, n)
+		}
+	}
+}
+
+func TestAbiProcessor_ReloadResetsProcessorState(t *testing.T) {
+	initializeAccessorAbi(t)
+
+	processor := newAbiProcessor(&mockRdsService{}, &config.ExtractorOptions{EventDedupWindow: 10})
+	defer processor.Unload()
+
+	unknown := common.HexToAddress("0x0c0b638ffccb4bdc4c0d0d5fef062fc512c92511")
+	processor.unknownTokens[unknown] = true
+	processor.seenLogs.firstSeen(common.HexToHash("0x01"), 0, 100)
+
+	l := &ExtractorServiceImpl{processor: processor, dao: &mockRdsService{}}
+	l.Reload(config.ExtractorOptions{EventDedupWindow: 20})
+
+	if processor.unknownTokens[unknown] {
+		t.Fatalf("unknown token should be resolved again after reload")
+	}
+	if processor.seenLogs.window != 20 || len(processor.seenLogs.seen) != 0 {
+		t.Fatalf("dedup records should be rebuilt with new window")
+	}
+	if processor.seenLogs.latest != 100 {
+		t.Fatalf("dedup high-water mark should be kept, got %d", processor.seenLogs.latest)
+	}
+}
+
+func TestAbiProcessor_EnabledHandlers(t *testing.T) {
+	initializeAccessorAbi(t)
+
+	options := &config.ExtractorOptions{EnabledHandlers: []string{
+		ethaccessor.METHOD_SUBMIT_RING, ethaccessor.EVENT_RING_MINED,
+		ethaccessor.METHOD_CANCEL_ORDER, ethaccessor.EVENT_ORDER_CANCELLED,
+	}}
+	processor := newAbiProcessor(&mockRdsService{}, options)
+	defer processor.Unload()
+
+	names := make(map[string]bool)
+	for _, evt := range processor.events {
+		names[evt.Name] = true
+	}
+	for _, method := range processor.methods {
+		names[method.Name] = true
+	}
+	if len(names) != 4 {
+		t.Fatalf("expect only ring and cancel handlers registered, got %v", names)
+	}
+	for _, name := range options.EnabledHandlers {
+		if !names[name] {
+			t.Fatalf("%s should be registered", name)
+		}
+	}
+
+	transferEvent := ethaccessor.Erc20Abi().Events[ethaccessor.EVENT_TRANSFER]
+	transferMethod := ethaccessor.Erc20Abi().Methods[ethaccessor.METHOD_TRANSFER]
+	if eventemitter.WatcherCount(transferEvent.Id().Hex()) != 0 || eventemitter.WatcherCount(common.ToHex(transferMethod.Id())) != 0 {
+		t.Fatalf("transfer handlers should not be registered")
+	}
+
+	var transfers int
+	watcher := &eventemitter.Watcher{Concurrent: false, Handle: func(input eventemitter.EventData) error {
+		transfers++
+		return nil
+	}}
+	eventemitter.On(eventemitter.Transfer, watcher)
+	defer eventemitter.Un(eventemitter.Transfer, watcher)
+
+	receiver := common.HexToAddress("0xb1018949b241D76A1AB2094f473E9bEfeAbB5Ead")
+	input, err := ethaccessor.Erc20Abi().Pack(ethaccessor.METHOD_TRANSFER, receiver, big.NewInt(100))
+	if err != nil {
+		t.Fatal(err)
+	}
+	tx := &ethaccessor.Transaction{
+		Hash:  "0x01",
+		From:  "0x1b978a1D302335a6F2Ebe4B8823B5E17c3C84135",
+		To:    "0xEF68e7C694F40c8202821eDF525dE3782458639f",
+		Input: common.ToHex(input),
+	}
+	receipt := &ethaccessor.TransactionReceipt{
+		Status: types.NewBigPtr(big.NewInt(1)),
+		Logs: []ethaccessor.Log{{
+			Address: tx.To,
+			Topics:  []string{transferEvent.Id().Hex(), common.BytesToHash(common.FromHex(tx.From)).Hex(), common.BytesToHash(receiver.Bytes()).Hex()},
+			Data:    common.ToHex(common.LeftPadBytes(big.NewInt(100).Bytes(), 32)),
+		}},
+	}
+
+	l := &ExtractorServiceImpl{processor: processor}
+	l.ProcessMinedTransaction(tx, receipt, big.NewInt(1520000000))
+	l.ProcessPendingTransaction(tx)
+	if transfers != 0 {
+		t.Fatalf("transfer should not be processed, got %d", transfers)
+	}
+}
+
+func TestAbiProcessor_ReloadProtocolSetChanged(t *testing.T) {
+	initializeAccessorAbi(t)
+
+	processor := newAbiProcessor(&mockRdsService{}, &config.ExtractorOptions{})
+	defer processor.Unload()
+
+	var changes []*types.ProtocolSetChangedEvent
+	watcher := &eventemitter.Watcher{Concurrent: false, Handle: func(input eventemitter.EventData) error {
+		changes = append(changes, input.(*types.ProtocolSetChangedEvent))
+		return nil
+	}}
+	eventemitter.On(eventemitter.ProtocolSetChanged, watcher)
+	defer eventemitter.Un(eventemitter.ProtocolSetChanged, watcher)
+
+	processor.Reload(&mockRdsService{}, &config.ExtractorOptions{})
+	if len(changes) != 0 {
+		t.Fatalf("reload without protocol change should not emit, got %d", len(changes))
+	}
+
+	// 新版本协议上线
+	protocol := common.HexToAddress("0x781870080C8C24a2FD6882296c49c837b06A65E6")
+	ethaccessor.ProtocolAddresses()[protocol] = &ethaccessor.ProtocolAddress{
+		Version:              "v2.0",
+		ContractAddress:      protocol,
+		DelegateAddress:      common.HexToAddress("0xC533531f4f291F036513f7Abd23bfc7f4D8aC780"),
+		TokenRegistryAddress: common.HexToAddress("0xE8C2F3Dd85B2B4dB4E4De7D6C0a5e7B1e6A2c3C4"),
+	}
+	defer delete(ethaccessor.ProtocolAddresses(), protocol)
+
+	processor.Reload(&mockRdsService{}, &config.ExtractorOptions{})
+	if len(changes) != 1 {
+		t.Fatalf("expect one protocol set change, got %d", len(changes))
+	}
+	if len(changes[0].Added) != 1 || changes[0].Added[0] != protocol || len(changes[0].Removed) != 0 {
+		t.Fatalf("expect %s added, got added:%v removed:%v", protocol.Hex(), changes[0].Added, changes[0].Removed)
+	}
+	if !processor.SupportedContract(protocol) {
+		t.Fatalf("new protocol should be loaded")
+	}
+
+	delete(ethaccessor.ProtocolAddresses(), protocol)
+	processor.Reload(&mockRdsService{}, &config.ExtractorOptions{})
+	if len(changes) != 2 || len(changes[1].Removed) != 1 || changes[1].Removed[0] != protocol {
+		t.Fatalf("expect %s removed", protocol.Hex())
+	}
+}
@@ -0,0 +1,169 @@
+/*
+
+  Copyright 2017 Loopring Project Ltd (Loopring Foundation).
+
+  Licensed under the Apache License, Version 2.0 (the "License");
+  you may not use this file except in compliance with the License.
+  You may obtain a copy of the License at
+
+  http://www.apache.org/licenses/LICENSE-2.0
+
+  Unless required by applicable law or agreed to in writing, software
+  distributed under the License is distributed on an "AS IS" BASIS,
+  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+  See the License for the specific language governing permissions and
+  limitations under the License.
+
+*/
+
+package extractor
+
+import (
+	"github.com/Loopring/relay/ethaccessor"
+	"github.com/Loopring/relay/eventemiter"
+	"github.com/Loopring/relay/log"
+	"github.com/Loopring/relay/types"
+	"math/big"
+	"sync"
+)
+
+const defaultReorgTrackDepth = 100
+
+type txFetcher func(txhash string) (*ethaccessor.Transaction, *ethaccessor.TransactionReceipt, error)
+
+// 记录最近区块中已发出的交易状态, 分叉时重新获取孤块内交易在新链上的状态
+type reorgTxTracker struct {
+	mtx     sync.Mutex
+	depth   int64
+	latest  int64
+	blocks  map[int64][]types.TxInfo
+	watcher *eventemitter.Watcher
+	fetch   txFetcher
+}
+
+func newReorgTxTracker(depth int64) *reorgTxTracker {
+	if depth <= 0 {
+		depth = defaultReorgTrackDepth
+	}
+
+	tracker := &reorgTxTracker{}
+	tracker.depth = depth
+	tracker.blocks = make(map[int64][]types.TxInfo)
+	tracker.fetch = fetchTransaction
+
+	return tracker
+}
+
+func (t *reorgTxTracker) Start() {
+	t.watcher = &eventemitter.Watcher{Concurrent: false, Handle: t.handleTransactionCompleted}
+	eventemitter.On(eventemitter.TransactionCompleted, t.watcher)
+}
+
+// 分叉重启时不清空记录, 更深的分叉仍需要之前区块的交易
+func (t *reorgTxTracker) Stop() {
+	eventemitter.Un(eventemitter.TransactionCompleted, t.watcher)
+}
+
+func (t *reorgTxTracker) handleTransactionCompleted(input eventemitter.EventData) error {
+	evt := input.(*types.TransactionCompletedEvent)
+	if evt.BlockNumber == nil || evt.Status == types.TX_STATUS_PENDING {
+		return nil
+	}
+
+	t.mtx.Lock()
+	defer t.mtx.Unlock()
+
+	number := evt.BlockNumber.Int64()
+	t.blocks[number] = append(t.blocks[number], evt.TxInfo)
+	if number > t.latest {
+		t.latest = number
+		for n := range t.blocks {
+			if n <= t.latest-t.depth {
+				delete(t.blocks, n)
+			}
+		}
+	}
+
+	return nil
+}
+
+// Reorg 孤块中交易状态变化时发出TransactionStateChanged
+func (t *reorgTxTracker) Reorg(forkEvent *types.ForkedEvent) {
+	forkNumber := forkEvent.ForkBlock.Int64()
+
+	var orphaned []types.TxInfo
+	t.mtx.Lock()
+	for n, txs := range t.blocks {
+		if n > forkNumber {
+			orphaned = append(orphaned, txs...)
+			delete(t.blocks, n)
+		}
+	}
+	t.latest = forkNumber
+	t.mtx.Unlock()
+
+	for _, old := range orphaned {
+		tx, receipt, err := t.fetch(old.TxHash.Hex())
+		if err != nil {
+			log.Errorf("extractor,reorg tx:%s get transaction error:%s", old.TxHash.Hex(), err.Error())
+			continue
+		}
+
+		var (
+			status      types.TxStatus
+			blockNumber *big.Int
+		)
+		switch {
+		case tx == nil:
+			status = types.TX_STATUS_UNKNOWN
+		case receipt == nil:
+			status = types.TX_STATUS_PENDING
+		case receipt.Failed(tx):
+			status = types.TX_STATUS_FAILED
+			blockNumber = receipt.BlockNumber.BigInt()
+		default:
+			status = types.TX_STATUS_SUCCESS
+			blockNumber = receipt.BlockNumber.BigInt()
+		}
+
+		if status == old.Status {
+			continue
+		}
+
+		log.Debugf("extractor,reorg tx:%s status changed from %s to %s", old.TxHash.Hex(), types.StatusStr(old.Status), types.StatusStr(status))
+		eventemitter.Emit(eventemitter.TransactionStateChanged, &types.TransactionStateChangedEvent{
+			TxHash:         old.TxHash,
+			From:           old.From,
+			To:             old.To,
+			OldStatus:      old.Status,
+			NewStatus:      status,
+			OldBlockNumber: old.BlockNumber,
+			NewBlockNumber: blockNumber,
+		})
+	}
+}
+
+// 新链上找不到交易时返回nil, 未打包时receipt为nil, 节点请求失败时返回error
+func fetchTransaction(txhash string) (*ethaccessor.Transaction, *ethaccessor.TransactionReceipt, error) {
+	var tx ethaccessor.Transaction
+	if err := ethaccessor.GetTransactionByHash(&tx, txhash, "latest"); err != nil {
+		if ethaccessor.IsNotFound(err) {
+			return nil, nil, nil
+		}
+		return nil, nil, err
+	}
+	if tx.IsPending() {
+		return &tx, nil, nil
+	}
+
+	// 交易已打包但节点还没有receipt(节点间同步延迟), 按未打包处理
+	var receipt ethaccessor.TransactionReceipt
+	if err := ethaccessor.GetTransactionReceipt(&receipt, txhash, "latest"); err != nil {
+		if ethaccessor.IsNotFound(err) {
+			return &tx, nil, nil
+		}
+		return nil, nil, err
+	}
+
+	return &tx, &receipt, nil
+}
@@ -0,0 +1,111 @@
+/*
+
+  Copyright 2017 Loopring Project Ltd (Loopring Foundation).
+
+  Licensed under the Apache License, Version 2.0 (the "License");
+  you may not use this file except in compliance with the License.
+  You may obtain a copy of the License at
+
+  http://www.apache.org/licenses/LICENSE-2.0
+
+  Unless required by applicable law or agreed to in writing, software
+  distributed under the License is distributed on an "AS IS" BASIS,
+  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+  See the License for the specific language governing permissions and
+  limitations under the License.
+
+*/
+
+package extractor
+
+import (
+	"fmt"
+	"github.com/Loopring/relay/config"
+	"github.com/Loopring/relay/dao"
+	"github.com/Loopring/relay/ethaccessor"
+	"github.com/Loopring/relay/eventemiter"
+	"github.com/Loopring/relay/types"
+	"github.com/ethereum/go-ethereum/common"
+	"math/big"
+	"testing"
+)
+
+type reorgRdsService struct {
+	dao.RdsService
+	blocks map[common.Hash]*dao.Block
+}
+
+func (s *reorgRdsService) FindBlockByHash(blockhash common.Hash) (*dao.Block, error) {
+	if block, ok := s.blocks[blockhash]; ok {
+		return block, nil
+	}
+	return nil, fmt.Errorf("block %s not found", blockhash.Hex())
+}
+
+func (s *reorgRdsService) SetForkBlock(from, to int64) error {
+	return nil
+}
+
+func TestExtractorServiceImpl_ReorgTransactionStateChanged(t *testing.T) {
+	var (
+		root     = &types.Block{BlockNumber: big.NewInt(5000009), BlockHash: common.HexToHash("0x09"), ParentHash: common.HexToHash("0x08")}
+		orphaned = &types.Block{BlockNumber: big.NewInt(5000010), BlockHash: common.HexToHash("0x0a"), ParentHash: root.BlockHash}
+		replaced = &types.Block{BlockNumber: big.NewInt(5000010), BlockHash: common.HexToHash("0x1a"), ParentHash: root.BlockHash}
+		txhash   = common.HexToHash("0xabcd")
+	)
+
+	rootModel := &dao.Block{}
+	rootModel.ConvertDown(root)
+	db := &reorgRdsService{blocks: map[common.Hash]*dao.Block{root.BlockHash: rootModel}}
+
+	l := &ExtractorServiceImpl{options: config.ExtractorOptions{ReorgTxCheck: true}, dao: db, processor: &AbiProcessor{}}
+	l.detector = &forkDetector{db: db, latestBlock: orphaned}
+	l.reorg = newReorgTxTracker(0)
+	l.reorg.fetch = func(hash string) (*ethaccessor.Transaction, *ethaccessor.TransactionReceipt, error) {
+		if hash != txhash.Hex() {
+			return nil, nil, fmt.Errorf("unexpected tx:%s", hash)
+		}
+		tx := &ethaccessor.Transaction{Hash: hash}
+		receipt := &ethaccessor.TransactionReceipt{TransactionHash: hash, Status: types.NewBigWithInt(0)}
+		receipt.BlockNumber.SetInt(big.NewInt(5000011))
+		return tx, receipt, nil
+	}
+	l.reorg.Start()
+	defer l.reorg.Stop()
+
+	var changed []*types.TransactionStateChangedEvent
+	watcher := &eventemitter.Watcher{Concurrent: false, Handle: func(input eventemitter.EventData) error {
+		changed = append(changed, input.(*types.TransactionStateChangedEvent))
+		return nil
+	}}
+	eventemitter.On(eventemitter.TransactionStateChanged, watcher)
+	defer eventemitter.Un(eventemitter.TransactionStateChanged, watcher)
+
+	// 交易在孤块中执行成功
+	completed := &types.TransactionCompletedEvent{}
+	completed.TxHash = txhash
+	completed.BlockNumber = orphaned.BlockNumber
+	completed.Status = types.TX_STATUS_SUCCESS
+	eventemitter.Emit(eventemitter.TransactionCompleted, completed)
+
+	if err := l.ForkProcess(replaced); err == nil {
+		t.Fatalf("fork should be detected")
+	}
+
+	if len(changed) != 1 {
+		t.Fatalf("expect 1 state change, got %d", len(changed))
+	}
+	evt := changed[0]
+	if evt.TxHash != txhash || evt.OldStatus != types.TX_STATUS_SUCCESS || evt.NewStatus != types.TX_STATUS_FAILED {
+		t.Fatalf("unexpected state change, tx:%s %s->%s", evt.TxHash.Hex(), types.StatusStr(evt.OldStatus), types.StatusStr(evt.NewStatus))
+	}
+	if evt.OldBlockNumber.Cmp(orphaned.BlockNumber) != 0 || evt.NewBlockNumber.Int64() != 5000011 {
+		t.Fatalf("unexpected block numbers %s->%s", evt.OldBlockNumber.String(), evt.NewBlockNumber.String())
+	}
+
+	// 同一分叉不再重复发出
+	l.reorg.Reorg(&types.ForkedEvent{ForkBlock: root.BlockNumber})
+	if len(changed) != 1 {
+		t.Fatalf("orphaned tx should only be checked once, got %d", len(changed))
+	}
+}
@@ -0,0 +1,126 @@
+/*
+
+  Copyright 2017 Loopring Project Ltd (Loopring Foundation).
+
+  Licensed under the Apache License, Version 2.0 (the "License");
+  you may not use this file except in compliance with the License.
+  You may obtain a copy of the License at
+
+  http://www.apache.org/licenses/LICENSE-2.0
+
+  Unless required by applicable law or agreed to in writing, software
+  distributed under the License is distributed on an "AS IS" BASIS,
+  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+  See the License for the specific language governing permissions and
+  limitations under the License.
+
+*/
+
+package extractor
+
+import (
+	"fmt"
+	"github.com/Loopring/relay/ethaccessor"
+	"github.com/Loopring/relay/log"
+	"github.com/ethereum/go-ethereum/common"
+	"math/big"
+)
+
+// 已重放交易的记录上限, 下游按Replay标记去重, 超出后被淘汰的交易再次重放也不会重复入库
+const maxReplayedTxs = 100000
+
+// ReplayBlocks 同步重新处理[from, to]之间的历史区块, 用于修复bug后重新提取数据.
+// 不保存区块, 不做分叉检测, 也不发出Block_New/Block_End; 发出的事件带Replay标记, 已重放过的交易直接跳过.
+// 每个区块与正常扫块互斥执行
+func (l *ExtractorServiceImpl) ReplayBlocks(from, to *big.Int) error {
+	if from == nil || to == nil || from.Cmp(to) > 0 {
+		return fmt.Errorf("extractor,invalid replay range")
+	}
+
+	for number := new(big.Int).Set(from); number.Cmp(to) <= 0; number = new(big.Int).Add(number, big.NewInt(1)) {
+		block, err := l.getBlock(number)
+		if err != nil {
+			return fmt.Errorf("extractor,replay block:%s error:%s", number.String(), err.Error())
+		}
+		if len(block.Receipts) != len(block.Transactions) {
+			return fmt.Errorf("extractor,replay block:%s receipts number %d not match transactions %d", number.String(), len(block.Receipts), len(block.Transactions))
+		}
+		l.replayBlock(block)
+	}
+
+	return nil
+}
+
+func (l *ExtractorServiceImpl) replayBlock(block *ethaccessor.BlockWithTxAndReceipt) {
+	l.processMtx.Lock()
+	defer l.processMtx.Unlock()
+
+	log.Infof("extractor,replay block:%s->%s, transaction number:%d", block.Number.BigInt().String(), block.Hash.Hex(), len(block.Transactions))
+
+	for idx := range block.Transactions {
+		l.metrics.setQueueDepth(len(block.Transactions) - idx)
+		tx := &block.Transactions[idx]
+		txhash := common.HexToHash(tx.Hash)
+		if !l.markReplayed(txhash) {
+			l.debug("extractor,tx:%s already replayed", tx.Hash)
+			continue
+		}
+
+		l.processor.beginReplay(txhash)
+		l.ProcessMinedTransaction(tx, &block.Receipts[idx], block.Timestamp.BigInt())
+		l.processor.endReplay(txhash)
+	}
+	l.metrics.setQueueDepth(0)
+}
+
+func (l *ExtractorServiceImpl) markReplayed(txhash common.Hash) bool {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+
+	if l.replayed[txhash] {
+		return false
+	}
+	l.replayed[txhash] = true
+	l.replayedOrder = append(l.replayedOrder, txhash)
+	if len(l.replayedOrder) > maxReplayedTxs {
+		delete(l.replayed, l.replayedOrder[0])
+		l.replayedOrder = l.replayedOrder[1:]
+	}
+	return true
+}
+
+func getFullBlock(blockNumber *big.Int) (*ethaccessor.BlockWithTxAndReceipt, error) {
+	inter, err := ethaccessor.GetFullBlock(blockNumber, true)
+	if err != nil {
+		return nil, err
+	}
+	block, ok := inter.(*ethaccessor.BlockWithTxAndReceipt)
+	if !ok {
+		return nil, fmt.Errorf("extractor,block:%s without transactions", blockNumber.String())
+	}
+	return block, nil
+}
+
+func (processor *AbiProcessor) beginReplay(txhash common.Hash) {
+	processor.replayMtx.Lock()
+	defer processor.replayMtx.Unlock()
+
+	if processor.replayTxs == nil {
+		processor.replayTxs = make(map[common.Hash]bool)
+	}
+	processor.replayTxs[txhash] = true
+}
+
+func (processor *AbiProcessor) endReplay(txhash common.Hash) {
+	processor.replayMtx.Lock()
+	defer processor.replayMtx.Unlock()
+
+	delete(processor.replayTxs, txhash)
+}
+
+func (processor *AbiProcessor) isReplay(txhash common.Hash) bool {
+	processor.replayMtx.RLock()
+	defer processor.replayMtx.RUnlock()
+
+	return processor.replayTxs[txhash]
+}
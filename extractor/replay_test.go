@@ -0,0 +1,123 @@
+/*
+
+  Copyright 2017 Loopring Project Ltd (Loopring Foundation).
+
+  Licensed under the Apache License, Version 2.0 (the "License");
+  you may not use this file except in compliance with the License.
+  You may obtain a copy of the License at
+
+  http://www.apache.org/licenses/LICENSE-2.0
+
+  Unless required by applicable law or agreed to in writing, software
+  distributed under the License is distributed on an "AS IS" BASIS,
+  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+  See the License for the specific language governing permissions and
+  limitations under the License.
+
+*/
+
+package extractor
+
+import (
+	"fmt"
+	"github.com/Loopring/relay/config"
+	"github.com/Loopring/relay/ethaccessor"
+	"github.com/Loopring/relay/eventemiter"
+	"github.com/Loopring/relay/types"
+	"github.com/ethereum/go-ethereum/common"
+	"math/big"
+	"testing"
+)
+
+func TestExtractorServiceImpl_ReplayBlocks(t *testing.T) {
+	initializeAccessorAbi(t)
+	lrc, _ := setupMarketTokens()
+
+	processor := newAbiProcessor(&mockRdsService{}, &config.ExtractorOptions{})
+	defer processor.Unload()
+
+	var (
+		sender        = common.HexToAddress("0x1b978a1D302335a6F2Ebe4B8823B5E17c3C84135")
+		receiver      = common.HexToAddress("0xb1018949b241D76A1AB2094f473E9bEfeAbB5Ead")
+		transferEvent = ethaccessor.Erc20Abi().Events[ethaccessor.EVENT_TRANSFER]
+	)
+	input, err := ethaccessor.Erc20Abi().Pack(ethaccessor.METHOD_TRANSFER, receiver, big.NewInt(100))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// 10-12块各一笔lrc转账
+	blocks := make(map[int64]*ethaccessor.BlockWithTxAndReceipt)
+	for number := int64(10); number <= 12; number++ {
+		tx := ethaccessor.Transaction{
+			Hash:        common.BigToHash(big.NewInt(number)).Hex(),
+			From:        sender.Hex(),
+			To:          lrc.Protocol.Hex(),
+			Input:       common.ToHex(input),
+			BlockNumber: *types.NewBigPtr(big.NewInt(number)),
+		}
+		receipt := ethaccessor.TransactionReceipt{
+			Status:  types.NewBigPtr(big.NewInt(1)),
+			GasUsed: *types.NewBigPtr(big.NewInt(50000)),
+			Logs: []ethaccessor.Log{{
+				Address: tx.To,
+				Topics:  []string{transferEvent.Id().Hex(), common.BytesToHash(sender.Bytes()).Hex(), common.BytesToHash(receiver.Bytes()).Hex()},
+				Data:    common.ToHex(common.LeftPadBytes(big.NewInt(100).Bytes(), 32)),
+			}},
+		}
+		block := &ethaccessor.BlockWithTxAndReceipt{Transactions: []ethaccessor.Transaction{tx}, Receipts: []ethaccessor.TransactionReceipt{receipt}}
+		block.Number = *types.NewBigPtr(big.NewInt(number))
+		block.Timestamp = *types.NewBigPtr(big.NewInt(1520000000 + number))
+		blocks[number] = block
+	}
+
+	var transfers []*types.TransferEvent
+	watcher := &eventemitter.Watcher{Concurrent: false, Handle: func(input eventemitter.EventData) error {
+		transfers = append(transfers, input.(*types.TransferEvent))
+		return nil
+	}}
+	eventemitter.On(eventemitter.Transfer, watcher)
+	defer eventemitter.Un(eventemitter.Transfer, watcher)
+
+	l := &ExtractorServiceImpl{processor: processor, replayed: make(map[common.Hash]bool)}
+	l.getBlock = func(blockNumber *big.Int) (*ethaccessor.BlockWithTxAndReceipt, error) {
+		block, ok := blocks[blockNumber.Int64()]
+		if !ok {
+			return nil, fmt.Errorf("block %s not found", blockNumber.String())
+		}
+		return block, nil
+	}
+
+	if err := l.ReplayBlocks(big.NewInt(10), big.NewInt(12)); err != nil {
+		t.Fatal(err)
+	}
+	if len(transfers) != 3 {
+		t.Fatalf("expect 3 transfers replayed, got %d", len(transfers))
+	}
+	for i, v := range transfers {
+		if !v.Replay {
+			t.Fatalf("replayed transfer should be flagged")
+		}
+		if v.BlockNumber.Int64() != int64(10+i) {
+			t.Fatalf("transfers should be replayed in block order, got %s at %d", v.BlockNumber.String(), i)
+		}
+	}
+
+	// 已重放的交易不再发出
+	if err := l.ReplayBlocks(big.NewInt(11), big.NewInt(12)); err != nil {
+		t.Fatal(err)
+	}
+	if len(transfers) != 3 {
+		t.Fatalf("replay should be idempotent, got %d transfers", len(transfers))
+	}
+
+	if err := l.ReplayBlocks(big.NewInt(12), big.NewInt(13)); err == nil {
+		t.Fatalf("missing block should return error")
+	}
+
+	// 正常处理不带重放标记
+	l.ProcessMinedTransaction(&blocks[10].Transactions[0], &blocks[10].Receipts[0], big.NewInt(1520000010))
+	if len(transfers) != 4 || transfers[3].Replay {
+		t.Fatalf("live transfer should not be flagged as replay")
+	}
+}
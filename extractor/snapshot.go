@@ -0,0 +1,123 @@
+/*
+
+  Copyright 2017 Loopring Project Ltd (Loopring Foundation).
+
+  Licensed under the Apache License, Version 2.0 (the "License");
+  you may not use this file except in compliance with the License.
+  You may obtain a copy of the License at
+
+  http://www.apache.org/licenses/LICENSE-2.0
+
+  Unless required by applicable law or agreed to in writing, software
+  distributed under the License is distributed on an "AS IS" BASIS,
+  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+  See the License for the specific language governing permissions and
+  limitations under the License.
+
+*/
+
+package extractor
+
+import (
+	"encoding/json"
+	"github.com/Loopring/relay/log"
+	"github.com/Loopring/relay/market/util"
+	"github.com/ethereum/go-ethereum/common"
+	"io/ioutil"
+	"os"
+)
+
+// 重启时直接恢复processor中链上获取的delegate及合约地址表, 跳过重新查询.
+// token表以启动时util中的token为准, 不保存在快照中, 避免恢复已移除或已验证的token
+// 旧版本快照中map格式的contract_codes不再读取, 恢复后按需重新查询
+type processorSnapshot struct {
+	Delegates         map[common.Address]string         `json:"delegates"`
+	DelegateProtocols map[common.Address]common.Address `json:"delegate_protocols"`
+	ContractCodes     []contractCode                    `json:"contract_code_list"` // 按访问时间从旧到新
+	LatestBlock       int64                             `json:"latest_block"`       // 日志去重记录的最高区块
+}
+
+func (processor *AbiProcessor) SnapshotState() ([]byte, error) {
+	var snapshot processorSnapshot
+
+	if processor.contractCodes != nil {
+		snapshot.ContractCodes = processor.contractCodes.entries()
+	}
+	if processor.seenLogs != nil {
+		processor.seenLogs.mtx.Lock()
+		snapshot.LatestBlock = processor.seenLogs.latest
+		processor.seenLogs.mtx.Unlock()
+	}
+
+	processor.delegateMtx.RLock()
+	defer processor.delegateMtx.RUnlock()
+	snapshot.Delegates = processor.delegates
+	snapshot.DelegateProtocols = processor.delegateProtocols
+
+	return json.Marshal(&snapshot)
+}
+
+func (processor *AbiProcessor) RestoreState(data []byte) error {
+	var snapshot processorSnapshot
+	if err := json.Unmarshal(data, &snapshot); err != nil {
+		return err
+	}
+
+	// token表由util重建, loopring合约地址由调用方按配置加载
+	processor.protocols = make(map[common.Address]string)
+	for _, v := range util.AllTokens() {
+		processor.loadTokenAddress(v.Protocol, v.Symbol)
+	}
+	var cacheSize int
+	if processor.options != nil {
+		cacheSize = processor.options.ContractCodeCacheSize
+	}
+	processor.contractCodes = newContractCodeCache(cacheSize)
+	for _, v := range snapshot.ContractCodes {
+		processor.contractCodes.add(v.Address, v.IsContract)
+	}
+	if processor.seenLogs != nil {
+		processor.seenLogs.mtx.Lock()
+		processor.seenLogs.latest = snapshot.LatestBlock
+		processor.seenLogs.mtx.Unlock()
+	}
+
+	processor.delegateMtx.Lock()
+	defer processor.delegateMtx.Unlock()
+	processor.delegates = make(map[common.Address]string)
+	for k, v := range snapshot.Delegates {
+		processor.delegates[k] = v
+	}
+	processor.delegateProtocols = make(map[common.Address]common.Address)
+	for k, v := range snapshot.DelegateProtocols {
+		processor.delegateProtocols[k] = v
+	}
+
+	return nil
+}
+
+func (processor *AbiProcessor) saveSnapshot(file string) error {
+	data, err := processor.SnapshotState()
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(file, data, 0644)
+}
+
+// loadSnapshot 快照不存在或无效时返回false, 由调用方重新构建
+func (processor *AbiProcessor) loadSnapshot(file string) bool {
+	data, err := ioutil.ReadFile(file)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			log.Errorf("extractor,read snapshot %s error:%s", file, err.Error())
+		}
+		return false
+	}
+	if err := processor.RestoreState(data); err != nil {
+		log.Errorf("extractor,restore snapshot %s error:%s", file, err.Error())
+		return false
+	}
+
+	log.Infof("extractor,restored %d delegates and %d contract codes from snapshot %s", len(processor.delegates), processor.contractCodes.len(), file)
+	return true
+}
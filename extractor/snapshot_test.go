@@ -0,0 +1,129 @@
+/*
+
+  Copyright 2017 Loopring Project Ltd (Loopring Foundation).
+
+  Licensed under the Apache License, Version 2.0 (the "License");
+  you may not use this file except in compliance with the License.
+  You may obtain a copy of the License at
+
+  http://www.apache.org/licenses/LICENSE-2.0
+
+  Unless required by applicable law or agreed to in writing, software
+  distributed under the License is distributed on an "AS IS" BASIS,
+  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+  See the License for the specific language governing permissions and
+  limitations under the License.
+
+*/
+
+package extractor
+
+import (
+	"github.com/ethereum/go-ethereum/common"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestAbiProcessor_SnapshotAndRestoreState(t *testing.T) {
+	lrc, weth := setupMarketTokens()
+	protocol := common.HexToAddress("0x781870080C8C24a2FD6882296c49c837b06A65E6")
+	delegate := common.HexToAddress("0xC533531f4f291F036513f7Abd7d8fd3f23d25d74")
+	unknown := common.HexToAddress("0x1B793201a2Ed5bC6bb5fE96B6e8Bd5F6B0b24A0d")
+	removed := common.HexToAddress("0x255Aa6DF07540Cb5d3d297f0D0D4D84cb52bc8e6")
+	wallet := common.HexToAddress("0x4Ec94E1007605D70a86279370ec5e4b755295eDA")
+
+	processor := &AbiProcessor{
+		protocols:         map[common.Address]string{protocol: "loopring", lrc.Protocol: "LRC", removed: "RDN"},
+		delegates:         map[common.Address]string{delegate: "v1.5"},
+		delegateProtocols: map[common.Address]common.Address{delegate: protocol},
+		unknownTokens:     map[common.Address]bool{unknown: true},
+		contractCodes:     newContractCodeCache(0),
+		seenLogs:          newSeenLogs(10),
+	}
+	processor.contractCodes.add(protocol, true)
+	processor.contractCodes.add(wallet, false)
+	processor.seenLogs.latest = 4500000
+
+	data, err := processor.SnapshotState()
+	if err != nil {
+		t.Fatalf("snapshot error:%s", err.Error())
+	}
+
+	restored := &AbiProcessor{unknownTokens: make(map[common.Address]bool), seenLogs: newSeenLogs(10)}
+	if err := restored.RestoreState(data); err != nil {
+		t.Fatalf("restore error:%s", err.Error())
+	}
+
+	// token表以util为准, 快照中已移除的token不恢复
+	expectProtocols := map[common.Address]string{lrc.Protocol: "LRC", weth.Protocol: "WETH"}
+	if !reflect.DeepEqual(expectProtocols, restored.protocols) {
+		t.Fatalf("token protocols should be rebuilt from util, got %v", restored.protocols)
+	}
+	if len(restored.unknownTokens) != 0 {
+		t.Fatalf("unknown tokens should not be restored, got %v", restored.unknownTokens)
+	}
+	if !reflect.DeepEqual(processor.delegates, restored.delegates) {
+		t.Fatalf("delegates not restored, got %v", restored.delegates)
+	}
+	if !reflect.DeepEqual(processor.delegateProtocols, restored.delegateProtocols) {
+		t.Fatalf("delegate protocols not restored, got %v", restored.delegateProtocols)
+	}
+	if !reflect.DeepEqual(processor.contractCodes.entries(), restored.contractCodes.entries()) {
+		t.Fatalf("contract codes not restored, got %v", restored.contractCodes.entries())
+	}
+	if restored.seenLogs.latest != 4500000 {
+		t.Fatalf("latest block should be 4500000, got %d", restored.seenLogs.latest)
+	}
+	if !restored.HasSpender(delegate) {
+		t.Fatalf("restored processor should recognize delegate")
+	}
+
+	// 恢复后的表与原processor互不影响
+	restored.contractCodes.add(unknown, true)
+	if _, ok := processor.contractCodes.get(unknown); ok {
+		t.Fatalf("restored contract codes should not share cache with snapshot source")
+	}
+}
+
+func TestAbiProcessor_SnapshotFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "extractor-snapshot")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	file := filepath.Join(dir, "processor.json")
+
+	fresh := &AbiProcessor{seenLogs: newSeenLogs(10)}
+	if fresh.loadSnapshot(file) {
+		t.Fatalf("missing snapshot should not be loaded")
+	}
+
+	delegate := common.HexToAddress("0xC533531f4f291F036513f7Abd7d8fd3f23d25d74")
+	processor := &AbiProcessor{
+		protocols:         map[common.Address]string{},
+		delegates:         map[common.Address]string{delegate: "v1.5"},
+		delegateProtocols: map[common.Address]common.Address{},
+		unknownTokens:     map[common.Address]bool{},
+		contractCodes:     newContractCodeCache(0),
+	}
+	if err := processor.saveSnapshot(file); err != nil {
+		t.Fatalf("save snapshot error:%s", err.Error())
+	}
+
+	if !fresh.loadSnapshot(file) {
+		t.Fatalf("snapshot should be loaded")
+	}
+	if !fresh.HasSpender(delegate) {
+		t.Fatalf("delegate should be restored from file")
+	}
+
+	if err := ioutil.WriteFile(file, []byte("not json"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if (&AbiProcessor{}).loadSnapshot(file) {
+		t.Fatalf("invalid snapshot should not be loaded")
+	}
+}
@@ -0,0 +1,79 @@
+/*
+
+  Copyright 2017 Loopring Project Ltd (Loopring Foundation).
+
+  Licensed under the Apache License, Version 2.0 (the "License");
+  you may not use this file except in compliance with the License.
+  You may obtain a copy of the License at
+
+  http://www.apache.org/licenses/LICENSE-2.0
+
+  Unless required by applicable law or agreed to in writing, software
+  distributed under the License is distributed on an "AS IS" BASIS,
+  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+  See the License for the specific language governing permissions and
+  limitations under the License.
+
+*/
+
+package extractor
+
+import (
+	"github.com/Loopring/relay/log"
+	"github.com/ethereum/go-ethereum/common"
+	"sync"
+)
+
+// 垃圾/空投token合约, 其transfer/approve直接丢弃, 不发出也不记录
+type spamContracts struct {
+	mtx sync.RWMutex
+	set map[common.Address]bool
+}
+
+func (s *spamContracts) contains(protocol common.Address) bool {
+	s.mtx.RLock()
+	defer s.mtx.RUnlock()
+	return s.set[protocol]
+}
+
+func (s *spamContracts) reset(list []common.Address) {
+	set := make(map[common.Address]bool)
+	for _, v := range list {
+		set[v] = true
+	}
+
+	s.mtx.Lock()
+	s.set = set
+	s.mtx.Unlock()
+}
+
+func spamContractAddresses(list []string) []common.Address {
+	var addresses []common.Address
+	for _, v := range list {
+		if !common.IsHexAddress(v) {
+			log.Errorf("extractor,spam contract %s is not a valid address", v)
+			continue
+		}
+		addresses = append(addresses, common.HexToAddress(v))
+	}
+	return addresses
+}
+
+// SetSpamContracts 运行时替换垃圾token合约列表, 无需重启, Reload时以配置为准
+func (processor *AbiProcessor) SetSpamContracts(list []common.Address) {
+	processor.spam.reset(list)
+	log.Infof("extractor,spam contracts updated, %d contracts", len(list))
+}
+
+func (processor *AbiProcessor) isSpamContract(txhash common.Hash, protocol common.Address) bool {
+	if !processor.spam.contains(protocol) {
+		return false
+	}
+	log.Debugf("extractor,tx:%s contract:%s is spam, dropped", txhash.Hex(), protocol.Hex())
+	return true
+}
+
+// SetSpamContracts 可与区块处理并发调用
+func (l *ExtractorServiceImpl) SetSpamContracts(list []common.Address) {
+	l.processor.SetSpamContracts(list)
+}
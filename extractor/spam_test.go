@@ -0,0 +1,108 @@
+/*
+
+  Copyright 2017 Loopring Project Ltd (Loopring Foundation).
+
+  Licensed under the Apache License, Version 2.0 (the "License");
+  you may not use this file except in compliance with the License.
+  You may obtain a copy of the License at
+
+  http://www.apache.org/licenses/LICENSE-2.0
+
+  Unless required by applicable law or agreed to in writing, software
+  distributed under the License is distributed on an "AS IS" BASIS,
+  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+  See the License for the specific language governing permissions and
+  limitations under the License.
+
+*/
+
+package extractor
+
+import (
+	"context"
+	"github.com/Loopring/relay/config"
+	"github.com/Loopring/relay/ethaccessor"
+	"github.com/Loopring/relay/eventemiter"
+	"github.com/Loopring/relay/types"
+	"github.com/ethereum/go-ethereum/common"
+	"math/big"
+	"testing"
+)
+
+func TestAbiProcessor_SpamContracts(t *testing.T) {
+	setupMarketTokens()
+	defer setupMarketTokens()
+
+	cfg := config.LoadConfig("../config/relay.toml")
+	erc20Abi, err := ethaccessor.NewAbi(cfg.Common.Erc20Abi)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var emitted []eventemitter.EventData
+	watcher := &eventemitter.Watcher{Concurrent: false, Handle: func(input eventemitter.EventData) error {
+		emitted = append(emitted, input)
+		return nil
+	}}
+	for _, topic := range []string{eventemitter.Transfer, eventemitter.ContractTransfer, eventemitter.TokenSupply, eventemitter.Approve, eventemitter.AllowanceChanged} {
+		eventemitter.On(topic, watcher)
+		defer eventemitter.Un(topic, watcher)
+	}
+
+	spam := common.HexToAddress("0x0f4f6fd0ab1e7f4a6ba2b4fc1c4a7a0fd5e2a1c3")
+	var resolved int
+	processor := &AbiProcessor{
+		unknownTokens: make(map[common.Address]bool),
+		erc20Symbol: func(ctx context.Context, tokenAddress common.Address, blockParameter string) (string, error) {
+			resolved++
+			return "AIR", nil
+		},
+		erc20Decimals: func(ctx context.Context, tokenAddress common.Address, blockParameter string) (uint8, error) {
+			return 18, nil
+		},
+	}
+	processor.SetSpamContracts([]common.Address{spam})
+
+	transfer := func() {
+		var data EventData
+		data.Protocol = spam
+		data.TxHash = common.HexToHash("0x01")
+		data.Event = &ethaccessor.TransferEvent{Value: big.NewInt(1000)}
+		data.Topics = []string{"", types.NilHash.Hex(), common.HexToHash("0x02").Hex()}
+		processor.handleTransferEvent(data)
+	}
+	approval := func() {
+		var data EventData
+		data.Protocol = spam
+		data.TxHash = common.HexToHash("0x03")
+		data.Event = &ethaccessor.ApprovalEvent{Value: big.NewInt(1000)}
+		data.Topics = []string{"", common.HexToHash("0x02").Hex(), common.HexToHash("0x04").Hex()}
+		processor.handleApprovalEvent(data)
+	}
+	allowanceChange := func() {
+		increase := erc20Abi.Methods[ethaccessor.METHOD_INCREASE_APPROVAL]
+		data := newMethodData(&increase, erc20Abi)
+		data.Method = &ethaccessor.AllowanceChangeMethod{}
+		data.Protocol = spam
+		data.TxHash = common.HexToHash("0x05")
+		data.Status = types.TX_STATUS_SUCCESS
+		data.Input = "0xd73dd623" +
+			"00000000000000000000000045aa504eb94077eec4bf95a10095a8e3196fc591" +
+			"0000000000000000000000000000000000000000000000008ac7230489e80000"
+		processor.handleAllowanceChangeMethod(data)
+	}
+
+	transfer()
+	approval()
+	allowanceChange()
+	if len(emitted) != 0 || resolved != 0 || len(processor.unknownTokens) != 0 {
+		t.Fatalf("spam contract events should be fully dropped, got %d events %d resolved", len(emitted), resolved)
+	}
+
+	// 运行时移除后恢复处理
+	processor.SetSpamContracts(nil)
+	transfer()
+	if len(emitted) == 0 || resolved != 1 {
+		t.Fatalf("transfer should be processed after contract removed from spam list, got %d events", len(emitted))
+	}
+}
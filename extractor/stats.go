@@ -0,0 +1,113 @@
+/*
+
+  Copyright 2017 Loopring Project Ltd (Loopring Foundation).
+
+  Licensed under the Apache License, Version 2.0 (the "License");
+  you may not use this file except in compliance with the License.
+  You may obtain a copy of the License at
+
+  http://www.apache.org/licenses/LICENSE-2.0
+
+  Unless required by applicable law or agreed to in writing, software
+  distributed under the License is distributed on an "AS IS" BASIS,
+  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+  See the License for the specific language governing permissions and
+  limitations under the License.
+
+*/
+
+package extractor
+
+import (
+	"github.com/Loopring/relay/eventemiter"
+	"sync"
+	"sync/atomic"
+)
+
+// Stats中错误计数的key, 包括handler返回的错误及method/event解析失败
+const StatsErrorKey = "errors"
+
+// statsRegistry 进程内的MetricsRegistry实现, 按名称保存计数供Stats读取, Reload后继续累计
+type statsRegistry struct {
+	mtx      sync.Mutex
+	counters map[string]*statsCounter
+}
+
+type statsCounter struct {
+	value uint64
+}
+
+func (c *statsCounter) Inc() {
+	atomic.AddUint64(&c.value, 1)
+}
+
+// Stats只统计数量, gauge不保存
+type statsGauge struct{}
+
+func (statsGauge) Set(value float64) {}
+
+func newStatsRegistry() *statsRegistry {
+	return &statsRegistry{counters: make(map[string]*statsCounter)}
+}
+
+// Counter 同名counter只创建一次, Reload重新注册handler时沿用原计数
+func (r *statsRegistry) Counter(name, help string) MetricsCounter {
+	r.mtx.Lock()
+	defer r.mtx.Unlock()
+
+	if c, ok := r.counters[name]; ok {
+		return c
+	}
+	c := &statsCounter{}
+	r.counters[name] = c
+	return c
+}
+
+func (r *statsRegistry) Gauge(name, help string) MetricsGauge {
+	return statsGauge{}
+}
+
+// wrap 统计handler的调用次数, 返回错误时同时计入MetricHandlerErrors
+func (r *statsRegistry) wrap(name string, handle func(eventemitter.EventData) error) func(eventemitter.EventData) error {
+	if r == nil || handle == nil {
+		return handle
+	}
+	handled := r.Counter(name, "contract event or method handled by extractor")
+	errors := r.Counter(MetricHandlerErrors, "contract event or method handlers returned error")
+	return func(input eventemitter.EventData) error {
+		err := handle(input)
+		handled.Inc()
+		if err != nil {
+			errors.Inc()
+		}
+		return err
+	}
+}
+
+// Stats 返回各合约event/method已处理数量的快照, key为名称, 如RingMined/Transfer/Approval
+// handler错误与解析失败(MetricDecodeFailures)合并计入StatsErrorKey, 其余extractor指标不返回
+func (processor *AbiProcessor) Stats() map[string]uint64 {
+	ret := make(map[string]uint64)
+	if processor.stats == nil {
+		return ret
+	}
+
+	processor.stats.mtx.Lock()
+	defer processor.stats.mtx.Unlock()
+	for k, c := range processor.stats.counters {
+		value := atomic.LoadUint64(&c.value)
+		switch k {
+		case MetricHandlerErrors, MetricDecodeFailures:
+			ret[StatsErrorKey] += value
+		case MetricEventsProcessed:
+		default:
+			ret[k] = value
+		}
+	}
+	for k, v := range ret {
+		if v == 0 {
+			delete(ret, k)
+		}
+	}
+	return ret
+}
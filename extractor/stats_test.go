@@ -0,0 +1,92 @@
+/*
+
+  Copyright 2017 Loopring Project Ltd (Loopring Foundation).
+
+  Licensed under the Apache License, Version 2.0 (the "License");
+  you may not use this file except in compliance with the License.
+  You may obtain a copy of the License at
+
+  http://www.apache.org/licenses/LICENSE-2.0
+
+  Unless required by applicable law or agreed to in writing, software
+  distributed under the License is distributed on an "AS IS" BASIS,
+  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+  See the License for the specific language governing permissions and
+  limitations under the License.
+
+*/
+
+package extractor
+
+import (
+	"github.com/Loopring/relay/config"
+	"github.com/Loopring/relay/ethaccessor"
+	"github.com/Loopring/relay/eventemiter"
+	"github.com/ethereum/go-ethereum/common"
+	"math/big"
+	"testing"
+)
+
+func TestAbiProcessor_Stats(t *testing.T) {
+	initializeAccessorAbi(t)
+	lrc, _ := setupMarketTokens()
+
+	processor := newAbiProcessor(&mockRdsService{}, &config.ExtractorOptions{})
+	defer processor.Unload()
+	// 解析失败由extractor指标统计, 与Stats共用processor的counter
+	metrics := newExtractorMetrics(processor.stats)
+	metrics.Start()
+	defer metrics.Stop()
+
+	if stats := processor.Stats(); len(stats) != 0 {
+		t.Fatalf("stats should be empty before any event, got %v", stats)
+	}
+
+	var transfer EventData
+	for _, v := range processor.events {
+		if v.Name == ethaccessor.EVENT_TRANSFER {
+			transfer = v
+		}
+	}
+	var submitRing MethodData
+	for _, v := range processor.methods {
+		if v.Name == ethaccessor.METHOD_SUBMIT_RING {
+			submitRing = v
+		}
+	}
+
+	for i := 0; i < 3; i++ {
+		data := transfer
+		data.Protocol = lrc.Protocol
+		data.Event = &ethaccessor.TransferEvent{Value: big.NewInt(100)}
+		data.Topics = []string{"", common.HexToHash("0x01").Hex(), common.HexToHash("0x02").Hex()}
+		eventemitter.Emit(data.Id.Hex(), data)
+	}
+
+	// 解析失败计入错误数
+	method := submitRing
+	method.Input = "0x1234"
+	eventemitter.Emit(method.Id, method)
+
+	metrics.eventProcessed()
+
+	stats := processor.Stats()
+	if _, ok := stats[MetricEventsProcessed]; ok {
+		t.Errorf("extractor metrics should not be returned as event stats")
+	}
+	if stats[ethaccessor.EVENT_TRANSFER] != 3 {
+		t.Errorf("expect 3 transfer events, got %d", stats[ethaccessor.EVENT_TRANSFER])
+	}
+	if stats[ethaccessor.METHOD_SUBMIT_RING] != 1 {
+		t.Errorf("expect 1 submitRing method, got %d", stats[ethaccessor.METHOD_SUBMIT_RING])
+	}
+	if stats[StatsErrorKey] != 1 {
+		t.Errorf("expect 1 error, got %d", stats[StatsErrorKey])
+	}
+
+	// 返回的是快照
+	stats[ethaccessor.EVENT_TRANSFER] = 0
+	if processor.Stats()[ethaccessor.EVENT_TRANSFER] != 3 {
+		t.Errorf("modify returned stats should not affect processor")
+	}
+}
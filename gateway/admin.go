@@ -0,0 +1,78 @@
+/*
+
+  Copyright 2017 Loopring Project Ltd (Loopring Foundation).
+
+  Licensed under the Apache License, Version 2.0 (the "License");
+  you may not use this file except in compliance with the License.
+  You may obtain a copy of the License at
+
+  http://www.apache.org/licenses/LICENSE-2.0
+
+  Unless required by applicable law or agreed to in writing, software
+  distributed under the License is distributed on an "AS IS" BASIS,
+  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+  See the License for the specific language governing permissions and
+  limitations under the License.
+
+*/
+
+package gateway
+
+import (
+	"errors"
+	"fmt"
+	"github.com/Loopring/relay/log"
+	"github.com/ethereum/go-ethereum/rpc"
+	"math/big"
+	"net"
+	"net/http"
+)
+
+// BlockReplayer 重新处理历史区块, 由extractor实现
+type BlockReplayer interface {
+	ReplayBlocks(from, to *big.Int) error
+}
+
+// AdminServiceImpl 运维接口, 只监听127.0.0.1, 不对外开放
+type AdminServiceImpl struct {
+	port     string
+	replayer BlockReplayer
+}
+
+func NewAdminService(port string, replayer BlockReplayer) *AdminServiceImpl {
+	a := &AdminServiceImpl{}
+	a.port = port
+	a.replayer = replayer
+	return a
+}
+
+// ReplayBlocks 同步重放[from, to]之间的区块, 完成后返回
+func (a *AdminServiceImpl) ReplayBlocks(from, to int64) (string, error) {
+	if a.replayer == nil {
+		return "", errors.New("extractor not started")
+	}
+	if err := a.replayer.ReplayBlocks(big.NewInt(from), big.NewInt(to)); err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("replayed blocks %d-%d", from, to), nil
+}
+
+func (a *AdminServiceImpl) Start() {
+	if a.port == "" {
+		return
+	}
+
+	handler := rpc.NewServer()
+	if err := handler.RegisterName("admin", a); err != nil {
+		log.Errorf("admin rpc register error:%s", err.Error())
+		return
+	}
+
+	listener, err := net.Listen("tcp", "127.0.0.1:"+a.port)
+	if err != nil {
+		log.Errorf("admin rpc listen error:%s", err.Error())
+		return
+	}
+	go (&http.Server{Handler: handler}).Serve(listener)
+	log.Infof("admin HTTP endpoint opened on 127.0.0.1:%s", a.port)
+}
@@ -53,6 +53,8 @@ type Filter interface {
 }
 
 func Initialize(filterOptions *config.GatewayFiltersOptions, options *config.GateWayOptions, ipfsOptions *config.IpfsOptions, om ordermanager.OrderManager, marketCap marketcap.MarketCapProvider, am market.AccountManager) {
+	eventemitter.Declare(eventemitter.NewOrder, eventemitter.GatewayNewOrder, eventemitter.PendingTransaction)
+
 	// add gateway watcher
 	gatewayWatcher := &eventemitter.Watcher{Concurrent: false, Handle: HandleOrder}
 	eventemitter.On(eventemitter.GatewayNewOrder, gatewayWatcher)
@@ -213,7 +215,7 @@ func (f *BaseFilter) filter(o *types.Order) (bool, error) {
 
 		if b, ok := balances["LRC"]; ok {
 			lrcHold := big.NewInt(f.MinLrcHold)
-			lrcHold = lrcHold.Mul(lrcHold, util.AllTokens["LRC"].Decimals)
+			lrcHold = lrcHold.Mul(lrcHold, util.AllTokens()["LRC"].Decimals)
 			if b.Cmp(lrcHold) < 1 {
 				return false, fmt.Errorf("gateway,base filter,owner holds lrc less than %d ", f.MinLrcHold)
 			}
@@ -315,7 +317,7 @@ type TokenFilter struct {
 func (f *TokenFilter) filter(o *types.Order) (bool, error) {
 	supportTokenS := false
 	supportTokenB := false
-	for _, v := range util.AllTokens {
+	for _, v := range util.AllTokens() {
 		if v.Protocol == o.TokenS && !v.Deny {
 			supportTokenS = true
 		}
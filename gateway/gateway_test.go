@@ -26,7 +26,7 @@ func TestGetPow(t *testing.T) {
 
 	globalConfig := test.LoadConfig()
 
-	fmt.Println(util.CalculatePrice("23399999899980370", "2027934200000000", "0xfe5aFA7BfF3394359af2D277aCc9f00065CdBe2f", "0x639687b7f8501f174356D3aCb1972f749021CCD0"))
+	fmt.Println(util.CalculatePrice("23399999899980370", "2027934200000000", common.HexToAddress("0xfe5aFA7BfF3394359af2D277aCc9f00065CdBe2f"), common.HexToAddress("0x639687b7f8501f174356D3aCb1972f749021CCD0"), "0xfe5aFA7BfF3394359af2D277aCc9f00065CdBe2f-0x639687b7f8501f174356D3aCb1972f749021CCD0"))
 	fmt.Println(util.GetSide("0xfe5aFA7BfF3394359af2D277aCc9f00065CdBe2f", "0x639687b7f8501f174356D3aCb1972f749021CCD0"))
 
 	rds := dao.NewRdsService(globalConfig.Mysql)
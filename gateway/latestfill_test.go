@@ -0,0 +1,100 @@
+/*
+
+  Copyright 2017 Loopring Project Ltd (Loopring Foundation).
+
+  Licensed under the Apache License, Version 2.0 (the "License");
+  you may not use this file except in compliance with the License.
+  You may obtain a copy of the License at
+
+  http://www.apache.org/licenses/LICENSE-2.0
+
+  Unless required by applicable law or agreed to in writing, software
+  distributed under the License is distributed on an "AS IS" BASIS,
+  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+  See the License for the specific language governing permissions and
+  limitations under the License.
+
+*/
+
+package gateway
+
+import (
+	"github.com/Loopring/relay/dao"
+	"github.com/Loopring/relay/market/util"
+	"github.com/Loopring/relay/marketcap"
+	"github.com/Loopring/relay/types"
+	"github.com/ethereum/go-ethereum/common"
+	"math"
+	"math/big"
+	"testing"
+)
+
+// token单价: LRC=1, WETH=100
+type latestFillMarketCap struct {
+	marketcap.MarketCapProvider
+	prices map[common.Address]*big.Rat
+}
+
+func (mc *latestFillMarketCap) GetMarketCap(tokenAddress common.Address) (*big.Rat, error) {
+	return mc.prices[tokenAddress], nil
+}
+
+func (mc *latestFillMarketCap) LegalCurrencyValue(tokenAddress common.Address, amount *big.Rat) (*big.Rat, error) {
+	value := new(big.Rat).Quo(amount, new(big.Rat).SetInt(big.NewInt(1e18)))
+	return value.Mul(value, mc.prices[tokenAddress]), nil
+}
+
+func TestToLatestFill_EffectiveRate(t *testing.T) {
+	weth := types.Token{Protocol: common.HexToAddress("0x2956356cD2a2bf3202F771F50D3D14A367b48070"), Symbol: "WETH", Decimals: big.NewInt(1e18), IsMarket: true}
+	lrc := types.Token{Protocol: common.HexToAddress("0xEF68e7C694F40c8202821eDF525dE3782458639f"), Symbol: "LRC", Decimals: big.NewInt(1e18)}
+	util.SetTokens(map[string]types.Token{"LRC": lrc}, map[string]types.Token{"WETH": weth})
+
+	mc := &latestFillMarketCap{prices: map[common.Address]*big.Rat{
+		lrc.Protocol:  big.NewRat(1, 1),
+		weth.Protocol: big.NewRat(100, 1),
+	}}
+
+	// 用1WETH买入100LRC, 手续费10LRC折合0.1WETH
+	buy := dao.FillEvent{
+		TokenS:  weth.Protocol.Hex(),
+		TokenB:  lrc.Protocol.Hex(),
+		AmountS: "1000000000000000000",
+		AmountB: "100000000000000000000",
+		LrcFee:  "10000000000000000000",
+	}
+	fill, err := toLatestFill(buy, mc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fill.Price != 0.01 {
+		t.Fatalf("expect raw price 0.01, got %f", fill.Price)
+	}
+	if math.Abs(fill.EffectiveRate-0.011) > 1e-9 {
+		t.Errorf("buyer pays fee, expect effective rate 0.011, got %f", fill.EffectiveRate)
+	}
+
+	// 卖出100LRC得到1WETH, 手续费减少实际所得
+	sell := dao.FillEvent{
+		TokenS:  lrc.Protocol.Hex(),
+		TokenB:  weth.Protocol.Hex(),
+		AmountS: "100000000000000000000",
+		AmountB: "1000000000000000000",
+		LrcFee:  "10000000000000000000",
+	}
+	if fill, err = toLatestFill(sell, mc); err != nil {
+		t.Fatal(err)
+	}
+	if math.Abs(fill.EffectiveRate-0.009) > 1e-9 {
+		t.Errorf("seller pays fee, expect effective rate 0.009, got %f", fill.EffectiveRate)
+	}
+
+	// 没有手续费或无法换算时与原始价格一致
+	sell.LrcFee = "0"
+	if fill, _ = toLatestFill(sell, mc); fill.EffectiveRate != fill.Price {
+		t.Errorf("effective rate without fee should equal price, got %f and %f", fill.EffectiveRate, fill.Price)
+	}
+	sell.LrcFee = "10000000000000000000"
+	if fill, _ = toLatestFill(sell, nil); fill.EffectiveRate != fill.Price {
+		t.Errorf("effective rate without rate provider should fall back to price, got %f", fill.EffectiveRate)
+	}
+}
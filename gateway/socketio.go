@@ -7,6 +7,7 @@ import (
 	"github.com/Loopring/relay/ethaccessor"
 	"github.com/Loopring/relay/eventemiter"
 	"github.com/Loopring/relay/log"
+	"github.com/Loopring/relay/market"
 	"github.com/Loopring/relay/market/util"
 	txtyp "github.com/Loopring/relay/txmanager/types"
 	"github.com/Loopring/relay/types"
@@ -87,6 +88,7 @@ const (
 	eventKeyPendingTx       = "pendingTx"
 	eventKeyDepth           = "depth"
 	eventKeyTrades          = "trades"
+	eventKeyTape            = "tape"
 )
 
 var EventTypeRoute = map[string]InvokeInfo{
@@ -127,12 +129,16 @@ type SocketIOServiceImpl struct {
 	connIdMap          *sync.Map
 	connBusinessKeyMap map[string]socketio.Conn
 	cron               *cron.Cron
+	tapeManager        *market.TapeManager
+	tapeCancels        *sync.Map
 }
 
-func NewSocketIOService(port string, walletService WalletServiceImpl) *SocketIOServiceImpl {
+func NewSocketIOService(port string, walletService WalletServiceImpl, tapeManager *market.TapeManager) *SocketIOServiceImpl {
 	so := &SocketIOServiceImpl{}
 	so.port = port
 	so.walletService = walletService
+	so.tapeManager = tapeManager
+	so.tapeCancels = &sync.Map{}
 	so.connBusinessKeyMap = make(map[string]socketio.Conn)
 	so.connIdMap = &sync.Map{}
 	so.cron = cron.New()
@@ -200,6 +206,16 @@ func (so *SocketIOServiceImpl) Start() {
 		})
 	}
 
+	// 成交明细由TapeManager按市场推送, 不走cron轮询
+	if so.tapeManager != nil {
+		server.OnEvent("/", eventKeyTape+EventPostfixReq, func(s socketio.Conn, msg string) {
+			so.subscribeTape(s.ID(), s.Emit, msg)
+		})
+		server.OnEvent("/", eventKeyTape+EventPostfixEnd, func(s socketio.Conn, msg string) {
+			so.unsubscribeTape(s.ID())
+		})
+	}
+
 	for k, events := range EventTypeRoute {
 		copyOfK := k
 		spec := events.spec
@@ -277,6 +293,7 @@ func (so *SocketIOServiceImpl) Start() {
 	server.OnDisconnect("/", func(s socketio.Conn, msg string) {
 		s.Close()
 		so.connIdMap.Delete(s.ID())
+		so.unsubscribeTape(s.ID())
 		fmt.Println("closed", msg)
 	})
 	go server.Serve()
@@ -751,3 +768,35 @@ func (so *SocketIOServiceImpl) handlePendingTransaction(input eventemitter.Event
 
 	return nil
 }
+
+// subscribeTape 订阅msg中market的成交明细, 每个连接同时只订阅一个市场, 重复订阅时取消之前的
+func (so *SocketIOServiceImpl) subscribeTape(connId string, emit func(event string, v ...interface{}), msg string) {
+	query := SingleMarket{}
+	if err := json.Unmarshal([]byte(msg), &query); err != nil || query.Market == "" {
+		errMsg := "market must be applied"
+		if err != nil {
+			errMsg = err.Error()
+		}
+		errJson, _ := json.Marshal(SocketIOJsonResp{Error: errMsg})
+		emit(eventKeyTape+EventPostfixRes, string(errJson[:]))
+		return
+	}
+
+	so.unsubscribeTape(connId)
+	entries, cancel := so.tapeManager.SubscribeTape(query.Market)
+	so.tapeCancels.Store(connId, cancel)
+
+	go func() {
+		for entry := range entries {
+			b, _ := json.Marshal(SocketIOJsonResp{Data: entry})
+			emit(eventKeyTape+EventPostfixRes, string(b[:]))
+		}
+	}()
+}
+
+func (so *SocketIOServiceImpl) unsubscribeTape(connId string) {
+	if cancel, ok := so.tapeCancels.Load(connId); ok {
+		so.tapeCancels.Delete(connId)
+		cancel.(func())()
+	}
+}
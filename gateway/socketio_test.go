@@ -0,0 +1,94 @@
+/*
+
+  Copyright 2017 Loopring Project Ltd (Loopring Foundation).
+
+  Licensed under the Apache License, Version 2.0 (the "License");
+  you may not use this file except in compliance with the License.
+  You may obtain a copy of the License at
+
+  http://www.apache.org/licenses/LICENSE-2.0
+
+  Unless required by applicable law or agreed to in writing, software
+  distributed under the License is distributed on an "AS IS" BASIS,
+  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+  See the License for the specific language governing permissions and
+  limitations under the License.
+
+*/
+
+package gateway
+
+import (
+	"encoding/json"
+	"github.com/Loopring/relay/eventemiter"
+	"github.com/Loopring/relay/market"
+	"github.com/Loopring/relay/market/util"
+	"github.com/Loopring/relay/types"
+	"github.com/ethereum/go-ethereum/common"
+	"math/big"
+	"testing"
+	"time"
+)
+
+func TestSocketIOService_SubscribeTape(t *testing.T) {
+	lrc := types.Token{Protocol: common.HexToAddress("0xEF68e7C694F40c8202821eDF525dE3782458639f"), Symbol: "LRC", Decimals: big.NewInt(1e18)}
+	weth := types.Token{Protocol: common.HexToAddress("0x2956356cD2a2bf3202F771F50D3D14A367b48070"), Symbol: "WETH", Decimals: big.NewInt(1e18)}
+	util.SetTokens(map[string]types.Token{"LRC": lrc}, map[string]types.Token{"WETH": weth})
+
+	tape := market.NewTapeManager(0)
+	tape.Start()
+	defer tape.Stop()
+	so := NewSocketIOService("", WalletServiceImpl{}, tape)
+
+	messages := make(chan string, 10)
+	emit := func(event string, v ...interface{}) {
+		if event != eventKeyTape+EventPostfixRes {
+			t.Errorf("unexpected event %s", event)
+		}
+		messages <- v[0].(string)
+	}
+	receive := func() SocketIOJsonResp {
+		select {
+		case msg := <-messages:
+			var resp SocketIOJsonResp
+			if err := json.Unmarshal([]byte(msg), &resp); err != nil {
+				t.Fatalf("unmarshal tape message error:%s", err.Error())
+			}
+			return resp
+		case <-time.After(time.Second):
+			t.Fatalf("tape message not delivered")
+		}
+		return SocketIOJsonResp{}
+	}
+
+	so.subscribeTape("conn1", emit, `{"contractVersion":"v1.5"}`)
+	if resp := receive(); resp.Error == "" {
+		t.Fatalf("subscribe without market should return error")
+	}
+
+	so.subscribeTape("conn1", emit, `{"market":"lrc-weth"}`)
+	fill := &types.OrderFilledEvent{Market: "LRC-WETH", Role: types.FILL_ROLE_TAKER, Price: 0.001, FillIndex: big.NewInt(0)}
+	fill.BlockNumber = big.NewInt(100)
+	fill.BlockTime = 1520000100
+	fill.Status = types.TX_STATUS_SUCCESS
+	fill.TokenS, fill.TokenB = weth.Protocol, lrc.Protocol
+	fill.NormalizedAmountS, fill.NormalizedAmountB = 0.1, 100
+	eventemitter.Emit(eventemitter.OrderFilled, fill)
+
+	resp := receive()
+	entry, ok := resp.Data.(map[string]interface{})
+	if !ok || entry["market"] != "LRC-WETH" || entry["size"] != float64(100) || entry["side"] != util.SideBuy {
+		t.Fatalf("unexpected tape entry %+v", resp)
+	}
+
+	// 断开后不再推送
+	so.unsubscribeTape("conn1")
+	next := *fill
+	next.BlockNumber = big.NewInt(101)
+	eventemitter.Emit(eventemitter.OrderFilled, &next)
+	select {
+	case msg := <-messages:
+		t.Fatalf("unsubscribed connection should not receive %s", msg)
+	case <-time.After(50 * time.Millisecond):
+	}
+}
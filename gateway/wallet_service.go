@@ -265,14 +265,15 @@ type AccountJson struct {
 }
 
 type LatestFill struct {
-	CreateTime int64   `json:"createTime"`
-	Price      float64 `json:"price"`
-	Amount     float64 `json:"amount"`
-	Side       string  `json:"side"`
-	RingHash   string  `json:"ringHash"`
-	LrcFee     string  `json:"lrcFee"`
-	SplitS     string  `json:"splitS"`
-	SplitB     string  `json:"splitB"`
+	CreateTime    int64   `json:"createTime"`
+	Price         float64 `json:"price"`
+	EffectiveRate float64 `json:"effectiveRate"` // 计入lrcFee后的实际成交价格
+	Amount        float64 `json:"amount"`
+	Side          string  `json:"side"`
+	RingHash      string  `json:"ringHash"`
+	LrcFee        string  `json:"lrcFee"`
+	SplitS        string  `json:"splitS"`
+	SplitB        string  `json:"splitB"`
 }
 
 type P2PRingRequest struct {
@@ -375,7 +376,7 @@ func (w *WalletServiceImpl) GetPortfolio(query SingleOwner) (res []Portfolio, er
 func (w *WalletServiceImpl) GetPriceQuote(query PriceQuoteQuery) (result PriceQuote, err error) {
 
 	rst := PriceQuote{query.Currency, make([]TokenPrice, 0)}
-	for k, v := range util.AllTokens {
+	for k, v := range util.AllTokens() {
 		price, err := w.marketCap.GetMarketCapByCurrency(v.Protocol, query.Currency)
 		if err != nil {
 			log.Debug(">>>>>>>> get market cap error " + err.Error())
@@ -589,30 +590,33 @@ func (w *WalletServiceImpl) GetDepth(query DepthQuery) (res Depth, err error) {
 	askBid := AskBid{Buy: empty, Sell: empty}
 	depth := Depth{DelegateAddress: delegateAddress, Market: mkt, Depth: askBid}
 
+	// 同一次查询使用同一份token快照
+	tokens := util.AllTokens()
+
 	//(TODO) 考虑到需要聚合的情况，所以每次取2倍的数据，先聚合完了再cut, 不是完美方案，后续再优化
 	asks, askErr := w.orderManager.GetOrderBook(
 		common.HexToAddress(delegateAddress),
-		util.AllTokens[a].Protocol,
-		util.AllTokens[b].Protocol, defaultDepthLength*2)
+		tokens[a].Protocol,
+		tokens[b].Protocol, defaultDepthLength*2)
 
 	if askErr != nil {
 		err = errors.New("get depth error , please refresh again")
 		return
 	}
 
-	depth.Depth.Sell = w.calculateDepth(asks, defaultDepthLength, true, util.AllTokens[a].Decimals, util.AllTokens[b].Decimals)
+	depth.Depth.Sell = w.calculateDepth(asks, defaultDepthLength, true, tokens[a].Decimals, tokens[b].Decimals)
 
 	bids, bidErr := w.orderManager.GetOrderBook(
 		common.HexToAddress(delegateAddress),
-		util.AllTokens[b].Protocol,
-		util.AllTokens[a].Protocol, defaultDepthLength*2)
+		tokens[b].Protocol,
+		tokens[a].Protocol, defaultDepthLength*2)
 
 	if bidErr != nil {
 		err = errors.New("get depth error , please refresh again")
 		return
 	}
 
-	depth.Depth.Buy = w.calculateDepth(bids, defaultDepthLength, false, util.AllTokens[b].Decimals, util.AllTokens[a].Decimals)
+	depth.Depth.Buy = w.calculateDepth(bids, defaultDepthLength, false, tokens[b].Decimals, tokens[a].Decimals)
 
 	return depth, err
 }
@@ -652,7 +656,7 @@ func (w *WalletServiceImpl) GetLatestFills(query FillQuery) ([]LatestFill, error
 	}
 
 	for _, f := range res {
-		lf, err := toLatestFill(f)
+		lf, err := toLatestFill(f, w.marketCap)
 		if err == nil && lf.Price > 0 && lf.Amount > 0 {
 			rst = append(rst, lf)
 		}
@@ -806,12 +810,12 @@ func (w *WalletServiceImpl) GetContracts() (contracts map[string][]string, err e
 }
 
 func (w *WalletServiceImpl) GetSupportedMarket() (markets []string, err error) {
-	return util.AllMarkets, err
+	return util.AllMarkets(), err
 }
 
 func (w *WalletServiceImpl) GetSupportedTokens() (markets []types.Token, err error) {
 	markets = make([]types.Token, 0)
-	for _, v := range util.AllTokens {
+	for _, v := range util.AllTokens() {
 		markets = append(markets, v)
 	}
 	return markets, err
@@ -1372,10 +1376,19 @@ func fillDetail(ring dao.RingMinedEvent, fills []dao.FillEvent) (rst RingMinedDe
 	return rst, nil
 }
 
-func toLatestFill(f dao.FillEvent) (latestFill LatestFill, err error) {
+func toLatestFill(f dao.FillEvent, mc marketcap.MarketCapProvider) (latestFill LatestFill, err error) {
 	rst := LatestFill{CreateTime: f.CreateTime}
-	price := util.CalculatePrice(f.AmountS, f.AmountB, f.TokenS, f.TokenB)
+	price, err := util.CalculatePrice(f.AmountS, f.AmountB, common.HexToAddress(f.TokenS), common.HexToAddress(f.TokenB), f.Market)
+	if err != nil {
+		return latestFill, err
+	}
 	rst.Price, _ = strconv.ParseFloat(fmt.Sprintf("%0.8f", price), 64)
+	if rate, err := effectiveRate(f, mc); err != nil {
+		log.Debugf("latest fill,ring:%s effective rate unavailable:%s", f.RingHash, err.Error())
+		rst.EffectiveRate = rst.Price
+	} else {
+		rst.EffectiveRate, _ = strconv.ParseFloat(fmt.Sprintf("%0.8f", rate), 64)
+	}
 	rst.Side = f.Side
 	rst.RingHash = f.RingHash
 	rst.LrcFee = f.LrcFee
@@ -1384,7 +1397,7 @@ func toLatestFill(f dao.FillEvent) (latestFill LatestFill, err error) {
 	var amount float64
 	if util.GetSide(f.TokenS, f.TokenB) == util.SideBuy {
 		amountB, _ := new(big.Int).SetString(f.AmountB, 0)
-		tokenB, ok := util.AllTokens[util.AddressToAlias(f.TokenB)]
+		tokenB, ok := util.AllTokens()[util.AddressToAlias(f.TokenB)]
 		if !ok {
 			return latestFill, err
 		}
@@ -1393,7 +1406,7 @@ func toLatestFill(f dao.FillEvent) (latestFill LatestFill, err error) {
 		rst.Amount, _ = strconv.ParseFloat(fmt.Sprintf("%0.8f", amount), 64)
 	} else {
 		amountS, _ := new(big.Int).SetString(f.AmountS, 0)
-		tokenS, ok := util.AllTokens[util.AddressToAlias(f.TokenS)]
+		tokenS, ok := util.AllTokens()[util.AddressToAlias(f.TokenS)]
 		if !ok {
 			return latestFill, err
 		}
@@ -1404,6 +1417,72 @@ func toLatestFill(f dao.FillEvent) (latestFill LatestFill, err error) {
 	return rst, nil
 }
 
+// effectiveRate 将lrcFee按市值换算为quote token计入成交价格:
+// 买入时手续费增加支付的quote, 卖出时手续费减少收到的quote
+func effectiveRate(f dao.FillEvent, mc marketcap.MarketCapProvider) (float64, error) {
+	if mc == nil {
+		return 0, fmt.Errorf("market cap provider not set")
+	}
+
+	tokenS, err := util.AddressToToken(common.HexToAddress(f.TokenS))
+	if err != nil {
+		return 0, err
+	}
+	tokenB, err := util.AddressToToken(common.HexToAddress(f.TokenB))
+	if err != nil {
+		return 0, err
+	}
+	amountS, ok := new(big.Int).SetString(f.AmountS, 0)
+	if !ok || amountS.Sign() <= 0 {
+		return 0, fmt.Errorf("invalid amountS:%s", f.AmountS)
+	}
+	amountB, ok := new(big.Int).SetString(f.AmountB, 0)
+	if !ok || amountB.Sign() <= 0 {
+		return 0, fmt.Errorf("invalid amountB:%s", f.AmountB)
+	}
+
+	isBuy := util.GetSide(f.TokenS, f.TokenB) == util.SideBuy
+	var base, quote *big.Rat
+	var quoteToken *types.Token
+	if isBuy {
+		quote, base, quoteToken = new(big.Rat).SetFrac(amountS, tokenS.Decimals), new(big.Rat).SetFrac(amountB, tokenB.Decimals), tokenS
+	} else {
+		base, quote, quoteToken = new(big.Rat).SetFrac(amountS, tokenS.Decimals), new(big.Rat).SetFrac(amountB, tokenB.Decimals), tokenB
+	}
+
+	fee := new(big.Rat)
+	if lrcFee, ok := new(big.Int).SetString(f.LrcFee, 0); ok && lrcFee.Sign() > 0 {
+		lrc, ok := util.TokenBySymbol("LRC")
+		if !ok {
+			return 0, fmt.Errorf("lrc token not found")
+		}
+		if lrc.Protocol == quoteToken.Protocol {
+			fee.SetFrac(lrcFee, lrc.Decimals)
+		} else {
+			feeValue, err := mc.LegalCurrencyValue(lrc.Protocol, new(big.Rat).SetInt(lrcFee))
+			if err != nil {
+				return 0, err
+			}
+			quotePrice, err := mc.GetMarketCap(quoteToken.Protocol)
+			if err != nil {
+				return 0, err
+			}
+			if quotePrice == nil || quotePrice.Sign() <= 0 {
+				return 0, fmt.Errorf("market cap of %s unavailable", quoteToken.Symbol)
+			}
+			fee.Quo(feeValue, quotePrice)
+		}
+	}
+
+	if isBuy {
+		quote.Add(quote, fee)
+	} else {
+		quote.Sub(quote, fee)
+	}
+	rate, _ := quote.Quo(quote, base).Float64()
+	return rate, nil
+}
+
 func saveMatchedRelation(takerOrderHash, makerOrderHash, ringTxHash string) (err error) {
 	return nil
 }
@@ -31,6 +31,7 @@ import (
 	"github.com/ethereum/go-ethereum/common"
 	"math/big"
 	"strings"
+	"sync"
 )
 
 const (
@@ -79,7 +80,7 @@ func parseCacheField(field []byte) common.Address {
 //todo:tokens
 func (b AccountBalances) batchReqs(tokens ...common.Address) ethaccessor.BatchBalanceReqs {
 	reqs := ethaccessor.BatchBalanceReqs{}
-	for _, token := range util.AllTokens {
+	for _, token := range util.AllTokens() {
 		req := &ethaccessor.BatchBalanceReq{}
 		req.BlockParameter = "latest"
 		req.Token = token.Protocol
@@ -226,7 +227,7 @@ func parseAllowanceCacheField(data []byte) (token common.Address, spender common
 //todo:tokens
 func (accountAllowances *AccountAllowances) batchReqs(tokens, spenders []common.Address) ethaccessor.BatchErc20AllowanceReqs {
 	reqs := ethaccessor.BatchErc20AllowanceReqs{}
-	for _, v := range util.AllTokens {
+	for _, v := range util.AllTokens() {
 		for _, impl := range ethaccessor.ProtocolAddresses() {
 			req := &ethaccessor.BatchErc20AllowanceReq{}
 			req.BlockParameter = "latest"
@@ -542,11 +543,121 @@ func (b *ChangedOfBlock) syncAndSaveAllowances() error {
 	return nil
 }
 
+// 跟踪permit授权的deadline, 过期后授权即失效
+type permitTracker struct {
+	mtx     sync.Mutex
+	permits map[string]*types.PermitApprovalEvent
+}
+
+func permitKey(owner, token, spender common.Address) string {
+	return owner.Hex() + token.Hex() + spender.Hex()
+}
+
+func (t *permitTracker) track(event *types.PermitApprovalEvent) {
+	t.mtx.Lock()
+	defer t.mtx.Unlock()
+	t.permits[permitKey(event.Owner, event.Protocol, event.Spender)] = event
+}
+
+func (t *permitTracker) untrack(owner, token, spender common.Address) {
+	t.mtx.Lock()
+	defer t.mtx.Unlock()
+	delete(t.permits, permitKey(owner, token, spender))
+}
+
+func (t *permitTracker) expire(blockTime int64) []*types.AllowanceExpiredEvent {
+	t.mtx.Lock()
+	defer t.mtx.Unlock()
+
+	var list []*types.AllowanceExpiredEvent
+	for k, v := range t.permits {
+		if v.Deadline > blockTime {
+			continue
+		}
+		list = append(list, &types.AllowanceExpiredEvent{
+			Owner:     v.Owner,
+			Token:     v.Protocol,
+			Spender:   v.Spender,
+			Amount:    v.Amount,
+			Deadline:  v.Deadline,
+			BlockTime: blockTime,
+		})
+		delete(t.permits, k)
+	}
+	return list
+}
+
+// 按spender记录链上approve, delegate被取消授权时据此找出失效的授权
+type approvalTracker struct {
+	mtx          sync.Mutex
+	approvals    map[common.Address]map[string]*types.ApprovalEvent // spender -> owner+token
+	deauthorized map[common.Address]bool
+}
+
+func newApprovalTracker() *approvalTracker {
+	return &approvalTracker{
+		approvals:    make(map[common.Address]map[string]*types.ApprovalEvent),
+		deauthorized: make(map[common.Address]bool),
+	}
+}
+
+// record 返回true表示spender已被取消授权, 该approve记录后立即失效
+func (t *approvalTracker) record(event *types.ApprovalEvent) bool {
+	t.mtx.Lock()
+	defer t.mtx.Unlock()
+
+	key := event.Owner.Hex() + event.Protocol.Hex()
+	if event.Amount == nil || event.Amount.Sign() == 0 {
+		delete(t.approvals[event.Spender], key)
+		return false
+	}
+	if t.deauthorized[event.Spender] {
+		return true
+	}
+	if _, ok := t.approvals[event.Spender]; !ok {
+		t.approvals[event.Spender] = make(map[string]*types.ApprovalEvent)
+	}
+	t.approvals[event.Spender][key] = event
+	return false
+}
+
+func (t *approvalTracker) authorize(delegate common.Address) {
+	t.mtx.Lock()
+	defer t.mtx.Unlock()
+	delete(t.deauthorized, delegate)
+}
+
+func (t *approvalTracker) deauthorize(delegate, protocol common.Address, blockNumber *big.Int) []*types.AllowanceStaleEvent {
+	t.mtx.Lock()
+	defer t.mtx.Unlock()
+
+	t.deauthorized[delegate] = true
+
+	var list []*types.AllowanceStaleEvent
+	for _, v := range t.approvals[delegate] {
+		list = append(list, &types.AllowanceStaleEvent{
+			Owner:       v.Owner,
+			Token:       v.Protocol,
+			Spender:     v.Spender,
+			Amount:      v.Amount,
+			Protocol:    protocol,
+			BlockNumber: blockNumber,
+		})
+	}
+	delete(t.approvals, delegate)
+	return list
+}
+
 type AccountManager struct {
 	cacheDuration int64
 
 	maxBlockLength uint64
 	block          *ChangedOfBlock
+	permits        *permitTracker
+	approvals      *approvalTracker
+
+	// 缓存中的授权数量, 重复approve(数量与当前授权相同)时不再刷新
+	allowanceOf func(owner, token, spender common.Address) (*big.Int, error)
 }
 
 func NewAccountManager(options config.AccountManagerOptions) AccountManager {
@@ -560,14 +671,24 @@ func NewAccountManager(options config.AccountManagerOptions) AccountManager {
 	b := &ChangedOfBlock{}
 	b.cachedDuration = big.NewInt(int64(500))
 	accountManager.block = b
+	if options.TrackPermitExpiry {
+		accountManager.permits = &permitTracker{permits: make(map[string]*types.PermitApprovalEvent)}
+	}
+	accountManager.approvals = newApprovalTracker()
+	accountManager.allowanceOf = func(owner, token, spender common.Address) (*big.Int, error) {
+		_, allowance, err := accountManager.GetBalanceAndAllowance(owner, token, spender)
+		return allowance, err
+	}
 
 	return accountManager
 }
 
 func (accountManager *AccountManager) Start() {
+	eventemitter.Declare(eventemitter.BalanceUpdated, eventemitter.AllowanceStale, eventemitter.AllowanceExpired)
 
 	transferWatcher := &eventemitter.Watcher{Concurrent: false, Handle: accountManager.handleTokenTransfer}
 	approveWatcher := &eventemitter.Watcher{Concurrent: false, Handle: accountManager.handleApprove}
+	allowanceChangedWatcher := &eventemitter.Watcher{Concurrent: false, Handle: accountManager.handleAllowanceChanged}
 	wethDepositWatcher := &eventemitter.Watcher{Concurrent: false, Handle: accountManager.handleWethDeposit}
 	wethWithdrawalWatcher := &eventemitter.Watcher{Concurrent: false, Handle: accountManager.handleWethWithdrawal}
 	blockForkWatcher := &eventemitter.Watcher{Concurrent: false, Handle: accountManager.handleBlockFork}
@@ -577,21 +698,30 @@ func (accountManager *AccountManager) Start() {
 	cancelOrderWather := &eventemitter.Watcher{Concurrent: false, Handle: accountManager.handleCancelOrder}
 	cutoffAllWatcher := &eventemitter.Watcher{Concurrent: false, Handle: accountManager.handleCutOff}
 	cutoffPairAllWatcher := &eventemitter.Watcher{Concurrent: false, Handle: accountManager.handleCutOffPair}
+	authorizedWatcher := &eventemitter.Watcher{Concurrent: false, Handle: accountManager.handleAddressAuthorized}
+	deauthorizedWatcher := &eventemitter.Watcher{Concurrent: false, Handle: accountManager.handleAddressDeAuthorized}
 
 	eventemitter.On(eventemitter.WethDeposit, wethDepositWatcher)
 	eventemitter.On(eventemitter.WethWithdrawal, wethWithdrawalWatcher)
 	eventemitter.On(eventemitter.Approve, approveWatcher)
+	eventemitter.On(eventemitter.AllowanceChanged, allowanceChangedWatcher)
 	eventemitter.On(eventemitter.Transfer, transferWatcher)
 	eventemitter.On(eventemitter.EthTransferEvent, ethTransferWatcher)
 
 	eventemitter.On(eventemitter.CancelOrder, cancelOrderWather)
 	eventemitter.On(eventemitter.CutoffAll, cutoffAllWatcher)
 	eventemitter.On(eventemitter.CutoffPair, cutoffPairAllWatcher)
+	eventemitter.On(eventemitter.AddressAuthorized, authorizedWatcher)
+	eventemitter.On(eventemitter.AddressDeAuthorized, deauthorizedWatcher)
 
 	eventemitter.On(eventemitter.Block_End, blockEndWatcher)
 	eventemitter.On(eventemitter.Block_New, blockNewWatcher)
 	eventemitter.On(eventemitter.ChainForkDetected, blockForkWatcher)
 
+	if accountManager.permits != nil {
+		permitApproveWatcher := &eventemitter.Watcher{Concurrent: false, Handle: accountManager.handlePermitApprove}
+		eventemitter.On(eventemitter.PermitApprove, permitApproveWatcher)
+	}
 }
 
 func (a *AccountManager) GetBalanceWithSymbolResult(owner common.Address) (map[string]*big.Int, error) {
@@ -681,9 +811,13 @@ func (a *AccountManager) handleTokenTransfer(input eventemitter.EventData) (err
 	}
 
 	//balance
-	a.block.saveBalanceKey(event.Sender, event.Protocol)
+	if !event.Mint {
+		a.block.saveBalanceKey(event.Sender, event.Protocol)
+	}
 	a.block.saveBalanceKey(event.From, types.NilAddress)
-	a.block.saveBalanceKey(event.Receiver, event.Protocol)
+	if !event.Burn {
+		a.block.saveBalanceKey(event.Receiver, event.Protocol)
+	}
 
 	//allowance
 	if spender, err := ethaccessor.GetSpenderAddress(event.To); nil == err {
@@ -702,13 +836,100 @@ func (a *AccountManager) handleApprove(input eventemitter.EventData) error {
 		return nil
 	}
 
-	a.block.saveAllowanceKey(event.Owner, event.Protocol, event.Spender)
+	// 链上approve覆盖之前的permit授权
+	if a.permits != nil {
+		a.permits.untrack(event.Owner, event.Protocol, event.Spender)
+	}
+
+	a.trackApproval(event)
+
+	if a.allowanceChanged(event) {
+		a.block.saveAllowanceKey(event.Owner, event.Protocol, event.Spender)
+	} else {
+		log.Debugf("approval of owner:%s token:%s spender:%s equals cached allowance, skip refresh", event.Owner.Hex(), event.Protocol.Hex(), event.Spender.Hex())
+	}
 
 	a.block.saveBalanceKey(event.Owner, types.NilAddress)
 
 	return nil
 }
 
+// allowanceChanged 比较的是当前授权而不是上一次approve的数量, 授权被transferFrom/成交消耗后重新approve原数量仍需刷新
+func (a *AccountManager) allowanceChanged(event *types.ApprovalEvent) bool {
+	if a.allowanceOf == nil || event.Amount == nil {
+		return true
+	}
+	allowance, err := a.allowanceOf(event.Owner, event.Protocol, event.Spender)
+	if err != nil || allowance == nil {
+		return true
+	}
+	return allowance.Cmp(event.Amount) != 0
+}
+
+// 授权增量无法直接更新缓存, 只对delegate的授权在块结束时重新获取
+func (a *AccountManager) handleAllowanceChanged(input eventemitter.EventData) error {
+	event := input.(*types.AllowanceChangedEvent)
+	if event == nil || event.Status != types.TX_STATUS_SUCCESS {
+		return nil
+	}
+	if !ethaccessor.IsSpenderAddress(event.Spender) {
+		return nil
+	}
+
+	a.block.saveAllowanceKey(event.Owner, event.Protocol, event.Spender)
+
+	return nil
+}
+
+func (a *AccountManager) trackApproval(event *types.ApprovalEvent) {
+	if a.approvals.record(event) {
+		eventemitter.Emit(eventemitter.AllowanceStale, &types.AllowanceStaleEvent{
+			Owner:       event.Owner,
+			Token:       event.Protocol,
+			Spender:     event.Spender,
+			Amount:      event.Amount,
+			BlockNumber: event.BlockNumber,
+		})
+	}
+}
+
+// AddressAuthorized/AddressDeAuthorized由delegate合约发出, TxInfo.Protocol即delegate地址
+func (a *AccountManager) handleAddressAuthorized(input eventemitter.EventData) error {
+	event := input.(*types.AddressAuthorizedEvent)
+	if event == nil || event.Status != types.TX_STATUS_SUCCESS {
+		return nil
+	}
+
+	a.approvals.authorize(event.TxInfo.Protocol)
+	return nil
+}
+
+func (a *AccountManager) handleAddressDeAuthorized(input eventemitter.EventData) error {
+	event := input.(*types.AddressDeAuthorizedEvent)
+	if event == nil || event.Status != types.TX_STATUS_SUCCESS {
+		return nil
+	}
+
+	for _, v := range a.approvals.deauthorize(event.TxInfo.Protocol, event.Protocol, event.BlockNumber) {
+		log.Debugf("allowance stale, token:%s, owner:%s, spender:%s", v.Token.Hex(), v.Owner.Hex(), v.Spender.Hex())
+		eventemitter.Emit(eventemitter.AllowanceStale, v)
+	}
+	return nil
+}
+
+func (a *AccountManager) handlePermitApprove(input eventemitter.EventData) error {
+	event := input.(*types.PermitApprovalEvent)
+	if event == nil || event.Status != types.TX_STATUS_SUCCESS {
+		log.Info("received wrong status event, drop it")
+		return nil
+	}
+
+	log.Debugf("received permit approval, token:%s, owner:%s, spender:%s, deadline:%d", event.Protocol.Hex(), event.Owner.Hex(), event.Spender.Hex(), event.Deadline)
+	a.permits.track(event)
+
+	return nil
+}
+
 func (a *AccountManager) handleWethDeposit(input eventemitter.EventData) (err error) {
 	event := input.(*types.WethDepositEvent)
 	if event == nil || event.Status != types.TX_STATUS_SUCCESS {
@@ -749,13 +970,22 @@ func (a *AccountManager) handleBlockNew(input eventemitter.EventData) error {
 	event := input.(*types.BlockEvent)
 	log.Debugf("handleBlockNewhandleBlockNewhandleBlockNewhandleBlockNew:%s", event.BlockNumber.String())
 	a.block.currentBlockNumber = new(big.Int).Set(event.BlockNumber)
+
+	if a.permits != nil {
+		for _, v := range a.permits.expire(event.BlockTime) {
+			log.Debugf("permit allowance expired, token:%s, owner:%s, spender:%s, deadline:%d", v.Token.Hex(), v.Owner.Hex(), v.Spender.Hex(), v.Deadline)
+			eventemitter.Emit(eventemitter.AllowanceExpired, v)
+		}
+	}
 	return nil
 }
 
 func (a *AccountManager) handleEthTransfer(input eventemitter.EventData) error {
 	event := input.(*types.TransferEvent)
 	a.block.saveBalanceKey(event.From, types.NilAddress)
-	a.block.saveBalanceKey(event.To, types.NilAddress)
+	if !event.SelfTransfer {
+		a.block.saveBalanceKey(event.To, types.NilAddress)
+	}
 	return nil
 }
 
@@ -0,0 +1,65 @@
+/*
+
+  Copyright 2017 Loopring Project Ltd (Loopring Foundation).
+
+  Licensed under the Apache License, Version 2.0 (the "License");
+  you may not use this file except in compliance with the License.
+  You may obtain a copy of the License at
+
+  http://www.apache.org/licenses/LICENSE-2.0
+
+  Unless required by applicable law or agreed to in writing, software
+  distributed under the License is distributed on an "AS IS" BASIS,
+  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+  See the License for the specific language governing permissions and
+  limitations under the License.
+
+*/
+
+package market
+
+import (
+	"errors"
+	"github.com/Loopring/relay/config"
+	"github.com/Loopring/relay/types"
+	"github.com/ethereum/go-ethereum/common"
+	"math/big"
+	"testing"
+)
+
+func TestAccountManager_AllowanceChanged(t *testing.T) {
+	var (
+		owner   = common.HexToAddress("0x1b978a1D302335a6F2Ebe4B8823B5E17c3C84135")
+		spender = common.HexToAddress("0x17233e07c67d086464fD408148c3ABB56245FA64")
+		token   = common.HexToAddress("0xcd36128815ebe0b44d0374649bad2721b8751bef")
+	)
+
+	accManager := NewAccountManager(config.AccountManagerOptions{})
+	cached := big.NewInt(1000)
+	var lookupErr error
+	accManager.allowanceOf = func(o, tk, s common.Address) (*big.Int, error) {
+		if o != owner || tk != token || s != spender {
+			t.Fatalf("unexpected allowance lookup %s %s %s", o.Hex(), tk.Hex(), s.Hex())
+		}
+		return cached, lookupErr
+	}
+
+	approval := &types.ApprovalEvent{Owner: owner, Spender: spender, Amount: big.NewInt(1000)}
+	approval.Protocol = token
+
+	if accManager.allowanceChanged(approval) {
+		t.Errorf("approval equal to cached allowance should not refresh")
+	}
+
+	// 授权被成交消耗一部分后重新approve原数量, 授权实际发生了变化
+	cached = big.NewInt(400)
+	if !accManager.allowanceChanged(approval) {
+		t.Errorf("re-approving the original amount after allowance consumed should refresh")
+	}
+
+	lookupErr = errors.New("cache unavailable")
+	cached = big.NewInt(1000)
+	if !accManager.allowanceChanged(approval) {
+		t.Errorf("allowance should be refreshed when cache lookup failed")
+	}
+}
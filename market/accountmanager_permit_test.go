@@ -0,0 +1,78 @@
+/*
+
+  Copyright 2017 Loopring Project Ltd (Loopring Foundation).
+
+  Licensed under the Apache License, Version 2.0 (the "License");
+  you may not use this file except in compliance with the License.
+  You may obtain a copy of the License at
+
+  http://www.apache.org/licenses/LICENSE-2.0
+
+  Unless required by applicable law or agreed to in writing, software
+  distributed under the License is distributed on an "AS IS" BASIS,
+  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+  See the License for the specific language governing permissions and
+  limitations under the License.
+
+*/
+
+package market_test
+
+import (
+	"github.com/Loopring/relay/config"
+	"github.com/Loopring/relay/eventemiter"
+	"github.com/Loopring/relay/log"
+	"github.com/Loopring/relay/market"
+	"github.com/Loopring/relay/types"
+	"github.com/ethereum/go-ethereum/common"
+	"go.uber.org/zap"
+	"math/big"
+	"testing"
+)
+
+func TestAccountManager_PermitAllowanceExpired(t *testing.T) {
+	zapOpts := zap.NewDevelopmentConfig()
+	zapOpts.Level = zap.NewAtomicLevelAt(zap.ErrorLevel)
+	log.Initialize(config.LogOptions{ZapOpts: zapOpts})
+
+	accManager := market.NewAccountManager(config.AccountManagerOptions{TrackPermitExpiry: true})
+	accManager.Start()
+
+	var expired []*types.AllowanceExpiredEvent
+	watcher := &eventemitter.Watcher{Concurrent: false, Handle: func(input eventemitter.EventData) error {
+		expired = append(expired, input.(*types.AllowanceExpiredEvent))
+		return nil
+	}}
+	eventemitter.On(eventemitter.AllowanceExpired, watcher)
+	defer eventemitter.Un(eventemitter.AllowanceExpired, watcher)
+
+	permit := &types.PermitApprovalEvent{
+		Owner:    common.HexToAddress("0x1b978a1D302335a6F2Ebe4B8823B5E17c3C84135"),
+		Spender:  common.HexToAddress("0x17233e07c67d086464fD408148c3ABB56245FA64"),
+		Amount:   big.NewInt(1000),
+		Deadline: 1000,
+	}
+	permit.Protocol = common.HexToAddress("0xcd36128815ebe0b44d0374649bad2721b8751bef")
+	permit.Status = types.TX_STATUS_SUCCESS
+	eventemitter.Emit(eventemitter.PermitApprove, permit)
+
+	eventemitter.Emit(eventemitter.Block_New, &types.BlockEvent{BlockNumber: big.NewInt(1), BlockTime: 999})
+	if len(expired) != 0 {
+		t.Fatalf("permit should not expire before deadline, got %d expired", len(expired))
+	}
+
+	eventemitter.Emit(eventemitter.Block_New, &types.BlockEvent{BlockNumber: big.NewInt(2), BlockTime: 1001})
+	if len(expired) != 1 {
+		t.Fatalf("expect 1 allowance expired event, got %d", len(expired))
+	}
+	evt := expired[0]
+	if evt.Owner != permit.Owner || evt.Spender != permit.Spender || evt.Token != permit.Protocol || evt.Deadline != permit.Deadline {
+		t.Fatalf("expired allowance doesn't match permit")
+	}
+
+	// 过期只通知一次
+	eventemitter.Emit(eventemitter.Block_New, &types.BlockEvent{BlockNumber: big.NewInt(3), BlockTime: 1002})
+	if len(expired) != 1 {
+		t.Fatalf("allowance expired should be emitted once, got %d", len(expired))
+	}
+}
@@ -0,0 +1,88 @@
+/*
+
+  Copyright 2017 Loopring Project Ltd (Loopring Foundation).
+
+  Licensed under the Apache License, Version 2.0 (the "License");
+  you may not use this file except in compliance with the License.
+  You may obtain a copy of the License at
+
+  http://www.apache.org/licenses/LICENSE-2.0
+
+  Unless required by applicable law or agreed to in writing, software
+  distributed under the License is distributed on an "AS IS" BASIS,
+  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+  See the License for the specific language governing permissions and
+  limitations under the License.
+
+*/
+
+package market
+
+import (
+	"github.com/Loopring/relay/config"
+	"github.com/Loopring/relay/eventemiter"
+	"github.com/Loopring/relay/log"
+	"github.com/Loopring/relay/types"
+	"github.com/ethereum/go-ethereum/common"
+	"go.uber.org/zap"
+	"math/big"
+	"testing"
+)
+
+func TestAccountManager_AllowanceStaleAfterDeAuthorized(t *testing.T) {
+	zapOpts := zap.NewDevelopmentConfig()
+	zapOpts.Level = zap.NewAtomicLevelAt(zap.ErrorLevel)
+	log.Initialize(config.LogOptions{ZapOpts: zapOpts})
+
+	var (
+		delegate = common.HexToAddress("0x17233e07c67d086464fD408148c3ABB56245FA64")
+		protocol = common.HexToAddress("0x8d8812b72d1e4ffCeC158D25f56748b7d67c1e78")
+		owner    = common.HexToAddress("0x1b978a1D302335a6F2Ebe4B8823B5E17c3C84135")
+		token    = common.HexToAddress("0xcd36128815ebe0b44d0374649bad2721b8751bef")
+	)
+
+	accManager := NewAccountManager(config.AccountManagerOptions{})
+	accManager.Start()
+
+	var stale []*types.AllowanceStaleEvent
+	watcher := &eventemitter.Watcher{Concurrent: false, Handle: func(input eventemitter.EventData) error {
+		stale = append(stale, input.(*types.AllowanceStaleEvent))
+		return nil
+	}}
+	eventemitter.On(eventemitter.AllowanceStale, watcher)
+	defer eventemitter.Un(eventemitter.AllowanceStale, watcher)
+
+	authorized := &types.AddressAuthorizedEvent{Protocol: protocol, Number: 1}
+	authorized.TxInfo.Protocol = delegate
+	authorized.Status = types.TX_STATUS_SUCCESS
+	eventemitter.Emit(eventemitter.AddressAuthorized, authorized)
+
+	// approve写入redis, 这里只记录授权
+	approval := &types.ApprovalEvent{Owner: owner, Spender: delegate, Amount: big.NewInt(1000)}
+	approval.Protocol = token
+	approval.Status = types.TX_STATUS_SUCCESS
+	accManager.trackApproval(approval)
+	if len(stale) != 0 {
+		t.Fatalf("approval to authorized delegate should not be stale")
+	}
+
+	deauthorized := &types.AddressDeAuthorizedEvent{Protocol: protocol, Number: 1}
+	deauthorized.TxInfo.Protocol = delegate
+	deauthorized.BlockNumber = big.NewInt(100)
+	deauthorized.Status = types.TX_STATUS_SUCCESS
+	eventemitter.Emit(eventemitter.AddressDeAuthorized, deauthorized)
+
+	if len(stale) != 1 {
+		t.Fatalf("expect 1 allowance stale event, got %d", len(stale))
+	}
+	evt := stale[0]
+	if evt.Owner != owner || evt.Token != token || evt.Spender != delegate || evt.Protocol != protocol || evt.Amount.Int64() != 1000 || evt.BlockNumber.Int64() != 100 {
+		t.Fatalf("unexpected stale allowance %v", evt)
+	}
+
+	// 取消授权后新的approve立即失效
+	accManager.trackApproval(approval)
+	if len(stale) != 2 {
+		t.Fatalf("approval to deauthorized delegate should be stale, got %d", len(stale))
+	}
+}
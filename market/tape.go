@@ -0,0 +1,239 @@
+/*
+
+  Copyright 2017 Loopring Project Ltd (Loopring Foundation).
+
+  Licensed under the Apache License, Version 2.0 (the "License");
+  you may not use this file except in compliance with the License.
+  You may obtain a copy of the License at
+
+  http://www.apache.org/licenses/LICENSE-2.0
+
+  Unless required by applicable law or agreed to in writing, software
+  distributed under the License is distributed on an "AS IS" BASIS,
+  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+  See the License for the specific language governing permissions and
+  limitations under the License.
+
+*/
+
+package market
+
+import (
+	"github.com/Loopring/relay/eventemiter"
+	"github.com/Loopring/relay/log"
+	"github.com/Loopring/relay/market/util"
+	"github.com/Loopring/relay/types"
+	"github.com/ethereum/go-ethereum/common"
+	"math"
+	"strings"
+	"sync"
+)
+
+const defaultTapeBufferSize = 256
+
+// 成交明细(time-and-sales), 每个环路只取taker一侧的成交, side为taker的买卖方向, size以base token计
+type TapeEntry struct {
+	Market    string      `json:"market"`
+	Time      int64       `json:"time"`
+	Price     float64     `json:"price"`
+	Size      float64     `json:"size"`
+	Side      string      `json:"side"`
+	TxHash    common.Hash `json:"txHash"`
+	FillIndex int64       `json:"fillIndex"`
+}
+
+// 成交在链上的位置, 用于保证同一市场的明细按时间顺序推送
+type tapePosition struct {
+	blockNumber int64
+	txIndex     int64
+	logIndex    int64
+	fillIndex   int64
+}
+
+func (p tapePosition) after(other tapePosition) bool {
+	if p.blockNumber != other.blockNumber {
+		return p.blockNumber > other.blockNumber
+	}
+	if p.txIndex != other.txIndex {
+		return p.txIndex > other.txIndex
+	}
+	if p.logIndex != other.logIndex {
+		return p.logIndex > other.logIndex
+	}
+	return p.fillIndex > other.fillIndex
+}
+
+type tapeSubscriber struct {
+	ch chan TapeEntry
+}
+
+// TapeManager 监听OrderFilled, 按市场向订阅者推送成交明细
+type TapeManager struct {
+	mtx         sync.RWMutex
+	bufferSize  int
+	subscribers map[string][]*tapeSubscriber
+	last        map[string]tapePosition
+	watcher     *eventemitter.Watcher
+	forkWatcher *eventemitter.Watcher
+}
+
+func NewTapeManager(bufferSize int) *TapeManager {
+	tape := &TapeManager{}
+	tape.bufferSize = bufferSize
+	if tape.bufferSize <= 0 {
+		tape.bufferSize = defaultTapeBufferSize
+	}
+	tape.subscribers = make(map[string][]*tapeSubscriber)
+	tape.last = make(map[string]tapePosition)
+	tape.watcher = &eventemitter.Watcher{Concurrent: false, Handle: tape.handleOrderFilled}
+	tape.forkWatcher = &eventemitter.Watcher{Concurrent: false, Handle: tape.handleFork}
+
+	return tape
+}
+
+func (t *TapeManager) Start() {
+	eventemitter.On(eventemitter.OrderFilled, t.watcher)
+	eventemitter.On(eventemitter.ChainForkDetected, t.forkWatcher)
+}
+
+// Stop 取消监听并关闭所有订阅
+func (t *TapeManager) Stop() {
+	eventemitter.Un(eventemitter.OrderFilled, t.watcher)
+	eventemitter.Un(eventemitter.ChainForkDetected, t.forkWatcher)
+
+	t.mtx.Lock()
+	defer t.mtx.Unlock()
+
+	for _, list := range t.subscribers {
+		for _, sub := range list {
+			close(sub.ch)
+		}
+	}
+	t.subscribers = make(map[string][]*tapeSubscriber)
+}
+
+// SubscribeTape 订阅market的成交明细, 返回的cancel用于取消订阅并关闭channel.
+// 订阅者消费不及时缓冲区满时, 新的成交会被丢弃, 已推送的明细仍保持时间顺序
+func (t *TapeManager) SubscribeTape(market string) (<-chan TapeEntry, func()) {
+	market = strings.ToUpper(market)
+	sub := &tapeSubscriber{ch: make(chan TapeEntry, t.bufferSize)}
+
+	t.mtx.Lock()
+	t.subscribers[market] = append(t.subscribers[market], sub)
+	t.mtx.Unlock()
+
+	var once sync.Once
+	cancel := func() {
+		once.Do(func() {
+			t.mtx.Lock()
+			defer t.mtx.Unlock()
+
+			list := t.subscribers[market]
+			for i, v := range list {
+				if v == sub {
+					t.subscribers[market] = append(list[:i:i], list[i+1:]...)
+					close(sub.ch)
+					break
+				}
+			}
+			if len(t.subscribers[market]) == 0 {
+				delete(t.subscribers, market)
+			}
+		})
+	}
+
+	return sub.ch, cancel
+}
+
+func (t *TapeManager) handleOrderFilled(input eventemitter.EventData) error {
+	fill := input.(*types.OrderFilledEvent)
+
+	// 重放的历史成交不是新成交, 不推送给订阅者
+	if fill.Replay {
+		return nil
+	}
+
+	entry, ok := newTapeEntry(fill)
+	if !ok {
+		return nil
+	}
+	pos := tapePosition{txIndex: fill.TxIndex, logIndex: fill.TxLogIndex, fillIndex: entry.FillIndex}
+	if fill.BlockNumber != nil {
+		pos.blockNumber = fill.BlockNumber.Int64()
+	}
+
+	t.mtx.Lock()
+	defer t.mtx.Unlock()
+
+	// 重复或乱序到达的成交不再推送, 避免订阅者看到时间倒退的明细
+	if last, ok := t.last[entry.Market]; ok && !pos.after(last) {
+		log.Debugf("tape,market:%s skip fill tx:%s fillIndex:%d not after last delivered", entry.Market, entry.TxHash.Hex(), entry.FillIndex)
+		return nil
+	}
+	t.last[entry.Market] = pos
+
+	for _, sub := range t.subscribers[entry.Market] {
+		select {
+		case sub.ch <- entry:
+		default:
+			log.Warnf("tape,market:%s subscriber buffer full, drop fill tx:%s fillIndex:%d", entry.Market, entry.TxHash.Hex(), entry.FillIndex)
+		}
+	}
+
+	return nil
+}
+
+// handleFork 分叉后forkBlock之后的成交会在新链上重新打包, 推送位置退回到forkBlock末尾
+func (t *TapeManager) handleFork(input eventemitter.EventData) error {
+	forkEvent := input.(*types.ForkedEvent)
+	if forkEvent.ForkBlock == nil {
+		return nil
+	}
+	forkPos := tapePosition{blockNumber: forkEvent.ForkBlock.Int64(), txIndex: math.MaxInt64}
+
+	t.mtx.Lock()
+	defer t.mtx.Unlock()
+
+	for market, last := range t.last {
+		if last.after(forkPos) {
+			t.last[market] = forkPos
+		}
+	}
+	log.Debugf("tape,reset delivered position to fork block:%s", forkEvent.ForkBlock.String())
+	return nil
+}
+
+// newTapeEntry 一个环路中maker与taker两侧是同一笔成交, 只取taker一侧, 未区分角色时每笔都取
+func newTapeEntry(fill *types.OrderFilledEvent) (TapeEntry, bool) {
+	if fill.Status != types.TX_STATUS_SUCCESS || fill.Market == "" {
+		return TapeEntry{}, false
+	}
+	if fill.Role != "" && fill.Role != types.FILL_ROLE_TAKER {
+		return TapeEntry{}, false
+	}
+
+	entry := TapeEntry{}
+	entry.Market = strings.ToUpper(fill.Market)
+	entry.Time = fill.BlockTime
+	entry.Price = fill.Price
+	entry.Side = util.GetSide(fill.TokenS.Hex(), fill.TokenB.Hex())
+	entry.TxHash = fill.TxHash
+	if fill.FillIndex != nil {
+		entry.FillIndex = fill.FillIndex.Int64()
+	}
+
+	switch entry.Side {
+	case util.SideBuy:
+		entry.Size = fill.NormalizedAmountB
+	case util.SideSell:
+		entry.Size = fill.NormalizedAmountS
+	default:
+		return TapeEntry{}, false
+	}
+
+	if entry.Price <= 0 || entry.Size <= 0 {
+		return TapeEntry{}, false
+	}
+
+	return entry, true
+}
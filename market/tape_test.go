@@ -0,0 +1,166 @@
+/*
+
+  Copyright 2017 Loopring Project Ltd (Loopring Foundation).
+
+  Licensed under the Apache License, Version 2.0 (the "License");
+  you may not use this file except in compliance with the License.
+  You may obtain a copy of the License at
+
+  http://www.apache.org/licenses/LICENSE-2.0
+
+  Unless required by applicable law or agreed to in writing, software
+  distributed under the License is distributed on an "AS IS" BASIS,
+  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+  See the License for the specific language governing permissions and
+  limitations under the License.
+
+*/
+
+package market
+
+import (
+	"github.com/Loopring/relay/config"
+	"github.com/Loopring/relay/eventemiter"
+	"github.com/Loopring/relay/log"
+	"github.com/Loopring/relay/market/util"
+	"github.com/Loopring/relay/types"
+	"github.com/ethereum/go-ethereum/common"
+	"go.uber.org/zap"
+	"math/big"
+	"testing"
+	"time"
+)
+
+func TestTapeManager_SubscribeTape(t *testing.T) {
+	zapOpts := zap.NewDevelopmentConfig()
+	zapOpts.Level = zap.NewAtomicLevelAt(zap.ErrorLevel)
+	log.Initialize(config.LogOptions{ZapOpts: zapOpts})
+
+	lrc := types.Token{Protocol: common.HexToAddress("0xEF68e7C694F40c8202821eDF525dE3782458639f"), Symbol: "LRC", Decimals: big.NewInt(1e18)}
+	weth := types.Token{Protocol: common.HexToAddress("0x2956356cD2a2bf3202F771F50D3D14A367b48070"), Symbol: "WETH", Decimals: big.NewInt(1e18)}
+	util.SetTokens(map[string]types.Token{"LRC": lrc}, map[string]types.Token{"WETH": weth})
+
+	fill := func(block int64, buy bool, role string, price, size float64) *types.OrderFilledEvent {
+		evt := &types.OrderFilledEvent{Market: "LRC-WETH", Role: role, Price: price, FillIndex: big.NewInt(0)}
+		evt.TxHash = common.BigToHash(big.NewInt(block))
+		evt.BlockNumber = big.NewInt(block)
+		evt.BlockTime = 1520000000 + block
+		evt.Status = types.TX_STATUS_SUCCESS
+		if buy {
+			evt.TokenS, evt.TokenB = weth.Protocol, lrc.Protocol
+			evt.NormalizedAmountS, evt.NormalizedAmountB = size*price, size
+		} else {
+			evt.TokenS, evt.TokenB = lrc.Protocol, weth.Protocol
+			evt.NormalizedAmountS, evt.NormalizedAmountB = size, size*price
+		}
+		return evt
+	}
+
+	tape := NewTapeManager(0)
+	tape.Start()
+	defer tape.Stop()
+
+	entries, cancel := tape.SubscribeTape("lrc-weth")
+	other, cancelOther := tape.SubscribeTape("FOO-WETH")
+	defer cancelOther()
+
+	fills := []*types.OrderFilledEvent{
+		fill(100, true, types.FILL_ROLE_TAKER, 0.001, 100),
+		// 同一环路的maker一侧不重复推送
+		fill(100, false, types.FILL_ROLE_MAKER, 0.001, 100),
+		fill(101, false, types.FILL_ROLE_TAKER, 0.0009, 50),
+		fill(102, false, "", 0.0011, 20),
+		// 重复到达的成交不再推送
+		fill(101, false, types.FILL_ROLE_TAKER, 0.0009, 50),
+		fill(103, true, types.FILL_ROLE_TAKER, 0.0012, 10),
+	}
+	failed := fill(104, true, types.FILL_ROLE_TAKER, 0.002, 1)
+	failed.Status = types.TX_STATUS_FAILED
+	// 重放的历史成交不推送
+	replayed := fill(104, true, types.FILL_ROLE_TAKER, 0.002, 1)
+	replayed.Replay = true
+	fills = append(fills, failed, replayed)
+
+	for _, v := range fills {
+		eventemitter.Emit(eventemitter.OrderFilled, v)
+	}
+
+	expected := []TapeEntry{
+		{Market: "LRC-WETH", Time: 1520000100, Price: 0.001, Size: 100, Side: util.SideBuy},
+		{Market: "LRC-WETH", Time: 1520000101, Price: 0.0009, Size: 50, Side: util.SideSell},
+		{Market: "LRC-WETH", Time: 1520000102, Price: 0.0011, Size: 20, Side: util.SideSell},
+		{Market: "LRC-WETH", Time: 1520000103, Price: 0.0012, Size: 10, Side: util.SideBuy},
+	}
+	for i, want := range expected {
+		select {
+		case got := <-entries:
+			if got.Market != want.Market || got.Time != want.Time || got.Price != want.Price || got.Size != want.Size || got.Side != want.Side {
+				t.Fatalf("entry %d expect %+v, got %+v", i, want, got)
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("entry %d not delivered", i)
+		}
+	}
+
+	select {
+	case got := <-entries:
+		t.Fatalf("unexpected entry %+v", got)
+	case got := <-other:
+		t.Fatalf("other market should not receive LRC-WETH entry, got %+v", got)
+	default:
+	}
+
+	cancel()
+	if _, ok := <-entries; ok {
+		t.Fatalf("channel should be closed after cancel")
+	}
+	eventemitter.Emit(eventemitter.OrderFilled, fill(105, true, types.FILL_ROLE_TAKER, 0.001, 1))
+}
+
+func TestTapeManager_ForkReset(t *testing.T) {
+	lrc := types.Token{Protocol: common.HexToAddress("0xEF68e7C694F40c8202821eDF525dE3782458639f"), Symbol: "LRC", Decimals: big.NewInt(1e18)}
+	weth := types.Token{Protocol: common.HexToAddress("0x2956356cD2a2bf3202F771F50D3D14A367b48070"), Symbol: "WETH", Decimals: big.NewInt(1e18)}
+	util.SetTokens(map[string]types.Token{"LRC": lrc}, map[string]types.Token{"WETH": weth})
+
+	fill := func(block int64) *types.OrderFilledEvent {
+		evt := &types.OrderFilledEvent{Market: "LRC-WETH", Role: types.FILL_ROLE_TAKER, Price: 0.001, FillIndex: big.NewInt(0)}
+		evt.TxHash = common.BigToHash(big.NewInt(block))
+		evt.BlockNumber = big.NewInt(block)
+		evt.BlockTime = 1520000000 + block
+		evt.Status = types.TX_STATUS_SUCCESS
+		evt.TokenS, evt.TokenB = weth.Protocol, lrc.Protocol
+		evt.NormalizedAmountS, evt.NormalizedAmountB = 0.1, 100
+		return evt
+	}
+
+	tape := NewTapeManager(0)
+	tape.Start()
+	defer tape.Stop()
+
+	entries, cancel := tape.SubscribeTape("LRC-WETH")
+	defer cancel()
+
+	eventemitter.Emit(eventemitter.OrderFilled, fill(100))
+	eventemitter.Emit(eventemitter.OrderFilled, fill(103))
+	tape.handleFork(&types.ForkedEvent{ForkBlock: big.NewInt(101), DetectedBlock: big.NewInt(103)})
+
+	// 分叉块及之前的成交仍不重复推送, 分叉块之后在新链上打包的成交正常推送
+	eventemitter.Emit(eventemitter.OrderFilled, fill(101))
+	eventemitter.Emit(eventemitter.OrderFilled, fill(102))
+
+	for _, want := range []int64{1520000100, 1520000103, 1520000102} {
+		select {
+		case got := <-entries:
+			if got.Time != want {
+				t.Fatalf("expect entry at %d, got %d", want, got.Time)
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("entry at %d not delivered", want)
+		}
+	}
+	select {
+	case got := <-entries:
+		t.Fatalf("unexpected entry %+v", got)
+	default:
+	}
+}
@@ -160,7 +160,7 @@ func updateHuobiCache() {
 func updateCacheByExchange(exchange string, getter func(mkt string) (ticker Ticker, err error)) {
 
 	tkFields := make([]TickerField, 0)
-	for _, v := range util.AllMarkets {
+	for _, v := range util.AllMarkets() {
 
 		if !stringInSlice(v, supportedMarkets) {
 			continue
@@ -223,7 +223,7 @@ func setHMCache(exchange string, tickers []TickerField) {
 func NewCollector(cronJobLock bool) *CollectorImpl {
 	rst := &CollectorImpl{exs: make([]ExchangeImpl, 0), syncInterval: defaultSyncInterval, cron: cron.New(), cronJobLock: cronJobLock}
 	rst.localCache = gocache.New(5*time.Second, 5*time.Minute)
-	for _, v := range util.AllMarkets {
+	for _, v := range util.AllMarkets() {
 		if strings.HasSuffix(v, "ETH") {
 			supportedMarkets = append(supportedMarkets, v)
 		}
@@ -28,6 +28,7 @@ import (
 	"github.com/Loopring/relay/log"
 	"github.com/Loopring/relay/market/util"
 	"github.com/Loopring/relay/types"
+	"github.com/ethereum/go-ethereum/common"
 	gocache "github.com/patrickmn/go-cache"
 	"github.com/robfig/cron"
 	"sort"
@@ -72,6 +73,7 @@ type Ticker struct {
 	Last      float64 `json:"last"`
 	Buy       float64 `json:"buy"`
 	Sell      float64 `json:"sell"`
+	Vwap      float64 `json:"vwap"`
 	Change    string  `json:"change"`
 }
 
@@ -114,6 +116,7 @@ func NewTrendManager(dao dao.RdsService, cronJobLock bool) TrendManager {
 	once.Do(func() {
 		trendManager = TrendManager{rds: dao, cron: cron.New(), cronJobLock: cronJobLock}
 		trendManager.localCache = gocache.New(5*time.Second, 5*time.Minute)
+		eventemitter.Declare(eventemitter.TrendUpdated, eventemitter.LoopringTickerUpdated)
 		trendManager.LoadCache()
 		if cronJobLock {
 			trendManager.startScheduleUpdate()
@@ -134,7 +137,7 @@ func (t *TrendManager) ProofRead() {
 		return
 	}
 
-	for _, mkt := range util.AllMarkets {
+	for _, mkt := range util.AllMarkets() {
 		copyOfMkt := mkt
 		go func(market string) {
 			for _, interval := range allInterval {
@@ -211,7 +214,7 @@ func (t *TrendManager) refreshCacheByInterval(interval string) {
 	log.Info("start refresh cache by interval " + interval)
 
 	//trendMap := make(map[string]Cache)
-	for _, mkt := range util.AllMarkets {
+	for _, mkt := range util.AllMarkets() {
 		mktCache := Cache{}
 		mktCache.Trends = make([]Trend, 0)
 
@@ -247,7 +250,7 @@ func (t *TrendManager) refreshMinIntervalCache() {
 
 	//trendMap := make(map[string]Cache)
 	tickerMap := make(map[string]Ticker)
-	for _, mkt := range util.AllMarkets {
+	for _, mkt := range util.AllMarkets() {
 		mktCache := Cache{}
 		mktCache.Trends = make([]Trend, 0)
 		mktCache.Fills = make([]dao.FillEvent, 0)
@@ -302,10 +305,12 @@ func calculateTicker(market string, fills []dao.FillEvent, trends []Trend, now t
 	before24Hour := now.Unix() - 24*60*60
 
 	var (
-		high   float64
-		low    float64
-		vol    float64
-		amount float64
+		high       float64
+		low        float64
+		vol        float64
+		amount     float64
+		vwapVol    float64
+		vwapAmount float64
 	)
 
 	copyOfTrends := make([]Trend, 0)
@@ -326,6 +331,8 @@ func calculateTicker(market string, fills []dao.FillEvent, trends []Trend, now t
 
 		vol += data.Vol
 		amount += data.Amount
+		vwapVol += data.Vol
+		vwapAmount += data.Amount
 
 		if result.Open == 0 && data.Open != 0 {
 			result.Open = data.Open
@@ -358,7 +365,24 @@ func calculateTicker(market string, fills []dao.FillEvent, trends []Trend, now t
 			amount += util.StringToFloat(data.TokenS, data.AmountS)
 		}
 
-		price := util.CalculatePrice(data.AmountS, data.AmountB, data.TokenS, data.TokenB)
+		// dust成交只计入成交量, 不参与价格统计
+		if isDustFill(data) {
+			continue
+		}
+
+		if data.Side == util.SideBuy {
+			vwapVol += util.StringToFloat(data.TokenS, data.AmountS)
+			vwapAmount += util.StringToFloat(data.TokenB, data.AmountB)
+		} else {
+			vwapVol += util.StringToFloat(data.TokenB, data.AmountB)
+			vwapAmount += util.StringToFloat(data.TokenS, data.AmountS)
+		}
+
+		price, err := util.CalculatePrice(data.AmountS, data.AmountB, common.HexToAddress(data.TokenS), common.HexToAddress(data.TokenB), data.Market)
+		if err != nil {
+			log.Debugf("trend manager,fill:%s skipped in price stats, %s", data.RingHash, err.Error())
+			continue
+		}
 
 		if result.Open == 0 && price != 0 {
 			result.Open = price
@@ -384,11 +408,22 @@ func calculateTicker(market string, fills []dao.FillEvent, trends []Trend, now t
 		result.Change = fmt.Sprintf("%.2f%%", 100*(result.Last-result.Open)/result.Open)
 	}
 
+	if vwapAmount > 0 {
+		result.Vwap = vwapVol / vwapAmount
+	}
+
 	result.Vol = vol
 	result.Amount = amount
 	return result
 }
 
+func isDustFill(fill dao.FillEvent) bool {
+	if fill.Side == util.SideBuy {
+		return util.IsDustFill(fill.Market, fill.AmountB)
+	}
+	return util.IsDustFill(fill.Market, fill.AmountS)
+}
+
 func (t *TrendManager) startScheduleUpdate() {
 	t.cron.AddFunc("10 1 * * * *", t.ScheduleUpdate)
 	t.cron.AddFunc("0 30 1 * * *", t.ProofRead)
@@ -416,7 +451,7 @@ func (t *TrendManager) insertByTrend(interval string) error {
 	start := end.Unix() - getTsInterval(interval) + 1
 	//multiple := tsInterval / tsOneHour
 
-	for _, mkt := range util.AllMarkets {
+	for _, mkt := range util.AllMarkets() {
 
 		trends, err := t.rds.TrendQueryByInterval(OneHour, mkt, start, end.Unix())
 
@@ -538,7 +573,15 @@ func (t *TrendManager) insertMinIntervalTrend(interval string, start int64, mkt
 			amount += util.StringToFloat(data.TokenS, data.AmountS)
 		}
 
-		price := util.CalculatePrice(data.AmountS, data.AmountB, data.TokenS, data.TokenB)
+		if isDustFill(data) {
+			continue
+		}
+
+		price, err := util.CalculatePrice(data.AmountS, data.AmountB, common.HexToAddress(data.TokenS), common.HexToAddress(data.TokenB), data.Market)
+		if err != nil {
+			log.Debugf("trend manager,fill:%s skipped in price stats, %s", data.RingHash, err.Error())
+			continue
+		}
 
 		if toInsert.Open == 0 && price != 0 {
 			toInsert.Open = price
@@ -667,7 +710,7 @@ func (t *TrendManager) ScheduleUpdate() {
 
 	var wg sync.WaitGroup
 
-	for _, mkt := range util.AllMarkets {
+	for _, mkt := range util.AllMarkets() {
 		now := time.Now()
 		firstSecondThisHour := time.Date(now.Year(), now.Month(), now.Day(), now.Hour(), 0, 1, 0, now.Location())
 
@@ -745,7 +788,15 @@ func (t *TrendManager) ScheduleUpdate() {
 							amount += util.StringToFloat(data.TokenS, data.AmountS)
 						}
 
-						price := util.CalculatePrice(data.AmountS, data.AmountB, data.TokenS, data.TokenB)
+						if isDustFill(data) {
+							continue
+						}
+
+						price, err := util.CalculatePrice(data.AmountS, data.AmountB, common.HexToAddress(data.TokenS), common.HexToAddress(data.TokenB), data.Market)
+						if err != nil {
+							log.Debugf("trend manager,fill:%s skipped in price stats, %s", data.RingHash, err.Error())
+							continue
+						}
 
 						if open == 0 && price != 0 {
 							open = price
@@ -829,6 +880,8 @@ func (t *TrendManager) aggregate(fills []dao.FillEvent, trends []Trend) (trend T
 		low    float64
 		vol    float64
 		amount float64
+		first  float64
+		last   float64
 	)
 
 	sort.Slice(fills, func(i, j int) bool {
@@ -849,7 +902,20 @@ func (t *TrendManager) aggregate(fills []dao.FillEvent, trends []Trend) (trend T
 			amount += util.StringToFloat(data.TokenS, data.AmountS)
 		}
 
-		price := util.CalculatePrice(data.AmountS, data.AmountB, data.TokenS, data.TokenB)
+		if isDustFill(data) {
+			continue
+		}
+
+		price, err := util.CalculatePrice(data.AmountS, data.AmountB, common.HexToAddress(data.TokenS), common.HexToAddress(data.TokenB), data.Market)
+		if err != nil {
+			log.Debugf("trend manager,fill:%s skipped in price stats, %s", data.RingHash, err.Error())
+			continue
+		}
+
+		if first == 0 {
+			first = price
+		}
+		last = price
 
 		if high == 0 || high < price {
 			high = price
@@ -861,11 +927,8 @@ func (t *TrendManager) aggregate(fills []dao.FillEvent, trends []Trend) (trend T
 
 	trend.High = high
 	trend.Low = low
-
-	openFill := fills[0]
-	trend.Open = util.CalculatePrice(openFill.AmountS, openFill.AmountB, openFill.TokenS, openFill.TokenB)
-	closeFill := fills[len(fills)-1]
-	trend.Close = util.CalculatePrice(closeFill.AmountS, closeFill.AmountB, closeFill.TokenS, closeFill.TokenB)
+	trend.Open = first
+	trend.Close = last
 
 	trend.Vol = vol
 	trend.Amount = amount
@@ -1042,7 +1105,8 @@ func (t *TrendManager) HandleOrderFilled(input eventemitter.EventData) (err erro
 	if t.cacheReady {
 
 		event := input.(*types.OrderFilledEvent)
-		if event.Status != types.TX_STATUS_SUCCESS {
+		// 重放的成交已计入趋势缓存, 由ProofRead按db重新校正
+		if event.Status != types.TX_STATUS_SUCCESS || event.Replay {
 			return
 		}
 
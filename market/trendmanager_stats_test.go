@@ -0,0 +1,66 @@
+/*
+
+  Copyright 2017 Loopring Project Ltd (Loopring Foundation).
+
+  Licensed under the Apache License, Version 2.0 (the "License");
+  you may not use this file except in compliance with the License.
+  You may obtain a copy of the License at
+
+  http://www.apache.org/licenses/LICENSE-2.0
+
+  Unless required by applicable law or agreed to in writing, software
+  distributed under the License is distributed on an "AS IS" BASIS,
+  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+  See the License for the specific language governing permissions and
+  limitations under the License.
+
+*/
+
+package market
+
+import (
+	"github.com/Loopring/relay/config"
+	"github.com/Loopring/relay/dao"
+	"github.com/Loopring/relay/log"
+	"github.com/Loopring/relay/market/util"
+	"github.com/Loopring/relay/types"
+	"github.com/ethereum/go-ethereum/common"
+	"go.uber.org/zap"
+	"math"
+	"math/big"
+	"testing"
+	"time"
+)
+
+func TestCalculateTicker_ExcludeDustFill(t *testing.T) {
+	zapOpts := zap.NewDevelopmentConfig()
+	zapOpts.Level = zap.NewAtomicLevelAt(zap.ErrorLevel)
+	log.Initialize(config.LogOptions{ZapOpts: zapOpts})
+
+	lrc := types.Token{Protocol: common.HexToAddress("0xEF68e7C694F40c8202821eDF525dE3782458639f"), Symbol: "LRC", Decimals: big.NewInt(1e18)}
+	weth := types.Token{Protocol: common.HexToAddress("0x2956356cD2a2bf3202F771F50D3D14A367b48070"), Symbol: "WETH", Decimals: big.NewInt(1e18)}
+	util.SetTokens(map[string]types.Token{"LRC": lrc}, map[string]types.Token{"WETH": weth})
+	util.SetMinFillSizes(map[string]string{"LRC-WETH": "1"})
+	defer util.SetMinFillSizes(nil)
+
+	now := time.Now()
+	fills := []dao.FillEvent{
+		// 100 LRC -> 0.1 WETH, price 0.001
+		{Market: "LRC-WETH", Side: util.SideSell, TokenS: lrc.Protocol.Hex(), TokenB: weth.Protocol.Hex(), AmountS: "100000000000000000000", AmountB: "100000000000000000", CreateTime: now.Unix() - 10},
+		// dust: 0.5 LRC -> 0.05 WETH, price 0.1
+		{Market: "LRC-WETH", Side: util.SideSell, TokenS: lrc.Protocol.Hex(), TokenB: weth.Protocol.Hex(), AmountS: "500000000000000000", AmountB: "50000000000000000", CreateTime: now.Unix() - 5},
+	}
+
+	ticker := calculateTicker("LRC-WETH", fills, nil, now)
+
+	if math.Abs(ticker.Vwap-0.001) > 1e-12 {
+		t.Errorf("vwap should only include normal fill, expect 0.001, got %v", ticker.Vwap)
+	}
+	if math.Abs(ticker.Last-0.001) > 1e-12 || math.Abs(ticker.High-0.001) > 1e-12 {
+		t.Errorf("dust fill should not affect last/high, got last %v high %v", ticker.Last, ticker.High)
+	}
+	// 成交量仍然包含dust成交
+	if math.Abs(ticker.Amount-100.5) > 1e-9 || math.Abs(ticker.Vol-0.15) > 1e-9 {
+		t.Errorf("dust fill should be recorded in volume, got amount %v vol %v", ticker.Amount, ticker.Vol)
+	}
+}
@@ -29,9 +29,13 @@ import (
 	"github.com/ethereum/go-ethereum/common"
 	"github.com/robfig/cron"
 	"io/ioutil"
+	"math"
 	"math/big"
 	"os"
+	"sort"
 	"strings"
+	"sync"
+	"time"
 )
 
 const SideSell = "sell"
@@ -47,40 +51,287 @@ var MarketBaseOrder = map[string]uint8{"BAR": 5, "LRC": 10, "WETH": 20, "DAI": 3
 type TokenStandard uint8
 
 func StringToFloat(token string, amount string) float64 {
-	rst, _ := new(big.Rat).SetString(amount)
+	rst, _ := new(big.Float).SetString(amount)
 	ts, _ := AddressToToken(common.HexToAddress(token))
-	weiRat := new(big.Rat).SetInt64(ts.Decimals.Int64())
-	rst.Quo(rst, weiRat)
+	return quoFloat(rst, ts.Decimals)
+}
+
+// ByteToFloatWithDecimals 链上金额按token精度转换, decimals为小数位数, 如usdc为6
+func ByteToFloatWithDecimals(amount []byte, decimals int) float64 {
+	rst := new(big.Float).SetInt(new(big.Int).SetBytes(amount))
+	return quoFloat(rst, decimalsScale(decimals))
+}
+
+// 大额余额超出int64范围, 用big.Float除以精度避免截断
+func quoFloat(amount *big.Float, scale *big.Int) float64 {
+	rst := new(big.Float).Quo(amount, new(big.Float).SetInt(scale))
 	result, _ := rst.Float64()
 	return result
 }
 
+// FloatToByteWithDecimals 四舍五入到最小单位, 负数、NaN及Inf返回false
+func FloatToByteWithDecimals(amount float64, decimals int) ([]byte, bool) {
+	return FloatToByteRound(amount, decimals, big.ToNearestAway)
+}
+
+// FloatToByteRound 按mode舍入到最小单位, 负数、NaN及Inf返回false.
+// 先精确相乘, 结果为整数(如1e9*1e18)时直接返回; 否则就近舍入回float64的53位精度再按mode取整,
+// 抵消二进制表示误差(如0.1*1e18得到1e17), 避免向上/向下舍入时多出或少掉1个最小单位
+func FloatToByteRound(amount float64, decimals int, mode big.RoundingMode) ([]byte, bool) {
+	if amount < 0 || math.IsNaN(amount) || math.IsInf(amount, 0) {
+		return nil, false
+	}
+
+	x := big.NewFloat(amount)
+	scale := new(big.Float).SetInt(decimalsScale(decimals))
+	rst := new(big.Float).SetPrec(x.Prec()+scale.Prec()).Mul(x, scale)
+	if !rst.IsInt() {
+		rst.SetPrec(53)
+	}
+	return roundFloat(rst, mode).Bytes(), true
+}
+
+// roundFloat 非负数按mode舍入为整数, big.Float.Int只会向零截断
+func roundFloat(amount *big.Float, mode big.RoundingMode) *big.Int {
+	quo, acc := amount.Int(nil)
+	if acc == big.Exact {
+		return quo
+	}
+
+	switch mode {
+	case big.AwayFromZero, big.ToPositiveInf:
+		quo.Add(quo, big.NewInt(1))
+	case big.ToNearestEven, big.ToNearestAway:
+		rem := new(big.Float).Sub(amount, new(big.Float).SetInt(quo))
+		half := rem.Cmp(big.NewFloat(0.5))
+		if half > 0 || (half == 0 && (mode == big.ToNearestAway || quo.Bit(0) == 1)) {
+			quo.Add(quo, big.NewInt(1))
+		}
+	}
+	return quo
+}
+
+func decimalsScale(decimals int) *big.Int {
+	return new(big.Int).Exp(big.NewInt(10), big.NewInt(int64(decimals)), nil)
+}
+
 var (
-	SupportTokens  map[string]types.Token // token symbol to entity
-	AllTokens      map[string]types.Token
-	SupportMarkets map[string]types.Token // token symbol to contract hex address
-	AllMarkets     []string
-	AllTokenPairs  []TokenPair
-	SymbolTokenMap map[common.Address]string
+	supportTokenMap  map[string]types.Token // token symbol to entity
+	allTokenMap      map[string]types.Token
+	supportMarketMap map[string]types.Token // token symbol to contract hex address
+	allMarketList    []string
+	allTokenPairList []TokenPair
+	addressSymbolMap map[common.Address]string
+
+	// symbol -> 包含该token(任意一方)的市场, 随allMarketList一起重建
+	tokenMarkets map[string][]string
+
+	// 配置文件中的token symbol, 与市场token一起不参与淘汰
+	configTokens map[string]bool
+
+	// 保护以上token/market数据, extractor等goroutine并发读取, 刷新及token注册时写入.
+	// 包外通过SupportTokens/AllTokens等加锁读取, 返回的map可能被调用方继续持有,
+	// 因此写入时总是复制后整体替换(见tokenMaps), 不原地修改
+	tokensMtx sync.RWMutex
 )
 
+// tokenMaps token相关map的副本, 修改完成后publish整体替换全局变量, 之前被读取的map保持不变
+type tokenMaps struct {
+	supportTokens  map[string]types.Token
+	supportMarkets map[string]types.Token
+	allTokens      map[string]types.Token
+	symbolTokenMap map[common.Address]string
+}
+
+// cloneTokenMaps should be called with tokensMtx locked
+func cloneTokenMaps() *tokenMaps {
+	m := &tokenMaps{}
+	m.supportTokens = copyTokens(supportTokenMap)
+	m.supportMarkets = copyTokens(supportMarketMap)
+	m.allTokens = copyTokens(allTokenMap)
+	m.symbolTokenMap = make(map[common.Address]string, len(addressSymbolMap))
+	for k, v := range addressSymbolMap {
+		m.symbolTokenMap[k] = v
+	}
+	return m
+}
+
+func copyTokens(src map[string]types.Token) map[string]types.Token {
+	dst := make(map[string]types.Token, len(src))
+	for k, v := range src {
+		dst[k] = v
+	}
+	return dst
+}
+
+// publish should be called with tokensMtx locked
+func (m *tokenMaps) publish() {
+	supportTokenMap, supportMarketMap, allTokenMap, addressSymbolMap = m.supportTokens, m.supportMarkets, m.allTokens, m.symbolTokenMap
+}
+
+func (m *tokenMaps) put(token types.Token) {
+	if token.IsMarket {
+		m.supportMarkets[token.Symbol] = token
+	} else {
+		m.supportTokens[token.Symbol] = token
+	}
+	m.allTokens[token.Symbol] = token
+	m.symbolTokenMap[token.Protocol] = token.Symbol
+}
+
+func (m *tokenMaps) remove(symbol string) {
+	if token, ok := m.allTokens[symbol]; ok {
+		delete(m.symbolTokenMap, token.Protocol)
+	}
+	delete(m.supportTokens, symbol)
+	delete(m.supportMarkets, symbol)
+	delete(m.allTokens, symbol)
+	forgetTokenActivity(symbol)
+}
+
+// update 修改已存在token的属性(如decimals), 保持其在supportTokens/supportMarkets中的归属
+func (m *tokenMaps) update(symbol string, token types.Token) {
+	m.allTokens[symbol] = token
+	if _, ok := m.supportTokens[symbol]; ok {
+		m.supportTokens[symbol] = token
+	}
+	if _, ok := m.supportMarkets[symbol]; ok {
+		m.supportMarkets[symbol] = token
+	}
+}
+
 func StartRefreshCron(option config.MarketOptions) {
 	mktCron := cron.New()
 	mktCron.AddFunc("1 0/10 * * * *", func() {
 		log.Info("start market util refresh.....")
-		SupportTokens, SupportMarkets, AllTokens, AllMarkets, AllTokenPairs, SymbolTokenMap = getTokenAndMarketFromDB(option.TokenFile)
+		reloadTokens(option.TokenFile)
 	})
 	mktCron.Start()
 }
 
+func reloadTokens(tokenfile string) {
+	m := &tokenMaps{}
+	var markets []string
+	var pairs []TokenPair
+	m.supportTokens, m.supportMarkets, m.allTokens, markets, pairs, m.symbolTokenMap = getTokenAndMarketFromDB(tokenfile)
+
+	// defer后进先出, 先解锁再发出TokenEvicted, 避免watcher回调读取token时死锁
+	var evicted []types.Token
+	defer func() { emitEvicted(evicted) }()
+	tokensMtx.Lock()
+	defer tokensMtx.Unlock()
+	m.publish()
+	configTokens = tokenSymbols(m.allTokens)
+	allMarketList, allTokenPairList = markets, pairs
+	tokenMarkets = indexMarkets(allMarketList)
+	evicted = evictTokens()
+}
+
+// SetTokens 使用给定的token替换当前全部token并重建市场, 供测试及外部加载使用,
+// 给定的token视同配置文件中的token, 不会被淘汰
+func SetTokens(tokens, markets map[string]types.Token) {
+	m := &tokenMaps{
+		supportTokens:  copyTokens(tokens),
+		supportMarkets: copyTokens(markets),
+		allTokens:      make(map[string]types.Token),
+		symbolTokenMap: make(map[common.Address]string),
+	}
+	for _, src := range []map[string]types.Token{tokens, markets} {
+		for k, v := range src {
+			m.allTokens[k] = v
+			m.symbolTokenMap[v.Protocol] = v.Symbol
+		}
+	}
+
+	tokensMtx.Lock()
+	defer tokensMtx.Unlock()
+	m.publish()
+	configTokens = tokenSymbols(m.allTokens)
+	rebuildMarkets()
+}
+
+func tokenSymbols(tokens map[string]types.Token) map[string]bool {
+	symbols := make(map[string]bool, len(tokens))
+	for symbol := range tokens {
+		symbols[symbol] = true
+	}
+	return symbols
+}
+
+// SupportTokens 返回当前支持的非市场token, 返回的map为只读快照, 调用方不能修改
+func SupportTokens() map[string]types.Token {
+	tokensMtx.RLock()
+	defer tokensMtx.RUnlock()
+	return supportTokenMap
+}
+
+// SupportMarkets 返回当前的市场token(如WETH), 只读快照
+func SupportMarkets() map[string]types.Token {
+	tokensMtx.RLock()
+	defer tokensMtx.RUnlock()
+	return supportMarketMap
+}
+
+// AllTokens 返回全部token(包括市场token), 只读快照
+func AllTokens() map[string]types.Token {
+	tokensMtx.RLock()
+	defer tokensMtx.RUnlock()
+	return allTokenMap
+}
+
+// AllMarkets 返回全部市场, 只读快照
+func AllMarkets() []string {
+	tokensMtx.RLock()
+	defer tokensMtx.RUnlock()
+	return allMarketList
+}
+
+// AllTokenPairs 返回全部交易对, 只读快照
+func AllTokenPairs() []TokenPair {
+	tokensMtx.RLock()
+	defer tokensMtx.RUnlock()
+	return allTokenPairList
+}
+
+// SymbolTokenMap 返回token地址到symbol的映射, 只读快照
+func SymbolTokenMap() map[common.Address]string {
+	tokensMtx.RLock()
+	defer tokensMtx.RUnlock()
+	return addressSymbolMap
+}
+
+// TokenBySymbol find token by symbol, ok is false while token not loaded
+func TokenBySymbol(symbol string) (types.Token, bool) {
+	tokensMtx.RLock()
+	defer tokensMtx.RUnlock()
+	token, ok := allTokenMap[strings.ToUpper(symbol)]
+	return token, ok
+}
+
+// TokenByAddress find token by contract address through addressSymbolMap
+func TokenByAddress(addr common.Address) (types.Token, bool) {
+	tokensMtx.RLock()
+	defer tokensMtx.RUnlock()
+	symbol, ok := addressSymbolMap[addr]
+	if !ok {
+		return types.Token{}, false
+	}
+	token, ok := allTokenMap[symbol]
+	return token, ok
+}
+
 type token struct {
 	Protocol string `json:"Protocol"`
 	Symbol   string `json:"Symbol"`
 	Source   string `json:"Source"`
 	Deny     bool   `json:"Deny"`
-	Decimals int    `json:"Decimals"`
+	Decimals *int   `json:"Decimals"`
 	IsMarket bool   `json:"IsMarket"`
 	IcoPrice string `json:"IcoPrice"`
+
+	FeeOnTransfer   bool   `json:"FeeOnTransfer"`
+	TransferFeeRate string `json:"TransferFeeRate"`
+	Upgradeable     bool   `json:"Upgradeable"`
 }
 
 func (t *token) convert() types.Token {
@@ -90,13 +341,22 @@ func (t *token) convert() types.Token {
 	dst.Symbol = strings.ToUpper(t.Symbol)
 	dst.Source = t.Source
 	dst.Deny = t.Deny
-	dst.Decimals = new(big.Int)
-	dst.Decimals.SetString("1"+strings.Repeat("0", t.Decimals), 0)
+	// decimals unknown, should be filled by BackfillDecimals
+	if t.Decimals != nil {
+		dst.Decimals = new(big.Int)
+		dst.Decimals.SetString("1"+strings.Repeat("0", *t.Decimals), 0)
+	}
 	dst.IsMarket = t.IsMarket
 	if "" != t.IcoPrice {
 		dst.IcoPrice = new(big.Rat)
 		dst.IcoPrice.SetString(t.IcoPrice)
 	}
+	dst.FeeOnTransfer = t.FeeOnTransfer
+	if "" != t.TransferFeeRate {
+		dst.TransferFeeRate = new(big.Rat)
+		dst.TransferFeeRate.SetString(t.TransferFeeRate)
+	}
+	dst.Upgradeable = t.Upgradeable
 
 	return dst
 }
@@ -112,8 +372,6 @@ func getTokenAndMarketFromDB(tokenfile string) (
 	supportTokens = make(map[string]types.Token)
 	allTokens = make(map[string]types.Token)
 	supportMarkets = make(map[string]types.Token)
-	allMarkets = make([]string, 0)
-	allTokenPairs = make([]TokenPair, 0)
 	symbolTokenMap = make(map[common.Address]string)
 
 	var list []token
@@ -151,6 +409,15 @@ func getTokenAndMarketFromDB(tokenfile string) (
 		symbolTokenMap[v.Protocol] = v.Symbol
 	}
 
+	allMarkets, allTokenPairs = buildMarkets(allTokens, supportMarkets)
+
+	return
+}
+
+func buildMarkets(allTokens, supportMarkets map[string]types.Token) (allMarkets []string, allTokenPairs []TokenPair) {
+	allMarkets = make([]string, 0)
+	allTokenPairs = make([]TokenPair, 0)
+
 	// set all markets
 	for k := range allTokens { // lrc,omg
 		for kk := range supportMarkets { //eth
@@ -185,25 +452,432 @@ func getTokenAndMarketFromDB(tokenfile string) (
 	return
 }
 
-func Initialize(options config.MarketOptions) {
+// indexMarkets 建立symbol到市场的反向索引, 市场的两个token都会被索引
+func indexMarkets(allMarkets []string) map[string][]string {
+	index := make(map[string][]string)
+	for _, market := range allMarkets {
+		s, b := UnWrap(market)
+		if s == "" || b == "" {
+			continue
+		}
+		index[s] = append(index[s], market)
+		if b != s {
+			index[b] = append(index[b], market)
+		}
+	}
+	for _, markets := range index {
+		sort.Strings(markets)
+	}
+	return index
+}
+
+// MarketsForToken 返回allMarketList中包含该token的所有市场, 市场token(如WETH)作为报价一方时同样包含在内,
+// 只有一个市场token时即为全部市场. 未知的symbol返回空列表
+func MarketsForToken(symbol string) []string {
+	tokensMtx.RLock()
+	defer tokensMtx.RUnlock()
 
-	SupportTokens = make(map[string]types.Token)
-	SupportMarkets = make(map[string]types.Token)
-	AllTokens = make(map[string]types.Token)
-	SymbolTokenMap = make(map[common.Address]string)
+	markets := tokenMarkets[strings.ToUpper(symbol)]
+	return append(make([]string, 0, len(markets)), markets...)
+}
+
+func Initialize(options config.MarketOptions) {
 
-	SupportTokens, SupportMarkets, AllTokens, AllMarkets, AllTokenPairs, SymbolTokenMap = getTokenAndMarketFromDB(options.TokenFile)
+	reloadTokens(options.TokenFile)
+	SetMinFillSizes(options.MinFillSize)
+	SetMaxTokens(options.MaxTokens)
+	SetRegisterDebounce(options.RegisterDebounce)
+	eventemitter.Declare(eventemitter.TokenMetadataChanged, eventemitter.MarketAnomaly, eventemitter.TokenEvicted)
 
 	// StartRefreshCron(rds)
 
-	//tokenRegisterWatcher := &eventemitter.Watcher{false, TokenRegister}
-	tokenUnRegisterWatcher := &eventemitter.Watcher{false, TokenUnRegister}
-	//eventemitter.On(eventemitter.TokenRegistered, tokenRegisterWatcher)
+	tokenRegisterWatcher := &eventemitter.Watcher{Concurrent: false, Handle: TokenRegister}
+	tokenUnRegisterWatcher := &eventemitter.Watcher{Concurrent: false, Handle: TokenUnRegister}
+	eventemitter.On(eventemitter.TokenRegistered, tokenRegisterWatcher)
 	eventemitter.On(eventemitter.TokenUnRegistered, tokenUnRegisterWatcher)
+
+	transferWatcher := &eventemitter.Watcher{Concurrent: false, Handle: handleTokenTransfer}
+	eventemitter.On(eventemitter.Transfer, transferWatcher)
+}
+
+var (
+	maxTokens int
+	// symbol -> 最近一次活跃的序号, 序号越小越久没有transfer
+	// 每笔transfer都会更新, 使用单独的锁避免与token读取竞争tokensMtx
+	tokenActivity = make(map[string]int64)
+	activitySeq   int64
+	activityMtx   sync.Mutex
+)
+
+func SetMaxTokens(max int) {
+	tokensMtx.Lock()
+	maxTokens = max
+	evicted := evictTokens()
+	tokensMtx.Unlock()
+
+	emitEvicted(evicted)
+}
+
+var (
+	// TokenRegistered连续到达时合并, 静默registerDebounce后只重建一次市场, 0为每次注册立即重建
+	registerDebounce time.Duration
+	rebuildTimer     *time.Timer
+	marketRebuilds   int64
+)
+
+// SetRegisterDebounce millis为毫秒
+func SetRegisterDebounce(millis int) {
+	tokensMtx.Lock()
+	defer tokensMtx.Unlock()
+
+	registerDebounce = time.Duration(millis) * time.Millisecond
+}
+
+// rebuildMarkets should be called with tokensMtx locked
+func rebuildMarkets() {
+	allMarketList, allTokenPairList = buildMarkets(allTokenMap, supportMarketMap)
+	tokenMarkets = indexMarkets(allMarketList)
+	marketRebuilds++
+}
+
+// scheduleMarketRebuild should be called with tokensMtx locked, 窗口内再次调用时重新计时
+func scheduleMarketRebuild() {
+	if rebuildTimer != nil {
+		rebuildTimer.Stop()
+	}
+	rebuildTimer = time.AfterFunc(registerDebounce, func() {
+		tokensMtx.Lock()
+		defer tokensMtx.Unlock()
+		rebuildMarkets()
+		log.Infof("market util,rebuild markets after token registered, %d markets", len(allMarketList))
+	})
+}
+
+func handleTokenTransfer(input eventemitter.EventData) error {
+	evt := input.(*types.TransferEvent)
+	TouchToken(evt.Protocol)
+	return nil
+}
+
+// TouchToken mark token active, least active tokens will be evicted first while exceeding MaxTokens
+func TouchToken(protocol common.Address) {
+	tokensMtx.RLock()
+	symbol, ok := addressSymbolMap[protocol]
+	tokensMtx.RUnlock()
+
+	if ok {
+		touchToken(symbol)
+	}
+}
+
+func touchToken(symbol string) {
+	activityMtx.Lock()
+	defer activityMtx.Unlock()
+
+	activitySeq++
+	tokenActivity[symbol] = activitySeq
+}
+
+func forgetTokenActivity(symbol string) {
+	activityMtx.Lock()
+	defer activityMtx.Unlock()
+
+	delete(tokenActivity, symbol)
+}
+
+// evictTokens should be called with tokensMtx locked
+// 淘汰最久没有transfer的token, 市场token(如WETH)及配置文件中的token不淘汰.
+// 返回被淘汰的token, 调用方解锁后通过emitEvicted发出TokenEvicted
+func evictTokens() []types.Token {
+	if maxTokens <= 0 || len(allTokenMap) <= maxTokens {
+		return nil
+	}
+
+	var candidates []string
+	for symbol := range allTokenMap {
+		if isPinnedToken(symbol) {
+			continue
+		}
+		candidates = append(candidates, symbol)
+	}
+
+	activity := make(map[string]int64)
+	activityMtx.Lock()
+	for _, symbol := range candidates {
+		activity[symbol] = tokenActivity[symbol]
+	}
+	activityMtx.Unlock()
+	sort.Slice(candidates, func(i, j int) bool {
+		return activity[candidates[i]] < activity[candidates[j]]
+	})
+
+	m := cloneTokenMaps()
+	var evicted []types.Token
+	for _, symbol := range candidates {
+		if len(m.allTokens) <= maxTokens {
+			break
+		}
+		evicted = append(evicted, m.allTokens[symbol])
+		m.remove(symbol)
+		log.Infof("market util,token:%s evicted, max tokens %d", symbol, maxTokens)
+	}
+
+	if len(evicted) > 0 {
+		m.publish()
+		rebuildMarkets()
+	}
+	return evicted
+}
+
+// emitEvicted should be called without tokensMtx locked
+func emitEvicted(evicted []types.Token) {
+	for _, token := range evicted {
+		eventemitter.Emit(eventemitter.TokenEvicted, &types.TokenEvictedEvent{Token: token.Protocol, Symbol: token.Symbol})
+	}
+}
+
+// isPinnedToken should be called with tokensMtx locked
+// 运行时AddToken/TokenRegister加入的token同样会进入supportTokenMap, 因此只按市场及配置文件判断
+func isPinnedToken(symbol string) bool {
+	if _, ok := supportMarketMap[symbol]; ok {
+		return true
+	}
+	return configTokens[symbol]
+}
+
+const defaultDecimals = 18
+
+type DecimalsReader func(tokenAddress common.Address, blockParameter string) (uint8, error)
+
+// 链上注册的token没有decimals, 注册时通过reader查询
+var registerDecimalsReader DecimalsReader
+
+func SetDecimalsReader(reader DecimalsReader) {
+	registerDecimalsReader = reader
+}
+
+// BackfillDecimals query decimals on chain for tokens whose decimals unknown,
+// token still unknown after query will use the default 18 decimals
+func BackfillDecimals(reader DecimalsReader) {
+	unknown := make(map[string]types.Token)
+	tokensMtx.RLock()
+	for symbol, token := range allTokenMap {
+		if token.Decimals == nil {
+			unknown[symbol] = token
+		}
+	}
+	tokensMtx.RUnlock()
+
+	for symbol, token := range unknown {
+		decimals, err := reader(token.Protocol, "latest")
+		if err != nil {
+			log.Errorf("market util,backfill token:%s decimals error:%s, use default decimals %d", symbol, err.Error(), defaultDecimals)
+			decimals = defaultDecimals
+		}
+		token.Decimals = new(big.Int).Exp(big.NewInt(10), big.NewInt(int64(decimals)), nil)
+		log.Infof("market util,backfill token:%s decimals:%d", symbol, decimals)
+
+		tokensMtx.Lock()
+		if current, ok := allTokenMap[symbol]; ok && current.Protocol == token.Protocol {
+			m := cloneTokenMaps()
+			m.update(symbol, token)
+			m.publish()
+		}
+		tokensMtx.Unlock()
+	}
+}
+
+func StartDecimalsRefreshCron(option config.MarketOptions, reader DecimalsReader) {
+	if option.DecimalsRefreshCron == "" {
+		return
+	}
+
+	decimalsCron := cron.New()
+	decimalsCron.AddFunc(option.DecimalsRefreshCron, func() {
+		log.Info("start refresh upgradeable token decimals.....")
+		RefreshUpgradeableDecimals(reader)
+	})
+	decimalsCron.Start()
+}
+
+// RefreshUpgradeableDecimals re-read decimals of upgradeable tokens, update token and emit TokenMetadataChanged while changed
+func RefreshUpgradeableDecimals(reader DecimalsReader) {
+	upgradeable := make(map[string]types.Token)
+	tokensMtx.RLock()
+	for symbol, token := range allTokenMap {
+		if token.Upgradeable {
+			upgradeable[symbol] = token
+		}
+	}
+	tokensMtx.RUnlock()
+
+	for symbol, token := range upgradeable {
+		decimals, err := reader(token.Protocol, "latest")
+		if err != nil {
+			log.Errorf("market util,refresh token:%s decimals error:%s", symbol, err.Error())
+			continue
+		}
+
+		scale := new(big.Int).Exp(big.NewInt(10), big.NewInt(int64(decimals)), nil)
+		if token.Decimals != nil && token.Decimals.Cmp(scale) == 0 {
+			continue
+		}
+
+		tokensMtx.Lock()
+		current, ok := allTokenMap[symbol]
+		if !ok || current.Protocol != token.Protocol {
+			tokensMtx.Unlock()
+			continue
+		}
+		current.Decimals = scale
+		m := cloneTokenMaps()
+		m.update(symbol, current)
+		m.publish()
+		tokensMtx.Unlock()
+
+		log.Infof("market util,token:%s decimals changed to %d", symbol, decimals)
+		eventemitter.Emit(eventemitter.TokenMetadataChanged, &types.TokenMetadataChangedEvent{
+			Token:       token.Protocol,
+			Symbol:      symbol,
+			OldDecimals: token.Decimals,
+			NewDecimals: scale,
+		})
+	}
+}
+
+// TokenStore persist tokens added or deleted at runtime, implemented by dao.RdsService
+type TokenStore interface {
+	GetTokens() ([]types.Token, error)
+	SaveToken(token types.Token) error
+}
+
+var tokenStore TokenStore
+
+// LoadTokens merge tokens persisted in store into tokens loaded from token file, denied token will be removed
+func LoadTokens(store TokenStore) error {
+	tokens, err := store.GetTokens()
+	if err != nil {
+		return err
+	}
+
+	tokensMtx.Lock()
+	defer tokensMtx.Unlock()
+
+	tokenStore = store
+	m := cloneTokenMaps()
+	for _, token := range tokens {
+		m.remove(token.Symbol)
+		if !token.Deny {
+			m.put(token)
+		}
+	}
+	m.publish()
+	rebuildMarkets()
+
+	return nil
+}
+
+// AddToken register token at runtime, symbol and protocol should not be used by other token
+func AddToken(token types.Token) error {
+	return addToken(token, false)
 }
 
+// verify为true时为链上注册事件, 允许将unverified token转为正式token
+func addToken(token types.Token, verify bool) error {
+	token.Symbol = strings.ToUpper(token.Symbol)
+	if token.Symbol == "" {
+		return errors.New("market util,token symbol is empty")
+	}
+	if token.Decimals == nil || token.Decimals.Sign() <= 0 {
+		return fmt.Errorf("market util,token %s decimals invalid", token.Symbol)
+	}
+
+	var evicted []types.Token
+	defer func() { emitEvicted(evicted) }()
+	tokensMtx.Lock()
+	defer tokensMtx.Unlock()
+
+	if exist, ok := allTokenMap[token.Symbol]; ok {
+		// 重复的注册事件
+		if verify && exist.Protocol == token.Protocol && !exist.Unverified {
+			return nil
+		}
+		if !verify || !exist.Unverified || exist.Protocol != token.Protocol {
+			return fmt.Errorf("market util,token symbol %s already exists", token.Symbol)
+		}
+	} else if symbol, ok := addressSymbolMap[token.Protocol]; ok {
+		return fmt.Errorf("market util,token address %s already used by %s", token.Protocol.Hex(), symbol)
+	}
+
+	token.Deny = false
+	if tokenStore != nil {
+		if err := tokenStore.SaveToken(token); err != nil {
+			return err
+		}
+	}
+
+	m := cloneTokenMaps()
+	m.remove(token.Symbol)
+	m.put(token)
+	m.publish()
+	touchToken(token.Symbol)
+	if verify && registerDebounce > 0 {
+		scheduleMarketRebuild()
+	} else {
+		rebuildMarkets()
+	}
+	log.Infof("market util,add token:%s->%s", token.Symbol, token.Protocol.Hex())
+	evicted = evictTokens()
+
+	return nil
+}
+
+// DeleteToken remove token at runtime, market token such as WETH can only be removed by ForceDeleteToken
+func DeleteToken(symbol string) error {
+	return deleteToken(symbol, false)
+}
+
+func ForceDeleteToken(symbol string) error {
+	return deleteToken(symbol, true)
+}
+
+func deleteToken(symbol string, force bool) error {
+	symbol = strings.ToUpper(symbol)
+
+	tokensMtx.Lock()
+	defer tokensMtx.Unlock()
+
+	token, ok := allTokenMap[symbol]
+	if !ok {
+		return fmt.Errorf("market util,token %s not exists", symbol)
+	}
+	if _, ok := supportMarketMap[symbol]; ok && !force {
+		return fmt.Errorf("market util,token %s is a supported market", symbol)
+	}
+
+	token.Deny = true
+	if tokenStore != nil {
+		if err := tokenStore.SaveToken(token); err != nil {
+			return err
+		}
+	}
+
+	m := cloneTokenMaps()
+	m.remove(symbol)
+	m.publish()
+	delete(configTokens, symbol)
+	rebuildMarkets()
+	log.Infof("market util,delete token:%s->%s", symbol, token.Protocol.Hex())
+
+	return nil
+}
+
+// TokenRegister add token registered on chain, token tentatively added as unverified will be verified
 func TokenRegister(input eventemitter.EventData) error {
 	evt := input.(*types.TokenRegisterEvent)
+	if evt.Status != types.TX_STATUS_SUCCESS {
+		return nil
+	}
 
 	var token types.Token
 	token.Protocol = evt.Token
@@ -213,64 +887,228 @@ func TokenRegister(input eventemitter.EventData) error {
 	token.Time = evt.BlockTime
 
 	// todo: how to get source token.Source = ""
-	SupportTokens[token.Symbol] = token
-	AllTokens[token.Symbol] = token
-
-	pairsMap := make(map[string]TokenPair, 0)
-	for _, v := range SupportMarkets {
-		pairsMap[v.Symbol+"-"+token.Symbol] = TokenPair{v.Protocol, token.Protocol}
-		pairsMap[token.Symbol+"-"+v.Symbol] = TokenPair{token.Protocol, v.Protocol}
+	decimals := uint8(defaultDecimals)
+	if registerDecimalsReader != nil {
+		if d, err := registerDecimalsReader(token.Protocol, "latest"); err != nil {
+			log.Errorf("market util,registered token:%s decimals error:%s, use default decimals %d", token.Symbol, err.Error(), defaultDecimals)
+		} else {
+			decimals = d
+		}
 	}
-	for _, v := range pairsMap {
-		AllTokenPairs = append(AllTokenPairs, v)
+	token.Decimals = new(big.Int).Exp(big.NewInt(10), big.NewInt(int64(decimals)), nil)
+
+	if err := addToken(token, true); err != nil {
+		log.Errorf("market util,register token:%s->%s error:%s", token.Symbol, token.Protocol.Hex(), err.Error())
 	}
 	return nil
 }
 
+// AddUnverifiedToken register token which never fired tokenRegistered event tentatively,
+// it can be resolved by address and symbol but is not a supported trading token
+func AddUnverifiedToken(protocol common.Address, symbol string, decimals uint8) (types.Token, error) {
+	var token types.Token
+	token.Protocol = protocol
+	token.Symbol = strings.ToUpper(symbol)
+
+	var evicted []types.Token
+	defer func() { emitEvicted(evicted) }()
+	tokensMtx.Lock()
+	defer tokensMtx.Unlock()
+	if exist, ok := allTokenMap[token.Symbol]; ok && exist.Protocol != protocol {
+		return token, fmt.Errorf("market util,token symbol %s already used by %s", token.Symbol, exist.Protocol.Hex())
+	}
+	token.Decimals = new(big.Int).Exp(big.NewInt(10), big.NewInt(int64(decimals)), nil)
+	token.Unverified = true
+
+	m := cloneTokenMaps()
+	m.allTokens[token.Symbol] = token
+	m.symbolTokenMap[token.Protocol] = token.Symbol
+	m.publish()
+	touchToken(token.Symbol)
+	evicted = evictTokens()
+
+	return token, nil
+}
+
 func TokenUnRegister(input eventemitter.EventData) error {
 	evt := input.(*types.TokenUnRegisterEvent)
+	if evt.Status != types.TX_STATUS_SUCCESS {
+		return nil
+	}
 
-	delete(SupportTokens, strings.ToUpper(evt.Symbol))
-	delete(AllTokens, strings.ToUpper(evt.Symbol))
-
-	var list []TokenPair
-	for _, v := range AllTokenPairs {
-		if v.TokenS == evt.Token || v.TokenB == evt.Token {
-			continue
-		}
-		list = append(list, v)
+	// 未加载过的token(如注册事件尚未处理)直接忽略
+	symbol := strings.ToUpper(evt.Symbol)
+	if token, ok := TokenBySymbol(symbol); !ok || token.Protocol != evt.Token {
+		log.Infof("market util,unregistered token:%s->%s never loaded", symbol, evt.Token.Hex())
+		return nil
 	}
-	AllTokenPairs = list
 
+	if err := ForceDeleteToken(symbol); err != nil {
+		log.Errorf("market util,unregister token:%s error:%s", symbol, err.Error())
+	}
 	return nil
 }
 
 func WethTokenAddress() common.Address {
-	return AllTokens["WETH"].Protocol
+	return AliasToAddress("WETH")
 }
 
+// WrapMarket 返回"token-市场token"格式的市场, 与参数顺序无关.
+// 两个token都是市场token时(如WETH-USDT), 由isMarketSide决定哪个作为市场一方
 func WrapMarket(s, b string) (market string, err error) {
+	tokensMtx.RLock()
+	defer tokensMtx.RUnlock()
+	return wrapMarket(s, b)
+}
 
+// wrapMarket should be called with tokensMtx locked
+func wrapMarket(s, b string) (market string, err error) {
 	s, b = strings.ToUpper(s), strings.ToUpper(b)
 
-	if IsSupportedMarket(s) && isSupportedToken(b) {
-		market = fmt.Sprintf("%s-%s", b, s)
-	} else if IsSupportedMarket(b) && isSupportedToken(s) {
-		market = fmt.Sprintf("%s-%s", s, b)
-	} else if IsSupportedMarket(b) && IsSupportedMarket(s) {
-		if MarketBaseOrder[s] < MarketBaseOrder[b] {
+	_, sIsMarket := supportMarketMap[s]
+	_, bIsMarket := supportMarketMap[b]
+	_, sIsToken := supportTokenMap[s]
+	_, bIsToken := supportTokenMap[b]
+
+	if bIsMarket && sIsMarket {
+		if isMarketSide(b, s) {
 			market = fmt.Sprintf("%s-%s", s, b)
 		} else {
 			market = fmt.Sprintf("%s-%s", b, s)
 		}
+	} else if sIsMarket && bIsToken {
+		market = fmt.Sprintf("%s-%s", b, s)
+	} else if bIsMarket && sIsToken {
+		market = fmt.Sprintf("%s-%s", s, b)
 	} else {
 		err = errors.New(fmt.Sprintf("not supported market type : %s-%s", s, b))
 	}
 	return
 }
 
+// isMarketSide 两个市场token组成交易对时, 判断token是否作为市场(报价)一方:
+// 1.只有一方在MarketBaseOrder中配置时, 配置的一方为市场
+// 2.都有配置时, order较大的一方为市场
+// 3.都未配置或order相同时, 按symbol字典序, 较大的一方为市场
+func isMarketSide(token, other string) bool {
+	o1, ok1 := MarketBaseOrder[token]
+	o2, ok2 := MarketBaseOrder[other]
+
+	switch {
+	case ok1 && !ok2:
+		return true
+	case !ok1 && ok2:
+		return false
+	case o1 != o2:
+		return o1 > o2
+	default:
+		return token > other
+	}
+}
+
+// ErrUnknownToken 地址不是合法地址或不在token列表中, 与token都已知但不构成市场的错误区分
+type ErrUnknownToken struct {
+	Addresses []string
+}
+
+func (e *ErrUnknownToken) Error() string {
+	return fmt.Sprintf("market util,unknown token address:%s", strings.Join(e.Addresses, ","))
+}
+
+// IsUnknownToken err是否由未知的token地址引起
+func IsUnknownToken(err error) bool {
+	_, ok := err.(*ErrUnknownToken)
+	return ok
+}
+
+// WrapMarketByAddress 只获取一次读锁, 未知地址直接返回*ErrUnknownToken, 错误信息中包含原始地址
 func WrapMarketByAddress(s, b string) (market string, err error) {
-	return WrapMarket(AddressToAlias(s), AddressToAlias(b))
+	tokensMtx.RLock()
+	defer tokensMtx.RUnlock()
+
+	var unknown []string
+	symbol := func(addr string) string {
+		if !common.IsHexAddress(addr) {
+			unknown = append(unknown, addr)
+			return ""
+		}
+		sym, ok := addressSymbolMap[common.HexToAddress(addr)]
+		if !ok {
+			unknown = append(unknown, common.HexToAddress(addr).Hex())
+		}
+		return sym
+	}
+	symS, symB := symbol(s), symbol(b)
+	if len(unknown) > 0 {
+		return "", &ErrUnknownToken{Addresses: unknown}
+	}
+
+	if market, err = wrapMarket(symS, symB); err != nil {
+		return "", fmt.Errorf("%s, address:%s-%s", err.Error(), s, b)
+	}
+	return market, nil
+}
+
+// BatchWrapMarket 批量解析交易对市场, 只获取一次读锁, 通过addressSymbolMap反查symbol.
+// 返回结果与pairs一一对应, 不支持的交易对为空字符串
+func BatchWrapMarket(pairs []TokenPair) []string {
+	markets := make([]string, len(pairs))
+
+	tokensMtx.RLock()
+	defer tokensMtx.RUnlock()
+
+	for i, pair := range pairs {
+		market, err := wrapMarket(addressSymbolMap[pair.TokenS], addressSymbolMap[pair.TokenB])
+		if err == nil {
+			markets[i] = market
+		}
+	}
+	return markets
+}
+
+// ValidateMarket 解析出的市场必须在allMarketList中, 或者是支持的token-token交易对
+func ValidateMarket(market string) error {
+	mkt := strings.ToUpper(market)
+
+	tokensMtx.RLock()
+	defer tokensMtx.RUnlock()
+	for _, v := range allMarketList {
+		if strings.ToUpper(v) == mkt {
+			return nil
+		}
+	}
+
+	s, b := UnWrap(mkt)
+	if ts, ok := allTokenMap[s]; ok {
+		if tb, ok := allTokenMap[b]; ok {
+			for _, v := range allTokenPairList {
+				if (v.TokenS == ts.Protocol && v.TokenB == tb.Protocol) || (v.TokenS == tb.Protocol && v.TokenB == ts.Protocol) {
+					return nil
+				}
+			}
+		}
+	}
+
+	return fmt.Errorf("market %s not in all markets", market)
+}
+
+// CheckMarket 校验失败时发出MarketAnomaly, 由调用方决定是否继续传播
+func CheckMarket(market string, tokenS, tokenB common.Address, source string, txhash common.Hash) bool {
+	err := ValidateMarket(market)
+	if err == nil {
+		return true
+	}
+
+	log.Errorf("market util,%s tx:%s resolved invalid market, tokenS:%s tokenB:%s, err:%s", source, txhash.Hex(), tokenS.Hex(), tokenB.Hex(), err.Error())
+	eventemitter.Emit(eventemitter.MarketAnomaly, &types.MarketAnomalyEvent{
+		Market: market,
+		TokenS: tokenS,
+		TokenB: tokenB,
+		Source: source,
+		TxHash: txhash,
+		Reason: err.Error(),
+	})
+	return false
 }
 
 func UnWrap(market string) (s, b string) {
@@ -288,67 +1126,266 @@ func UnWrapToAddress(market string) (s, b common.Address) {
 	return common.StringToAddress(sa), common.StringToAddress(sb)
 }
 
+// market -> 参与价格统计的最小成交量, 以base token计
+var minFillSizes map[string]*big.Rat
+
+func SetMinFillSizes(sizes map[string]string) {
+	fillSizes := make(map[string]*big.Rat)
+	for mkt, v := range sizes {
+		size, ok := new(big.Rat).SetString(v)
+		if !ok || size.Sign() <= 0 {
+			log.Errorf("market %s min fill size %s invalid", mkt, v)
+			continue
+		}
+		fillSizes[strings.ToUpper(mkt)] = size
+	}
+
+	tokensMtx.Lock()
+	minFillSizes = fillSizes
+	tokensMtx.Unlock()
+}
+
+// IsDustFill base token成交量低于市场最小值的成交仍然记录, 但不参与价格统计
+func IsDustFill(market string, baseAmount string) bool {
+	tokensMtx.RLock()
+	size, ok := minFillSizes[strings.ToUpper(market)]
+	tokensMtx.RUnlock()
+	if !ok {
+		return false
+	}
+
+	base, _ := UnWrap(market)
+	token, ok := TokenBySymbol(base)
+	if !ok || token.Decimals == nil || token.Decimals.Sign() <= 0 {
+		return false
+	}
+
+	amount, ok := new(big.Rat).SetString(baseAmount)
+	if !ok {
+		return false
+	}
+	amount.Quo(amount, new(big.Rat).SetInt(token.Decimals))
+
+	return amount.Cmp(size) < 0
+}
+
+const (
+	defaultPriceDecimals  = 8
+	defaultAmountDecimals = 4
+)
+
+// market -> 交易对参数, 未配置的市场由GetMarketConfig按base token生成默认值
+var marketConfigs = make(map[string]types.MarketConfig)
+
+// MarketConfigStore load market configs, implemented by dao.RdsService
+type MarketConfigStore interface {
+	GetMarketConfigs() ([]types.MarketConfig, error)
+}
+
+// LoadMarketConfigs 替换已加载的市场参数, 市场格式或精度非法的配置被忽略
+func LoadMarketConfigs(store MarketConfigStore) error {
+	list, err := store.GetMarketConfigs()
+	if err != nil {
+		return err
+	}
+
+	configs := make(map[string]types.MarketConfig)
+	for _, v := range list {
+		mkt := strings.ToUpper(v.Market)
+		if s, b := UnWrap(mkt); s == "" || b == "" {
+			log.Errorf("market util,market config %s invalid market", v.Market)
+			continue
+		}
+		if v.PriceDecimals < 0 || v.AmountDecimals < 0 || (v.MinAmountS != nil && v.MinAmountS.Sign() < 0) {
+			log.Errorf("market util,market config %s invalid, priceDecimals:%d amountDecimals:%d", v.Market, v.PriceDecimals, v.AmountDecimals)
+			continue
+		}
+		v.Market = mkt
+		if v.MinAmountS == nil {
+			v.MinAmountS = big.NewInt(0)
+		}
+		configs[mkt] = v
+	}
+
+	tokensMtx.Lock()
+	marketConfigs = configs
+	tokensMtx.Unlock()
+
+	return nil
+}
+
+// GetMarketConfig 返回市场参数, 市场不在allMarketList中且未配置时ok为false.
+// 运行时新增token的市场没有配置, 使用默认值: 不限制最小数量, 价格8位, 数量不超过base token精度的4位
+func GetMarketConfig(market string) (types.MarketConfig, bool) {
+	mkt := strings.ToUpper(market)
+
+	tokensMtx.RLock()
+	defer tokensMtx.RUnlock()
+
+	if config, ok := marketConfigs[mkt]; ok {
+		config.MinAmountS = new(big.Int).Set(config.MinAmountS)
+		return config, true
+	}
+
+	s, _ := UnWrap(mkt)
+	found := false
+	for _, v := range tokenMarkets[s] {
+		if v == mkt {
+			found = true
+			break
+		}
+	}
+	if !found {
+		return types.MarketConfig{}, false
+	}
+
+	config := types.MarketConfig{
+		Market:         mkt,
+		MinAmountS:     big.NewInt(0),
+		PriceDecimals:  defaultPriceDecimals,
+		AmountDecimals: defaultAmountDecimals,
+	}
+	if token, ok := allTokenMap[s]; ok && token.Decimals != nil && token.Decimals.Sign() > 0 {
+		if digits := len(token.Decimals.String()) - 1; digits < config.AmountDecimals {
+			config.AmountDecimals = digits
+		}
+	}
+	return config, true
+}
+
 func IsSupportedMarket(market string) bool {
-	_, ok := SupportMarkets[strings.ToUpper(market)]
+	tokensMtx.RLock()
+	defer tokensMtx.RUnlock()
+	_, ok := supportMarketMap[strings.ToUpper(market)]
 	return ok
 }
 
-func isSupportedToken(token string) bool {
-	_, ok := SupportTokens[strings.ToUpper(token)]
+func IsSupportedToken(token string) bool {
+	tokensMtx.RLock()
+	defer tokensMtx.RUnlock()
+	_, ok := supportTokenMap[strings.ToUpper(token)]
 	return ok
 }
 
 func AliasToAddress(t string) common.Address {
-	return AllTokens[t].Protocol
+	token, _ := TokenBySymbol(t)
+	return token.Protocol
 }
 
+// AddressToAlias 在extractor等热点路径中调用, 直接查addressSymbolMap,
+// 统一转换为common.Address比较, 避免checksum大小写不同导致查找失败
 func AddressToAlias(t string) string {
-	for k, v := range AllTokens {
-		if strings.ToUpper(t) == strings.ToUpper(v.Protocol.Hex()) {
-			return k
-		}
+	if !common.IsHexAddress(t) {
+		return ""
 	}
-	return ""
+
+	tokensMtx.RLock()
+	defer tokensMtx.RUnlock()
+	return addressSymbolMap[common.HexToAddress(t)]
 }
 
 func AddressToToken(t common.Address) (*types.Token, error) {
-	for _, v := range AllTokens {
-		if v.Protocol == t {
-			return &v, nil
-		}
+	if token, ok := TokenByAddress(t); ok {
+		return &token, nil
 	}
 
 	return nil, fmt.Errorf("unsupported token:%s", t.Hex())
 }
 
-func CalculatePrice(amountS, amountB string, s, b string) float64 {
+// TransferReceivedAmount the amount receiver actually got, fee-on-transfer token charges value*feeRate
+func TransferReceivedAmount(protocol common.Address, amount *big.Int) *big.Int {
+	if amount == nil {
+		return nil
+	}
+
+	token, err := AddressToToken(protocol)
+	if err != nil || !token.FeeOnTransfer {
+		return amount
+	}
+	if token.TransferFeeRate == nil {
+		log.Errorf("market util,fee-on-transfer token:%s without fee rate, use transfer value", token.Symbol)
+		return amount
+	}
+
+	received := new(big.Rat).Sub(big.NewRat(1, 1), token.TransferFeeRate)
+	received.Mul(received, new(big.Rat).SetInt(amount))
 
-	as, _ := new(big.Int).SetString(amountS, 0)
-	ab, _ := new(big.Int).SetString(amountB, 0)
+	return new(big.Int).Quo(received.Num(), received.Denom())
+}
 
-	result := new(big.Rat).SetInt64(0)
+// CalculatePrice 按market确定买卖方向, 返回每单位base token的quote数量.
+// market两边可以是symbol或token地址, token不在market中、不支持、精度未知或数量为0时返回error, 调用方据此区分真实价格
+func CalculatePrice(amountS, amountB string, tokenS, tokenB common.Address, market string) (float64, error) {
+	as, ok := new(big.Int).SetString(amountS, 0)
+	if !ok || as.Sign() <= 0 {
+		return 0, fmt.Errorf("calculate price, invalid amountS:%s", amountS)
+	}
+	ab, ok := new(big.Int).SetString(amountB, 0)
+	if !ok || ab.Sign() <= 0 {
+		return 0, fmt.Errorf("calculate price, invalid amountB:%s", amountB)
+	}
 
-	tokenS, ok := AllTokens[AddressToAlias(s)]
+	sToken, ok := TokenByAddress(tokenS)
 	if !ok {
-		return 0
+		return 0, fmt.Errorf("calculate price, unsupported tokenS:%s", tokenS.Hex())
 	}
-	tokenB, ok := AllTokens[AddressToAlias(b)]
+	bToken, ok := TokenByAddress(tokenB)
 	if !ok {
-		return 0
+		return 0, fmt.Errorf("calculate price, unsupported tokenB:%s", tokenB.Hex())
 	}
 
-	if as.Cmp(big.NewInt(0)) == 0 || ab.Cmp(big.NewInt(0)) == 0 {
-		return 0
+	// 精度未知时无法计算价格
+	if sToken.Decimals == nil || sToken.Decimals.Sign() <= 0 {
+		return 0, fmt.Errorf("calculate price, token:%s decimals unknown", sToken.Symbol)
+	}
+	if bToken.Decimals == nil || bToken.Decimals.Sign() <= 0 {
+		return 0, fmt.Errorf("calculate price, token:%s decimals unknown", bToken.Symbol)
 	}
 
-	if GetSide(s, b) == SideBuy {
-		result.Quo(new(big.Rat).SetFrac(as, tokenS.Decimals), new(big.Rat).SetFrac(ab, tokenB.Decimals))
-	} else {
-		result.Quo(new(big.Rat).SetFrac(ab, tokenB.Decimals), new(big.Rat).SetFrac(as, tokenS.Decimals))
+	base, quote, err := marketTokenAddresses(market)
+	if err != nil {
+		return 0, err
+	}
+
+	sellAmount := new(big.Rat).SetFrac(as, sToken.Decimals)
+	buyAmount := new(big.Rat).SetFrac(ab, bToken.Decimals)
+	result := new(big.Rat)
+	switch {
+	case tokenS == base && tokenB == quote:
+		// 卖出base
+		result.Quo(buyAmount, sellAmount)
+	case tokenS == quote && tokenB == base:
+		// 买入base
+		result.Quo(sellAmount, buyAmount)
+	default:
+		return 0, fmt.Errorf("calculate price, tokens %s/%s not in market:%s", tokenS.Hex(), tokenB.Hex(), market)
 	}
 
 	price, _ := result.Float64()
-	return price
+	return price, nil
+}
+
+// marketTokenAddresses market两边为地址时直接使用, 否则按symbol查找
+func marketTokenAddresses(market string) (base, quote common.Address, err error) {
+	mkt := strings.Split(strings.TrimSpace(market), "-")
+	if len(mkt) != 2 {
+		return base, quote, fmt.Errorf("calculate price, invalid market:%s", market)
+	}
+
+	addresses := make([]common.Address, 2)
+	for i, v := range mkt {
+		if IsAddress(v) {
+			addresses[i] = common.HexToAddress(v)
+			continue
+		}
+		token, ok := TokenBySymbol(v)
+		if !ok {
+			return base, quote, fmt.Errorf("calculate price, unsupported token:%s in market:%s", v, market)
+		}
+		addresses[i] = token.Protocol
+	}
+
+	return addresses[0], addresses[1], nil
 }
 
 //
@@ -358,7 +1395,7 @@ func CalculatePrice(amountS, amountB string, s, b string) float64 {
 //	}
 //
 //
-//	if _, ok := SupportTokens[tokenB]; !ok {
+//	if _, ok := supportTokenMap[tokenB]; !ok {
 //		return false
 //	}
 //	return true
@@ -374,16 +1411,16 @@ func GetSide(s, b string) string {
 		b = AddressToAlias(b)
 	}
 
-	if IsSupportedMarket(s) && isSupportedToken(b) {
-		return SideBuy
-	} else if IsSupportedMarket(b) && isSupportedToken(s) {
-		return SideSell
-	} else if IsSupportedMarket(b) && IsSupportedMarket(s) {
-		if MarketBaseOrder[s] < MarketBaseOrder[b] {
+	if IsSupportedMarket(b) && IsSupportedMarket(s) {
+		if isMarketSide(b, s) {
 			return SideSell
 		} else {
 			return SideBuy
 		}
+	} else if IsSupportedMarket(s) && IsSupportedToken(b) {
+		return SideBuy
+	} else if IsSupportedMarket(b) && IsSupportedToken(s) {
+		return SideSell
 	}
 	return ""
 }
@@ -393,7 +1430,9 @@ func IsAddress(token string) bool {
 }
 
 func GetSymbolWithAddress(address common.Address) (string, error) {
-	if symbol, ok := SymbolTokenMap[address]; ok {
+	tokensMtx.RLock()
+	defer tokensMtx.RUnlock()
+	if symbol, ok := addressSymbolMap[address]; ok {
 		return symbol, nil
 	}
 	return "", fmt.Errorf("market util, unsupported address:%s", address.Hex())
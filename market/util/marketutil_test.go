@@ -20,30 +20,840 @@ package util_test
 
 import (
 	"fmt"
+	"github.com/Loopring/relay/config"
+	"github.com/Loopring/relay/eventemiter"
 	log2 "github.com/Loopring/relay/log"
 	"github.com/Loopring/relay/market/util"
 	"github.com/Loopring/relay/types"
 	"github.com/ethereum/go-ethereum/common"
-	"github.com/go-ethereum/log"
+	"go.uber.org/zap"
+	"io/ioutil"
+	"math"
 	"math/big"
+	"os"
+	"strings"
+	"sync"
 	"testing"
+	"time"
 )
 
+func init() {
+	zapOpts := zap.NewDevelopmentConfig()
+	zapOpts.Level = zap.NewAtomicLevelAt(zap.ErrorLevel)
+	log2.Initialize(config.LogOptions{ZapOpts: zapOpts})
+}
+
 func TestCalculatePrice(t *testing.T) {
-	util.SupportTokens = make(map[string]types.Token)
-	util.AllTokens = make(map[string]types.Token)
-	funToken := types.Token{Protocol: common.HexToAddress("0x419D0d8BdD9aF5e606Ae2232ed285Aff190E711b"), Decimals: big.NewInt(1e8)}
-	wethToken := types.Token{Protocol: common.HexToAddress("0x2956356cD2a2bf3202F771F50D3D14A367b48070"), Decimals: big.NewInt(1e18)}
-	util.SupportTokens["FUN"] = funToken
-	util.AllTokens["FUN"] = funToken
-	util.AllTokens["WETH"] = wethToken
-	price := util.CalculatePrice("10000000000", "7000000000000000", "0x419D0d8BdD9aF5e606Ae2232ed285Aff190E711b", "0x2956356cD2a2bf3202F771F50D3D14A367b48070")
-	fmt.Println(price)
-	fmt.Println(price == 0.00007)
-	if price != 0.00007 {
-		log.Error("not right")
-	} else {
-		log.Error("xxxxx")
-	}
-	log2.Fatal("ksfjlsdjfklj")
+	funToken := types.Token{Protocol: common.HexToAddress("0x419D0d8BdD9aF5e606Ae2232ed285Aff190E711b"), Symbol: "FUN", Decimals: big.NewInt(1e8)}
+	wethToken := types.Token{Protocol: common.HexToAddress("0x2956356cD2a2bf3202F771F50D3D14A367b48070"), Symbol: "WETH", Decimals: big.NewInt(1e18)}
+	usdcToken := types.Token{Protocol: common.HexToAddress("0xA0b86991c6218b36c1d19D4a2e9Eb0cE3606eB48"), Symbol: "USDC", Decimals: big.NewInt(1e6)}
+	util.SetTokens(map[string]types.Token{"FUN": funToken}, map[string]types.Token{"WETH": wethToken, "USDC": usdcToken})
+
+	// 100 FUN(8 decimals) -> 0.007 WETH(18 decimals)
+	price, err := util.CalculatePrice("10000000000", "7000000000000000", funToken.Protocol, wethToken.Protocol, "FUN-WETH")
+	if err != nil || math.Abs(price-0.00007) > 1e-12 {
+		t.Errorf("expect price 0.00007, got %v %v", price, err)
+	}
+
+	// 2 WETH -> 1500 USDC(6 decimals)
+	price, err = util.CalculatePrice("2000000000000000000", "1500000000", wethToken.Protocol, usdcToken.Protocol, "WETH-USDC")
+	if err != nil || math.Abs(price-750) > 1e-9 {
+		t.Errorf("expect price 750, got %v %v", price, err)
+	}
+
+	if price, err := util.CalculatePrice("0", "1500000000", wethToken.Protocol, usdcToken.Protocol, "WETH-USDC"); err == nil || price != 0 {
+		t.Errorf("zero amount should return error, got %v", price)
+	}
+
+	// token without decimals
+	util.SetTokens(map[string]types.Token{"FUN": funToken}, map[string]types.Token{"WETH": wethToken, "USDC": {Protocol: usdcToken.Protocol, Symbol: "USDC"}})
+	if price, err := util.CalculatePrice("2000000000000000000", "1500000000", wethToken.Protocol, usdcToken.Protocol, "WETH-USDC"); err == nil || price != 0 {
+		t.Errorf("price without decimals should return error, got %v", price)
+	}
+}
+
+func TestCalculatePrice_UnsupportedToken(t *testing.T) {
+	wethToken := types.Token{Protocol: common.HexToAddress("0x2956356cD2a2bf3202F771F50D3D14A367b48070"), Symbol: "WETH", Decimals: big.NewInt(1e18)}
+	util.SetTokens(map[string]types.Token{}, map[string]types.Token{"WETH": wethToken})
+
+	unknown := common.HexToAddress("0x8b0f7dad5a9a64c895fe54612b6949286d55f37c")
+	if _, err := util.CalculatePrice("100", "100", unknown, wethToken.Protocol, "FUN-WETH"); err == nil {
+		t.Errorf("unsupported tokenS should return error")
+	}
+	if _, err := util.CalculatePrice("100", "100", wethToken.Protocol, unknown, "FUN-WETH"); err == nil {
+		t.Errorf("unsupported tokenB should return error")
+	}
+}
+
+func TestCalculatePrice_AddressMarket(t *testing.T) {
+	wethToken := types.Token{Protocol: common.HexToAddress("0x2956356cD2a2bf3202F771F50D3D14A367b48070"), Symbol: "WETH", Decimals: big.NewInt(1e18), IsMarket: true}
+	usdcToken := types.Token{Protocol: common.HexToAddress("0xA0b86991c6218b36c1d19D4a2e9Eb0cE3606eB48"), Symbol: "USDC", Decimals: big.NewInt(1e6), IsMarket: true}
+	funToken := types.Token{Protocol: common.HexToAddress("0x419D0d8BdD9aF5e606Ae2232ed285Aff190E711b"), Symbol: "FUN", Decimals: big.NewInt(1e8)}
+	util.SetTokens(map[string]types.Token{"FUN": funToken}, map[string]types.Token{"WETH": wethToken, "USDC": usdcToken})
+
+	// base为市场token, 两边均以地址给出
+	market := wethToken.Protocol.Hex() + "-" + usdcToken.Protocol.Hex()
+
+	// 卖出2 WETH得到1500 USDC
+	price, err := util.CalculatePrice("2000000000000000000", "1500000000", wethToken.Protocol, usdcToken.Protocol, market)
+	if err != nil || math.Abs(price-750) > 1e-9 {
+		t.Errorf("sell side expect price 750, got %v %v", price, err)
+	}
+
+	// 花费3000 USDC买入2 WETH
+	price, err = util.CalculatePrice("3000000000", "2000000000000000000", usdcToken.Protocol, wethToken.Protocol, market)
+	if err != nil || math.Abs(price-1500) > 1e-9 {
+		t.Errorf("buy side expect price 1500, got %v %v", price, err)
+	}
+
+	if _, err := util.CalculatePrice("100", "100", funToken.Protocol, wethToken.Protocol, market); err == nil {
+		t.Errorf("token not in market should return error")
+	}
+}
+
+func TestByteToFloatWithDecimals(t *testing.T) {
+	cases := []struct {
+		amount   string
+		decimals int
+		expected float64
+	}{
+		{"1500000", 6, 1.5},
+		{"12345678", 8, 0.12345678},
+		{"2500000000000000000", 18, 2.5},
+		{"0", 18, 0},
+	}
+
+	for _, c := range cases {
+		amount, _ := new(big.Int).SetString(c.amount, 0)
+		if got := util.ByteToFloatWithDecimals(amount.Bytes(), c.decimals); math.Abs(got-c.expected) > 1e-12 {
+			t.Errorf("amount %s with %d decimals, expect %v got %v", c.amount, c.decimals, c.expected, got)
+		}
+		bs, ok := util.FloatToByteWithDecimals(c.expected, c.decimals)
+		if got := new(big.Int).SetBytes(bs); !ok || got.Cmp(amount) != 0 {
+			t.Errorf("float %v with %d decimals, expect %s got %s", c.expected, c.decimals, c.amount, got.String())
+		}
+	}
+
+	// 0.29*1e6在浮点下略小于290000, 需要四舍五入
+	bs, ok := util.FloatToByteWithDecimals(0.29, 6)
+	if got := new(big.Int).SetBytes(bs); !ok || got.Int64() != 290000 {
+		t.Errorf("expect 290000, got %s", got.String())
+	}
+}
+
+func TestByteToFloatWithDecimals_LargeAmount(t *testing.T) {
+	// 1e27 wei, 远超int64范围
+	amount, _ := new(big.Int).SetString("1000000000000000000000000000", 0)
+
+	got := util.ByteToFloatWithDecimals(amount.Bytes(), 18)
+	if math.Abs(got-1e9)/1e9 > 1e-15 {
+		t.Fatalf("expect 1e9, got %v", got)
+	}
+
+	bs, ok := util.FloatToByteWithDecimals(got, 18)
+	if !ok {
+		t.Fatalf("%v should be converted", got)
+	}
+	back := new(big.Float).SetInt(new(big.Int).SetBytes(bs))
+	diff, _ := new(big.Float).Quo(new(big.Float).Sub(back, new(big.Float).SetInt(amount)), new(big.Float).SetInt(amount)).Float64()
+	if math.Abs(diff) > 1e-15 {
+		t.Errorf("round trip relative error %v too large, got %s", diff, back.String())
+	}
+}
+
+func TestFloatToByteRound(t *testing.T) {
+	cases := []struct {
+		amount   float64
+		decimals int
+		mode     big.RoundingMode
+		expected string
+	}{
+		// 0.1在float64中略大于0.1, 向上舍入也不应多出1wei
+		{0.1, 18, big.ToZero, "100000000000000000"},
+		{0.1, 18, big.AwayFromZero, "100000000000000000"},
+		// 远超int64范围
+		{1e9, 18, big.ToZero, "1000000000000000000000000000"},
+		// 超出float64有效位数(约16位)的部分为二进制舍入结果
+		{123456789.123456789, 18, big.ToNearestEven, "123456789123456791337762816"},
+		{1.2345675, 6, big.ToZero, "1234567"},
+		{1.2345675, 6, big.AwayFromZero, "1234568"},
+		{1.2345665, 6, big.ToNearestEven, "1234566"},
+		{1.2345665, 6, big.ToNearestAway, "1234567"},
+		{0, 18, big.AwayFromZero, "0"},
+	}
+
+	for _, c := range cases {
+		bs, ok := util.FloatToByteRound(c.amount, c.decimals, c.mode)
+		if got := new(big.Int).SetBytes(bs); !ok || got.String() != c.expected {
+			t.Errorf("float %v with %d decimals mode %s, expect %s got %s", c.amount, c.decimals, c.mode.String(), c.expected, got.String())
+		}
+	}
+
+	// 负数、NaN及Inf不能转换为链上金额
+	for _, amount := range []float64{-0.5, -1e-18, math.NaN(), math.Inf(1), math.Inf(-1)} {
+		if bs, ok := util.FloatToByteRound(amount, 18, big.ToNearestAway); ok {
+			t.Errorf("float %v should be rejected, got %s", amount, new(big.Int).SetBytes(bs).String())
+		}
+		if _, ok := util.FloatToByteWithDecimals(amount, 18); ok {
+			t.Errorf("float %v should be rejected", amount)
+		}
+	}
+}
+
+func TestBackfillDecimals(t *testing.T) {
+	lrc := types.Token{Protocol: common.HexToAddress("0xEF68e7C694F40c8202821eDF525dE3782458639f"), Symbol: "LRC", Decimals: big.NewInt(1e18)}
+	fun := types.Token{Protocol: common.HexToAddress("0x419D0d8BdD9aF5e606Ae2232ed285Aff190E711b"), Symbol: "FUN"}
+	util.SetTokens(map[string]types.Token{"FUN": fun}, map[string]types.Token{"LRC": lrc})
+
+	var queried []common.Address
+	util.BackfillDecimals(func(tokenAddress common.Address, blockParameter string) (uint8, error) {
+		queried = append(queried, tokenAddress)
+		return 8, nil
+	})
+
+	if len(queried) != 1 || queried[0] != fun.Protocol {
+		t.Fatalf("only token without decimals should be queried, got %v", queried)
+	}
+	if util.AllTokens()["FUN"].Decimals.Cmp(big.NewInt(1e8)) != 0 {
+		t.Errorf("expect FUN decimals 1e8, got %v", util.AllTokens()["FUN"].Decimals)
+	}
+	if util.SupportTokens()["FUN"].Decimals.Cmp(big.NewInt(1e8)) != 0 {
+		t.Errorf("support token FUN should be updated too")
+	}
+	if util.AllTokens()["LRC"].Decimals.Cmp(big.NewInt(1e18)) != 0 {
+		t.Errorf("LRC decimals should not be changed")
+	}
+}
+
+func TestTokens_ConcurrentAccess(t *testing.T) {
+	tokens := `[
+		{"Protocol":"0xEF68e7C694F40c8202821eDF525dE3782458639f","Symbol":"LRC","Decimals":18},
+		{"Protocol":"0x2956356cD2a2bf3202F771F50D3D14A367b48070","Symbol":"WETH","Decimals":18,"IsMarket":true}
+	]`
+	file, err := ioutil.TempFile("", "tokens")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(file.Name())
+	file.WriteString(tokens)
+	file.Close()
+
+	options := config.MarketOptions{TokenFile: file.Name()}
+	util.Initialize(options)
+
+	lrc := common.HexToAddress("0xEF68e7C694F40c8202821eDF525dE3782458639f")
+	weth := common.HexToAddress("0x2956356cD2a2bf3202F771F50D3D14A367b48070")
+	unverified := common.HexToAddress("0x419D0d8BdD9aF5e606Ae2232ed285Aff190E711b")
+
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 50; j++ {
+				util.Initialize(options)
+				util.AddUnverifiedToken(unverified, "FUN", 8)
+			}
+		}()
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 50; j++ {
+				util.AddressToAlias(lrc.Hex())
+				util.AddressToToken(weth)
+				util.IsSupportedMarket("WETH")
+				util.ValidateMarket("LRC-WETH")
+				util.GetSide(lrc.Hex(), weth.Hex())
+				util.CalculatePrice("100", "1", lrc, weth, "LRC-WETH")
+				util.GetSymbolWithAddress(lrc)
+			}
+		}()
+		// gateway等包外代码通过访问函数读取token map
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 50; j++ {
+				supportTokens := util.SupportTokens()
+				for symbol := range util.AllTokens() {
+					_ = supportTokens[symbol]
+				}
+				_ = util.SymbolTokenMap()[unverified]
+				_ = len(util.AllMarkets())
+			}
+		}()
+	}
+	wg.Wait()
+
+	// 修改token时整体替换map, 已读取的map不受影响
+	before := util.AllTokens()
+	if _, err := util.AddUnverifiedToken(common.HexToAddress("0x0D8775F648430679A709E98d2b0Cb6250d2887EF"), "BAT", 18); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := before["BAT"]; ok {
+		t.Errorf("token map read before update should not be modified in place")
+	}
+	if _, ok := util.AllTokens()["BAT"]; !ok {
+		t.Errorf("BAT should be added")
+	}
+
+	if alias := util.AddressToAlias(lrc.Hex()); alias != "LRC" {
+		t.Errorf("expect LRC, got %s", alias)
+	}
+	if err := util.ValidateMarket("LRC-WETH"); err != nil {
+		t.Errorf("LRC-WETH should be valid, got %s", err.Error())
+	}
+}
+
+func TestRefreshUpgradeableDecimals(t *testing.T) {
+	lrc := types.Token{Protocol: common.HexToAddress("0xEF68e7C694F40c8202821eDF525dE3782458639f"), Symbol: "LRC", Decimals: big.NewInt(1e18)}
+	usdx := types.Token{Protocol: common.HexToAddress("0xA0b86991c6218b36c1d19D4a2e9Eb0cE3606eB48"), Symbol: "USDX", Decimals: big.NewInt(1e6), Upgradeable: true}
+	util.SetTokens(map[string]types.Token{"LRC": lrc, "USDX": usdx}, map[string]types.Token{})
+
+	var changed []*types.TokenMetadataChangedEvent
+	watcher := &eventemitter.Watcher{Concurrent: false, Handle: func(input eventemitter.EventData) error {
+		changed = append(changed, input.(*types.TokenMetadataChangedEvent))
+		return nil
+	}}
+	eventemitter.On(eventemitter.TokenMetadataChanged, watcher)
+	defer eventemitter.Un(eventemitter.TokenMetadataChanged, watcher)
+
+	var queried []common.Address
+	decimals := uint8(6)
+	reader := func(tokenAddress common.Address, blockParameter string) (uint8, error) {
+		queried = append(queried, tokenAddress)
+		return decimals, nil
+	}
+
+	util.RefreshUpgradeableDecimals(reader)
+	if len(queried) != 1 || queried[0] != usdx.Protocol {
+		t.Fatalf("only upgradeable token should be queried, got %v", queried)
+	}
+	if len(changed) != 0 {
+		t.Fatalf("decimals unchanged, expect no event, got %d", len(changed))
+	}
+
+	// 合约升级后decimals变为18
+	decimals = 18
+	util.RefreshUpgradeableDecimals(reader)
+	if len(changed) != 1 {
+		t.Fatalf("expect 1 token metadata changed event, got %d", len(changed))
+	}
+	if evt := changed[0]; evt.Token != usdx.Protocol || evt.OldDecimals.Cmp(big.NewInt(1e6)) != 0 || evt.NewDecimals.Cmp(big.NewInt(1e18)) != 0 {
+		t.Errorf("unexpected event token:%s old:%s new:%s", evt.Token.Hex(), evt.OldDecimals, evt.NewDecimals)
+	}
+
+	token, err := util.AddressToToken(usdx.Protocol)
+	if err != nil || token.Decimals.Cmp(big.NewInt(1e18)) != 0 {
+		t.Errorf("token decimals should be updated to 1e18, got %v", token)
+	}
+	if util.SupportTokens()["USDX"].Decimals.Cmp(big.NewInt(1e18)) != 0 {
+		t.Errorf("support token decimals should be updated, got %s", util.SupportTokens()["USDX"].Decimals)
+	}
+}
+
+type memoryTokenStore struct {
+	tokens map[string]types.Token
+}
+
+func (s *memoryTokenStore) GetTokens() ([]types.Token, error) {
+	var list []types.Token
+	for _, v := range s.tokens {
+		list = append(list, v)
+	}
+	return list, nil
+}
+
+func (s *memoryTokenStore) SaveToken(token types.Token) error {
+	s.tokens[token.Symbol] = token
+	return nil
+}
+
+func TestAddAndDeleteToken(t *testing.T) {
+	lrc := types.Token{Protocol: common.HexToAddress("0xEF68e7C694F40c8202821eDF525dE3782458639f"), Symbol: "LRC", Decimals: big.NewInt(1e18)}
+	weth := types.Token{Protocol: common.HexToAddress("0x2956356cD2a2bf3202F771F50D3D14A367b48070"), Symbol: "WETH", Decimals: big.NewInt(1e18), IsMarket: true}
+	util.SetTokens(map[string]types.Token{"LRC": lrc}, map[string]types.Token{"WETH": weth})
+
+	store := &memoryTokenStore{tokens: make(map[string]types.Token)}
+	if err := util.LoadTokens(store); err != nil {
+		t.Fatal(err)
+	}
+
+	rdn := types.Token{Protocol: common.HexToAddress("0x255Aa6DF07540Cb5d3d297f0D0D4D84cb52bc8e6"), Symbol: "rdn", Decimals: big.NewInt(1e18)}
+	if err := util.AddToken(rdn); err != nil {
+		t.Fatal(err)
+	}
+
+	if !util.IsSupportedToken("RDN") {
+		t.Errorf("RDN should be supported token")
+	}
+	if err := util.ValidateMarket("RDN-WETH"); err != nil {
+		t.Errorf("RDN-WETH should be valid market, got %s", err.Error())
+	}
+	if side := util.GetSide(rdn.Protocol.Hex(), weth.Protocol.Hex()); side != util.SideSell {
+		t.Errorf("sell RDN for WETH should be sell side, got %s", side)
+	}
+	if saved, ok := store.tokens["RDN"]; !ok || saved.Deny {
+		t.Errorf("RDN should be persisted")
+	}
+
+	// symbol冲突
+	if err := util.AddToken(types.Token{Protocol: common.HexToAddress("0x01"), Symbol: "LRC", Decimals: big.NewInt(1e18)}); err == nil {
+		t.Errorf("add token with existing symbol should fail")
+	}
+
+	// 市场token需强制删除
+	if err := util.DeleteToken("WETH"); err == nil {
+		t.Errorf("delete market token without force should fail")
+	}
+	if err := util.DeleteToken("RDN"); err != nil {
+		t.Fatal(err)
+	}
+	if util.IsSupportedToken("RDN") || util.ValidateMarket("RDN-WETH") == nil {
+		t.Errorf("RDN and RDN-WETH should be removed")
+	}
+	if !store.tokens["RDN"].Deny {
+		t.Errorf("deleted token should be persisted as denied")
+	}
+	if err := util.ForceDeleteToken("WETH"); err != nil {
+		t.Fatal(err)
+	}
+	if util.IsSupportedMarket("WETH") || util.ValidateMarket("LRC-WETH") == nil {
+		t.Errorf("WETH markets should be removed after force delete")
+	}
+}
+
+func TestTokenRegister(t *testing.T) {
+	lrc := types.Token{Protocol: common.HexToAddress("0xEF68e7C694F40c8202821eDF525dE3782458639f"), Symbol: "LRC", Decimals: big.NewInt(1e18)}
+	weth := types.Token{Protocol: common.HexToAddress("0x2956356cD2a2bf3202F771F50D3D14A367b48070"), Symbol: "WETH", Decimals: big.NewInt(1e18), IsMarket: true}
+	util.SetTokens(map[string]types.Token{"LRC": lrc}, map[string]types.Token{"WETH": weth})
+	if err := util.LoadTokens(&memoryTokenStore{tokens: make(map[string]types.Token)}); err != nil {
+		t.Fatal(err)
+	}
+	util.SetDecimalsReader(func(tokenAddress common.Address, blockParameter string) (uint8, error) {
+		return 8, nil
+	})
+	defer util.SetDecimalsReader(nil)
+
+	registered := &types.TokenRegisterEvent{Token: common.HexToAddress("0x419D0d8BdD9aF5e606Ae2232ed285Aff190E711b"), Symbol: "fun"}
+	registered.Status = types.TX_STATUS_SUCCESS
+	util.TokenRegister(registered)
+
+	if !util.IsSupportedToken("FUN") || util.ValidateMarket("FUN-WETH") != nil {
+		t.Fatalf("registered token should be tradable immediately")
+	}
+	if token, err := util.AddressToToken(registered.Token); err != nil || token.Decimals.Cmp(big.NewInt(1e8)) != 0 {
+		t.Errorf("registered token decimals should be 1e8, got %v", token)
+	}
+
+	// 未加载过的token注销, 以及地址不匹配的注销, 都应忽略
+	unknown := &types.TokenUnRegisterEvent{Token: common.HexToAddress("0x01"), Symbol: "ABC"}
+	unknown.Status = types.TX_STATUS_SUCCESS
+	if err := util.TokenUnRegister(unknown); err != nil {
+		t.Fatal(err)
+	}
+	mismatch := &types.TokenUnRegisterEvent{Token: common.HexToAddress("0x02"), Symbol: "LRC"}
+	mismatch.Status = types.TX_STATUS_SUCCESS
+	util.TokenUnRegister(mismatch)
+	if !util.IsSupportedToken("LRC") {
+		t.Fatalf("LRC should not be removed by mismatched unregister")
+	}
+
+	unregistered := &types.TokenUnRegisterEvent{Token: registered.Token, Symbol: "FUN"}
+	unregistered.Status = types.TX_STATUS_SUCCESS
+	util.TokenUnRegister(unregistered)
+	if util.IsSupportedToken("FUN") || util.ValidateMarket("FUN-WETH") == nil {
+		t.Errorf("unregistered token should be removed")
+	}
+
+	// 先以unverified加入的token, 注册后转为正式token
+	rdn := common.HexToAddress("0x255Aa6DF07540Cb5d3d297f0D0D4D84cb52bc8e6")
+	if _, err := util.AddUnverifiedToken(rdn, "RDN", 18); err != nil {
+		t.Fatal(err)
+	}
+	registered = &types.TokenRegisterEvent{Token: rdn, Symbol: "RDN"}
+	registered.Status = types.TX_STATUS_SUCCESS
+	util.TokenRegister(registered)
+	if token, err := util.AddressToToken(rdn); err != nil || token.Unverified || !util.IsSupportedToken("RDN") {
+		t.Errorf("unverified token should be verified after registered, got %v", token)
+	}
+}
+
+func TestTokenRegister_Debounce(t *testing.T) {
+	weth := types.Token{Protocol: common.HexToAddress("0x2956356cD2a2bf3202F771F50D3D14A367b48070"), Symbol: "WETH", Decimals: big.NewInt(1e18), IsMarket: true}
+	util.SetTokens(map[string]types.Token{}, map[string]types.Token{"WETH": weth})
+	if err := util.LoadTokens(&memoryTokenStore{tokens: make(map[string]types.Token)}); err != nil {
+		t.Fatal(err)
+	}
+	util.SetRegisterDebounce(100)
+	defer util.SetRegisterDebounce(0)
+
+	// 连续注册10个token, 静默前不重建
+	before := util.MarketRebuilds()
+	for i := 1; i <= 10; i++ {
+		registered := &types.TokenRegisterEvent{Token: common.BigToAddress(big.NewInt(int64(i))), Symbol: fmt.Sprintf("TK%d", i)}
+		registered.Status = types.TX_STATUS_SUCCESS
+		util.TokenRegister(registered)
+	}
+	if util.MarketRebuilds() != before || util.ValidateMarket("TK1-WETH") == nil {
+		t.Fatalf("markets should not be rebuilt during registration burst")
+	}
+
+	deadline := time.Now().Add(2 * time.Second)
+	for util.MarketRebuilds() == before && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	time.Sleep(200 * time.Millisecond)
+
+	if rebuilds := util.MarketRebuilds() - before; rebuilds != 1 {
+		t.Fatalf("expect a single market rebuild, got %d", rebuilds)
+	}
+	for i := 1; i <= 10; i++ {
+		if err := util.ValidateMarket(fmt.Sprintf("TK%d-WETH", i)); err != nil {
+			t.Errorf("market TK%d-WETH should be available after rebuild: %s", i, err.Error())
+		}
+	}
+}
+
+func TestMaxTokensEviction(t *testing.T) {
+	// LRC来自配置, 虽然从未活跃也不淘汰
+	weth := types.Token{Protocol: common.HexToAddress("0x2956356cD2a2bf3202F771F50D3D14A367b48070"), Symbol: "WETH", Decimals: big.NewInt(1e18), IsMarket: true}
+	lrc := types.Token{Protocol: common.HexToAddress("0xEF68e7C694F40c8202821eDF525dE3782458639f"), Symbol: "LRC", Decimals: big.NewInt(1e18)}
+	util.SetTokens(map[string]types.Token{"LRC": lrc}, map[string]types.Token{"WETH": weth})
+	if err := util.LoadTokens(&memoryTokenStore{tokens: make(map[string]types.Token)}); err != nil {
+		t.Fatal(err)
+	}
+	util.SetMaxTokens(5)
+	defer util.SetMaxTokens(0)
+
+	// watcher中读取token, 若TokenEvicted在持有tokensMtx时发出则会死锁
+	var evicted []*types.TokenEvictedEvent
+	watcher := &eventemitter.Watcher{Concurrent: false, Handle: func(input eventemitter.EventData) error {
+		evt := input.(*types.TokenEvictedEvent)
+		if _, ok := util.TokenByAddress(evt.Token); ok {
+			t.Errorf("token %s still exists while TokenEvicted emitted", evt.Symbol)
+		}
+		evicted = append(evicted, evt)
+		return nil
+	}}
+	eventemitter.On(eventemitter.TokenEvicted, watcher)
+	defer eventemitter.Un(eventemitter.TokenEvicted, watcher)
+
+	// 运行时加入的REP同样进入支持token, 但不固定, 之后最久没有活跃
+	rep := types.Token{Protocol: common.HexToAddress("0xE94327D07Fc17907b4DB788E5aDf2ed424adDff6"), Symbol: "REP", Decimals: big.NewInt(1e18)}
+	if err := util.AddToken(rep); err != nil {
+		t.Fatal(err)
+	}
+	if !util.IsSupportedToken("REP") {
+		t.Fatalf("REP should be supported after AddToken")
+	}
+	rdn := common.HexToAddress("0x255Aa6DF07540Cb5d3d297f0D0D4D84cb52bc8e6")
+	fun := common.HexToAddress("0x419D0d8BdD9aF5e606Ae2232ed285Aff190E711b")
+	omg := common.HexToAddress("0xd26114cd6EE289AccF82350c8d8487fedB8A0C07")
+	for address, symbol := range map[common.Address]string{rdn: "RDN", fun: "FUN"} {
+		if _, err := util.AddUnverifiedToken(address, symbol, 18); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if len(evicted) != 0 {
+		t.Fatalf("no token should be evicted within max tokens, got %d", len(evicted))
+	}
+
+	util.TouchToken(rdn)
+	util.TouchToken(fun)
+
+	if _, err := util.AddUnverifiedToken(omg, "OMG", 18); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, ok := util.TokenBySymbol("REP"); ok {
+		t.Errorf("least active token REP added at runtime should be evicted")
+	}
+	if util.IsSupportedToken("REP") {
+		t.Errorf("evicted token REP should not be supported")
+	}
+	if len(evicted) != 1 || evicted[0].Symbol != "REP" || evicted[0].Token != rep.Protocol {
+		t.Errorf("expect TokenEvicted for REP, got %d events", len(evicted))
+	}
+	for _, symbol := range []string{"RDN", "FUN", "OMG"} {
+		if _, ok := util.TokenBySymbol(symbol); !ok {
+			t.Errorf("active token %s should be kept", symbol)
+		}
+	}
+	if !util.IsSupportedToken("LRC") {
+		t.Errorf("config token LRC should be pinned")
+	}
+	if !util.IsSupportedMarket("WETH") {
+		t.Errorf("market token WETH should be pinned")
+	}
+	if len(util.AllTokens()) != 5 {
+		t.Errorf("expect 5 tokens, got %d", len(util.AllTokens()))
+	}
+}
+
+func TestTokenBySymbolAndAddress(t *testing.T) {
+	lrc := types.Token{Protocol: common.HexToAddress("0xEF68e7C694F40c8202821eDF525dE3782458639f"), Symbol: "LRC", Decimals: big.NewInt(1e18)}
+	util.SetTokens(map[string]types.Token{"LRC": lrc}, map[string]types.Token{})
+
+	if token, ok := util.TokenBySymbol("lrc"); !ok || token.Protocol != lrc.Protocol || token.Decimals.Cmp(big.NewInt(1e18)) != 0 {
+		t.Errorf("LRC should be found by symbol, got %v %t", token, ok)
+	}
+	if _, ok := util.TokenBySymbol("RDN"); ok {
+		t.Errorf("RDN should not be found")
+	}
+	if token, ok := util.TokenByAddress(lrc.Protocol); !ok || token.Symbol != "LRC" {
+		t.Errorf("LRC should be found by address, got %v %t", token, ok)
+	}
+	if _, ok := util.TokenByAddress(common.HexToAddress("0x01")); ok {
+		t.Errorf("unknown address should not be found")
+	}
+
+	if alias := util.AddressToAlias("0xef68e7c694f40c8202821edf525de3782458639f"); alias != "LRC" {
+		t.Errorf("expect LRC, got %s", alias)
+	}
+	if alias := util.AddressToAlias("LRC"); alias != "" {
+		t.Errorf("symbol is not an address, got %s", alias)
+	}
+	if addr := util.AliasToAddress("LRC"); addr != lrc.Protocol {
+		t.Errorf("expect %s, got %s", lrc.Protocol.Hex(), addr.Hex())
+	}
+}
+
+func TestAddressToAlias_IndexUpdated(t *testing.T) {
+	weth := types.Token{Protocol: common.HexToAddress("0x2956356cD2a2bf3202F771F50D3D14A367b48070"), Symbol: "WETH", Decimals: big.NewInt(1e18), IsMarket: true}
+	util.SetTokens(map[string]types.Token{}, map[string]types.Token{"WETH": weth})
+
+	store := &memoryTokenStore{tokens: make(map[string]types.Token)}
+	if err := util.LoadTokens(store); err != nil {
+		t.Fatal(err)
+	}
+
+	rdn := types.Token{Protocol: common.HexToAddress("0x255Aa6DF07540Cb5d3d297f0D0D4D84cb52bc8e6"), Symbol: "RDN", Decimals: big.NewInt(1e18)}
+	if err := util.AddToken(rdn); err != nil {
+		t.Fatal(err)
+	}
+
+	// checksum与全小写/全大写地址都应命中
+	for _, addr := range []string{rdn.Protocol.Hex(), strings.ToLower(rdn.Protocol.Hex()), "0x" + strings.ToUpper(rdn.Protocol.Hex()[2:])} {
+		if alias := util.AddressToAlias(addr); alias != "RDN" {
+			t.Errorf("expect RDN for %s, got %s", addr, alias)
+		}
+	}
+	if market, err := util.WrapMarketByAddress(strings.ToLower(rdn.Protocol.Hex()), weth.Protocol.Hex()); err != nil || market != "RDN-WETH" {
+		t.Errorf("expect RDN-WETH, got %s %v", market, err)
+	}
+
+	if err := util.DeleteToken("RDN"); err != nil {
+		t.Fatal(err)
+	}
+	if alias := util.AddressToAlias(rdn.Protocol.Hex()); alias != "" {
+		t.Errorf("deleted token should be removed from index, got %s", alias)
+	}
+}
+
+func TestWrapMarket_BothMarkets(t *testing.T) {
+	weth := types.Token{Protocol: common.HexToAddress("0x2956356cD2a2bf3202F771F50D3D14A367b48070"), Symbol: "WETH", Decimals: big.NewInt(1e18), IsMarket: true}
+	usdt := types.Token{Protocol: common.HexToAddress("0xdAC17F958D2ee523a2206206994597C13D831ec7"), Symbol: "USDT", Decimals: big.NewInt(1e6), IsMarket: true}
+	usdc := types.Token{Protocol: common.HexToAddress("0xA0b86991c6218b36c1d19D4a2e9Eb0cE3606eB48"), Symbol: "USDC", Decimals: big.NewInt(1e6), IsMarket: true}
+	util.SetTokens(map[string]types.Token{"WETH": weth, "USDT": usdt, "USDC": usdc}, map[string]types.Token{"WETH": weth, "USDT": usdt, "USDC": usdc})
+
+	cases := []struct {
+		s, b, market string
+	}{
+		// 只有WETH配置了MarketBaseOrder, WETH作为市场
+		{"WETH", "USDT", "USDT-WETH"},
+		{"usdt", "weth", "USDT-WETH"},
+		// 都未配置, 字典序较大的USDT作为市场
+		{"USDC", "USDT", "USDC-USDT"},
+		{"USDT", "USDC", "USDC-USDT"},
+	}
+	for _, c := range cases {
+		for i := 0; i < 10; i++ {
+			market, err := util.WrapMarket(c.s, c.b)
+			if err != nil || market != c.market {
+				t.Fatalf("wrap %s %s expect %s, got %s %v", c.s, c.b, c.market, market, err)
+			}
+		}
+	}
+
+	// side与市场保持一致: 卖出USDT换WETH为卖单
+	if side := util.GetSide("USDT", "WETH"); side != util.SideSell {
+		t.Errorf("expect sell, got %s", side)
+	}
+	if side := util.GetSide("USDT", "USDC"); side != util.SideBuy {
+		t.Errorf("expect buy, got %s", side)
+	}
+}
+
+func setBatchWrapMarketTokens() []util.TokenPair {
+	weth := types.Token{Protocol: common.HexToAddress("0x2956356cD2a2bf3202F771F50D3D14A367b48070"), Symbol: "WETH", Decimals: big.NewInt(1e18), IsMarket: true}
+	usdt := types.Token{Protocol: common.HexToAddress("0xdAC17F958D2ee523a2206206994597C13D831ec7"), Symbol: "USDT", Decimals: big.NewInt(1e6), IsMarket: true}
+	lrc := types.Token{Protocol: common.HexToAddress("0xEF68e7C694F40c8202821eDF525dE3782458639f"), Symbol: "LRC", Decimals: big.NewInt(1e18)}
+	rdn := types.Token{Protocol: common.HexToAddress("0x255Aa6DF07540Cb5d3d297f0D0D4D84cb52bc8e6"), Symbol: "RDN", Decimals: big.NewInt(1e18)}
+	unknown := common.HexToAddress("0x0000000000000000000000000000000000000001")
+
+	util.SetTokens(map[string]types.Token{"LRC": lrc, "RDN": rdn}, map[string]types.Token{"WETH": weth, "USDT": usdt})
+
+	return []util.TokenPair{
+		{lrc.Protocol, weth.Protocol},
+		{weth.Protocol, rdn.Protocol},
+		{usdt.Protocol, weth.Protocol},
+		{rdn.Protocol, usdt.Protocol},
+		{lrc.Protocol, rdn.Protocol},
+		{unknown, weth.Protocol},
+	}
+}
+
+func TestBatchWrapMarket(t *testing.T) {
+	pairs := setBatchWrapMarketTokens()
+
+	markets := util.BatchWrapMarket(pairs)
+	if len(markets) != len(pairs) {
+		t.Fatalf("expect %d markets, got %d", len(pairs), len(markets))
+	}
+	for i, pair := range pairs {
+		expect, err := util.WrapMarketByAddress(pair.TokenS.Hex(), pair.TokenB.Hex())
+		if err != nil {
+			expect = ""
+		}
+		if markets[i] != expect {
+			t.Errorf("pair %d expect %q, got %q", i, expect, markets[i])
+		}
+	}
+	if markets[0] != "LRC-WETH" || markets[5] != "" {
+		t.Errorf("unexpected markets %v", markets)
+	}
+}
+
+func TestWrapMarketByAddress_UnknownToken(t *testing.T) {
+	pairs := setBatchWrapMarketTokens()
+	unknown, weth := pairs[5].TokenS, pairs[5].TokenB
+
+	_, err := util.WrapMarketByAddress(unknown.Hex(), weth.Hex())
+	if !util.IsUnknownToken(err) {
+		t.Fatalf("expect unknown token error, got %v", err)
+	}
+	if e := err.(*util.ErrUnknownToken); len(e.Addresses) != 1 || e.Addresses[0] != unknown.Hex() {
+		t.Errorf("unknown token error should carry the address, got %v", e.Addresses)
+	}
+	if !strings.Contains(err.Error(), unknown.Hex()) {
+		t.Errorf("error message should contain address %s, got %s", unknown.Hex(), err.Error())
+	}
+
+	// 两个地址都已知但不构成市场, 不是unknown token错误, 错误信息中仍包含地址
+	lrc, rdn := pairs[4].TokenS, pairs[4].TokenB
+	_, err = util.WrapMarketByAddress(lrc.Hex(), rdn.Hex())
+	if err == nil || util.IsUnknownToken(err) {
+		t.Fatalf("expect unsupported market error, got %v", err)
+	}
+	if !strings.Contains(err.Error(), lrc.Hex()) || !strings.Contains(err.Error(), rdn.Hex()) {
+		t.Errorf("error message should contain both addresses, got %s", err.Error())
+	}
+}
+
+func BenchmarkBatchWrapMarket(b *testing.B) {
+	pairs := setBatchWrapMarketTokens()
+	for len(pairs) < 1000 {
+		pairs = append(pairs, pairs...)
+	}
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		util.BatchWrapMarket(pairs)
+	}
+}
+
+func BenchmarkWrapMarketByAddress(b *testing.B) {
+	pairs := setBatchWrapMarketTokens()
+	for len(pairs) < 1000 {
+		pairs = append(pairs, pairs...)
+	}
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		for _, pair := range pairs {
+			util.WrapMarketByAddress(pair.TokenS.Hex(), pair.TokenB.Hex())
+		}
+	}
+}
+
+func TestMarketsForToken(t *testing.T) {
+	lrc := types.Token{Protocol: common.HexToAddress("0xEF68e7C694F40c8202821eDF525dE3782458639f"), Symbol: "LRC", Decimals: big.NewInt(1e18)}
+	rdn := types.Token{Protocol: common.HexToAddress("0x255Aa6DF07540Cb5d3d297f0D0D4D84cb52bc8e6"), Symbol: "RDN", Decimals: big.NewInt(1e18)}
+	weth := types.Token{Protocol: common.HexToAddress("0x2956356cD2a2bf3202F771F50D3D14A367b48070"), Symbol: "WETH", Decimals: big.NewInt(1e18), IsMarket: true}
+	util.SetTokens(map[string]types.Token{"LRC": lrc, "RDN": rdn}, map[string]types.Token{"WETH": weth})
+	if err := util.LoadTokens(&memoryTokenStore{tokens: make(map[string]types.Token)}); err != nil {
+		t.Fatal(err)
+	}
+
+	if markets := util.MarketsForToken("lrc"); len(markets) != 1 || markets[0] != "LRC-WETH" {
+		t.Errorf("LRC should only be in LRC-WETH, got %v", markets)
+	}
+	if markets := util.MarketsForToken("WETH"); strings.Join(markets, ",") != "LRC-WETH,RDN-WETH" {
+		t.Errorf("base token should be in all markets, got %v", markets)
+	}
+	if markets := util.MarketsForToken("ABC"); markets == nil || len(markets) != 0 {
+		t.Errorf("unknown token should have no markets, got %v", markets)
+	}
+
+	// 删除token后索引随市场一起重建
+	if err := util.DeleteToken("RDN"); err != nil {
+		t.Fatal(err)
+	}
+	if markets := util.MarketsForToken("WETH"); strings.Join(markets, ",") != "LRC-WETH" {
+		t.Errorf("RDN-WETH should be removed from index, got %v", markets)
+	}
+}
+
+type memoryMarketConfigStore struct {
+	configs []types.MarketConfig
+}
+
+func (s *memoryMarketConfigStore) GetMarketConfigs() ([]types.MarketConfig, error) {
+	return s.configs, nil
+}
+
+func TestGetMarketConfig(t *testing.T) {
+	lrc := types.Token{Protocol: common.HexToAddress("0xEF68e7C694F40c8202821eDF525dE3782458639f"), Symbol: "LRC", Decimals: big.NewInt(1e18)}
+	weth := types.Token{Protocol: common.HexToAddress("0x2956356cD2a2bf3202F771F50D3D14A367b48070"), Symbol: "WETH", Decimals: big.NewInt(1e18), IsMarket: true}
+	util.SetTokens(map[string]types.Token{"LRC": lrc}, map[string]types.Token{"WETH": weth})
+	if err := util.LoadTokens(&memoryTokenStore{tokens: make(map[string]types.Token)}); err != nil {
+		t.Fatal(err)
+	}
+
+	store := &memoryMarketConfigStore{configs: []types.MarketConfig{
+		{Market: "lrc-weth", MinAmountS: big.NewInt(1e18), PriceDecimals: 6, AmountDecimals: 2},
+		{Market: "RDN", PriceDecimals: 6},
+		{Market: "OMG-WETH", PriceDecimals: -1},
+	}}
+	if err := util.LoadMarketConfigs(store); err != nil {
+		t.Fatal(err)
+	}
+	defer util.LoadMarketConfigs(&memoryMarketConfigStore{})
+
+	config, ok := util.GetMarketConfig("LRC-WETH")
+	if !ok || config.MinAmountS.Cmp(big.NewInt(1e18)) != 0 || config.PriceDecimals != 6 || config.AmountDecimals != 2 {
+		t.Fatalf("unexpected LRC-WETH config %v", config)
+	}
+	if _, ok := util.GetMarketConfig("OMG-WETH"); ok {
+		t.Errorf("invalid config of unknown market should be ignored")
+	}
+	if _, ok := util.GetMarketConfig("ABC-WETH"); ok {
+		t.Errorf("unknown market should not have config")
+	}
+
+	// 运行时新增的token使用默认值, 数量精度不超过token精度
+	usdc := types.Token{Protocol: common.HexToAddress("0xA0b86991c6218b36c1d19D4a2e9Eb0cE3606eB48"), Symbol: "USDC", Decimals: big.NewInt(1e2)}
+	if err := util.AddToken(usdc); err != nil {
+		t.Fatal(err)
+	}
+	config, ok = util.GetMarketConfig("usdc-weth")
+	if !ok || config.Market != "USDC-WETH" || config.MinAmountS.Sign() != 0 || config.PriceDecimals != 8 || config.AmountDecimals != 2 {
+		t.Fatalf("unexpected default USDC-WETH config %v", config)
+	}
+	rdn := types.Token{Protocol: common.HexToAddress("0x255Aa6DF07540Cb5d3d297f0D0D4D84cb52bc8e6"), Symbol: "RDN", Decimals: big.NewInt(1e18)}
+	if err := util.AddToken(rdn); err != nil {
+		t.Fatal(err)
+	}
+	if config, ok = util.GetMarketConfig("RDN-WETH"); !ok || config.AmountDecimals != 4 {
+		t.Fatalf("unexpected default RDN-WETH config %v", config)
+	}
 }
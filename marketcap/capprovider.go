@@ -23,6 +23,7 @@ import (
 	"errors"
 	"fmt"
 	"github.com/Loopring/relay/config"
+	"github.com/Loopring/relay/eventemiter"
 	"github.com/Loopring/relay/log"
 	"github.com/Loopring/relay/market"
 	"github.com/Loopring/relay/market/util"
@@ -87,7 +88,7 @@ func NewLocalCap() *CapProvider_LocalCap {
 }
 
 func (cap *CapProvider_LocalCap) Start() {
-	for _, marketStr := range util.AllMarkets {
+	for _, marketStr := range util.AllMarkets() {
 		tokenAddress, _ := util.UnWrapToAddress(marketStr)
 		token, _ := util.AddressToToken(tokenAddress)
 		c := &types.CurrencyMarketCap{}
@@ -191,6 +192,7 @@ type CapProvider_CoinMarketCap struct {
 	currency        string
 	duration        int
 	stopChan        chan bool
+	decimalsWatcher *eventemitter.Watcher
 }
 
 func (p *CapProvider_CoinMarketCap) LegalCurrencyValue(tokenAddress common.Address, amount *big.Rat) (*big.Rat, error) {
@@ -198,7 +200,7 @@ func (p *CapProvider_CoinMarketCap) LegalCurrencyValue(tokenAddress common.Addre
 }
 
 func (p *CapProvider_CoinMarketCap) LegalCurrencyValueOfEth(amount *big.Rat) (*big.Rat, error) {
-	tokenAddress := util.AllTokens["WETH"].Protocol
+	tokenAddress := util.AllTokens()["WETH"].Protocol
 	return p.LegalCurrencyValueByCurrency(tokenAddress, amount, p.currency)
 }
 
@@ -220,7 +222,7 @@ func (p *CapProvider_CoinMarketCap) GetMarketCap(tokenAddress common.Address) (*
 }
 
 func (p *CapProvider_CoinMarketCap) GetEthCap() (*big.Rat, error) {
-	return p.GetMarketCapByCurrency(util.AllTokens["WETH"].Protocol, p.currency)
+	return p.GetMarketCapByCurrency(util.AllTokens()["WETH"].Protocol, p.currency)
 }
 
 func (p *CapProvider_CoinMarketCap) GetMarketCapByCurrency(tokenAddress common.Address, currencyStr string) (*big.Rat, error) {
@@ -236,8 +238,8 @@ func (p *CapProvider_CoinMarketCap) GetMarketCapByCurrency(tokenAddress common.A
 			v = c.PriceBtc
 		}
 		if "VITE" == c.Symbol || "ARP" == c.Symbol {
-			wethCap, _ := p.GetMarketCapByCurrency(util.AllTokens["WETH"].Protocol, currencyStr)
-			v = wethCap.Mul(wethCap, util.AllTokens[c.Symbol].IcoPrice)
+			wethCap, _ := p.GetMarketCapByCurrency(util.AllTokens()["WETH"].Protocol, currencyStr)
+			v = wethCap.Mul(wethCap, util.AllTokens()[c.Symbol].IcoPrice)
 		}
 		if v == nil {
 			return nil, errors.New("tokenCap is nil")
@@ -255,10 +257,14 @@ func (p *CapProvider_CoinMarketCap) GetMarketCapByCurrency(tokenAddress common.A
 }
 
 func (p *CapProvider_CoinMarketCap) Stop() {
+	eventemitter.Un(eventemitter.TokenMetadataChanged, p.decimalsWatcher)
 	p.stopChan <- true
 }
 
 func (p *CapProvider_CoinMarketCap) Start() {
+	p.decimalsWatcher = &eventemitter.Watcher{Concurrent: false, Handle: p.handleTokenMetadataChanged}
+	eventemitter.On(eventemitter.TokenMetadataChanged, p.decimalsWatcher)
+
 	go func() {
 		for {
 			select {
@@ -276,6 +282,15 @@ func (p *CapProvider_CoinMarketCap) Start() {
 	}()
 }
 
+// 可升级token的decimals变化后, 法币价值需按新的decimals计算
+func (p *CapProvider_CoinMarketCap) handleTokenMetadataChanged(input eventemitter.EventData) error {
+	evt := input.(*types.TokenMetadataChangedEvent)
+	if c, exists := p.tokenMarketCaps[evt.Token]; exists {
+		c.Decimals = new(big.Int).Set(evt.NewDecimals)
+	}
+	return nil
+}
+
 func (p *CapProvider_CoinMarketCap) syncMarketCap() error {
 	url := fmt.Sprintf(p.baseUrl, p.currency)
 	resp, err := http.Get(url)
@@ -331,7 +346,7 @@ func NewMarketCapProvider(options config.MarketCapOptions) *CapProvider_CoinMark
 		//default 5 min
 		provider.duration = 5
 	}
-	for _, v := range util.AllTokens {
+	for _, v := range util.AllTokens() {
 		if "ARP" == v.Symbol || "VITE" == v.Symbol {
 			c := &types.CurrencyMarketCap{}
 			c.Address = v.Protocol
@@ -35,7 +35,7 @@ func TestStart(t *testing.T) {
 	util.Initialize(cfg.Market)
 	provider := marketcap.NewMarketCapProvider(cfg.MarketCap)
 	provider.Start()
-	for _, token := range util.AllTokens {
+	for _, token := range util.AllTokens() {
 		p1, _ := provider.GetMarketCap(token.Protocol)
 		p2, _ := provider.GetMarketCapByCurrency(token.Protocol, "USD")
 		t.Logf("second round token:%s, p1:%s, p2:%s", token.Symbol, p1.FloatString(2), p2.FloatString(2))
@@ -19,6 +19,7 @@
 package miner
 
 import (
+	"github.com/Loopring/relay/eventemiter"
 	"github.com/Loopring/relay/marketcap"
 )
 
@@ -30,6 +31,7 @@ type Miner struct {
 }
 
 func (minerInstance *Miner) Start() {
+	eventemitter.Declare(eventemitter.Miner_NewRing, eventemitter.Miner_RingSubmitResult)
 	minerInstance.matcher.Start()
 	minerInstance.submitter.start()
 }
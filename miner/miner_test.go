@@ -143,9 +143,9 @@ func TestMiner_PrepareOrders(t *testing.T) {
 	//c := test.Cfg()
 	entity := test.Entity()
 
-	lrc := util.SupportTokens["LRC"].Protocol
+	lrc := util.SupportTokens()["LRC"].Protocol
 
-	eth := util.SupportMarkets["WETH"].Protocol
+	eth := util.SupportMarkets()["WETH"].Protocol
 
 	account1 := entity.Accounts[0]
 	account2 := entity.Accounts[1]
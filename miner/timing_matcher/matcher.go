@@ -86,7 +86,7 @@ func NewTimingMatcher(matcherOptions *config.TimingMatcher, submitter *miner.Rin
 	matcher.lastRoundNumber = big.NewInt(0)
 	matcher.stopFuncs = []func(){}
 
-	for _, pair := range marketUtilLib.AllTokenPairs {
+	for _, pair := range marketUtilLib.AllTokenPairs() {
 		inited := false
 		for _, market := range matcher.markets {
 			if (market.TokenB == pair.TokenB && market.TokenA == pair.TokenS) ||
@@ -27,6 +27,7 @@ import (
 	"github.com/Loopring/relay/crypto"
 	"github.com/Loopring/relay/dao"
 	"github.com/Loopring/relay/ethaccessor"
+	"github.com/Loopring/relay/eventemiter"
 	"github.com/Loopring/relay/extractor"
 	"github.com/Loopring/relay/gateway"
 	"github.com/Loopring/relay/log"
@@ -39,6 +40,7 @@ import (
 	"github.com/Loopring/relay/txmanager"
 	"github.com/Loopring/relay/usermanager"
 	"github.com/ethereum/go-ethereum/accounts/keystore"
+	"github.com/ethereum/go-ethereum/common"
 	"go.uber.org/zap"
 )
 
@@ -66,8 +68,10 @@ type Node struct {
 type RelayNode struct {
 	extractorService extractor.ExtractorService
 	trendManager     market.TrendManager
+	tapeManager      *market.TapeManager
 	tickerCollector  market.CollectorImpl
 	jsonRpcService   gateway.JsonrpcServiceImpl
+	adminService     *gateway.AdminServiceImpl
 	websocketService gateway.WebsocketServiceImpl
 	socketIOService  gateway.SocketIOServiceImpl
 	walletService    gateway.WalletServiceImpl
@@ -76,12 +80,14 @@ type RelayNode struct {
 
 func (n *RelayNode) Start() {
 	n.txManager.Start()
+	n.tapeManager.Start()
 	n.extractorService.Start()
 
 	//gateway.NewJsonrpcService("8080").Start()
 	fmt.Println("step in relay node start")
 	n.tickerCollector.Start()
 	go n.jsonRpcService.Start()
+	n.adminService.Start()
 	//n.websocketService.Start()
 	go n.socketIOService.Start()
 
@@ -89,6 +95,7 @@ func (n *RelayNode) Start() {
 
 func (n *RelayNode) Stop() {
 	n.txManager.Stop()
+	n.tapeManager.Stop()
 }
 
 type MineNode struct {
@@ -112,8 +119,17 @@ func NewNode(logger *zap.Logger, globalConfig *config.GlobalConfig) *Node {
 	cache.NewCache(n.globalConfig.Redis)
 
 	util.Initialize(n.globalConfig.Market)
-	n.registerMarketCap()
+	if err := util.LoadTokens(n.rdsService); err != nil {
+		log.Errorf("load tokens from mysql error:%s", err.Error())
+	}
+	if err := util.LoadMarketConfigs(n.rdsService); err != nil {
+		log.Errorf("load market configs from mysql error:%s", err.Error())
+	}
 	n.registerAccessor()
+	util.BackfillDecimals(ethaccessor.Erc20Decimals)
+	util.SetDecimalsReader(ethaccessor.Erc20Decimals)
+	util.StartDecimalsRefreshCron(n.globalConfig.Market, ethaccessor.Erc20Decimals)
+	n.registerMarketCap()
 	n.registerUserManager()
 	n.registerOrderManager()
 	n.registerAccountManager()
@@ -137,6 +153,7 @@ func (n *Node) registerRelayNode() {
 	n.registerExtractor()
 	n.registerTransactionManager()
 	n.registerTrendManager()
+	n.registerTapeManager()
 	n.registerTickerCollector()
 	n.registerWalletService()
 	n.registerJsonRpcService()
@@ -165,6 +182,9 @@ func (n *Node) Start() {
 		n.mineNode.Start()
 		ethaccessor.IncludeGasPriceEvaluator()
 	}
+
+	// 校验watcher与emitter是否配对, 仅输出警告
+	eventemitter.Validate()
 }
 
 func (n *Node) Wait() {
@@ -192,6 +212,23 @@ func (n *Node) Stop() {
 	n.lock.RUnlock()
 }
 
+// Reload 配置文件变更后重新加载支持热更新的模块, 目前为协议合约地址及extractor配置
+// 协议地址变化时由extractor发出ProtocolSetChanged
+func (n *Node) Reload(globalConfig *config.GlobalConfig) {
+	n.lock.Lock()
+	defer n.lock.Unlock()
+
+	if err := ethaccessor.ReloadProtocolAddresses(globalConfig.Common.ProtocolImpl.Address); nil != err {
+		log.Errorf("reload protocol addresses error:%s", err.Error())
+	} else {
+		n.globalConfig.Common.ProtocolImpl.Address = globalConfig.Common.ProtocolImpl.Address
+	}
+	n.globalConfig.Extractor = globalConfig.Extractor
+	if nil != n.relayNode {
+		n.relayNode.extractorService.Reload(n.globalConfig.Extractor)
+	}
+}
+
 func (n *Node) registerCrypto(ks *keystore.KeyStore) {
 	c := crypto.NewKSCrypto(true, ks)
 	crypto.Initialize(c)
@@ -210,7 +247,12 @@ func (n *Node) registerAccessor() {
 }
 
 func (n *Node) registerExtractor() {
-	n.relayNode.extractorService = extractor.NewExtractorService(n.globalConfig.Extractor, n.rdsService)
+	extractorService := extractor.NewExtractorService(n.globalConfig.Extractor, n.rdsService)
+	extractorService.SetTrackedOwnerFilter(func(owner common.Address) bool {
+		unlocked, _ := n.accountManager.HasUnlocked(owner.Hex())
+		return unlocked
+	})
+	n.relayNode.extractorService = extractorService
 }
 
 func (n *Node) registerIPFSSubService() {
@@ -225,12 +267,16 @@ func (n *Node) registerTrendManager() {
 	n.relayNode.trendManager = market.NewTrendManager(n.rdsService, n.globalConfig.Market.CronJobLock)
 }
 
+func (n *Node) registerTapeManager() {
+	n.relayNode.tapeManager = market.NewTapeManager(n.globalConfig.Market.TapeBufferSize)
+}
+
 func (n *Node) registerAccountManager() {
 	n.accountManager = market.NewAccountManager(n.globalConfig.AccountManager)
 }
 
 func (n *Node) registerTransactionManager() {
-	n.relayNode.txManager = txmanager.NewTxManager(n.rdsService, &n.accountManager)
+	n.relayNode.txManager = txmanager.NewTxManager(n.rdsService, &n.accountManager, &n.globalConfig.TxManager)
 }
 
 func (n *Node) registerTickerCollector() {
@@ -244,6 +290,7 @@ func (n *Node) registerWalletService() {
 
 func (n *Node) registerJsonRpcService() {
 	n.relayNode.jsonRpcService = *gateway.NewJsonrpcService(n.globalConfig.Jsonrpc.Port, &n.relayNode.walletService)
+	n.relayNode.adminService = gateway.NewAdminService(n.globalConfig.Jsonrpc.AdminPort, n.relayNode.extractorService)
 }
 
 func (n *Node) registerWebsocketService() {
@@ -251,7 +298,7 @@ func (n *Node) registerWebsocketService() {
 }
 
 func (n *Node) registerSocketIOService() {
-	n.relayNode.socketIOService = *gateway.NewSocketIOService(n.globalConfig.Websocket.Port, n.relayNode.walletService)
+	n.relayNode.socketIOService = *gateway.NewSocketIOService(n.globalConfig.Websocket.Port, n.relayNode.walletService, n.relayNode.tapeManager)
 }
 
 func (n *Node) registerMiner() {
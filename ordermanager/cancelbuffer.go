@@ -0,0 +1,186 @@
+/*
+
+  Copyright 2017 Loopring Project Ltd (Loopring Foundation).
+
+  Licensed under the Apache License, Version 2.0 (the "License");
+  you may not use this file except in compliance with the License.
+  You may obtain a copy of the License at
+
+  http://www.apache.org/licenses/LICENSE-2.0
+
+  Unless required by applicable law or agreed to in writing, software
+  distributed under the License is distributed on an "AS IS" BASIS,
+  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+  See the License for the specific language governing permissions and
+  limitations under the License.
+
+*/
+
+package ordermanager
+
+import (
+	"encoding/json"
+	"github.com/Loopring/relay/cache"
+	"github.com/Loopring/relay/dao"
+	"github.com/Loopring/relay/log"
+	"github.com/Loopring/relay/types"
+	"math/big"
+	"sync"
+)
+
+const pendingCancelKey = "OM_PENDING_CANCEL"
+
+// 未确认的cancel同时写入存储, relay重启后从存储恢复, 避免丢失
+type cancelStore interface {
+	save(evt *types.OrderCancelledEvent) error
+	remove(list []*types.OrderCancelledEvent) error
+	load() ([]*types.OrderCancelledEvent, error)
+}
+
+// cancel事件确认confirm个块后才处理, 避免被分叉回滚的cancel提前移除订单
+type CancelBuffer struct {
+	mtx     sync.Mutex
+	confirm int64
+	pending []*types.OrderCancelledEvent
+	store   cancelStore
+}
+
+func NewCancelBuffer(confirm int64) *CancelBuffer {
+	return &CancelBuffer{confirm: confirm, store: &redisCancelStore{}}
+}
+
+func (b *CancelBuffer) Add(evt *types.OrderCancelledEvent) {
+	b.mtx.Lock()
+	defer b.mtx.Unlock()
+
+	if b.add(evt) {
+		if err := b.store.save(evt); err != nil {
+			log.Errorf("order manager,save pending cancel tx:%s order:%s error:%s", evt.TxHash.Hex(), evt.OrderHash.Hex(), err.Error())
+		}
+	}
+}
+
+// Restore 从存储恢复重启前未确认的cancel, 已在缓冲中的不重复添加
+func (b *CancelBuffer) Restore() error {
+	list, err := b.store.load()
+	if err != nil {
+		return err
+	}
+
+	b.mtx.Lock()
+	defer b.mtx.Unlock()
+
+	for _, v := range list {
+		b.add(v)
+	}
+	return nil
+}
+
+func (b *CancelBuffer) add(evt *types.OrderCancelledEvent) bool {
+	for _, v := range b.pending {
+		if v.TxHash == evt.TxHash && v.OrderHash == evt.OrderHash {
+			return false
+		}
+	}
+	b.pending = append(b.pending, evt)
+	return true
+}
+
+func (b *CancelBuffer) drop(list []*types.OrderCancelledEvent) {
+	if len(list) == 0 {
+		return
+	}
+	if err := b.store.remove(list); err != nil {
+		log.Errorf("order manager,remove %d pending cancels error:%s", len(list), err.Error())
+	}
+}
+
+// Ready 取出到blockNumber为止已确认的cancel, 按到达顺序返回
+func (b *CancelBuffer) Ready(blockNumber *big.Int) []*types.OrderCancelledEvent {
+	b.mtx.Lock()
+	defer b.mtx.Unlock()
+
+	var ready, list []*types.OrderCancelledEvent
+	for _, v := range b.pending {
+		if v.BlockNumber.Int64()+b.confirm <= blockNumber.Int64() {
+			ready = append(ready, v)
+		} else {
+			list = append(list, v)
+		}
+	}
+	b.pending = list
+	b.drop(ready)
+	return ready
+}
+
+// Rollback 丢弃forkBlock之后的cancel, 返回丢弃数量
+func (b *CancelBuffer) Rollback(forkBlock *big.Int) int {
+	b.mtx.Lock()
+	defer b.mtx.Unlock()
+
+	var list, dropped []*types.OrderCancelledEvent
+	for _, v := range b.pending {
+		if v.BlockNumber.Cmp(forkBlock) <= 0 {
+			list = append(list, v)
+		} else {
+			dropped = append(dropped, v)
+		}
+	}
+	b.pending = list
+	b.drop(dropped)
+	return len(dropped)
+}
+
+func (b *CancelBuffer) Len() int {
+	b.mtx.Lock()
+	defer b.mtx.Unlock()
+	return len(b.pending)
+}
+
+// redisCancelStore 以hash保存未确认的cancel, field为txhash-orderhash
+type redisCancelStore struct{}
+
+func pendingCancelField(evt *types.OrderCancelledEvent) []byte {
+	return []byte(evt.TxHash.Hex() + "-" + evt.OrderHash.Hex())
+}
+
+func (s *redisCancelStore) save(evt *types.OrderCancelledEvent) error {
+	model := &dao.CancelEvent{}
+	model.ConvertDown(evt)
+	bs, err := json.Marshal(model)
+	if err != nil {
+		return err
+	}
+	return cache.HMSet(pendingCancelKey, 0, pendingCancelField(evt), bs)
+}
+
+func (s *redisCancelStore) remove(list []*types.OrderCancelledEvent) error {
+	var fields [][]byte
+	for _, v := range list {
+		fields = append(fields, pendingCancelField(v))
+	}
+	_, err := cache.HDel(pendingCancelKey, fields...)
+	return err
+}
+
+func (s *redisCancelStore) load() ([]*types.OrderCancelledEvent, error) {
+	vals, err := cache.HVals(pendingCancelKey)
+	if err != nil {
+		return nil, err
+	}
+
+	var list []*types.OrderCancelledEvent
+	for _, bs := range vals {
+		model := &dao.CancelEvent{}
+		if err := json.Unmarshal(bs, model); err != nil {
+			log.Errorf("order manager,unmarshal pending cancel error:%s", err.Error())
+			continue
+		}
+		evt := &types.OrderCancelledEvent{}
+		model.ConvertUp(evt)
+		// 只有成功的cancel才会进入缓冲
+		evt.Status = types.TX_STATUS_SUCCESS
+		list = append(list, evt)
+	}
+	return list, nil
+}
@@ -0,0 +1,226 @@
+/*
+
+  Copyright 2017 Loopring Project Ltd (Loopring Foundation).
+
+  Licensed under the Apache License, Version 2.0 (the "License");
+  you may not use this file except in compliance with the License.
+  You may obtain a copy of the License at
+
+  http://www.apache.org/licenses/LICENSE-2.0
+
+  Unless required by applicable law or agreed to in writing, software
+  distributed under the License is distributed on an "AS IS" BASIS,
+  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+  See the License for the specific language governing permissions and
+  limitations under the License.
+
+*/
+
+package ordermanager
+
+import (
+	"encoding/json"
+	"github.com/Loopring/relay/config"
+	"github.com/Loopring/relay/crypto"
+	"github.com/Loopring/relay/dao"
+	"github.com/Loopring/relay/eventemiter"
+	"github.com/Loopring/relay/log"
+	"github.com/Loopring/relay/types"
+	"github.com/ethereum/go-ethereum/common"
+	"go.uber.org/zap"
+	"math/big"
+	"testing"
+	"time"
+)
+
+func TestOrderManagerImpl_CancelConfirmBlocks(t *testing.T) {
+	zapOpts := zap.NewDevelopmentConfig()
+	zapOpts.Level = zap.NewAtomicLevelAt(zap.ErrorLevel)
+	log.Initialize(config.LogOptions{ZapOpts: zapOpts})
+	crypto.Initialize(crypto.NewKSCrypto(true, nil))
+
+	validUntil := time.Now().Unix() + 3600
+	reorged := newOpenOrder("LRC-WETH", 1000, validUntil)
+	confirmed := newOpenOrder("LRC-WETH", 2000, validUntil)
+
+	db := &openOrdersRdsService{orders: make(map[common.Hash]*dao.Order)}
+	for _, v := range []*dao.Order{reorged, confirmed} {
+		db.orders[common.HexToHash(v.OrderHash)] = v
+	}
+
+	om := NewOrderManager(&config.OrderManagerOptions{DustOrderValue: 0, CancelConfirmBlocks: 3}, db, nil, &openOrdersMarketCap{})
+	om.cancels.store = newMemoryCancelStore()
+	om.Start()
+	defer om.Stop()
+
+	newBlock := func(number int64) {
+		eventemitter.Emit(eventemitter.Block_New, &types.BlockEvent{BlockNumber: big.NewInt(number)})
+	}
+	cancel := func(order *dao.Order, txhash string, block int64) {
+		evt := &types.OrderCancelledEvent{OrderHash: common.HexToHash(order.OrderHash), AmountCancelled: big.NewInt(5000)}
+		evt.Status = types.TX_STATUS_SUCCESS
+		evt.TxHash = common.HexToHash(txhash)
+		evt.BlockNumber = big.NewInt(block)
+		eventemitter.Emit(eventemitter.CancelOrder, evt)
+	}
+
+	newBlock(100)
+	cancel(confirmed, "0x02", 100)
+	newBlock(101)
+	cancel(reorged, "0x01", 101)
+	if cnt := om.OpenOrderCount("LRC-WETH"); cnt != 2 {
+		t.Fatalf("cancels within grace period should not remove orders, got %d", cnt)
+	}
+
+	// 块101被分叉回滚, 其中的cancel尚未确认, 直接丢弃
+	om.cancels.Rollback(big.NewInt(100))
+	newBlock(102)
+	newBlock(103)
+
+	if cnt := om.OpenOrderCount("LRC-WETH"); cnt != 1 {
+		t.Fatalf("only the confirmed cancel should remove its order, got %d open", cnt)
+	}
+	if reorged.Status != uint8(types.ORDER_NEW) || reorged.CancelledAmountS != "0" {
+		t.Fatalf("reorged cancel should not touch order, got status %d cancelled %s", reorged.Status, reorged.CancelledAmountS)
+	}
+	if confirmed.Status != uint8(types.ORDER_CANCEL) {
+		t.Fatalf("confirmed cancel should settle order, got status %d", confirmed.Status)
+	}
+	if om.cancels.Len() != 0 {
+		t.Fatalf("cancel buffer should be empty, got %d", om.cancels.Len())
+	}
+}
+
+func TestOrderManagerImpl_ReplayCancel(t *testing.T) {
+	zapOpts := zap.NewDevelopmentConfig()
+	zapOpts.Level = zap.NewAtomicLevelAt(zap.ErrorLevel)
+	log.Initialize(config.LogOptions{ZapOpts: zapOpts})
+	crypto.Initialize(crypto.NewKSCrypto(true, nil))
+
+	order := newOpenOrder("LRC-WETH", 1000, time.Now().Unix()+3600)
+	db := &openOrdersRdsService{orders: map[common.Hash]*dao.Order{common.HexToHash(order.OrderHash): order}}
+
+	om := NewOrderManager(&config.OrderManagerOptions{DustOrderValue: 0, CancelConfirmBlocks: 3}, db, nil, &openOrdersMarketCap{})
+	om.cancels.store = newMemoryCancelStore()
+	om.Start()
+	defer om.Stop()
+
+	// 重放的历史cancel已确认, 直接处理
+	evt := &types.OrderCancelledEvent{OrderHash: common.HexToHash(order.OrderHash), AmountCancelled: big.NewInt(5000)}
+	evt.Status = types.TX_STATUS_SUCCESS
+	evt.TxHash = common.HexToHash("0x01")
+	evt.BlockNumber = big.NewInt(50)
+	evt.Replay = true
+	eventemitter.Emit(eventemitter.CancelOrder, evt)
+
+	if order.Status != uint8(types.ORDER_CANCEL) {
+		t.Fatalf("replayed cancel should settle order immediately, got status %d", order.Status)
+	}
+	if om.cancels.Len() != 0 {
+		t.Fatalf("replayed cancel should not be buffered, got %d", om.cancels.Len())
+	}
+}
+
+func TestCancelBuffer_Rollback(t *testing.T) {
+	buffer := NewCancelBuffer(2)
+	buffer.store = newMemoryCancelStore()
+	for i, block := range []int64{10, 11, 12} {
+		evt := &types.OrderCancelledEvent{OrderHash: common.BigToHash(big.NewInt(int64(i)))}
+		evt.TxHash = common.BigToHash(big.NewInt(block))
+		evt.BlockNumber = big.NewInt(block)
+		buffer.Add(evt)
+		buffer.Add(evt)
+	}
+	if buffer.Len() != 3 {
+		t.Fatalf("duplicated cancel should be buffered once, got %d", buffer.Len())
+	}
+
+	if n := buffer.Rollback(big.NewInt(10)); n != 2 {
+		t.Fatalf("expect 2 cancels after fork block dropped, got %d", n)
+	}
+	if ready := buffer.Ready(big.NewInt(11)); len(ready) != 0 {
+		t.Fatalf("cancel at block 10 needs 2 confirmations, got %d ready", len(ready))
+	}
+	if ready := buffer.Ready(big.NewInt(12)); len(ready) != 1 || ready[0].BlockNumber.Int64() != 10 {
+		t.Fatalf("cancel at block 10 should be ready at block 12")
+	}
+}
+
+func TestCancelBuffer_Restore(t *testing.T) {
+	store := newMemoryCancelStore()
+	buffer := NewCancelBuffer(2)
+	buffer.store = store
+	for i, block := range []int64{10, 11} {
+		evt := &types.OrderCancelledEvent{OrderHash: common.BigToHash(big.NewInt(int64(i))), AmountCancelled: big.NewInt(100)}
+		evt.TxHash = common.BigToHash(big.NewInt(block))
+		evt.BlockNumber = big.NewInt(block)
+		evt.Status = types.TX_STATUS_SUCCESS
+		buffer.Add(evt)
+	}
+	if ready := buffer.Ready(big.NewInt(12)); len(ready) != 1 {
+		t.Fatalf("cancel at block 10 should be ready at block 12")
+	}
+	if len(store.events) != 1 {
+		t.Fatalf("confirmed cancel should be removed from store, got %d stored", len(store.events))
+	}
+
+	// 重启后从存储恢复未确认的cancel, 重复恢复不重复添加
+	restarted := NewCancelBuffer(2)
+	restarted.store = store
+	for i := 0; i < 2; i++ {
+		if err := restarted.Restore(); err != nil {
+			t.Fatalf("restore pending cancels error:%s", err.Error())
+		}
+	}
+	if restarted.Len() != 1 {
+		t.Fatalf("expect 1 pending cancel after restart, got %d", restarted.Len())
+	}
+	ready := restarted.Ready(big.NewInt(13))
+	if len(ready) != 1 || ready[0].BlockNumber.Int64() != 11 || ready[0].AmountCancelled.Int64() != 100 || ready[0].Status != types.TX_STATUS_SUCCESS {
+		t.Fatalf("restored cancel should be ready at block 13")
+	}
+	if len(store.events) != 0 {
+		t.Fatalf("store should be empty, got %d", len(store.events))
+	}
+}
+
+type memoryCancelStore struct {
+	events map[string][]byte
+}
+
+func newMemoryCancelStore() *memoryCancelStore {
+	return &memoryCancelStore{events: make(map[string][]byte)}
+}
+
+func (s *memoryCancelStore) save(evt *types.OrderCancelledEvent) error {
+	model := &dao.CancelEvent{}
+	model.ConvertDown(evt)
+	bs, err := json.Marshal(model)
+	if err != nil {
+		return err
+	}
+	s.events[string(pendingCancelField(evt))] = bs
+	return nil
+}
+
+func (s *memoryCancelStore) remove(list []*types.OrderCancelledEvent) error {
+	for _, v := range list {
+		delete(s.events, string(pendingCancelField(v)))
+	}
+	return nil
+}
+
+func (s *memoryCancelStore) load() ([]*types.OrderCancelledEvent, error) {
+	var list []*types.OrderCancelledEvent
+	for _, bs := range s.events {
+		model := &dao.CancelEvent{}
+		if err := json.Unmarshal(bs, model); err != nil {
+			return nil, err
+		}
+		evt := &types.OrderCancelledEvent{}
+		model.ConvertUp(evt)
+		evt.Status = types.TX_STATUS_SUCCESS
+		list = append(list, evt)
+	}
+	return list, nil
+}
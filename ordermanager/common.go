@@ -22,6 +22,7 @@ import (
 	"fmt"
 	"github.com/Loopring/relay/dao"
 	"github.com/Loopring/relay/ethaccessor"
+	"github.com/Loopring/relay/eventemiter"
 	"github.com/Loopring/relay/market/util"
 	"github.com/Loopring/relay/marketcap"
 	"github.com/Loopring/relay/types"
@@ -72,6 +73,7 @@ func newOrderEntity(state *types.OrderState, mc marketcap.MarketCapProvider, blo
 	if err != nil {
 		return nil, fmt.Errorf("order manager,newOrderEntity error:%s", err.Error())
 	}
+	util.CheckMarket(model.Market, state.RawOrder.TokenS, state.RawOrder.TokenB, "newOrder", types.NilHash)
 	model.ConvertDown(state)
 
 	return model, nil
@@ -183,3 +185,72 @@ func getCancelledAndDealtAmount(protocol common.Address, orderhash common.Hash,
 
 	return cancelled, dealt, nil
 }
+
+func isOrderTerminated(status types.OrderStatus) bool {
+	return status == types.ORDER_FINISHED || status == types.ORDER_CANCEL || status == types.ORDER_CUTOFF
+}
+
+// 订单进入终态时通知下游, 区分完全成交与带剩余量的移除
+func emitOrderConsumed(state *types.OrderState, reason string, blockNumber *big.Int) {
+	filledAmount, remainingAmount := filledAndRemainingAmount(state)
+
+	eventemitter.Emit(eventemitter.OrderConsumed, &types.OrderConsumedEvent{
+		OrderHash:       state.RawOrder.Hash,
+		FilledAmount:    filledAmount,
+		RemainingAmount: remainingAmount,
+		TerminalReason:  reason,
+		BlockNumber:     blockNumber,
+	})
+}
+
+// 订单由open首次进入部分成交
+func emitOrderPartiallyFilled(state *types.OrderState, txHash common.Hash, blockNumber *big.Int) {
+	filledAmount, remainingAmount := filledAndRemainingAmount(state)
+
+	eventemitter.Emit(eventemitter.OrderPartiallyFilled, &types.OrderPartiallyFilledEvent{
+		OrderHash:       state.RawOrder.Hash,
+		FilledAmount:    filledAmount,
+		RemainingAmount: remainingAmount,
+		TxHash:          txHash,
+		BlockNumber:     blockNumber,
+	})
+}
+
+// 成交关联relay存储的订单, 便于用订单id对账链上成交
+func emitTradeExecuted(model *dao.Order, event *types.OrderFilledEvent, side string) {
+	eventemitter.Emit(eventemitter.TradeExecuted, &types.TradeExecutedEvent{
+		OrderId:         model.ID,
+		OrderHash:       event.OrderHash,
+		OrderCreateTime: model.CreateTime,
+		OrderType:       model.OrderType,
+		WalletAddress:   common.HexToAddress(model.WalletAddress),
+		Owner:           common.HexToAddress(model.Owner),
+		Market:          model.Market,
+		Side:            side,
+		Ringhash:        event.Ringhash,
+		FillIndex:       event.FillIndex,
+		AmountS:         event.AmountS,
+		AmountB:         event.AmountB,
+		GrossAmountB:    event.GrossAmountB,
+		NetAmountB:      event.NetAmountB,
+		TxHash:          event.TxHash,
+		BlockNumber:     event.BlockNumber,
+		BlockTime:       event.BlockTime,
+	})
+}
+
+func filledAndRemainingAmount(state *types.OrderState) (*big.Int, *big.Int) {
+	filledS, filledB := state.DealtAndSplitAmount()
+
+	total, filled := state.RawOrder.AmountS, filledS
+	if state.RawOrder.BuyNoMoreThanAmountB {
+		total, filled = state.RawOrder.AmountB, filledB
+	}
+
+	filledAmount := new(big.Int).Quo(filled.Num(), filled.Denom())
+	remainingAmount := new(big.Int).Sub(total, filledAmount)
+	if remainingAmount.Sign() < 0 {
+		remainingAmount = big.NewInt(0)
+	}
+	return filledAmount, remainingAmount
+}
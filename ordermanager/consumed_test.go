@@ -0,0 +1,148 @@
+/*
+
+  Copyright 2017 Loopring Project Ltd (Loopring Foundation).
+
+  Licensed under the Apache License, Version 2.0 (the "License");
+  you may not use this file except in compliance with the License.
+  You may obtain a copy of the License at
+
+  http://www.apache.org/licenses/LICENSE-2.0
+
+  Unless required by applicable law or agreed to in writing, software
+  distributed under the License is distributed on an "AS IS" BASIS,
+  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+  See the License for the specific language governing permissions and
+  limitations under the License.
+
+*/
+
+package ordermanager_test
+
+import (
+	"errors"
+	"github.com/Loopring/relay/config"
+	"github.com/Loopring/relay/crypto"
+	"github.com/Loopring/relay/dao"
+	"github.com/Loopring/relay/eventemiter"
+	"github.com/Loopring/relay/log"
+	"github.com/Loopring/relay/marketcap"
+	"github.com/Loopring/relay/ordermanager"
+	"github.com/Loopring/relay/types"
+	"github.com/ethereum/go-ethereum/common"
+	"go.uber.org/zap"
+	"math/big"
+	"testing"
+)
+
+type consumedRdsService struct {
+	dao.RdsService
+	order *dao.Order
+}
+
+func (s *consumedRdsService) GetCancelEvent(txhash common.Hash) (dao.CancelEvent, error) {
+	return dao.CancelEvent{}, errors.New("not found")
+}
+
+func (s *consumedRdsService) GetOpenOrders() ([]dao.Order, error) {
+	return nil, nil
+}
+
+func (s *consumedRdsService) Add(item interface{}) error {
+	return nil
+}
+
+func (s *consumedRdsService) GetOrderByHash(orderhash common.Hash) (*dao.Order, error) {
+	order := *s.order
+	return &order, nil
+}
+
+func (s *consumedRdsService) UpdateOrderWhileCancel(hash common.Hash, status types.OrderStatus, cancelledAmountS, cancelledAmountB *big.Int, blockNumber *big.Int) error {
+	s.order.Status = uint8(status)
+	s.order.CancelledAmountS = cancelledAmountS.String()
+	s.order.CancelledAmountB = cancelledAmountB.String()
+	return nil
+}
+
+func (s *consumedRdsService) UpdateOrderLifecycle(hash common.Hash, firstFilledTime, removedTime int64) error {
+	return nil
+}
+
+// 按数量计价, 剩余量为0时视为灰尘
+type amountMarketCap struct {
+	marketcap.MarketCapProvider
+}
+
+func (mc *amountMarketCap) LegalCurrencyValue(tokenAddress common.Address, amount *big.Rat) (*big.Rat, error) {
+	return amount, nil
+}
+
+func partialFilledOrder() *dao.Order {
+	order := &dao.Order{
+		Protocol:         "0x456044789a41b277f033e4d79fab2139d69cd154",
+		DelegateAddress:  "0x17233e07c67d086464fD408148c3ABB56245FA64",
+		Owner:            "0x1b978a1D302335a6F2Ebe4B8823B5E17c3C84135",
+		TokenS:           "0xcd36128815ebe0b44d0374649bad2721b8751bef",
+		TokenB:           "0x88699e7fee2da0462981a08a15a3b940304cc516",
+		AmountS:          "1000",
+		AmountB:          "100",
+		LrcFee:           "0",
+		DealtAmountS:     "400",
+		DealtAmountB:     "40",
+		SplitAmountS:     "0",
+		SplitAmountB:     "0",
+		CancelledAmountS: "0",
+		CancelledAmountB: "0",
+		ValidSince:       1,
+		ValidUntil:       2,
+		Status:           uint8(types.ORDER_PARTIAL),
+	}
+
+	var state types.OrderState
+	order.ConvertUp(&state)
+	order.OrderHash = state.RawOrder.GenerateHash().Hex()
+	return order
+}
+
+func TestOrderManagerImpl_OrderConsumedAfterCancel(t *testing.T) {
+	zapOpts := zap.NewDevelopmentConfig()
+	zapOpts.Level = zap.NewAtomicLevelAt(zap.ErrorLevel)
+	log.Initialize(config.LogOptions{ZapOpts: zapOpts})
+	crypto.Initialize(crypto.NewKSCrypto(true, nil))
+
+	db := &consumedRdsService{order: partialFilledOrder()}
+	om := ordermanager.NewOrderManager(&config.OrderManagerOptions{DustOrderValue: 0}, db, nil, &amountMarketCap{})
+	om.Start()
+	defer om.Stop()
+
+	var consumed []*types.OrderConsumedEvent
+	watcher := &eventemitter.Watcher{Concurrent: false, Handle: func(input eventemitter.EventData) error {
+		consumed = append(consumed, input.(*types.OrderConsumedEvent))
+		return nil
+	}}
+	eventemitter.On(eventemitter.OrderConsumed, watcher)
+	defer eventemitter.Un(eventemitter.OrderConsumed, watcher)
+
+	cancel := &types.OrderCancelledEvent{OrderHash: common.HexToHash(db.order.OrderHash), AmountCancelled: big.NewInt(600)}
+	cancel.Status = types.TX_STATUS_SUCCESS
+	cancel.BlockNumber = big.NewInt(100)
+	cancel.TxHash = common.HexToHash("0x01")
+	eventemitter.Emit(eventemitter.CancelOrder, cancel)
+
+	if db.order.Status != uint8(types.ORDER_CANCEL) {
+		t.Fatalf("order status should be cancelled, got %d", db.order.Status)
+	}
+	if len(consumed) != 1 {
+		t.Fatalf("expect 1 order consumed event, got %d", len(consumed))
+	}
+
+	evt := consumed[0]
+	if evt.OrderHash.Hex() != db.order.OrderHash {
+		t.Fatalf("consumed order hash %s should be %s", evt.OrderHash.Hex(), db.order.OrderHash)
+	}
+	if evt.TerminalReason != types.ORDER_CONSUMED_CANCELLED {
+		t.Fatalf("terminal reason should be %s, got %s", types.ORDER_CONSUMED_CANCELLED, evt.TerminalReason)
+	}
+	if evt.FilledAmount.Cmp(big.NewInt(400)) != 0 || evt.RemainingAmount.Cmp(big.NewInt(600)) != 0 {
+		t.Fatalf("filled/remaining should be 400/600, got %s/%s", evt.FilledAmount.String(), evt.RemainingAmount.String())
+	}
+}
@@ -0,0 +1,93 @@
+/*
+
+  Copyright 2017 Loopring Project Ltd (Loopring Foundation).
+
+  Licensed under the Apache License, Version 2.0 (the "License");
+  you may not use this file except in compliance with the License.
+  You may obtain a copy of the License at
+
+  http://www.apache.org/licenses/LICENSE-2.0
+
+  Unless required by applicable law or agreed to in writing, software
+  distributed under the License is distributed on an "AS IS" BASIS,
+  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+  See the License for the specific language governing permissions and
+  limitations under the License.
+
+*/
+
+package ordermanager_test
+
+import (
+	"github.com/Loopring/relay/config"
+	"github.com/Loopring/relay/dao"
+	"github.com/Loopring/relay/ordermanager"
+	"github.com/ethereum/go-ethereum/common"
+	"testing"
+)
+
+type fillsRdsService struct {
+	dao.RdsService
+	orders []dao.Order
+	fills  []dao.FillEvent
+}
+
+func (s *fillsRdsService) GetFillsByOwner(owner string, start, end int64) ([]dao.FillEvent, error) {
+	hashes := make(map[string]bool)
+	for _, v := range s.orders {
+		if v.Owner == owner {
+			hashes[v.OrderHash] = true
+		}
+	}
+
+	var list []dao.FillEvent
+	for _, v := range s.fills {
+		if !hashes[v.OrderHash] || v.CreateTime < start || (end != 0 && v.CreateTime > end) {
+			continue
+		}
+		list = append(list, v)
+	}
+	return list, nil
+}
+
+func TestOrderManagerImpl_FillsForOwner(t *testing.T) {
+	owner := common.HexToAddress("0x1b978a1D302335a6F2Ebe4B8823B5E17c3C84135")
+	other := common.HexToAddress("0xb1018949b241D76A1AB2094f473E9bEfeAbB5Ead")
+
+	lrcOrder := common.HexToHash("0x01").Hex()
+	rdnOrder := common.HexToHash("0x02").Hex()
+	otherOrder := common.HexToHash("0x03").Hex()
+
+	db := &fillsRdsService{
+		orders: []dao.Order{
+			{Owner: owner.Hex(), OrderHash: lrcOrder, Market: "LRC-WETH"},
+			{Owner: owner.Hex(), OrderHash: rdnOrder, Market: "RDN-WETH"},
+			{Owner: other.Hex(), OrderHash: otherOrder, Market: "LRC-WETH"},
+		},
+		fills: []dao.FillEvent{
+			{OrderHash: lrcOrder, Owner: owner.Hex(), Market: "LRC-WETH", AmountS: "100", CreateTime: 10},
+			{OrderHash: rdnOrder, Owner: owner.Hex(), Market: "RDN-WETH", AmountS: "200", CreateTime: 20},
+			{OrderHash: otherOrder, Owner: other.Hex(), Market: "LRC-WETH", AmountS: "300", CreateTime: 30},
+		},
+	}
+
+	om := ordermanager.NewOrderManager(&config.OrderManagerOptions{}, db, nil, nil)
+	fills, err := om.FillsForOwner(owner, 0, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(fills) != 2 {
+		t.Fatalf("expect 2 fills for owner, got %d", len(fills))
+	}
+
+	markets := make(map[string]bool)
+	for _, v := range fills {
+		if v.Owner != owner {
+			t.Fatalf("fill owner %s should be %s", v.Owner.Hex(), owner.Hex())
+		}
+		markets[v.Market] = true
+	}
+	if !markets["LRC-WETH"] || !markets["RDN-WETH"] {
+		t.Fatalf("fills should cover both markets, got %v", markets)
+	}
+}
@@ -24,6 +24,7 @@ import (
 	"github.com/Loopring/relay/log"
 	"github.com/Loopring/relay/marketcap"
 	"github.com/Loopring/relay/types"
+	"github.com/ethereum/go-ethereum/common"
 	"math/big"
 	"sort"
 )
@@ -240,6 +241,8 @@ func (p *ForkProcessor) GetForkEvents(from, to int64) (InnerForkEventList, error
 			)
 			v.ConvertUp(&fill)
 			innerEvt.LogIndex = fill.TxLogIndex
+			innerEvt.TxIndex = fill.TxIndex
+			innerEvt.TxHash = fill.TxHash
 			innerEvt.BlockNumber = fill.BlockNumber.Int64()
 			innerEvt.Type = FORK_EVT_TYPE_FILL
 			innerEvt.Event = &fill
@@ -255,6 +258,8 @@ func (p *ForkProcessor) GetForkEvents(from, to int64) (InnerForkEventList, error
 			)
 			v.ConvertUp(&cancel)
 			innerEvt.LogIndex = cancel.TxLogIndex
+			innerEvt.TxIndex = cancel.TxIndex
+			innerEvt.TxHash = cancel.TxHash
 			innerEvt.BlockNumber = cancel.BlockNumber.Int64()
 			innerEvt.Type = FORK_EVT_TYPE_CANCEL
 			innerEvt.Event = &cancel
@@ -270,6 +275,8 @@ func (p *ForkProcessor) GetForkEvents(from, to int64) (InnerForkEventList, error
 			)
 			v.ConvertUp(&cutoff)
 			innerEvt.LogIndex = cutoff.TxLogIndex
+			innerEvt.TxIndex = cutoff.TxIndex
+			innerEvt.TxHash = cutoff.TxHash
 			innerEvt.BlockNumber = cutoff.BlockNumber.Int64()
 			innerEvt.Type = FORK_EVT_TYPE_CUTOFF
 			innerEvt.Event = &cutoff
@@ -285,6 +292,8 @@ func (p *ForkProcessor) GetForkEvents(from, to int64) (InnerForkEventList, error
 			)
 			v.ConvertUp(&cutoffPair)
 			innerEvt.LogIndex = cutoffPair.TxLogIndex
+			innerEvt.TxIndex = cutoffPair.TxIndex
+			innerEvt.TxHash = cutoffPair.TxHash
 			innerEvt.BlockNumber = cutoffPair.BlockNumber.Int64()
 			innerEvt.Type = FORK_EVT_TYPE_CUTOFF_PAIR
 			innerEvt.Event = &cutoffPair
@@ -298,10 +307,16 @@ func (p *ForkProcessor) GetForkEvents(from, to int64) (InnerForkEventList, error
 type InnerForkEvent struct {
 	Type        string
 	BlockNumber int64
+	TxIndex     int64
 	LogIndex    int64
+	TxHash      common.Hash
 	Event       interface{}
 }
 
+func (e InnerForkEvent) Position() types.EventPosition {
+	return types.EventPosition{BlockNumber: e.BlockNumber, TxIndex: e.TxIndex, LogIndex: e.LogIndex, TxHash: e.TxHash}
+}
+
 type InnerForkEventList []InnerForkEvent
 
 func (l InnerForkEventList) Len() int {
@@ -312,12 +327,9 @@ func (l InnerForkEventList) Swap(i, j int) {
 	l[i], l[j] = l[j], l[i]
 }
 
+// 回滚时后发生的事件先处理
 func (l InnerForkEventList) Less(i, j int) bool {
-	if l[i].BlockNumber == l[j].BlockNumber {
-		return l[i].LogIndex > l[j].LogIndex
-	} else {
-		return l[i].BlockNumber > l[j].BlockNumber
-	}
+	return l[j].Position().Less(l[i].Position())
 }
 
 func safeSub(x, y *big.Int) *big.Int {
@@ -22,7 +22,9 @@ import (
 	"github.com/Loopring/relay/ordermanager"
 	"github.com/Loopring/relay/test"
 	"github.com/Loopring/relay/types"
+	"github.com/ethereum/go-ethereum/common"
 	"math/big"
+	"math/rand"
 	"sort"
 	"testing"
 )
@@ -40,6 +42,34 @@ func TestInnerForkEventList_Sort(t *testing.T) {
 	}
 }
 
+func TestInnerForkEventList_SortTieBreak(t *testing.T) {
+	hash1 := common.HexToHash("0x01")
+	hash2 := common.HexToHash("0x02")
+
+	// 同一block同一logIndex, 不同tx/合约的事件
+	expect := ordermanager.InnerForkEventList{
+		{Type: ordermanager.FORK_EVT_TYPE_FILL, BlockNumber: 35, LogIndex: 3},
+		{Type: ordermanager.FORK_EVT_TYPE_CUTOFF, BlockNumber: 32, TxIndex: 2, LogIndex: 2, TxHash: hash1},
+		{Type: ordermanager.FORK_EVT_TYPE_CANCEL, BlockNumber: 32, TxIndex: 1, LogIndex: 2, TxHash: hash2},
+		{Type: ordermanager.FORK_EVT_TYPE_CUTOFF_PAIR, BlockNumber: 32, LogIndex: 2, TxHash: hash2},
+		{Type: ordermanager.FORK_EVT_TYPE_FILL, BlockNumber: 32, LogIndex: 2, TxHash: hash1},
+	}
+
+	for n := 0; n < 20; n++ {
+		list := make(ordermanager.InnerForkEventList, len(expect))
+		for i, j := range rand.Perm(len(expect)) {
+			list[i] = expect[j]
+		}
+		sort.Sort(list)
+
+		for i := range expect {
+			if list[i].Type != expect[i].Type || list[i].Position() != expect[i].Position() {
+				t.Fatalf("round %d index %d expect %s %+v, got %s %+v", n, i, expect[i].Type, expect[i].Position(), list[i].Type, list[i].Position())
+			}
+		}
+	}
+}
+
 func TestForkProcessor_RollBack(t *testing.T) {
 	db := test.Rds()
 	mc := test.GenerateMarketCap()
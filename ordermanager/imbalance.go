@@ -0,0 +1,155 @@
+/*
+
+  Copyright 2017 Loopring Project Ltd (Loopring Foundation).
+
+  Licensed under the Apache License, Version 2.0 (the "License");
+  you may not use this file except in compliance with the License.
+  You may obtain a copy of the License at
+
+  http://www.apache.org/licenses/LICENSE-2.0
+
+  Unless required by applicable law or agreed to in writing, software
+  distributed under the License is distributed on an "AS IS" BASIS,
+  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+  See the License for the specific language governing permissions and
+  limitations under the License.
+
+*/
+
+package ordermanager
+
+import (
+	"github.com/Loopring/relay/market/util"
+	"github.com/Loopring/relay/types"
+	"github.com/ethereum/go-ethereum/common"
+	"math/big"
+	"sync"
+	"time"
+)
+
+const (
+	defaultImbalanceWindow = 3600
+	minImbalanceFills      = 3 // 窗口内成交过少时不判断
+)
+
+type imbalanceRecord struct {
+	txhash    common.Hash
+	fillIndex int64
+	blockTime int64
+	side      string
+	volume    *big.Int // 以市场基础token计的成交量
+}
+
+// 按市场统计窗口内taker买入与卖出的成交量, 一侧占比超过threshold时发出信号
+type MarketImbalanceTracker struct {
+	mtx       sync.Mutex
+	window    int64
+	threshold float64
+	records   map[string][]imbalanceRecord
+	signaled  map[string]string // 已发出信号的一侧, 回落到threshold以下后清除
+	now       func() int64
+}
+
+func NewMarketImbalanceTracker(window int64, threshold float64) *MarketImbalanceTracker {
+	tracker := &MarketImbalanceTracker{}
+	tracker.window = window
+	if tracker.window <= 0 {
+		tracker.window = defaultImbalanceWindow
+	}
+	tracker.threshold = threshold
+	tracker.records = make(map[string][]imbalanceRecord)
+	tracker.signaled = make(map[string]string)
+	tracker.now = func() int64 { return time.Now().Unix() }
+
+	return tracker
+}
+
+// Add 记录一笔成交, 买卖任一侧占比首次达到threshold时返回imbalance事件.
+// 一个环路中maker与taker两侧成交量相同, 只统计taker的方向才能反映买卖压力
+func (t *MarketImbalanceTracker) Add(fill *types.OrderFilledEvent, side string) (*types.MarketImbalanceEvent, bool) {
+	if fill.Market == "" || (fill.Role != "" && fill.Role != types.FILL_ROLE_TAKER) {
+		return nil, false
+	}
+
+	var volume *big.Int
+	switch side {
+	case util.SideBuy:
+		volume = fill.AmountB
+	case util.SideSell:
+		volume = fill.AmountS
+	default:
+		return nil, false
+	}
+	if volume == nil || volume.Sign() <= 0 {
+		return nil, false
+	}
+
+	t.mtx.Lock()
+	defer t.mtx.Unlock()
+
+	var fillIndex int64
+	if fill.FillIndex != nil {
+		fillIndex = fill.FillIndex.Int64()
+	}
+
+	since := t.now() - t.window
+	buy, sell := big.NewInt(0), big.NewInt(0)
+	var list []imbalanceRecord
+	for _, v := range t.records[fill.Market] {
+		if v.txhash == fill.TxHash && v.fillIndex == fillIndex {
+			return nil, false
+		}
+		if v.blockTime < since {
+			continue
+		}
+		list = append(list, v)
+		if v.side == util.SideBuy {
+			buy.Add(buy, v.volume)
+		} else {
+			sell.Add(sell, v.volume)
+		}
+	}
+	if fill.BlockTime >= since {
+		list = append(list, imbalanceRecord{txhash: fill.TxHash, fillIndex: fillIndex, blockTime: fill.BlockTime, side: side, volume: new(big.Int).Set(volume)})
+		if side == util.SideBuy {
+			buy.Add(buy, volume)
+		} else {
+			sell.Add(sell, volume)
+		}
+	}
+	t.records[fill.Market] = list
+
+	total := new(big.Int).Add(buy, sell)
+	if len(list) < minImbalanceFills || total.Sign() == 0 {
+		delete(t.signaled, fill.Market)
+		return nil, false
+	}
+	buyRatio, _ := new(big.Rat).SetFrac(buy, total).Float64()
+
+	dominant := ""
+	if buyRatio >= t.threshold {
+		dominant = util.SideBuy
+	} else if 1-buyRatio >= t.threshold {
+		dominant = util.SideSell
+	}
+
+	if dominant == "" {
+		delete(t.signaled, fill.Market)
+		return nil, false
+	}
+	if t.signaled[fill.Market] == dominant {
+		return nil, false
+	}
+	t.signaled[fill.Market] = dominant
+
+	return &types.MarketImbalanceEvent{
+		Market:     fill.Market,
+		Side:       dominant,
+		BuyVolume:  buy,
+		SellVolume: sell,
+		BuyRatio:   buyRatio,
+		Window:     t.window,
+		TxHash:     fill.TxHash,
+		BlockTime:  fill.BlockTime,
+	}, true
+}
@@ -0,0 +1,106 @@
+/*
+
+  Copyright 2017 Loopring Project Ltd (Loopring Foundation).
+
+  Licensed under the Apache License, Version 2.0 (the "License");
+  you may not use this file except in compliance with the License.
+  You may obtain a copy of the License at
+
+  http://www.apache.org/licenses/LICENSE-2.0
+
+  Unless required by applicable law or agreed to in writing, software
+  distributed under the License is distributed on an "AS IS" BASIS,
+  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+  See the License for the specific language governing permissions and
+  limitations under the License.
+
+*/
+
+package ordermanager
+
+import (
+	"github.com/Loopring/relay/config"
+	"github.com/Loopring/relay/eventemiter"
+	"github.com/Loopring/relay/log"
+	"github.com/Loopring/relay/market/util"
+	"github.com/Loopring/relay/types"
+	"github.com/ethereum/go-ethereum/common"
+	"go.uber.org/zap"
+	"math/big"
+	"testing"
+)
+
+func TestOrderManagerImpl_MarketImbalance(t *testing.T) {
+	zapOpts := zap.NewDevelopmentConfig()
+	zapOpts.Level = zap.NewAtomicLevelAt(zap.ErrorLevel)
+	log.Initialize(config.LogOptions{ZapOpts: zapOpts})
+
+	om := NewOrderManager(&config.OrderManagerOptions{ImbalanceWindow: 600, ImbalanceThreshold: 0.75}, nil, nil, nil)
+	now := int64(1520000000)
+	om.imbalance.now = func() int64 { return now }
+
+	var signals []*types.MarketImbalanceEvent
+	watcher := &eventemitter.Watcher{Concurrent: false, Handle: func(input eventemitter.EventData) error {
+		signals = append(signals, input.(*types.MarketImbalanceEvent))
+		return nil
+	}}
+	eventemitter.On(eventemitter.MarketImbalance, watcher)
+	defer eventemitter.Un(eventemitter.MarketImbalance, watcher)
+
+	var index int64
+	fill := func(side, role string, amount int64) *types.OrderFilledEvent {
+		index++
+		evt := &types.OrderFilledEvent{Market: "LRC-WETH", Role: role, FillIndex: big.NewInt(index), AmountS: big.NewInt(0), AmountB: big.NewInt(0)}
+		if side == util.SideBuy {
+			evt.AmountB = big.NewInt(amount)
+		} else {
+			evt.AmountS = big.NewInt(amount)
+		}
+		evt.TxHash = common.HexToHash("0x01")
+		evt.BlockTime = now
+		om.recordImbalance(evt, side)
+		return evt
+	}
+
+	fill(util.SideSell, types.FILL_ROLE_TAKER, 100)
+	fill(util.SideBuy, types.FILL_ROLE_TAKER, 100)
+	if len(signals) != 0 {
+		t.Fatalf("too few fills should not signal, got %d", len(signals))
+	}
+
+	// maker一侧不计入
+	fill(util.SideSell, types.FILL_ROLE_MAKER, 1000)
+	last := fill(util.SideBuy, types.FILL_ROLE_TAKER, 200)
+	if len(signals) != 1 {
+		t.Fatalf("buy ratio reached threshold, expect 1 signal, got %d", len(signals))
+	}
+	if s := signals[0]; s.Market != "LRC-WETH" || s.Side != util.SideBuy || s.BuyVolume.Int64() != 300 || s.SellVolume.Int64() != 100 || s.BuyRatio != 0.75 {
+		t.Fatalf("unexpected signal market:%s side:%s buy:%s sell:%s ratio:%f", s.Market, s.Side, s.BuyVolume, s.SellVolume, s.BuyRatio)
+	}
+
+	// 同一成交重复处理, 以及持续同侧成交都不重复发出
+	om.recordImbalance(last, util.SideBuy)
+	fill(util.SideBuy, types.FILL_ROLE_TAKER, 100)
+	if len(signals) != 1 {
+		t.Fatalf("signal should fire once while imbalance lasts, got %d", len(signals))
+	}
+
+	// 回落后再次失衡
+	fill(util.SideSell, types.FILL_ROLE_TAKER, 600)
+	fill(util.SideSell, types.FILL_ROLE_TAKER, 1300)
+	if len(signals) != 2 || signals[1].Side != util.SideSell {
+		t.Fatalf("expect sell imbalance after sell pressure, got %d signals", len(signals))
+	}
+
+	// 窗口外的成交不再计入
+	now += 601
+	fill(util.SideBuy, types.FILL_ROLE_TAKER, 100)
+	fill(util.SideBuy, types.FILL_ROLE_TAKER, 100)
+	if len(signals) != 2 {
+		t.Fatalf("expired fills should be dropped, got %d signals", len(signals))
+	}
+	fill(util.SideBuy, types.FILL_ROLE_TAKER, 100)
+	if len(signals) != 3 || signals[2].SellVolume.Sign() != 0 {
+		t.Fatalf("expect buy imbalance within new window, got %d signals", len(signals))
+	}
+}
@@ -0,0 +1,103 @@
+/*
+
+  Copyright 2017 Loopring Project Ltd (Loopring Foundation).
+
+  Licensed under the Apache License, Version 2.0 (the "License");
+  you may not use this file except in compliance with the License.
+  You may obtain a copy of the License at
+
+  http://www.apache.org/licenses/LICENSE-2.0
+
+  Unless required by applicable law or agreed to in writing, software
+  distributed under the License is distributed on an "AS IS" BASIS,
+  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+  See the License for the specific language governing permissions and
+  limitations under the License.
+
+*/
+
+package ordermanager
+
+import (
+	"github.com/Loopring/relay/config"
+	"github.com/Loopring/relay/crypto"
+	"github.com/Loopring/relay/dao"
+	"github.com/Loopring/relay/log"
+	"github.com/Loopring/relay/types"
+	"github.com/ethereum/go-ethereum/common"
+	"go.uber.org/zap"
+	"math/big"
+	"testing"
+	"time"
+)
+
+func TestOrderManagerImpl_OrderLifecycle(t *testing.T) {
+	zapOpts := zap.NewDevelopmentConfig()
+	zapOpts.Level = zap.NewAtomicLevelAt(zap.ErrorLevel)
+	log.Initialize(config.LogOptions{ZapOpts: zapOpts})
+	crypto.Initialize(crypto.NewKSCrypto(true, nil))
+
+	// 下单
+	order := newOpenOrder("LRC-WETH", 1000, time.Now().Unix()+3600)
+	order.CreateTime = 1520000000
+	orderhash := common.HexToHash(order.OrderHash)
+	db := &openOrdersRdsService{orders: map[common.Hash]*dao.Order{orderhash: order}}
+
+	om := NewOrderManager(&config.OrderManagerOptions{DustOrderValue: 0}, db, nil, &openOrdersMarketCap{})
+	om.Start()
+	defer om.Stop()
+
+	lifecycle, err := om.OrderLifecycle(orderhash)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if lifecycle.CreateTime != 1520000000 || lifecycle.FirstFilledTime != 0 || lifecycle.RemovedTime != 0 {
+		t.Fatalf("open order should only have create time, got %v", lifecycle)
+	}
+
+	// 两次部分成交, 只记录首次成交的区块时间
+	for i, blockTime := range []int64{1520000100, 1520000200} {
+		fill := &types.OrderFilledEvent{
+			OrderHash: orderhash,
+			AmountS:   big.NewInt(100),
+			AmountB:   big.NewInt(10),
+			SplitS:    big.NewInt(0),
+			SplitB:    big.NewInt(0),
+			LrcReward: big.NewInt(0),
+			LrcFee:    big.NewInt(0),
+			RingIndex: big.NewInt(1),
+			FillIndex: big.NewInt(int64(i)),
+		}
+		fill.Status = types.TX_STATUS_SUCCESS
+		fill.TxHash = common.HexToHash("0x01")
+		fill.BlockNumber = big.NewInt(100 + int64(i))
+		fill.BlockTime = blockTime
+		if err := om.handleOrderFilled(fill); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// 取消剩余部分
+	cancel := &types.OrderCancelledEvent{OrderHash: orderhash, AmountCancelled: big.NewInt(800)}
+	cancel.Status = types.TX_STATUS_SUCCESS
+	cancel.TxHash = common.HexToHash("0x02")
+	cancel.BlockNumber = big.NewInt(110)
+	cancel.BlockTime = 1520000300
+	if err := om.handleOrderCancelled(cancel); err != nil {
+		t.Fatal(err)
+	}
+
+	lifecycle, err = om.OrderLifecycle(orderhash)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if lifecycle.OrderHash != orderhash || lifecycle.CreateTime != 1520000000 {
+		t.Errorf("unexpected order %s create time %d", lifecycle.OrderHash.Hex(), lifecycle.CreateTime)
+	}
+	if lifecycle.FirstFilledTime != 1520000100 {
+		t.Errorf("expect first filled time 1520000100, got %d", lifecycle.FirstFilledTime)
+	}
+	if lifecycle.RemovedTime != 1520000300 {
+		t.Errorf("expect removed time 1520000300, got %d", lifecycle.RemovedTime)
+	}
+}
@@ -0,0 +1,100 @@
+/*
+
+  Copyright 2017 Loopring Project Ltd (Loopring Foundation).
+
+  Licensed under the Apache License, Version 2.0 (the "License");
+  you may not use this file except in compliance with the License.
+  You may obtain a copy of the License at
+
+  http://www.apache.org/licenses/LICENSE-2.0
+
+  Unless required by applicable law or agreed to in writing, software
+  distributed under the License is distributed on an "AS IS" BASIS,
+  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+  See the License for the specific language governing permissions and
+  limitations under the License.
+
+*/
+
+package ordermanager
+
+import (
+	"github.com/Loopring/relay/dao"
+	"github.com/ethereum/go-ethereum/common"
+	"sync"
+	"time"
+)
+
+// 按市场统计挂单数, 记录validUntil以便过期订单在查询时剔除
+type OpenOrderCounter struct {
+	mtx     sync.Mutex
+	markets map[string]map[common.Hash]int64
+	orders  map[common.Hash]string
+	now     func() int64
+}
+
+func NewOpenOrderCounter() *OpenOrderCounter {
+	counter := &OpenOrderCounter{}
+	counter.markets = make(map[string]map[common.Hash]int64)
+	counter.orders = make(map[common.Hash]string)
+	counter.now = func() int64 { return time.Now().Unix() }
+
+	return counter
+}
+
+// 从数据库重建, order manager每次启动(包括分叉后重启)都会调用
+func (c *OpenOrderCounter) Reload(orders []dao.Order) {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+
+	c.markets = make(map[string]map[common.Hash]int64)
+	c.orders = make(map[common.Hash]string)
+	for _, v := range orders {
+		c.add(v.Market, common.HexToHash(v.OrderHash), v.ValidUntil)
+	}
+}
+
+func (c *OpenOrderCounter) Add(market string, orderhash common.Hash, validUntil int64) {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+
+	c.add(market, orderhash, validUntil)
+}
+
+func (c *OpenOrderCounter) add(market string, orderhash common.Hash, validUntil int64) {
+	if _, ok := c.orders[orderhash]; ok {
+		return
+	}
+	if _, ok := c.markets[market]; !ok {
+		c.markets[market] = make(map[common.Hash]int64)
+	}
+	c.markets[market][orderhash] = validUntil
+	c.orders[orderhash] = market
+}
+
+func (c *OpenOrderCounter) Remove(orderhash common.Hash) {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+
+	market, ok := c.orders[orderhash]
+	if !ok {
+		return
+	}
+	delete(c.orders, orderhash)
+	delete(c.markets[market], orderhash)
+}
+
+func (c *OpenOrderCounter) Count(market string) int {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+
+	now := c.now()
+	for orderhash, validUntil := range c.markets[market] {
+		if validUntil < now {
+			delete(c.markets[market], orderhash)
+			delete(c.orders, orderhash)
+		}
+	}
+
+	return len(c.markets[market])
+}
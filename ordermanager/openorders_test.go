@@ -0,0 +1,223 @@
+/*
+
+  Copyright 2017 Loopring Project Ltd (Loopring Foundation).
+
+  Licensed under the Apache License, Version 2.0 (the "License");
+  you may not use this file except in compliance with the License.
+  You may obtain a copy of the License at
+
+  http://www.apache.org/licenses/LICENSE-2.0
+
+  Unless required by applicable law or agreed to in writing, software
+  distributed under the License is distributed on an "AS IS" BASIS,
+  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+  See the License for the specific language governing permissions and
+  limitations under the License.
+
+*/
+
+package ordermanager
+
+import (
+	"errors"
+	"github.com/Loopring/relay/config"
+	"github.com/Loopring/relay/crypto"
+	"github.com/Loopring/relay/dao"
+	"github.com/Loopring/relay/log"
+	"github.com/Loopring/relay/marketcap"
+	"github.com/Loopring/relay/types"
+	"github.com/ethereum/go-ethereum/common"
+	"go.uber.org/zap"
+	"math/big"
+	"testing"
+	"time"
+)
+
+type openOrdersRdsService struct {
+	dao.RdsService
+	orders map[common.Hash]*dao.Order
+}
+
+func (s *openOrdersRdsService) GetOpenOrders() ([]dao.Order, error) {
+	var list []dao.Order
+	for _, v := range s.orders {
+		if v.Status == uint8(types.ORDER_NEW) || v.Status == uint8(types.ORDER_PARTIAL) {
+			list = append(list, *v)
+		}
+	}
+	return list, nil
+}
+
+func (s *openOrdersRdsService) GetOrderByHash(orderhash common.Hash) (*dao.Order, error) {
+	order, ok := s.orders[orderhash]
+	if !ok {
+		return nil, errors.New("order not found")
+	}
+	copied := *order
+	return &copied, nil
+}
+
+func (s *openOrdersRdsService) FindFillEvent(txhash string, FillIndex int64) (*dao.FillEvent, error) {
+	return nil, errors.New("not found")
+}
+
+func (s *openOrdersRdsService) GetCancelEvent(txhash common.Hash) (dao.CancelEvent, error) {
+	return dao.CancelEvent{}, errors.New("not found")
+}
+
+func (s *openOrdersRdsService) Add(item interface{}) error {
+	return nil
+}
+
+func (s *openOrdersRdsService) UpdateOrderWhileFill(hash common.Hash, status types.OrderStatus, dealtAmountS, dealtAmountB, splitAmountS, splitAmountB, blockNumber *big.Int) error {
+	s.orders[hash].Status = uint8(status)
+	s.orders[hash].DealtAmountS = dealtAmountS.String()
+	s.orders[hash].DealtAmountB = dealtAmountB.String()
+	return nil
+}
+
+func (s *openOrdersRdsService) UpdateOrderWhileCancel(hash common.Hash, status types.OrderStatus, cancelledAmountS, cancelledAmountB, blockNumber *big.Int) error {
+	s.orders[hash].Status = uint8(status)
+	s.orders[hash].CancelledAmountS = cancelledAmountS.String()
+	s.orders[hash].CancelledAmountB = cancelledAmountB.String()
+	return nil
+}
+
+func (s *openOrdersRdsService) UpdateOrderLifecycle(hash common.Hash, firstFilledTime, removedTime int64) error {
+	if firstFilledTime > 0 {
+		s.orders[hash].FirstFilledTime = firstFilledTime
+	}
+	if removedTime > 0 {
+		s.orders[hash].RemovedTime = removedTime
+	}
+	return nil
+}
+
+// 按数量计价, 剩余量为0时视为灰尘
+type openOrdersMarketCap struct {
+	marketcap.MarketCapProvider
+}
+
+func (mc *openOrdersMarketCap) LegalCurrencyValue(tokenAddress common.Address, amount *big.Rat) (*big.Rat, error) {
+	return amount, nil
+}
+
+func newOpenOrder(market string, amountS int64, validUntil int64) *dao.Order {
+	order := &dao.Order{
+		Protocol:         "0x456044789a41b277f033e4d79fab2139d69cd154",
+		DelegateAddress:  "0x17233e07c67d086464fD408148c3ABB56245FA64",
+		Owner:            "0x1b978a1D302335a6F2Ebe4B8823B5E17c3C84135",
+		TokenS:           "0xcd36128815ebe0b44d0374649bad2721b8751bef",
+		TokenB:           "0x88699e7fee2da0462981a08a15a3b940304cc516",
+		AmountS:          big.NewInt(amountS).String(),
+		AmountB:          "100",
+		LrcFee:           "0",
+		DealtAmountS:     "0",
+		DealtAmountB:     "0",
+		SplitAmountS:     "0",
+		SplitAmountB:     "0",
+		CancelledAmountS: "0",
+		CancelledAmountB: "0",
+		ValidSince:       1,
+		ValidUntil:       validUntil,
+		Market:           market,
+		Status:           uint8(types.ORDER_NEW),
+	}
+
+	var state types.OrderState
+	order.ConvertUp(&state)
+	order.OrderHash = state.RawOrder.GenerateHash().Hex()
+	return order
+}
+
+func TestOpenOrderCounter(t *testing.T) {
+	counter := NewOpenOrderCounter()
+	validUntil := time.Now().Unix() + 3600
+
+	counter.Add("LRC-WETH", common.HexToHash("0x01"), validUntil)
+	counter.Add("LRC-WETH", common.HexToHash("0x02"), validUntil)
+	counter.Add("LRC-WETH", common.HexToHash("0x02"), validUntil)
+	counter.Add("RDN-WETH", common.HexToHash("0x03"), validUntil)
+	counter.Add("RDN-WETH", common.HexToHash("0x04"), time.Now().Unix()-1)
+
+	if cnt := counter.Count("LRC-WETH"); cnt != 2 {
+		t.Fatalf("LRC-WETH should have 2 open orders, got %d", cnt)
+	}
+	// 过期订单不计入
+	if cnt := counter.Count("RDN-WETH"); cnt != 1 {
+		t.Fatalf("RDN-WETH should have 1 open order, got %d", cnt)
+	}
+
+	counter.Remove(common.HexToHash("0x01"))
+	counter.Remove(common.HexToHash("0x01"))
+	if cnt := counter.Count("LRC-WETH"); cnt != 1 {
+		t.Fatalf("LRC-WETH should have 1 open order after remove, got %d", cnt)
+	}
+}
+
+func TestOrderManagerImpl_OpenOrderCount(t *testing.T) {
+	zapOpts := zap.NewDevelopmentConfig()
+	zapOpts.Level = zap.NewAtomicLevelAt(zap.ErrorLevel)
+	log.Initialize(config.LogOptions{ZapOpts: zapOpts})
+	crypto.Initialize(crypto.NewKSCrypto(true, nil))
+
+	validUntil := time.Now().Unix() + 3600
+	filled := newOpenOrder("LRC-WETH", 1000, validUntil)
+	partial := newOpenOrder("LRC-WETH", 2000, validUntil)
+	cancelled := newOpenOrder("RDN-WETH", 3000, validUntil)
+
+	db := &openOrdersRdsService{orders: make(map[common.Hash]*dao.Order)}
+	for _, v := range []*dao.Order{filled, partial, cancelled} {
+		db.orders[common.HexToHash(v.OrderHash)] = v
+	}
+
+	om := NewOrderManager(&config.OrderManagerOptions{DustOrderValue: 0}, db, nil, &openOrdersMarketCap{})
+	om.Start()
+	defer om.Stop()
+
+	if om.OpenOrderCount("LRC-WETH") != 2 || om.OpenOrderCount("RDN-WETH") != 1 {
+		t.Fatalf("open orders should be loaded on start, got LRC-WETH:%d RDN-WETH:%d", om.OpenOrderCount("LRC-WETH"), om.OpenOrderCount("RDN-WETH"))
+	}
+
+	fill := func(order *dao.Order, amountS int64, fillIndex int64) {
+		evt := &types.OrderFilledEvent{
+			OrderHash: common.HexToHash(order.OrderHash),
+			AmountS:   big.NewInt(amountS),
+			AmountB:   big.NewInt(0),
+			SplitS:    big.NewInt(0),
+			SplitB:    big.NewInt(0),
+			LrcReward: big.NewInt(0),
+			LrcFee:    big.NewInt(0),
+			RingIndex: big.NewInt(1),
+			FillIndex: big.NewInt(fillIndex),
+		}
+		evt.Status = types.TX_STATUS_SUCCESS
+		evt.BlockNumber = big.NewInt(100)
+		if err := om.handleOrderFilled(evt); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	fill(filled, 1000, 0)
+	if cnt := om.OpenOrderCount("LRC-WETH"); cnt != 1 {
+		t.Fatalf("fully filled order should leave the book, LRC-WETH got %d", cnt)
+	}
+
+	fill(partial, 500, 1)
+	if cnt := om.OpenOrderCount("LRC-WETH"); cnt != 1 {
+		t.Fatalf("partially filled order should stay open, LRC-WETH got %d", cnt)
+	}
+
+	cancel := &types.OrderCancelledEvent{OrderHash: common.HexToHash(cancelled.OrderHash), AmountCancelled: big.NewInt(3000)}
+	cancel.Status = types.TX_STATUS_SUCCESS
+	cancel.BlockNumber = big.NewInt(101)
+	if err := om.handleOrderCancelled(cancel); err != nil {
+		t.Fatal(err)
+	}
+	if cnt := om.OpenOrderCount("RDN-WETH"); cnt != 0 {
+		t.Fatalf("cancelled order should leave the book, RDN-WETH got %d", cnt)
+	}
+	if cnt := om.OpenOrderCount("LRC-WETH"); cnt != 1 {
+		t.Fatalf("cancel in another market shouldn't change LRC-WETH, got %d", cnt)
+	}
+}
@@ -0,0 +1,113 @@
+/*
+
+  Copyright 2017 Loopring Project Ltd (Loopring Foundation).
+
+  Licensed under the Apache License, Version 2.0 (the "License");
+  you may not use this file except in compliance with the License.
+  You may obtain a copy of the License at
+
+  http://www.apache.org/licenses/LICENSE-2.0
+
+  Unless required by applicable law or agreed to in writing, software
+  distributed under the License is distributed on an "AS IS" BASIS,
+  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+  See the License for the specific language governing permissions and
+  limitations under the License.
+
+*/
+
+package ordermanager
+
+import (
+	"github.com/Loopring/relay/market/util"
+	"github.com/Loopring/relay/types"
+	"math/big"
+	"sort"
+)
+
+// OrderBookLevel 同一价格的挂单汇总, 数量均为链上原始精度, price为每单位base的quote数量
+type OrderBookLevel struct {
+	Price  *big.Rat
+	Amount *big.Rat // 剩余base数量
+	Size   *big.Rat // 剩余quote数量
+	Orders int
+}
+
+// OrderBook 由未成交订单重建的市场深度, bids价格从高到低, asks价格从低到高
+type OrderBook struct {
+	Market string
+	Bids   []*OrderBookLevel
+	Asks   []*OrderBookLevel
+}
+
+func buildOrderBook(market string, states []types.OrderState, depth int) *OrderBook {
+	base, _ := util.UnWrap(market)
+	baseAddress := util.AliasToAddress(base)
+
+	bids := make(map[string]*OrderBookLevel)
+	asks := make(map[string]*OrderBookLevel)
+	for i := range states {
+		ord := states[i].RawOrder
+		if ord.AmountS == nil || ord.AmountB == nil || ord.AmountS.Sign() <= 0 || ord.AmountB.Sign() <= 0 {
+			continue
+		}
+		remainS, remainB := states[i].RemainedAmount()
+		if remainS.Sign() <= 0 || remainB.Sign() <= 0 {
+			continue
+		}
+
+		var (
+			levels        map[string]*OrderBookLevel
+			price         *big.Rat
+			amount, quote *big.Rat
+		)
+		switch baseAddress {
+		case ord.TokenS:
+			// 卖出base
+			levels = asks
+			price = new(big.Rat).SetFrac(ord.AmountB, ord.AmountS)
+			amount, quote = remainS, remainB
+		case ord.TokenB:
+			// 买入base
+			levels = bids
+			price = new(big.Rat).SetFrac(ord.AmountS, ord.AmountB)
+			amount, quote = remainB, remainS
+		default:
+			continue
+		}
+
+		key := price.RatString()
+		level, ok := levels[key]
+		if !ok {
+			level = &OrderBookLevel{Price: price, Amount: new(big.Rat), Size: new(big.Rat)}
+			levels[key] = level
+		}
+		level.Amount.Add(level.Amount, amount)
+		level.Size.Add(level.Size, quote)
+		level.Orders++
+	}
+
+	return &OrderBook{
+		Market: market,
+		Bids:   sortBookLevels(bids, depth, true),
+		Asks:   sortBookLevels(asks, depth, false),
+	}
+}
+
+func sortBookLevels(levels map[string]*OrderBookLevel, depth int, desc bool) []*OrderBookLevel {
+	list := make([]*OrderBookLevel, 0, len(levels))
+	for _, v := range levels {
+		list = append(list, v)
+	}
+	sort.Slice(list, func(i, j int) bool {
+		if desc {
+			return list[i].Price.Cmp(list[j].Price) > 0
+		}
+		return list[i].Price.Cmp(list[j].Price) < 0
+	})
+
+	if depth > 0 && len(list) > depth {
+		list = list[:depth]
+	}
+	return list
+}
@@ -0,0 +1,121 @@
+/*
+
+  Copyright 2017 Loopring Project Ltd (Loopring Foundation).
+
+  Licensed under the Apache License, Version 2.0 (the "License");
+  you may not use this file except in compliance with the License.
+  You may obtain a copy of the License at
+
+  http://www.apache.org/licenses/LICENSE-2.0
+
+  Unless required by applicable law or agreed to in writing, software
+  distributed under the License is distributed on an "AS IS" BASIS,
+  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+  See the License for the specific language governing permissions and
+  limitations under the License.
+
+*/
+
+package ordermanager_test
+
+import (
+	"github.com/Loopring/relay/config"
+	"github.com/Loopring/relay/crypto"
+	"github.com/Loopring/relay/dao"
+	"github.com/Loopring/relay/log"
+	"github.com/Loopring/relay/market/util"
+	"github.com/Loopring/relay/ordermanager"
+	"github.com/Loopring/relay/types"
+	"github.com/ethereum/go-ethereum/common"
+	"go.uber.org/zap"
+	"math/big"
+	"testing"
+)
+
+type orderBookRdsService struct {
+	dao.RdsService
+	orders []dao.Order
+}
+
+func (s *orderBookRdsService) GetMarketOpenOrders(market string) ([]dao.Order, error) {
+	var list []dao.Order
+	for _, v := range s.orders {
+		if v.Market == market {
+			list = append(list, v)
+		}
+	}
+	return list, nil
+}
+
+func TestOrderManagerImpl_GetMarketOrderBook(t *testing.T) {
+	zapOpts := zap.NewDevelopmentConfig()
+	zapOpts.Level = zap.NewAtomicLevelAt(zap.ErrorLevel)
+	log.Initialize(config.LogOptions{ZapOpts: zapOpts})
+	crypto.Initialize(crypto.NewKSCrypto(true, nil))
+
+	weth := types.Token{Protocol: common.HexToAddress("0x2956356cD2a2bf3202F771F50D3D14A367b48070"), Symbol: "WETH", Decimals: big.NewInt(1e18), IsMarket: true}
+	lrc := types.Token{Protocol: common.HexToAddress("0xEF68e7C694F40c8202821eDF525dE3782458639f"), Symbol: "LRC", Decimals: big.NewInt(1e18)}
+	util.SetTokens(map[string]types.Token{"LRC": lrc}, map[string]types.Token{"WETH": weth})
+
+	order := func(tokenS, tokenB common.Address, amountS, amountB, dealtAmountS string) dao.Order {
+		model := dao.Order{
+			Owner:            "0x1b978a1D302335a6F2Ebe4B8823B5E17c3C84135",
+			TokenS:           tokenS.Hex(),
+			TokenB:           tokenB.Hex(),
+			AmountS:          amountS,
+			AmountB:          amountB,
+			LrcFee:           "0",
+			DealtAmountS:     dealtAmountS,
+			DealtAmountB:     "0",
+			SplitAmountS:     "0",
+			SplitAmountB:     "0",
+			CancelledAmountS: "0",
+			CancelledAmountB: "0",
+			Market:           "LRC-WETH",
+			Status:           uint8(types.ORDER_NEW),
+		}
+
+		var state types.OrderState
+		model.ConvertUp(&state)
+		model.OrderHash = state.RawOrder.GenerateHash().Hex()
+		return model
+	}
+
+	db := &orderBookRdsService{orders: []dao.Order{
+		// asks: 0.01两笔, 其中一笔已成交一半, 0.02一笔
+		order(lrc.Protocol, weth.Protocol, "100", "1", "0"),
+		order(lrc.Protocol, weth.Protocol, "200", "2", "100"),
+		order(lrc.Protocol, weth.Protocol, "100", "2", "0"),
+		// bids: 0.009两笔, 0.008一笔
+		order(weth.Protocol, lrc.Protocol, "9", "1000", "0"),
+		order(weth.Protocol, lrc.Protocol, "18", "2000", "0"),
+		order(weth.Protocol, lrc.Protocol, "8", "1000", "0"),
+	}}
+
+	om := ordermanager.NewOrderManager(&config.OrderManagerOptions{}, db, nil, nil)
+
+	book, err := om.GetMarketOrderBook("LRC-WETH", 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(book.Asks) != 1 || len(book.Bids) != 1 {
+		t.Fatalf("depth 1 should return one level per side, got asks:%d bids:%d", len(book.Asks), len(book.Bids))
+	}
+	if ask := book.Asks[0]; ask.Price.Cmp(big.NewRat(1, 100)) != 0 || ask.Amount.Cmp(big.NewRat(200, 1)) != 0 || ask.Size.Cmp(big.NewRat(2, 1)) != 0 || ask.Orders != 2 {
+		t.Fatalf("best ask should aggregate 200 LRC at 0.01, got %s LRC at %s from %d orders", ask.Amount.RatString(), ask.Price.RatString(), ask.Orders)
+	}
+	if bid := book.Bids[0]; bid.Price.Cmp(big.NewRat(9, 1000)) != 0 || bid.Amount.Cmp(big.NewRat(3000, 1)) != 0 || bid.Size.Cmp(big.NewRat(27, 1)) != 0 || bid.Orders != 2 {
+		t.Fatalf("best bid should aggregate 3000 LRC at 0.009, got %s LRC at %s from %d orders", bid.Amount.RatString(), bid.Price.RatString(), bid.Orders)
+	}
+
+	book, err = om.GetMarketOrderBook("LRC-WETH", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(book.Asks) != 2 || book.Asks[1].Price.Cmp(big.NewRat(2, 100)) != 0 || book.Asks[1].Amount.Cmp(big.NewRat(100, 1)) != 0 {
+		t.Fatalf("asks should be sorted by price ascending")
+	}
+	if len(book.Bids) != 2 || book.Bids[1].Price.Cmp(big.NewRat(8, 1000)) != 0 || book.Bids[1].Amount.Cmp(big.NewRat(1000, 1)) != 0 {
+		t.Fatalf("bids should be sorted by price descending")
+	}
+}
@@ -30,6 +30,7 @@ import (
 	"github.com/Loopring/relay/usermanager"
 	"github.com/ethereum/go-ethereum/common"
 	"math/big"
+	"time"
 )
 
 type OrderManager interface {
@@ -37,12 +38,18 @@ type OrderManager interface {
 	Stop()
 	MinerOrders(protocol, tokenS, tokenB common.Address, length int, reservedTime, startBlockNumber, endBlockNumber int64, filterOrderHashLists ...*types.OrderDelayList) []*types.OrderState
 	GetOrderBook(protocol, tokenS, tokenB common.Address, length int) ([]types.OrderState, error)
+	GetMarketOrderBook(market string, depth int) (*OrderBook, error)
 	GetOrders(query map[string]interface{}, statusList []types.OrderStatus, pageIndex, pageSize int) (dao.PageResult, error)
 	GetOrderByHash(hash common.Hash) (*types.OrderState, error)
+	OrderLifecycle(hash common.Hash) (*types.OrderLifecycle, error)
 	UpdateBroadcastTimeByHash(hash common.Hash, bt int) error
 	FillsPageQuery(query map[string]interface{}, pageIndex, pageSize int) (dao.PageResult, error)
 	GetLatestFills(query map[string]interface{}, limit int) ([]dao.FillEvent, error)
 	FindFillsByRingHash(ringHash common.Hash) (result []dao.FillEvent, err error)
+	FillsForOwner(owner common.Address, from, to int64) ([]types.OrderFilledEvent, error)
+	OpenOrderCount(market string) int
+	NetWrapped(owner common.Address, window int64) *big.Int
+	OwnerDailyPnL(owner common.Address) (*OwnerPnL, error)
 	RingMinedPageQuery(query map[string]interface{}, pageIndex, pageSize int) (dao.PageResult, error)
 	IsOrderCutoff(protocol, owner, token1, token2 common.Address, validsince *big.Int) bool
 	IsOrderFullFinished(state *types.OrderState) bool
@@ -58,16 +65,23 @@ type OrderManagerImpl struct {
 	um                 usermanager.UserManager
 	mc                 marketcap.MarketCapProvider
 	cutoffCache        *CutoffCache
+	openOrders         *OpenOrderCounter
+	netWrapped         *NetWrappedTracker
+	imbalance          *MarketImbalanceTracker
+	cancels            *CancelBuffer
 	newOrderWatcher    *eventemitter.Watcher
 	ringMinedWatcher   *eventemitter.Watcher
 	fillOrderWatcher   *eventemitter.Watcher
 	cancelOrderWatcher *eventemitter.Watcher
 	cutoffOrderWatcher *eventemitter.Watcher
 	cutoffPairWatcher  *eventemitter.Watcher
+	depositWatcher     *eventemitter.Watcher
+	withdrawalWatcher  *eventemitter.Watcher
 	forkWatcher        *eventemitter.Watcher
 	//syncWatcher             *eventemitter.Watcher
 	warningWatcher          *eventemitter.Watcher
 	submitRingMethodWatcher *eventemitter.Watcher
+	blockWatcher            *eventemitter.Watcher
 	//ordersValidForMiner     bool
 }
 
@@ -84,6 +98,14 @@ func NewOrderManager(
 	om.um = userManager
 	om.mc = market
 	om.cutoffCache = NewCutoffCache(options.CutoffCacheCleanTime)
+	om.openOrders = NewOpenOrderCounter()
+	om.netWrapped = NewNetWrappedTracker()
+	if options.ImbalanceThreshold > 0 {
+		om.imbalance = NewMarketImbalanceTracker(options.ImbalanceWindow, options.ImbalanceThreshold)
+	}
+	if options.CancelConfirmBlocks > 0 {
+		om.cancels = NewCancelBuffer(options.CancelConfirmBlocks)
+	}
 	//om.ordersValidForMiner = false
 
 	dustOrderValue = om.options.DustOrderValue
@@ -93,43 +115,74 @@ func NewOrderManager(
 
 // Start start orderbook as a service
 func (om *OrderManagerImpl) Start() {
+	if orders, err := om.rds.GetOpenOrders(); err != nil {
+		log.Errorf("order manager,load open orders error:%s", err.Error())
+	} else {
+		om.openOrders.Reload(orders)
+	}
+
+	eventemitter.Declare(eventemitter.DepthUpdated, eventemitter.MarketImbalance, eventemitter.OrderConsumed, eventemitter.OrderPartiallyFilled, eventemitter.TradeExecuted)
+
 	om.newOrderWatcher = &eventemitter.Watcher{Concurrent: false, Handle: om.handleGatewayOrder}
-	om.ringMinedWatcher = &eventemitter.Watcher{Concurrent: false, Handle: om.handleRingMined}
-	om.fillOrderWatcher = &eventemitter.Watcher{Concurrent: false, Handle: om.handleOrderFilled}
-	om.cancelOrderWatcher = &eventemitter.Watcher{Concurrent: false, Handle: om.handleOrderCancelled}
-	om.cutoffOrderWatcher = &eventemitter.Watcher{Concurrent: false, Handle: om.handleCutoff}
-	om.cutoffPairWatcher = &eventemitter.Watcher{Concurrent: false, Handle: om.handleCutoffPair}
+	om.ringMinedWatcher = &eventemitter.Watcher{Concurrent: false, Ordered: true, Handle: om.handleRingMined}
+	om.fillOrderWatcher = &eventemitter.Watcher{Concurrent: false, Ordered: true, Handle: om.handleOrderFilled}
+	om.cancelOrderWatcher = &eventemitter.Watcher{Concurrent: false, Ordered: true, Handle: om.handleOrderCancelled}
+	om.cutoffOrderWatcher = &eventemitter.Watcher{Concurrent: false, Ordered: true, Handle: om.handleCutoff}
+	om.cutoffPairWatcher = &eventemitter.Watcher{Concurrent: false, Ordered: true, Handle: om.handleCutoffPair}
+	om.depositWatcher = &eventemitter.Watcher{Concurrent: false, Handle: om.handleWethDeposit}
+	om.withdrawalWatcher = &eventemitter.Watcher{Concurrent: false, Handle: om.handleWethWithdrawal}
 	//om.syncWatcher = &eventemitter.Watcher{Concurrent: false, Handle: om.handleSync}
 	om.forkWatcher = &eventemitter.Watcher{Concurrent: false, Handle: om.handleFork}
 	om.warningWatcher = &eventemitter.Watcher{Concurrent: false, Handle: om.handleWarning}
 	om.submitRingMethodWatcher = &eventemitter.Watcher{Concurrent: false, Handle: om.handleSubmitRingMethod}
+	om.blockWatcher = &eventemitter.Watcher{Concurrent: false, Ordered: true, Handle: om.handleBlockNew}
 
 	eventemitter.On(eventemitter.NewOrder, om.newOrderWatcher)
-	eventemitter.On(eventemitter.RingMined, om.ringMinedWatcher)
-	eventemitter.On(eventemitter.OrderFilled, om.fillOrderWatcher)
-	eventemitter.On(eventemitter.CancelOrder, om.cancelOrderWatcher)
-	eventemitter.On(eventemitter.CutoffAll, om.cutoffOrderWatcher)
-	eventemitter.On(eventemitter.CutoffPair, om.cutoffPairWatcher)
+	eventemitter.On(om.protocolTopic(eventemitter.RingMined), om.ringMinedWatcher)
+	eventemitter.On(om.protocolTopic(eventemitter.OrderFilled), om.fillOrderWatcher)
+	eventemitter.On(om.protocolTopic(eventemitter.CancelOrder), om.cancelOrderWatcher)
+	eventemitter.On(om.protocolTopic(eventemitter.CutoffAll), om.cutoffOrderWatcher)
+	eventemitter.On(om.protocolTopic(eventemitter.CutoffPair), om.cutoffPairWatcher)
+	eventemitter.On(eventemitter.WethDeposit, om.depositWatcher)
+	eventemitter.On(eventemitter.WethWithdrawal, om.withdrawalWatcher)
 	//eventemitter.On(eventemitter.SyncChainComplete, om.syncWatcher)
 	eventemitter.On(eventemitter.ChainForkDetected, om.forkWatcher)
 	eventemitter.On(eventemitter.ExtractorWarning, om.warningWatcher)
-	eventemitter.On(eventemitter.Miner_SubmitRing_Method, om.submitRingMethodWatcher)
+	eventemitter.On(om.protocolTopic(eventemitter.Miner_SubmitRing_Method), om.submitRingMethodWatcher)
+	if om.cancels != nil {
+		if err := om.cancels.Restore(); err != nil {
+			log.Errorf("order manager,restore pending cancels error:%s", err.Error())
+		}
+		eventemitter.On(eventemitter.Block_New, om.blockWatcher)
+	}
 }
 
 func (om *OrderManagerImpl) Stop() {
 	eventemitter.Un(eventemitter.NewOrder, om.newOrderWatcher)
-	eventemitter.Un(eventemitter.RingMined, om.ringMinedWatcher)
-	eventemitter.Un(eventemitter.OrderFilled, om.fillOrderWatcher)
-	eventemitter.Un(eventemitter.CancelOrder, om.cancelOrderWatcher)
-	eventemitter.Un(eventemitter.CutoffAll, om.cutoffOrderWatcher)
+	eventemitter.Un(om.protocolTopic(eventemitter.RingMined), om.ringMinedWatcher)
+	eventemitter.Un(om.protocolTopic(eventemitter.OrderFilled), om.fillOrderWatcher)
+	eventemitter.Un(om.protocolTopic(eventemitter.CancelOrder), om.cancelOrderWatcher)
+	eventemitter.Un(om.protocolTopic(eventemitter.CutoffAll), om.cutoffOrderWatcher)
+	eventemitter.Un(om.protocolTopic(eventemitter.CutoffPair), om.cutoffPairWatcher)
+	eventemitter.Un(eventemitter.WethDeposit, om.depositWatcher)
+	eventemitter.Un(eventemitter.WethWithdrawal, om.withdrawalWatcher)
 	//eventemitter.Un(eventemitter.SyncChainComplete, om.syncWatcher)
 	eventemitter.Un(eventemitter.ChainForkDetected, om.forkWatcher)
 	eventemitter.Un(eventemitter.ExtractorWarning, om.warningWatcher)
-	eventemitter.Un(eventemitter.Miner_SubmitRing_Method, om.submitRingMethodWatcher)
+	eventemitter.Un(om.protocolTopic(eventemitter.Miner_SubmitRing_Method), om.submitRingMethodWatcher)
+	eventemitter.Un(eventemitter.Block_New, om.blockWatcher)
 
 	//om.ordersValidForMiner = false
 }
 
+// protocolTopic 配置了protocol_version时只订阅该版本协议的事件, 需要extractor开启route_protocol_version
+func (om *OrderManagerImpl) protocolTopic(topic string) string {
+	if om.options == nil || om.options.ProtocolVersion == "" {
+		return topic
+	}
+	return eventemitter.VersionTopic(topic, om.options.ProtocolVersion)
+}
+
 //func (om *OrderManagerImpl) handleSync(input eventemitter.EventData) error {
 //	blockNumber := input.(types.Big)
 //	if blockNumber.BigInt().Cmp(big.NewInt(0)) > 0 {
@@ -142,8 +195,15 @@ func (om *OrderManagerImpl) Stop() {
 func (om *OrderManagerImpl) handleFork(input eventemitter.EventData) error {
 	log.Debugf("order manager processing chain fork......")
 
+	forkEvent := input.(*types.ForkedEvent)
+	if om.cancels != nil {
+		if n := om.cancels.Rollback(forkEvent.ForkBlock); n > 0 {
+			log.Debugf("order manager,drop %d unconfirmed cancel events after fork block:%s", n, forkEvent.ForkBlock.String())
+		}
+	}
+
 	om.Stop()
-	if err := om.processor.Fork(input.(*types.ForkedEvent)); err != nil {
+	if err := om.processor.Fork(forkEvent); err != nil {
 		log.Fatalf("order manager,handle fork error:%s", err.Error())
 	}
 	om.Start()
@@ -193,7 +253,36 @@ func (om *OrderManagerImpl) handleGatewayOrder(input eventemitter.EventData) err
 	}
 
 	eventemitter.Emit(eventemitter.DepthUpdated, types.DepthUpdateEvent{DelegateAddress: model.DelegateAddress, Market: model.Market})
-	return om.rds.Add(model)
+	if err := om.rds.Add(model); err != nil {
+		return err
+	}
+	if state.Status == types.ORDER_NEW || state.Status == types.ORDER_PARTIAL {
+		om.openOrders.Add(model.Market, state.RawOrder.Hash, model.ValidUntil)
+	}
+
+	return nil
+}
+
+func (om *OrderManagerImpl) handleWethDeposit(input eventemitter.EventData) error {
+	event := input.(*types.WethDepositEvent)
+
+	if event.Status != types.TX_STATUS_SUCCESS {
+		return nil
+	}
+
+	om.netWrapped.Deposit(event.Dst, event.TxHash, event.TxLogIndex, event.BlockTime, event.Amount)
+	return nil
+}
+
+func (om *OrderManagerImpl) handleWethWithdrawal(input eventemitter.EventData) error {
+	event := input.(*types.WethWithdrawalEvent)
+
+	if event.Status != types.TX_STATUS_SUCCESS {
+		return nil
+	}
+
+	om.netWrapped.Withdrawal(event.Src, event.TxHash, event.TxLogIndex, event.BlockTime, event.Amount)
+	return nil
 }
 
 func (om *OrderManagerImpl) handleRingMined(input eventemitter.EventData) error {
@@ -210,6 +299,10 @@ func (om *OrderManagerImpl) handleRingMined(input eventemitter.EventData) error
 
 	model, err = om.rds.FindRingMined(event.TxHash.Hex())
 	if err == nil {
+		// 重放的区块中已入库的环路直接跳过
+		if event.Replay {
+			return nil
+		}
 		return fmt.Errorf("order manager,handle ringmined event,ring %s has already exist", event.Ringhash.Hex())
 	}
 	model.ConvertDown(event)
@@ -254,12 +347,18 @@ func (om *OrderManagerImpl) handleOrderFilled(input eventemitter.EventData) erro
 		return err
 	}
 
+	emitTradeExecuted(model, event, newFillModel.Side)
+	om.recordImbalance(event, newFillModel.Side)
+
 	// judge order status
 	if state.Status == types.ORDER_CUTOFF || state.Status == types.ORDER_FINISHED || state.Status == types.ORDER_UNKNOWN {
 		log.Debugf("order manager,handle order filled event,order %s status is %d ", state.RawOrder.Hash.Hex(), state.Status)
 		return nil
 	}
 
+	terminated := isOrderTerminated(state.Status)
+	previous := state.Status
+
 	// calculate dealt amount
 	state.UpdatedBlock = event.BlockNumber
 	state.DealtAmountS = new(big.Int).Add(state.DealtAmountS, event.AmountS)
@@ -281,6 +380,24 @@ func (om *OrderManagerImpl) handleOrderFilled(input eventemitter.EventData) erro
 		return err
 	}
 
+	if !terminated && state.Status == types.ORDER_FINISHED {
+		om.openOrders.Remove(state.RawOrder.Hash)
+		emitOrderConsumed(state, types.ORDER_CONSUMED_FILLED, event.BlockNumber)
+	}
+
+	var firstFilledTime, removedTime int64
+	if state.FirstFilledTime == 0 {
+		firstFilledTime = event.BlockTime
+	}
+	if !terminated && state.Status == types.ORDER_FINISHED {
+		removedTime = event.BlockTime
+	}
+	om.updateOrderLifecycle(state, firstFilledTime, removedTime)
+
+	if previous == types.ORDER_NEW && state.Status == types.ORDER_PARTIAL {
+		emitOrderPartiallyFilled(state, event.TxHash, event.BlockNumber)
+	}
+
 	return nil
 }
 
@@ -291,6 +408,28 @@ func (om *OrderManagerImpl) handleOrderCancelled(input eventemitter.EventData) e
 		return nil
 	}
 
+	// 重放的历史区块早已确认, 无需等待确认块数, 已入库的cancel在apply时跳过
+	if om.cancels == nil || event.Replay {
+		return om.applyOrderCancelled(event)
+	}
+
+	om.cancels.Add(event)
+	return nil
+}
+
+// 到达确认块数的cancel才真正处理
+func (om *OrderManagerImpl) handleBlockNew(input eventemitter.EventData) error {
+	block := input.(*types.BlockEvent)
+
+	for _, event := range om.cancels.Ready(block.BlockNumber) {
+		if err := om.applyOrderCancelled(event); err != nil {
+			log.Errorf("order manager,handle confirmed cancel tx:%s error:%s", event.TxHash.Hex(), err.Error())
+		}
+	}
+	return nil
+}
+
+func (om *OrderManagerImpl) applyOrderCancelled(event *types.OrderCancelledEvent) error {
 	// save cancel event
 	_, err := om.rds.GetCancelEvent(event.TxHash)
 	if err == nil {
@@ -313,6 +452,7 @@ func (om *OrderManagerImpl) handleOrderCancelled(input eventemitter.EventData) e
 	if err := model.ConvertUp(state); err != nil {
 		return err
 	}
+	terminated := isOrderTerminated(state.Status)
 
 	// calculate remainAmount and cancelled amount should be saved whether order is finished or not
 	if state.RawOrder.BuyNoMoreThanAmountB {
@@ -335,6 +475,12 @@ func (om *OrderManagerImpl) handleOrderCancelled(input eventemitter.EventData) e
 		return err
 	}
 
+	if !terminated && state.Status == types.ORDER_CANCEL {
+		om.openOrders.Remove(state.RawOrder.Hash)
+		emitOrderConsumed(state, types.ORDER_CONSUMED_CANCELLED, event.BlockNumber)
+		om.updateOrderLifecycle(state, 0, event.BlockTime)
+	}
+
 	return nil
 }
 
@@ -363,12 +509,19 @@ func (om *OrderManagerImpl) handleCutoff(input eventemitter.EventData) error {
 	} else {
 		om.cutoffCache.UpdateCutoff(evt.Protocol, evt.Owner, evt.Cutoff)
 		if orders, _ := om.rds.GetCutoffOrders(evt.Owner, evt.Cutoff); len(orders) > 0 {
+			var states []types.OrderState
 			for _, v := range orders {
 				var state types.OrderState
 				v.ConvertUp(&state)
 				orderHashList = append(orderHashList, state.RawOrder.Hash)
+				states = append(states, state)
 			}
 			om.rds.SetCutOffOrders(orderHashList, evt.BlockNumber)
+			for i := range states {
+				om.openOrders.Remove(states[i].RawOrder.Hash)
+				emitOrderConsumed(&states[i], types.ORDER_CONSUMED_CUTOFF, evt.BlockNumber)
+				om.updateOrderLifecycle(&states[i], 0, evt.BlockTime)
+			}
 		}
 		log.Debugf("order manager,handle cutoff event, owner:%s, cutoffTimestamp:%s", evt.Owner.Hex(), evt.Cutoff.String())
 	}
@@ -405,12 +558,19 @@ func (om *OrderManagerImpl) handleCutoffPair(input eventemitter.EventData) error
 	} else {
 		om.cutoffCache.UpdateCutoffPair(evt.Protocol, evt.Owner, evt.Token1, evt.Token2, evt.Cutoff)
 		if orders, _ := om.rds.GetCutoffPairOrders(evt.Owner, evt.Token1, evt.Token2, evt.Cutoff); len(orders) > 0 {
+			var states []types.OrderState
 			for _, v := range orders {
 				var state types.OrderState
 				v.ConvertUp(&state)
 				orderHashList = append(orderHashList, state.RawOrder.Hash)
+				states = append(states, state)
 			}
 			om.rds.SetCutOffOrders(orderHashList, evt.BlockNumber)
+			for i := range states {
+				om.openOrders.Remove(states[i].RawOrder.Hash)
+				emitOrderConsumed(&states[i], types.ORDER_CONSUMED_CUTOFF, evt.BlockNumber)
+				om.updateOrderLifecycle(&states[i], 0, evt.BlockTime)
+			}
 		}
 		log.Debugf("order manager,handle cutoffPair event, owner:%s, token1:%s, token2:%s, cutoffTimestamp:%s", evt.Owner.Hex(), evt.Token1.Hex(), evt.Token2.Hex(), evt.Cutoff.String())
 	}
@@ -424,6 +584,30 @@ func (om *OrderManagerImpl) handleCutoffPair(input eventemitter.EventData) error
 	return om.rds.Add(newCutoffPairEventModel)
 }
 
+// 记录首次成交及移除时间, 已记录过的时间不再覆盖
+func (om *OrderManagerImpl) updateOrderLifecycle(state *types.OrderState, firstFilledTime, removedTime int64) {
+	if state.FirstFilledTime > 0 {
+		firstFilledTime = 0
+	}
+	if state.RemovedTime > 0 {
+		removedTime = 0
+	}
+	if firstFilledTime == 0 && removedTime == 0 {
+		return
+	}
+
+	if err := om.rds.UpdateOrderLifecycle(state.RawOrder.Hash, firstFilledTime, removedTime); err != nil {
+		log.Errorf("order manager,update order:%s lifecycle error:%s", state.RawOrder.Hash.Hex(), err.Error())
+		return
+	}
+	if firstFilledTime > 0 {
+		state.FirstFilledTime = firstFilledTime
+	}
+	if removedTime > 0 {
+		state.RemovedTime = removedTime
+	}
+}
+
 func (om *OrderManagerImpl) IsOrderFullFinished(state *types.OrderState) bool {
 	return isOrderFullFinished(state, om.mc)
 }
@@ -499,6 +683,25 @@ func (om *OrderManagerImpl) GetOrderBook(protocol, tokenS, tokenB common.Address
 	return list, nil
 }
 
+// GetMarketOrderBook 由未成交订单按价格聚合买卖盘, depth为每边最多档数, 0时不限制
+func (om *OrderManagerImpl) GetMarketOrderBook(market string, depth int) (*OrderBook, error) {
+	models, err := om.rds.GetMarketOpenOrders(market)
+	if err != nil {
+		return nil, err
+	}
+
+	var states []types.OrderState
+	for _, v := range models {
+		var state types.OrderState
+		if err := v.ConvertUp(&state); err != nil {
+			continue
+		}
+		states = append(states, state)
+	}
+
+	return buildOrderBook(market, states, depth), nil
+}
+
 func (om *OrderManagerImpl) GetOrders(query map[string]interface{}, statusList []types.OrderStatus, pageIndex, pageSize int) (dao.PageResult, error) {
 	var (
 		pageRes dao.PageResult
@@ -542,6 +745,20 @@ func (om *OrderManagerImpl) GetOrderByHash(hash common.Hash) (orderState *types.
 	return &result, nil
 }
 
+func (om *OrderManagerImpl) OrderLifecycle(hash common.Hash) (*types.OrderLifecycle, error) {
+	state, err := om.GetOrderByHash(hash)
+	if err != nil {
+		return nil, err
+	}
+
+	return &types.OrderLifecycle{
+		OrderHash:       state.RawOrder.Hash,
+		CreateTime:      state.RawOrder.CreateTime,
+		FirstFilledTime: state.FirstFilledTime,
+		RemovedTime:     state.RemovedTime,
+	}, nil
+}
+
 func (om *OrderManagerImpl) UpdateBroadcastTimeByHash(hash common.Hash, bt int) error {
 	return om.rds.UpdateBroadcastTimeByHash(hash.Hex(), bt)
 }
@@ -558,6 +775,67 @@ func (om *OrderManagerImpl) FindFillsByRingHash(ringHash common.Hash) (result []
 	return om.rds.FindFillsByRingHash(ringHash)
 }
 
+func (om *OrderManagerImpl) FillsForOwner(owner common.Address, from, to int64) ([]types.OrderFilledEvent, error) {
+	fills, err := om.rds.GetFillsByOwner(owner.Hex(), from, to)
+	if err != nil {
+		return nil, err
+	}
+
+	var list []types.OrderFilledEvent
+	for _, v := range fills {
+		var evt types.OrderFilledEvent
+		if err := v.ConvertUp(&evt); err != nil {
+			return nil, err
+		}
+		list = append(list, evt)
+	}
+
+	return list, nil
+}
+
+func (om *OrderManagerImpl) OpenOrderCount(market string) int {
+	return om.openOrders.Count(market)
+}
+
+func (om *OrderManagerImpl) recordImbalance(event *types.OrderFilledEvent, side string) {
+	if om.imbalance == nil {
+		return
+	}
+	if evt, ok := om.imbalance.Add(event, side); ok {
+		log.Debugf("order manager,market %s imbalance side:%s, buy ratio:%f", evt.Market, evt.Side, evt.BuyRatio)
+		eventemitter.Emit(eventemitter.MarketImbalance, evt)
+	}
+}
+
+// NetWrapped 用户最近window秒内weth deposit减去withdrawal的净值
+func (om *OrderManagerImpl) NetWrapped(owner common.Address, window int64) *big.Int {
+	return om.netWrapped.NetWrapped(owner, window)
+}
+
+// OwnerDailyPnL 用户当天(UTC)已实现盈亏估计, 当天之前的持仓作为成本带入, 未平仓部分不计入
+func (om *OrderManagerImpl) OwnerDailyPnL(owner common.Address) (*OwnerPnL, error) {
+	now := time.Now().Unix()
+	dayStart := now - now%secondsPerDay
+
+	fills, err := om.FillsForOwner(owner, dayStart-pnlCarryLookback, now)
+	if err != nil {
+		return nil, err
+	}
+
+	result := &OwnerPnL{Owner: owner, DayStart: dayStart, Value: new(big.Rat)}
+	result.Markets = calculateMarketPnL(fills, dayStart)
+	for market, pnl := range result.Markets {
+		_, quote := util.UnWrap(market)
+		value, err := om.mc.LegalCurrencyValue(util.AliasToAddress(quote), pnl.Realized)
+		if err != nil {
+			return nil, err
+		}
+		result.Value.Add(result.Value, value)
+	}
+
+	return result, nil
+}
+
 func (om *OrderManagerImpl) RingMinedPageQuery(query map[string]interface{}, pageIndex, pageSize int) (result dao.PageResult, err error) {
 	return om.rds.RingMinedPageQuery(query, pageIndex, pageSize)
 }
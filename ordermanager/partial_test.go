@@ -0,0 +1,92 @@
+/*
+
+  Copyright 2017 Loopring Project Ltd (Loopring Foundation).
+
+  Licensed under the Apache License, Version 2.0 (the "License");
+  you may not use this file except in compliance with the License.
+  You may obtain a copy of the License at
+
+  http://www.apache.org/licenses/LICENSE-2.0
+
+  Unless required by applicable law or agreed to in writing, software
+  distributed under the License is distributed on an "AS IS" BASIS,
+  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+  See the License for the specific language governing permissions and
+  limitations under the License.
+
+*/
+
+package ordermanager
+
+import (
+	"github.com/Loopring/relay/config"
+	"github.com/Loopring/relay/crypto"
+	"github.com/Loopring/relay/dao"
+	"github.com/Loopring/relay/eventemiter"
+	"github.com/Loopring/relay/log"
+	"github.com/Loopring/relay/types"
+	"github.com/ethereum/go-ethereum/common"
+	"go.uber.org/zap"
+	"math/big"
+	"testing"
+	"time"
+)
+
+func TestOrderManagerImpl_OrderPartiallyFilled(t *testing.T) {
+	zapOpts := zap.NewDevelopmentConfig()
+	zapOpts.Level = zap.NewAtomicLevelAt(zap.ErrorLevel)
+	log.Initialize(config.LogOptions{ZapOpts: zapOpts})
+	crypto.Initialize(crypto.NewKSCrypto(true, nil))
+
+	order := newOpenOrder("LRC-WETH", 1000, time.Now().Unix()+3600)
+	db := &openOrdersRdsService{orders: map[common.Hash]*dao.Order{common.HexToHash(order.OrderHash): order}}
+
+	om := NewOrderManager(&config.OrderManagerOptions{DustOrderValue: 0}, db, nil, &openOrdersMarketCap{})
+	om.Start()
+	defer om.Stop()
+
+	var partial []*types.OrderPartiallyFilledEvent
+	watcher := &eventemitter.Watcher{Concurrent: false, Handle: func(input eventemitter.EventData) error {
+		partial = append(partial, input.(*types.OrderPartiallyFilledEvent))
+		return nil
+	}}
+	eventemitter.On(eventemitter.OrderPartiallyFilled, watcher)
+	defer eventemitter.Un(eventemitter.OrderPartiallyFilled, watcher)
+
+	fill := func(amountS int64, fillIndex int64) {
+		evt := &types.OrderFilledEvent{
+			OrderHash: common.HexToHash(order.OrderHash),
+			AmountS:   big.NewInt(amountS),
+			AmountB:   big.NewInt(0),
+			SplitS:    big.NewInt(0),
+			SplitB:    big.NewInt(0),
+			LrcReward: big.NewInt(0),
+			LrcFee:    big.NewInt(0),
+			RingIndex: big.NewInt(1),
+			FillIndex: big.NewInt(fillIndex),
+		}
+		evt.Status = types.TX_STATUS_SUCCESS
+		evt.TxHash = common.HexToHash("0x01")
+		evt.BlockNumber = big.NewInt(100)
+		if err := om.handleOrderFilled(evt); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	fill(300, 0)
+	if len(partial) != 1 {
+		t.Fatalf("expect 1 partially filled event, got %d", len(partial))
+	}
+	if partial[0].OrderHash.Hex() != order.OrderHash || partial[0].FilledAmount.Int64() != 300 || partial[0].RemainingAmount.Int64() != 700 {
+		t.Fatalf("unexpected partially filled event %s filled:%s remaining:%s", partial[0].OrderHash.Hex(), partial[0].FilledAmount, partial[0].RemainingAmount)
+	}
+
+	// 已经是部分成交状态, 不再重复发出
+	fill(200, 1)
+	if len(partial) != 1 {
+		t.Fatalf("transition event should fire once, got %d", len(partial))
+	}
+	if order.Status != uint8(types.ORDER_PARTIAL) || order.DealtAmountS != "500" {
+		t.Fatalf("order should be partial with dealt 500, got status %d dealt %s", order.Status, order.DealtAmountS)
+	}
+}
@@ -0,0 +1,132 @@
+/*
+
+  Copyright 2017 Loopring Project Ltd (Loopring Foundation).
+
+  Licensed under the Apache License, Version 2.0 (the "License");
+  you may not use this file except in compliance with the License.
+  You may obtain a copy of the License at
+
+  http://www.apache.org/licenses/LICENSE-2.0
+
+  Unless required by applicable law or agreed to in writing, software
+  distributed under the License is distributed on an "AS IS" BASIS,
+  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+  See the License for the specific language governing permissions and
+  limitations under the License.
+
+*/
+
+package ordermanager
+
+import (
+	"github.com/Loopring/relay/market/util"
+	"github.com/Loopring/relay/types"
+	"github.com/ethereum/go-ethereum/common"
+	"math/big"
+	"sort"
+)
+
+const (
+	secondsPerDay = 3600 * 24
+
+	// 当天之前的持仓成本最多向前追溯30天
+	pnlCarryLookback = secondsPerDay * 30
+)
+
+// MarketPnL 单个市场的已实现盈亏, 数量均为链上原始精度, realized以quote token计
+type MarketPnL struct {
+	Market    string
+	Realized  *big.Rat
+	CarryIn   *big.Int // 当天之前建立的base持仓
+	CarryOut  *big.Int // 当天结束时未平仓的base持仓, 不计入盈亏
+	Unmatched *big.Int // 卖出超过持仓的部分, 没有成本无法计算盈亏
+}
+
+// OwnerPnL 用户一天内的已实现盈亏估计, value为各市场realized按法币汇总
+type OwnerPnL struct {
+	Owner    common.Address
+	DayStart int64
+	Value    *big.Rat
+	Markets  map[string]*MarketPnL
+}
+
+type pnlPosition struct {
+	amount *big.Int // base数量
+	cost   *big.Rat // 持仓总成本, 以quote计
+}
+
+// calculateMarketPnL 按平均成本法, 用dayStart之前的成交建立持仓, 只计算dayStart之后卖出的盈亏
+func calculateMarketPnL(fills []types.OrderFilledEvent, dayStart int64) map[string]*MarketPnL {
+	sorted := make([]types.OrderFilledEvent, len(fills))
+	copy(sorted, fills)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		if sorted[i].BlockTime != sorted[j].BlockTime {
+			return sorted[i].BlockTime < sorted[j].BlockTime
+		}
+		return sorted[i].TxLogIndex < sorted[j].TxLogIndex
+	})
+
+	positions := make(map[string]*pnlPosition)
+	result := make(map[string]*MarketPnL)
+	for _, fill := range sorted {
+		if fill.AmountS == nil || fill.AmountB == nil || fill.AmountS.Sign() <= 0 || fill.AmountB.Sign() <= 0 {
+			continue
+		}
+
+		market := fill.Market
+		if market == "" {
+			var err error
+			if market, err = util.WrapMarketByAddress(fill.TokenS.Hex(), fill.TokenB.Hex()); err != nil {
+				continue
+			}
+		}
+		base, _ := util.UnWrap(market)
+
+		pos, ok := positions[market]
+		if !ok {
+			pos = &pnlPosition{amount: big.NewInt(0), cost: new(big.Rat)}
+			positions[market] = pos
+		}
+
+		// 当天第一笔成交时记录带入的持仓
+		pnl, ok := result[market]
+		if !ok && fill.BlockTime >= dayStart {
+			pnl = &MarketPnL{Market: market, Realized: new(big.Rat), CarryIn: new(big.Int).Set(pos.amount), Unmatched: big.NewInt(0)}
+			result[market] = pnl
+		}
+
+		if util.AliasToAddress(base) == fill.TokenB {
+			// 买入base, 支付quote
+			pos.amount.Add(pos.amount, fill.AmountB)
+			pos.cost.Add(pos.cost, new(big.Rat).SetInt(fill.AmountS))
+			continue
+		}
+
+		// 卖出base, 收到quote, 按平均成本结转已卖出部分
+		sold := new(big.Int).Set(fill.AmountS)
+		if sold.Cmp(pos.amount) > 0 {
+			if pnl != nil {
+				pnl.Unmatched.Add(pnl.Unmatched, new(big.Int).Sub(sold, pos.amount))
+			}
+			sold.Set(pos.amount)
+		}
+		if sold.Sign() == 0 {
+			continue
+		}
+
+		ratio := new(big.Rat).SetFrac(sold, fill.AmountS)
+		proceeds := new(big.Rat).Mul(new(big.Rat).SetInt(fill.AmountB), ratio)
+		cost := new(big.Rat).Mul(pos.cost, new(big.Rat).SetFrac(sold, pos.amount))
+
+		pos.amount.Sub(pos.amount, sold)
+		pos.cost.Sub(pos.cost, cost)
+		if pnl != nil {
+			pnl.Realized.Add(pnl.Realized, proceeds.Sub(proceeds, cost))
+		}
+	}
+
+	for market, pnl := range result {
+		pnl.CarryOut = new(big.Int).Set(positions[market].amount)
+	}
+	return result
+}
@@ -0,0 +1,99 @@
+/*
+
+  Copyright 2017 Loopring Project Ltd (Loopring Foundation).
+
+  Licensed under the Apache License, Version 2.0 (the "License");
+  you may not use this file except in compliance with the License.
+  You may obtain a copy of the License at
+
+  http://www.apache.org/licenses/LICENSE-2.0
+
+  Unless required by applicable law or agreed to in writing, software
+  distributed under the License is distributed on an "AS IS" BASIS,
+  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+  See the License for the specific language governing permissions and
+  limitations under the License.
+
+*/
+
+package ordermanager_test
+
+import (
+	"github.com/Loopring/relay/config"
+	"github.com/Loopring/relay/dao"
+	"github.com/Loopring/relay/market/util"
+	"github.com/Loopring/relay/marketcap"
+	"github.com/Loopring/relay/ordermanager"
+	"github.com/Loopring/relay/types"
+	"github.com/ethereum/go-ethereum/common"
+	"math/big"
+	"testing"
+	"time"
+)
+
+// 以quote原始数量作为法币价值
+type pnlMarketCap struct {
+	marketcap.MarketCapProvider
+}
+
+func (mc *pnlMarketCap) LegalCurrencyValue(tokenAddress common.Address, amount *big.Rat) (*big.Rat, error) {
+	return amount, nil
+}
+
+func TestOrderManagerImpl_OwnerDailyPnL(t *testing.T) {
+	weth := types.Token{Protocol: common.HexToAddress("0x2956356cD2a2bf3202F771F50D3D14A367b48070"), Symbol: "WETH", Decimals: big.NewInt(1e18), IsMarket: true}
+	lrc := types.Token{Protocol: common.HexToAddress("0xEF68e7C694F40c8202821eDF525dE3782458639f"), Symbol: "LRC", Decimals: big.NewInt(1e18)}
+	util.SetTokens(map[string]types.Token{"LRC": lrc}, map[string]types.Token{"WETH": weth})
+
+	owner := common.HexToAddress("0x1b978a1D302335a6F2Ebe4B8823B5E17c3C84135")
+	now := time.Now().Unix()
+	dayStart := now - now%(3600*24)
+
+	var (
+		carryOrder = common.HexToHash("0x01").Hex()
+		buyOrder   = common.HexToHash("0x02").Hex()
+		sellOrder  = common.HexToHash("0x03").Hex()
+	)
+	db := &fillsRdsService{
+		orders: []dao.Order{
+			{Owner: owner.Hex(), OrderHash: carryOrder, Market: "LRC-WETH"},
+			{Owner: owner.Hex(), OrderHash: buyOrder, Market: "LRC-WETH"},
+			{Owner: owner.Hex(), OrderHash: sellOrder, Market: "LRC-WETH"},
+		},
+		fills: []dao.FillEvent{
+			// 前一天买入100LRC, 花费1WETH
+			{OrderHash: carryOrder, Owner: owner.Hex(), Market: "LRC-WETH", TokenS: weth.Protocol.Hex(), TokenB: lrc.Protocol.Hex(), AmountS: "1000000000000000000", AmountB: "100000000000000000000", CreateTime: dayStart - 100},
+			// 当天买入100LRC, 花费2WETH
+			{OrderHash: buyOrder, Owner: owner.Hex(), Market: "LRC-WETH", TokenS: weth.Protocol.Hex(), TokenB: lrc.Protocol.Hex(), AmountS: "2000000000000000000", AmountB: "100000000000000000000", CreateTime: dayStart},
+			// 当天以更高价格卖出150LRC, 得到3WETH
+			{OrderHash: sellOrder, Owner: owner.Hex(), Market: "LRC-WETH", TokenS: lrc.Protocol.Hex(), TokenB: weth.Protocol.Hex(), AmountS: "150000000000000000000", AmountB: "3000000000000000000", CreateTime: dayStart + 1},
+		},
+	}
+
+	om := ordermanager.NewOrderManager(&config.OrderManagerOptions{}, db, nil, &pnlMarketCap{})
+	pnl, err := om.OwnerDailyPnL(owner)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if pnl.Value.Sign() <= 0 {
+		t.Fatalf("buy then sell at higher price should be positive, got %s", pnl.Value.FloatString(0))
+	}
+
+	// 平均成本 3WETH/200LRC, 卖出150LRC成本2.25WETH, 盈利0.75WETH
+	market, ok := pnl.Markets["LRC-WETH"]
+	if !ok {
+		t.Fatalf("LRC-WETH pnl not found")
+	}
+	if expect := new(big.Rat).SetInt64(750000000000000000); market.Realized.Cmp(expect) != 0 {
+		t.Errorf("expect realized %s, got %s", expect.FloatString(0), market.Realized.FloatString(0))
+	}
+	if market.CarryIn.String() != "100000000000000000000" {
+		t.Errorf("carry in should be position bought before the day, got %s", market.CarryIn.String())
+	}
+	if market.CarryOut.String() != "50000000000000000000" {
+		t.Errorf("unsold position should be carried out, got %s", market.CarryOut.String())
+	}
+	if market.Unmatched.Sign() != 0 {
+		t.Errorf("expect no unmatched sell, got %s", market.Unmatched.String())
+	}
+}
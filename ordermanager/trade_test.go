@@ -0,0 +1,102 @@
+/*
+
+  Copyright 2017 Loopring Project Ltd (Loopring Foundation).
+
+  Licensed under the Apache License, Version 2.0 (the "License");
+  you may not use this file except in compliance with the License.
+  You may obtain a copy of the License at
+
+  http://www.apache.org/licenses/LICENSE-2.0
+
+  Unless required by applicable law or agreed to in writing, software
+  distributed under the License is distributed on an "AS IS" BASIS,
+  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+  See the License for the specific language governing permissions and
+  limitations under the License.
+
+*/
+
+package ordermanager
+
+import (
+	"github.com/Loopring/relay/config"
+	"github.com/Loopring/relay/crypto"
+	"github.com/Loopring/relay/dao"
+	"github.com/Loopring/relay/eventemiter"
+	"github.com/Loopring/relay/log"
+	"github.com/Loopring/relay/types"
+	"github.com/ethereum/go-ethereum/common"
+	"go.uber.org/zap"
+	"math/big"
+	"testing"
+	"time"
+)
+
+func TestOrderManagerImpl_TradeExecuted(t *testing.T) {
+	zapOpts := zap.NewDevelopmentConfig()
+	zapOpts.Level = zap.NewAtomicLevelAt(zap.ErrorLevel)
+	log.Initialize(config.LogOptions{ZapOpts: zapOpts})
+	crypto.Initialize(crypto.NewKSCrypto(true, nil))
+
+	// relay api接收并存储的订单
+	order := newOpenOrder("LRC-WETH", 1000, time.Now().Unix()+3600)
+	order.ID = 42
+	order.CreateTime = 1520000000
+	order.OrderType = types.ORDER_TYPE_MARKET
+	order.WalletAddress = "0xb94065482Ad64d4c2b9252358D746B39e820A582"
+	var state types.OrderState
+	order.ConvertUp(&state)
+	order.OrderHash = state.RawOrder.GenerateHash().Hex()
+	db := &openOrdersRdsService{orders: map[common.Hash]*dao.Order{common.HexToHash(order.OrderHash): order}}
+
+	om := NewOrderManager(&config.OrderManagerOptions{DustOrderValue: 0}, db, nil, &openOrdersMarketCap{})
+	om.Start()
+	defer om.Stop()
+
+	var trades []*types.TradeExecutedEvent
+	watcher := &eventemitter.Watcher{Concurrent: false, Handle: func(input eventemitter.EventData) error {
+		trades = append(trades, input.(*types.TradeExecutedEvent))
+		return nil
+	}}
+	eventemitter.On(eventemitter.TradeExecuted, watcher)
+	defer eventemitter.Un(eventemitter.TradeExecuted, watcher)
+
+	evt := &types.OrderFilledEvent{
+		Ringhash:  common.HexToHash("0xaa"),
+		OrderHash: common.HexToHash(order.OrderHash),
+		AmountS:   big.NewInt(300),
+		AmountB:   big.NewInt(30),
+		SplitS:    big.NewInt(0),
+		SplitB:    big.NewInt(0),
+		LrcReward: big.NewInt(0),
+		LrcFee:    big.NewInt(0),
+		RingIndex: big.NewInt(1),
+		FillIndex: big.NewInt(0),
+
+		GrossAmountB: big.NewInt(30),
+		NetAmountB:   big.NewInt(28),
+	}
+	evt.Status = types.TX_STATUS_SUCCESS
+	evt.TxHash = common.HexToHash("0x01")
+	evt.BlockNumber = big.NewInt(100)
+	if err := om.handleOrderFilled(evt); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(trades) != 1 {
+		t.Fatalf("expect 1 trade executed event, got %d", len(trades))
+	}
+	trade := trades[0]
+	if trade.OrderId != 42 || trade.OrderType != types.ORDER_TYPE_MARKET || trade.OrderCreateTime != 1520000000 {
+		t.Errorf("trade should carry stored order metadata, got id:%d type:%s createTime:%d", trade.OrderId, trade.OrderType, trade.OrderCreateTime)
+	}
+	if trade.WalletAddress != common.HexToAddress(order.WalletAddress) || trade.Market != "LRC-WETH" {
+		t.Errorf("unexpected wallet %s or market %s", trade.WalletAddress.Hex(), trade.Market)
+	}
+	if trade.TxHash != evt.TxHash || trade.Ringhash != evt.Ringhash || trade.OrderHash.Hex() != order.OrderHash || trade.AmountS.Int64() != 300 {
+		t.Errorf("trade should carry on chain fill, got tx:%s ring:%s order:%s amountS:%s", trade.TxHash.Hex(), trade.Ringhash.Hex(), trade.OrderHash.Hex(), trade.AmountS)
+	}
+	if trade.GrossAmountB.Int64() != 30 || trade.NetAmountB.Int64() != 28 {
+		t.Errorf("trade should carry gross and net amountB, got gross:%s net:%s", trade.GrossAmountB, trade.NetAmountB)
+	}
+}
@@ -0,0 +1,93 @@
+/*
+
+  Copyright 2017 Loopring Project Ltd (Loopring Foundation).
+
+  Licensed under the Apache License, Version 2.0 (the "License");
+  you may not use this file except in compliance with the License.
+  You may obtain a copy of the License at
+
+  http://www.apache.org/licenses/LICENSE-2.0
+
+  Unless required by applicable law or agreed to in writing, software
+  distributed under the License is distributed on an "AS IS" BASIS,
+  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+  See the License for the specific language governing permissions and
+  limitations under the License.
+
+*/
+
+package ordermanager
+
+import (
+	"github.com/ethereum/go-ethereum/common"
+	"math/big"
+	"sync"
+	"time"
+)
+
+// 最多保留7天的wrap/unwrap记录
+const defaultNetWrappedRetention = 3600 * 24 * 7
+
+type wrapRecord struct {
+	txhash    common.Hash
+	logIndex  int64
+	blockTime int64
+	amount    *big.Int // deposit为正, withdrawal为负
+}
+
+// 按用户统计weth deposit减去withdrawal的净值
+type NetWrappedTracker struct {
+	mtx       sync.Mutex
+	retention int64
+	records   map[common.Address][]wrapRecord
+	now       func() int64
+}
+
+func NewNetWrappedTracker() *NetWrappedTracker {
+	tracker := &NetWrappedTracker{}
+	tracker.retention = defaultNetWrappedRetention
+	tracker.records = make(map[common.Address][]wrapRecord)
+	tracker.now = func() int64 { return time.Now().Unix() }
+
+	return tracker
+}
+
+func (t *NetWrappedTracker) Deposit(owner common.Address, txhash common.Hash, logIndex, blockTime int64, amount *big.Int) {
+	t.add(owner, wrapRecord{txhash: txhash, logIndex: logIndex, blockTime: blockTime, amount: new(big.Int).Set(amount)})
+}
+
+func (t *NetWrappedTracker) Withdrawal(owner common.Address, txhash common.Hash, logIndex, blockTime int64, amount *big.Int) {
+	t.add(owner, wrapRecord{txhash: txhash, logIndex: logIndex, blockTime: blockTime, amount: new(big.Int).Neg(amount)})
+}
+
+func (t *NetWrappedTracker) add(owner common.Address, record wrapRecord) {
+	t.mtx.Lock()
+	defer t.mtx.Unlock()
+
+	expired := t.now() - t.retention
+	var list []wrapRecord
+	for _, v := range t.records[owner] {
+		if v.txhash == record.txhash && v.logIndex == record.logIndex {
+			return
+		}
+		if v.blockTime >= expired {
+			list = append(list, v)
+		}
+	}
+	t.records[owner] = append(list, record)
+}
+
+// NetWrapped 最近window秒内的净wrap数量, 负数表示unwrap更多
+func (t *NetWrappedTracker) NetWrapped(owner common.Address, window int64) *big.Int {
+	t.mtx.Lock()
+	defer t.mtx.Unlock()
+
+	net := big.NewInt(0)
+	since := t.now() - window
+	for _, v := range t.records[owner] {
+		if v.blockTime >= since {
+			net.Add(net, v.amount)
+		}
+	}
+	return net
+}
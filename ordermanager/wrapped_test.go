@@ -0,0 +1,92 @@
+/*
+
+  Copyright 2017 Loopring Project Ltd (Loopring Foundation).
+
+  Licensed under the Apache License, Version 2.0 (the "License");
+  you may not use this file except in compliance with the License.
+  You may obtain a copy of the License at
+
+  http://www.apache.org/licenses/LICENSE-2.0
+
+  Unless required by applicable law or agreed to in writing, software
+  distributed under the License is distributed on an "AS IS" BASIS,
+  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+  See the License for the specific language governing permissions and
+  limitations under the License.
+
+*/
+
+package ordermanager_test
+
+import (
+	"github.com/Loopring/relay/config"
+	"github.com/Loopring/relay/dao"
+	"github.com/Loopring/relay/eventemiter"
+	"github.com/Loopring/relay/ordermanager"
+	"github.com/Loopring/relay/types"
+	"github.com/ethereum/go-ethereum/common"
+	"math/big"
+	"testing"
+	"time"
+)
+
+type wrappedRdsService struct {
+	dao.RdsService
+}
+
+func (s *wrappedRdsService) GetOpenOrders() ([]dao.Order, error) {
+	return nil, nil
+}
+
+func TestOrderManagerImpl_NetWrapped(t *testing.T) {
+	om := ordermanager.NewOrderManager(&config.OrderManagerOptions{}, &wrappedRdsService{}, nil, nil)
+	om.Start()
+	defer om.Stop()
+
+	owner := common.HexToAddress("0x1b978a1D302335a6F2Ebe4B8823B5E17c3C84135")
+	other := common.HexToAddress("0xb1018949b241D76A1AB2094f473E9bEfeAbB5Ead")
+	now := time.Now().Unix()
+
+	deposit := func(dst common.Address, txhash string, blockTime int64, amount int64) {
+		evt := &types.WethDepositEvent{Dst: dst, Amount: big.NewInt(amount)}
+		evt.TxHash = common.HexToHash(txhash)
+		evt.BlockTime = blockTime
+		evt.Status = types.TX_STATUS_SUCCESS
+		eventemitter.Emit(eventemitter.WethDeposit, evt)
+	}
+	withdrawal := func(src common.Address, txhash string, blockTime int64, amount int64) {
+		evt := &types.WethWithdrawalEvent{Src: src, Amount: big.NewInt(amount)}
+		evt.TxHash = common.HexToHash(txhash)
+		evt.BlockTime = blockTime
+		evt.Status = types.TX_STATUS_SUCCESS
+		eventemitter.Emit(eventemitter.WethWithdrawal, evt)
+	}
+
+	deposit(owner, "0x01", now-7200, 500)
+	deposit(owner, "0x02", now-60, 100)
+	deposit(owner, "0x02", now-60, 100)
+	withdrawal(owner, "0x03", now-30, 30)
+	deposit(other, "0x04", now-10, 1000)
+
+	// pending交易不计入
+	pending := &types.WethWithdrawalEvent{Src: owner, Amount: big.NewInt(40)}
+	pending.TxHash = common.HexToHash("0x05")
+	pending.BlockTime = now
+	pending.Status = types.TX_STATUS_PENDING
+	eventemitter.Emit(eventemitter.WethWithdrawal, pending)
+
+	if net := om.NetWrapped(owner, 3600); net.Cmp(big.NewInt(70)) != 0 {
+		t.Fatalf("net wrapped in last hour should be 70, got %s", net.String())
+	}
+	if net := om.NetWrapped(owner, 3600*24); net.Cmp(big.NewInt(570)) != 0 {
+		t.Fatalf("net wrapped in last day should be 570, got %s", net.String())
+	}
+
+	withdrawal(owner, "0x06", now, 600)
+	if net := om.NetWrapped(owner, 3600*24); net.Cmp(big.NewInt(-30)) != 0 {
+		t.Fatalf("net wrapped should be -30 after unwrapping more, got %s", net.String())
+	}
+	if net := om.NetWrapped(other, 3600); net.Cmp(big.NewInt(1000)) != 0 {
+		t.Fatalf("other owner net wrapped should be 1000, got %s", net.String())
+	}
+}
@@ -147,7 +147,7 @@ func loadTestData() *TestEntity {
 	}
 
 	e.Tokens = make(map[string]common.Address)
-	for symbol, token := range util.AllTokens {
+	for symbol, token := range util.AllTokens() {
 		e.Tokens[symbol] = token.Protocol
 	}
 
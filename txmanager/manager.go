@@ -19,6 +19,7 @@
 package txmanager
 
 import (
+	"github.com/Loopring/relay/config"
 	"github.com/Loopring/relay/dao"
 	"github.com/Loopring/relay/ethaccessor"
 	"github.com/Loopring/relay/eventemiter"
@@ -29,10 +30,26 @@ import (
 	"github.com/ethereum/go-ethereum/common"
 )
 
+// event types which could be excluded from persistence by config tx_manager.disabled_persistence
+const (
+	PERSISTENCE_APPROVE         = "approve"
+	PERSISTENCE_CANCEL_ORDER    = "cancel_order"
+	PERSISTENCE_CUTOFF          = "cutoff"
+	PERSISTENCE_CUTOFF_PAIR     = "cutoff_pair"
+	PERSISTENCE_WETH_DEPOSIT    = "weth_deposit"
+	PERSISTENCE_WETH_WITHDRAWAL = "weth_withdrawal"
+	PERSISTENCE_TRANSFER        = "transfer"
+	PERSISTENCE_ETH_TRANSFER    = "eth_transfer"
+	PERSISTENCE_ORDER_FILLED    = "order_filled"
+)
+
 type TransactionManager struct {
 	db                         dao.RdsService
+	disabledPersistence        map[string]bool
 	accountmanager             *market.AccountManager
+	approveFailedEventWatcher  *eventemitter.Watcher
 	approveEventWatcher        *eventemitter.Watcher
+	allowanceChangedWatcher    *eventemitter.Watcher
 	orderCancelledEventWatcher *eventemitter.Watcher
 	cutoffAllEventWatcher      *eventemitter.Watcher
 	cutoffPairEventWatcher     *eventemitter.Watcher
@@ -44,10 +61,14 @@ type TransactionManager struct {
 	forkDetectedEventWatcher   *eventemitter.Watcher
 }
 
-func NewTxManager(db dao.RdsService, accountmanager *market.AccountManager) TransactionManager {
+func NewTxManager(db dao.RdsService, accountmanager *market.AccountManager, options *config.TxManagerOptions) TransactionManager {
 	var tm TransactionManager
 	tm.db = db
 	tm.accountmanager = accountmanager
+	tm.disabledPersistence = make(map[string]bool)
+	for _, v := range options.DisabledPersistence {
+		tm.disabledPersistence[v] = true
+	}
 
 	return tm
 }
@@ -55,51 +76,61 @@ func NewTxManager(db dao.RdsService, accountmanager *market.AccountManager) Tran
 // Start start orderbook as a service
 func (tm *TransactionManager) Start() {
 	log.Debugf("transaction manager start...")
-
-	tm.approveEventWatcher = &eventemitter.Watcher{Concurrent: false, Handle: tm.SaveApproveEvent}
-	eventemitter.On(eventemitter.Approve, tm.approveEventWatcher)
-
-	tm.orderCancelledEventWatcher = &eventemitter.Watcher{Concurrent: false, Handle: tm.SaveOrderCancelledEvent}
-	eventemitter.On(eventemitter.CancelOrder, tm.orderCancelledEventWatcher)
-
-	tm.cutoffAllEventWatcher = &eventemitter.Watcher{Concurrent: false, Handle: tm.SaveCutoffAllEvent}
-	eventemitter.On(eventemitter.CutoffAll, tm.cutoffAllEventWatcher)
-
-	tm.cutoffPairEventWatcher = &eventemitter.Watcher{Concurrent: false, Handle: tm.SaveCutoffPairEvent}
-	eventemitter.On(eventemitter.CutoffPair, tm.cutoffPairEventWatcher)
-
-	tm.wethDepositEventWatcher = &eventemitter.Watcher{Concurrent: false, Handle: tm.SaveWethDepositEvent}
-	eventemitter.On(eventemitter.WethDeposit, tm.wethDepositEventWatcher)
-
-	tm.wethWithdrawalEventWatcher = &eventemitter.Watcher{Concurrent: false, Handle: tm.SaveWethWithdrawalEvent}
-	eventemitter.On(eventemitter.WethWithdrawal, tm.wethWithdrawalEventWatcher)
-
-	tm.transferEventWatcher = &eventemitter.Watcher{Concurrent: false, Handle: tm.SaveTransferEvent}
-	eventemitter.On(eventemitter.Transfer, tm.transferEventWatcher)
-
-	tm.ethTransferEventWatcher = &eventemitter.Watcher{Concurrent: false, Handle: tm.SaveEthTransferEvent}
-	eventemitter.On(eventemitter.EthTransferEvent, tm.ethTransferEventWatcher)
-
-	tm.orderFilledEventWatcher = &eventemitter.Watcher{Concurrent: false, Handle: tm.SaveOrderFilledEvent}
-	eventemitter.On(eventemitter.OrderFilled, tm.orderFilledEventWatcher)
+	eventemitter.Declare(eventemitter.TransactionEvent)
+
+	tm.approveEventWatcher = tm.watch(eventemitter.Approve, PERSISTENCE_APPROVE, tm.SaveApproveEvent)
+	tm.approveFailedEventWatcher = tm.watch(eventemitter.ApproveFailed, PERSISTENCE_APPROVE, tm.SaveApproveEvent)
+	tm.allowanceChangedWatcher = tm.watch(eventemitter.AllowanceChanged, PERSISTENCE_APPROVE, tm.SaveAllowanceChangedEvent)
+	tm.orderCancelledEventWatcher = tm.watch(eventemitter.CancelOrder, PERSISTENCE_CANCEL_ORDER, tm.SaveOrderCancelledEvent)
+	tm.cutoffAllEventWatcher = tm.watch(eventemitter.CutoffAll, PERSISTENCE_CUTOFF, tm.SaveCutoffAllEvent)
+	tm.cutoffPairEventWatcher = tm.watch(eventemitter.CutoffPair, PERSISTENCE_CUTOFF_PAIR, tm.SaveCutoffPairEvent)
+	tm.wethDepositEventWatcher = tm.watch(eventemitter.WethDeposit, PERSISTENCE_WETH_DEPOSIT, tm.SaveWethDepositEvent)
+	tm.wethWithdrawalEventWatcher = tm.watch(eventemitter.WethWithdrawal, PERSISTENCE_WETH_WITHDRAWAL, tm.SaveWethWithdrawalEvent)
+	tm.transferEventWatcher = tm.watch(eventemitter.Transfer, PERSISTENCE_TRANSFER, tm.SaveTransferEvent)
+	tm.ethTransferEventWatcher = tm.watch(eventemitter.EthTransferEvent, PERSISTENCE_ETH_TRANSFER, tm.SaveEthTransferEvent)
+	tm.orderFilledEventWatcher = tm.watch(eventemitter.OrderFilled, PERSISTENCE_ORDER_FILLED, tm.SaveOrderFilledEvent)
 
 	tm.forkDetectedEventWatcher = &eventemitter.Watcher{Concurrent: false, Handle: tm.ForkProcess}
 	eventemitter.On(eventemitter.ChainForkDetected, tm.forkDetectedEventWatcher)
 }
 
 func (tm *TransactionManager) Stop() {
-	eventemitter.Un(eventemitter.Approve, tm.approveEventWatcher)
-	eventemitter.Un(eventemitter.CancelOrder, tm.orderCancelledEventWatcher)
-	eventemitter.Un(eventemitter.CutoffAll, tm.cutoffAllEventWatcher)
-	eventemitter.Un(eventemitter.CutoffPair, tm.cutoffPairEventWatcher)
-	eventemitter.Un(eventemitter.WethDeposit, tm.wethDepositEventWatcher)
-	eventemitter.Un(eventemitter.WethWithdrawal, tm.wethWithdrawalEventWatcher)
-	eventemitter.Un(eventemitter.Transfer, tm.transferEventWatcher)
-	eventemitter.Un(eventemitter.EthTransferEvent, tm.ethTransferEventWatcher)
-	eventemitter.Un(eventemitter.OrderFilled, tm.orderFilledEventWatcher)
+	tm.unwatch(eventemitter.Approve, tm.approveEventWatcher)
+	tm.unwatch(eventemitter.ApproveFailed, tm.approveFailedEventWatcher)
+	tm.unwatch(eventemitter.AllowanceChanged, tm.allowanceChangedWatcher)
+	tm.unwatch(eventemitter.CancelOrder, tm.orderCancelledEventWatcher)
+	tm.unwatch(eventemitter.CutoffAll, tm.cutoffAllEventWatcher)
+	tm.unwatch(eventemitter.CutoffPair, tm.cutoffPairEventWatcher)
+	tm.unwatch(eventemitter.WethDeposit, tm.wethDepositEventWatcher)
+	tm.unwatch(eventemitter.WethWithdrawal, tm.wethWithdrawalEventWatcher)
+	tm.unwatch(eventemitter.Transfer, tm.transferEventWatcher)
+	tm.unwatch(eventemitter.EthTransferEvent, tm.ethTransferEventWatcher)
+	tm.unwatch(eventemitter.OrderFilled, tm.orderFilledEventWatcher)
 	eventemitter.Un(eventemitter.ChainForkDetected, tm.forkDetectedEventWatcher)
 }
 
+// watch only subscribe event types whose persistence is enabled, other consumers still receive the event
+func (tm *TransactionManager) watch(topic, persistence string, handle func(input eventemitter.EventData) error) *eventemitter.Watcher {
+	if !tm.PersistenceEnabled(persistence) {
+		log.Infof("transaction manager,persistence of %s disabled", persistence)
+		return nil
+	}
+
+	watcher := &eventemitter.Watcher{Concurrent: false, Handle: handle}
+	eventemitter.On(topic, watcher)
+	return watcher
+}
+
+func (tm *TransactionManager) unwatch(topic string, watcher *eventemitter.Watcher) {
+	if watcher != nil {
+		eventemitter.Un(topic, watcher)
+	}
+}
+
+func (tm *TransactionManager) PersistenceEnabled(persistence string) bool {
+	return !tm.disabledPersistence[persistence]
+}
+
 // todo: check and test
 func (tm *TransactionManager) ForkProcess(input eventemitter.EventData) error {
 	log.Debugf("txmanager,processing chain fork......")
@@ -140,6 +171,24 @@ func (tm *TransactionManager) SaveApproveEvent(input eventemitter.EventData) err
 	return tm.saveTransaction(&entity, list)
 }
 
+func (tm *TransactionManager) SaveAllowanceChangedEvent(input eventemitter.EventData) error {
+	event := input.(*types.AllowanceChangedEvent)
+
+	var (
+		entity txtyp.TransactionEntity
+		list   []txtyp.TransactionView
+	)
+
+	entity.FromAllowanceChangedEvent(event)
+	view, err := txtyp.AllowanceChangedView(event)
+	if err != nil {
+		return err
+	}
+	list = append(list, view)
+
+	return tm.saveTransaction(&entity, list)
+}
+
 func (tm *TransactionManager) SaveOrderCancelledEvent(input eventemitter.EventData) error {
 	event := input.(*types.OrderCancelledEvent)
 
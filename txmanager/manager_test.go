@@ -0,0 +1,85 @@
+/*
+
+  Copyright 2017 Loopring Project Ltd (Loopring Foundation).
+
+  Licensed under the Apache License, Version 2.0 (the "License");
+  you may not use this file except in compliance with the License.
+  You may obtain a copy of the License at
+
+  http://www.apache.org/licenses/LICENSE-2.0
+
+  Unless required by applicable law or agreed to in writing, software
+  distributed under the License is distributed on an "AS IS" BASIS,
+  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+  See the License for the specific language governing permissions and
+  limitations under the License.
+
+*/
+
+package txmanager_test
+
+import (
+	"github.com/Loopring/relay/config"
+	"github.com/Loopring/relay/dao"
+	"github.com/Loopring/relay/eventemiter"
+	"github.com/Loopring/relay/log"
+	"github.com/Loopring/relay/txmanager"
+	"github.com/Loopring/relay/types"
+	"github.com/ethereum/go-ethereum/common"
+	"go.uber.org/zap"
+	"math/big"
+	"testing"
+)
+
+type recordRdsService struct {
+	dao.RdsService
+	added []interface{}
+}
+
+func (s *recordRdsService) Add(item interface{}) error {
+	s.added = append(s.added, item)
+	return nil
+}
+
+func TestTransactionManager_DisabledPersistence(t *testing.T) {
+	zapOpts := zap.NewDevelopmentConfig()
+	zapOpts.Level = zap.NewAtomicLevelAt(zap.ErrorLevel)
+	log.Initialize(config.LogOptions{ZapOpts: zapOpts})
+
+	db := &recordRdsService{}
+	options := &config.TxManagerOptions{DisabledPersistence: []string{txmanager.PERSISTENCE_APPROVE}}
+	tm := txmanager.NewTxManager(db, nil, options)
+	tm.Start()
+	defer tm.Stop()
+
+	if tm.PersistenceEnabled(txmanager.PERSISTENCE_APPROVE) {
+		t.Fatalf("approve persistence should be disabled")
+	}
+	if !tm.PersistenceEnabled(txmanager.PERSISTENCE_ORDER_FILLED) {
+		t.Fatalf("order filled persistence should be enabled")
+	}
+
+	// approval still emitted in memory, but tx manager never stores it
+	received := false
+	watcher := &eventemitter.Watcher{Concurrent: false, Handle: func(input eventemitter.EventData) error {
+		received = true
+		return nil
+	}}
+	eventemitter.On(eventemitter.Approve, watcher)
+	defer eventemitter.Un(eventemitter.Approve, watcher)
+
+	approval := &types.ApprovalEvent{
+		Owner:   common.HexToAddress("0x1b978a1D302335a6F2Ebe4B8823B5E17c3C84135"),
+		Spender: common.HexToAddress("0x17233e07c67d086464fD408148c3ABB56245FA64"),
+		Amount:  big.NewInt(100),
+	}
+	approval.Status = types.TX_STATUS_SUCCESS
+	eventemitter.Emit(eventemitter.Approve, approval)
+
+	if !received {
+		t.Fatalf("approval should still be emitted in memory")
+	}
+	if len(db.added) != 0 {
+		t.Fatalf("approval should not be written, got %d records", len(db.added))
+	}
+}
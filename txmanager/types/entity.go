@@ -46,8 +46,16 @@ type ApproveContent struct {
 	Owner   string `json:"owner"`
 	Spender string `json:"spender"`
 	Amount  string `json:"amount"`
+
+	// increaseApproval等方法只记录授权增量, 为空时amount是授权绝对值
+	Change string `json:"change,omitempty"`
 }
 
+const (
+	APPROVE_CHANGE_INCREASE = "increase"
+	APPROVE_CHANGE_DECREASE = "decrease"
+)
+
 type CancelContent struct {
 	OrderHash string `json:"order_hash"`
 	Amount    string `json:"amount"`
@@ -115,6 +123,28 @@ func (tx *TransactionEntity) FromApproveEvent(src *types.ApprovalEvent) error {
 	return nil
 }
 
+func (tx *TransactionEntity) FromAllowanceChangedEvent(src *types.AllowanceChangedEvent) error {
+	tx.fullFilled(src.TxInfo)
+
+	var content ApproveContent
+	content.Owner = src.Owner.Hex()
+	content.Spender = src.Spender.Hex()
+	content.Amount = src.Delta.String()
+	if src.Increase {
+		content.Change = APPROVE_CHANGE_INCREASE
+	} else {
+		content.Change = APPROVE_CHANGE_DECREASE
+	}
+
+	bs, err := json.Marshal(&content)
+	if err != nil {
+		return err
+	}
+
+	tx.Content = string(bs)
+	return nil
+}
+
 func (tx *TransactionEntity) FromCancelEvent(src *types.OrderCancelledEvent) error {
 	tx.fullFilled(src.TxInfo)
 
@@ -58,6 +58,25 @@ func ApproveView(src *types.ApprovalEvent) (TransactionView, error) {
 	return tx, nil
 }
 
+// amount为授权增量, 是否增加记录在entity content中
+func AllowanceChangedView(src *types.AllowanceChangedEvent) (TransactionView, error) {
+	var (
+		tx  TransactionView
+		err error
+	)
+
+	if tx.Symbol, err = util.GetSymbolWithAddress(src.Protocol); err != nil {
+		return tx, err
+	}
+	tx.fullFilled(src.TxInfo)
+
+	tx.Owner = src.Owner
+	tx.Amount = src.Delta
+	tx.Type = TX_TYPE_APPROVE
+
+	return tx, nil
+}
+
 // 从entity中获取amount&orderHash
 func CancelView(src *types.OrderCancelledEvent) TransactionView {
 	var tx TransactionView
@@ -156,6 +175,9 @@ func TransferView(src *types.TransferEvent) ([]TransactionView, error) {
 	tx2 = tx1
 	tx2.Owner = src.Receiver
 	tx2.Type = TX_TYPE_RECEIVE
+	if src.Received != nil {
+		tx2.Amount = src.Received
+	}
 
 	list = append(list, tx1, tx2)
 	return list, nil
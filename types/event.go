@@ -19,6 +19,7 @@
 package types
 
 import (
+	"bytes"
 	"github.com/ethereum/go-ethereum/common"
 	"math/big"
 )
@@ -64,6 +65,26 @@ func StrToTxStatus(txType string) TxStatus {
 	return ret
 }
 
+const (
+	FILL_ROLE_MAKER = "maker"
+	FILL_ROLE_TAKER = "taker"
+)
+
+const (
+	ORDER_CONSUMED_FILLED    = "filled"
+	ORDER_CONSUMED_CANCELLED = "cancelled"
+	ORDER_CONSUMED_CUTOFF    = "cutoff"
+)
+
+const (
+	EFFECT_TRANSFER_IN  = "transfer_in"
+	EFFECT_TRANSFER_OUT = "transfer_out"
+	EFFECT_APPROVE      = "approve"
+	EFFECT_FILL_SELL    = "fill_sell"
+	EFFECT_FILL_BUY     = "fill_buy"
+	EFFECT_GAS          = "gas"
+)
+
 type TxInfo struct {
 	Protocol        common.Address `json:"from"`
 	DelegateAddress common.Address `json:"to"`
@@ -82,6 +103,50 @@ type TxInfo struct {
 	GasPrice        *big.Int       `json:"gas_price"`
 	Nonce           *big.Int       `json:"nonce"`
 	Identify        string         `json:"identify"`
+
+	// gasPrice为0, gas由第三方代付(meta-transaction/侧链), 手续费为0属正常情况
+	SponsoredTransaction bool `json:"sponsored_transaction"`
+
+	// EIP-1559交易的费用上限, legacy交易为nil; GasPrice为receipt中的effectiveGasPrice
+	MaxFeePerGas         *big.Int `json:"max_fee_per_gas"`
+	MaxPriorityFeePerGas *big.Int `json:"max_priority_fee_per_gas"`
+
+	// ReplayBlocks重新处理历史区块时发出的事件, 下游据此去重
+	Replay bool `json:"replay"`
+}
+
+// Fee 交易实际支付的gas费用, 代付交易及pending交易返回0
+func (info *TxInfo) Fee() *big.Int {
+	if info.GasUsed == nil || info.GasPrice == nil {
+		return big.NewInt(0)
+	}
+	return new(big.Int).Mul(info.GasUsed, info.GasPrice)
+}
+
+func IsSponsoredGasPrice(gasPrice *big.Int) bool {
+	return gasPrice != nil && gasPrice.Sign() == 0
+}
+
+// EventPosition 事件在链上的位置, 分叉回滚及重放时统一按此排序
+type EventPosition struct {
+	BlockNumber int64
+	TxIndex     int64
+	LogIndex    int64
+	TxHash      common.Hash
+}
+
+// Less 依次比较block, txIndex, logIndex, 最后以txhash兜底, 保证排序结果确定
+func (p EventPosition) Less(o EventPosition) bool {
+	if p.BlockNumber != o.BlockNumber {
+		return p.BlockNumber < o.BlockNumber
+	}
+	if p.TxIndex != o.TxIndex {
+		return p.TxIndex < o.TxIndex
+	}
+	if p.LogIndex != o.LogIndex {
+		return p.LogIndex < o.LogIndex
+	}
+	return bytes.Compare(p.TxHash.Bytes(), o.TxHash.Bytes()) < 0
 }
 
 type TokenRegisterEvent struct {
@@ -90,6 +155,20 @@ type TokenRegisterEvent struct {
 	Symbol string
 }
 
+// 可升级token链上decimals变化, decimals为10^n
+type TokenMetadataChangedEvent struct {
+	Token       common.Address
+	Symbol      string
+	OldDecimals *big.Int
+	NewDecimals *big.Int
+}
+
+// token数超出max_tokens时淘汰的token, 与链上unregister无关
+type TokenEvictedEvent struct {
+	Token  common.Address
+	Symbol string
+}
+
 type TokenUnRegisterEvent struct {
 	TxInfo
 	Token  common.Address
@@ -113,6 +192,11 @@ type TransferEvent struct {
 	Sender   common.Address
 	Receiver common.Address
 	Amount   *big.Int
+	Received *big.Int // actual amount receiver got, less than amount for fee-on-transfer tokens
+
+	SelfTransfer bool // sender==receiver, 余额不变, 订阅者不应重复调整
+	Mint         bool // sender为零地址, 增发, 订阅者不应调整零地址余额
+	Burn         bool // receiver为零地址, 销毁, 订阅者不应调整零地址余额
 }
 
 type ApprovalEvent struct {
@@ -122,6 +206,43 @@ type ApprovalEvent struct {
 	Amount  *big.Int
 }
 
+// increaseApproval等方法只修改授权增量, calldata中没有授权的绝对值
+type AllowanceChangedEvent struct {
+	TxInfo
+	Owner    common.Address
+	Spender  common.Address
+	Delta    *big.Int
+	Increase bool
+}
+
+// 链下签名授权, deadline之后授权失效, protocol为token地址
+type PermitApprovalEvent struct {
+	TxInfo
+	Owner    common.Address
+	Spender  common.Address
+	Amount   *big.Int
+	Deadline int64
+}
+
+type AllowanceExpiredEvent struct {
+	Owner     common.Address
+	Token     common.Address
+	Spender   common.Address
+	Amount    *big.Int
+	Deadline  int64
+	BlockTime int64
+}
+
+// delegate被取消授权后, 之前对其的approve不再有意义, protocol为被取消授权的地址
+type AllowanceStaleEvent struct {
+	Owner       common.Address
+	Token       common.Address
+	Spender     common.Address
+	Amount      *big.Int
+	Protocol    common.Address
+	BlockNumber *big.Int
+}
+
 type OrderFilledEvent struct {
 	TxInfo
 	Ringhash      common.Hash
@@ -142,6 +263,23 @@ type OrderFilledEvent struct {
 	SplitB        *big.Int
 	Market        string
 	FillIndex     *big.Int
+	Role          string
+
+	// 成交价相对订单限价的改善比例, 正值表示优于限价
+	Slippage float64
+
+	// 按token精度转换后的成交数量及market价格, 精度未知时为0, 原始金额仍在AmountS/AmountB/LrcFee
+	NormalizedAmountS float64
+	NormalizedAmountB float64
+	NormalizedLrcFee  float64
+	Price             float64
+
+	// 成交实际支付手续费的token, 由链上splitS/splitB/lrcFee确定
+	FeeToken common.Address
+
+	// 买入token的成交总量, 及扣除分润和以买入token支付的手续费后实际到账的数量
+	GrossAmountB *big.Int
+	NetAmountB   *big.Int
 }
 
 type OrderCancelledEvent struct {
@@ -150,6 +288,95 @@ type OrderCancelledEvent struct {
 	AmountCancelled *big.Int
 }
 
+// 订单进入终态(完全成交/取消/cutoff)时发出, amount以订单主币种计算(BuyNoMoreThanAmountB时为tokenB)
+type OrderConsumedEvent struct {
+	OrderHash       common.Hash
+	FilledAmount    *big.Int
+	RemainingAmount *big.Int
+	TerminalReason  string
+	BlockNumber     *big.Int
+}
+
+// 订单从open首次进入部分成交状态时发出, amount计算方式同OrderConsumedEvent
+type OrderPartiallyFilledEvent struct {
+	OrderHash       common.Hash
+	FilledAmount    *big.Int
+	RemainingAmount *big.Int
+	TxHash          common.Hash
+	BlockNumber     *big.Int
+}
+
+// 链上成交与relay接收订单时记录的链下信息关联, OrderId为relay存储的订单id
+type TradeExecutedEvent struct {
+	OrderId         int
+	OrderHash       common.Hash
+	OrderCreateTime int64
+	OrderType       string
+	WalletAddress   common.Address
+	Owner           common.Address
+	Market          string
+	Side            string
+	Ringhash        common.Hash
+	FillIndex       *big.Int
+	AmountS         *big.Int
+	AmountB         *big.Int
+	GrossAmountB    *big.Int
+	NetAmountB      *big.Int
+	TxHash          common.Hash
+	BlockNumber     *big.Int
+	BlockTime       int64
+}
+
+// submitRing中订单重新计算的hash与存储的订单不一致
+type OrderHashMismatchEvent struct {
+	TxInfo
+	OrderHash  common.Hash
+	StoredHash string
+	Owner      common.Address
+	Reason     string
+}
+
+// 解析出的市场不在支持列表中
+type MarketAnomalyEvent struct {
+	Market string
+	TokenS common.Address
+	TokenB common.Address
+	Source string
+	TxHash common.Hash
+	Reason string
+}
+
+// 窗口内某市场taker买入或卖出的成交量占比超过阈值
+type MarketImbalanceEvent struct {
+	Market     string
+	Side       string // 占优的一侧, buy/sell
+	BuyVolume  *big.Int
+	SellVolume *big.Int
+	BuyRatio   float64 // 买入量占买卖总量的比例
+	Window     int64
+	TxHash     common.Hash
+	BlockTime  int64
+}
+
+// 矿工实际收取的lrcFee与按订单lrcFee和成交比例计算的应收值不一致
+type FeeDiscrepancyEvent struct {
+	TxInfo
+	Ringhash    common.Hash
+	OrderHash   common.Hash
+	Owner       common.Address
+	ExpectedFee *big.Int
+	ActualFee   *big.Int
+}
+
+type RingMidPriceEvent struct {
+	TxInfo
+	Ringhash common.Hash
+	Market   string
+	BidPrice *big.Rat
+	AskPrice *big.Rat
+	MidPrice *big.Rat
+}
+
 type CutoffEvent struct {
 	TxInfo
 	Owner         common.Address
@@ -174,9 +401,92 @@ type RingMinedEvent struct {
 	Ringhash     common.Hash
 	Miner        common.Address
 	FeeRecipient common.Address
+	GasCost      *big.Int // 结算交易gasUsed*gasPrice
 	Err          error
 }
 
+// 归一化的转账边, token为NilAddress时表示eth
+type TransferEdgeEvent struct {
+	From        common.Address
+	To          common.Address
+	Token       common.Address
+	Amount      *big.Int
+	BlockNumber *big.Int
+	TxHash      common.Hash
+	LogIndex    int64
+}
+
+// 可暂停的token连续transfer失败时Paused为true, 之后出现成功的transfer时Paused为false
+type TokenPausedEvent struct {
+	TxInfo
+	Token    common.Address
+	Paused   bool
+	Failures int
+}
+
+// token增发或销毁, Delta为供应量变化, 增发为正, 销毁为负. Account为收到增发或被销毁的账户
+type TokenSupplyChangedEvent struct {
+	TxInfo
+	Token   common.Address
+	Account common.Address
+	Mint    bool
+	Delta   *big.Int
+}
+
+// 超出owner限流而未在原topic发出的账户事件, Topic为原事件的topic, Overflowed为该owner自上次放行后累计超出的数量
+type AccountEventOverflowEvent struct {
+	Topic      string
+	Owner      common.Address
+	Event      interface{}
+	Overflowed int
+}
+
+// 重新加载配置后协议合约地址的变化
+type ProtocolSetChangedEvent struct {
+	Added   []common.Address
+	Removed []common.Address
+}
+
+// 合约method/event解析失败, name为method或event名称
+type ExtractorUnpackErrorEvent struct {
+	TxHash      common.Hash
+	BlockNumber *big.Int
+	Name        string
+	Err         error
+}
+
+// extractor停止时被中断的handler调用, name为被中断的db/rpc调用
+type ExtractorHandlerCancelledEvent struct {
+	TxHash common.Hash
+	Name   string
+	Err    error
+}
+
+// 区块时间为0且查询区块头仍无法获取
+type BlockTimeUnavailableEvent struct {
+	TxHash      common.Hash
+	BlockNumber *big.Int
+	Err         error
+}
+
+// 单个块内成交汇总, MarketVolumes为各市场卖单成交的计价token数量, 每笔撮合只计一次
+type BlockFillStatsEvent struct {
+	BlockNumber   *big.Int
+	BlockHash     common.Hash
+	RingCount     int
+	FillCount     int
+	MarketVolumes map[string]*big.Int
+	UniqueOwners  int
+}
+
+// 环路结算交易的链上成本, 矿工据此与预期lrc收益对账
+type RingSettledCostEvent struct {
+	TxInfo
+	Ringhash  common.Hash
+	GasCost   *big.Int
+	FillCount int
+}
+
 type WethDepositEvent struct {
 	TxInfo
 	Dst    common.Address
@@ -215,6 +525,34 @@ type ForkedEvent struct {
 	ForkHash      common.Hash
 }
 
+// 交易处理完毕的边界, 该交易的所有事件均已发出
+type TransactionCompletedEvent struct {
+	TxInfo
+}
+
+type AccountEffect struct {
+	Type         string
+	Token        common.Address
+	Amount       *big.Int
+	Counterparty common.Address
+}
+
+type TransactionEffectsEvent struct {
+	TxInfo
+	Effects map[common.Address][]AccountEffect
+}
+
+// 分叉后交易状态发生变化, NewBlockNumber为nil表示交易已不在主链上
+type TransactionStateChangedEvent struct {
+	TxHash         common.Hash
+	From           common.Address
+	To             common.Address
+	OldStatus      TxStatus
+	NewStatus      TxStatus
+	OldBlockNumber *big.Int
+	NewBlockNumber *big.Int
+}
+
 type BlockEvent struct {
 	BlockNumber *big.Int
 	BlockHash   common.Hash
@@ -269,6 +269,16 @@ type OrderState struct {
 	CancelledAmountB *big.Int    `json:"cancelledAmountB"`
 	Status           OrderStatus `json:"status"`
 	BroadcastTime    int         `json:"broadcastTime"`
+	FirstFilledTime  int64       `json:"firstFilledTime"`
+	RemovedTime      int64       `json:"removedTime"`
+}
+
+// 订单生命周期时间戳, createTime为订单创建时间, 其余取自首次成交及移除(完全成交/取消/cutoff)事件的区块时间
+type OrderLifecycle struct {
+	OrderHash       common.Hash `json:"orderHash"`
+	CreateTime      int64       `json:"createTime"`
+	FirstFilledTime int64       `json:"firstFilledTime"`
+	RemovedTime     int64       `json:"removedTime"`
 }
 
 type OrderDelayList struct {
@@ -34,6 +34,25 @@ type Token struct {
 	Decimals *big.Int       `json:"decimals"`
 	IsMarket bool           `json:"isMarket"`
 	IcoPrice *big.Rat       `json:"icoPrice"`
+
+	// Unverified token is registered tentatively from on chain metadata, but never seen in token register
+	Unverified bool `json:"unverified"`
+
+	// FeeOnTransfer token deducts TransferFeeRate of the value from the receiver
+	FeeOnTransfer   bool     `json:"feeOnTransfer"`
+	TransferFeeRate *big.Rat `json:"transferFeeRate"`
+
+	// Upgradeable token contract may change decimals after upgrade, decimals should be re-read periodically
+	Upgradeable bool `json:"upgradeable"`
+}
+
+// MarketConfig 市场交易对参数, MinAmountS为卖出base token的最小数量(最小单位),
+// PriceDecimals及AmountDecimals为价格和数量的展示精度
+type MarketConfig struct {
+	Market         string   `json:"market"`
+	MinAmountS     *big.Int `json:"minAmountS"`
+	PriceDecimals  int      `json:"priceDecimals"`
+	AmountDecimals int      `json:"amountDecimals"`
 }
 
 type CurrencyMarketCap struct {